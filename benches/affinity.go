@@ -0,0 +1,182 @@
+package benches
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+)
+
+// Affinity selects the CPUs a set of processes may run on, by a CPU list
+// and/or NUMA nodes whose CPUs are added to it
+type Affinity struct {
+	// CPUs is a CPU list as for taskset -c, e.g. "0-3,8"
+	CPUs string `json:"cpus,omitempty"`
+	// Nodes is a list of NUMA nodes in the same format, e.g. "1"
+	Nodes string `json:"nodes,omitempty"`
+}
+
+// AffinityConfig pins the harness, the engine daemons and the engine client
+// processes to CPUs independently, so the results are not distorted by the
+// scheduler migrating them and the contention between daemon and clients can
+// be studied
+type AffinityConfig struct {
+	// Harness pins the bucketbench worker threads
+	Harness *Affinity `json:"harness,omitempty"`
+	Daemon  *Affinity `json:"daemon,omitempty"`
+	// Clients pins the client processes run by the CLI drivers (e.g. docker
+	// or ctr); by default they inherit the harness affinity
+	Clients *Affinity `json:"clients,omitempty"`
+}
+
+// resolve returns the CPUs selected by the affinity of the named processes
+func (a *Affinity) resolve(name string) ([]int, error) {
+	if a.CPUs == "" && a.Nodes == "" {
+		return nil, fmt.Errorf("The %s cpuAffinity requires cpus or nodes", name)
+	}
+	var cpus []int
+	if a.CPUs != "" {
+		list, err := utils.ParseCPUList(a.CPUs)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s cpuAffinity cpus: %v", name, err)
+		}
+		cpus = append(cpus, list...)
+	}
+	if a.Nodes != "" {
+		nodes, err := utils.ParseCPUList(a.Nodes)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s cpuAffinity nodes %q: use NUMA node numbers and ranges, e.g. 0-1", name, a.Nodes)
+		}
+		for _, node := range nodes {
+			list, err := utils.NodeCPUs(node)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s cpuAffinity nodes: %v", name, err)
+			}
+			cpus = append(cpus, list...)
+		}
+	}
+	return uniqueCPUs(cpus), nil
+}
+
+// uniqueCPUs sorts the CPUs and drops duplicates
+func uniqueCPUs(cpus []int) []int {
+	seen := make(map[int]bool)
+	var unique []int
+	for _, cpu := range cpus {
+		if !seen[cpu] {
+			seen[cpu] = true
+			unique = append(unique, cpu)
+		}
+	}
+	sort.Ints(unique)
+	return unique
+}
+
+// String renders the affinity, e.g. "cpus=0-3 nodes=1"
+func (a *Affinity) String() string {
+	var settings []string
+	if a.CPUs != "" {
+		settings = append(settings, "cpus="+a.CPUs)
+	}
+	if a.Nodes != "" {
+		settings = append(settings, "nodes="+a.Nodes)
+	}
+	return strings.Join(settings, " ")
+}
+
+// Validate checks the affinities resolve to CPUs of the host
+func (c *AffinityConfig) Validate() error {
+	for name, a := range map[string]*Affinity{"harness": c.Harness, "daemon": c.Daemon, "clients": c.Clients} {
+		if a == nil {
+			continue
+		}
+		if _, err := a.resolve(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyHarnessAffinity pins the bucketbench threads, and the client processes
+// they start, to the harness and client CPUs
+func ApplyHarnessAffinity(benchmark Benchmark) error {
+	c := benchmark.CPUAffinity
+	if c == nil {
+		return nil
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.Harness != nil {
+		cpus, _ := c.Harness.resolve("harness")
+		// affinities are per thread; threads started later inherit them
+		for _, tid := range utils.TasksOf(os.Getpid()) {
+			if err := utils.SetTaskAffinity(tid, cpus); err != nil {
+				return fmt.Errorf("Error pinning the harness to CPUs %s: %v", utils.FormatCPUList(cpus), err)
+			}
+		}
+	}
+	if c.Clients != nil {
+		cpus, _ := c.Clients.resolve("clients")
+		if err := utils.SetClientAffinity(cpus); err != nil {
+			return fmt.Errorf("Error pinning the engine clients: %v", err)
+		}
+	}
+	return nil
+}
+
+var (
+	affinityMu sync.Mutex
+	// daemonAffinities holds the original affinities of the daemon tasks
+	// which were pinned, to restore them after the benchmark
+	daemonAffinities = make(map[int][]int)
+)
+
+// ApplyDaemonAffinity pins the engine daemons of a driver type to the daemon
+// CPUs; as a daemon may have been restarted, it is pinned before every run.
+// Daemonless drivers are skipped.
+func ApplyDaemonAffinity(benchmark Benchmark, dtype driver.Type) error {
+	if benchmark.CPUAffinity == nil || benchmark.CPUAffinity.Daemon == nil {
+		return nil
+	}
+	cpus, err := benchmark.CPUAffinity.Daemon.resolve("daemon")
+	if err != nil {
+		return err
+	}
+	pids := daemonPids(dtype)
+	if len(pids) == 0 {
+		return skipped(benchmark.Strict, "No daemon processes found for the %s driver; the daemon is not pinned", driver.TypeToString(dtype))
+	}
+	affinityMu.Lock()
+	defer affinityMu.Unlock()
+	for _, pid := range pids {
+		for _, tid := range utils.TasksOf(pid) {
+			previous, err := utils.GetTaskAffinity(tid)
+			if err != nil {
+				return fmt.Errorf("Error reading the CPU affinity of daemon process %d: %v", pid, err)
+			}
+			if err := utils.SetTaskAffinity(tid, cpus); err != nil {
+				return fmt.Errorf("Error pinning daemon process %d to CPUs %s: %v", pid, utils.FormatCPUList(cpus), err)
+			}
+			if _, ok := daemonAffinities[tid]; !ok {
+				daemonAffinities[tid] = previous
+			}
+		}
+	}
+	return nil
+}
+
+// RestoreAffinities restores the original affinities of the daemon tasks
+// which were pinned; tasks which have exited are skipped
+func RestoreAffinities() {
+	affinityMu.Lock()
+	defer affinityMu.Unlock()
+	for tid, previous := range daemonAffinities {
+		utils.SetTaskAffinity(tid, previous)
+		delete(daemonAffinities, tid)
+	}
+}
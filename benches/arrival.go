@@ -0,0 +1,151 @@
+package benches
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+	log "github.com/sirupsen/logrus"
+)
+
+// Arrival patterns
+const (
+	ArrivalUniform = "uniform"
+	ArrivalPoisson = "poisson"
+	ArrivalBursty  = "bursty"
+)
+
+// ArrivalConfig holds the YAML settings of open-loop mode, where iterations
+// start at arrival times generated by a pattern whether or not the previous
+// iterations have completed
+type ArrivalConfig struct {
+	// Pattern is "uniform" (default), "poisson" or "bursty"
+	Pattern string
+	// Rate is the mean number of iterations started per second by each thread
+	Rate float64
+	// DutyCycle is the fraction of each period a bursty pattern is on
+	DutyCycle float64 `yaml:"dutyCycle"`
+	// Period is the length of a bursty pattern's on/off cycle (e.g. "2s")
+	Period string
+}
+
+// arrivalPattern generates the start offsets of successive iterations
+type arrivalPattern struct {
+	pattern string
+	rate    float64
+	duty    float64
+	period  time.Duration
+}
+
+// newArrivalPattern validates the YAML arrival settings
+func newArrivalPattern(config ArrivalConfig) (*arrivalPattern, error) {
+	a := &arrivalPattern{
+		pattern: config.Pattern,
+		rate:    config.Rate,
+		duty:    config.DutyCycle,
+	}
+	if a.pattern == "" {
+		a.pattern = ArrivalUniform
+	}
+	if a.rate <= 0 {
+		return nil, fmt.Errorf("Invalid arrival rate %v: must be a positive number of iterations per second", config.Rate)
+	}
+	switch a.pattern {
+	case ArrivalUniform, ArrivalPoisson:
+	case ArrivalBursty:
+		if a.duty <= 0 || a.duty > 1 {
+			return nil, fmt.Errorf("Invalid arrival dutyCycle %v: must be greater than 0 and at most 1", config.DutyCycle)
+		}
+		var err error
+		if a.period, err = time.ParseDuration(config.Period); err != nil || a.period <= 0 {
+			return nil, fmt.Errorf("Invalid arrival period %q: must be a positive duration such as 2s", config.Period)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown arrival pattern %q; use %q, %q or %q", a.pattern, ArrivalUniform, ArrivalPoisson, ArrivalBursty)
+	}
+	return a, nil
+}
+
+// offsets returns a function generating the offset from the start of the run
+// of each successive arrival
+func (a *arrivalPattern) offsets(seed int64) func() time.Duration {
+	rnd := rand.New(rand.NewSource(seed))
+	var next float64 // seconds
+	return func() time.Duration {
+		current := next
+		switch a.pattern {
+		case ArrivalPoisson:
+			next += rnd.ExpFloat64() / a.rate
+		case ArrivalBursty:
+			// arrivals are compressed into the on phase of each period so
+			// the mean rate over a period is unchanged
+			period := a.period.Seconds()
+			next += a.duty / a.rate
+			if phase := next - float64(int(next/period))*period; phase >= a.duty*period {
+				next += period - phase
+			}
+		default:
+			next += 1 / a.rate
+		}
+		return time.Duration(current * float64(time.Second))
+	}
+}
+
+// openLoopThread starts the iterations of one thread at the arrival times of
+// the pattern, each in its own goroutine, so a slow engine builds up a queue
+// of in-flight iterations rather than slowing the arrivals down. Drivers are
+// reused between iterations which do not overlap.
+func (cb *CustomBench) openLoopThread(ctx context.Context, drv driver.Driver, threadNum, threads, iterations int, commands []string, stats chan RunStatistics) {
+	var (
+		benchName = cb.Info()
+		next      = cb.arrival.offsets(time.Now().UnixNano() + int64(threadNum))
+		idle      = []driver.Driver{drv}
+		idleMu    sync.Mutex
+		wg        sync.WaitGroup
+	)
+	cb.rampDelay(ctx, threadNum, threads)
+	start := time.Now()
+	for i := 0; i < iterations && ctx.Err() == nil; i++ {
+		gate.wait()
+		select {
+		case <-time.After(time.Until(start.Add(next()))):
+		case <-ctx.Done():
+			continue
+		}
+		idleMu.Lock()
+		var iterDrv driver.Driver
+		if n := len(idle); n > 0 {
+			iterDrv, idle = idle[n-1], idle[:n-1]
+		}
+		idleMu.Unlock()
+		if iterDrv == nil {
+			var err error
+			if iterDrv, err = driver.New(cb.driver.Type(), cb.driverConfig); err != nil {
+				log.Errorf("Error creating driver for open-loop iteration %d of thread %d: %v", i, threadNum, err)
+				continue
+			}
+		}
+		wg.Add(1)
+		go func(i int, iterDrv driver.Driver) {
+			defer wg.Done()
+			raisePeak(&cb.peakInFlight, atomic.AddInt64(&cb.inFlight, 1))
+			stats <- cb.tracedIteration(ctx, iterDrv, benchName, threadNum, threads, i, commands)
+			atomic.AddInt64(&cb.inFlight, -1)
+			idleMu.Lock()
+			idle = append(idle, iterDrv)
+			idleMu.Unlock()
+		}(i, iterDrv)
+	}
+	wg.Wait()
+	for _, d := range idle {
+		if err := d.Close(cleanupContext(ctx)); err != nil {
+			log.Errorf("error on closing driver: %v", err)
+		}
+	}
+	close(stats)
+	cb.wg.Done()
+}
@@ -0,0 +1,79 @@
+package benches
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	backoffInitial = 100 * time.Millisecond
+	backoffMax     = 10 * time.Second
+)
+
+// daemonBackoff holds all worker threads of a benchmark run off an unavailable
+// daemon with exponential backoff, and records the gaps this leaves in the run
+type daemonBackoff struct {
+	sync.Mutex
+	delay   time.Duration
+	until   time.Time
+	outages int
+	total   time.Duration
+}
+
+// wait blocks while the run is backing off from an unavailable daemon, or
+// until ctx is canceled
+func (b *daemonBackoff) wait(ctx context.Context) {
+	b.Lock()
+	until := b.until
+	b.Unlock()
+	if d := time.Until(until); d > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(d):
+		}
+	}
+}
+
+// failed records a daemon-unavailable error; failures reported by other
+// threads during the current backoff window do not extend it further
+func (b *daemonBackoff) failed() {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	if now.Before(b.until) {
+		return
+	}
+	if b.delay == 0 {
+		b.outages++
+		b.delay = backoffInitial
+	} else if b.delay *= 2; b.delay > backoffMax {
+		b.delay = backoffMax
+	}
+	b.until = now.Add(b.delay)
+	b.total += b.delay
+	log.Warnf("Daemon unavailable; pausing workers for %v", b.delay)
+}
+
+// paused returns the time the run has spent backing off up to now, which is
+// not part of the run's duration
+func (b *daemonBackoff) paused(now time.Time) time.Duration {
+	b.Lock()
+	defer b.Unlock()
+	if now.Before(b.until) {
+		return b.total - b.until.Sub(now)
+	}
+	return b.total
+}
+
+// succeeded resets the backoff once the daemon responds again
+func (b *daemonBackoff) succeeded() {
+	b.Lock()
+	defer b.Unlock()
+	if b.delay != 0 {
+		log.Infof("Daemon available again; resuming workers")
+		b.delay = 0
+	}
+}
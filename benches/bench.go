@@ -1,7 +1,11 @@
 package benches
 
 import (
+	"context"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/estesp/bucketbench/driver"
@@ -17,8 +21,50 @@ type Type int
 // Each "step" from the benchmark is named and a map of the name
 // to a millisecond duration for that step is provided
 type RunStatistics struct {
-	Durations map[string]int
-	Errors    map[string]int
+	// Thread and Iteration identify the iteration within the run, and Start
+	// is the milliseconds from the start of the run to its start
+	Thread    int            `json:"thread"`
+	Iteration int            `json:"iteration"`
+	Start     int            `json:"start"`
+	Durations map[string]int `json:"durations"`
+	Errors    map[string]int `json:"errors,omitempty"`
+	// UserTimes and SysTimes hold the user and system CPU milliseconds of the
+	// client process for each step; only exec-based drivers provide them
+	UserTimes map[string]int `json:"userTimes,omitempty"`
+	SysTimes  map[string]int `json:"sysTimes,omitempty"`
+	// Nanos holds the nanoseconds of each step in exact mode, timed by the
+	// driver between the start and stop points of its milliseconds
+	Nanos map[string]int64 `json:"nanos,omitempty"`
+	// GCPauseMicros holds the microseconds of each step during which the
+	// harness was paused by its garbage collector; steps without a pause
+	// are left out
+	GCPauseMicros map[string]int `json:"gcPauseMicros,omitempty"`
+	// RunQueueMicros holds the microseconds the threads of the engine
+	// daemons spent runnable but waiting for a CPU during each step, summed
+	// over the threads, with schedDelay
+	RunQueueMicros map[string]int `json:"runQueueMicros,omitempty"`
+	// Concurrency holds the number of operations of the run in flight,
+	// across all threads and including the step itself, when each step
+	// started
+	Concurrency map[string]int `json:"concurrency,omitempty"`
+	// ErrorClasses holds the class of the error of each failed step (see
+	// driver.ClassifyError), e.g. "timeout" or "daemon unavailable"
+	ErrorClasses map[string]string `json:"errorClasses,omitempty"`
+	// Retries holds the number of times each step was retried after a
+	// failure; a step which succeeded on a retry is not counted in Errors
+	Retries map[string]int `json:"retries,omitempty"`
+	// Traces holds the paths of the trace files of the iteration's container
+	// when tracing is enabled
+	Traces []string `json:"traces,omitempty"`
+	// VerifyFailures counts the verify steps of the iteration which failed;
+	// they are not counted in Errors as no operation failed
+	VerifyFailures int `json:"verifyFailures,omitempty"`
+	// spans holds the start and end of each step, to attribute the GC
+	// pauses of the harness to them
+	spans map[string]gcPause
+	// interrupted marks an iteration canceled before its container was
+	// created, which is left out of the results
+	interrupted bool
 }
 
 // Benchmark is the object form of a YAML-defined custom benchmark
@@ -28,9 +74,477 @@ type Benchmark struct {
 	Image    string
 	Command  string //optionally override the default image CMD/ENTRYPOINT
 	RootFs   string
+	SIF      string //optional SIF image path for the Apptainer driver
 	Detached bool
 	Drivers  []DriverConfig
 	Commands []string
+	// ExecCommand is the command run in the container by the exec command
+	ExecCommand string `yaml:"execCommand"`
+	// ReadyCommand is run in the container of a serverless invocation
+	// until it succeeds, timing the ready phase
+	ReadyCommand string `yaml:"readyCommand"`
+	// PurgeImage removes the image from the engine before every iteration
+	// and pulls it again as a timed step, so each iteration measures a cold
+	// start
+	PurgeImage bool `yaml:"purgeImageBetweenIterations"`
+	// EnsureImage makes sure the image is "present" on each engine before
+	// its runs, pulling it if needed, or "absent", removing it before each
+	// run so the first iterations start cold; by default the image is used
+	// as the engine has it
+	EnsureImage string `yaml:"ensureImage"`
+	// RestartDaemon restarts the engine daemon before running each
+	// driver configuration so no state carries over between them
+	RestartDaemon bool `yaml:"restartDaemonBetweenConfigs"`
+	// Schedule selects how driver runs are ordered: "serial" (default)
+	// or "interleaved"
+	Schedule string
+	// PerfCounters collects CPU cycles, instructions and context switches
+	// of the engine daemons and client processes via `perf stat`
+	PerfCounters bool `yaml:"perfCounters"`
+	// EnergyMeter measures energy used during each run: "rapl" for Intel
+	// RAPL counters, or a command printing a cumulative joules counter
+	EnergyMeter string `yaml:"energyMeter"`
+	// MonitorInterval enables sampling of the engine daemons' CPU, memory,
+	// open files and threads at this interval (e.g. "500ms")
+	MonitorInterval string `yaml:"monitorInterval"`
+	// SchedDelay records the run queue delay of the engine daemons' threads
+	// during each operation, from their schedstat
+	SchedDelay bool `yaml:"schedDelay"`
+	// Collectors enables telemetry collectors by name (e.g. "psi"); the
+	// perf, daemon and energy collectors are also enabled by their options
+	Collectors []string
+	// StackSampling samples the goroutine stacks of the engine daemon
+	// during each run and reports the stacks most often blocked on locks;
+	// the same as listing the stacks collector, with settings
+	StackSampling *StackSamplingConfig `yaml:"stackSampling"`
+	// Prometheus optionally exports progress and results to Prometheus;
+	// shorthand for a prometheus entry in Outputs
+	Prometheus *PrometheusConfig
+	// Outputs lists additional sinks the results are written to
+	Outputs []OutputConfig
+	// Type selects the benchmark: "custom" (default) runs the Commands
+	// against containers of Image; "pull" measures pulls of Images;
+	// "fairness" runs the Commands as a sensitive and a bulk tenant;
+	// "serverless" times the phases of FaaS-style invocations of Image;
+	// "mix" runs the weighted operations of Mix
+	Type string
+	// Mix holds the weights of the operations of a mix benchmark, keyed by
+	// a command or a sequence of commands joined by "+" (e.g. "stop+remove")
+	Mix map[string]float64
+	// Images lists the image references (including any registry host)
+	// pulled by a pull benchmark; defaults to Image
+	Images []string
+	// PullScenarios selects "cold" pulls (image removed first) and/or
+	// "warm" pulls (image and layers already present); defaults to both
+	PullScenarios []string `yaml:"pullScenarios"`
+	// Exact times every operation in nanoseconds so statistics are
+	// computed on exact samples rather than whole milliseconds
+	Exact bool `yaml:"exactTimings"`
+	// ForceClean makes the driver cleanup kill the containers of earlier
+	// runs without waiting for their graceful termination (Kubelet)
+	ForceClean bool `yaml:"forceClean"`
+	// Strict fails the benchmark when a driver would skip a setting or
+	// operation of the benchmark (e.g. labels on a driver without label
+	// support, or an operation it only stubs), instead of warning and
+	// recording the run without it
+	Strict bool
+	// Arrival enables open-loop mode, starting iterations at the arrival
+	// times of a pattern rather than back-to-back
+	Arrival *ArrivalConfig
+	// Rate limits each thread to this many iterations per second, keeping
+	// the load steady rather than running iterations back-to-back
+	Rate float64
+	// Ramp staggers the start of the threads of a run evenly over this
+	// window (e.g. "10s") instead of starting them all at once
+	Ramp string
+	// Overlap keeps the containers of this many iterations of each thread
+	// alive: the stop and remove commands of an iteration are deferred until
+	// as many newer containers are up, for sustained concurrency
+	Overlap int
+	// Retries retries each operation failing with a nonzero exit, an
+	// unreachable daemon or another transient error up to this many times,
+	// with a growing delay, before counting it as an error; timeouts and
+	// name conflicts are never retried
+	Retries int
+	// MaxSamples bounds the memory of long, high-rate runs: the statistics
+	// of every iteration are folded into streaming summaries (quantiles are
+	// t-digest estimates) and only a uniform sample of at most this many
+	// iterations is kept; 0 keeps every iteration
+	MaxSamples int `yaml:"maxSamples"`
+	// CleanRate limits the containers removed by the driver cleanup before
+	// and after each run to this many per second; 0 removes them as fast as
+	// the engine allows
+	CleanRate float64 `yaml:"cleanRate"`
+	// PullRate limits the image pulls preparing a run (ensureImage,
+	// pinImageDigest, the validation pulls of a pull benchmark) to this many
+	// per second; timed pulls are not limited
+	PullRate float64 `yaml:"pullRate"`
+	// PinImageDigest resolves the image tag to the digest of the image on
+	// each engine (pulling it if needed) before running, runs every
+	// operation against the digest and records it in the results
+	PinImageDigest bool `yaml:"pinImageDigest"`
+	// Verify holds the checks run by the verify command
+	Verify *VerifyConfig
+	// TraceDir is the directory the traces of the containers are written to
+	// when tracing is enabled (--trace); defaults to DefaultTraceDir, or the
+	// traces directory of the output directory
+	TraceDir string `yaml:"traceDir"`
+	// RunID isolates concurrent bucketbench invocations on one host: the
+	// containers are named bb-<runID>-... and driver cleanup only removes
+	// containers of the same run ID
+	RunID string `yaml:"runID"`
+	// Preflight holds the free resources checked before the benchmark runs
+	Preflight *PreflightConfig
+	// Tunables holds the limits and kernel tunables checked before the
+	// benchmark runs
+	Tunables *TunablesConfig
+	// Priority holds the CPU and IO priorities of the harness, the engine
+	// daemons and the container workloads
+	Priority *PriorityConfig
+	// CPUAffinity pins the harness, the engine daemons and the engine client
+	// processes to CPUs or NUMA nodes
+	CPUAffinity *AffinityConfig `yaml:"cpuAffinity"`
+	// HarnessGC tunes the garbage collector of bucketbench; when set, its
+	// pauses during each run are reported in the run metrics
+	HarnessGC *HarnessGCConfig `yaml:"harnessGC"`
+	// LabelContainers labels every container with the run ID and benchmark
+	// name, for drivers which support labels
+	LabelContainers bool `yaml:"labelContainers"`
+	// Resources holds the resource limits of every container, for drivers
+	// which support them
+	Resources *ResourcesConfig
+	// EngineFlags are extra flags passed to the run command of the CLI
+	// drivers (docker, podman, nerdctl), e.g. "--pids-limit 100"
+	EngineFlags string `yaml:"engineFlags"`
+	// Network is the network mode of every container: bridge, host or
+	// none; the engine's default if empty
+	Network string
+	// Ports are container ports published on random host ports, e.g. 80 or
+	// 53/udp, to include the port forwarding setup in the run
+	Ports []string
+	// Mounts are mounted into every container, to deliberately include the
+	// storage driver and mount propagation overhead in the measurements
+	Mounts []MountConfig
+	// User is the user every container's process runs as: a name or uid,
+	// optionally with ":group" or ":gid", e.g. "1000:1000", to include the
+	// cost of user remapping or ownership changes on start
+	User string
+}
+
+// MountConfig holds a mount of a benchmark's containers
+type MountConfig struct {
+	// Type is bind (default), volume or tmpfs
+	Type string
+	// Source is the host path of a bind mount or the name of a volume
+	Source string
+	// Target is the absolute path of the mount in the container
+	Target   string
+	ReadOnly bool `yaml:"readOnly"`
+	// Propagation is the propagation of a bind mount: private, rprivate,
+	// shared, rshared, slave or rslave
+	Propagation string
+}
+
+// ResourcesConfig holds the resource limits of a benchmark's containers
+type ResourcesConfig struct {
+	// CPUs is the number of CPUs a container may use, e.g. 0.5
+	CPUs float64 `yaml:"cpus"`
+	// Memory is the memory limit, in bytes or with a k, m or g suffix, e.g. 64m
+	Memory string
+	// CgroupParent is the cgroup under which the containers' cgroups are created
+	CgroupParent string `yaml:"cgroupParent"`
+}
+
+// runIDPattern restricts run IDs to names valid for every engine; without
+// dashes no run's name prefix can be the prefix of another run's names
+var runIDPattern = regexp.MustCompile(`^[a-z0-9]{1,32}$`)
+
+// NamePrefix returns the prefix of the names of the benchmark's containers:
+// bb-<runID>- with a run ID, or driver.DefaultNamePrefix without one
+func (b Benchmark) NamePrefix() (string, error) {
+	if b.RunID == "" {
+		return driver.DefaultNamePrefix, nil
+	}
+	if !runIDPattern.MatchString(b.RunID) || driver.DefaultNamePrefix == "bb-"+b.RunID+"-" {
+		return "", fmt.Errorf("Invalid run ID %q: use up to 32 lowercase letters and digits, other than \"ctr\"", b.RunID)
+	}
+	return "bb-" + b.RunID + "-", nil
+}
+
+// Container labels set by labelContainers
+const (
+	LabelRunID     = "bucketbench/run-id"
+	LabelBenchmark = "bucketbench/benchmark"
+)
+
+// labelValuePattern matches the characters not allowed in label values by
+// the strictest engines (Kubernetes)
+var labelValuePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ContainerLabels returns the labels of the benchmark's containers, or nil
+// unless labelContainers is set. The benchmark name is reduced to a valid
+// Kubernetes label value, which also keeps it a single CLI argument.
+func (b Benchmark) ContainerLabels() map[string]string {
+	if !b.LabelContainers {
+		return nil
+	}
+	labels := make(map[string]string)
+	if b.RunID != "" {
+		labels[LabelRunID] = b.RunID
+	}
+	name := labelValuePattern.ReplaceAllString(b.Name, "-")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	if name = strings.Trim(name, "._-"); name != "" {
+		labels[LabelBenchmark] = name
+	}
+	return labels
+}
+
+// memoryPattern matches memory sizes such as 1048576, 64m or 1.5GiB
+var memoryPattern = regexp.MustCompile(`^(?i)([0-9]+(?:\.[0-9]+)?)\s*([kmgt]?)(?:i?b)?$`)
+
+// ContainerResources returns the resource limits of the benchmark's containers
+func (b Benchmark) ContainerResources() (driver.Resources, error) {
+	if b.Resources == nil {
+		return driver.Resources{}, nil
+	}
+	resources := driver.Resources{
+		CPUs:         b.Resources.CPUs,
+		CgroupParent: b.Resources.CgroupParent,
+	}
+	if resources.CPUs < 0 {
+		return resources, fmt.Errorf("Invalid cpus limit %v: must be a positive number of CPUs", resources.CPUs)
+	}
+	if strings.ContainsAny(resources.CgroupParent, " \t") {
+		return resources, fmt.Errorf("Invalid cgroupParent %q: must not contain spaces", resources.CgroupParent)
+	}
+	if b.Resources.Memory != "" {
+		var ok bool
+		if resources.Memory, ok = parseMemory(b.Resources.Memory); !ok {
+			return resources, fmt.Errorf("Invalid memory limit %q: use bytes or a size such as 64m", b.Resources.Memory)
+		}
+	}
+	return resources, nil
+}
+
+// parseMemory returns the bytes of a memory size matching memoryPattern
+func parseMemory(size string) (int64, bool) {
+	match := memoryPattern.FindStringSubmatch(strings.TrimSpace(size))
+	if match == nil {
+		return 0, false
+	}
+	n, _ := strconv.ParseFloat(match[1], 64)
+	shift := map[string]uint{"": 0, "k": 10, "m": 20, "g": 30, "t": 40}[strings.ToLower(match[2])]
+	return int64(n * float64(uint64(1)<<shift)), true
+}
+
+// portPattern matches the container ports which can be published
+var portPattern = regexp.MustCompile(`^([0-9]{1,5})(/(tcp|udp|sctp))?$`)
+
+// ValidateNetwork checks the network mode and published ports of the benchmark
+func (b Benchmark) ValidateNetwork() error {
+	switch b.Network {
+	case "", driver.NetworkBridge, driver.NetworkHost, driver.NetworkNone:
+	default:
+		return fmt.Errorf("Invalid network %q: use bridge, host or none", b.Network)
+	}
+	for _, port := range b.Ports {
+		match := portPattern.FindStringSubmatch(port)
+		if match == nil {
+			return fmt.Errorf("Invalid port %q: use a container port such as 80 or 53/udp; concurrent containers are published on random host ports", port)
+		}
+		if n, _ := strconv.Atoi(match[1]); n == 0 || n > 65535 {
+			return fmt.Errorf("Invalid port %q: must be between 1 and 65535", port)
+		}
+	}
+	if len(b.Ports) > 0 && (b.Network == driver.NetworkHost || b.Network == driver.NetworkNone) {
+		return fmt.Errorf("Ports are only published with the bridge network, not with network %q", b.Network)
+	}
+	return nil
+}
+
+// userPattern matches a user name or uid, optionally with a group name or gid
+var userPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?$`)
+
+// ValidateUser checks the user of the benchmark's containers
+func (b Benchmark) ValidateUser() error {
+	if b.User != "" && !userPattern.MatchString(b.User) {
+		return fmt.Errorf("Invalid user %q: use a name or uid, optionally followed by :group or :gid, e.g. 1000:1000", b.User)
+	}
+	return nil
+}
+
+// ContainerMounts returns the mounts of the benchmark's containers
+func (b Benchmark) ContainerMounts() ([]driver.Mount, error) {
+	var mounts []driver.Mount
+	for _, m := range b.Mounts {
+		mount := driver.Mount{
+			Type:        m.Type,
+			Source:      m.Source,
+			Target:      m.Target,
+			ReadOnly:    m.ReadOnly,
+			Propagation: m.Propagation,
+		}
+		if mount.Type == "" {
+			mount.Type = driver.MountBind
+		}
+		switch mount.Type {
+		case driver.MountBind, driver.MountVolume, driver.MountTmpfs:
+		default:
+			return nil, fmt.Errorf("Invalid mount type %q: use bind, volume or tmpfs", m.Type)
+		}
+		if !strings.HasPrefix(mount.Target, "/") {
+			return nil, fmt.Errorf("Invalid mount target %q: must be an absolute path", m.Target)
+		}
+		if mount.Type != driver.MountTmpfs && mount.Source == "" {
+			return nil, fmt.Errorf("The %s mount of %s requires a source", mount.Type, m.Target)
+		}
+		if mount.Type == driver.MountBind && !strings.HasPrefix(mount.Source, "/") {
+			return nil, fmt.Errorf("Invalid bind mount source %q: must be an absolute path", m.Source)
+		}
+		// the mounts are passed as single CLI arguments
+		if strings.ContainsAny(mount.Source+mount.Target, " \t,") {
+			return nil, fmt.Errorf("Invalid mount of %q: source and target must not contain spaces or commas", m.Target)
+		}
+		switch mount.Propagation {
+		case "":
+		case "private", "rprivate", "shared", "rshared", "slave", "rslave":
+			if mount.Type != driver.MountBind {
+				return nil, fmt.Errorf("Invalid mount of %q: propagation only applies to bind mounts", m.Target)
+			}
+		default:
+			return nil, fmt.Errorf("Invalid mount propagation %q: use private, rprivate, shared, rshared, slave or rslave", m.Propagation)
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
+
+// Pull scenarios
+const (
+	PullCold = "cold"
+	PullWarm = "warm"
+)
+
+// Image states guaranteed with ensureImage
+const (
+	ImagePresent = "present"
+	ImageAbsent  = "absent"
+)
+
+// BenchType returns the benchmark type selected in the YAML
+func (b Benchmark) BenchType() (Type, error) {
+	switch strings.ToLower(b.Type) {
+	case "", "custom":
+		return Custom, nil
+	case "pull":
+		return Pull, nil
+	case "fairness":
+		return Fairness, nil
+	case "serverless":
+		return Serverless, nil
+	case "mix":
+		return Mix, nil
+	default:
+		return Custom, fmt.Errorf("Unknown benchmark type %q; use \"custom\", \"pull\", \"fairness\", \"serverless\" or \"mix\"", b.Type)
+	}
+}
+
+// Steps returns the names of the steps reported by the benchmark type
+func (b Benchmark) Steps() []string {
+	benchType, _ := b.BenchType()
+	switch benchType {
+	case Pull:
+		steps, _ := b.PullSteps()
+		return steps
+	case Fairness:
+		return FairnessSteps(b.Commands)
+	case Serverless:
+		return ServerlessSteps
+	case Mix:
+		return MixSteps(b.Mix)
+	default:
+		if b.PurgeImage {
+			return append([]string{phasePull}, b.Commands...)
+		}
+		return b.Commands
+	}
+}
+
+// PullImages returns the images pulled by a pull benchmark
+func (b Benchmark) PullImages() []string {
+	if len(b.Images) > 0 {
+		return b.Images
+	}
+	if b.Image != "" {
+		return []string{b.Image}
+	}
+	return nil
+}
+
+// PullSteps returns the names of the timed steps of a pull benchmark, one per
+// scenario and image, e.g. "cold alpine:latest"
+func (b Benchmark) PullSteps() ([]string, error) {
+	scenarios := b.PullScenarios
+	if len(scenarios) == 0 {
+		scenarios = []string{PullCold, PullWarm}
+	}
+	var steps []string
+	for _, scenario := range scenarios {
+		if scenario != PullCold && scenario != PullWarm {
+			return nil, fmt.Errorf("Unknown pull scenario %q; use %q or %q", scenario, PullCold, PullWarm)
+		}
+		for _, image := range b.PullImages() {
+			steps = append(steps, scenario+" "+image)
+		}
+	}
+	return steps, nil
+}
+
+// PrometheusConfig holds the YAML settings of the Prometheus exporter
+type PrometheusConfig struct {
+	// Listen is the address of an embedded /metrics endpoint (e.g. ":9110"),
+	// or of the /events endpoint of an sse sink
+	Listen string
+	// Pushgateway is the URL of a Prometheus Pushgateway to push the
+	// final metrics to at the end of the benchmark
+	Pushgateway string
+	// Job is the Pushgateway job name; defaults to "bucketbench"
+	Job string
+}
+
+// OutputConfig holds the YAML settings of one result sink; which fields
+// apply depends on the type
+type OutputConfig struct {
+	// Type selects the sink: "console", "file", "prometheus", "influx",
+	// "graphite", "webhook", "s3", "sse", "history", "otlp" or a type
+	// registered with output.RegisterSink
+	Type string
+	// Format of a console ("text" or "json") or file ("text", "json" or
+	// "csv") sink; a file's format defaults to the one of its extension
+	Format string
+	// Path of a file sink, or the database of a history sink
+	Path string
+	// URL of a webhook or InfluxDB server, the host:port of a Graphite
+	// server, the endpoint of an S3-compatible service, or the base URL of
+	// an OTLP/HTTP collector
+	URL string
+	// Headers are added to webhook, InfluxDB and OTLP requests, e.g. for an
+	// Authorization token
+	Headers map[string]string
+	// Database is the InfluxDB database the points are written to
+	Database string
+	// Bucket, Key and Region locate the object written by an s3 sink
+	Bucket string
+	Key    string
+	Region string
+	// Window is the aggregation interval of an sse sink, e.g. 500ms;
+	// defaults to 1s
+	Window string
+	// PrometheusConfig holds the settings of a prometheus sink
+	PrometheusConfig `yaml:",inline"`
 }
 
 // DriverConfig contains the YAML-defined parameters for running a
@@ -40,6 +554,173 @@ type DriverConfig struct {
 	Binary     string //optional path to specific client binary
 	Threads    int
 	Iterations int
+	// DaemonService optionally overrides the systemd unit restarted
+	// when restartDaemonBetweenConfigs is set
+	DaemonService string `yaml:"daemonService"`
+	// DataRoot optionally overrides the engine data root whose free disk
+	// space is checked by the preflight
+	DataRoot string `yaml:"dataRoot"`
+	// SandboxConfig is a JSON pod sandbox config template (CRI and Crictl
+	// drivers only)
+	SandboxConfig string `yaml:"sandboxConfig"`
+	// SandboxMode selects whether the CRI driver creates a "fresh" pod sandbox
+	// per container (default) or runs all of a thread's containers in one
+	// "shared" persistent sandbox
+	SandboxMode string `yaml:"sandboxMode"`
+	// ManifestDir is the static pod manifest directory of the kubelet
+	// (Kubelet driver only)
+	ManifestDir string `yaml:"manifestDir"`
+	// CRISocket is the socket of the CRI runtime beneath the kubelet, which
+	// forceClean kills the pods through (Kubelet driver only)
+	CRISocket string `yaml:"criSocket"`
+	// Mode selects how the Containerd driver talks to containerd: "api"
+	// (default) for the gRPC client, or "cli" for the ctr binary
+	Mode string
+	// Runtime selects the OCI runtime for the Docker and DockerAPI drivers
+	// (e.g. runsc, kata-runtime) or the runtime name for the Containerd and
+	// Nerdctl drivers
+	Runtime string
+	// Nested runs the DockerAPI driver against a Docker engine started in a
+	// container on the host engine: "dind" (privileged Docker-in-Docker) or
+	// "sysbox" (unprivileged, under the sysbox-runc runtime)
+	Nested string
+	// NestedImage is the image of the nested engine; defaults to docker:dind
+	NestedImage string `yaml:"nestedImage"`
+	// KernelImage and RootDrive are the paths of the kernel image and root
+	// drive of the microVMs of the Firecracker driver
+	KernelImage string `yaml:"kernelImage"`
+	RootDrive   string `yaml:"rootDrive"`
+	// OperationTimeout optionally bounds each container operation (e.g. "30s");
+	// an operation which exceeds it is counted as an error for the iteration
+	OperationTimeout string `yaml:"operationTimeout"`
+	// StreamProcessors are added to containerd's config (ContainerdConfig,
+	// by default /etc/containerd/config.toml) while this configuration runs
+	// (Containerd, Ctr and Nerdctl drivers only)
+	StreamProcessors []driver.StreamProcessor `yaml:"streamProcessors"`
+	ContainerdConfig string                   `yaml:"containerdConfig"`
+	// Templates are the command lines of the operations of the Generic
+	// driver, e.g. "crun run -d --bundle {{.Image}} {{.Name}}"
+	Templates *driver.GenericTemplates
+	// Version labels the results of this configuration with the version of
+	// its engine, as "[version:X]"
+	Version string
+	// Image overrides the benchmark's image for this configuration, e.g. to
+	// compare images of different layer counts (not used by pull benchmarks)
+	Image string
+	// Matrix runs this configuration once per entry, one after the other,
+	// each with its own engine binary, for a version-trend table of the
+	// builds of an engine (see ExpandMatrix)
+	Matrix []MatrixEntry
+	// Env sets environment variables (e.g. DOCKER_HOST, CONTAINERD_NAMESPACE,
+	// XDG_RUNTIME_DIR) while this configuration runs, for every command the
+	// driver executes and for API clients configured from the environment
+	Env map[string]string
+}
+
+// Containerd driver modes
+const (
+	ModeAPI = "api"
+	ModeCLI = "cli"
+)
+
+// CRI driver sandbox modes
+const (
+	SandboxFresh  = "fresh"
+	SandboxShared = "shared"
+)
+
+// DriverType returns the driver type for this driver configuration, taking
+// the containerd mode into account
+func (dc DriverConfig) DriverType() (driver.Type, error) {
+	dtype, err := dc.modeType()
+	if err != nil {
+		return dtype, err
+	}
+	if dc.Runtime != "" && dtype != driver.Docker && dtype != driver.DockerAPI && dtype != driver.Containerd && dtype != driver.Nerdctl {
+		return dtype, fmt.Errorf("runtime is only supported by the Docker, DockerAPI, Containerd (api mode) and Nerdctl drivers")
+	}
+	if (dc.KernelImage != "" || dc.RootDrive != "") && dtype != driver.Firecracker {
+		return dtype, fmt.Errorf("kernelImage and rootDrive are only supported by the Firecracker driver")
+	}
+	if len(dc.StreamProcessors) > 0 {
+		if dtype != driver.Containerd && dtype != driver.Ctr && dtype != driver.Nerdctl {
+			return dtype, fmt.Errorf("streamProcessors are only supported by the Containerd, Ctr and Nerdctl drivers")
+		}
+		for _, p := range dc.StreamProcessors {
+			if err := p.Validate(); err != nil {
+				return dtype, err
+			}
+		}
+	}
+	if dc.CRISocket != "" && dtype != driver.Kubelet {
+		return dtype, fmt.Errorf("criSocket is only supported by the Kubelet driver")
+	}
+	if dc.Templates != nil && dtype != driver.Generic {
+		return dtype, fmt.Errorf("templates are only supported by the Generic driver")
+	}
+	if dtype == driver.Generic && (dc.Templates == nil || dc.Templates.Run == "") {
+		return dtype, fmt.Errorf("the Generic driver requires templates with at least a run command line")
+	}
+	if strings.ContainsAny(dc.Version, "[]") {
+		return dtype, fmt.Errorf("invalid version %q: brackets are not allowed", dc.Version)
+	}
+	switch dc.Nested {
+	case "":
+	case driver.NestedDinD, driver.NestedSysbox:
+		if dtype != driver.DockerAPI {
+			return dtype, fmt.Errorf("nested is only supported by the DockerAPI driver")
+		}
+	default:
+		return dtype, fmt.Errorf("unknown nested engine %q; use %q or %q", dc.Nested, driver.NestedDinD, driver.NestedSysbox)
+	}
+	switch dc.SandboxMode {
+	case "", SandboxFresh:
+	case SandboxShared:
+		if dtype != driver.CRI {
+			return dtype, fmt.Errorf("sandboxMode is only supported by the CRI driver")
+		}
+	default:
+		return dtype, fmt.Errorf("unknown sandboxMode %q; use %q or %q", dc.SandboxMode, SandboxFresh, SandboxShared)
+	}
+	return dtype, nil
+}
+
+// modeType returns the driver type selected by the type and mode settings
+func (dc DriverConfig) modeType() (driver.Type, error) {
+	dtype := driver.StringToType(dc.Type)
+	switch {
+	case dc.Mode == "":
+		return dtype, nil
+	case dtype != driver.Containerd:
+		return dtype, fmt.Errorf("mode is only supported by the Containerd driver")
+	case dc.Mode == ModeAPI:
+		return driver.Containerd, nil
+	case dc.Mode == ModeCLI:
+		return driver.Ctr, nil
+	default:
+		return dtype, fmt.Errorf("unknown Containerd mode %q; use %q or %q", dc.Mode, ModeAPI, ModeCLI)
+	}
+}
+
+// Config returns the driver creation settings for this driver configuration
+func (dc DriverConfig) Config() driver.Config {
+	config := driver.Config{
+		Path:          dc.Binary,
+		SandboxConfig: dc.SandboxConfig,
+		SharedSandbox: dc.SandboxMode == SandboxShared,
+		ManifestDir:   dc.ManifestDir,
+		CRISocket:     dc.CRISocket,
+		Nested:        dc.Nested,
+		Runtime:       dc.Runtime,
+		KernelImage:   dc.KernelImage,
+		RootDrive:     dc.RootDrive,
+	}
+	if dc.Templates != nil {
+		config.Generic = *dc.Templates
+	}
+	config.StreamProcessors = dc.StreamProcessors
+	config.Version = dc.Version
+	return config
 }
 
 // State constants
@@ -59,23 +740,33 @@ const (
 	Limit Type = iota
 	// Custom is a YAML-defined series of container actions run as a benchmark
 	Custom
+	// Pull measures the latency of image pulls from registries
+	Pull
+	// Fairness measures how a bulk tenant degrades a latency-sensitive tenant
+	Fairness
+	// Serverless emulates FaaS cold starts, timing each phase of an invocation
+	Serverless
+	// Mix runs operations picked at random by weight to simulate churn
+	Mix
 )
 
 // Bench is an interface to manage benchmark execution against a specific driver
 type Bench interface {
 
 	// Init initializes the benchmark (for example, verifies a daemon is running for daemon-centric
-	// engines, pre-pulls images, etc.)
-	Init(name string, driverType driver.Type, binaryPath, imageInfo, cmdOverride string, trace bool) error
+	// engines, pre-pulls images, etc.). The imageInfo is the image name or rootfs path
+	// which the selected driver will use to create containers
+	Init(benchmark Benchmark, driverConfig DriverConfig, imageInfo string, trace bool) error
 
 	//Validates the any condition that need to be checked before actual banchmark run.
 	//Helpful in testing operations required in benchmark for single run.
-	Validate() error
+	Validate(ctx context.Context) error
 
 	// Run executes the specified # of iterations against a specified # of
 	// threads per benchmark against a specific engine driver type and collects
-	// the statistics of each iteration and thread
-	Run(threads, iterations int, commands []string) error
+	// the statistics of each iteration and thread; canceling ctx stops the
+	// run after the in-flight operations are interrupted
+	Run(ctx context.Context, threads, iterations int, commands []string) error
 
 	// Stats returns the statistics of the benchmark run
 	Stats() []RunStatistics
@@ -83,6 +774,10 @@ type Bench interface {
 	// Elapsed returns the time.Duration that the benchmark took to execute
 	Elapsed() time.Duration
 
+	// Metrics returns run-level measurements collected during the benchmark run,
+	// keyed by a display name including the unit (e.g. "cycles/iter")
+	Metrics() map[string]float64
+
 	// State returns Created, Running, or Completed
 	State() State
 
@@ -93,6 +788,26 @@ type Bench interface {
 	Info() string
 }
 
+// PinnedBench is implemented by benchmarks supporting pinImageDigest;
+// ImageDigest returns the digest the image was pinned to, or "" if not pinned
+type PinnedBench interface {
+	ImageDigest() string
+}
+
+// SampledBench is implemented by benchmarks supporting maxSamples; Sampler
+// returns nil unless the completed run was sampled, in which case Stats only
+// returns the sampled iterations
+type SampledBench interface {
+	Sampler() *Sampler
+}
+
+// ClosableBench is implemented by benchmarks which keep the driver they were
+// initialized with for the final cleanup and results; Close closes it once
+// the benchmark is done
+type ClosableBench interface {
+	Close() error
+}
+
 // New creates an instance of the selected benchmark type
 func New(btype Type) (Bench, error) {
 	switch btype {
@@ -104,6 +819,22 @@ func New(btype Type) (Bench, error) {
 		return &CustomBench{
 			state: Created,
 		}, nil
+	case Pull:
+		return &PullBench{
+			state: Created,
+		}, nil
+	case Fairness:
+		return &FairnessBench{
+			CustomBench{state: Created},
+		}, nil
+	case Serverless:
+		return &ServerlessBench{
+			CustomBench: CustomBench{state: Created},
+		}, nil
+	case Mix:
+		return &MixBench{
+			CustomBench: CustomBench{state: Created},
+		}, nil
 	default:
 		return nil, fmt.Errorf("No such benchmark type: %v", btype)
 	}
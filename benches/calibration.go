@@ -0,0 +1,52 @@
+package benches
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// CalibrationProfile is the host "noise floor" measured by the calibrate
+// command: the cost of primitive operations that every container engine
+// builds upon, measured natively without any engine involved
+type CalibrationProfile struct {
+	Hostname   string
+	Kernel     string
+	CPUs       int
+	Clock      string
+	Iterations int
+	// Operations maps each primitive operation to its timing statistics
+	Operations map[string]CalibrationOp
+}
+
+// CalibrationOp holds the statistics of one calibration operation in microseconds
+type CalibrationOp struct {
+	Min    float64
+	Median float64
+	P90    float64
+	Mean   float64
+	Stddev float64
+	Errors int
+}
+
+// WriteCalibration stores a calibration profile as JSON
+func WriteCalibration(filename string, profile CalibrationProfile) error {
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// ReadCalibration loads a calibration profile stored by WriteCalibration
+func ReadCalibration(filename string) (CalibrationProfile, error) {
+	var profile CalibrationProfile
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return profile, fmt.Errorf("Can't read calibration file %q: %v", filename, err)
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return profile, fmt.Errorf("Can't parse calibration file %q: %v", filename, err)
+	}
+	return profile, nil
+}
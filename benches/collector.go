@@ -0,0 +1,349 @@
+package benches
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// RunInfo describes the benchmark run a collector measures
+type RunInfo struct {
+	Bench  string
+	Driver driver.Type
+	// Iterations is the total number of iterations over all threads
+	Iterations int
+	// Elapsed is the duration of the run; only set when stopping
+	Elapsed time.Duration
+}
+
+// Collector gathers telemetry (daemon overhead, host counters, cgroup stats,
+// ...) over a benchmark run. Start is called before the first iteration and
+// Stop after the last one; the measurements returned by Stop are added to
+// the run's metrics.
+type Collector interface {
+	// Name returns the name of the collector
+	Name() string
+	// Start begins measuring a run
+	Start(run RunInfo) error
+	// Stop ends measuring a run and returns its measurements
+	Stop(run RunInfo) (map[string]float64, error)
+}
+
+// CollectorOK is the health of a collector which measured a run; a collector
+// which could not is reported as "unavailable: <reason>"
+const CollectorOK = "ok"
+
+// CollectorHealthBench is implemented by benchmarks which run collectors;
+// CollectorHealth returns the health of each enabled collector during the
+// last run
+type CollectorHealthBench interface {
+	CollectorHealth() map[string]string
+}
+
+// unavailableCollector stands in for an enabled collector which failed to
+// initialize, so the benchmark runs without it and reports it unavailable
+type unavailableCollector struct {
+	name string
+	err  error
+}
+
+func (u *unavailableCollector) Name() string {
+	return u.name
+}
+
+func (u *unavailableCollector) Start(run RunInfo) error {
+	return u.err
+}
+
+func (u *unavailableCollector) Stop(run RunInfo) (map[string]float64, error) {
+	return nil, u.err
+}
+
+// CollectorFactory creates a collector for the benchmark, or returns nil if
+// the benchmark does not enable it
+type CollectorFactory func(benchmark Benchmark) (Collector, error)
+
+var collectorFactories = map[string]CollectorFactory{
+	"perf":   newPerfCollector,
+	"daemon": newDaemonCollector,
+	"energy": newEnergyCollector,
+	"psi":    newPSICollector,
+	"stacks": newStackCollector,
+}
+
+// RegisterCollector adds a collector which can then be enabled in the
+// collectors list of a benchmark YAML
+func RegisterCollector(name string, factory CollectorFactory) {
+	collectorFactories[strings.ToLower(name)] = factory
+}
+
+// CollectorNames returns the names of the registered collectors
+func CollectorNames() []string {
+	var names []string
+	for name := range collectorFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CollectorEnabled returns whether the collectors list of the benchmark
+// names the collector
+func (b Benchmark) CollectorEnabled(name string) bool {
+	for _, c := range b.Collectors {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// newCollectors creates the collectors enabled by the benchmark
+func newCollectors(benchmark Benchmark) ([]Collector, error) {
+	for _, name := range benchmark.Collectors {
+		if _, ok := collectorFactories[strings.ToLower(name)]; !ok {
+			return nil, fmt.Errorf("Unknown collector %q; use one of %s", name, strings.Join(CollectorNames(), ", "))
+		}
+	}
+	var collectors []Collector
+	for _, name := range CollectorNames() {
+		c, err := collectorFactories[name](benchmark)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			collectors = append(collectors, c)
+		}
+	}
+	return collectors, nil
+}
+
+// startCollectors starts the collectors for a run and returns those which
+// started, recording the health of each in health; a collector which cannot
+// measure is skipped with a warning or, in strict mode, fails the run
+func startCollectors(collectors []Collector, run RunInfo, strict bool, health map[string]string) ([]Collector, error) {
+	var started []Collector
+	for _, c := range collectors {
+		if err := c.Start(run); err != nil {
+			health[c.Name()] = "unavailable: " + err.Error()
+			if err := skipped(strict, "Collector %s unavailable: %v", c.Name(), err); err != nil {
+				stopCollectors(started, run, make(map[string]float64), health)
+				return nil, err
+			}
+			continue
+		}
+		health[c.Name()] = CollectorOK
+		started = append(started, c)
+	}
+	return started, nil
+}
+
+// stopCollectors stops the collectors of a run and adds their measurements
+// to the metrics; a collector failing to measure is marked unavailable in
+// health
+func stopCollectors(collectors []Collector, run RunInfo, metrics map[string]float64, health map[string]string) {
+	for _, c := range collectors {
+		values, err := c.Stop(run)
+		if err != nil {
+			log.Warnf("Collector %s unavailable: %v", c.Name(), err)
+			health[c.Name()] = "unavailable: " + err.Error()
+			continue
+		}
+		for k, v := range values {
+			metrics[k] = v
+		}
+	}
+}
+
+// daemonPids returns the process IDs of the engine daemons of a driver type
+func daemonPids(dtype driver.Type) []int {
+	var pids []int
+	for _, name := range driver.DaemonProcesses(dtype) {
+		pids = append(pids, utils.PidsOf(name)...)
+	}
+	return pids
+}
+
+// perfCollector counts perf events for the engine daemons of the driver and
+// for this process, which also counts the client and runtime processes
+// spawned by exec-based drivers
+type perfCollector struct {
+	perf *utils.PerfStat
+}
+
+func newPerfCollector(benchmark Benchmark) (Collector, error) {
+	if !benchmark.PerfCounters && !benchmark.CollectorEnabled("perf") {
+		return nil, nil
+	}
+	return &perfCollector{}, nil
+}
+
+func (p *perfCollector) Name() string {
+	return "perf"
+}
+
+func (p *perfCollector) Start(run RunInfo) error {
+	var err error
+	p.perf, err = utils.StartPerfStat(append([]int{os.Getpid()}, daemonPids(run.Driver)...))
+	return err
+}
+
+// Stop records the perf counters per iteration
+func (p *perfCollector) Stop(run RunInfo) (map[string]float64, error) {
+	counts, err := p.perf.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("Error collecting perf counters: %v", err)
+	}
+	metrics := make(map[string]float64)
+	for event, count := range counts {
+		metrics[event+"/iter"] = count / float64(run.Iterations)
+	}
+	return metrics, nil
+}
+
+// defaultMonitorInterval is the sampling interval of the daemon collector
+// when it is enabled without a monitorInterval
+const defaultMonitorInterval = time.Second
+
+// daemonCollector samples the resource usage of the engine daemons of the driver
+type daemonCollector struct {
+	interval time.Duration
+	monitor  *utils.Monitor
+}
+
+func newDaemonCollector(benchmark Benchmark) (Collector, error) {
+	if benchmark.MonitorInterval == "" {
+		if !benchmark.CollectorEnabled("daemon") {
+			return nil, nil
+		}
+		return &daemonCollector{interval: defaultMonitorInterval}, nil
+	}
+	interval, err := time.ParseDuration(benchmark.MonitorInterval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("Invalid monitorInterval %q: must be a positive duration such as 500ms", benchmark.MonitorInterval)
+	}
+	return &daemonCollector{interval: interval}, nil
+}
+
+func (d *daemonCollector) Name() string {
+	return "daemon"
+}
+
+func (d *daemonCollector) Start(run RunInfo) error {
+	pids := daemonPids(run.Driver)
+	if len(pids) == 0 {
+		return fmt.Errorf("no daemon processes found for the %s driver", driver.TypeToString(run.Driver))
+	}
+	d.monitor = utils.StartMonitor(pids, d.interval)
+	return nil
+}
+
+// Stop records the average and peak daemon usage
+func (d *daemonCollector) Stop(run RunInfo) (map[string]float64, error) {
+	stats := d.monitor.Stop()
+	if stats.Samples == 0 {
+		return nil, fmt.Errorf("run finished before the first sample; use a shorter monitorInterval")
+	}
+	return map[string]float64{
+		"daemon cpu% avg":     stats.CPUPercentAvg,
+		"daemon cpu% peak":    stats.CPUPercentPeak,
+		"daemon rss MB avg":   float64(stats.RSSAvg) / (1 << 20),
+		"daemon rss MB peak":  float64(stats.RSSPeak) / (1 << 20),
+		"daemon fds avg":      stats.FDsAvg,
+		"daemon fds peak":     float64(stats.FDsPeak),
+		"daemon threads avg":  stats.ThreadsAvg,
+		"daemon threads peak": float64(stats.ThreadsPeak),
+	}, nil
+}
+
+// energyCollector measures the energy used during the run
+type energyCollector struct {
+	meter       utils.EnergyMeter
+	joulesStart float64
+}
+
+func newEnergyCollector(benchmark Benchmark) (Collector, error) {
+	spec := benchmark.EnergyMeter
+	if spec == "" {
+		if !benchmark.CollectorEnabled("energy") {
+			return nil, nil
+		}
+		spec = "rapl"
+	}
+	meter, err := utils.NewEnergyMeter(spec)
+	if err != nil {
+		// e.g. no RAPL on this host; the benchmark runs without it
+		return &unavailableCollector{name: "energy", err: fmt.Errorf("Error initializing energy meter: %v", err)}, nil
+	}
+	return &energyCollector{meter: meter}, nil
+}
+
+func (e *energyCollector) Name() string {
+	return "energy"
+}
+
+func (e *energyCollector) Start(run RunInfo) error {
+	var err error
+	e.joulesStart, err = e.meter.Joules()
+	return err
+}
+
+// Stop records the energy used per 1000 iterations (container lifecycles)
+// and as average power
+func (e *energyCollector) Stop(run RunInfo) (map[string]float64, error) {
+	joulesEnd, err := e.meter.Joules()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading energy meter: %v", err)
+	}
+	joules := e.meter.Delta(e.joulesStart, joulesEnd)
+	return map[string]float64{
+		"joules/1000 iters": joules / float64(run.Iterations) * 1000,
+		"avg watts":         joules / run.Elapsed.Seconds(),
+	}, nil
+}
+
+// psiCollector measures the host's pressure stall information: the share of
+// the run during which tasks stalled waiting for CPU, memory or IO
+type psiCollector struct {
+	start map[string]time.Duration
+	began time.Time
+}
+
+func newPSICollector(benchmark Benchmark) (Collector, error) {
+	if !benchmark.CollectorEnabled("psi") {
+		return nil, nil
+	}
+	return &psiCollector{}, nil
+}
+
+func (p *psiCollector) Name() string {
+	return "psi"
+}
+
+func (p *psiCollector) Start(run RunInfo) error {
+	var err error
+	p.start, err = utils.ReadPressure()
+	p.began = time.Now()
+	return err
+}
+
+// Stop records the stall time of each resource in percent of the run; the
+// wall time is used as the kernel's counters keep running while paused
+func (p *psiCollector) Stop(run RunInfo) (map[string]float64, error) {
+	end, err := utils.ReadPressure()
+	if err != nil {
+		return nil, err
+	}
+	wall := time.Since(p.began)
+	metrics := make(map[string]float64)
+	for kind, total := range end {
+		metrics["psi "+kind+" %"] = float64(total-p.start[kind]) / float64(wall) * 100
+	}
+	return metrics, nil
+}
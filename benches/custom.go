@@ -1,76 +1,333 @@
 package benches
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
 )
 
+// defaultExecCommand is run by the exec command unless the YAML sets execCommand
+const defaultExecCommand = "true"
+
+// DefaultTraceDir is the directory the traces of traced containers are
+// written to unless the benchmark sets traceDir
+const DefaultTraceDir = "traces"
+
+// retryDelay is the delay before the first retry of a failed operation; it
+// doubles with every further retry
+const retryDelay = 100 * time.Millisecond
+
 // CustomBench benchmark runs a series of container lifecycle operations as
 // defined in the provided YAML against specified image and driver types
 type CustomBench struct {
-	benchName   string
-	driver      driver.Driver
-	imageInfo   string
-	cmdOverride string
-	trace       bool
-	stats       []RunStatistics
-	elapsed     time.Duration
-	state       State
-	wg          sync.WaitGroup
+	// inFlight and peakInFlight count the concurrent iterations in open-loop
+	// mode, opsInFlight the concurrent timed operations, live and peakLive
+	// the containers kept alive in overlap mode, lateStarts the iterations
+	// which missed their slot in rate-limited mode and verifyFails the failed
+	// verify steps of a run; they are accessed atomically so must stay 64-bit
+	// aligned
+	inFlight     int64
+	opsInFlight  int64
+	peakInFlight int64
+	live         int64
+	peakLive     int64
+	lateStarts   int64
+	verifyFails  int64
+	benchName    string
+	driver       driver.Driver
+	driverConfig driver.Config
+	imageInfo    string
+	imageDigest  string
+	cmdOverride  string
+	execCommand  string
+	namePrefix   string
+	trace        bool
+	traceDir     string
+	runTraceDir  string
+	purgeImage   bool
+	purge        *purgeBarrier
+	ensureImage  string
+	schedDelay   bool
+	schedPids    []int
+	exact        bool
+	strict       bool
+	harnessGC    bool
+	collectors   []Collector
+	health       map[string]string
+	opTimeout    time.Duration
+	arrival      *arrivalPattern
+	rate         float64
+	ramp         time.Duration
+	overlap      int
+	retries      int
+	stats        []RunStatistics
+	maxSamples   int
+	verifier     *verifier
+	sampler      *Sampler
+	metrics      map[string]float64
+	backoff      *daemonBackoff
+	elapsed      time.Duration
+	started      time.Time
+	state        State
+	wg           sync.WaitGroup
+	// iterate runs a single iteration; benchmark types built on CustomBench
+	// replace the container lifecycle iteration with their own
+	iterate func(ctx context.Context, drv driver.Driver, benchName string, threadNum, threads, i int, commands []string) RunStatistics
+}
+
+// skipped warns that a driver skips a setting or operation requested by the
+// benchmark or, in strict mode, fails with it so a comparison is not
+// published with the driver silently doing less
+func skipped(strict bool, format string, args ...interface{}) error {
+	if strict {
+		return fmt.Errorf(format+" (strict mode)", args...)
+	}
+	log.Warnf(format, args...)
+	return nil
 }
 
 // Init initializes the benchmark
-func (cb *CustomBench) Init(name string, driverType driver.Type, binaryPath, imageInfo, cmdOverride string, trace bool) error {
-	driver, err := driver.New(driverType, binaryPath)
+func (cb *CustomBench) Init(benchmark Benchmark, driverConfig DriverConfig, imageInfo string, trace bool) error {
+	driverType, err := driverConfig.DriverType()
+	if err != nil {
+		return err
+	}
+	namePrefix, err := benchmark.NamePrefix()
+	if err != nil {
+		return err
+	}
+	config := driverConfig.Config()
+	config.NamePrefix = namePrefix
+	config.ForceClean = benchmark.ForceClean
+	config.Container.Labels = benchmark.ContainerLabels()
+	if config.Container.Labels != nil && !driver.SupportsLabels(driverType) {
+		if err := skipped(benchmark.Strict, "The %s driver does not support labels; its containers are not labeled", driverConfig.Type); err != nil {
+			return err
+		}
+	}
+	if config.Container.Resources, err = benchmark.ContainerResources(); err != nil {
+		return err
+	}
+	if config.Container.Resources.IsSet() && !driver.SupportsResources(driverType) {
+		if err := skipped(benchmark.Strict, "The %s driver does not support resource limits; its containers are not limited", driverConfig.Type); err != nil {
+			return err
+		}
+	}
+	config.Container.EngineFlags = benchmark.EngineFlags
+	// the command is the task of a serverless invocation
+	benchType, _ := benchmark.BenchType()
+	config.Container.RunCommand = benchType == Serverless
+	if config.Container.EngineFlags != "" && !driver.SupportsEngineFlags(driverType) {
+		if err := skipped(benchmark.Strict, "The %s driver does not support engineFlags; they are ignored", driverConfig.Type); err != nil {
+			return err
+		}
+	}
+	if err := benchmark.ValidateNetwork(); err != nil {
+		return err
+	}
+	config.Container.Network = benchmark.Network
+	if config.Container.Network != "" && !driver.SupportsNetwork(driverType, config.Container.Network) {
+		if err := skipped(benchmark.Strict, "The %s driver does not support the %s network; its containers use the default network", driverConfig.Type, config.Container.Network); err != nil {
+			return err
+		}
+	}
+	config.Container.Ports = benchmark.Ports
+	if len(config.Container.Ports) > 0 && !driver.SupportsPorts(driverType) {
+		if err := skipped(benchmark.Strict, "The %s driver does not support publishing ports; no ports are published", driverConfig.Type); err != nil {
+			return err
+		}
+	}
+	if config.Container.Mounts, err = benchmark.ContainerMounts(); err != nil {
+		return err
+	}
+	for _, m := range config.Container.Mounts {
+		if !driver.SupportsMount(driverType, m.Type) {
+			if err := skipped(benchmark.Strict, "The %s driver does not support %s mounts; %s is not mounted", driverConfig.Type, m.Type, m.Target); err != nil {
+				return err
+			}
+		}
+	}
+	if err := benchmark.ValidateUser(); err != nil {
+		return err
+	}
+	config.Container.User = benchmark.User
+	if config.Container.User != "" && !driver.SupportsUser(driverType, config.Container.User) {
+		if err := skipped(benchmark.Strict, "The %s driver does not support user %q; its containers run as the image's user", driverConfig.Type, config.Container.User); err != nil {
+			return err
+		}
+	}
+	sequences := [][]string{benchmark.Commands}
+	for name := range benchmark.Mix {
+		sequences = append(sequences, strings.Split(name, mixSeparator))
+	}
+	stubbed := make(map[string]bool)
+	for _, commands := range sequences {
+		var previous []string
+		for _, cmd := range commands {
+			op := CanonicalCommand(strings.TrimSpace(cmd))
+			if !stubbed[op] && driver.IsStubbed(driverType, op, previous) {
+				stubbed[op] = true
+				if err := skipped(benchmark.Strict, "The %s driver does not implement %s; its timings are recorded as zero", driverConfig.Type, op); err != nil {
+					return err
+				}
+			}
+			previous = append(previous, op)
+		}
+	}
+	if err := validEnsureImage(benchmark); err != nil {
+		return err
+	}
+	drv, err := driver.New(driverType, config)
 	if err != nil {
 		return fmt.Errorf("Error during driver initialization for CustomBench: %v", err)
 	}
+	if benchmark.EnsureImage != "" && !driver.SupportsImages(drv) {
+		return fmt.Errorf("ensureImage is not supported by the %s driver", driverConfig.Type)
+	}
+	if benchmark.PurgeImage && !driver.SupportsImages(drv) {
+		return fmt.Errorf("purgeImageBetweenIterations is not supported by the %s driver", driverConfig.Type)
+	}
 	// get driver info; will also validate for daemon-based variants whether system is ready/up
 	// and running for benchmarking
-	info, err := driver.Info()
+	info, err := drv.Info(context.Background())
 	if err != nil {
 		return fmt.Errorf("Error during driver info query: %v", err)
 	}
 	log.Infof("Driver initialized: %s", info)
+	if v, ok := drv.(vmDriver); ok && v.VM() != "" {
+		log.Warnf("Engine for driver %s runs in a local %s VM; results include the VM boundary and are not comparable with bare-metal runs", driverConfig.Type, v.VM())
+	}
 	// prepare environment
-	err = driver.Clean()
+	err = drv.Clean(context.Background())
 	if err != nil {
 		return fmt.Errorf("Error during driver init cleanup: %v", err)
 	}
-	cb.benchName = name
+	cb.benchName = benchmark.Name
 	cb.imageInfo = imageInfo
-	cb.cmdOverride = cmdOverride
-	cb.driver = driver
-	cb.trace = trace
+	if benchmark.EnsureImage == ImagePresent {
+		if err := pullMissing(context.Background(), drv, imageInfo); err != nil {
+			return err
+		}
+	}
+	if benchmark.PinImageDigest {
+		// every operation uses the digest, so a tag moved in the registry
+		// mid-run cannot change the workload
+		if cb.imageDigest, cb.imageInfo, err = pinImage(context.Background(), drv, imageInfo); err != nil {
+			return err
+		}
+		log.Infof("Image %s pinned to %s", imageInfo, cb.imageInfo)
+	}
+	cb.cmdOverride = benchmark.Command
+	if benchmark.Priority != nil && benchmark.Priority.Workload != nil {
+		if benchmark.Command == "" {
+			return fmt.Errorf("The workload priority requires a command to run with nice and ionice")
+		}
+		cb.cmdOverride = workloadCommand(benchmark.Priority.Workload, benchmark.Command)
+	}
+	cb.execCommand = benchmark.ExecCommand
+	if cb.execCommand == "" {
+		cb.execCommand = defaultExecCommand
+	}
+	cb.driver = drv
+	cb.driverConfig = config
+	cb.namePrefix = namePrefix
+	cb.purgeImage = benchmark.PurgeImage
+	cb.ensureImage = benchmark.EnsureImage
+	cb.schedDelay = benchmark.SchedDelay
+	cb.exact = benchmark.Exact
+	cb.strict = benchmark.Strict
+	if err := cb.initTrace(benchmark, trace); err != nil {
+		return err
+	}
+	cb.harnessGC = benchmark.HarnessGC != nil
+	cb.iterate = cb.runIteration
+	if benchmark.MaxSamples < 0 {
+		return fmt.Errorf("Invalid maxSamples %d: must not be negative", benchmark.MaxSamples)
+	}
+	cb.maxSamples = benchmark.MaxSamples
+	if cb.verifier, err = newVerifier(benchmark.Verify, benchmark.Commands, drv); err != nil {
+		return err
+	}
+	if cb.collectors, err = newCollectors(benchmark); err != nil {
+		return err
+	}
+	if driverConfig.OperationTimeout != "" {
+		if cb.opTimeout, err = time.ParseDuration(driverConfig.OperationTimeout); err != nil || cb.opTimeout <= 0 {
+			return fmt.Errorf("Invalid operationTimeout %q: must be a positive duration such as 30s", driverConfig.OperationTimeout)
+		}
+	}
+	if benchmark.Rate < 0 {
+		return fmt.Errorf("Invalid rate %v: must be a positive number of iterations per second", benchmark.Rate)
+	}
+	if benchmark.Rate > 0 && benchmark.Arrival != nil {
+		return fmt.Errorf("rate and arrival are mutually exclusive; use an arrival pattern for open-loop load")
+	}
+	cb.rate = benchmark.Rate
+	if benchmark.Arrival != nil {
+		if cb.arrival, err = newArrivalPattern(*benchmark.Arrival); err != nil {
+			return err
+		}
+	}
+	if benchmark.Ramp != "" {
+		if cb.ramp, err = time.ParseDuration(benchmark.Ramp); err != nil || cb.ramp < 0 {
+			return fmt.Errorf("Invalid ramp %q: must be a duration such as 10s", benchmark.Ramp)
+		}
+	}
+	if benchmark.Overlap < 0 {
+		return fmt.Errorf("Invalid overlap %d: must not be negative", benchmark.Overlap)
+	}
+	if benchmark.Overlap > 0 {
+		if benchmark.Arrival != nil {
+			return fmt.Errorf("overlap and arrival are mutually exclusive")
+		}
+		if _, teardown := splitTeardown(benchmark.Commands); len(teardown) == 0 {
+			return fmt.Errorf("overlap requires a stop or remove command to defer")
+		}
+	}
+	cb.overlap = benchmark.Overlap
+	if benchmark.PurgeImage && (benchmark.Arrival != nil || benchmark.Overlap > 0 || len(benchmark.Mix) > 0) {
+		// their containers outlive the iterations, so there is no point at
+		// which the image is unused
+		return fmt.Errorf("purgeImageBetweenIterations is not supported with arrival, overlap or mix")
+	}
+	if benchmark.Retries < 0 {
+		return fmt.Errorf("Invalid retries %d: must not be negative", benchmark.Retries)
+	}
+	cb.retries = benchmark.Retries
 	return nil
 }
 
 // Validate the unit of benchmark execution (create-run-stop-remove) against
 // the initialized driver.
-func (cb *CustomBench) Validate() error {
-	ctr, err := cb.driver.Create("bb-test", cb.imageInfo, cb.cmdOverride, true, cb.trace)
+func (cb *CustomBench) Validate(ctx context.Context) error {
+	ctr, err := cb.driver.Create(ctx, cb.namePrefix+"test", cb.imageInfo, cb.cmdOverride, true, false)
 	if err != nil {
 		return fmt.Errorf("Driver validation: error creating test container: %v", err)
 	}
 
-	_, _, err = cb.driver.Run(ctr)
+	_, _, err = cb.driver.Run(ctx, ctr)
 	if err != nil {
 		return fmt.Errorf("Driver validation: error running test container: %v", err)
 	}
 
-	_, _, err = cb.driver.Stop(ctr)
+	_, _, err = cb.driver.Stop(ctx, ctr)
 	if err != nil {
 		return fmt.Errorf("Driver validation: error stopping test container: %v", err)
 	}
 	// allow time for quiesce of stopped state in process and container executor metadata
 	time.Sleep(50 * time.Millisecond)
 
-	_, _, err = cb.driver.Remove(ctr)
+	_, _, err = cb.driver.Remove(ctx, ctr)
 	if err != nil {
 		return fmt.Errorf("Driver validation: error deleting test container: %v", err)
 	}
@@ -79,105 +336,548 @@ func (cb *CustomBench) Validate() error {
 
 // Run executes the benchmark iterations against a specific engine driver type
 // for a specified number of iterations
-func (cb *CustomBench) Run(threads, iterations int, commands []string) error {
+func (cb *CustomBench) Run(ctx context.Context, threads, iterations int, commands []string) error {
 	log.Infof("Start CustomBench run: threads (%d); iterations (%d)", threads, iterations)
+	cb.metrics = make(map[string]float64)
+	cb.backoff = &daemonBackoff{}
+	run := RunInfo{Bench: cb.benchName, Driver: cb.driver.Type(), Iterations: threads * iterations}
+	cb.health = make(map[string]string)
+	if cb.ensureImage == ImageAbsent {
+		// after the validation, whose test container may have pulled it
+		if err := removePresent(ctx, cb.driver, cb.imageInfo); err != nil {
+			return err
+		}
+	}
+	if err := cb.initSchedDelay(); err != nil {
+		return err
+	}
+	collectors, err := startCollectors(cb.collectors, run, cb.strict, cb.health)
+	if err != nil {
+		return err
+	}
 	statChan := make([]chan RunStatistics, threads)
-	for i := range statChan {
-		statChan[i] = make(chan RunStatistics, iterations)
+	var drain sync.WaitGroup
+	if cb.maxSamples > 0 {
+		// fold the statistics into the sampler as they arrive rather than
+		// buffering every iteration of the run
+		cb.sampler = NewSampler(cb.maxSamples)
+		for i := range statChan {
+			statChan[i] = make(chan RunStatistics, 64)
+			drain.Add(1)
+			go func(ch chan RunStatistics) {
+				defer drain.Done()
+				for entry := range ch {
+					if !entry.interrupted {
+						cb.sampler.Add(entry)
+					}
+				}
+			}(statChan[i])
+		}
+	} else {
+		for i := range statChan {
+			statChan[i] = make(chan RunStatistics, iterations)
+		}
 	}
 	cb.state = Running
+	cb.peakInFlight = 0
+	cb.peakLive = 0
+	cb.lateStarts = 0
+	cb.verifyFails = 0
+	cb.purge = nil
+	if cb.purgeImage {
+		cb.purge = newPurgeBarrier(cb.imageInfo, threads, cb.opContext)
+	}
+	gc := markGC()
 	start := time.Now()
+	cb.started = start
+	pausedStart := gate.pausedTotal()
+	if cb.traceDir != "" {
+		cb.runTraceDir = filepath.Join(cb.traceDir, traceDirName(cb.Info()), fmt.Sprintf("threads-%d", threads))
+		if err := os.MkdirAll(cb.runTraceDir, 0755); err != nil {
+			return fmt.Errorf("Error creating trace directory %q: %v", cb.runTraceDir, err)
+		}
+	}
 	for i := 0; i < threads; i++ {
 		// create a driver instance for each thread to protect from drivers
 		// which may not be threadsafe (e.g. gRPC client connection in containerd?)
-		drv, err := driver.New(cb.driver.Type(), cb.driver.Path())
+		drv, err := driver.New(cb.driver.Type(), cb.driverConfig)
 		if err != nil {
 			return fmt.Errorf("error creating new driver for thread %d: %v", i, err)
 		}
 		cb.wg.Add(1)
-		go cb.runThread(drv, i, iterations, commands, statChan[i])
+		if cb.arrival != nil {
+			go cb.openLoopThread(ctx, drv, i, threads, iterations, commands, statChan[i])
+			continue
+		}
+		if cb.overlap > 0 {
+			go cb.overlapThread(ctx, drv, i, threads, iterations, commands, statChan[i])
+			continue
+		}
+		go cb.runThread(ctx, drv, i, threads, iterations, commands, nil, statChan[i])
 	}
 	cb.wg.Wait()
-	cb.elapsed = time.Since(start)
+	// time spent paused or backing off from an unavailable daemon is not
+	// part of the benchmark run
+	cb.elapsed = time.Since(start) - (gate.pausedTotal() - pausedStart) - cb.backoff.paused(time.Now())
+	run.Elapsed = cb.elapsed
+	stopCollectors(collectors, run, cb.metrics, cb.health)
+	pauses, gcCount, gcTotal := gc.pausesSince()
+	if cb.harnessGC {
+		cb.metrics["harness GC pauses"] = float64(gcCount)
+		cb.metrics["harness GC pause ms"] = float64(gcTotal.Nanoseconds()) / 1e6
+	}
+	if cb.arrival != nil {
+		cb.metrics["peak in-flight"] = float64(cb.peakInFlight)
+	}
+	if cb.overlap > 0 {
+		cb.metrics["peak live containers"] = float64(cb.peakLive)
+	}
+	if cb.rate > 0 {
+		cb.metrics["late starts"] = float64(cb.lateStarts)
+	}
+	if cb.verifier != nil {
+		cb.metrics["verify failures"] = float64(cb.verifyFails)
+	}
+	if cb.backoff.outages > 0 {
+		cb.metrics["daemon outages"] = float64(cb.backoff.outages)
+		cb.metrics["backoff secs"] = cb.backoff.total.Seconds()
+	}
 
 	log.Infof("CustomBench threads complete in %v time elapsed", cb.elapsed)
 	//collect stats
-	for _, ch := range statChan {
-		for statEntry := range ch {
-			cb.stats = append(cb.stats, statEntry)
+	completed := 0
+	if cb.sampler != nil {
+		drain.Wait()
+		cb.stats = cb.sampler.Reservoir()
+		completed = cb.sampler.Seen()
+	} else {
+		for _, ch := range statChan {
+			for statEntry := range ch {
+				if !statEntry.interrupted {
+					cb.stats = append(cb.stats, statEntry)
+				}
+			}
 		}
+		completed = len(cb.stats)
 	}
+	// an interrupted run's rate covers the iterations it completed
+	rate := float64(completed) / cb.elapsed.Seconds()
+	notify(func(o Observer) { o.RunDone(cb.Info(), threads, rate, cb.metrics) })
+	attributeGCPauses(cb.stats, pauses)
 	cb.state = Completed
 	// final environment cleanup
-	if err := cb.driver.Clean(); err != nil {
+	if err := cb.driver.Clean(cleanupContext(ctx)); err != nil {
 		return fmt.Errorf("Error during driver final cleanup: %v", err)
 	}
+	return ctx.Err()
+}
+
+// runThread runs the iterations of one thread, stopping early if ctx is
+// canceled or stop (if non-nil) is closed
+func (cb *CustomBench) runThread(ctx context.Context, drv driver.Driver, threadNum, threads, iterations int, commands []string, stop <-chan struct{}, stats chan RunStatistics) {
+	benchName := cb.Info()
+	cb.rampDelay(ctx, threadNum, threads)
+	var slot time.Time
+	for i := 0; i < iterations && ctx.Err() == nil && !stopped(stop); i++ {
+		gate.wait()
+		cb.backoff.wait(ctx)
+		if cb.rate > 0 {
+			if slot = cb.nextSlot(ctx, slot); ctx.Err() != nil {
+				break
+			}
+		}
+		stats <- cb.tracedIteration(ctx, drv, benchName, threadNum, threads, i, commands)
+	}
+	if cb.purge != nil {
+		cb.purge.leave(ctx, drv)
+	}
+	if err := drv.Close(cleanupContext(ctx)); err != nil {
+		log.Errorf("error on closing driver: %v", err)
+	}
+	close(stats)
+	cb.wg.Done()
+}
+
+// nextSlot waits for the start of the next iteration slot of a thread in
+// rate-limited mode and returns it. Slots are 1/rate apart; an iteration
+// which overran its slot is followed immediately, and counted as a late
+// start, without bursting to catch up, so the rate is never exceeded.
+func (cb *CustomBench) nextSlot(ctx context.Context, last time.Time) time.Time {
+	now := time.Now()
+	if last.IsZero() {
+		return now
+	}
+	slot := last.Add(time.Duration(float64(time.Second) / cb.rate))
+	if slot.Before(now) {
+		atomic.AddInt64(&cb.lateStarts, 1)
+		return now
+	}
+	select {
+	case <-time.After(slot.Sub(now)):
+	case <-ctx.Done():
+	}
+	return slot
+}
+
+// initTrace enables tracing the containers of the benchmark, if requested
+// and supported by the driver, with the traces written under the benchmark's
+// trace directory
+func (cb *CustomBench) initTrace(benchmark Benchmark, trace bool) error {
+	cb.trace, cb.traceDir = false, ""
+	if !trace {
+		return nil
+	}
+	if _, ok := cb.driver.(driver.Tracer); !ok {
+		return skipped(cb.strict, "Tracing is not supported by the %s driver; its containers run untraced", driver.TypeToString(cb.driver.Type()))
+	}
+	cb.trace = true
+	cb.traceDir = benchmark.TraceDir
+	if cb.traceDir == "" {
+		cb.traceDir = DefaultTraceDir
+	}
 	return nil
 }
 
-func (cb *CustomBench) runThread(driver driver.Driver, threadNum, iterations int, commands []string, stats chan RunStatistics) {
-	for i := 0; i < iterations; i++ {
-		errors := make(map[string]int)
-		durations := make(map[string]int)
-		// commands are specified in the passed in array; we will need
-		// a container for each set of commands:
-		name := fmt.Sprintf("bb-ctr-%d-%d", threadNum, i)
-		ctr, err := driver.Create(name, cb.imageInfo, cb.cmdOverride, true, cb.trace)
-		if err != nil {
+// tracedIteration runs an iteration as the root span of a trace, if spans are
+// observed, and, with tracing enabled, writes the trace of its container to
+// the trace directory of the run, recording the paths of the trace files in
+// the statistics of the iteration
+func (cb *CustomBench) tracedIteration(ctx context.Context, drv driver.Driver, benchName string, threadNum, threads, i int, commands []string) RunStatistics {
+	ctx, span := startIterationSpan(ctx, benchName, drv.Type(), threads, threadNum, i)
+	defer endSpan(span, nil)
+	if !cb.trace {
+		return cb.iterate(ctx, drv, benchName, threadNum, threads, i, commands)
+	}
+	start := time.Now()
+	stats := cb.iterate(ctx, drv, benchName, threadNum, threads, i, commands)
+	name := fmt.Sprintf("%s%d-%d", cb.namePrefix, threadNum, i)
+	traces, err := drv.(driver.Tracer).WriteTrace(context.Background(), name, start, time.Now(), cb.runTraceDir)
+	if err != nil {
+		log.Warnf("Error writing the trace of container %q: %v", name, err)
+	}
+	stats.Traces = traces
+	return stats
+}
+
+// traceDirName makes the name of a result usable as a directory name
+func traceDirName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// runIteration creates a container and runs the commands against it,
+// returning the statistics of the iteration
+func (cb *CustomBench) runIteration(ctx context.Context, drv driver.Driver, benchName string, threadNum, threads, i int, commands []string) RunStatistics {
+	// commands are specified in the passed in array; we will need
+	// a container for each set of commands:
+	pull := cb.coldPull(ctx, drv, fmt.Sprintf("%s%d-%d", cb.namePrefix, threadNum, i), benchName, threadNum, threads, i)
+	var stats RunStatistics
+	if ctr, name, iterStart, err := cb.createContainer(ctx, drv, threadNum, i); err != nil {
+		stats = cb.createFailed(ctx, benchName, threadNum, threads, i, iterStart, commands, err)
+	} else {
+		stats = cb.runCommands(ctx, drv, ctr, name, benchName, threadNum, threads, i, iterStart, commands)
+	}
+	if pull != nil {
+		// the iteration starts with the pull
+		stats = stats.merge(*pull)
+		stats.Start = pull.Start
+	}
+	notify(func(o Observer) { o.IterationDone(benchName, threads) })
+	return stats
+}
+
+// createContainer creates the container of an iteration, returning it with
+// its name and the start of the iteration, or the error creating it failed with
+func (cb *CustomBench) createContainer(ctx context.Context, drv driver.Driver, threadNum, i int) (driver.Container, string, time.Duration, error) {
+	name := fmt.Sprintf("%s%d-%d", cb.namePrefix, threadNum, i)
+	iterStart := time.Since(cb.started)
+	spanCtx, span := startSpan(ctx, spanCreate, name)
+	ctr, err := drv.Create(spanCtx, name, cb.imageInfo, cb.cmdOverride, true, cb.trace)
+	endSpan(span, err)
+	if err != nil {
+		if ctx.Err() == nil {
 			log.Errorf("Error on creating container %q from image %q: %v", name, cb.imageInfo, err)
 		}
+		return nil, name, iterStart, err
+	}
+	return ctr, name, iterStart, nil
+}
 
-		for _, cmd := range commands {
-			switch strings.ToLower(cmd) {
-			case "run", "start":
-				out, runElapsed, err := driver.Run(ctr)
-				if err != nil {
-					errors[cmd]++
-					log.Warnf("Error during container command %q on %q: %v\n  Output: %s", cmd, name, err, out)
-				}
-				durations[cmd] = runElapsed
-			case "stop", "kill":
-				out, stopElapsed, err := driver.Stop(ctr)
-				if err != nil {
-					errors[cmd]++
-					log.Warnf("Error during container command %q on %q: %v\n  Output: %s", cmd, name, err, out)
-				}
-				durations[cmd] = stopElapsed
-			case "remove", "erase", "delete":
-				out, rmElapsed, err := driver.Remove(ctr)
-				if err != nil {
-					errors[cmd]++
-					log.Warnf("Error during container command %q on %q: %v\n  Output: %s", cmd, name, err, out)
-				}
-				durations[cmd] = rmElapsed
-			case "pause":
-				out, pauseElapsed, err := driver.Pause(ctr)
-				if err != nil {
-					errors[cmd]++
-					log.Warnf("Error during container command %q on %q: %v\n  Output: %s", cmd, name, err, out)
-				}
-				durations[cmd] = pauseElapsed
-			case "unpause", "resume":
-				out, unpauseElapsed, err := driver.Unpause(ctr)
-				if err != nil {
-					errors[cmd]++
-					log.Warnf("Error during container command %q on %q: %v\n  Output: %s", cmd, name, err, out)
+// createFailed returns the statistics of an iteration whose container could
+// not be created. The error is counted against the run step, as creating the
+// container is part of running it for most drivers, and the remaining
+// commands are skipped as there is no container for them to act on. An
+// iteration interrupted by canceling ctx while creating its container never
+// started, and is marked to be left out of the results.
+func (cb *CustomBench) createFailed(ctx context.Context, benchName string, threadNum, threads, i int, iterStart time.Duration, commands []string, err error) RunStatistics {
+	if ctx.Err() != nil {
+		return RunStatistics{Thread: threadNum, Iteration: i, interrupted: true}
+	}
+	step := runStep(commands)
+	class := driver.ClassifyError(err, "")
+	if driver.IsDaemonUnavailable(err, "") {
+		// the next iterations would only fail too; back off before them
+		cb.backoff.failed()
+	}
+	stats := RunStatistics{
+		Thread:       threadNum,
+		Iteration:    i,
+		Start:        utils.Ms(iterStart),
+		Durations:    map[string]int{step: 0},
+		Errors:       map[string]int{step: 1},
+		ErrorClasses: map[string]string{step: class},
+	}
+	if cb.exact {
+		stats.Nanos = map[string]int64{step: 0}
+	}
+	notify(func(o Observer) { o.OpDone(benchName, threads, step, 0, true) })
+	return stats
+}
+
+// runStep returns the command of an iteration which a failure to create its
+// container is counted against: its run command, or its first command if it
+// has none
+func runStep(commands []string) string {
+	for _, cmd := range commands {
+		if CanonicalCommand(cmd) == opRun {
+			return cmd
+		}
+	}
+	if len(commands) == 0 {
+		return opRun
+	}
+	return commands[0]
+}
+
+// runCommands runs the commands of an iteration which started at iterStart
+// against the container, returning the statistics of the iteration
+func (cb *CustomBench) runCommands(ctx context.Context, drv driver.Driver, ctr driver.Container, name, benchName string, threadNum, threads, i int, iterStart time.Duration, commands []string) RunStatistics {
+	errors := make(map[string]int)
+	durations := make(map[string]int)
+	userTimes := make(map[string]int)
+	sysTimes := make(map[string]int)
+	var (
+		nanos          map[string]int64
+		verifySteps    int
+		verifyFailures int
+	)
+	if cb.exact {
+		nanos = make(map[string]int64)
+	}
+	spans := make(map[string]gcPause)
+	runQueue := make(map[string]int)
+	concurrency := make(map[string]int)
+	errorClasses := make(map[string]string)
+	retries := make(map[string]int)
+	for _, cmd := range commands {
+		notifyOpStart(benchName, threads, threadNum, i, cmd)
+		switch CanonicalCommand(cmd) {
+		case opVerify:
+			// untimed; a failed check is not an operation error
+			opCtx, cancel := cb.opContext(ctx)
+			failures := cb.verifier.check(opCtx, drv, ctr, verifySteps)
+			cancel()
+			verifySteps++
+			if len(failures) > 0 {
+				verifyFailures++
+				atomic.AddInt64(&cb.verifyFails, 1)
+				log.Warnf("Verification of %q failed: %s", name, strings.Join(failures, "; "))
+			}
+			continue
+		case opRun, opStop, opRemove, opPause, opUnpause, opExec, opWait, opLogs, opCheckpoint, opRestore:
+		default:
+			log.Errorf("Command %q unrecognized from YAML commands list; skipping", cmd)
+			continue
+		}
+		var (
+			out      string
+			elapsed  int
+			err      error
+			class    string
+			inFlight int64
+			opStart  time.Time
+			opEnd    time.Time
+			exact    time.Duration
+		)
+		spanCtx, span := startSpan(ctx, CanonicalCommand(cmd), name)
+		for attempt := 0; ; attempt++ {
+			exact = 0
+			opCtx, cancel := cb.opContext(utils.WithExact(spanCtx, &exact))
+			inFlight = atomic.AddInt64(&cb.opsInFlight, 1)
+			rqStart, sampled := cb.runQueueDelay()
+			opStart = time.Now()
+			out, elapsed, err = cb.operation(opCtx, drv, ctr, cmd)
+			opEnd = time.Now()
+			if rqEnd, ok := cb.runQueueDelay(); sampled && ok {
+				runQueue[cmd] = int((rqEnd - rqStart).Nanoseconds() / 1000)
+			}
+			atomic.AddInt64(&cb.opsInFlight, -1)
+			timedOut := opCtx.Err() == context.DeadlineExceeded
+			cancel()
+			if err == nil {
+				break
+			}
+			class = driver.ClassifyError(err, out)
+			if timedOut {
+				class = driver.ErrorTimeout
+			}
+			if attempt >= cb.retries || ctx.Err() != nil || !retryable(class) {
+				break
+			}
+			retries[cmd]++
+			log.Warnf("Error during container command %q on %q (%s), retrying: %v\n  Output: %s", cmd, name, class, err, out)
+			select {
+			case <-time.After(retryDelay << uint(attempt)):
+			case <-ctx.Done():
+			}
+		}
+		endSpan(span, err)
+		if err != nil {
+			errors[cmd]++
+			errorClasses[cmd] = class
+			log.Warnf("Error during container command %q on %q (%s): %v\n  Output: %s", cmd, name, class, err, out)
+			if class == driver.ErrorTimeout || ctx.Err() != nil {
+				// the container is in an unknown state; abandon the rest of the iteration
+				if class == driver.ErrorTimeout {
+					log.Warnf("Command %q on %q exceeded the %v operation timeout", cmd, name, cb.opTimeout)
 				}
-				durations[cmd] = unpauseElapsed
-			default:
-				log.Errorf("Command %q unrecognized from YAML commands list; skipping", cmd)
+				break
+			}
+			if class == driver.ErrorDaemonUnavailable {
+				// the remaining commands would only fail too; back off before the next iteration
+				cb.backoff.failed()
+				break
 			}
+		} else {
+			cb.backoff.succeeded()
 		}
-		stats <- RunStatistics{
-			Durations: durations,
-			Errors:    errors,
+		durations[cmd] = elapsed
+		spans[cmd] = gcPause{start: opStart.UnixNano(), end: opEnd.UnixNano()}
+		concurrency[cmd] = int(inFlight)
+		if nanos != nil {
+			nanos[cmd] = exactNanos(exact, elapsed, err)
+		}
+		notify(func(o Observer) { o.OpDone(benchName, threads, cmd, elapsed, err != nil) })
+		if u, ok := drv.(usageReporter); ok {
+			usage := u.LastUsage()
+			userTimes[cmd] = utils.Ms(usage.User)
+			sysTimes[cmd] = utils.Ms(usage.System)
 		}
 	}
-	if err := driver.Close(); err != nil {
-		log.Errorf("error on closing driver: %v", err)
+	return RunStatistics{
+		Thread:         threadNum,
+		Iteration:      i,
+		Start:          utils.Ms(iterStart),
+		Durations:      durations,
+		Errors:         errors,
+		UserTimes:      userTimes,
+		SysTimes:       sysTimes,
+		RunQueueMicros: runQueue,
+		Nanos:          nanos,
+		VerifyFailures: verifyFailures,
+		Concurrency:    concurrency,
+		ErrorClasses:   errorClasses,
+		Retries:        retries,
+		spans:          spans,
 	}
-	close(stats)
-	cb.wg.Done()
+}
+
+// operation runs a timed lifecycle command against the container
+func (cb *CustomBench) operation(ctx context.Context, drv driver.Driver, ctr driver.Container, cmd string) (string, int, error) {
+	switch CanonicalCommand(cmd) {
+	case opRun:
+		return drv.Run(ctx, ctr)
+	case opStop:
+		return drv.Stop(ctx, ctr)
+	case opRemove:
+		return drv.Remove(ctx, ctr)
+	case opPause:
+		return drv.Pause(ctx, ctr)
+	case opUnpause:
+		return drv.Unpause(ctx, ctr)
+	case opExec:
+		return drv.Exec(ctx, ctr, cb.execCommand)
+	case opWait:
+		return drv.Wait(ctx, ctr)
+	case opLogs:
+		return drv.Logs(ctx, ctr)
+	case opCheckpoint:
+		return drv.Checkpoint(ctx, ctr)
+	case opRestore:
+		return drv.Restore(ctx, ctr)
+	}
+	return "", 0, fmt.Errorf("unknown command %q", cmd)
+}
+
+// retryable returns whether an operation failing with an error of the class
+// may succeed when retried: timed out operations leave the container in an
+// unknown state and name conflicts persist, so neither is retried
+func retryable(class string) bool {
+	return class == driver.ErrorDaemonUnavailable || class == driver.ErrorNonzeroExit || class == driver.ErrorOther
+}
+
+// opContext returns the context of a single operation, bounded by the
+// operation timeout if one is configured
+func (cb *CustomBench) opContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cb.opTimeout > 0 {
+		return context.WithTimeout(ctx, cb.opTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// exactNanos returns the nanoseconds of an operation in exact mode: the
+// duration the driver timed for its elapsed milliseconds, or those
+// milliseconds for drivers which do not record it, and 0 for a failed
+// operation, whose elapsed time is reported as 0 too
+func exactNanos(exact time.Duration, elapsed int, err error) int64 {
+	if err != nil {
+		return 0
+	}
+	if exact == 0 {
+		return int64(elapsed) * 1000000
+	}
+	return exact.Nanoseconds()
+}
+
+// cleanupContext returns the context for the cleanup at the end of a run:
+// ctx itself, or a background context once ctx is canceled, so the driver
+// still removes the containers of a canceled run
+func cleanupContext(ctx context.Context) context.Context {
+	if ctx.Err() != nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// stopped reports whether the stop channel has been closed
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Metrics returns the run-level measurements of the benchmark run
+func (cb *CustomBench) Metrics() map[string]float64 {
+	if cb.state == Completed {
+		return cb.metrics
+	}
+	return nil
+}
+
+// CollectorHealth returns the health of each enabled collector during the
+// benchmark run: CollectorOK, or unavailable with the reason
+func (cb *CustomBench) CollectorHealth() map[string]string {
+	if cb.state != Completed || len(cb.health) == 0 {
+		return nil
+	}
+	return cb.health
 }
 
 // Stats returns the statistics of the benchmark run
@@ -188,6 +888,21 @@ func (cb *CustomBench) Stats() []RunStatistics {
 	return []RunStatistics{}
 }
 
+// ImageDigest returns the digest the image was pinned to, if pinImageDigest
+// is set
+func (cb *CustomBench) ImageDigest() string {
+	return cb.imageDigest
+}
+
+// Sampler returns the sampler of a run with maxSamples set, or nil if every
+// iteration's statistics were kept
+func (cb *CustomBench) Sampler() *Sampler {
+	if cb.state == Completed {
+		return cb.sampler
+	}
+	return nil
+}
+
 // State returns Created, Running, or Completed
 func (cb *CustomBench) State() State {
 	return cb.state
@@ -198,13 +913,119 @@ func (cb *CustomBench) Elapsed() time.Duration {
 	return cb.elapsed
 }
 
+// Close closes the driver the benchmark was initialized with
+func (cb *CustomBench) Close() error {
+	if cb.driver == nil {
+		return nil
+	}
+	return cb.driver.Close(context.Background())
+}
+
 // Type returns the type of benchmark
 func (cb *CustomBench) Type() Type {
 	return Custom
 }
 
-// Info returns a string with the driver type and custom benchmark name
+// Info returns a string with the driver type and custom benchmark name; for
+// drivers fronting an alternate engine (e.g. balena-engine via the Docker driver)
+// the engine name is included so results are not mistaken for the default engine,
+// and an engine running in a local VM is labeled with the VM product
 func (cb *CustomBench) Info() string {
-	driverType := driver.TypeToString(cb.driver.Type())
-	return cb.benchName + ":" + driverType
+	return cb.benchName + ":" + driverName(cb.driver) + configLabel(cb.driverConfig)
+}
+
+// driverName returns the driver type name, labeled with any alternate engine,
+// local VM the driver's engine runs in, or alternate runtime
+func driverName(drv driver.Driver) string {
+	driverType := driver.TypeToString(drv.Type())
+	if e, ok := drv.(engineDriver); ok && e.Engine() != "docker" {
+		driverType = driverType + "(" + e.Engine() + ")"
+	}
+	if v, ok := drv.(vmDriver); ok && v.VM() != "" {
+		driverType = driverType + "[VM:" + v.VM() + "]"
+	}
+	if r, ok := drv.(runtimeDriver); ok && r.Runtime() != "" {
+		driverType = driverType + "[runtime:" + r.Runtime() + "]"
+	}
+	if n, ok := drv.(nestedDriver); ok && n.Nested() != "" {
+		driverType = driverType + "[nested:" + n.Nested() + "]"
+	}
+	if s, ok := drv.(sandboxDriver); ok && s.SandboxMode() != "" {
+		driverType = driverType + "[sandbox:" + s.SandboxMode() + "]"
+	}
+	return driverType
+}
+
+// configLabel labels the results of a driver configuration with the settings
+// applied outside the driver, such as containerd's stream processors, and
+// with the engine version of a version matrix
+func configLabel(config driver.Config) string {
+	label := ""
+	if len(config.StreamProcessors) > 0 {
+		label += "[streamProcessors:" + strings.Join(driver.StreamProcessorNames(config.StreamProcessors), ",") + "]"
+	}
+	if config.Version != "" {
+		label += "[version:" + config.Version + "]"
+	}
+	return label
+}
+
+// unpackReporter is implemented by drivers which time the unpacking of the
+// layers of a pull separately
+type unpackReporter interface {
+	LastUnpack() driver.Unpack
+}
+
+// imageChecker is implemented by drivers which can report whether an image
+// is already present on the engine
+type imageChecker interface {
+	HasImage(ctx context.Context, image string) (bool, error)
+}
+
+// imageDigester is implemented by drivers which can resolve a local image to
+// the digest it was pulled as from its registry
+type imageDigester interface {
+	ImageDigest(ctx context.Context, image string) (string, error)
+}
+
+// exitCoder is implemented by drivers which can report the exit code of a
+// container's main process
+type exitCoder interface {
+	ExitCode(ctx context.Context, ctr driver.Container) (int, error)
+}
+
+// usageReporter is implemented by exec-based drivers which can report the
+// CPU time used by the client process of the last operation
+type usageReporter interface {
+	LastUsage() utils.Usage
+}
+
+// engineDriver is implemented by drivers which can target multiple
+// API-compatible engines
+type engineDriver interface {
+	Engine() string
+}
+
+// runtimeDriver is implemented by drivers which can run containers with an
+// alternate runtime (e.g. gVisor or Kata Containers)
+type runtimeDriver interface {
+	Runtime() string
+}
+
+// nestedDriver is implemented by drivers which can drive an engine nested
+// inside a container (Docker-in-Docker, sysbox)
+type nestedDriver interface {
+	Nested() string
+}
+
+// sandboxDriver is implemented by drivers which can run containers in a
+// shared pod sandbox rather than a sandbox per container
+type sandboxDriver interface {
+	SandboxMode() string
+}
+
+// vmDriver is implemented by drivers which can detect that their engine
+// runs inside a local VM (Docker Desktop, Colima, Lima)
+type vmDriver interface {
+	VM() string
 }
@@ -0,0 +1,92 @@
+package benches
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+)
+
+// createFailingDriver is a driver whose containers cannot be created; any
+// other operation panics on the nil embedded driver, as acting on the nil
+// container of a failed creation would
+type createFailingDriver struct {
+	driver.Driver
+	err error
+}
+
+func (d *createFailingDriver) Type() driver.Type {
+	return driver.Null
+}
+
+func (d *createFailingDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (driver.Container, error) {
+	return nil, d.err
+}
+
+func TestCreateFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		class    string
+		outages  int
+		commands []string
+		step     string
+	}{
+		{"daemon unavailable", errors.New("dial unix /var/run/docker.sock: connect: connection refused"), driver.ErrorDaemonUnavailable, 1, []string{"run", "stop", "remove"}, "run"},
+		{"other error", errors.New("image not known"), driver.ErrorOther, 0, []string{"run", "stop", "remove"}, "run"},
+		{"aliased run", errors.New("image not known"), driver.ErrorOther, 0, []string{"start", "kill", "delete"}, "start"},
+	}
+	for _, tt := range tests {
+		drv := &createFailingDriver{err: tt.err}
+		cb := &CustomBench{namePrefix: "bb-test-", started: time.Now(), backoff: &daemonBackoff{}}
+		stats := cb.runIteration(context.Background(), drv, "test", 0, 1, 0, tt.commands)
+		if stats.Errors[tt.step] != 1 || len(stats.Errors) != 1 {
+			t.Errorf("%s: errors = %v, want one error for %s", tt.name, stats.Errors, tt.step)
+		}
+		if got := stats.ErrorClasses[tt.step]; got != tt.class {
+			t.Errorf("%s: error class = %q, want %q", tt.name, got, tt.class)
+		}
+		if cb.backoff.outages != tt.outages {
+			t.Errorf("%s: %d daemon outages, want %d", tt.name, cb.backoff.outages, tt.outages)
+		}
+	}
+}
+
+func TestMixCreateFailure(t *testing.T) {
+	ops, err := parseMix(map[string]float64{"run+stop+remove": 1}, driver.Docker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drv := &createFailingDriver{err: errors.New("503 Service Unavailable")}
+	mb := &MixBench{
+		CustomBench: CustomBench{namePrefix: "bb-test-", started: time.Now(), backoff: &daemonBackoff{}},
+		ops:         ops,
+		running:     make(map[int][]driver.Container),
+	}
+	stats := mb.runMixIteration(context.Background(), drv, "test", 0, 1, 0, nil)
+	if stats.Errors["run"] != 1 {
+		t.Errorf("errors = %v, want one error for run", stats.Errors)
+	}
+	if len(mb.running[0]) != 0 {
+		t.Errorf("%d containers kept running after a failed creation", len(mb.running[0]))
+	}
+	if mb.backoff.outages != 1 {
+		t.Errorf("%d daemon outages, want 1", mb.backoff.outages)
+	}
+}
+
+func TestCreateInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	drv := &createFailingDriver{err: context.Canceled}
+	cb := &CustomBench{namePrefix: "bb-test-", started: time.Now(), backoff: &daemonBackoff{}}
+	stats := cb.runIteration(ctx, drv, "test", 0, 1, 0, []string{"run", "stop", "remove"})
+	if !stats.interrupted {
+		t.Error("an iteration canceled while creating its container is not marked interrupted")
+	}
+	if len(stats.Errors) != 0 {
+		t.Errorf("errors = %v, want none for an interrupted iteration", stats.Errors)
+	}
+}
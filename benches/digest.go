@@ -0,0 +1,41 @@
+package benches
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/estesp/bucketbench/driver"
+)
+
+// pinImage resolves an image reference to the digest of the image on the
+// driver's engine, pulling the image first if it is not present, and returns
+// the digest and the image reference pinned to it
+func pinImage(ctx context.Context, drv driver.Driver, image string) (string, string, error) {
+	digester, ok := drv.(imageDigester)
+	if !ok {
+		return "", "", fmt.Errorf("pinImageDigest is not supported by the %s driver", driver.TypeToString(drv.Type()))
+	}
+	if err := pullMissing(ctx, drv, image); err != nil {
+		return "", "", err
+	}
+	digest, err := digester.ImageDigest(ctx, image)
+	if err != nil {
+		return "", "", fmt.Errorf("Error resolving the digest of image %q: %v", image, err)
+	}
+	return digest, PinnedReference(image, digest), nil
+}
+
+// PinnedReference replaces the tag or digest of an image reference with a
+// digest, e.g. alpine:latest becomes alpine@sha256:...
+func PinnedReference(image, digest string) string {
+	name := image
+	if i := strings.Index(name, "@"); i != -1 {
+		name = name[:i]
+	}
+	// a colon before the last slash separates a registry port, not a tag
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return name + "@" + digest
+}
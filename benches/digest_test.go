@@ -0,0 +1,27 @@
+package benches
+
+import "testing"
+
+func TestPinnedReference(t *testing.T) {
+	const digest = "sha256:4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"
+	tests := []struct {
+		name  string
+		image string
+		want  string
+	}{
+		{"bare name", "alpine", "alpine@" + digest},
+		{"tag", "alpine:latest", "alpine@" + digest},
+		{"repository path", "docker.io/library/alpine:3.18", "docker.io/library/alpine@" + digest},
+		{"registry port", "localhost:5000/alpine", "localhost:5000/alpine@" + digest},
+		{"registry port and tag", "localhost:5000/alpine:3.18", "localhost:5000/alpine@" + digest},
+		{"digest", "alpine@sha256:0123", "alpine@" + digest},
+		{"tag and digest", "alpine:3.18@sha256:0123", "alpine@" + digest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PinnedReference(tt.image, digest); got != tt.want {
+				t.Errorf("PinnedReference(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package benches
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+	"github.com/montanaflynn/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+// Step prefixes of the fairness benchmark tenants
+const (
+	fairnessSolo   = "solo"
+	fairnessShared = "shared"
+	fairnessBulk   = "bulk"
+)
+
+// FairnessBench measures how a bulk tenant churning containers degrades the
+// latency of a latency-sensitive tenant on the same engine. The sensitive
+// tenant is a single thread running the commands for the configured number of
+// iterations, first alone and then while the bulk tenant's threads run the
+// same commands for as long as the sensitive tenant is running. The thread
+// count of a run is the number of bulk threads.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type FairnessBench struct {
+	CustomBench
+}
+
+// Init initializes the benchmark
+func (fb *FairnessBench) Init(benchmark Benchmark, driverConfig DriverConfig, imageInfo string, trace bool) error {
+	if benchmark.MaxSamples > 0 {
+		return fmt.Errorf("maxSamples is not supported by the fairness benchmark")
+	}
+	if benchmark.Overlap > 0 {
+		return fmt.Errorf("overlap is not supported by the fairness benchmark")
+	}
+	return fb.CustomBench.Init(benchmark, driverConfig, imageInfo, trace)
+}
+
+// Run executes the solo and shared phases of the sensitive tenant against a
+// specific engine driver type, with threads bulk tenant threads in the shared
+// phase
+func (fb *FairnessBench) Run(ctx context.Context, threads, iterations int, commands []string) error {
+	log.Infof("Start FairnessBench run: bulk threads (%d); iterations (%d)", threads, iterations)
+	fb.metrics = make(map[string]float64)
+	fb.backoff = &daemonBackoff{}
+	fb.state = Running
+	fb.verifyFails = 0
+	start := time.Now()
+	fb.started = start
+	pausedStart := gate.pausedTotal()
+
+	solo, _, _, err := fb.runTenants(ctx, 0, iterations, commands)
+	if err != nil {
+		return err
+	}
+	if err := fb.driver.Clean(ctx); err != nil {
+		return fmt.Errorf("Error during driver cleanup between phases: %v", err)
+	}
+	shared, bulk, bulkElapsed, err := fb.runTenants(ctx, threads, iterations, commands)
+	if err != nil {
+		return err
+	}
+	fb.elapsed = time.Since(start) - (gate.pausedTotal() - pausedStart) - fb.backoff.paused(time.Now())
+	log.Infof("FairnessBench threads complete in %v time elapsed", fb.elapsed)
+
+	soloP99 := iterationPercentile(solo, 99)
+	sharedP99 := iterationPercentile(shared, 99)
+	fb.metrics["solo p99 ms"] = soloP99
+	fb.metrics["shared p99 ms"] = sharedP99
+	if soloP99 > 0 {
+		fb.metrics["p99 degradation %"] = (sharedP99/soloP99 - 1) * 100
+	}
+	if fb.verifier != nil {
+		fb.metrics["verify failures"] = float64(fb.verifyFails)
+	}
+	if bulkElapsed > 0 {
+		fb.metrics["bulk iter/sec"] = float64(len(bulk)) / bulkElapsed.Seconds()
+	}
+	fb.stats = append(fb.stats, prefixSteps(fairnessSolo, solo)...)
+	fb.stats = append(fb.stats, prefixSteps(fairnessShared, shared)...)
+	fb.stats = append(fb.stats, prefixSteps(fairnessBulk, bulk)...)
+
+	rate := float64(2*iterations) / fb.elapsed.Seconds()
+	notify(func(o Observer) { o.RunDone(fb.Info(), threads, rate, fb.metrics) })
+	fb.state = Completed
+	if err := fb.driver.Clean(cleanupContext(ctx)); err != nil {
+		return fmt.Errorf("Error during driver final cleanup: %v", err)
+	}
+	return ctx.Err()
+}
+
+// runTenants runs the sensitive tenant for the given iterations alongside
+// bulk threads which churn containers until the sensitive tenant completes,
+// returning the statistics of both tenants and the time the bulk tenant ran
+func (fb *FairnessBench) runTenants(ctx context.Context, bulkThreads, iterations int, commands []string) ([]RunStatistics, []RunStatistics, time.Duration, error) {
+	var (
+		sensitive []RunStatistics
+		bulk      []RunStatistics
+		bulkMu    sync.Mutex
+		drain     sync.WaitGroup
+	)
+	stop := make(chan struct{})
+	fb.purge = nil
+	if fb.purgeImage {
+		fb.purge = newPurgeBarrier(fb.imageInfo, bulkThreads+1, fb.opContext)
+	}
+	start := time.Now()
+	for i := 1; i <= bulkThreads; i++ {
+		drv, err := driver.New(fb.driver.Type(), fb.driverConfig)
+		if err != nil {
+			close(stop)
+			fb.wg.Wait()
+			return nil, nil, 0, fmt.Errorf("error creating new driver for bulk thread %d: %v", i, err)
+		}
+		// bulk threads run until stopped; their statistics are drained as
+		// they arrive so the threads never block on a full channel
+		ch := make(chan RunStatistics, iterations)
+		drain.Add(1)
+		go func() {
+			defer drain.Done()
+			for entry := range ch {
+				bulkMu.Lock()
+				bulk = append(bulk, entry)
+				bulkMu.Unlock()
+			}
+		}()
+		fb.wg.Add(1)
+		go fb.runThread(ctx, drv, i, bulkThreads+1, math.MaxInt32, commands, stop, ch)
+	}
+	drv, err := driver.New(fb.driver.Type(), fb.driverConfig)
+	if err != nil {
+		close(stop)
+		fb.wg.Wait()
+		return nil, nil, 0, fmt.Errorf("error creating new driver for sensitive thread: %v", err)
+	}
+	ch := make(chan RunStatistics, iterations)
+	fb.wg.Add(1)
+	fb.runThread(ctx, drv, 0, bulkThreads+1, iterations, commands, nil, ch)
+	close(stop)
+	fb.wg.Wait()
+	elapsed := time.Since(start)
+	drain.Wait()
+	for entry := range ch {
+		sensitive = append(sensitive, entry)
+	}
+	return sensitive, bulk, elapsed, nil
+}
+
+// Type returns the type of benchmark
+func (fb *FairnessBench) Type() Type {
+	return Fairness
+}
+
+// iterationPercentile returns the percentile of the total duration of all
+// steps of each iteration
+func iterationPercentile(statistics []RunStatistics, percent float64) float64 {
+	var totals []float64
+	for _, entry := range statistics {
+		total := 0.0
+		for step, ms := range entry.Durations {
+			if nanos, ok := entry.Nanos[step]; ok {
+				total += float64(nanos) / 1e6
+				continue
+			}
+			total += float64(ms)
+		}
+		totals = append(totals, total)
+	}
+	p, err := stats.Percentile(totals, percent)
+	if err != nil {
+		return 0
+	}
+	return p
+}
+
+// prefixSteps returns the statistics with each step name prefixed by the tenant
+func prefixSteps(prefix string, statistics []RunStatistics) []RunStatistics {
+	for i, entry := range statistics {
+		statistics[i].Durations = prefixKeys(prefix, entry.Durations)
+		statistics[i].Errors = prefixKeys(prefix, entry.Errors)
+		statistics[i].UserTimes = prefixKeys(prefix, entry.UserTimes)
+		statistics[i].SysTimes = prefixKeys(prefix, entry.SysTimes)
+		statistics[i].RunQueueMicros = prefixKeys(prefix, entry.RunQueueMicros)
+		statistics[i].Concurrency = prefixKeys(prefix, entry.Concurrency)
+		statistics[i].Retries = prefixKeys(prefix, entry.Retries)
+		if entry.ErrorClasses != nil {
+			classes := make(map[string]string, len(entry.ErrorClasses))
+			for k, v := range entry.ErrorClasses {
+				classes[prefix+" "+k] = v
+			}
+			statistics[i].ErrorClasses = classes
+		}
+		if entry.Nanos != nil {
+			nanos := make(map[string]int64, len(entry.Nanos))
+			for k, v := range entry.Nanos {
+				nanos[prefix+" "+k] = v
+			}
+			statistics[i].Nanos = nanos
+		}
+	}
+	return statistics
+}
+
+func prefixKeys(prefix string, m map[string]int) map[string]int {
+	prefixed := make(map[string]int, len(m))
+	for k, v := range m {
+		prefixed[prefix+" "+k] = v
+	}
+	return prefixed
+}
+
+// FairnessSteps returns the step names reported by the fairness benchmark
+// for the given commands
+func FairnessSteps(commands []string) []string {
+	var steps []string
+	for _, prefix := range []string{fairnessSolo, fairnessShared, fairnessBulk} {
+		for _, cmd := range commands {
+			steps = append(steps, prefix+" "+cmd)
+		}
+	}
+	return steps
+}
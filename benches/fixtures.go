@@ -0,0 +1,32 @@
+package benches
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// FixtureSet records the standard benchmark images built or pulled by the
+// fixtures command, so published results can reference reproducible workloads
+type FixtureSet struct {
+	Engine   string
+	Fixtures []Fixture
+}
+
+// Fixture is a single benchmark image and the digest identifying its content
+type Fixture struct {
+	Name        string
+	Image       string
+	Description string
+	// Digest is the registry digest of pulled images, or the content-addressed
+	// image ID of locally built images
+	Digest string
+}
+
+// WriteFixtures stores a fixture set as JSON
+func WriteFixtures(filename string, set FixtureSet) error {
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
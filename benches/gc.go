@@ -0,0 +1,120 @@
+package benches
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HarnessGCConfig tunes the Go garbage collector of bucketbench itself, so
+// its pauses can be kept out of (and ruled out as the cause of) outliers
+type HarnessGCConfig struct {
+	// GOGC is the GC target percentage, as the GOGC environment variable;
+	// -1 disables the collector until the memory limit is reached
+	GOGC *int `yaml:"gogc"`
+	// MemoryLimit is the soft memory limit of the harness, e.g. 2g
+	MemoryLimit string `yaml:"memoryLimit"`
+}
+
+// gcPauseHistory is the number of recent pauses kept in runtime.MemStats
+const gcPauseHistory = 256
+
+// ApplyHarnessGC sets the GC target and soft memory limit of bucketbench
+func ApplyHarnessGC(benchmark Benchmark) error {
+	config := benchmark.HarnessGC
+	if config == nil {
+		return nil
+	}
+	if config.GOGC != nil {
+		if *config.GOGC < -1 {
+			return fmt.Errorf("Invalid harnessGC gogc %d: use a percentage, or -1 to disable the collector", *config.GOGC)
+		}
+		debug.SetGCPercent(*config.GOGC)
+	}
+	if config.MemoryLimit != "" {
+		limit, ok := parseMemory(config.MemoryLimit)
+		if !ok || limit <= 0 {
+			return fmt.Errorf("Invalid harnessGC memoryLimit %q: use bytes or a size such as 2g", config.MemoryLimit)
+		}
+		debug.SetMemoryLimit(limit)
+	}
+	if config.GOGC != nil && *config.GOGC == -1 && config.MemoryLimit == "" {
+		log.Warnf("harnessGC disables the collector without a memoryLimit; the harness memory grows without bound")
+	}
+	return nil
+}
+
+// gcPause is a stop-the-world pause of the harness, in Unix nanoseconds
+type gcPause struct {
+	start, end int64
+}
+
+// gcMark records the collections of the harness up to a point in time
+type gcMark struct {
+	numGC      uint32
+	pauseTotal uint64
+}
+
+// markGC returns the collections of the harness so far
+func markGC() gcMark {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return gcMark{numGC: stats.NumGC, pauseTotal: stats.PauseTotalNs}
+}
+
+// pausesSince returns the pauses of the collections since the mark, their
+// number and their total duration; pauses beyond the runtime's history are
+// counted in the total but cannot be placed in time
+func (m gcMark) pausesSince() ([]gcPause, uint32, time.Duration) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	var pauses []gcPause
+	first := m.numGC + 1
+	if stats.NumGC-m.numGC > gcPauseHistory {
+		first = stats.NumGC - gcPauseHistory + 1
+	}
+	for n := first; n <= stats.NumGC; n++ {
+		i := (n + gcPauseHistory - 1) % gcPauseHistory
+		end, ns := int64(stats.PauseEnd[i]), int64(stats.PauseNs[i])
+		pauses = append(pauses, gcPause{start: end - ns, end: end})
+	}
+	count := stats.NumGC - m.numGC
+	if count > gcPauseHistory {
+		log.Warnf("%d harness GC pauses during the run; only the last %d are attributed to operations", count, gcPauseHistory)
+	}
+	return pauses, count, time.Duration(stats.PauseTotalNs - m.pauseTotal)
+}
+
+// attributeGCPauses sets the microseconds of harness GC pause overlapping
+// each timed step of the iterations
+func attributeGCPauses(stats []RunStatistics, pauses []gcPause) {
+	if len(pauses) == 0 {
+		return
+	}
+	for i := range stats {
+		for step, span := range stats[i].spans {
+			var overlap int64
+			for _, p := range pauses {
+				start, end := p.start, p.end
+				if start < span.start {
+					start = span.start
+				}
+				if end > span.end {
+					end = span.end
+				}
+				if end > start {
+					overlap += end - start
+				}
+			}
+			if overlap > 0 {
+				if stats[i].GCPauseMicros == nil {
+					stats[i].GCPauseMicros = make(map[string]int)
+				}
+				stats[i].GCPauseMicros[step] = int(overlap / 1000)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package benches
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/estesp/bucketbench/driver"
+)
+
+// pullMissing pulls the image onto the driver's engine unless it is already
+// present; drivers which cannot check for an image always pull it
+func pullMissing(ctx context.Context, drv driver.Driver, image string) error {
+	if checker, ok := drv.(imageChecker); ok {
+		present, err := checker.HasImage(ctx, image)
+		if err != nil {
+			return fmt.Errorf("Error checking for image %q: %v", image, err)
+		}
+		if present {
+			return nil
+		}
+	}
+	if err := pullLimiter.Wait(ctx); err != nil {
+		return err
+	}
+	if out, _, err := drv.PullImage(ctx, image); err != nil {
+		return fmt.Errorf("Error pulling image %q: %v (output: %s)", image, err, out)
+	}
+	return nil
+}
+
+// removePresent removes the image from the driver's engine unless it is
+// already absent
+func removePresent(ctx context.Context, drv driver.Driver, image string) error {
+	if checker, ok := drv.(imageChecker); ok {
+		present, err := checker.HasImage(ctx, image)
+		if err != nil {
+			return fmt.Errorf("Error checking for image %q: %v", image, err)
+		}
+		if !present {
+			return nil
+		}
+	}
+	if err := drv.RemoveImage(ctx, image); err != nil {
+		return fmt.Errorf("Error removing image %q: %v", image, err)
+	}
+	return nil
+}
+
+// validEnsureImage checks the ensureImage setting of a benchmark
+func validEnsureImage(benchmark Benchmark) error {
+	switch benchmark.EnsureImage {
+	case "", ImagePresent:
+	case ImageAbsent:
+		if benchmark.PinImageDigest {
+			return fmt.Errorf("ensureImage %q and pinImageDigest are mutually exclusive; pinning the digest pulls the image", ImageAbsent)
+		}
+	default:
+		return fmt.Errorf("Invalid ensureImage %q: use %q or %q", benchmark.EnsureImage, ImagePresent, ImageAbsent)
+	}
+	return nil
+}
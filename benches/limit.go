@@ -1,12 +1,12 @@
 package benches
 
 import (
+	"context"
 	"sync"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
-	"github.com/estesp/bucketbench/driver"
 	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
 )
 
 // LimitBench only checks per-thread throughput as a baseline for comparison to runs on
@@ -21,18 +21,18 @@ type LimitBench struct {
 }
 
 // Init initializes the benchmark
-func (lb *LimitBench) Init(name string, driverType driver.Type, binaryPath, imageInfo, cmdOverride string, trace bool) error {
+func (lb *LimitBench) Init(benchmark Benchmark, driverConfig DriverConfig, imageInfo string, trace bool) error {
 	return nil
 }
 
-//Validate the unit of benchmark execution
-func (lb *LimitBench) Validate() error {
+// Validate the unit of benchmark execution
+func (lb *LimitBench) Validate(ctx context.Context) error {
 	return nil
 }
 
 // Run executes the benchmark iterations against a specific engine driver type
 // for a specified number of iterations
-func (lb *LimitBench) Run(threads, iterations int, commands []string) error {
+func (lb *LimitBench) Run(ctx context.Context, threads, iterations int, commands []string) error {
 	log.Infof("Start LimitBench run: threads (%d); iterations (%d)", threads, iterations)
 	statChan := make([]chan RunStatistics, threads)
 	for i := range statChan {
@@ -42,7 +42,7 @@ func (lb *LimitBench) Run(threads, iterations int, commands []string) error {
 	start := time.Now()
 	for i := 0; i < threads; i++ {
 		lb.wg.Add(1)
-		go lb.runThread(iterations, statChan[i])
+		go lb.runThread(ctx, iterations, statChan[i])
 	}
 	lb.wg.Wait()
 	lb.elapsed = time.Since(start)
@@ -55,11 +55,11 @@ func (lb *LimitBench) Run(threads, iterations int, commands []string) error {
 		}
 	}
 	lb.state = Completed
-	return nil
+	return ctx.Err()
 }
 
-func (lb *LimitBench) runThread(iterations int, stats chan RunStatistics) {
-	for i := 0; i < iterations; i++ {
+func (lb *LimitBench) runThread(ctx context.Context, iterations int, stats chan RunStatistics) {
+	for i := 0; i < iterations && ctx.Err() == nil; i++ {
 		_, elapsed, _ := utils.ExecTimedCmd("ls", "/tmp")
 		//_, elapsed, _ := utils.ExecTimedCmd("date", "")
 		stats <- RunStatistics{
@@ -78,6 +78,11 @@ func (lb *LimitBench) Stats() []RunStatistics {
 	return []RunStatistics{}
 }
 
+// Metrics returns no run-level measurements for the limit benchmark
+func (lb *LimitBench) Metrics() map[string]float64 {
+	return nil
+}
+
 // State returns Created, Running, or Completed
 func (lb *LimitBench) State() State {
 	return lb.state
@@ -0,0 +1,77 @@
+package benches
+
+import "fmt"
+
+// MatrixEntry is one engine build of a driver configuration's version
+// matrix, e.g. one of several runc binaries to bisect a regression between,
+// or one image of a sweep run with the same engine
+type MatrixEntry struct {
+	// Version labels the results of the entry; defaults to the binary path,
+	// or else the image
+	Version string
+	// Binary is the engine client binary (or API socket) of the entry;
+	// defaults to the binary of the driver configuration
+	Binary string
+	// Image is the image run by the entry; defaults to the image of the
+	// driver configuration or benchmark
+	Image string
+	// Env is added to (and overrides) the environment of the driver
+	// configuration while the entry runs, e.g. to select a runtime binary
+	// through a variable used by Generic driver command lines
+	Env map[string]string
+}
+
+// ExpandMatrix returns the driver configurations of the benchmark with each
+// version matrix replaced by one configuration per entry, in the order of the
+// entries, so the builds run one after the other under the same benchmark and
+// their results can be compared as a version trend
+func (b Benchmark) ExpandMatrix() ([]DriverConfig, error) {
+	var drivers []DriverConfig
+	for _, dc := range b.Drivers {
+		if len(dc.Matrix) == 0 {
+			drivers = append(drivers, dc)
+			continue
+		}
+		if dc.Version != "" {
+			return nil, fmt.Errorf("Driver %s has both a version and a version matrix; set the version of each matrix entry instead", dc.Type)
+		}
+		seen := make(map[string]bool)
+		for i, entry := range dc.Matrix {
+			version := entry.Version
+			if version == "" {
+				version = entry.Binary
+			}
+			if version == "" {
+				version = entry.Image
+			}
+			if version == "" {
+				return nil, fmt.Errorf("Matrix entry %d of driver %s requires a version, binary or image", i+1, dc.Type)
+			}
+			if seen[version] {
+				return nil, fmt.Errorf("Duplicate matrix version %q of driver %s", version, dc.Type)
+			}
+			seen[version] = true
+
+			expanded := dc
+			expanded.Matrix = nil
+			expanded.Version = version
+			if entry.Binary != "" {
+				expanded.Binary = entry.Binary
+			}
+			if entry.Image != "" {
+				expanded.Image = entry.Image
+			}
+			if len(entry.Env) > 0 {
+				expanded.Env = make(map[string]string)
+				for name, value := range dc.Env {
+					expanded.Env[name] = value
+				}
+				for name, value := range entry.Env {
+					expanded.Env[name] = value
+				}
+			}
+			drivers = append(drivers, expanded)
+		}
+	}
+	return drivers, nil
+}
@@ -0,0 +1,222 @@
+package benches
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+)
+
+// mixSeparator joins the commands of a mix operation, e.g. "stop+remove"
+const mixSeparator = "+"
+
+// mixOp is a weighted operation of a mix benchmark
+type mixOp struct {
+	commands []string
+	weight   float64
+	// fresh operations start with run on a new container; the others act
+	// on a running container of the thread
+	fresh bool
+	// keep is whether the container is still running afterwards
+	keep bool
+}
+
+// parseMix validates the weighted operations of a mix benchmark against the
+// container lifecycle of the driver type. Each operation either runs a new
+// container or acts on a running one, and must leave it running or removed.
+func parseMix(mix map[string]float64, dtype driver.Type) ([]mixOp, error) {
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("The mix benchmark requires weighted operations in a 'mix:' section")
+	}
+	var names []string
+	for name := range mix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var (
+		ops   []mixOp
+		fresh bool
+	)
+	for _, name := range names {
+		if mix[name] <= 0 {
+			return nil, fmt.Errorf("Invalid weight %v of mix operation %q: must be positive", mix[name], name)
+		}
+		op := mixOp{weight: mix[name]}
+		for _, cmd := range strings.Split(name, mixSeparator) {
+			op.commands = append(op.commands, strings.TrimSpace(cmd))
+		}
+		op.fresh = CanonicalCommand(op.commands[0]) == opRun
+		commands := op.commands
+		if !op.fresh {
+			// validated from a running container
+			commands = append([]string{opRun}, commands...)
+		}
+		if err := ValidateCommands(commands, dtype); err != nil {
+			return nil, fmt.Errorf("Invalid mix operation %q: %v", name, err)
+		}
+		state := ctrCreated
+		for _, cmd := range commands {
+			if CanonicalCommand(cmd) == opVerify {
+				return nil, fmt.Errorf("Invalid mix operation %q: verify is not supported by the mix benchmark", name)
+			}
+			state = transitions[state][CanonicalCommand(cmd)]
+		}
+		if state != ctrRunning && state != ctrRemoved {
+			return nil, fmt.Errorf("Invalid mix operation %q: must leave the container running or removed, not %s", name, state)
+		}
+		op.keep = state == ctrRunning
+		fresh = fresh || op.fresh
+		ops = append(ops, op)
+	}
+	if !fresh {
+		return nil, fmt.Errorf("The mix benchmark requires an operation starting with run")
+	}
+	return ops, nil
+}
+
+// ValidateMix checks the weighted operations of a mix benchmark for the
+// given driver type
+func ValidateMix(mix map[string]float64, dtype driver.Type) error {
+	_, err := parseMix(mix, dtype)
+	return err
+}
+
+// MixSteps returns the steps reported by a mix benchmark: the commands of
+// its operations in lifecycle order
+func MixSteps(mix map[string]float64) []string {
+	seen := make(map[string]bool)
+	var steps []string
+	for name := range mix {
+		for _, cmd := range strings.Split(name, mixSeparator) {
+			if cmd = strings.TrimSpace(cmd); !seen[cmd] {
+				seen[cmd] = true
+				steps = append(steps, cmd)
+			}
+		}
+	}
+	order := map[string]int{opRun: 0, opExec: 1, opLogs: 2, opPause: 3, opUnpause: 4, opCheckpoint: 5, opRestore: 6, opWait: 7, opStop: 8, opRemove: 9}
+	sort.Slice(steps, func(i, j int) bool {
+		oi, oj := order[CanonicalCommand(steps[i])], order[CanonicalCommand(steps[j])]
+		if oi != oj {
+			return oi < oj
+		}
+		return steps[i] < steps[j]
+	})
+	return steps
+}
+
+// MixBench simulates realistic churn: every iteration picks one of a set of
+// weighted operations at random, e.g. 70% run, 20% exec and 10% stop+remove,
+// rather than running a fixed command sequence. Operations which do not start
+// with run act on a random running container of the same thread; while a
+// thread has none, only operations starting with run are picked.
+type MixBench struct {
+	CustomBench
+	ops []mixOp
+	// running holds the running containers of each thread
+	running map[int][]driver.Container
+	mu      sync.Mutex
+}
+
+// Init initializes the benchmark
+func (mb *MixBench) Init(benchmark Benchmark, driverConfig DriverConfig, imageInfo string, trace bool) error {
+	if benchmark.Verify != nil {
+		return fmt.Errorf("verify is not supported by the mix benchmark")
+	}
+	if benchmark.Overlap > 0 {
+		return fmt.Errorf("overlap is not supported by the mix benchmark")
+	}
+	if err := mb.CustomBench.Init(benchmark, driverConfig, imageInfo, trace); err != nil {
+		return err
+	}
+	var err error
+	if mb.ops, err = parseMix(benchmark.Mix, mb.driver.Type()); err != nil {
+		return err
+	}
+	mb.iterate = mb.runMixIteration
+	return nil
+}
+
+// Run executes the benchmark iterations; the containers left running by the
+// operations are stopped and removed (untimed) by the final driver cleanup
+func (mb *MixBench) Run(ctx context.Context, threads, iterations int, commands []string) error {
+	mb.running = make(map[int][]driver.Container)
+	return mb.CustomBench.Run(ctx, threads, iterations, commands)
+}
+
+// Type returns the type of benchmark
+func (mb *MixBench) Type() Type {
+	return Mix
+}
+
+// pick selects an operation at random by weight, taking a running container
+// of the thread for operations which need one
+func (mb *MixBench) pick(threadNum int) (mixOp, driver.Container) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	ctrs := mb.running[threadNum]
+	var total float64
+	for _, op := range mb.ops {
+		if op.fresh || len(ctrs) > 0 {
+			total += op.weight
+		}
+	}
+	r := rand.Float64() * total
+	var chosen mixOp
+	for _, op := range mb.ops {
+		if !op.fresh && len(ctrs) == 0 {
+			continue
+		}
+		chosen = op
+		if r -= op.weight; r < 0 {
+			break
+		}
+	}
+	if chosen.fresh {
+		return chosen, nil
+	}
+	// the container is taken out of the pool while in use, so concurrent
+	// open-loop iterations never act on the same container
+	n := rand.Intn(len(ctrs))
+	ctr := ctrs[n]
+	ctrs[n] = ctrs[len(ctrs)-1]
+	mb.running[threadNum] = ctrs[:len(ctrs)-1]
+	return chosen, ctr
+}
+
+// runMixIteration runs one randomly picked operation; the commands list is
+// not used
+func (mb *MixBench) runMixIteration(ctx context.Context, drv driver.Driver, benchName string, threadNum, threads, i int, commands []string) RunStatistics {
+	op, ctr := mb.pick(threadNum)
+	iterStart := time.Since(mb.started)
+	var name string
+	if ctr != nil {
+		name = ctr.Name()
+	} else {
+		var err error
+		if ctr, name, iterStart, err = mb.createContainer(ctx, drv, threadNum, i); err != nil {
+			stats := mb.createFailed(ctx, benchName, threadNum, threads, i, iterStart, op.commands, err)
+			notify(func(o Observer) { o.IterationDone(benchName, threads) })
+			return stats
+		}
+	}
+	stats := mb.runCommands(ctx, drv, ctr, name, benchName, threadNum, threads, i, iterStart, op.commands)
+	// a container whose operation failed is in an unknown state, so it is
+	// left to the driver cleanup of the next run
+	failed := false
+	for _, errors := range stats.Errors {
+		failed = failed || errors > 0
+	}
+	if op.keep && !failed {
+		mb.mu.Lock()
+		mb.running[threadNum] = append(mb.running[threadNum], ctr)
+		mb.mu.Unlock()
+	}
+	notify(func(o Observer) { o.IterationDone(benchName, threads) })
+	return stats
+}
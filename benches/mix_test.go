@@ -0,0 +1,95 @@
+package benches
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/estesp/bucketbench/driver"
+)
+
+func TestParseMix(t *testing.T) {
+	tests := []struct {
+		name  string
+		mix   map[string]float64
+		dtype driver.Type
+		want  []mixOp
+		err   string
+	}{
+		{
+			name:  "fresh and running operations",
+			mix:   map[string]float64{"run+stop+remove": 3, "exec": 1},
+			dtype: driver.Docker,
+			want: []mixOp{
+				{commands: []string{"exec"}, weight: 1, fresh: false, keep: true},
+				{commands: []string{"run", "stop", "remove"}, weight: 3, fresh: true, keep: false},
+			},
+		},
+		{
+			name:  "aliases and spaces",
+			mix:   map[string]float64{" start + kill + delete ": 1, "run": 2},
+			dtype: driver.Docker,
+			want: []mixOp{
+				{commands: []string{"start", "kill", "delete"}, weight: 1, fresh: true, keep: false},
+				{commands: []string{"run"}, weight: 2, fresh: true, keep: true},
+			},
+		},
+		{
+			name: "empty",
+			err:  "requires weighted operations",
+		},
+		{
+			name:  "non-positive weight",
+			mix:   map[string]float64{"run+stop+remove": 0},
+			dtype: driver.Docker,
+			err:   "must be positive",
+		},
+		{
+			name:  "no operation starting with run",
+			mix:   map[string]float64{"exec": 1},
+			dtype: driver.Docker,
+			err:   "requires an operation starting with run",
+		},
+		{
+			name:  "container left stopped",
+			mix:   map[string]float64{"run+stop": 1},
+			dtype: driver.Docker,
+			err:   "must leave the container running or removed, not stopped",
+		},
+		{
+			name:  "invalid transition",
+			mix:   map[string]float64{"run+remove": 1},
+			dtype: driver.Docker,
+			err:   "is invalid when the container is running",
+		},
+		{
+			name:  "operation the driver does not support",
+			mix:   map[string]float64{"run+pause+unpause": 1},
+			dtype: driver.Kubelet,
+			err:   "is not supported by the Kubelet driver",
+		},
+		{
+			name:  "verify",
+			mix:   map[string]float64{"run+verify": 1},
+			dtype: driver.Docker,
+			err:   "verify is not supported by the mix benchmark",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMix(tt.mix, tt.dtype)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("parseMix() error = %v, want error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMix() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMix() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package benches
+
+import "sync"
+
+// Observer receives the progress of benchmark runs as they execute, e.g. to
+// export live metrics. Methods are called concurrently from benchmark threads.
+type Observer interface {
+	// OpDone is called after every lifecycle operation of an iteration
+	OpDone(bench string, threads int, op string, ms int, failed bool)
+	// IterationDone is called after every iteration
+	IterationDone(bench string, threads int)
+	// RunDone is called when a benchmark run at a thread count completes,
+	// with its rate (iterations/second) and run-level metrics
+	RunDone(bench string, threads int, rate float64, metrics map[string]float64)
+}
+
+// ThreadObserver is an Observer which also follows what each thread of a run
+// is doing, e.g. to display per-thread progress
+type ThreadObserver interface {
+	Observer
+	// OpStart is called before every lifecycle operation of an iteration,
+	// with the thread running it and the index of the iteration
+	OpStart(bench string, threads, thread, iteration int, op string)
+}
+
+var (
+	observersMu sync.Mutex
+	observers   []Observer
+)
+
+// AddObserver registers an observer for all subsequent benchmark runs
+func AddObserver(o Observer) {
+	observersMu.Lock()
+	defer observersMu.Unlock()
+	observers = append(observers, o)
+}
+
+// notify calls fn for each registered observer
+func notify(fn func(o Observer)) {
+	observersMu.Lock()
+	current := observers
+	observersMu.Unlock()
+	for _, o := range current {
+		fn(o)
+	}
+}
+
+// notifyOpStart tells the thread observers that a thread is starting an
+// operation
+func notifyOpStart(bench string, threads, thread, iteration int, op string) {
+	notify(func(o Observer) {
+		if t, ok := o.(ThreadObserver); ok {
+			t.OpStart(bench, threads, thread, iteration, op)
+		}
+	})
+}
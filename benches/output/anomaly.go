@@ -0,0 +1,172 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+)
+
+const (
+	// DefaultAnomalyThreshold is the deviation, in robust standard
+	// deviations, of a p99 from its baseline which is reported as an anomaly
+	DefaultAnomalyThreshold = 3.5
+	// anomalyAlpha is the weight of each run in the EWMA baseline of a series
+	anomalyAlpha = 0.3
+	// anomalyMinRuns is the number of earlier runs of a series needed before
+	// its p99 is checked
+	anomalyMinRuns = 5
+	// anomalyWindow is the number of latest earlier runs the spread of a
+	// series is computed over
+	anomalyWindow = 20
+	// anomalyMinSpread is the smallest spread, relative to the baseline, so a
+	// series of near-identical p99s does not report small changes
+	anomalyMinSpread = 0.01
+	// madScale makes the MAD of normally distributed values an estimate of
+	// their standard deviation
+	madScale = 1.4826
+)
+
+// Anomaly is a shift of the p99 latency of a command of a result at one
+// thread count from the earlier runs of the same host in the history
+type Anomaly struct {
+	// ID is the history ID of the run; zero for a run not stored yet
+	ID      uint64  `json:"id,omitempty"`
+	Name    string  `json:"name"`
+	Threads int     `json:"threads"`
+	Command string  `json:"command"`
+	P99     float64 `json:"p99"`
+	// Baseline is the EWMA of the p99 of the earlier runs
+	Baseline float64 `json:"baseline"`
+	// Score is the deviation from the baseline in robust standard
+	// deviations (the scaled MAD of the latest earlier runs); positive is a
+	// slowdown
+	Score float64 `json:"score"`
+}
+
+// anomalySeries is the p99 history of a command of a result at one thread
+// count on one host
+type anomalySeries struct {
+	values []float64
+	ewma   float64
+}
+
+// anomalyDetector checks reports against the series of the reports added
+// before them
+type anomalyDetector struct {
+	threshold float64
+	series    map[string]*anomalySeries
+}
+
+func newAnomalyDetector(threshold float64) *anomalyDetector {
+	return &anomalyDetector{threshold: threshold, series: make(map[string]*anomalySeries)}
+}
+
+// add checks the p99s of a report against their series, then adds them to
+// the series; a series only becomes a baseline after anomalyMinRuns runs,
+// and a command without a p99 (e.g. every iteration failed) is skipped
+func (d *anomalyDetector) add(id uint64, host string, report Report) []Anomaly {
+	var anomalies []Anomaly
+	for _, result := range report.Results {
+		for _, run := range result.Runs {
+			for _, cmd := range commandOrder(report.Commands, run.Commands) {
+				p99 := run.Commands[cmd].P99
+				if p99 <= 0 {
+					continue
+				}
+				key := fmt.Sprintf("%s/%s/%s", host, runKey(result.Name, run.Threads), cmd)
+				s := d.series[key]
+				if s == nil {
+					s = &anomalySeries{ewma: p99}
+					d.series[key] = s
+				}
+				if len(s.values) >= anomalyMinRuns {
+					score := (p99 - s.ewma) / s.spread()
+					if math.Abs(score) > d.threshold {
+						anomalies = append(anomalies, Anomaly{
+							ID:       id,
+							Name:     result.Name,
+							Threads:  run.Threads,
+							Command:  cmd,
+							P99:      p99,
+							Baseline: s.ewma,
+							Score:    score,
+						})
+					}
+				}
+				s.values = append(s.values, p99)
+				s.ewma = anomalyAlpha*p99 + (1-anomalyAlpha)*s.ewma
+			}
+		}
+	}
+	return anomalies
+}
+
+// spread is the scaled median absolute deviation of the latest values of the
+// series, at least anomalyMinSpread of the baseline
+func (s *anomalySeries) spread() float64 {
+	window := s.values
+	if len(window) > anomalyWindow {
+		window = window[len(window)-anomalyWindow:]
+	}
+	median := medianOf(window)
+	deviations := make([]float64, len(window))
+	for i, v := range window {
+		deviations[i] = math.Abs(v - median)
+	}
+	return math.Max(madScale*medianOf(deviations), anomalyMinSpread*s.ewma)
+}
+
+func medianOf(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// Anomalies checks every stored run against the runs of the same host stored
+// before it, and returns the p99 shifts beyond threshold (see Anomaly)
+func (h *History) Anomalies(threshold float64) ([]Anomaly, error) {
+	detector := newAnomalyDetector(threshold)
+	var anomalies []Anomaly
+	err := h.forEachReport(func(entry HistoryEntry, report Report) error {
+		anomalies = append(anomalies, detector.add(entry.ID, entry.Hostname, report)...)
+		return nil
+	})
+	return anomalies, err
+}
+
+// AnomaliesOf checks a report which is not stored yet against the stored
+// runs of its host, and returns its p99 shifts beyond threshold
+func (h *History) AnomaliesOf(report Report, threshold float64) ([]Anomaly, error) {
+	detector := newAnomalyDetector(threshold)
+	err := h.forEachReport(func(entry HistoryEntry, stored Report) error {
+		if entry.Hostname == report.Environment.Hostname {
+			detector.add(entry.ID, entry.Hostname, stored)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return detector.add(0, report.Environment.Hostname, report), nil
+}
+
+// writeAnomalies displays the p99 anomalies of a report
+func writeAnomalies(out io.Writer, report Report, precision int) {
+	if len(report.Anomalies) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "P99 ANOMALIES (shifts from the history of this host)\n\n")
+	w := tabwriter.NewWriter(out, 10, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "Result\tThreads\tCommand\tP99\tBaseline\tScore\t\n")
+	for _, a := range report.Anomalies {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%6.*f\t%6.*f\t%+.1f\t\n", a.Name, a.Threads, a.Command, precision, a.P99, precision, a.Baseline, a.Score)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "")
+}
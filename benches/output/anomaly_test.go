@@ -0,0 +1,71 @@
+package output
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func p99Report(host string, p99 float64) Report {
+	return Report{
+		SchemaVersion: SchemaVersion,
+		Benchmark:     "basic",
+		Commands:      []string{"run"},
+		Environment:   Environment{Hostname: host},
+		Results: []Result{{
+			Name: "basic:Docker",
+			Runs: []Run{{Threads: 1, Commands: map[string]CommandSummary{"run": {P99: p99}}}},
+		}},
+	}
+}
+
+func TestAnomalies(t *testing.T) {
+	history, err := OpenHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+	for _, p99 := range []float64{100, 103, 98, 101, 99, 102, 100} {
+		if _, err := history.Add(p99Report("bench01", p99)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a slower host does not shift the series of bench01
+	if _, err := history.Add(p99Report("bench02", 300)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		host    string
+		p99     float64
+		anomaly bool
+	}{
+		{"bench01", 104, false},
+		{"bench01", 150, true},
+		{"bench01", 60, true},
+		// too few earlier runs on bench02
+		{"bench02", 900, false},
+	} {
+		anomalies, err := history.AnomaliesOf(p99Report(c.host, c.p99), DefaultAnomalyThreshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(anomalies) > 0; got != c.anomaly {
+			t.Errorf("p99 %v on %s: anomaly %v, want %v (%+v)", c.p99, c.host, got, c.anomaly, anomalies)
+			continue
+		}
+		if c.anomaly && (anomalies[0].Score > 0) != (c.p99 > anomalies[0].Baseline) {
+			t.Errorf("p99 %v on %s: score %+.1f for baseline %.2f", c.p99, c.host, anomalies[0].Score, anomalies[0].Baseline)
+		}
+	}
+
+	if _, err := history.Add(p99Report("bench01", 150)); err != nil {
+		t.Fatal(err)
+	}
+	anomalies, err := history.Anomalies(DefaultAnomalyThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anomalies) != 1 || anomalies[0].ID != 9 {
+		t.Errorf("anomalies of the stored runs = %+v, want one of run 9", anomalies)
+	}
+}
@@ -0,0 +1,73 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WriteBenchstat writes the step timings of the report in the Go benchmark
+// format read by benchstat, so two runs can be compared with its statistical
+// tests. Every successful step of every iteration is one sample named
+// Benchmark<benchmark>/driver=<result>/step=<step>-<threads>, and the host is
+// recorded in the configuration lines. Failed steps are left out.
+func WriteBenchstat(w io.Writer, report Report) error {
+	env := report.Environment
+	for _, config := range [][2]string{
+		{"goos", env.OS},
+		{"goarch", env.Arch},
+		{"pkg", "github.com/estesp/bucketbench"},
+		{"host", env.Hostname},
+		{"kernel", env.Kernel},
+		{"runid", report.RunID},
+	} {
+		if config[1] != "" {
+			if _, err := fmt.Fprintf(w, "%s: %s\n", config[0], config[1]); err != nil {
+				return err
+			}
+		}
+	}
+	// a benchmark name must not continue with a lowercase letter
+	bench := benchstatName(report.Benchmark)
+	first, size := utf8.DecodeRuneInString(bench)
+	bench = string(unicode.ToUpper(first)) + bench[size:]
+	for _, result := range report.Results {
+		driver := benchstatName(strings.TrimPrefix(result.Name, report.Benchmark+":"))
+		for _, run := range result.Runs {
+			for _, stat := range run.Statistics {
+				for _, step := range report.Commands {
+					ms, ok := stat.Durations[step]
+					if !ok || stat.Errors[step] > 0 {
+						continue
+					}
+					nanos := int64(ms) * 1e6
+					if exact, ok := stat.Nanos[step]; ok {
+						nanos = exact
+					}
+					_, err := fmt.Fprintf(w, "Benchmark%s/driver=%s/step=%s-%d\t1\t%d ns/op\n", bench, driver, benchstatName(step), run.Threads, nanos)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// benchstatName makes a name usable in a benchmark name: whitespace and the
+// '/' separator are replaced with '_'
+func benchstatName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '/' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		return "_"
+	}
+	return name
+}
@@ -0,0 +1,172 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/estesp/bucketbench/benches"
+)
+
+// Delta is the change of one metric of a driver at one thread count between
+// two reports
+type Delta struct {
+	Name    string  `json:"name"`
+	Threads int     `json:"threads"`
+	Metric  string  `json:"metric"`
+	Old     float64 `json:"old"`
+	New     float64 `json:"new"`
+	// Percent is the change from old to new; positive is an increase
+	Percent float64 `json:"percent"`
+	// Regression is set when the change is worse than the threshold
+	Regression bool `json:"regression"`
+}
+
+// ReadJSON reads a report written by WriteJSON
+func ReadJSON(r io.Reader) (Report, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return report, err
+	}
+	if report.SchemaVersion != SchemaVersion {
+		return report, fmt.Errorf("unsupported report schema version %d (expected %d)", report.SchemaVersion, SchemaVersion)
+	}
+	return report, nil
+}
+
+// Compare computes the deltas of the rate and the median and p95 timing of
+// each command for every driver and thread count present in both reports. A
+// rate drop, or a timing increase, of more than threshold percent is marked
+// as a regression.
+func Compare(old, current Report, threshold float64) []Delta {
+	oldRuns := make(map[string]Run)
+	for _, result := range old.Results {
+		for _, run := range result.Runs {
+			oldRuns[runKey(result.Name, run.Threads)] = run
+		}
+	}
+	var deltas []Delta
+	for _, result := range current.Results {
+		for _, run := range result.Runs {
+			oldRun, ok := oldRuns[runKey(result.Name, run.Threads)]
+			if !ok {
+				continue
+			}
+			add := func(metric string, oldValue, newValue float64, higherIsBetter bool) {
+				if oldValue == 0 {
+					return
+				}
+				d := Delta{
+					Name:    result.Name,
+					Threads: run.Threads,
+					Metric:  metric,
+					Old:     oldValue,
+					New:     newValue,
+					Percent: (newValue - oldValue) / oldValue * 100,
+				}
+				if higherIsBetter {
+					d.Regression = d.Percent < -threshold
+				} else {
+					d.Regression = d.Percent > threshold
+				}
+				deltas = append(deltas, d)
+			}
+			add("rate", oldRun.Rate, run.Rate, true)
+			var commands []string
+			for cmd := range run.Commands {
+				commands = append(commands, cmd)
+			}
+			sort.Strings(commands)
+			for _, cmd := range commands {
+				oldSummary, ok := oldRun.Commands[cmd]
+				if !ok {
+					continue
+				}
+				add(cmd+" median", oldSummary.Median, run.Commands[cmd].Median, false)
+				add(cmd+" p95", oldSummary.P95, run.Commands[cmd].P95, false)
+			}
+		}
+	}
+	return deltas
+}
+
+// HostFactor returns how much slower the host of the current calibration
+// profile runs the primitive operations container engines build upon than the
+// host of the old one: the geometric mean of the ratios of the median timings
+// of the operations calibrated without errors on both hosts, along with the
+// names of those operations
+func HostFactor(old, current benches.CalibrationProfile) (float64, []string, error) {
+	var (
+		ops    []string
+		logSum float64
+	)
+	for name, oldOp := range old.Operations {
+		op, ok := current.Operations[name]
+		if !ok || oldOp.Errors > 0 || op.Errors > 0 || oldOp.Median <= 0 || op.Median <= 0 {
+			continue
+		}
+		ops = append(ops, name)
+		logSum += math.Log(op.Median / oldOp.Median)
+	}
+	if len(ops) == 0 {
+		return 0, nil, fmt.Errorf("the calibration profiles have no operation calibrated without errors on both hosts")
+	}
+	sort.Strings(ops)
+	return math.Exp(logSum / float64(len(ops))), ops, nil
+}
+
+// Normalize returns a copy of the report with the rates and command timings of
+// its runs scaled to a host factor times faster, so the results of a host
+// with factor HostFactor(old, current) are comparable with those of the old
+// host
+func Normalize(report Report, factor float64) Report {
+	results := make([]Result, len(report.Results))
+	for i, result := range report.Results {
+		runs := make([]Run, len(result.Runs))
+		for j, run := range result.Runs {
+			run.Rate *= factor
+			commands := make(map[string]CommandSummary, len(run.Commands))
+			for cmd, summary := range run.Commands {
+				summary.Min /= factor
+				summary.Max /= factor
+				summary.Avg /= factor
+				summary.Median /= factor
+				summary.P90 /= factor
+				summary.P95 /= factor
+				summary.P99 /= factor
+				summary.Stddev /= factor
+				commands[cmd] = summary
+			}
+			run.Commands = commands
+			runs[j] = run
+		}
+		result.Runs = runs
+		results[i] = result
+	}
+	report.Results = results
+	return report
+}
+
+// ImageMismatches returns the names of the results present in both reports
+// whose images were pinned to different digests, so their timings were not
+// measured with the same workload
+func ImageMismatches(old, current Report) []string {
+	oldDigests := make(map[string]string)
+	for _, result := range old.Results {
+		oldDigests[result.Name] = result.ImageDigest
+	}
+	var names []string
+	for _, result := range current.Results {
+		oldDigest, ok := oldDigests[result.Name]
+		if ok && oldDigest != "" && result.ImageDigest != "" && oldDigest != result.ImageDigest {
+			names = append(names, result.Name)
+		}
+	}
+	return names
+}
+
+func runKey(name string, threads int) string {
+	return fmt.Sprintf("%s:%d", name, threads)
+}
@@ -0,0 +1,67 @@
+package output
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/estesp/bucketbench/benches"
+)
+
+func TestHostFactor(t *testing.T) {
+	old := benches.CalibrationProfile{Operations: map[string]benches.CalibrationOp{
+		"forkexec": {Median: 400},
+		"cgroup":   {Median: 100},
+		"netns":    {Median: 1000, Errors: 3},
+	}}
+	current := benches.CalibrationProfile{Operations: map[string]benches.CalibrationOp{
+		"forkexec": {Median: 800},
+		"cgroup":   {Median: 400},
+		"netns":    {Median: 10},
+	}}
+	factor, ops, err := HostFactor(old, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the geometric mean of 2x and 4x; netns failed on the old host
+	if math.Abs(factor-math.Sqrt(8)) > 1e-9 {
+		t.Errorf("factor = %v, want %v", factor, math.Sqrt(8))
+	}
+	if want := []string{"cgroup", "forkexec"}; !reflect.DeepEqual(ops, want) {
+		t.Errorf("ops = %v, want %v", ops, want)
+	}
+
+	if _, _, err := HostFactor(old, benches.CalibrationProfile{}); err == nil {
+		t.Error("HostFactor of a profile without operations succeeded")
+	}
+}
+
+func TestNormalizeCompare(t *testing.T) {
+	report := func(rate, median float64) Report {
+		return Report{Results: []Result{{
+			Name: "Docker",
+			Runs: []Run{{
+				Threads:  1,
+				Rate:     rate,
+				Commands: map[string]CommandSummary{"run": {Median: median, P95: 2 * median}},
+			}},
+		}}}
+	}
+	old := report(10, 100)
+	// the same engine on a host twice as slow
+	current := report(5, 200)
+	for _, d := range Compare(old, current, 10) {
+		if !d.Regression {
+			t.Errorf("%s: a change of %+.1f%% is not a regression without normalization", d.Metric, d.Percent)
+		}
+	}
+	normalized := Normalize(current, 2)
+	for _, d := range Compare(old, normalized, 10) {
+		if d.Regression || d.Percent != 0 {
+			t.Errorf("%s: normalized change %+.1f%% (regression %v), want none", d.Metric, d.Percent, d.Regression)
+		}
+	}
+	if current.Results[0].Runs[0].Commands["run"].Median != 200 {
+		t.Error("Normalize modified the report it was given")
+	}
+}
@@ -0,0 +1,157 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/estesp/bucketbench/benches"
+	"github.com/montanaflynn/stats"
+)
+
+// ConcurrencyBucket summarizes the latency of the samples of a step taken
+// while Min to Max operations (including the step itself) were in flight
+type ConcurrencyBucket struct {
+	Min     int     `json:"min"`
+	Max     int     `json:"max"`
+	Samples int     `json:"samples"`
+	Median  float64 `json:"median"`
+	P90     float64 `json:"p90"`
+	P99     float64 `json:"p99"`
+}
+
+// concurrencyBucket returns the bounds of the power-of-two bucket of a
+// concurrency level: 1, 2, 3-4, 5-8, 9-16, ...
+func concurrencyBucket(level int) (int, int) {
+	max := 1
+	for max < level {
+		max *= 2
+	}
+	if max <= 2 {
+		return max, max
+	}
+	return max/2 + 1, max
+}
+
+// ConcurrencyBuckets buckets the samples of each step of a run's iterations
+// by the number of operations in flight when they started, and computes the
+// latency percentiles of each bucket; failed steps are left out
+func ConcurrencyBuckets(statistics []benches.RunStatistics) map[string][]ConcurrencyBucket {
+	samples := make(map[string]map[int][]float64)
+	for _, stat := range statistics {
+		for step, level := range stat.Concurrency {
+			ms, ok := stat.Durations[step]
+			if !ok || stat.Errors[step] > 0 {
+				continue
+			}
+			value := float64(ms)
+			if nanos, ok := stat.Nanos[step]; ok {
+				value = float64(nanos) / 1e6
+			}
+			if samples[step] == nil {
+				samples[step] = make(map[int][]float64)
+			}
+			_, max := concurrencyBucket(level)
+			samples[step][max] = append(samples[step][max], value)
+		}
+	}
+	result := make(map[string][]ConcurrencyBucket)
+	for step, byBucket := range samples {
+		var maxes []int
+		for max := range byBucket {
+			maxes = append(maxes, max)
+		}
+		sort.Ints(maxes)
+		for _, max := range maxes {
+			values := byBucket[max]
+			bucket := ConcurrencyBucket{Samples: len(values)}
+			bucket.Min, bucket.Max = concurrencyBucket(max)
+			bucket.Median, _ = stats.Median(values)
+			bucket.P90 = bucketPercentile(values, 90)
+			bucket.P99 = bucketPercentile(values, 99)
+			result[step] = append(result[step], bucket)
+		}
+	}
+	return result
+}
+
+// bucketPercentile returns a percentile of the samples of a bucket, or their
+// maximum for buckets too small to compute it from
+func bucketPercentile(values []float64, percent float64) float64 {
+	p, err := stats.Percentile(values, percent)
+	if err != nil || math.IsNaN(p) {
+		p, _ = stats.Max(values)
+	}
+	return p
+}
+
+// RoundBuckets rounds the timings of the concurrency buckets to the given
+// number of decimal places, for rendering
+func RoundBuckets(buckets map[string][]ConcurrencyBucket, precision int) map[string][]ConcurrencyBucket {
+	for _, steps := range buckets {
+		for i := range steps {
+			steps[i].Median = Round(steps[i].Median, precision)
+			steps[i].P90 = Round(steps[i].P90, precision)
+			steps[i].P99 = Round(steps[i].P99, precision)
+		}
+	}
+	return buckets
+}
+
+// writeConcurrency displays the median and p99 latency of each step by the
+// number of operations in flight, for the runs which reached more than one
+// concurrency bucket
+func writeConcurrency(out io.Writer, report Report, precision int) {
+	header := false
+	w := tabwriter.NewWriter(out, 10, 4, 2, ' ', tabwriter.AlignRight)
+	for _, result := range report.Results {
+		for _, run := range result.Runs {
+			var levels []int
+			seen := make(map[int]bool)
+			for _, buckets := range run.Concurrency {
+				for _, b := range buckets {
+					if !seen[b.Max] {
+						seen[b.Max] = true
+						levels = append(levels, b.Max)
+					}
+				}
+			}
+			if len(levels) < 2 {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(out, "LATENCY BY OPERATIONS IN FLIGHT (median/p99)\n")
+				header = true
+			}
+			sort.Ints(levels)
+			fmt.Fprintf(w, "%s:%d", result.Name, run.Threads)
+			for _, max := range levels {
+				if min, _ := concurrencyBucket(max); min == max {
+					fmt.Fprintf(w, "\t%d", max)
+				} else {
+					fmt.Fprintf(w, "\t%d-%d", min, max)
+				}
+			}
+			fmt.Fprintln(w, "\t ")
+			for _, step := range commandOrder(report.Commands, run.Commands) {
+				byMax := make(map[int]ConcurrencyBucket)
+				for _, b := range run.Concurrency[step] {
+					byMax[b.Max] = b
+				}
+				fmt.Fprintf(w, "%s", step)
+				for _, max := range levels {
+					if b, ok := byMax[max]; ok {
+						fmt.Fprintf(w, "\t%.*f/%.*f", precision, b.Median, precision, b.P99)
+					} else {
+						fmt.Fprintf(w, "\t-")
+					}
+				}
+				fmt.Fprintln(w, "\t ")
+			}
+			w.Flush()
+			fmt.Fprintln(out, "")
+		}
+	}
+}
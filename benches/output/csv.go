@@ -0,0 +1,250 @@
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/estesp/bucketbench/benches"
+)
+
+var csvHeader = []string{"driver", "threads", "thread", "iteration", "step", "ms", "error", "user_ms", "sys_ms", "gc_pause_us", "in_flight", "error_class", "retries", "runq_us"}
+
+// WriteCSV writes the raw timings of the report with one row per (driver,
+// thread count, iteration, step), for analysis in other tools. Steps follow
+// the order of the benchmark's command list; user_ms and sys_ms are empty
+// for drivers which don't report client process usage. In exact mode ms has
+// the full nanosecond resolution of the sample. gc_pause_us is the time the
+// harness itself was paused by its garbage collector during the step, and
+// in_flight the number of operations in flight when it started (empty for
+// benchmark types which don't track it). error_class is the class of the
+// error of a failed step and retries the number of times it was retried.
+// runq_us is the run queue delay of the engine daemons during the step, with
+// schedDelay.
+func WriteCSV(w io.Writer, report Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, result := range report.Results {
+		for _, run := range result.Runs {
+			for _, stat := range run.Statistics {
+				for _, step := range report.Commands {
+					ms, ok := stat.Durations[step]
+					if !ok {
+						// step not reached in this iteration
+						continue
+					}
+					msText := strconv.Itoa(ms)
+					if nanos, ok := stat.Nanos[step]; ok {
+						msText = strconv.FormatFloat(float64(nanos)/1e6, 'f', -1, 64)
+					}
+					errFlag := "0"
+					if stat.Errors[step] > 0 {
+						errFlag = "1"
+					}
+					var user, sys, inFlight, runQueue string
+					if n, ok := stat.Concurrency[step]; ok {
+						inFlight = strconv.Itoa(n)
+					}
+					if n, ok := stat.RunQueueMicros[step]; ok {
+						runQueue = strconv.Itoa(n)
+					}
+					if u, ok := stat.UserTimes[step]; ok {
+						user = strconv.Itoa(u)
+						sys = strconv.Itoa(stat.SysTimes[step])
+					}
+					row := []string{
+						result.Name,
+						strconv.Itoa(run.Threads),
+						strconv.Itoa(stat.Thread),
+						strconv.Itoa(stat.Iteration),
+						step,
+						msText,
+						errFlag,
+						user,
+						sys,
+						strconv.Itoa(stat.GCPauseMicros[step]),
+						inFlight,
+						stat.ErrorClasses[step],
+						strconv.Itoa(stat.Retries[step]),
+						runQueue,
+					}
+					if err := cw.Write(row); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads the raw timings written by WriteCSV back into a report, e.g.
+// to convert them to another format. The rows are regrouped into results,
+// runs and iterations and the command statistics recomputed from them;
+// columns missing from the CSV of older versions are left empty. The CSV does
+// not record the benchmark name, environment or rates, so the rates of the
+// runs are zero.
+func ReadCSV(r io.Reader) (Report, error) {
+	var report Report
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return report, fmt.Errorf("Error reading the CSV header: %v", err)
+	}
+	column := make(map[string]int)
+	for i, name := range header {
+		column[name] = i
+	}
+	for _, name := range []string{"driver", "threads", "thread", "iteration", "step", "ms"} {
+		if _, ok := column[name]; !ok {
+			return report, fmt.Errorf("The CSV has no %q column; not a raw timings file", name)
+		}
+	}
+	type runKey struct {
+		result, threads int
+	}
+	type iterationKey struct {
+		runKey
+		thread, iteration int
+	}
+	results := make(map[string]int)
+	runs := make(map[runKey][]*benches.RunStatistics)
+	var runOrder []runKey
+	iterations := make(map[iterationKey]*benches.RunStatistics)
+	seenStep := make(map[string]bool)
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		field := func(name string) string {
+			if i, ok := column[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		number := func(name string) (int, bool, error) {
+			text := field(name)
+			if text == "" {
+				return 0, false, nil
+			}
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				return 0, false, fmt.Errorf("Invalid %s %q on line %d of the CSV", name, text, line)
+			}
+			return n, true, nil
+		}
+		var key iterationKey
+		if key.threads, _, err = number("threads"); err != nil {
+			return report, err
+		}
+		if key.thread, _, err = number("thread"); err != nil {
+			return report, err
+		}
+		if key.iteration, _, err = number("iteration"); err != nil {
+			return report, err
+		}
+		ms, err := strconv.ParseFloat(field("ms"), 64)
+		if err != nil {
+			return report, fmt.Errorf("Invalid ms %q on line %d of the CSV", field("ms"), line)
+		}
+		name, step := field("driver"), field("step")
+		if !seenStep[step] {
+			seenStep[step] = true
+			report.Commands = append(report.Commands, step)
+		}
+		index, ok := results[name]
+		if !ok {
+			index = len(report.Results)
+			results[name] = index
+			report.Results = append(report.Results, Result{Name: name})
+		}
+		key.result = index
+		stat, ok := iterations[key]
+		if !ok {
+			if _, ok := runs[key.runKey]; !ok {
+				runOrder = append(runOrder, key.runKey)
+			}
+			stat = &benches.RunStatistics{
+				Thread:    key.thread,
+				Iteration: key.iteration,
+				Durations: make(map[string]int),
+			}
+			iterations[key] = stat
+			runs[key.runKey] = append(runs[key.runKey], stat)
+		}
+		stat.Durations[step] = int(ms)
+		if ms != float64(int(ms)) {
+			if stat.Nanos == nil {
+				stat.Nanos = make(map[string]int64)
+			}
+			stat.Nanos[step] = int64(ms * 1e6)
+		}
+		if field("error") == "1" {
+			stat.Errors = setStep(stat.Errors, step, 1)
+		}
+		if class := field("error_class"); class != "" {
+			if stat.ErrorClasses == nil {
+				stat.ErrorClasses = make(map[string]string)
+			}
+			stat.ErrorClasses[step] = class
+		}
+		columns := []struct {
+			name  string
+			steps *map[string]int
+			// keepZero is set for the columns whose zeroes are not left
+			// out by the harness
+			keepZero bool
+		}{
+			{"user_ms", &stat.UserTimes, true},
+			{"sys_ms", &stat.SysTimes, true},
+			{"gc_pause_us", &stat.GCPauseMicros, false},
+			{"in_flight", &stat.Concurrency, true},
+			{"retries", &stat.Retries, false},
+			{"runq_us", &stat.RunQueueMicros, true},
+		}
+		for _, c := range columns {
+			n, ok, err := number(c.name)
+			if err != nil {
+				return report, err
+			}
+			if ok && (n != 0 || c.keepZero) {
+				*c.steps = setStep(*c.steps, step, n)
+			}
+		}
+	}
+	for _, key := range runOrder {
+		run := Run{Threads: key.threads}
+		result := &report.Results[key.result]
+		for _, stat := range runs[key] {
+			run.Statistics = append(run.Statistics, *stat)
+			if stat.Iteration >= result.Iterations {
+				result.Iterations = stat.Iteration + 1
+			}
+		}
+		run.Commands = Summarize(run.Statistics)
+		result.Runs = append(result.Runs, run)
+		if key.threads > result.Threads {
+			result.Threads = key.threads
+		}
+	}
+	return report, nil
+}
+
+// setStep sets the value of a step in a map of step values, creating the map
+// if needed
+func setStep(steps map[string]int, step string, value int) map[string]int {
+	if steps == nil {
+		steps = make(map[string]int)
+	}
+	steps[step] = value
+	return steps
+}
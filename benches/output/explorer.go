@@ -0,0 +1,420 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// explorerPercentiles are the points of the percentile charts of a run
+var explorerPercentiles = []string{"min", "p50", "p90", "p95", "p99", "max"}
+
+// Explorer serves a small web UI over a history database, so the stored runs
+// can be browsed without standing up a dashboard: the runs filtered by
+// benchmark, host, driver and tag with the trend of their rates, the
+// percentile charts of a run, and the diff of two runs. The charts are drawn
+// with plotly.js, loaded from its CDN when a page is viewed. The database is
+// opened for each request, so runs can store results while the UI is up.
+type Explorer struct {
+	path      string
+	threshold float64
+	// mu serializes the requests, as the database is locked while open
+	mu  sync.Mutex
+	mux *http.ServeMux
+}
+
+// explorerChart is a plotly chart of a page
+type explorerChart struct {
+	ID     string
+	Data   template.JS
+	Layout template.JS
+}
+
+// plotTrace is a plotly trace
+type plotTrace struct {
+	Name string        `json:"name"`
+	Type string        `json:"type"`
+	Mode string        `json:"mode,omitempty"`
+	X    []interface{} `json:"x"`
+	Y    []float64     `json:"y"`
+}
+
+// explorerRow is a command of a result at one thread count
+type explorerRow struct {
+	Name    string
+	Threads int
+	Rate    float64
+	Command string
+	Summary CommandSummary
+}
+
+// explorerData is rendered by the explorer's pages; each page uses the
+// fields of its own
+type explorerData struct {
+	Title    string
+	PlotlyJS string
+	Action   string
+	// Hidden holds the parameters of the page kept by the filter form
+	Hidden  map[string]string
+	Filter  HistoryFilter
+	Query   template.URL
+	Drivers []string
+	Tags    []string
+	Benches []string
+	Hosts   []string
+	Charts  []explorerChart
+
+	// the runs
+	Entries []HistoryEntry
+	Threads []int
+	// a run
+	Entry HistoryEntry
+	Rows  []explorerRow
+	// the diff of two runs
+	Old, New    HistoryEntry
+	Deltas      []Delta
+	Threshold   float64
+	Regressions int
+}
+
+// NewExplorer creates the UI of the history database at path; the diff of
+// two runs marks changes worse than threshold percent as regressions, as
+// Compare does
+func NewExplorer(path string, threshold float64) *Explorer {
+	e := &Explorer{path: path, threshold: threshold, mux: http.NewServeMux()}
+	e.mux.HandleFunc("/", e.runs)
+	e.mux.HandleFunc("/run", e.run)
+	e.mux.HandleFunc("/diff", e.diff)
+	return e
+}
+
+func (e *Explorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mux.ServeHTTP(w, r)
+}
+
+// history opens the database for fn
+func (e *Explorer) history(fn func(*History) error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	history, err := OpenHistory(e.path)
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+	return fn(history)
+}
+
+// page returns the data common to the pages: the filter of the request and
+// the benchmarks, hosts, drivers and tags of the stored runs to filter by
+func (e *Explorer) page(r *http.Request, title string, entries []HistoryEntry) explorerData {
+	q := r.URL.Query()
+	data := explorerData{
+		Title:    title,
+		PlotlyJS: plotlyJS,
+		Action:   r.URL.Path,
+		Hidden:   make(map[string]string),
+		Filter: HistoryFilter{
+			Benchmark: q.Get("benchmark"),
+			Host:      q.Get("host"),
+			Driver:    q.Get("driver"),
+			Tag:       q.Get("tag"),
+		},
+	}
+	filter := url.Values{}
+	for _, name := range []string{"benchmark", "host", "driver", "tag"} {
+		if v := q.Get(name); v != "" {
+			filter.Set(name, v)
+		}
+	}
+	data.Query = template.URL(filter.Encode())
+	benchmarks, hosts, drivers, tags := make(map[string]bool), make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	for _, entry := range entries {
+		benchmarks[entry.Benchmark] = true
+		hosts[entry.Hostname] = true
+		for _, result := range entry.Results {
+			drivers[ResultDriver(result.Name)] = true
+			for _, tag := range ResultTags(result.Name) {
+				tags[tag] = true
+			}
+		}
+	}
+	data.Benches, data.Hosts, data.Drivers, data.Tags = sortedKeys(benchmarks), sortedKeys(hosts), sortedKeys(drivers), sortedKeys(tags)
+	return data
+}
+
+// runs lists the runs passing the filter, with the trend of their rates
+func (e *Explorer) runs(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	var entries []HistoryEntry
+	if err := e.history(func(h *History) (err error) {
+		entries, err = h.Entries()
+		return err
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := e.page(r, "Stored runs", entries)
+	data.Entries = data.Filter.Entries(entries)
+	threads := 0
+	traces := make(map[string]*plotTrace)
+	var names []string
+	for _, entry := range data.Entries {
+		for _, result := range entry.Results {
+			if len(result.Rates) > threads {
+				threads = len(result.Rates)
+			}
+			for i, rate := range result.Rates {
+				name := fmt.Sprintf("%s (%d thrds)", result.Name, i+1)
+				if traces[name] == nil {
+					traces[name] = &plotTrace{Name: name, Type: "scatter", Mode: "lines+markers"}
+					names = append(names, name)
+				}
+				traces[name].X = append(traces[name].X, entry.Time.Format("2006-01-02 15:04:05"))
+				traces[name].Y = append(traces[name].Y, rate)
+			}
+		}
+	}
+	for i := 1; i <= threads; i++ {
+		data.Threads = append(data.Threads, i)
+	}
+	var trend []plotTrace
+	for _, name := range names {
+		trend = append(trend, *traces[name])
+	}
+	if len(trend) > 0 {
+		chart, err := newExplorerChart("rates", trend, "Rate across runs", "stored", "iterations/s")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Charts = append(data.Charts, chart)
+	}
+	e.render(w, explorerRunsPage, data)
+}
+
+// run shows the percentile charts and statistics of the commands of a run
+func (e *Explorer) run(w http.ResponseWriter, r *http.Request) {
+	var (
+		entries []HistoryEntry
+		report  Report
+		entry   HistoryEntry
+	)
+	id := r.URL.Query().Get("id")
+	if err := e.history(func(h *History) (err error) {
+		if entries, err = h.Entries(); err != nil {
+			return err
+		}
+		entry, report, err = h.Report(id)
+		return err
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	data := e.page(r, fmt.Sprintf("Run %d: %s on %s", entry.ID, entry.Benchmark, entry.Hostname), entries)
+	data.Hidden["id"] = id
+	data.Entry = entry
+	commands := report.Commands
+	if len(commands) == 0 {
+		seen := make(map[string]bool)
+		for _, result := range report.Results {
+			for _, run := range result.Runs {
+				for cmd := range run.Commands {
+					seen[cmd] = true
+				}
+			}
+		}
+		commands = sortedKeys(seen)
+	}
+	for i, cmd := range commands {
+		var traces []plotTrace
+		for _, result := range report.Results {
+			if !data.Filter.MatchResult(result.Name) {
+				continue
+			}
+			for _, run := range result.Runs {
+				summary, ok := run.Commands[cmd]
+				if !ok {
+					continue
+				}
+				data.Rows = append(data.Rows, explorerRow{Name: result.Name, Threads: run.Threads, Rate: run.Rate, Command: cmd, Summary: summary})
+				trace := plotTrace{Name: fmt.Sprintf("%s (%d thrds)", result.Name, run.Threads), Type: "scatter", Mode: "lines+markers"}
+				for _, p := range explorerPercentiles {
+					trace.X = append(trace.X, p)
+				}
+				trace.Y = []float64{summary.Min, summary.Median, summary.P90, summary.P95, summary.P99, summary.Max}
+				traces = append(traces, trace)
+			}
+		}
+		if len(traces) == 0 {
+			continue
+		}
+		chart, err := newExplorerChart(fmt.Sprintf("cmd%d", i), traces, cmd+" latency percentiles", "percentile", "ms")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Charts = append(data.Charts, chart)
+	}
+	e.render(w, explorerRunPage, data)
+}
+
+// diff compares two runs: the new run's changes from the old one of the rate
+// and the median and p95 timings of each command
+func (e *Explorer) diff(w http.ResponseWriter, r *http.Request) {
+	var (
+		entries            []HistoryEntry
+		oldEntry, newEntry HistoryEntry
+		old, current       Report
+	)
+	q := r.URL.Query()
+	if err := e.history(func(h *History) (err error) {
+		if entries, err = h.Entries(); err != nil {
+			return err
+		}
+		if oldEntry, old, err = h.Report(q.Get("old")); err != nil {
+			return err
+		}
+		newEntry, current, err = h.Report(q.Get("new"))
+		return err
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	threshold := e.threshold
+	if t := q.Get("threshold"); t != "" {
+		var err error
+		if threshold, err = strconv.ParseFloat(t, 64); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid threshold %q", t), http.StatusBadRequest)
+			return
+		}
+	}
+	data := e.page(r, fmt.Sprintf("Diff of run %d and run %d", oldEntry.ID, newEntry.ID), entries)
+	data.Hidden["old"] = q.Get("old")
+	data.Hidden["new"] = q.Get("new")
+	data.Hidden["threshold"] = strconv.FormatFloat(threshold, 'f', -1, 64)
+	data.Old, data.New, data.Threshold = oldEntry, newEntry, threshold
+	for _, d := range Compare(old, current, threshold) {
+		if !data.Filter.MatchResult(d.Name) {
+			continue
+		}
+		data.Deltas = append(data.Deltas, d)
+		if d.Regression {
+			data.Regressions++
+		}
+	}
+	e.render(w, explorerDiffPage, data)
+}
+
+func newExplorerChart(id string, traces []plotTrace, title, xTitle, yTitle string) (explorerChart, error) {
+	layout := map[string]interface{}{
+		"title":  title,
+		"xaxis":  map[string]string{"title": xTitle},
+		"yaxis":  map[string]string{"title": yTitle},
+		"height": 450,
+	}
+	data, err := json.Marshal(traces)
+	if err != nil {
+		return explorerChart{}, err
+	}
+	layoutData, err := json.Marshal(layout)
+	if err != nil {
+		return explorerChart{}, err
+	}
+	return explorerChart{ID: id, Data: template.JS(data), Layout: template.JS(layoutData)}, nil
+}
+
+func (e *Explorer) render(w http.ResponseWriter, page *template.Template, data explorerData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// explorerPage parses the content of a page into the layout
+func explorerPage(content string) *template.Template {
+	return template.Must(template.Must(explorerLayout.Clone()).Parse(content))
+}
+
+var (
+	explorerLayout = template.Must(template.New("layout").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - bucketbench</title>
+<script src="{{.PlotlyJS}}"></script>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 1em 2em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 3px 8px; }
+td.num { text-align: right; }
+tr.regression { background: #fdd; }
+form.filter { background: #f4f4f4; padding: 0.5em; }
+</style>
+</head>
+<body>
+<h2><a href="/?{{.Query}}">bucketbench</a>: {{.Title}}</h2>
+<form class="filter" method="get" action="{{.Action}}">
+{{range $name, $value := .Hidden}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}Benchmark <select name="benchmark"><option value="">all</option>{{range .Benches}}<option{{if eq . $.Filter.Benchmark}} selected{{end}}>{{.}}</option>{{end}}</select>
+Host <select name="host"><option value="">all</option>{{range .Hosts}}<option{{if eq . $.Filter.Host}} selected{{end}}>{{.}}</option>{{end}}</select>
+Driver <input name="driver" list="drivers" value="{{.Filter.Driver}}" placeholder="e.g. Docker[version">
+<datalist id="drivers">{{range .Drivers}}<option value="{{.}}">{{end}}</datalist>
+Tag <input name="tag" list="tags" value="{{.Filter.Tag}}" placeholder="e.g. version:26.0">
+<datalist id="tags">{{range .Tags}}<option value="{{.}}">{{end}}</datalist>
+<button type="submit">Filter</button>
+</form>
+{{template "content" .}}
+{{range .Charts}}<div id="{{.ID}}"></div>
+<script>Plotly.newPlot({{.ID}}, {{.Data}}, {{.Layout}});</script>
+{{end}}</body>
+</html>
+`))
+
+	explorerRunsPage = explorerPage(`{{define "content"}}
+{{if not .Entries}}<p>No stored runs match.</p>{{else}}
+<form method="get" action="/diff">
+{{with .Filter}}<input type="hidden" name="benchmark" value="{{.Benchmark}}"><input type="hidden" name="host" value="{{.Host}}"><input type="hidden" name="driver" value="{{.Driver}}"><input type="hidden" name="tag" value="{{.Tag}}">{{end}}
+<table>
+<tr><th>Old</th><th>New</th><th>ID</th><th>Time</th><th>Benchmark</th><th>Run ID</th><th>Host</th><th>Result</th>{{range .Threads}}<th>{{.}} thrds</th>{{end}}</tr>
+{{range $entry := .Entries}}{{range $i, $result := .Results}}<tr>
+{{if eq $i 0}}<td rowspan="{{len $entry.Results}}"><input type="radio" name="old" value="{{$entry.ID}}"></td>
+<td rowspan="{{len $entry.Results}}"><input type="radio" name="new" value="{{$entry.ID}}"></td>
+<td rowspan="{{len $entry.Results}}"><a href="/run?id={{$entry.ID}}&{{$.Query}}">{{$entry.ID}}</a></td>
+<td rowspan="{{len $entry.Results}}">{{$entry.Time.Format "2006-01-02 15:04"}}</td>
+<td rowspan="{{len $entry.Results}}">{{$entry.Benchmark}}</td>
+<td rowspan="{{len $entry.Results}}">{{or $entry.RunID "-"}}</td>
+<td rowspan="{{len $entry.Results}}">{{$entry.Hostname}}</td>{{end}}
+<td>{{$result.Name}}</td>{{range $result.Rates}}<td class="num">{{printf "%.2f" .}}</td>{{end}}</tr>
+{{end}}{{end}}</table>
+<button type="submit">Diff the selected runs</button>
+</form>{{end}}
+{{end}}`)
+
+	explorerRunPage = explorerPage(`{{define "content"}}
+<p>{{.Entry.Time.Format "2006-01-02 15:04:05"}}{{if .Entry.RunID}}, run ID {{.Entry.RunID}}{{end}}, kernel {{.Entry.Kernel}}</p>
+{{if not .Rows}}<p>No command statistics of the results match.</p>{{else}}
+<table>
+<tr><th>Result</th><th>Threads</th><th>Rate</th><th>Command</th><th>Min</th><th>P50</th><th>P90</th><th>P95</th><th>P99</th><th>Max</th><th>Errors</th></tr>
+{{range .Rows}}<tr><td>{{.Name}}</td><td class="num">{{.Threads}}</td><td class="num">{{printf "%.2f" .Rate}}</td><td>{{.Command}}</td>
+{{with .Summary}}<td class="num">{{printf "%.2f" .Min}}</td><td class="num">{{printf "%.2f" .Median}}</td><td class="num">{{printf "%.2f" .P90}}</td><td class="num">{{printf "%.2f" .P95}}</td><td class="num">{{printf "%.2f" .P99}}</td><td class="num">{{printf "%.2f" .Max}}</td><td class="num">{{.Errors}}</td>{{end}}</tr>
+{{end}}</table>{{end}}
+{{end}}`)
+
+	explorerDiffPage = explorerPage(`{{define "content"}}
+<p>Old: <a href="/run?id={{.Old.ID}}&{{.Query}}">run {{.Old.ID}}</a> ({{.Old.Benchmark}} on {{.Old.Hostname}}, {{.Old.Time.Format "2006-01-02 15:04"}});
+new: <a href="/run?id={{.New.ID}}&{{.Query}}">run {{.New.ID}}</a> ({{.New.Benchmark}} on {{.New.Hostname}}, {{.New.Time.Format "2006-01-02 15:04"}}).
+{{.Regressions}} regressions beyond {{.Threshold}}%.</p>
+{{if not .Deltas}}<p>The runs have no results in common; results are matched by name and thread count.</p>{{else}}
+<table>
+<tr><th>Result</th><th>Threads</th><th>Metric</th><th>Old</th><th>New</th><th>Delta</th></tr>
+{{range .Deltas}}<tr{{if .Regression}} class="regression"{{end}}><td>{{.Name}}</td><td class="num">{{.Threads}}</td><td>{{.Metric}}</td><td class="num">{{printf "%.2f" .Old}}</td><td class="num">{{printf "%.2f" .New}}</td><td class="num">{{printf "%+.1f%%" .Percent}}</td></tr>
+{{end}}</table>{{end}}
+{{end}}`)
+)
@@ -0,0 +1,88 @@
+package output
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResultTags(t *testing.T) {
+	name := "basic:Docker(balena)[runtime:runsc][version:26.0]"
+	if got, want := ResultDriver(name), "Docker(balena)"; got != want {
+		t.Errorf("ResultDriver = %q, want %q", got, want)
+	}
+	if got, want := ResultTags(name), []string{"runtime:runsc", "version:26.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ResultTags = %v, want %v", got, want)
+	}
+	for tag, want := range map[string]bool{"version:26.0": true, "version": true, "version:25.0": false, "vers": false} {
+		if got := (HistoryFilter{Tag: tag}).MatchResult(name); got != want {
+			t.Errorf("tag %q matched %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestExplorer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	history, err := OpenHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := func(version string, rate, median float64) Report {
+		return Report{
+			SchemaVersion: SchemaVersion,
+			Benchmark:     "basic",
+			Commands:      []string{"run"},
+			Environment:   Environment{Hostname: "bench01"},
+			Results: []Result{{
+				Name: "basic:Docker[version:" + version + "]",
+				Runs: []Run{{
+					Threads:  1,
+					Rate:     rate,
+					Commands: map[string]CommandSummary{"run": {Median: median, P95: median, P99: median}},
+				}},
+			}},
+		}
+	}
+	for _, r := range []Report{report("25.0", 10, 100), report("26.0", 5, 200), report("25.0", 5, 200)} {
+		if _, err := history.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history.Close()
+
+	server := httptest.NewServer(NewExplorer(path, 10))
+	defer server.Close()
+	get := func(path string, status int) string {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != status {
+			t.Errorf("GET %s: status %d, want %d: %s", path, resp.StatusCode, status, body)
+		}
+		return string(body)
+	}
+
+	runs := get("/?tag=version:26.0", http.StatusOK)
+	if strings.Contains(runs, "basic:Docker[version:25.0]</td>") || !strings.Contains(runs, "basic:Docker[version:26.0]</td>") {
+		t.Errorf("the runs filtered by tag version:26.0 list the wrong results:\n%s", runs)
+	}
+	if run := get("/run?id=1", http.StatusOK); !strings.Contains(run, "run latency percentiles") {
+		t.Errorf("the run has no percentile chart:\n%s", run)
+	}
+	// the results of the two versions have different names
+	if diff := get("/diff?old=1&new=2", http.StatusOK); !strings.Contains(diff, "no results in common") {
+		t.Errorf("the diff of runs without common results:\n%s", diff)
+	}
+	if diff := get("/diff?old=1&new=3", http.StatusOK); strings.Count(diff, `class="regression"`) != 3 {
+		t.Errorf("the diff does not mark the regressions of the rate, median and p95:\n%s", diff)
+	}
+	get("/run?id=4", http.StatusNotFound)
+	get("/diff?old=1&new=1&threshold=x", http.StatusBadRequest)
+}
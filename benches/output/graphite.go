@@ -0,0 +1,88 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/benches"
+)
+
+// defaultGraphitePort is the port of Graphite's plaintext protocol
+const defaultGraphitePort = "2003"
+
+// graphiteSink writes the rate and command summaries of every run, and the
+// timing of every step of its iterations, as tagged series to a Graphite
+// server using the plaintext protocol
+type graphiteSink struct {
+	address string
+}
+
+func newGraphiteSink(config benches.OutputConfig, precision int) (Sink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("The graphite output requires a url (host:port of the plaintext protocol)")
+	}
+	address := strings.TrimPrefix(config.URL, "tcp://")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, defaultGraphitePort)
+	}
+	return &graphiteSink{address: address}, nil
+}
+
+func (s *graphiteSink) Name() string {
+	return "graphite " + s.address
+}
+
+// Write sends a bucketbench.run.rate series per driver and thread count and a
+// bucketbench.command.<statistic> series per command of each run, timestamped
+// now, and a bucketbench.step.ms series per step of every iteration,
+// timestamped at the start of its iteration. Graphite keeps one value per
+// series and retention interval, so steps of the same thread and command
+// starting in the same interval are stored as the last of them.
+func (s *graphiteSink) Write(report Report) error {
+	var buf bytes.Buffer
+	now := time.Now().Unix()
+	for _, result := range report.Results {
+		for _, run := range result.Runs {
+			tags := fmt.Sprintf(";benchmark=%s;bench=%s;threads=%d;run_id=%s", graphiteEscape(report.Benchmark), graphiteEscape(result.Name), run.Threads, graphiteEscape(report.RunID))
+			fmt.Fprintf(&buf, "bucketbench.run.rate%s %g %d\n", tags, run.Rate, now)
+			for _, cmd := range commandOrder(report.Commands, run.Commands) {
+				c := run.Commands[cmd]
+				cmdTags := tags + ";command=" + graphiteEscape(cmd)
+				for _, stat := range []struct {
+					name  string
+					value float64
+				}{
+					{"min", c.Min}, {"max", c.Max}, {"avg", c.Avg}, {"median", c.Median},
+					{"p90", c.P90}, {"p95", c.P95}, {"p99", c.P99}, {"stddev", c.Stddev},
+					{"errors", float64(c.Errors)},
+				} {
+					fmt.Fprintf(&buf, "bucketbench.command.%s%s %g %d\n", stat.name, cmdTags, stat.value, now)
+				}
+			}
+			for _, step := range stepTimings(report.Commands, run) {
+				fmt.Fprintf(&buf, "bucketbench.step.ms%s;command=%s;thread=%d %g %d\n",
+					tags, graphiteEscape(step.command), step.thread, step.ms, step.time/1000)
+			}
+		}
+	}
+	conn, err := net.DialTimeout("tcp", s.address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	_, err = conn.Write(buf.Bytes())
+	return err
+}
+
+// graphiteEscape makes a tag value safe for the plaintext protocol, which
+// separates fields by spaces and tags by semicolons
+func graphiteEscape(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strings.NewReplacer(" ", "_", ";", "_", "~", "_").Replace(value)
+}
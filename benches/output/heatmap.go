@@ -0,0 +1,228 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Heatmap grid size: columns are time buckets across the run and rows are
+// log-scaled latency buckets
+const (
+	heatmapColumns = 60
+	heatmapRows    = 20
+)
+
+// heatmap is the latency-over-time histogram of one command of a driver's run
+// at one thread count
+type heatmap struct {
+	title string
+	// counts holds the samples per [latency row][time column]; row 0 is the
+	// lowest latency
+	counts   [heatmapRows][heatmapColumns]int
+	maxCount int
+	// seconds is the run time covered by the columns, and min and max the
+	// latency range in milliseconds covered by the rows
+	seconds  float64
+	min, max float64
+}
+
+// noHeatmapSamples is shown in place of the heatmaps of a report without
+// per-iteration statistics, e.g. a run interrupted before any iteration
+const noHeatmapSamples = "No per-iteration statistics to draw heatmaps from"
+
+// sample is a step duration placed at the start of its iteration
+type sample struct {
+	offset float64 // seconds from the start of the run
+	ms     float64
+}
+
+// buildHeatmaps bins the per-iteration samples of the report into a heatmap
+// per driver, thread count and command; failed steps are left out, as their
+// durations are not latencies of completed operations
+func buildHeatmaps(report Report) []*heatmap {
+	var maps []*heatmap
+	for _, result := range report.Results {
+		for _, run := range result.Runs {
+			for _, step := range report.Commands {
+				var samples []sample
+				for _, stat := range run.Statistics {
+					ms, ok := stat.Durations[step]
+					if !ok || stat.Errors[step] > 0 {
+						continue
+					}
+					s := sample{offset: float64(stat.Start) / 1000, ms: float64(ms)}
+					if nanos, ok := stat.Nanos[step]; ok {
+						s.ms = float64(nanos) / 1e6
+					}
+					samples = append(samples, s)
+				}
+				if len(samples) == 0 {
+					continue
+				}
+				maps = append(maps, newHeatmap(fmt.Sprintf("%s:%d %s", result.Name, run.Threads, step), samples))
+			}
+		}
+	}
+	return maps
+}
+
+func newHeatmap(title string, samples []sample) *heatmap {
+	h := &heatmap{title: title, min: math.MaxFloat64}
+	for _, s := range samples {
+		h.seconds = math.Max(h.seconds, s.offset)
+		h.min = math.Min(h.min, s.ms)
+		h.max = math.Max(h.max, s.ms)
+	}
+	// iterations starting at the very end of the run fall in the last column
+	h.seconds = math.Max(h.seconds, 0.001) * (1 + 1e-9)
+	for _, s := range samples {
+		col := int(s.offset / h.seconds * heatmapColumns)
+		row := h.row(s.ms)
+		h.counts[row][col]++
+		if h.counts[row][col] > h.maxCount {
+			h.maxCount = h.counts[row][col]
+		}
+	}
+	return h
+}
+
+// row returns the latency row of a duration; rows are spaced on a log scale
+// so both the typical latency and rare stalls are resolved
+func (h *heatmap) row(ms float64) int {
+	low, high := math.Log1p(h.min), math.Log1p(h.max)
+	if high == low {
+		return 0
+	}
+	row := int((math.Log1p(ms) - low) / (high - low) * heatmapRows)
+	if row >= heatmapRows {
+		row = heatmapRows - 1
+	}
+	return row
+}
+
+// rowLabel returns the lower latency bound in milliseconds of a row
+func (h *heatmap) rowLabel(row int) float64 {
+	low, high := math.Log1p(h.min), math.Log1p(h.max)
+	return math.Expm1(low + (high-low)*float64(row)/heatmapRows)
+}
+
+// SVG layout of each heatmap panel
+const (
+	svgCell   = 10
+	svgLeft   = 70
+	svgTop    = 30
+	svgBottom = 30
+	svgPanel  = svgTop + heatmapRows*svgCell + svgBottom
+	svgWidth  = svgLeft + heatmapColumns*svgCell + 20
+)
+
+// WriteHeatmapSVG renders a latency-over-time heatmap of every driver, thread
+// count and command of the report as a standalone SVG image. Each column is
+// a slice of the run (iterations are placed at their start) and each row a
+// latency range, so warmup effects and periodic stalls stand out.
+func WriteHeatmapSVG(w io.Writer, report Report) error {
+	maps := buildHeatmaps(report)
+	height := svgTop * 2
+	if len(maps) > 0 {
+		height = len(maps) * svgPanel
+	}
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n",
+		svgWidth, height)
+	fmt.Fprintf(w, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	if len(maps) == 0 {
+		fmt.Fprintf(w, `<text x="%d" y="%d">%s</text>`+"\n", svgLeft, svgTop, noHeatmapSamples)
+	}
+	for i, h := range maps {
+		top := i*svgPanel + svgTop
+		bottom := top + heatmapRows*svgCell
+		fmt.Fprintf(w, `<text x="%d" y="%d" font-size="13">%s</text>`+"\n", svgLeft, top-10, html.EscapeString(h.title))
+		for row := 0; row < heatmapRows; row++ {
+			for col := 0; col < heatmapColumns; col++ {
+				count := h.counts[row][col]
+				if count == 0 {
+					continue
+				}
+				fmt.Fprintf(w, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>%d</title></rect>`+"\n",
+					svgLeft+col*svgCell, bottom-(row+1)*svgCell, svgCell, svgCell, heatColor(count, h.maxCount), count)
+			}
+		}
+		fmt.Fprintf(w, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="#999"/>`+"\n",
+			svgLeft, top, heatmapColumns*svgCell, heatmapRows*svgCell)
+		fmt.Fprintf(w, `<text x="%d" y="%d" text-anchor="end">%s ms</text>`+"\n", svgLeft-5, bottom, formatMs(h.min))
+		fmt.Fprintf(w, `<text x="%d" y="%d" text-anchor="end">%s ms</text>`+"\n", svgLeft-5, top+10, formatMs(h.max))
+		fmt.Fprintf(w, `<text x="%d" y="%d">0s</text>`+"\n", svgLeft, bottom+15)
+		fmt.Fprintf(w, `<text x="%d" y="%d" text-anchor="end">%.1fs</text>`+"\n", svgLeft+heatmapColumns*svgCell, bottom+15, h.seconds)
+	}
+	_, err := fmt.Fprintln(w, "</svg>")
+	return err
+}
+
+// heatColor shades a cell from light yellow to dark red by its share of the
+// busiest cell of the heatmap
+func heatColor(count, max int) string {
+	f := float64(count) / float64(max)
+	r := 255 - int(f*127)
+	g := 237 - int(f*237)
+	b := 160 - int(f*122)
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+func formatMs(ms float64) string {
+	return strconv.FormatFloat(ms, 'g', 4, 64)
+}
+
+// plotlyJS is the plotly.js bundle loaded by the HTML heatmaps and the
+// explorer
+const plotlyJS = "https://cdn.plot.ly/plotly-2.27.0.min.js"
+
+// WriteHeatmapHTML renders the heatmaps of WriteHeatmapSVG as an interactive
+// plotly page; plotly.js is loaded from its CDN when the page is viewed
+func WriteHeatmapHTML(w io.Writer, report Report) error {
+	maps := buildHeatmaps(report)
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s latency heatmaps</title>\n", html.EscapeString(report.Benchmark))
+	fmt.Fprintf(w, "<script src=\"%s\"></script>\n</head>\n<body>\n", plotlyJS)
+	if len(maps) == 0 {
+		fmt.Fprintf(w, "<p>%s</p>\n", noHeatmapSamples)
+	}
+	for i, h := range maps {
+		x := make([]float64, heatmapColumns)
+		for col := range x {
+			x[col] = math.Round(h.seconds*(float64(col)+0.5)/heatmapColumns*1000) / 1000
+		}
+		y := make([]string, heatmapRows)
+		z := make([][]int, heatmapRows)
+		for row := range y {
+			y[row] = formatMs(h.rowLabel(row)) + "-" + formatMs(h.rowLabel(row+1)) + " ms"
+			z[row] = h.counts[row][:]
+		}
+		trace := map[string]interface{}{
+			"type":          "heatmap",
+			"x":             x,
+			"y":             y,
+			"z":             z,
+			"colorscale":    "YlOrRd",
+			"reversescale":  true,
+			"hovertemplate": "%{x:.1f}s, %{y}: %{z}<extra></extra>",
+		}
+		layout := map[string]interface{}{
+			"title": h.title,
+			"xaxis": map[string]string{"title": "seconds into run"},
+			"yaxis": map[string]string{"title": "latency"},
+		}
+		data, err := json.Marshal([]interface{}{trace})
+		if err != nil {
+			return err
+		}
+		layoutData, err := json.Marshal(layout)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "<div id=\"heatmap%d\"></div>\n<script>Plotly.newPlot(\"heatmap%d\", %s, %s);</script>\n", i, i, data, layoutData)
+	}
+	_, err := fmt.Fprintln(w, "</body>\n</html>")
+	return err
+}
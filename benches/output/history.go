@@ -0,0 +1,316 @@
+package output
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/estesp/bucketbench/benches"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// historyIndex holds the HistoryEntry of each stored report, so listing
+	// the history does not decode every report
+	historyIndex = []byte("index")
+	// historyReports holds the JSON reports
+	historyReports = []byte("reports")
+)
+
+// HistoryEntry describes a report stored in the history
+type HistoryEntry struct {
+	// ID is assigned in the order the reports were stored
+	ID        uint64    `json:"id"`
+	Time      time.Time `json:"time"`
+	Benchmark string    `json:"benchmark"`
+	RunID     string    `json:"runID,omitempty"`
+	Hostname  string    `json:"hostname"`
+	Kernel    string    `json:"kernel"`
+	// Results holds the rates at each thread count of every result
+	Results []HistoryResult `json:"results"`
+}
+
+// HistoryResult holds the rates of one result of a stored report
+type HistoryResult struct {
+	Name  string    `json:"name"`
+	Rates []float64 `json:"rates"`
+}
+
+// ResultDriver returns the driver of a result name, without the benchmark
+// name and labels: Docker(balena) for "basic:Docker(balena)[version:26.0]"
+func ResultDriver(name string) string {
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+	return name[strings.LastIndex(name, ":")+1:]
+}
+
+// ResultTags returns the labels of a result name, such as the engine version
+// of a version matrix or the runtime: [runtime:runsc version:26.0] for
+// "basic:Docker[runtime:runsc][version:26.0]"
+func ResultTags(name string) []string {
+	var tags []string
+	for {
+		start := strings.Index(name, "[")
+		if start < 0 {
+			return tags
+		}
+		end := strings.Index(name[start:], "]")
+		if end < 0 {
+			return tags
+		}
+		tags = append(tags, name[start+1:start+end])
+		name = name[start+end+1:]
+	}
+}
+
+// HistoryFilter selects stored runs and their results
+type HistoryFilter struct {
+	Benchmark string
+	Host      string
+	// Driver matches results whose name contains it, ignoring case
+	Driver string
+	// Tag matches results with the label (see ResultTags), or a label with
+	// the key, e.g. version:26.0 or version
+	Tag string
+}
+
+// MatchResult reports whether a result name passes the driver and tag
+// filters
+func (f HistoryFilter) MatchResult(name string) bool {
+	if f.Driver != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(f.Driver)) {
+		return false
+	}
+	if f.Tag == "" {
+		return true
+	}
+	for _, tag := range ResultTags(name) {
+		if tag == f.Tag || strings.HasPrefix(tag, f.Tag+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// Entries returns the entries of the benchmark and host which have results
+// passing the filters, with only those results
+func (f HistoryFilter) Entries(entries []HistoryEntry) []HistoryEntry {
+	var matched []HistoryEntry
+	for _, entry := range entries {
+		if (f.Benchmark != "" && entry.Benchmark != f.Benchmark) || (f.Host != "" && entry.Hostname != f.Host) {
+			continue
+		}
+		var results []HistoryResult
+		for _, result := range entry.Results {
+			if f.MatchResult(result.Name) {
+				results = append(results, result)
+			}
+		}
+		if len(results) == 0 {
+			continue
+		}
+		entry.Results = results
+		matched = append(matched, entry)
+	}
+	return matched
+}
+
+// History is a local database of benchmark reports, so the results of
+// successive runs on a machine accumulate and can be queried, e.g. for the
+// trend of an engine's rate across versions
+type History struct {
+	db *bolt.DB
+}
+
+// DefaultHistoryPath returns the history database used when none is given:
+// .bucketbench/history.db in the home directory
+func DefaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".bucketbench", "history.db")
+}
+
+// OpenHistory opens the history database at path, creating it if needed
+func OpenHistory(path string) (*History, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Error opening history %q: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{historyIndex, historyReports} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Error initializing history %q: %v", path, err)
+	}
+	return &History{db: db}, nil
+}
+
+// Close closes the history database
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// historyKey returns the key of an ID; big-endian keys iterate in ID order
+func historyKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// Add stores a report and returns its history entry
+func (h *History) Add(report Report) (HistoryEntry, error) {
+	entry := HistoryEntry{
+		Time:      time.Now(),
+		Benchmark: report.Benchmark,
+		RunID:     report.RunID,
+		Hostname:  report.Environment.Hostname,
+		Kernel:    report.Environment.Kernel,
+	}
+	for _, result := range report.Results {
+		r := HistoryResult{Name: result.Name}
+		for _, run := range result.Runs {
+			r.Rates = append(r.Rates, run.Rate)
+		}
+		entry.Results = append(entry.Results, r)
+	}
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, report); err != nil {
+		return entry, err
+	}
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		index := tx.Bucket(historyIndex)
+		id, err := index.NextSequence()
+		if err != nil {
+			return err
+		}
+		entry.ID = id
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := index.Put(historyKey(id), data); err != nil {
+			return err
+		}
+		return tx.Bucket(historyReports).Put(historyKey(id), buf.Bytes())
+	})
+	return entry, err
+}
+
+// Entries returns the entries of the stored reports, oldest first
+func (h *History) Entries() ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	err := h.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyIndex).ForEach(func(k, v []byte) error {
+			var entry HistoryEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("Error decoding history entry %d: %v", binary.BigEndian.Uint64(k), err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// Report returns a stored report by its history ID or, for a reference which
+// is not a number, the latest report of the run ID
+func (h *History) Report(ref string) (HistoryEntry, Report, error) {
+	entries, err := h.Entries()
+	if err != nil {
+		return HistoryEntry{}, Report{}, err
+	}
+	id, numeric := strconv.ParseUint(ref, 10, 64)
+	var found *HistoryEntry
+	for i := range entries {
+		if (numeric == nil && entries[i].ID == id) || (numeric != nil && entries[i].RunID == ref) {
+			found = &entries[i]
+		}
+	}
+	if found == nil {
+		return HistoryEntry{}, Report{}, fmt.Errorf("No stored run %q in the history", ref)
+	}
+	var report Report
+	err = h.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(historyReports).Get(historyKey(found.ID))
+		if data == nil {
+			return fmt.Errorf("The report of stored run %d is missing", found.ID)
+		}
+		report, err = ReadJSON(bytes.NewReader(data))
+		return err
+	})
+	return *found, report, err
+}
+
+// forEachReport calls fn with the stored reports, oldest first
+func (h *History) forEachReport(fn func(HistoryEntry, Report) error) error {
+	entries, err := h.Entries()
+	if err != nil {
+		return err
+	}
+	return h.db.View(func(tx *bolt.Tx) error {
+		reports := tx.Bucket(historyReports)
+		for _, entry := range entries {
+			data := reports.Get(historyKey(entry.ID))
+			if data == nil {
+				return fmt.Errorf("The report of stored run %d is missing", entry.ID)
+			}
+			report, err := ReadJSON(bytes.NewReader(data))
+			if err != nil {
+				return fmt.Errorf("Error decoding stored run %d: %v", entry.ID, err)
+			}
+			if err := fn(entry, report); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// historySink stores the report in a history database
+type historySink struct {
+	path string
+}
+
+func newHistorySink(config benches.OutputConfig, precision int) (Sink, error) {
+	path := config.Path
+	if path == "" {
+		path = DefaultHistoryPath()
+	}
+	return &historySink{path: path}, nil
+}
+
+func (s *historySink) Name() string {
+	return "history " + s.path
+}
+
+func (s *historySink) Write(report Report) error {
+	history, err := OpenHistory(s.path)
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+	entry, err := history.Add(report)
+	if err != nil {
+		return err
+	}
+	log.Infof("Results stored in the history %s as run %d", s.path, entry.ID)
+	return nil
+}
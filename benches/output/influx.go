@@ -0,0 +1,110 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/benches"
+)
+
+// influxSink writes the rate and command summaries of every run, and the
+// timing of every step of its iterations, as points to an InfluxDB server
+// using the line protocol
+type influxSink struct {
+	url      string
+	database string
+	headers  map[string]string
+}
+
+func newInfluxSink(config benches.OutputConfig, precision int) (Sink, error) {
+	if config.URL == "" || config.Database == "" {
+		return nil, fmt.Errorf("The influx output requires a url and a database")
+	}
+	return &influxSink{
+		url:      strings.TrimRight(config.URL, "/"),
+		database: config.Database,
+		headers:  config.Headers,
+	}, nil
+}
+
+func (s *influxSink) Name() string {
+	return "influx " + s.url
+}
+
+// Write sends one bucketbench_run point per driver and thread count and one
+// bucketbench_command point per command of each run, timestamped now, and one
+// bucketbench_step point per step of every iteration, timestamped at the
+// start of its iteration
+func (s *influxSink) Write(report Report) error {
+	var buf bytes.Buffer
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	runID := influxEscape(report.RunID)
+	for _, result := range report.Results {
+		for _, run := range result.Runs {
+			tags := fmt.Sprintf("benchmark=%s,bench=%s,threads=%d,run_id=%s", influxEscape(report.Benchmark), influxEscape(result.Name), run.Threads, runID)
+			fmt.Fprintf(&buf, "bucketbench_run,%s rate=%g %d\n", tags, run.Rate, now)
+			for _, cmd := range commandOrder(report.Commands, run.Commands) {
+				c := run.Commands[cmd]
+				fmt.Fprintf(&buf, "bucketbench_command,%s,command=%s min=%g,max=%g,avg=%g,median=%g,p90=%g,p95=%g,p99=%g,stddev=%g,errors=%di %d\n",
+					tags, influxEscape(cmd), c.Min, c.Max, c.Avg, c.Median, c.P90, c.P95, c.P99, c.Stddev, c.Errors, now)
+			}
+			for _, step := range stepTimings(report.Commands, run) {
+				fmt.Fprintf(&buf, "bucketbench_step,%s,command=%s,thread=%d ms=%g,iteration=%di,errors=%di %d\n",
+					tags, influxEscape(step.command), step.thread, step.ms, step.iteration, step.errors, step.time)
+			}
+		}
+	}
+	target := s.url + "/write?precision=ms&db=" + url.QueryEscape(s.database)
+	return httpSend("POST", target, "text/plain; charset=utf-8", s.headers, buf.Bytes())
+}
+
+// stepTiming is the timing of one step of an iteration, for the time-series
+// sinks
+type stepTiming struct {
+	command   string
+	thread    int
+	iteration int
+	ms        float64
+	errors    int
+	// time is the Unix time in milliseconds the iteration started at
+	time int64
+}
+
+// stepTimings returns the timing of every step of the iterations of a run,
+// in the order of the run's statistics and of the commands; steps of the
+// same iteration share its start time, as only iterations are timestamped
+func stepTimings(commands []string, run Run) []stepTiming {
+	var steps []stepTiming
+	for _, stat := range run.Statistics {
+		for _, cmd := range commands {
+			ms, ok := stat.Durations[cmd]
+			if !ok {
+				continue
+			}
+			step := stepTiming{
+				command:   cmd,
+				thread:    stat.Thread,
+				iteration: stat.Iteration,
+				ms:        float64(ms),
+				errors:    stat.Errors[cmd],
+				time:      run.Started + int64(stat.Start),
+			}
+			if nanos, ok := stat.Nanos[cmd]; ok {
+				step.ms = float64(nanos) / 1e6
+			}
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// influxEscape escapes a tag value for the line protocol
+func influxEscape(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`).Replace(value)
+}
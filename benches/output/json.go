@@ -0,0 +1,134 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/estesp/bucketbench/benches"
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+)
+
+// SchemaVersion identifies the JSON report layout; it is incremented whenever
+// a field is removed or changes meaning, but not when fields are added
+const SchemaVersion = 1
+
+// Report is the JSON form of the results of a benchmark run
+type Report struct {
+	SchemaVersion int                         `json:"schemaVersion"`
+	Benchmark     string                      `json:"benchmark"`
+	RunID         string                      `json:"runID,omitempty"`
+	Commands      []string                    `json:"commands"`
+	Environment   Environment                 `json:"environment"`
+	Calibration   *benches.CalibrationProfile `json:"calibration,omitempty"`
+	Priority      *benches.PriorityConfig     `json:"priority,omitempty"`
+	CPUAffinity   *benches.AffinityConfig     `json:"cpuAffinity,omitempty"`
+	TraceDir      string                      `json:"traceDir,omitempty"`
+	Results       []Result                    `json:"results"`
+	Scorecard     []Scorecard                 `json:"scorecard,omitempty"`
+	Trends        []VersionTrend              `json:"trends,omitempty"`
+	// Anomalies holds the p99 shifts from the earlier runs in the history
+	// the results are stored in
+	Anomalies []Anomaly `json:"anomalies,omitempty"`
+}
+
+// Environment describes the host the benchmark ran on
+type Environment struct {
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Kernel   string `json:"kernel"`
+	CPUs     int    `json:"cpus"`
+	Clock    string `json:"clock"`
+	// Tunables holds the limits and kernel tunables of the host
+	Tunables map[string]uint64 `json:"tunables,omitempty"`
+	// Harness is set when bucketbench itself ran in a container
+	Harness *Harness `json:"harness,omitempty"`
+}
+
+// Harness describes the container bucketbench ran in
+type Harness struct {
+	Engine  string `json:"engine"`
+	HostPID bool   `json:"hostPID"`
+	// Sockets lists the engine sockets mounted into the container
+	Sockets []string `json:"sockets,omitempty"`
+}
+
+// Result holds the runs of one driver configuration (or the limit benchmark)
+// at each thread count
+type Result struct {
+	Name       string `json:"name"`
+	Iterations int    `json:"iterations"`
+	Threads    int    `json:"threads"`
+	// ImageDigest is the digest the image was pinned to with pinImageDigest
+	ImageDigest string `json:"imageDigest,omitempty"`
+	Runs        []Run  `json:"runs"`
+}
+
+// Run holds the results of a driver configuration at a single thread count
+type Run struct {
+	Threads int `json:"threads"`
+	// Started is the Unix time in milliseconds the run started at; the Start
+	// of each of its Statistics is relative to it
+	Started int64 `json:"started,omitempty"`
+	// Rate is iterations per second across all threads
+	Rate       float64                   `json:"rate"`
+	Commands   map[string]CommandSummary `json:"commands,omitempty"`
+	Metrics    map[string]float64        `json:"metrics,omitempty"`
+	Statistics []benches.RunStatistics   `json:"statistics,omitempty"`
+	// Concurrency holds the latency of each command by the number of
+	// operations in flight; for a sampled run, of the sampled iterations
+	Concurrency map[string][]ConcurrencyBucket `json:"concurrency,omitempty"`
+	// BlockedStacks are the daemon stacks most often found blocked on locks
+	// during the run, with stack sampling enabled
+	BlockedStacks []benches.BlockedStack `json:"blockedStacks,omitempty"`
+	// Collectors holds the health of each enabled collector during the run:
+	// "ok", or "unavailable: <reason>" when its metrics are missing
+	Collectors map[string]string `json:"collectors,omitempty"`
+	// SampledFrom is the number of iterations of a run with maxSamples set;
+	// Statistics then holds a uniform sample of them
+	SampledFrom int `json:"sampledFrom,omitempty"`
+}
+
+// NewEnvironment describes the local host
+func NewEnvironment() Environment {
+	hostname, _ := os.Hostname()
+	return Environment{
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Kernel:   utils.KernelVersion(),
+		CPUs:     runtime.NumCPU(),
+		Clock:    utils.GetClockInfo().String(),
+		Tunables: utils.ReadTunables(utils.SnapshotTunables),
+		Harness:  newHarness(),
+	}
+}
+
+// newHarness describes the container bucketbench runs in, or returns nil
+func newHarness() *Harness {
+	container := utils.DetectHarnessContainer()
+	if container == nil {
+		return nil
+	}
+	harness := &Harness{Engine: container.Engine, HostPID: container.HostPID}
+	seen := make(map[string]bool)
+	for _, dtype := range driver.BuiltinTypes() {
+		socket := driver.DaemonSocket(dtype)
+		if socket != "" && !seen[socket] && utils.IsSocket(socket) {
+			harness.Sockets = append(harness.Sockets, socket)
+		}
+		seen[socket] = true
+	}
+	return harness
+}
+
+// WriteJSON writes the report as indented JSON
+func WriteJSON(w io.Writer, report Report) error {
+	report.SchemaVersion = SchemaVersion
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
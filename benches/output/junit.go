@@ -0,0 +1,120 @@
+package output
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// junitSuites is the root element of a JUnit XML report
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       string          `xml:"time,attr"`
+	Hostname   string          `xml:"hostname,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+}
+
+// WriteJUnit writes the report as JUnit XML, so CI systems can display the
+// results alongside test results: one test suite per result, and one test
+// case per command and thread count, timed by its average and failed if any
+// of its operations failed. The rate of each run and the timing statistics
+// of each command are included as properties and output.
+func WriteJUnit(w io.Writer, report Report) error {
+	suites := junitSuites{Name: report.Benchmark}
+	for _, result := range report.Results {
+		suite := junitSuite{Name: result.Name, Hostname: report.Environment.Hostname}
+		if result.ImageDigest != "" {
+			suite.Properties = append(suite.Properties, junitProperty{Name: "imageDigest", Value: result.ImageDigest})
+		}
+		var total float64
+		for _, run := range result.Runs {
+			suite.Properties = append(suite.Properties, junitProperty{
+				Name:  fmt.Sprintf("rate.%dthreads", run.Threads),
+				Value: fmt.Sprintf("%.2f", run.Rate),
+			})
+			summaries := run.Commands
+			if len(summaries) == 0 {
+				summaries = Summarize(run.Statistics)
+			}
+			for _, cmd := range commandOrder(report.Commands, summaries) {
+				summary := summaries[cmd]
+				tc := junitCase{
+					Name:      fmt.Sprintf("%s [threads=%d]", cmd, run.Threads),
+					ClassName: result.Name,
+					Time:      fmt.Sprintf("%.3f", summary.Avg/1000),
+					SystemOut: fmt.Sprintf("min=%.2fms max=%.2fms avg=%.2fms median=%.2fms p90=%.2fms p95=%.2fms p99=%.2fms stddev=%.2fms",
+						summary.Min, summary.Max, summary.Avg, summary.Median, summary.P90, summary.P95, summary.P99, summary.Stddev),
+				}
+				total += summary.Avg / 1000
+				if summary.Errors > 0 {
+					tc.Failure = &junitFailure{
+						Message: fmt.Sprintf("%d of the %s operations failed", summary.Errors, cmd),
+						Type:    junitErrorClasses(summary.ErrorClasses),
+					}
+					suite.Failures++
+				}
+				suite.Cases = append(suite.Cases, tc)
+			}
+		}
+		suite.Tests = len(suite.Cases)
+		suite.Time = fmt.Sprintf("%.3f", total)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitErrorClasses renders the error classes of a command as the failure
+// type, e.g. "timeout=2,nonzero exit=1"
+func junitErrorClasses(classes map[string]int) string {
+	if len(classes) == 0 {
+		return "error"
+	}
+	var parts []string
+	for class, n := range classes {
+		parts = append(parts, fmt.Sprintf("%s=%d", class, n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,99 @@
+package output
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/estesp/bucketbench/utils"
+	yaml "github.com/go-yaml/yaml"
+)
+
+// ManifestVersion identifies the manifest layout; like SchemaVersion it is
+// only incremented when a field is removed or changes meaning
+const ManifestVersion = 1
+
+// Manifest records everything needed to reproduce a run and to judge whether
+// its numbers are comparable with another run's: the host, the engine
+// versions, the exact benchmark config and the bucketbench revision
+type Manifest struct {
+	ManifestVersion int    `json:"manifestVersion" yaml:"manifestVersion"`
+	Benchmark       string `json:"benchmark" yaml:"benchmark"`
+	RunID           string `json:"runID,omitempty" yaml:"runID,omitempty"`
+	// Started and Finished are RFC 3339 timestamps
+	Started  string `json:"started" yaml:"started"`
+	Finished string `json:"finished" yaml:"finished"`
+	// Args is the bucketbench command line
+	Args        []string        `json:"args" yaml:"args"`
+	Bucketbench BuildInfo       `json:"bucketbench" yaml:"bucketbench"`
+	Host        ManifestHost    `json:"host" yaml:"host"`
+	Engines     []EngineVersion `json:"engines" yaml:"engines"`
+	// Config is the benchmark YAML as read, including comments
+	Config string `json:"config" yaml:"config"`
+}
+
+// BuildInfo identifies the bucketbench binary
+type BuildInfo struct {
+	// Revision is the git revision bucketbench was built from, or "unknown"
+	Revision  string `json:"revision" yaml:"revision"`
+	GoVersion string `json:"goVersion" yaml:"goVersion"`
+}
+
+// ManifestHost describes the host the run was on
+type ManifestHost struct {
+	Hostname      string `json:"hostname" yaml:"hostname"`
+	OS            string `json:"os" yaml:"os"`
+	Arch          string `json:"arch" yaml:"arch"`
+	Kernel        string `json:"kernel" yaml:"kernel"`
+	CgroupVersion string `json:"cgroupVersion" yaml:"cgroupVersion"`
+	CPUModel      string `json:"cpuModel" yaml:"cpuModel"`
+	CPUs          int    `json:"cpus" yaml:"cpus"`
+	Clock         string `json:"clock" yaml:"clock"`
+}
+
+// EngineVersion holds the Info of a driver's engine as reported at the end of
+// the run; Error is set instead if the engine could not be queried
+type EngineVersion struct {
+	Driver string `json:"driver" yaml:"driver"`
+	Binary string `json:"binary,omitempty" yaml:"binary,omitempty"`
+	Info   string `json:"info,omitempty" yaml:"info,omitempty"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// NewManifestHost describes the current host
+func NewManifestHost() ManifestHost {
+	hostname, _ := os.Hostname()
+	return ManifestHost{
+		Hostname:      hostname,
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		Kernel:        utils.KernelVersion(),
+		CgroupVersion: utils.CgroupVersion(),
+		CPUModel:      utils.CPUModel(),
+		CPUs:          runtime.NumCPU(),
+		Clock:         utils.GetClockInfo().String(),
+	}
+}
+
+// WriteManifest writes a manifest to a file, as YAML if the file name ends in
+// .yaml or .yml and as JSON otherwise
+func WriteManifest(path string, manifest Manifest) error {
+	var (
+		data []byte
+		err  error
+	)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(manifest)
+	default:
+		data, err = json.MarshalIndent(manifest, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
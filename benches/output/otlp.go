@@ -0,0 +1,213 @@
+package output
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/estesp/bucketbench/benches"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultOTLPURL is the base URL of a local OpenTelemetry collector's
+	// OTLP/HTTP receiver, e.g. a Jaeger all-in-one
+	defaultOTLPURL = "http://localhost:4318"
+	// otlpBatch is the number of spans sent per export request
+	otlpBatch = 512
+	// otlpService is the service.name resource attribute of the spans
+	otlpService = "bucketbench"
+)
+
+// OTLP span kind and status code values: iterations are internal spans and
+// their operations client spans of the engine
+const (
+	otlpKindInternal = 1
+	otlpKindClient   = 3
+	otlpStatusError  = 2
+)
+
+// otlpSink exports the spans of every iteration and operation as OTLP/HTTP
+// JSON traces, e.g. to Jaeger or an OpenTelemetry collector. Spans are sent
+// in batches while the benchmark runs; Write sends the remaining ones.
+type otlpSink struct {
+	url     string
+	headers map[string]string
+
+	mu    sync.Mutex
+	spans []benches.Span
+	err   error
+	sends sync.WaitGroup
+}
+
+func newOTLPSink(config benches.OutputConfig, precision int) (Sink, error) {
+	url := config.URL
+	if url == "" {
+		url = defaultOTLPURL
+	}
+	return &otlpSink{url: strings.TrimRight(url, "/") + "/v1/traces", headers: config.Headers}, nil
+}
+
+func (s *otlpSink) Name() string {
+	return "otlp " + s.url
+}
+
+// OpDone, IterationDone and RunDone are not exported; the spans carry the
+// operations
+func (s *otlpSink) OpDone(bench string, threads int, op string, ms int, failed bool) {}
+
+func (s *otlpSink) IterationDone(bench string, threads int) {}
+
+func (s *otlpSink) RunDone(bench string, threads int, rate float64, metrics map[string]float64) {}
+
+// Span buffers a span, sending a batch once enough are buffered
+func (s *otlpSink) Span(span benches.Span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans = append(s.spans, span)
+	if len(s.spans) >= otlpBatch {
+		s.sendLocked()
+	}
+}
+
+// sendLocked sends the buffered spans in the background; s.mu is held
+func (s *otlpSink) sendLocked() {
+	spans := s.spans
+	s.spans = nil
+	s.sends.Add(1)
+	go func() {
+		defer s.sends.Done()
+		if err := s.send(spans); err != nil {
+			log.Warnf("Error exporting %d spans to %s: %v", len(spans), s.url, err)
+			s.mu.Lock()
+			if s.err == nil {
+				s.err = err
+			}
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// Write sends the remaining spans and waits for every export, returning the
+// first failed one; the report itself is not exported
+func (s *otlpSink) Write(report Report) error {
+	s.mu.Lock()
+	if len(s.spans) > 0 {
+		s.sendLocked()
+	}
+	s.mu.Unlock()
+	s.sends.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// send posts spans as an OTLP/HTTP JSON export request
+func (s *otlpSink) send(spans []benches.Span) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	return httpSend("POST", s.url, "application/json", s.headers, body)
+}
+
+// OTLP JSON encoding of an export request; IDs are hex and times are
+// nanoseconds since the epoch, encoded as strings
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	// IntValue is a string, as int64 values are in OTLP JSON
+	IntValue *string `json:"intValue,omitempty"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int) otlpAttribute {
+	v := strconv.Itoa(value)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &v}}
+}
+
+// otlpRequest encodes spans as an export request of one resource and scope
+func otlpRequest(spans []benches.Span) otlpTraces {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: otlpService}}
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(span.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.SpanID[:]),
+			Name:              span.Name,
+			Kind:              otlpKindInternal,
+			StartTimeUnixNano: fmt.Sprint(span.Start.UnixNano()),
+			EndTimeUnixNano:   fmt.Sprint(span.End.UnixNano()),
+			Attributes: []otlpAttribute{
+				otlpString("bucketbench.benchmark", span.Bench),
+				otlpString("bucketbench.driver", span.Driver),
+				otlpInt("bucketbench.threads", span.Threads),
+				otlpInt("bucketbench.thread", span.Thread),
+				otlpInt("bucketbench.iteration", span.Iteration),
+			},
+		}
+		if span.ParentID != [8]byte{} {
+			s.ParentSpanID = hex.EncodeToString(span.ParentID[:])
+			s.Kind = otlpKindClient
+		}
+		if span.Container != "" {
+			s.Attributes = append(s.Attributes, otlpString("container.name", span.Container))
+		}
+		if span.Error != "" {
+			s.Status = &otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+		scope.Spans = append(scope.Spans, s)
+	}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{otlpString("service.name", otlpService)}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+}
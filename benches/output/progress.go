@@ -0,0 +1,171 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressRun follows a benchmark run between progress lines
+type progressRun struct {
+	bench      string
+	threads    int
+	started    time.Time
+	iterations int
+	errors     int
+	// window holds the latencies of the operations completed since the last
+	// progress line, for the rolling average
+	window []int
+	// current is the iteration and operation each thread is running
+	current map[int]threadOp
+}
+
+// threadOp is the operation a thread is running
+type threadOp struct {
+	iteration int
+	op        string
+}
+
+// Progress periodically writes a structured progress line per running
+// benchmark run, so a long benchmark shows how it is doing instead of
+// staying silent until the results: the completed iterations, errors, the
+// average latency since the previous line and the iteration and operation of
+// each thread. It implements benches.ThreadObserver.
+type Progress struct {
+	mu       sync.Mutex
+	out      io.Writer
+	interval time.Duration
+	runs     map[string]*progressRun
+	done     chan struct{}
+	stopped  sync.WaitGroup
+}
+
+// NewProgress creates a progress writer with the given interval between
+// progress lines; Start begins writing them
+func NewProgress(out io.Writer, interval time.Duration) *Progress {
+	return &Progress{
+		out:      out,
+		interval: interval,
+		runs:     make(map[string]*progressRun),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start writes the progress lines every interval until Stop is called
+func (p *Progress) Start() {
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.write()
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops writing progress lines
+func (p *Progress) Stop() {
+	close(p.done)
+	p.stopped.Wait()
+}
+
+func (p *Progress) run(bench string, threads int) *progressRun {
+	key := fmt.Sprintf("%s/%d", bench, threads)
+	r, ok := p.runs[key]
+	if !ok {
+		r = &progressRun{bench: bench, threads: threads, started: time.Now(), current: make(map[int]threadOp)}
+		p.runs[key] = r
+	}
+	return r
+}
+
+// OpStart records the operation a thread is running
+func (p *Progress) OpStart(bench string, threads, thread, iteration int, op string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.run(bench, threads).current[thread] = threadOp{iteration: iteration, op: op}
+}
+
+// OpDone adds a lifecycle operation to the rolling average, or counts its
+// error
+func (p *Progress) OpDone(bench string, threads int, op string, ms int, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := p.run(bench, threads)
+	if failed {
+		r.errors++
+		return
+	}
+	r.window = append(r.window, ms)
+}
+
+// IterationDone counts a completed iteration
+func (p *Progress) IterationDone(bench string, threads int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.run(bench, threads).iterations++
+}
+
+// RunDone writes the final progress line of a run with its rate
+func (p *Progress) RunDone(bench string, threads int, rate float64, metrics map[string]float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := fmt.Sprintf("%s/%d", bench, threads)
+	r, ok := p.runs[key]
+	if !ok {
+		r = &progressRun{bench: bench, threads: threads, started: time.Now()}
+	}
+	delete(p.runs, key)
+	fmt.Fprintf(p.out, "progress bench=%q threads=%d elapsed=%s iterations=%d errors=%d rate=%.2f done\n",
+		r.bench, r.threads, time.Since(r.started).Round(time.Second), r.iterations, r.errors, rate)
+}
+
+// write writes a progress line per running benchmark run and starts the next
+// rolling average window
+func (p *Progress) write() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var keys []string
+	for key := range p.runs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		r := p.runs[key]
+		line := fmt.Sprintf("progress bench=%q threads=%d elapsed=%s iterations=%d errors=%d",
+			r.bench, r.threads, time.Since(r.started).Round(time.Second), r.iterations, r.errors)
+		if len(r.window) > 0 {
+			total := 0
+			for _, ms := range r.window {
+				total += ms
+			}
+			line += fmt.Sprintf(" ops=%d avg_ms=%.1f", len(r.window), float64(total)/float64(len(r.window)))
+		} else {
+			line += " ops=0"
+		}
+		var threads []int
+		for thread := range r.current {
+			threads = append(threads, thread)
+		}
+		sort.Ints(threads)
+		var status []string
+		for _, thread := range threads {
+			current := r.current[thread]
+			status = append(status, fmt.Sprintf("t%d=%d:%s", thread, current.iteration+1, strings.Replace(current.op, " ", "_", -1)))
+		}
+		if len(status) > 0 {
+			line += " " + strings.Join(status, " ")
+		}
+		fmt.Fprintln(p.out, line)
+		r.window = nil
+	}
+}
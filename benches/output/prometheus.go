@@ -0,0 +1,235 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/estesp/bucketbench/benches"
+	log "github.com/sirupsen/logrus"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the operation latency histogram
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// histogram is a cumulative Prometheus histogram
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Prometheus exports benchmark progress and results in the Prometheus text
+// exposition format. It implements benches.Observer.
+type Prometheus struct {
+	mu         sync.Mutex
+	latency    map[string]*histogram
+	errors     map[string]uint64
+	iterations map[string]uint64
+	gauges     map[string]float64
+}
+
+// NewPrometheus creates an exporter with no recorded metrics
+func NewPrometheus() *Prometheus {
+	return &Prometheus{
+		latency:    make(map[string]*histogram),
+		errors:     make(map[string]uint64),
+		iterations: make(map[string]uint64),
+		gauges:     make(map[string]float64),
+	}
+}
+
+// labels renders a Prometheus label set from name/value pairs
+func labels(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], value))
+	}
+	return strings.Join(parts, ",")
+}
+
+// OpDone records the latency and any error of a lifecycle operation
+func (p *Prometheus) OpDone(bench string, threads int, op string, ms int, failed bool) {
+	key := labels("bench", bench, "threads", fmt.Sprint(threads), "op", op)
+	seconds := float64(ms) / 1000
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.latency[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		p.latency[key] = h
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+	if failed {
+		p.errors[key]++
+	} else if _, ok := p.errors[key]; !ok {
+		p.errors[key] = 0
+	}
+}
+
+// IterationDone counts a completed iteration
+func (p *Prometheus) IterationDone(bench string, threads int) {
+	key := labels("bench", bench, "threads", fmt.Sprint(threads))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.iterations[key]++
+}
+
+// RunDone records the rate and run-level metrics of a completed run
+func (p *Prometheus) RunDone(bench string, threads int, rate float64, metrics map[string]float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gauges["bucketbench_run_rate{"+labels("bench", bench, "threads", fmt.Sprint(threads))+"}"] = rate
+	for name, value := range metrics {
+		key := labels("bench", bench, "threads", fmt.Sprint(threads), "metric", name)
+		p.gauges["bucketbench_run_metric{"+key+"}"] = value
+	}
+}
+
+// Write renders all metrics in the Prometheus text exposition format
+func (p *Prometheus) Write(buf *bytes.Buffer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	buf.WriteString("# HELP bucketbench_operation_duration_seconds Latency of container lifecycle operations.\n")
+	buf.WriteString("# TYPE bucketbench_operation_duration_seconds histogram\n")
+	for _, key := range sortedKeys(p.latency) {
+		h := p.latency[key]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(buf, "bucketbench_operation_duration_seconds_bucket{%s,le=\"%g\"} %d\n", key, bound, h.counts[i])
+		}
+		fmt.Fprintf(buf, "bucketbench_operation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", key, h.count)
+		fmt.Fprintf(buf, "bucketbench_operation_duration_seconds_sum{%s} %g\n", key, h.sum)
+		fmt.Fprintf(buf, "bucketbench_operation_duration_seconds_count{%s} %d\n", key, h.count)
+	}
+	buf.WriteString("# HELP bucketbench_operation_errors_total Failed container lifecycle operations.\n")
+	buf.WriteString("# TYPE bucketbench_operation_errors_total counter\n")
+	for _, key := range sortedKeys(p.errors) {
+		fmt.Fprintf(buf, "bucketbench_operation_errors_total{%s} %d\n", key, p.errors[key])
+	}
+	buf.WriteString("# HELP bucketbench_iterations_total Completed benchmark iterations.\n")
+	buf.WriteString("# TYPE bucketbench_iterations_total counter\n")
+	for _, key := range sortedKeys(p.iterations) {
+		fmt.Fprintf(buf, "bucketbench_iterations_total{%s} %d\n", key, p.iterations[key])
+	}
+	buf.WriteString("# HELP bucketbench_run_rate Iterations per second of completed benchmark runs.\n")
+	buf.WriteString("# TYPE bucketbench_run_rate gauge\n")
+	var metricKeys []string
+	for _, key := range sortedKeys(p.gauges) {
+		if strings.HasPrefix(key, "bucketbench_run_rate{") {
+			fmt.Fprintf(buf, "%s %g\n", key, p.gauges[key])
+		} else {
+			metricKeys = append(metricKeys, key)
+		}
+	}
+	buf.WriteString("# HELP bucketbench_run_metric Run-level measurements of completed benchmark runs.\n")
+	buf.WriteString("# TYPE bucketbench_run_metric gauge\n")
+	for _, key := range metricKeys {
+		fmt.Fprintf(buf, "%s %g\n", key, p.gauges[key])
+	}
+}
+
+// ServeHTTP serves the metrics on the /metrics endpoint
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	p.Write(&buf)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// Serve starts the embedded /metrics endpoint in the background
+func (p *Prometheus) Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", p)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("Prometheus metrics endpoint on %s failed: %v", addr, err)
+		}
+	}()
+	log.Infof("Serving Prometheus metrics on %s/metrics", addr)
+}
+
+// Push sends the metrics to a Prometheus Pushgateway, replacing any metrics
+// previously pushed for the job
+func (p *Prometheus) Push(gateway, job string) error {
+	var buf bytes.Buffer
+	p.Write(&buf)
+	target := strings.TrimRight(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+	return httpSend("PUT", target, "text/plain; version=0.0.4", nil, buf.Bytes())
+}
+
+// prometheusSink exports progress during the run through the embedded
+// exporter and pushes the final metrics to the Pushgateway, if configured
+type prometheusSink struct {
+	*Prometheus
+	config benches.PrometheusConfig
+}
+
+func newPrometheusSink(config benches.OutputConfig, precision int) (Sink, error) {
+	if config.Listen == "" && config.Pushgateway == "" {
+		return nil, fmt.Errorf("The prometheus output requires a listen address or a pushgateway URL")
+	}
+	sink := &prometheusSink{
+		Prometheus: NewPrometheus(),
+		config:     config.PrometheusConfig,
+	}
+	if config.Listen != "" {
+		sink.Serve(config.Listen)
+	}
+	return sink, nil
+}
+
+func (s *prometheusSink) Name() string {
+	if s.config.Pushgateway != "" {
+		return "prometheus " + s.config.Pushgateway
+	}
+	return "prometheus " + s.config.Listen
+}
+
+// Write pushes the metrics recorded during the run; the report itself is
+// not needed as the exporter observed the run
+func (s *prometheusSink) Write(report Report) error {
+	if s.config.Pushgateway == "" {
+		return nil
+	}
+	job := s.config.Job
+	if job == "" {
+		job = "bucketbench"
+	}
+	return s.Push(s.config.Pushgateway, job)
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch typed := m.(type) {
+	case map[string]*histogram:
+		for k := range typed {
+			keys = append(keys, k)
+		}
+	case map[string]uint64:
+		for k := range typed {
+			keys = append(keys, k)
+		}
+	case map[string]float64:
+		for k := range typed {
+			keys = append(keys, k)
+		}
+	case map[string]bool:
+		for k := range typed {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,174 @@
+package output
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/benches"
+)
+
+const defaultS3Region = "us-east-1"
+
+// s3Sink uploads the JSON report to an S3 (or S3-compatible, e.g. MinIO)
+// bucket. Requests are signed with AWS signature version 4 using the
+// credentials of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and optional
+// AWS_SESSION_TOKEN environment variables.
+type s3Sink struct {
+	endpoint string
+	bucket   string
+	key      string
+	region   string
+}
+
+func newS3Sink(config benches.OutputConfig, precision int) (Sink, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("The s3 output requires a bucket")
+	}
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" {
+		return nil, fmt.Errorf("The s3 output requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY in the environment")
+	}
+	region := config.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = defaultS3Region
+	}
+	endpoint := config.URL
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	return &s3Sink{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		bucket:   config.Bucket,
+		key:      strings.TrimLeft(config.Key, "/"),
+		region:   region,
+	}, nil
+}
+
+func (s *s3Sink) Name() string {
+	return "s3 " + s.bucket
+}
+
+// Write uploads the report; without a configured key it is stored as
+// <benchmark>-<UTC timestamp>.json
+func (s *s3Sink) Write(report Report) error {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, report); err != nil {
+		return err
+	}
+	key := s.key
+	if key == "" {
+		key = fmt.Sprintf("%s-%s.json", strings.Replace(report.Benchmark, " ", "_", -1), time.Now().UTC().Format("20060102-150405"))
+	}
+	target, err := url.Parse(s.endpoint)
+	if err != nil {
+		return err
+	}
+	// the request is sent with the path it is signed with
+	target.Path = "/" + s.bucket + "/" + key
+	target.RawPath = canonicalPath(target.Path)
+	req, err := http.NewRequest("PUT", target.String(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.sign(req, buf.Bytes(), time.Now().UTC())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("PUT s3://%s/%s returned %s", s.bucket, key, resp.Status)
+	}
+	return nil
+}
+
+// sign adds the AWS signature version 4 headers to a request
+func (s *s3Sink) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	signed := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "date" || strings.HasPrefix(lower, "x-amz-") {
+			signed[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	var names []string
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+os.Getenv("AWS_SECRET_ACCESS_KEY")), date)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		os.Getenv("AWS_ACCESS_KEY_ID"), scope, signedHeaders, signature))
+}
+
+// canonicalPath returns the URI-encoded path of a request as signature
+// version 4 requires for S3: every byte of each path segment is encoded
+// except the unreserved characters A-Z, a-z, 0-9, '-', '.', '_' and '~'
+func canonicalPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		var encoded strings.Builder
+		for j := 0; j < len(segment); j++ {
+			c := segment[j]
+			if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+				encoded.WriteByte(c)
+			} else {
+				fmt.Fprintf(&encoded, "%%%02X", c)
+			}
+		}
+		segments[i] = encoded.String()
+	}
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
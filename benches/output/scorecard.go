@@ -0,0 +1,147 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+
+	"github.com/estesp/bucketbench/benches"
+)
+
+// Scorecard categories
+const (
+	ScoreStartup    = "startup"
+	ScoreThroughput = "throughput"
+	ScoreMemory     = "memory"
+	ScoreTeardown   = "teardown"
+	ScoreOverall    = "overall"
+)
+
+var scoreCategories = []string{ScoreStartup, ScoreThroughput, ScoreMemory, ScoreTeardown}
+
+// Scorecard condenses the results of one driver configuration into scores
+// from 0 to 100 for a summary of several drivers; Values holds the measured
+// value each score is derived from
+type Scorecard struct {
+	Name   string             `json:"name"`
+	Scores map[string]float64 `json:"scores"`
+	Values map[string]float64 `json:"values"`
+}
+
+// Scorecards scores the driver results of the report. Startup (median
+// single-thread run latency), throughput (best rate at any thread count) and
+// memory (peak daemon RSS, when monitorInterval is set) are relative to the
+// best result, which scores 100; teardown is the percentage of stop and
+// remove operations which succeeded. The overall score is the average of the
+// scores a result has. Results without command statistics (e.g. the limit
+// benchmark) are not scored.
+func Scorecards(report Report) []Scorecard {
+	var cards []Scorecard
+	for _, result := range report.Results {
+		card := Scorecard{Name: result.Name, Values: make(map[string]float64), Scores: make(map[string]float64)}
+		var (
+			scored        bool
+			teardownOps   int
+			teardownFails int
+		)
+		for _, run := range result.Runs {
+			if len(run.Commands) == 0 {
+				continue
+			}
+			scored = true
+			card.Values[ScoreThroughput] = math.Max(card.Values[ScoreThroughput], run.Rate)
+			if rss, ok := run.Metrics["daemon rss MB peak"]; ok {
+				card.Values[ScoreMemory] = math.Max(card.Values[ScoreMemory], rss)
+			}
+			for cmd, summary := range run.Commands {
+				if benches.CanonicalCommand(cmd) == "run" && run.Threads == 1 {
+					card.Values[ScoreStartup] = summary.Median
+				}
+			}
+			for _, stat := range run.Statistics {
+				for cmd := range stat.Durations {
+					if op := benches.CanonicalCommand(cmd); op == "stop" || op == "remove" {
+						teardownOps++
+						if stat.Errors[cmd] > 0 {
+							teardownFails++
+						}
+					}
+				}
+			}
+		}
+		if !scored {
+			continue
+		}
+		if teardownOps > 0 {
+			card.Values[ScoreTeardown] = float64(teardownOps-teardownFails) / float64(teardownOps) * 100
+			card.Scores[ScoreTeardown] = card.Values[ScoreTeardown]
+		}
+		cards = append(cards, card)
+	}
+	relativeScore(cards, ScoreStartup, true)
+	relativeScore(cards, ScoreThroughput, false)
+	relativeScore(cards, ScoreMemory, true)
+	for _, card := range cards {
+		var sum float64
+		for _, category := range scoreCategories {
+			sum += card.Scores[category]
+		}
+		if len(card.Scores) > 0 {
+			card.Scores[ScoreOverall] = sum / float64(len(card.Scores))
+		}
+	}
+	return cards
+}
+
+// relativeScore scores a category of the cards against the best value, for
+// which lower or higher is better; cards without the value are not scored
+func relativeScore(cards []Scorecard, category string, lowerIsBetter bool) {
+	best := math.NaN()
+	for _, card := range cards {
+		value, ok := card.Values[category]
+		if !ok || value <= 0 {
+			continue
+		}
+		if math.IsNaN(best) || lowerIsBetter && value < best || !lowerIsBetter && value > best {
+			best = value
+		}
+	}
+	if math.IsNaN(best) {
+		return
+	}
+	for _, card := range cards {
+		value, ok := card.Values[category]
+		if !ok || value <= 0 {
+			continue
+		}
+		if lowerIsBetter {
+			card.Scores[category] = best / value * 100
+		} else {
+			card.Scores[category] = value / best * 100
+		}
+	}
+}
+
+// writeScorecard displays the scorecards of a report comparing several drivers
+func writeScorecard(out io.Writer, cards []Scorecard) {
+	if len(cards) < 2 {
+		return
+	}
+	fmt.Fprintf(out, "SCORECARD (100 = best)\n\n")
+	w := tabwriter.NewWriter(out, 10, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, " \tStartup\tThroughput\tMemory\tTeardown\tOverall\t\n")
+	for _, card := range cards {
+		fmt.Fprintf(w, "%s", card.Name)
+		for _, category := range append(scoreCategories, ScoreOverall) {
+			if score, ok := card.Scores[category]; ok {
+				fmt.Fprintf(w, "\t%.0f", score)
+			} else {
+				fmt.Fprintf(w, "\t-")
+			}
+		}
+		fmt.Fprintln(w, "\t")
+	}
+	w.Flush()
+	fmt.Fprintln(out, "")
+}
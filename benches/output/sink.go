@@ -0,0 +1,269 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/estesp/bucketbench/benches"
+	log "github.com/sirupsen/logrus"
+)
+
+// Output formats of the console and file sinks
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatSVG  = "svg"
+	FormatHTML = "html"
+	// FormatBenchstat and FormatJUnit are for other tools: the Go benchmark
+	// format read by benchstat, and JUnit XML for CI systems
+	FormatBenchstat = "benchstat"
+	FormatJUnit     = "junit"
+)
+
+// Sink receives the report of a completed benchmark run, e.g. to print it or
+// export it to another system. A sink which also implements benches.Observer
+// is registered as an observer for the whole run.
+type Sink interface {
+	// Name describes the sink in logs and errors
+	Name() string
+	// Write delivers the report
+	Write(report Report) error
+}
+
+// SinkFactory creates a sink from its YAML configuration; precision is the
+// number of decimal places of rendered values
+type SinkFactory func(config benches.OutputConfig, precision int) (Sink, error)
+
+var sinkFactories = map[string]SinkFactory{
+	"console":    newConsoleSink,
+	"file":       newFileSink,
+	"prometheus": newPrometheusSink,
+	"influx":     newInfluxSink,
+	"graphite":   newGraphiteSink,
+	"webhook":    newWebhookSink,
+	"s3":         newS3Sink,
+	"sse":        newSSESink,
+	"history":    newHistorySink,
+	"otlp":       newOTLPSink,
+}
+
+// RegisterSink adds a sink type which can then be used in the outputs list
+// of a benchmark YAML
+func RegisterSink(sinkType string, factory SinkFactory) {
+	sinkFactories[strings.ToLower(sinkType)] = factory
+}
+
+// SinkTypes returns the names of the registered sink types
+func SinkTypes() []string {
+	var types []string
+	for sinkType := range sinkFactories {
+		types = append(types, sinkType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewSink creates the sink described by an outputs entry of the YAML
+func NewSink(config benches.OutputConfig, precision int) (Sink, error) {
+	factory, ok := sinkFactories[strings.ToLower(config.Type)]
+	if !ok {
+		return nil, fmt.Errorf("Unknown output type %q; use one of %s", config.Type, strings.Join(SinkTypes(), ", "))
+	}
+	return factory(config, precision)
+}
+
+// MultiSink fans a report out to several sinks
+type MultiSink []Sink
+
+// Name lists the names of the sinks
+func (m MultiSink) Name() string {
+	var names []string
+	for _, sink := range m {
+		names = append(names, sink.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+// Write delivers the report to every sink, even if earlier sinks fail, and
+// returns an error naming the sinks which failed
+func (m MultiSink) Write(report Report) error {
+	var failed []string
+	for _, sink := range m {
+		if err := sink.Write(report); err != nil {
+			log.Errorf("Error writing results to %s: %v", sink.Name(), err)
+			failed = append(failed, sink.Name())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Error writing results to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// fileFormats lists the formats of the file sink for error messages
+var fileFormats = fmt.Sprintf("%q, %q, %q, %q, %q, %q or %q", FormatText, FormatJSON, FormatCSV, FormatSVG, FormatHTML, FormatBenchstat, FormatJUnit)
+
+// WriteFormat renders the report in one of the file sink formats
+func WriteFormat(w io.Writer, format string, report Report, precision int) error {
+	switch format {
+	case FormatText:
+		WriteText(w, report, precision)
+		return nil
+	case FormatJSON:
+		return WriteJSON(w, report)
+	case FormatCSV:
+		return WriteCSV(w, report)
+	case FormatSVG:
+		return WriteHeatmapSVG(w, report)
+	case FormatHTML:
+		return WriteHeatmapHTML(w, report)
+	case FormatBenchstat:
+		return WriteBenchstat(w, report)
+	case FormatJUnit:
+		return WriteJUnit(w, report)
+	default:
+		return fmt.Errorf("Unknown output format %q; use %s", format, fileFormats)
+	}
+}
+
+// consoleSink prints the report to stdout
+type consoleSink struct {
+	format    string
+	precision int
+}
+
+func newConsoleSink(config benches.OutputConfig, precision int) (Sink, error) {
+	format := config.Format
+	if format == "" {
+		format = FormatText
+	}
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("Unknown console output format %q; use %q or %q", format, FormatText, FormatJSON)
+	}
+	return &consoleSink{format: format, precision: precision}, nil
+}
+
+func (c *consoleSink) Name() string {
+	return "console (" + c.format + ")"
+}
+
+func (c *consoleSink) Write(report Report) error {
+	return WriteFormat(os.Stdout, c.format, report, c.precision)
+}
+
+// fileSink writes the report to a file; the format defaults to the one
+// matching the file extension
+type fileSink struct {
+	path      string
+	format    string
+	precision int
+}
+
+func newFileSink(config benches.OutputConfig, precision int) (Sink, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("The file output requires a path")
+	}
+	format := config.Format
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(config.Path)) {
+		case ".json":
+			format = FormatJSON
+		case ".csv":
+			format = FormatCSV
+		case ".svg":
+			format = FormatSVG
+		case ".html", ".htm":
+			format = FormatHTML
+		case ".xml":
+			format = FormatJUnit
+		default:
+			format = FormatText
+		}
+	}
+	switch format {
+	case FormatText, FormatJSON, FormatCSV, FormatSVG, FormatHTML, FormatBenchstat, FormatJUnit:
+	default:
+		return nil, fmt.Errorf("Unknown file output format %q; use %s", format, fileFormats)
+	}
+	return &fileSink{path: config.Path, format: format, precision: precision}, nil
+}
+
+// NewFileSink creates a sink writing the report to a file in a format
+func NewFileSink(path, format string, precision int) (Sink, error) {
+	return newFileSink(benches.OutputConfig{Type: "file", Path: path, Format: format}, precision)
+}
+
+func (f *fileSink) Name() string {
+	return "file " + f.path
+}
+
+func (f *fileSink) Write(report Report) error {
+	file, err := os.Create(f.path)
+	if err != nil {
+		return err
+	}
+	if err := WriteFormat(file, f.format, report, f.precision); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// webhookSink posts the JSON report to a URL, e.g. a chat or CI webhook
+type webhookSink struct {
+	url     string
+	headers map[string]string
+}
+
+func newWebhookSink(config benches.OutputConfig, precision int) (Sink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("The webhook output requires a url")
+	}
+	return &webhookSink{url: config.URL, headers: config.Headers}, nil
+}
+
+func (s *webhookSink) Name() string {
+	return "webhook " + s.url
+}
+
+func (s *webhookSink) Write(report Report) error {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, report); err != nil {
+		return err
+	}
+	return httpSend("POST", s.url, "application/json", s.headers, buf.Bytes())
+}
+
+// httpSend sends a request with a body, failing on a non-2xx response
+func httpSend(method, url, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var msg struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&msg)
+		return fmt.Errorf("%s %s returned %s %s%s", method, url, resp.Status, msg.Message, msg.Error)
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/estesp/bucketbench/benches"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultSSEWindow is the aggregation interval of an sse sink without a window
+const defaultSSEWindow = time.Second
+
+// sseClientBuffer is the number of events buffered per client; events to a
+// client which falls further behind are dropped
+const sseClientBuffer = 64
+
+// OpWindow summarizes the operations of one command within a window
+type OpWindow struct {
+	Count  int     `json:"count"`
+	Errors int     `json:"errors"`
+	Avg    float64 `json:"avg"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+	Max    float64 `json:"max"`
+}
+
+// Window is the event streamed for each benchmark run and window in which
+// operations completed
+type Window struct {
+	Bench   string `json:"bench"`
+	Threads int    `json:"threads"`
+	// Start is the start of the window, in Unix milliseconds
+	Start      int64 `json:"start"`
+	Iterations int   `json:"iterations"`
+	// Rate is iterations per second within the window
+	Rate float64             `json:"rate"`
+	Ops  map[string]OpWindow `json:"ops,omitempty"`
+}
+
+// sseRun collects the operations of a benchmark run in the current window
+type sseRun struct {
+	bench      string
+	threads    int
+	iterations int
+	timings    map[string][]int
+	errors     map[string]int
+}
+
+// SSE streams per-window aggregates of the running benchmark as server-sent
+// events, so remote dashboards can plot runs live. It implements
+// benches.Observer.
+type SSE struct {
+	mu      sync.Mutex
+	window  time.Duration
+	start   time.Time
+	runs    map[string]*sseRun
+	clients map[chan []byte]bool
+	// handlers tracks the connected clients, so the last events are
+	// delivered before exiting
+	handlers sync.WaitGroup
+}
+
+// NewSSE creates a stream aggregating operations over windows of the given
+// length; Serve begins the windows
+func NewSSE(window time.Duration) *SSE {
+	return &SSE{
+		window:  window,
+		runs:    make(map[string]*sseRun),
+		clients: make(map[chan []byte]bool),
+	}
+}
+
+func (s *SSE) run(bench string, threads int) *sseRun {
+	key := fmt.Sprintf("%s/%d", bench, threads)
+	r, ok := s.runs[key]
+	if !ok {
+		r = &sseRun{bench: bench, threads: threads, timings: make(map[string][]int), errors: make(map[string]int)}
+		s.runs[key] = r
+	}
+	return r
+}
+
+// OpDone adds a lifecycle operation to the current window
+func (s *SSE) OpDone(bench string, threads int, op string, ms int, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.run(bench, threads)
+	if failed {
+		r.errors[op]++
+		return
+	}
+	r.timings[op] = append(r.timings[op], ms)
+}
+
+// IterationDone counts an iteration in the current window
+func (s *SSE) IterationDone(bench string, threads int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run(bench, threads).iterations++
+}
+
+// RunDone flushes the current window and streams a run event with the rate
+// and run-level metrics of the completed run
+func (s *SSE) RunDone(bench string, threads int, rate float64, metrics map[string]float64) {
+	s.flush()
+	s.broadcast("run", map[string]interface{}{
+		"bench":   bench,
+		"threads": threads,
+		"rate":    rate,
+		"metrics": metrics,
+	})
+}
+
+// flush streams a window event per run with operations in the current
+// window, and starts the next window
+func (s *SSE) flush() {
+	s.mu.Lock()
+	start, elapsed := s.start, time.Since(s.start)
+	runs := s.runs
+	s.runs = make(map[string]*sseRun)
+	s.start = time.Now()
+	s.mu.Unlock()
+
+	var keys []string
+	for key := range runs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		r := runs[key]
+		w := Window{
+			Bench:      r.bench,
+			Threads:    r.threads,
+			Start:      start.UnixNano() / int64(time.Millisecond),
+			Iterations: r.iterations,
+			Rate:       float64(r.iterations) / elapsed.Seconds(),
+			Ops:        make(map[string]OpWindow),
+		}
+		for op, timings := range r.timings {
+			w.Ops[op] = summarizeWindow(timings, r.errors[op])
+		}
+		for op, errors := range r.errors {
+			if _, ok := w.Ops[op]; !ok {
+				w.Ops[op] = OpWindow{Count: errors, Errors: errors}
+			}
+		}
+		s.broadcast("window", w)
+	}
+}
+
+// summarizeWindow returns the summary of the successful timings of a command
+// in a window; failed operations are only counted
+func summarizeWindow(timings []int, errors int) OpWindow {
+	sort.Ints(timings)
+	sum := 0
+	for _, ms := range timings {
+		sum += ms
+	}
+	n := len(timings)
+	return OpWindow{
+		Count:  n + errors,
+		Errors: errors,
+		Avg:    float64(sum) / float64(n),
+		Median: float64(timings[n/2]),
+		P95:    float64(timings[(n*95-1)/100]),
+		Max:    float64(timings[n-1]),
+	}
+}
+
+// broadcast sends an event to every connected client
+func (s *SSE) broadcast(event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Warnf("SSE: error encoding %s event: %v", event, err)
+		return
+	}
+	msg := []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", event, payload))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		select {
+		case client <- msg:
+		default:
+			log.Warnf("SSE: dropping %s event for a slow client", event)
+		}
+	}
+}
+
+// ServeHTTP streams the events to a client until it disconnects
+func (s *SSE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	client := make(chan []byte, sseClientBuffer)
+	s.handlers.Add(1)
+	defer s.handlers.Done()
+	s.mu.Lock()
+	s.clients[client] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case msg, ok := <-client:
+			if !ok {
+				// the stream has ended
+				return
+			}
+			if _, err := w.Write(msg); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Serve starts the /events endpoint and the windows in the background
+func (s *SSE) Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/events", s)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("SSE endpoint on %s failed: %v", addr, err)
+		}
+	}()
+	s.mu.Lock()
+	s.start = time.Now()
+	s.mu.Unlock()
+	go func() {
+		for range time.Tick(s.window) {
+			s.flush()
+		}
+	}()
+	log.Infof("Streaming live results on %s/events", addr)
+}
+
+// sseSink streams the progress of the run and a final done event
+type sseSink struct {
+	*SSE
+	listen string
+}
+
+func newSSESink(config benches.OutputConfig, precision int) (Sink, error) {
+	if config.Listen == "" {
+		return nil, fmt.Errorf("The sse output requires a listen address")
+	}
+	window := defaultSSEWindow
+	if config.Window != "" {
+		var err error
+		if window, err = time.ParseDuration(config.Window); err != nil || window <= 0 {
+			return nil, fmt.Errorf("Invalid sse window %q: must be a positive duration such as 500ms", config.Window)
+		}
+	}
+	sink := &sseSink{SSE: NewSSE(window), listen: config.Listen}
+	sink.Serve(config.Listen)
+	return sink, nil
+}
+
+func (s *sseSink) Name() string {
+	return "sse " + s.listen
+}
+
+// Write streams a done event with the benchmark name, after which clients
+// can fetch the final results from the other outputs
+func (s *sseSink) Write(report Report) error {
+	s.flush()
+	s.broadcast("done", map[string]string{"benchmark": report.Benchmark, "runID": report.RunID})
+	// end the streams and give the clients a moment to receive the last
+	// events before exiting
+	s.mu.Lock()
+	for client := range s.clients {
+		close(client)
+		delete(s.clients, client)
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+	return nil
+}
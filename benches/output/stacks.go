@@ -0,0 +1,30 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeBlockedStacks displays the daemon stacks most often found blocked on
+// locks during each run with stack sampling, hottest first
+func writeBlockedStacks(out io.Writer, report Report) {
+	header := false
+	for _, result := range report.Results {
+		for _, run := range result.Runs {
+			if len(run.BlockedStacks) == 0 {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(out, "HOT BLOCKED DAEMON STACKS (share of blocked goroutines)\n\n")
+				header = true
+			}
+			fmt.Fprintf(out, "%s:%d\n", result.Name, run.Threads)
+			for _, stack := range run.BlockedStacks {
+				fmt.Fprintf(out, "%5.1f%%  %d x [%s]\n", stack.Share, stack.Count, stack.State)
+				fmt.Fprintf(out, "        %s\n", strings.Join(stack.Frames, "\n        "))
+			}
+			fmt.Fprintln(out, "")
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// SuiteSummary condenses the scorecards of the benchmarks of a suite, each
+// run separately, into rankings of the drivers across all of them
+type SuiteSummary struct {
+	Benchmarks []SuiteBenchmark `json:"benchmarks"`
+	Rankings   []SuiteRanking   `json:"rankings"`
+}
+
+// SuiteBenchmark holds the drivers which scored best in each scorecard
+// category of one benchmark; drivers tied for the best score are all listed
+type SuiteBenchmark struct {
+	Benchmark string              `json:"benchmark"`
+	RunID     string              `json:"runID,omitempty"`
+	Winners   map[string][]string `json:"winners"`
+}
+
+// SuiteRanking holds how a driver ranked in one scorecard category across the
+// benchmarks of the suite comparing it with other drivers in that category
+type SuiteRanking struct {
+	Category string `json:"category"`
+	Driver   string `json:"driver"`
+	// Benchmarks counts the benchmarks the driver was ranked in
+	Benchmarks int `json:"benchmarks"`
+	// Wins and Losses count the benchmarks the driver ranked first and last
+	// in; tied drivers share the rank
+	Wins    int     `json:"wins"`
+	Losses  int     `json:"losses"`
+	AvgRank float64 `json:"avgRank"`
+}
+
+// suiteDriver returns the name of a result without the benchmark name, so the
+// same driver configuration matches across benchmarks
+func suiteDriver(report Report, result string) string {
+	return strings.TrimPrefix(result, report.Benchmark+":")
+}
+
+// Suite ranks the drivers of the reports of a suite in each scorecard
+// category (see Scorecards). Within each benchmark the drivers with a score
+// in a category are ranked by it; a category scored for fewer than two
+// drivers compares nothing and is left out. The rankings are ordered by
+// category, then by wins, fewest losses and best average rank.
+func Suite(reports []Report) SuiteSummary {
+	var summary SuiteSummary
+	type key struct {
+		category, driver string
+	}
+	rankings := make(map[key]*SuiteRanking)
+	rankSums := make(map[key]int)
+	for _, report := range reports {
+		cards := report.Scorecard
+		if len(cards) == 0 {
+			cards = Scorecards(report)
+		}
+		bench := SuiteBenchmark{Benchmark: report.Benchmark, RunID: report.RunID, Winners: make(map[string][]string)}
+		for _, category := range append(scoreCategories, ScoreOverall) {
+			var scored []Scorecard
+			for _, card := range cards {
+				if _, ok := card.Scores[category]; ok {
+					scored = append(scored, card)
+				}
+			}
+			if len(scored) < 2 {
+				continue
+			}
+			sort.SliceStable(scored, func(i, j int) bool {
+				return scored[i].Scores[category] > scored[j].Scores[category]
+			})
+			worst := scored[len(scored)-1].Scores[category]
+			rank := 1
+			for i, card := range scored {
+				score := card.Scores[category]
+				if i > 0 && score < scored[i-1].Scores[category] {
+					rank = i + 1
+				}
+				k := key{category, suiteDriver(report, card.Name)}
+				r, ok := rankings[k]
+				if !ok {
+					r = &SuiteRanking{Category: category, Driver: k.driver}
+					rankings[k] = r
+				}
+				r.Benchmarks++
+				rankSums[k] += rank
+				if rank == 1 {
+					r.Wins++
+					bench.Winners[category] = append(bench.Winners[category], k.driver)
+				}
+				if score == worst && score < scored[0].Scores[category] {
+					r.Losses++
+				}
+			}
+		}
+		summary.Benchmarks = append(summary.Benchmarks, bench)
+	}
+	categoryOrder := make(map[string]int)
+	for i, category := range append(scoreCategories, ScoreOverall) {
+		categoryOrder[category] = i
+	}
+	for k, r := range rankings {
+		r.AvgRank = float64(rankSums[k]) / float64(r.Benchmarks)
+		summary.Rankings = append(summary.Rankings, *r)
+	}
+	sort.Slice(summary.Rankings, func(i, j int) bool {
+		a, b := summary.Rankings[i], summary.Rankings[j]
+		switch {
+		case a.Category != b.Category:
+			return categoryOrder[a.Category] < categoryOrder[b.Category]
+		case a.Wins != b.Wins:
+			return a.Wins > b.Wins
+		case a.Losses != b.Losses:
+			return a.Losses < b.Losses
+		case a.AvgRank != b.AvgRank:
+			return a.AvgRank < b.AvgRank
+		default:
+			return a.Driver < b.Driver
+		}
+	})
+	return summary
+}
+
+// WriteSuiteSummary displays the best drivers of each benchmark of a suite,
+// followed by the rankings of the drivers across the suite
+func WriteSuiteSummary(out io.Writer, summary SuiteSummary) {
+	fmt.Fprintf(out, "SUITE WINNERS BY BENCHMARK\n\n")
+	w := tabwriter.NewWriter(out, 10, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Benchmark\tStartup\tThroughput\tMemory\tTeardown\tOverall\t\n")
+	for _, bench := range summary.Benchmarks {
+		name := bench.Benchmark
+		if bench.RunID != "" {
+			name += " (" + bench.RunID + ")"
+		}
+		fmt.Fprintf(w, "%s", name)
+		for _, category := range append(scoreCategories, ScoreOverall) {
+			if winners := bench.Winners[category]; len(winners) > 0 {
+				fmt.Fprintf(w, "\t%s", strings.Join(winners, ", "))
+			} else {
+				fmt.Fprintf(w, "\t-")
+			}
+		}
+		fmt.Fprintln(w, "\t")
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\nSUITE DRIVER RANKINGS (wins/losses = benchmarks ranked first/last)\n\n")
+	w = tabwriter.NewWriter(out, 10, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "Category\tDriver\tBenchmarks\tWins\tLosses\tAvg rank\t\n")
+	for _, r := range summary.Rankings {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%.2f\t\n", r.Category, r.Driver, r.Benchmarks, r.Wins, r.Losses, r.AvgRank)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\n%s\n\n", suiteConclusion(summary))
+}
+
+// suiteConclusion names the driver which ranked best overall across the
+// suite, or the drivers tied for it
+func suiteConclusion(summary SuiteSummary) string {
+	var leaders []SuiteRanking
+	for _, r := range summary.Rankings {
+		if r.Category != ScoreOverall {
+			continue
+		}
+		if len(leaders) > 0 && (r.Wins != leaders[0].Wins || r.Losses != leaders[0].Losses || r.AvgRank != leaders[0].AvgRank) {
+			break
+		}
+		leaders = append(leaders, r)
+	}
+	switch len(leaders) {
+	case 0:
+		return "No benchmark compared two or more drivers"
+	case 1:
+		best := leaders[0]
+		return fmt.Sprintf("Best overall: %s, first in %d and last in %d of %d benchmarks", best.Driver, best.Wins, best.Losses, best.Benchmarks)
+	default:
+		var names []string
+		for _, r := range leaders {
+			names = append(names, r.Driver)
+		}
+		return fmt.Sprintf("No driver is best overall: %s tie with %d wins and %d losses", strings.Join(names, ", "), leaders[0].Wins, leaders[0].Losses)
+	}
+}
@@ -0,0 +1,200 @@
+// Package output renders the results of benchmark runs for consumption by
+// people and by other tools (CI pipelines, dashboards)
+package output
+
+import (
+	"math"
+
+	"github.com/estesp/bucketbench/benches"
+	"github.com/montanaflynn/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+// CommandSummary holds the statistics of one lifecycle command across the
+// iterations of a run; timings are in milliseconds
+type CommandSummary struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Avg    float64 `json:"avg"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+	Stddev float64 `json:"stddev"`
+	Errors int     `json:"errors"`
+	// ErrorClasses counts the errors by class (see driver.ClassifyError),
+	// and Retries the retries of failed operations
+	ErrorClasses map[string]int `json:"errorClasses,omitempty"`
+	Retries      int            `json:"retries,omitempty"`
+	// average client process CPU time, if provided by the driver
+	UserAvg float64 `json:"avgUser,omitempty"`
+	SysAvg  float64 `json:"avgSys,omitempty"`
+	// average run queue delay of the engine daemons, with schedDelay
+	RunQueueAvg float64 `json:"avgRunQueue,omitempty"`
+}
+
+// Summarize computes the per-command statistics of a run's iterations
+func Summarize(statistics []benches.RunStatistics) map[string]CommandSummary {
+	result := make(map[string]CommandSummary)
+	if len(statistics) == 0 {
+		return result
+	}
+	durationSeq := make(map[string][]float64)
+	errorSeq := make(map[string][]int)
+	userSeq := make(map[string][]float64)
+	sysSeq := make(map[string][]float64)
+	runQueueSeq := make(map[string][]float64)
+	classes := make(map[string]map[string]int)
+	retries := make(map[string]int)
+	iterations := len(statistics)
+
+	for i := 0; i < iterations; i++ {
+		for key, duration := range statistics[i].Durations {
+			if nanos, ok := statistics[i].Nanos[key]; ok {
+				// exact mode; keep the sub-millisecond part of the sample
+				durationSeq[key] = append(durationSeq[key], float64(nanos)/1e6)
+				continue
+			}
+			durationSeq[key] = append(durationSeq[key], float64(duration))
+		}
+		for key, errors := range statistics[i].Errors {
+			errorSeq[key] = append(errorSeq[key], errors)
+		}
+		for key, class := range statistics[i].ErrorClasses {
+			if classes[key] == nil {
+				classes[key] = make(map[string]int)
+			}
+			classes[key][class]++
+		}
+		for key, n := range statistics[i].Retries {
+			retries[key] += n
+		}
+		for key, user := range statistics[i].UserTimes {
+			userSeq[key] = append(userSeq[key], float64(user))
+		}
+		for key, sys := range statistics[i].SysTimes {
+			sysSeq[key] = append(sysSeq[key], float64(sys))
+		}
+		for key, micros := range statistics[i].RunQueueMicros {
+			runQueueSeq[key] = append(runQueueSeq[key], float64(micros)/1000)
+		}
+	}
+	// steps may differ between iterations (e.g. the tenants of a fairness
+	// benchmark), so every step seen in any iteration is summarized
+	for key := range durationSeq {
+		// take the durations for this key and perform
+		// several math/statistical functions:
+		min, err := stats.Min(durationSeq[key])
+		if err != nil {
+			log.Errorf("Error finding stats.Min(): %v", err)
+		}
+		max, err := stats.Max(durationSeq[key])
+		if err != nil {
+			log.Errorf("Error finding stats.Max(): %v", err)
+		}
+		average, err := stats.Mean(durationSeq[key])
+		if err != nil {
+			log.Errorf("Error finding stats.Average(): %v", err)
+		}
+		median, err := stats.Median(durationSeq[key])
+		if err != nil {
+			log.Errorf("Error finding stats.Median(): %v", err)
+		}
+		p90, err := stats.Percentile(durationSeq[key], 90)
+		if err != nil {
+			log.Errorf("Error finding stats.Percentile(90): %v", err)
+		}
+		p95, err := stats.Percentile(durationSeq[key], 95)
+		if err != nil {
+			log.Errorf("Error finding stats.Percentile(95): %v", err)
+		}
+		p99, err := stats.Percentile(durationSeq[key], 99)
+		if err != nil {
+			log.Errorf("Error finding stats.Percentile(99): %v", err)
+		}
+		stddev, err := stats.StandardDeviation(durationSeq[key])
+		if err != nil {
+			log.Errorf("Error finding stats.StdDev(): %v", err)
+		}
+		var errors int
+		for _, e := range errorSeq[key] {
+			errors += e
+		}
+		// mean of an empty sequence is an error; ignore for drivers without usage
+		userAvg, _ := stats.Mean(userSeq[key])
+		sysAvg, _ := stats.Mean(sysSeq[key])
+		runQueueAvg, _ := stats.Mean(runQueueSeq[key])
+		result[key] = CommandSummary{
+			Min:          min,
+			Max:          max,
+			Avg:          average,
+			Median:       median,
+			P90:          p90,
+			P95:          p95,
+			P99:          p99,
+			Stddev:       stddev,
+			Errors:       errors,
+			ErrorClasses: classes[key],
+			Retries:      retries[key],
+			UserAvg:      userAvg,
+			SysAvg:       sysAvg,
+			RunQueueAvg:  runQueueAvg,
+		}
+	}
+	return result
+}
+
+// SummarizeSampler converts the streaming statistics of a sampled run, which
+// cover every iteration rather than only the sampled ones
+func SummarizeSampler(sampler *benches.Sampler) map[string]CommandSummary {
+	result := make(map[string]CommandSummary)
+	for step, s := range sampler.Summaries() {
+		result[step] = CommandSummary{
+			Min:          s.Min,
+			Max:          s.Max,
+			Avg:          s.Mean,
+			Median:       s.Median,
+			P90:          s.P90,
+			P95:          s.P95,
+			P99:          s.P99,
+			Stddev:       s.Stddev,
+			Errors:       s.Errors,
+			ErrorClasses: s.ErrorClasses,
+			Retries:      s.Retries,
+			UserAvg:      s.UserAvg,
+			SysAvg:       s.SysAvg,
+			RunQueueAvg:  s.RunQueueAvg,
+		}
+	}
+	return result
+}
+
+// Round rounds a value to the given number of decimal places
+func Round(value float64, precision int) float64 {
+	scale := math.Pow(10, float64(precision))
+	return math.Round(value*scale) / scale
+}
+
+// RoundSummaries rounds the timings of each command summary to the given
+// number of decimal places, for rendering
+func RoundSummaries(summaries map[string]CommandSummary, precision int) map[string]CommandSummary {
+	for cmd, s := range summaries {
+		summaries[cmd] = CommandSummary{
+			Min:          Round(s.Min, precision),
+			Max:          Round(s.Max, precision),
+			Avg:          Round(s.Avg, precision),
+			Median:       Round(s.Median, precision),
+			P90:          Round(s.P90, precision),
+			P95:          Round(s.P95, precision),
+			P99:          Round(s.P99, precision),
+			Stddev:       Round(s.Stddev, precision),
+			Errors:       s.Errors,
+			ErrorClasses: s.ErrorClasses,
+			Retries:      s.Retries,
+			UserAvg:      Round(s.UserAvg, precision),
+			SysAvg:       Round(s.SysAvg, precision),
+			RunQueueAvg:  Round(s.RunQueueAvg, precision),
+		}
+	}
+	return summaries
+}
@@ -0,0 +1,354 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/estesp/bucketbench/benches"
+)
+
+// WriteText writes the report as the text tables shown at the end of a run:
+// the calibration profile (if any), the rate of every result at each thread
+// count, the per-command statistics, any run-level metrics and, comparing
+// several drivers, their scorecard, with values shown to precision decimal
+// places
+func WriteText(out io.Writer, report Report, precision int) {
+	if report.Calibration != nil {
+		WriteCalibrationText(out, *report.Calibration)
+	}
+	w := tabwriter.NewWriter(out, 10, 4, 2, ' ', tabwriter.AlignRight)
+
+	maxThreads := 0
+	for _, result := range report.Results {
+		if result.Threads > maxThreads {
+			maxThreads = result.Threads
+		}
+	}
+	fmt.Fprintf(out, "\nCLOCK: %s\n", report.Environment.Clock)
+	if h := report.Environment.Harness; h != nil {
+		pid := "own PID namespace"
+		if h.HostPID {
+			pid = "host PID namespace"
+		}
+		sockets := "none"
+		if len(h.Sockets) > 0 {
+			sockets = strings.Join(h.Sockets, ", ")
+		}
+		fmt.Fprintf(out, "HARNESS: %s container (%s; engine sockets: %s)\n", h.Engine, pid, sockets)
+	}
+	if p := report.Priority; p != nil {
+		var priorities []string
+		for _, entry := range []struct {
+			name     string
+			priority *benches.Priority
+		}{{"harness", p.Harness}, {"daemon", p.Daemon}, {"workload", p.Workload}} {
+			if entry.priority != nil {
+				priorities = append(priorities, entry.name+" "+describePriority(*entry.priority))
+			}
+		}
+		fmt.Fprintf(out, "PRIORITY: %s\n", strings.Join(priorities, "; "))
+	}
+	if c := report.CPUAffinity; c != nil {
+		var affinities []string
+		for _, entry := range []struct {
+			name     string
+			affinity *benches.Affinity
+		}{{"harness", c.Harness}, {"daemon", c.Daemon}, {"clients", c.Clients}} {
+			if entry.affinity != nil {
+				affinities = append(affinities, entry.name+" "+entry.affinity.String())
+			}
+		}
+		fmt.Fprintf(out, "CPU AFFINITY: %s\n", strings.Join(affinities, "; "))
+	}
+	if report.TraceDir != "" {
+		fmt.Fprintf(out, "TRACES: %s\n", report.TraceDir)
+	}
+	if len(report.Environment.Tunables) > 0 {
+		var tunables []string
+		for name, value := range report.Environment.Tunables {
+			tunables = append(tunables, fmt.Sprintf("%s=%d", name, value))
+		}
+		sort.Strings(tunables)
+		fmt.Fprintf(out, "TUNABLES: %s\n", strings.Join(tunables, " "))
+	}
+	for _, result := range report.Results {
+		if result.ImageDigest != "" {
+			fmt.Fprintf(out, "IMAGE: %s pinned to %s\n", result.Name, result.ImageDigest)
+		}
+	}
+	fmt.Fprintf(out, "\nSUMMARY TIMINGS/THREAD RATES\n\n")
+	fmt.Fprintf(w, " \tIter/Thd\t1 thrd")
+	for i := 2; i <= maxThreads; i++ {
+		fmt.Fprintf(w, "\t%d thrds", i)
+	}
+	fmt.Fprintln(w, "\t ")
+
+	for _, result := range report.Results {
+		fmt.Fprintf(w, "%s\t%d", result.Name, result.Iterations)
+		for _, run := range result.Runs {
+			fmt.Fprintf(w, "\t%7.*f", precision, run.Rate)
+		}
+		fmt.Fprintln(w, "\t ")
+	}
+	w.Flush()
+	fmt.Fprintln(out, "")
+
+	fmt.Fprintf(out, "DETAILED COMMAND TIMINGS/STATISTICS\n")
+	// output per-command timings across the runs as well
+	for _, result := range report.Results {
+		for _, run := range result.Runs {
+			if len(run.Commands) == 0 {
+				// the limit benchmark only records rates
+				continue
+			}
+			hasUsage := len(run.Statistics) > 0 && len(run.Statistics[0].UserTimes) > 0
+			hasRunQueue := hasRunQueueDelay(run)
+			fmt.Fprintf(w, "%s:%d\tMin\tMax\tAvg\tMedian\tP90\tP95\tP99\tStddev\tErrors\t", result.Name, run.Threads)
+			if hasUsage {
+				fmt.Fprintf(w, "AvgUser\tAvgSys\t")
+			}
+			if hasRunQueue {
+				fmt.Fprintf(w, "AvgRunQ\t")
+			}
+			fmt.Fprintln(w)
+			for _, cmd := range commandOrder(report.Commands, run.Commands) {
+				stats := run.Commands[cmd]
+				fmt.Fprintf(w, "%s\t%6.*f\t%6.*f\t%6.*f\t%6.*f\t%6.*f\t%6.*f\t%6.*f\t%6.*f\t%d\t", cmd, precision, stats.Min, precision, stats.Max, precision, stats.Avg, precision, stats.Median, precision, stats.P90, precision, stats.P95, precision, stats.P99, precision, stats.Stddev, stats.Errors)
+				if hasUsage {
+					fmt.Fprintf(w, "%6.*f\t%6.*f\t", precision, stats.UserAvg, precision, stats.SysAvg)
+				}
+				if hasRunQueue {
+					fmt.Fprintf(w, "%6.*f\t", precision, stats.RunQueueAvg)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+		fmt.Fprintln(out, "")
+	}
+	w.Flush()
+	writeRunMetrics(out, w, report, precision)
+	writeErrorClasses(out, w, report)
+	writeConcurrency(out, report, precision)
+	writeBlockedStacks(out, report)
+	writeScorecard(out, Scorecards(report))
+	writeVersionTrends(out, report, precision)
+	writeAnomalies(out, report, precision)
+	writeCollectorHealth(out, report)
+}
+
+// hasRunQueueDelay returns whether the run queue delay of the engine daemons
+// was recorded for any step of the run
+func hasRunQueueDelay(run Run) bool {
+	for _, stat := range run.Statistics {
+		if len(stat.RunQueueMicros) > 0 {
+			return true
+		}
+	}
+	for _, stats := range run.Commands {
+		if stats.RunQueueAvg > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCollectorHealth summarizes for each enabled collector the runs it
+// measured and those it was unavailable for, with the reasons
+func writeCollectorHealth(out io.Writer, report Report) {
+	type health struct {
+		runs    int
+		reasons map[string][]string
+	}
+	collectors := make(map[string]*health)
+	var names []string
+	for _, result := range report.Results {
+		for _, run := range result.Runs {
+			for name, status := range run.Collectors {
+				h, ok := collectors[name]
+				if !ok {
+					h = &health{reasons: make(map[string][]string)}
+					collectors[name] = h
+					names = append(names, name)
+				}
+				h.runs++
+				if status != benches.CollectorOK {
+					h.reasons[status] = append(h.reasons[status], fmt.Sprintf("%s:%d", result.Name, run.Threads))
+				}
+			}
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	fmt.Fprintf(out, "COLLECTOR HEALTH\n\n")
+	for _, name := range names {
+		h := collectors[name]
+		var failed int
+		var reasons []string
+		for reason, runs := range h.reasons {
+			failed += len(runs)
+			reasons = append(reasons, fmt.Sprintf("    %s (%s)", reason, strings.Join(runs, ", ")))
+		}
+		sort.Strings(reasons)
+		fmt.Fprintf(out, "%s: measured %d of %d runs\n", name, h.runs-failed, h.runs)
+		for _, reason := range reasons {
+			fmt.Fprintln(out, reason)
+		}
+	}
+	fmt.Fprintln(out, "")
+}
+
+// writeRunMetrics displays any run-level metrics (e.g. perf counters) per
+// thread count for the results which collected them
+func writeRunMetrics(out io.Writer, w *tabwriter.Writer, report Report, precision int) {
+	header := false
+	for _, result := range report.Results {
+		seen := make(map[string]bool)
+		var names []string
+		for _, run := range result.Runs {
+			for name := range run.Metrics {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		if !header {
+			fmt.Fprintf(out, "RUN METRICS\n")
+			header = true
+		}
+		sort.Strings(names)
+		fmt.Fprintf(w, "%s\t1 thrd", result.Name)
+		for i := 2; i <= len(result.Runs); i++ {
+			fmt.Fprintf(w, "\t%d thrds", i)
+		}
+		fmt.Fprintln(w, "\t ")
+		for _, name := range names {
+			fmt.Fprintf(w, "%s", name)
+			for _, run := range result.Runs {
+				if value, ok := run.Metrics[name]; ok {
+					fmt.Fprintf(w, "\t%.*f", precision, value)
+				} else {
+					// e.g. its collector was unavailable for this run
+					fmt.Fprintf(w, "\t-")
+				}
+			}
+			fmt.Fprintln(w, "\t ")
+		}
+		w.Flush()
+		fmt.Fprintln(out, "")
+	}
+}
+
+// writeErrorClasses displays the errors of each command by class and its
+// retries, for the runs with errors or retries
+func writeErrorClasses(out io.Writer, w *tabwriter.Writer, report Report) {
+	header := false
+	for _, result := range report.Results {
+		for _, run := range result.Runs {
+			seen := make(map[string]bool)
+			var classes []string
+			retries := false
+			for _, summary := range run.Commands {
+				for class := range summary.ErrorClasses {
+					if !seen[class] {
+						seen[class] = true
+						classes = append(classes, class)
+					}
+				}
+				retries = retries || summary.Retries > 0
+			}
+			if len(classes) == 0 && !retries {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(out, "ERRORS BY CLASS\n")
+				header = true
+			}
+			sort.Strings(classes)
+			fmt.Fprintf(w, "%s:%d", result.Name, run.Threads)
+			for _, class := range classes {
+				fmt.Fprintf(w, "\t%s", class)
+			}
+			fmt.Fprintln(w, "\tretries\t ")
+			for _, cmd := range commandOrder(report.Commands, run.Commands) {
+				summary := run.Commands[cmd]
+				if summary.Errors == 0 && summary.Retries == 0 {
+					continue
+				}
+				fmt.Fprintf(w, "%s", cmd)
+				for _, class := range classes {
+					fmt.Fprintf(w, "\t%d", summary.ErrorClasses[class])
+				}
+				fmt.Fprintf(w, "\t%d\t \n", summary.Retries)
+			}
+			w.Flush()
+			fmt.Fprintln(out, "")
+		}
+	}
+}
+
+// WriteCalibrationText writes a host calibration profile as a text table
+func WriteCalibrationText(out io.Writer, profile benches.CalibrationProfile) {
+	fmt.Fprintf(out, "\nCALIBRATION: %s (kernel %s, %d CPUs)\nCLOCK: %s\n\n", profile.Hostname, profile.Kernel, profile.CPUs, profile.Clock)
+	w := tabwriter.NewWriter(out, 10, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "usecs\tMin\tMedian\tP90\tMean\tStddev\tErrors\t\n")
+	var names []string
+	for name := range profile.Operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		op := profile.Operations[name]
+		fmt.Fprintf(w, "%s\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t%d\t\n", name, op.Min, op.Median, op.P90, op.Mean, op.Stddev, op.Errors)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "")
+}
+
+// commandOrder returns the summarized commands in the order of the
+// benchmark's steps, followed by any others (e.g. fairness tenant steps)
+func commandOrder(steps []string, summaries map[string]CommandSummary) []string {
+	var order []string
+	seen := make(map[string]bool)
+	for _, step := range steps {
+		if _, ok := summaries[step]; ok && !seen[step] {
+			seen[step] = true
+			order = append(order, step)
+		}
+	}
+	var rest []string
+	for cmd := range summaries {
+		if !seen[cmd] {
+			rest = append(rest, cmd)
+		}
+	}
+	sort.Strings(rest)
+	return append(order, rest...)
+}
+
+// describePriority renders the settings of a priority, e.g. "nice=-5 io=idle"
+func describePriority(p benches.Priority) string {
+	var settings []string
+	if p.Nice != nil {
+		settings = append(settings, fmt.Sprintf("nice=%d", *p.Nice))
+	}
+	if p.IOClass != "" {
+		io := "io=" + p.IOClass
+		if p.IOLevel != nil {
+			io += fmt.Sprintf("/%d", *p.IOLevel)
+		}
+		settings = append(settings, io)
+	}
+	if p.Policy != "" {
+		settings = append(settings, "policy="+p.Policy)
+	}
+	return strings.Join(settings, " ")
+}
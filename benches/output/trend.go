@@ -0,0 +1,167 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"text/tabwriter"
+)
+
+// versionLabel matches the "[version:X]" label of the results of a version
+// matrix entry
+var versionLabel = regexp.MustCompile(`\[version:([^\]]*)\]`)
+
+// VersionTrend compares the results of the versions of one driver
+// configuration, in the order they ran; changes are relative to the first
+// version
+type VersionTrend struct {
+	// Name is the name of the results without their version label
+	Name     string         `json:"name"`
+	Versions []TrendVersion `json:"versions"`
+}
+
+// TrendVersion holds the results of one version of a VersionTrend
+type TrendVersion struct {
+	Version string `json:"version"`
+	// Rates are the rates at each thread count, and RateChanges their
+	// percentage change from the first version
+	Rates       []float64 `json:"rates"`
+	RateChanges []float64 `json:"rateChanges"`
+	// Medians are the median milliseconds of each command in the run with
+	// the fewest threads, and MedianChanges their percentage change from the
+	// first version
+	Medians       map[string]float64 `json:"medians,omitempty"`
+	MedianChanges map[string]float64 `json:"medianChanges,omitempty"`
+}
+
+// VersionTrends groups the results of the report which differ only by their
+// version label, i.e. the entries of a driver configuration's version matrix,
+// into trends; results without a label, or alone in their group, are left out
+func VersionTrends(report Report) []VersionTrend {
+	var trends []VersionTrend
+	index := make(map[string]int)
+	for _, result := range report.Results {
+		match := versionLabel.FindStringSubmatch(result.Name)
+		if match == nil {
+			continue
+		}
+		name := versionLabel.ReplaceAllString(result.Name, "")
+		i, ok := index[name]
+		if !ok {
+			i = len(trends)
+			index[name] = i
+			trends = append(trends, VersionTrend{Name: name})
+		}
+		version := TrendVersion{Version: match[1]}
+		for _, run := range result.Runs {
+			version.Rates = append(version.Rates, run.Rate)
+		}
+		if len(result.Runs) > 0 && len(result.Runs[0].Commands) > 0 {
+			version.Medians = make(map[string]float64)
+			for cmd, summary := range result.Runs[0].Commands {
+				version.Medians[cmd] = summary.Median
+			}
+		}
+		trends[i].Versions = append(trends[i].Versions, version)
+	}
+	var compared []VersionTrend
+	for _, trend := range trends {
+		if len(trend.Versions) < 2 {
+			continue
+		}
+		base := trend.Versions[0]
+		for i := range trend.Versions {
+			version := &trend.Versions[i]
+			for t, rate := range version.Rates {
+				change := 0.0
+				if t < len(base.Rates) {
+					change = percentChange(base.Rates[t], rate)
+				}
+				version.RateChanges = append(version.RateChanges, change)
+			}
+			for cmd, median := range version.Medians {
+				if baseMedian, ok := base.Medians[cmd]; ok {
+					if version.MedianChanges == nil {
+						version.MedianChanges = make(map[string]float64)
+					}
+					version.MedianChanges[cmd] = percentChange(baseMedian, median)
+				}
+			}
+		}
+		compared = append(compared, trend)
+	}
+	return compared
+}
+
+// percentChange returns the percentage change from base to value, or zero
+// when base is zero
+func percentChange(base, value float64) float64 {
+	if base == 0 {
+		return 0
+	}
+	return (value - base) / base * 100
+}
+
+// writeVersionTrends displays the version trends of a report: the rate at
+// each thread count and the median of each command, with the change from the
+// first version
+func writeVersionTrends(out io.Writer, report Report, precision int) {
+	trends := VersionTrends(report)
+	if len(trends) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "VERSION TREND (change from the first version)\n\n")
+	w := tabwriter.NewWriter(out, 10, 4, 2, ' ', tabwriter.AlignRight)
+	for _, trend := range trends {
+		threads := 0
+		medians := make(map[string]CommandSummary)
+		for _, version := range trend.Versions {
+			if len(version.Rates) > threads {
+				threads = len(version.Rates)
+			}
+			for cmd := range version.Medians {
+				medians[cmd] = CommandSummary{}
+			}
+		}
+		commands := commandOrder(report.Commands, medians)
+		fmt.Fprintf(w, "%s\t1 thrd", trend.Name)
+		for i := 2; i <= threads; i++ {
+			fmt.Fprintf(w, "\t%d thrds", i)
+		}
+		for _, cmd := range commands {
+			fmt.Fprintf(w, "\t%s (median)", cmd)
+		}
+		fmt.Fprintln(w, "\t ")
+		for i, version := range trend.Versions {
+			fmt.Fprintf(w, "%s", version.Version)
+			for t := 0; t < threads; t++ {
+				if t >= len(version.Rates) {
+					fmt.Fprintf(w, "\t-")
+					continue
+				}
+				fmt.Fprintf(w, "\t%s", trendCell(version.Rates[t], version.RateChanges[t], i == 0, precision))
+			}
+			for _, cmd := range commands {
+				median, ok := version.Medians[cmd]
+				if !ok {
+					fmt.Fprintf(w, "\t-")
+					continue
+				}
+				change, ok := version.MedianChanges[cmd]
+				fmt.Fprintf(w, "\t%s", trendCell(median, change, i == 0 || !ok, precision))
+			}
+			fmt.Fprintln(w, "\t ")
+		}
+		w.Flush()
+		fmt.Fprintln(out, "")
+	}
+}
+
+// trendCell formats a value of a version trend with its change from the
+// first version, which is omitted for the first version itself
+func trendCell(value, change float64, base bool, precision int) string {
+	if base {
+		return fmt.Sprintf("%.*f", precision, value)
+	}
+	return fmt.Sprintf("%.*f (%+.1f%%)", precision, value, change)
+}
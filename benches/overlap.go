@@ -0,0 +1,152 @@
+package benches
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+	log "github.com/sirupsen/logrus"
+)
+
+// rampDelay waits for the start of a thread when the thread starts of a run
+// are staggered over the ramp window: thread n of threads starts n/threads of
+// the way into the window
+func (cb *CustomBench) rampDelay(ctx context.Context, threadNum, threads int) {
+	if cb.ramp <= 0 || threadNum == 0 {
+		return
+	}
+	delay := cb.ramp * time.Duration(threadNum) / time.Duration(threads)
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+}
+
+// raisePeak atomically raises peak to value if it is higher
+func raisePeak(peak *int64, value int64) {
+	for {
+		current := atomic.LoadInt64(peak)
+		if value <= current || atomic.CompareAndSwapInt64(peak, current, value) {
+			return
+		}
+	}
+}
+
+// splitTeardown splits the commands at the first stop or remove into the
+// commands bringing a container up and those tearing it down
+func splitTeardown(commands []string) ([]string, []string) {
+	for i, cmd := range commands {
+		if op := CanonicalCommand(cmd); op == opStop || op == opRemove {
+			return commands[:i], commands[i:]
+		}
+	}
+	return commands, nil
+}
+
+// liveIteration is an iteration in overlap mode whose container is kept
+// alive until its teardown commands run
+type liveIteration struct {
+	ctr       driver.Container
+	name      string
+	i         int
+	iterStart time.Duration
+	stats     RunStatistics
+}
+
+// overlapThread runs the iterations of one thread keeping the containers of
+// its last cb.overlap iterations alive: each iteration runs its commands up
+// to the first stop or remove, and the rest of them once overlap newer
+// containers are up. The engine then churns containers while holding a
+// sustained number of live ones, rather than emptying between iterations.
+func (cb *CustomBench) overlapThread(ctx context.Context, drv driver.Driver, threadNum, threads, iterations int, commands []string, stats chan RunStatistics) {
+	benchName := cb.Info()
+	setup, teardown := splitTeardown(commands)
+	var live []liveIteration
+	retire := func(it liveIteration) {
+		rest := cb.runCommands(ctx, drv, it.ctr, it.name, benchName, threadNum, threads, it.i, it.iterStart, teardown)
+		atomic.AddInt64(&cb.live, -1)
+		notify(func(o Observer) { o.IterationDone(benchName, threads) })
+		stats <- it.stats.merge(rest)
+	}
+	cb.rampDelay(ctx, threadNum, threads)
+	var slot time.Time
+	for i := 0; i < iterations && ctx.Err() == nil; i++ {
+		gate.wait()
+		cb.backoff.wait(ctx)
+		if cb.rate > 0 {
+			if slot = cb.nextSlot(ctx, slot); ctx.Err() != nil {
+				break
+			}
+		}
+		it := liveIteration{i: i}
+		var err error
+		if it.ctr, it.name, it.iterStart, err = cb.createContainer(ctx, drv, threadNum, i); err != nil {
+			// there is no container to keep alive or tear down
+			notify(func(o Observer) { o.IterationDone(benchName, threads) })
+			stats <- cb.createFailed(ctx, benchName, threadNum, threads, i, it.iterStart, commands, err)
+			continue
+		}
+		it.stats = cb.runCommands(ctx, drv, it.ctr, it.name, benchName, threadNum, threads, i, it.iterStart, setup)
+		raisePeak(&cb.peakLive, atomic.AddInt64(&cb.live, 1))
+		live = append(live, it)
+		if len(live) > cb.overlap {
+			retire(live[0])
+			live = live[1:]
+		}
+	}
+	// the containers still alive are torn down as the run winds down
+	for _, it := range live {
+		retire(it)
+	}
+	if err := drv.Close(cleanupContext(ctx)); err != nil {
+		log.Errorf("error on closing driver: %v", err)
+	}
+	close(stats)
+	cb.wg.Done()
+}
+
+// merge returns the statistics of an iteration whose commands ran in two
+// parts, the first of them s; as within a part, the timings of a command
+// run again replace the earlier ones while its errors add up
+func (s RunStatistics) merge(rest RunStatistics) RunStatistics {
+	mergeInts := func(into, from map[string]int, add bool) map[string]int {
+		if len(from) > 0 && into == nil {
+			into = make(map[string]int)
+		}
+		for k, v := range from {
+			if add {
+				v += into[k]
+			}
+			into[k] = v
+		}
+		return into
+	}
+	s.Durations = mergeInts(s.Durations, rest.Durations, false)
+	s.Errors = mergeInts(s.Errors, rest.Errors, true)
+	s.UserTimes = mergeInts(s.UserTimes, rest.UserTimes, false)
+	s.SysTimes = mergeInts(s.SysTimes, rest.SysTimes, false)
+	s.RunQueueMicros = mergeInts(s.RunQueueMicros, rest.RunQueueMicros, false)
+	s.Concurrency = mergeInts(s.Concurrency, rest.Concurrency, false)
+	s.Retries = mergeInts(s.Retries, rest.Retries, true)
+	for k, v := range rest.ErrorClasses {
+		if s.ErrorClasses == nil {
+			s.ErrorClasses = make(map[string]string)
+		}
+		s.ErrorClasses[k] = v
+	}
+	for k, v := range rest.Nanos {
+		if s.Nanos == nil {
+			s.Nanos = make(map[string]int64)
+		}
+		s.Nanos[k] = v
+	}
+	for k, v := range rest.spans {
+		if s.spans == nil {
+			s.spans = make(map[string]gcPause)
+		}
+		s.spans[k] = v
+	}
+	s.VerifyFailures += rest.VerifyFailures
+	return s
+}
@@ -0,0 +1,74 @@
+package benches
+
+import (
+	"sync"
+	"time"
+)
+
+// pauseGate allows a running benchmark to be paused between iterations. Threads
+// park at the start of their next iteration; any in-flight operation completes
+// normally so no sample spans the pause.
+type pauseGate struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	paused   bool
+	pausedAt time.Time
+	total    time.Duration
+}
+
+var gate = newPauseGate()
+
+func newPauseGate() *pauseGate {
+	g := &pauseGate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// Pause requests that all running benchmark threads stop before starting
+// their next iteration until Resume is called
+func Pause() {
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	if !gate.paused {
+		gate.paused = true
+		gate.pausedAt = time.Now()
+	}
+}
+
+// Resume releases threads parked by Pause
+func Resume() {
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	if gate.paused {
+		gate.paused = false
+		gate.total += time.Since(gate.pausedAt)
+		gate.cond.Broadcast()
+	}
+}
+
+// Paused returns whether benchmark execution is currently paused
+func Paused() bool {
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	return gate.paused
+}
+
+// wait blocks the calling thread while the benchmark is paused
+func (g *pauseGate) wait() {
+	g.mu.Lock()
+	for g.paused {
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+}
+
+// pausedTotal returns the total time spent paused, including a pause
+// which is still in progress
+func (g *pauseGate) pausedTotal() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return g.total + time.Since(g.pausedAt)
+	}
+	return g.total
+}
@@ -0,0 +1,114 @@
+package benches
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// PreflightConfig holds the free resources a benchmark requires, checked
+// before anything runs; zero thresholds are not checked
+type PreflightConfig struct {
+	// MinDiskGB is the free disk space required in the data root of each
+	// driver's engine
+	MinDiskGB float64 `yaml:"minDiskGB"`
+	// MinMemoryMB is the memory required to be available
+	MinMemoryMB float64 `yaml:"minMemoryMB"`
+	// MinOpenFiles is the open files limit required of bucketbench and of
+	// the engine daemons
+	MinOpenFiles uint64 `yaml:"minOpenFiles"`
+	// MinPids is the number of processes and threads required to be
+	// possible on the host
+	MinPids uint64 `yaml:"minPids"`
+}
+
+// Preflight checks the free resources of the host against the preflight
+// thresholds of the benchmark, so a benchmark which would run out of disk,
+// memory, files or pids fails up front with guidance rather than mid-run.
+// A resource which cannot be measured on the host is skipped with a warning.
+func Preflight(benchmark Benchmark) error {
+	config := benchmark.Preflight
+	if config == nil {
+		return nil
+	}
+	var failures []string
+	if config.MinDiskGB > 0 {
+		roots := make(map[string][]string)
+		for _, entry := range benchmark.Drivers {
+			dtype, err := entry.DriverType()
+			if err != nil {
+				continue
+			}
+			root := entry.DataRoot
+			if root == "" {
+				root = driver.DataRoot(dtype)
+			}
+			if root != "" {
+				roots[root] = append(roots[root], entry.Type)
+			}
+		}
+		var paths []string
+		for path := range roots {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			free, err := utils.FreeDisk(path)
+			if err != nil {
+				log.Warnf("Preflight: skipping the free disk check of %s: %v", path, err)
+				continue
+			}
+			if gb := float64(free) / (1 << 30); gb < config.MinDiskGB {
+				failures = append(failures, fmt.Sprintf("only %.1f GB free in %s (data root of %s), %g GB required; prune unused images and containers or move the data root to a larger filesystem (set dataRoot on the driver if it is not the default)",
+					gb, path, strings.Join(roots[path], ", "), config.MinDiskGB))
+			}
+		}
+	}
+	if config.MinMemoryMB > 0 {
+		if free, err := utils.FreeMemory(); err != nil {
+			log.Warnf("Preflight: skipping the free memory check: %v", err)
+		} else if mb := float64(free) / (1 << 20); mb < config.MinMemoryMB {
+			failures = append(failures, fmt.Sprintf("only %.0f MB of memory available, %.0f MB required; stop other workloads or lower the thread counts", mb, config.MinMemoryMB))
+		}
+	}
+	if config.MinOpenFiles > 0 {
+		if limit, err := utils.OpenFilesLimit(0); err != nil {
+			log.Warnf("Preflight: skipping the open files check: %v", err)
+		} else if limit < config.MinOpenFiles {
+			failures = append(failures, fmt.Sprintf("bucketbench may open %d files, %d required; raise the limit with `ulimit -n %d`", limit, config.MinOpenFiles, config.MinOpenFiles))
+		}
+		checked := make(map[int]bool)
+		for _, entry := range benchmark.Drivers {
+			dtype, err := entry.DriverType()
+			if err != nil {
+				continue
+			}
+			for _, name := range driver.DaemonProcesses(dtype) {
+				for _, pid := range utils.PidsOf(name) {
+					if checked[pid] {
+						continue
+					}
+					checked[pid] = true
+					if limit, err := utils.OpenFilesLimit(pid); err == nil && limit < config.MinOpenFiles {
+						failures = append(failures, fmt.Sprintf("the %s daemon (pid %d) may open %d files, %d required; raise LimitNOFILE= of its service", name, pid, limit, config.MinOpenFiles))
+					}
+				}
+			}
+		}
+	}
+	if config.MinPids > 0 {
+		if limit, source, err := utils.PidsLimit(); err != nil {
+			log.Warnf("Preflight: skipping the pids check: %v", err)
+		} else if limit < config.MinPids {
+			failures = append(failures, fmt.Sprintf("only %d processes and threads are possible (%s), %d required; raise the limit in %s", limit, source, config.MinPids, source))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("Preflight check failed:\n  %s", strings.Join(failures, "\n  "))
+	}
+	return nil
+}
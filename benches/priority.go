@@ -0,0 +1,194 @@
+package benches
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+)
+
+// Priority holds the CPU and IO priority of a set of processes; settings
+// which are not set are left unchanged
+type Priority struct {
+	// Nice is the nice value, from -20 (highest priority) to 19
+	Nice *int `json:"nice,omitempty"`
+	// IOClass is the IO scheduling class: realtime, best-effort or idle
+	IOClass string `yaml:"ioClass" json:"ioClass,omitempty"`
+	// IOLevel is the priority within the realtime and best-effort IO
+	// classes, from 0 (highest) to 7
+	IOLevel *int `yaml:"ioLevel" json:"ioLevel,omitempty"`
+	// Policy is the CPU scheduling policy: other, batch or idle
+	Policy string `json:"policy,omitempty"`
+}
+
+// PriorityConfig holds the priorities of the harness, the engine daemons and
+// the container workloads, set independently so the perturbation of the
+// measurements can be controlled
+type PriorityConfig struct {
+	Harness  *Priority `json:"harness,omitempty"`
+	Daemon   *Priority `json:"daemon,omitempty"`
+	Workload *Priority `json:"workload,omitempty"`
+}
+
+var (
+	ioClasses = map[string]int{
+		"realtime":    utils.IOClassRealtime,
+		"best-effort": utils.IOClassBestEffort,
+		"idle":        utils.IOClassIdle,
+	}
+	schedPolicies = map[string]int{
+		"other": utils.SchedOther,
+		"batch": utils.SchedBatch,
+		"idle":  utils.SchedIdle,
+	}
+)
+
+// validate checks the priority settings of the named processes
+func (p *Priority) validate(name string) error {
+	if p.Nice != nil && (*p.Nice < -20 || *p.Nice > 19) {
+		return fmt.Errorf("Invalid %s nice value %d: must be between -20 and 19", name, *p.Nice)
+	}
+	if _, ok := ioClasses[p.IOClass]; p.IOClass != "" && !ok {
+		return fmt.Errorf("Invalid %s ioClass %q: use realtime, best-effort or idle", name, p.IOClass)
+	}
+	if p.IOLevel != nil {
+		if *p.IOLevel < 0 || *p.IOLevel > 7 {
+			return fmt.Errorf("Invalid %s ioLevel %d: must be between 0 and 7", name, *p.IOLevel)
+		}
+		if p.IOClass != "realtime" && p.IOClass != "best-effort" {
+			return fmt.Errorf("The %s ioLevel requires the realtime or best-effort ioClass", name)
+		}
+	}
+	if _, ok := schedPolicies[p.Policy]; p.Policy != "" && !ok {
+		return fmt.Errorf("Invalid %s policy %q: use other, batch or idle", name, p.Policy)
+	}
+	return nil
+}
+
+// Validate checks the priority settings
+func (c *PriorityConfig) Validate() error {
+	for name, p := range map[string]*Priority{"harness": c.Harness, "daemon": c.Daemon, "workload": c.Workload} {
+		if p == nil {
+			continue
+		}
+		if err := p.validate(name); err != nil {
+			return err
+		}
+	}
+	if c.Workload != nil && c.Workload.Policy != "" {
+		return fmt.Errorf("The workload policy is not supported; use nice, ioClass and ioLevel")
+	}
+	return nil
+}
+
+// apply sets the priority of a task and returns its previous priority
+func (p *Priority) apply(tid int) (utils.TaskPriority, error) {
+	current, err := utils.GetTaskPriority(tid)
+	if err != nil {
+		return current, err
+	}
+	next := current
+	if p.Nice != nil {
+		next.Nice = *p.Nice
+	}
+	if p.IOClass != "" {
+		next.IOClass, next.IOLevel = ioClasses[p.IOClass], 0
+		if p.IOClass != "idle" {
+			// the default level of the realtime and best-effort classes
+			next.IOLevel = 4
+		}
+	}
+	if p.IOLevel != nil {
+		next.IOLevel = *p.IOLevel
+	}
+	if p.Policy != "" {
+		next.Policy = schedPolicies[p.Policy]
+	}
+	return current, utils.SetTaskPriority(tid, next)
+}
+
+// ApplyHarnessPriority sets the priority of bucketbench itself; the engine
+// clients it runs inherit it
+func ApplyHarnessPriority(benchmark Benchmark) error {
+	if benchmark.Priority == nil {
+		return nil
+	}
+	if err := benchmark.Priority.Validate(); err != nil {
+		return err
+	}
+	if benchmark.Priority.Harness == nil {
+		return nil
+	}
+	// priorities are per thread; threads started later inherit them
+	for _, tid := range utils.TasksOf(os.Getpid()) {
+		if _, err := benchmark.Priority.Harness.apply(tid); err != nil {
+			return fmt.Errorf("Error setting the harness priority: %v", err)
+		}
+	}
+	return nil
+}
+
+var (
+	priorityMu sync.Mutex
+	// daemonPriorities holds the original priorities of the daemon tasks
+	// whose priority was set, to restore them after the benchmark
+	daemonPriorities = make(map[int]utils.TaskPriority)
+)
+
+// ApplyDaemonPriority sets the priority of the engine daemons of a driver
+// type; as a daemon may have been restarted, it is set before every run.
+// Daemonless drivers are skipped.
+func ApplyDaemonPriority(benchmark Benchmark, dtype driver.Type) error {
+	if benchmark.Priority == nil || benchmark.Priority.Daemon == nil {
+		return nil
+	}
+	pids := daemonPids(dtype)
+	if len(pids) == 0 {
+		return skipped(benchmark.Strict, "No daemon processes found for the %s driver; the daemon priority is not set", driver.TypeToString(dtype))
+	}
+	priorityMu.Lock()
+	defer priorityMu.Unlock()
+	for _, pid := range pids {
+		for _, tid := range utils.TasksOf(pid) {
+			previous, err := benchmark.Priority.Daemon.apply(tid)
+			if err != nil {
+				return fmt.Errorf("Error setting the priority of daemon process %d: %v", pid, err)
+			}
+			if _, ok := daemonPriorities[tid]; !ok {
+				daemonPriorities[tid] = previous
+			}
+		}
+	}
+	return nil
+}
+
+// RestorePriorities restores the original priorities of the daemon tasks
+// whose priority was set; tasks which have exited are skipped
+func RestorePriorities() {
+	priorityMu.Lock()
+	defer priorityMu.Unlock()
+	for tid, previous := range daemonPriorities {
+		utils.SetTaskPriority(tid, previous)
+		delete(daemonPriorities, tid)
+	}
+}
+
+// workloadCommand wraps the command of the containers to run with the
+// workload priority, using the nice and ionice binaries of the image
+func workloadCommand(p *Priority, command string) string {
+	var prefix []string
+	if p.Nice != nil {
+		prefix = append(prefix, "nice", "-n", strconv.Itoa(*p.Nice))
+	}
+	if p.IOClass != "" {
+		prefix = append(prefix, "ionice", "-c", strconv.Itoa(ioClasses[p.IOClass]))
+		if p.IOLevel != nil {
+			prefix = append(prefix, "-n", strconv.Itoa(*p.IOLevel))
+		}
+	}
+	return strings.Join(append(prefix, command), " ")
+}
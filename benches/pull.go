@@ -0,0 +1,261 @@
+package benches
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// PullBench measures image pull latency and throughput of a driver for a list
+// of images. A "cold" pull first removes the image and its content, so all
+// layers are fetched from the registry; a "warm" pull finds the image and its
+// layers already present and only resolves the manifest.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type PullBench struct {
+	benchName    string
+	driver       driver.Driver
+	driverConfig driver.Config
+	images       []string
+	steps        []string
+	exact        bool
+	unpackMu     sync.Mutex
+	unpacks      map[string]driver.Unpack
+	stats        []RunStatistics
+	metrics      map[string]float64
+	elapsed      time.Duration
+	started      time.Time
+	state        State
+	wg           sync.WaitGroup
+}
+
+// Init initializes the benchmark
+func (pb *PullBench) Init(benchmark Benchmark, driverConfig DriverConfig, imageInfo string, trace bool) error {
+	driverType, err := driverConfig.DriverType()
+	if err != nil {
+		return err
+	}
+	steps, err := benchmark.PullSteps()
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		return fmt.Errorf("No images to pull; provide an 'images:' list in the benchmark YAML")
+	}
+	if benchmark.MaxSamples > 0 {
+		return fmt.Errorf("maxSamples is not supported by the pull benchmark")
+	}
+	if benchmark.Ramp != "" || benchmark.Overlap > 0 {
+		return fmt.Errorf("ramp and overlap are not supported by the pull benchmark")
+	}
+	if benchmark.Retries > 0 {
+		return fmt.Errorf("retries is not supported by the pull benchmark")
+	}
+	if benchmark.PinImageDigest {
+		return fmt.Errorf("pinImageDigest is not supported by the pull benchmark")
+	}
+	namePrefix, err := benchmark.NamePrefix()
+	if err != nil {
+		return err
+	}
+	config := driverConfig.Config()
+	config.NamePrefix = namePrefix
+	drv, err := driver.New(driverType, config)
+	if err != nil {
+		return fmt.Errorf("Error during driver initialization for PullBench: %v", err)
+	}
+	info, err := drv.Info(context.Background())
+	if err != nil {
+		return fmt.Errorf("Error during driver info query: %v", err)
+	}
+	log.Infof("Driver initialized: %s", info)
+	if !driver.SupportsImages(drv) {
+		return fmt.Errorf("Image pulls are not supported by the %s driver", driverConfig.Type)
+	}
+	pb.benchName = benchmark.Name
+	pb.driver = drv
+	pb.driverConfig = config
+	pb.images = benchmark.PullImages()
+	pb.steps = steps
+	pb.exact = benchmark.Exact
+	return nil
+}
+
+// Validate pulls each image once, which verifies the images can be pulled and
+// leaves them present for the first warm pulls
+func (pb *PullBench) Validate(ctx context.Context) error {
+	for _, image := range pb.images {
+		if err := pullLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		if out, _, err := pb.driver.PullImage(ctx, image); err != nil {
+			return fmt.Errorf("Driver validation: error pulling image %q: %v (output: %s)", image, err, out)
+		}
+	}
+	return nil
+}
+
+// Run executes the benchmark iterations against a specific engine driver type
+// for a specified number of iterations; each iteration performs every pull step
+// in order. The commands list is not used.
+func (pb *PullBench) Run(ctx context.Context, threads, iterations int, commands []string) error {
+	log.Infof("Start PullBench run: threads (%d); iterations (%d)", threads, iterations)
+	statChan := make([]chan RunStatistics, threads)
+	for i := range statChan {
+		statChan[i] = make(chan RunStatistics, iterations)
+	}
+	pb.metrics = make(map[string]float64)
+	pb.unpacks = make(map[string]driver.Unpack)
+	pb.state = Running
+	start := time.Now()
+	pb.started = start
+	pausedStart := gate.pausedTotal()
+	for i := 0; i < threads; i++ {
+		drv, err := driver.New(pb.driver.Type(), pb.driverConfig)
+		if err != nil {
+			return fmt.Errorf("error creating new driver for thread %d: %v", i, err)
+		}
+		pb.wg.Add(1)
+		go pb.runThread(ctx, drv, i, threads, iterations, statChan[i])
+	}
+	pb.wg.Wait()
+	pb.elapsed = time.Since(start) - (gate.pausedTotal() - pausedStart)
+
+	log.Infof("PullBench threads complete in %v time elapsed", pb.elapsed)
+	for _, ch := range statChan {
+		for statEntry := range ch {
+			pb.stats = append(pb.stats, statEntry)
+		}
+	}
+	// an interrupted run's rates cover the iterations it completed
+	completed := len(pb.stats)
+	pb.metrics["pulls/sec"] = float64(completed*len(pb.steps)) / pb.elapsed.Seconds()
+	for codec, unpack := range pb.unpacks {
+		pb.metrics["unpack MB/s "+codec] = float64(unpack.Bytes) / 1e6 / unpack.Duration.Seconds()
+	}
+	rate := float64(completed) / pb.elapsed.Seconds()
+	notify(func(o Observer) { o.RunDone(pb.Info(), threads, rate, pb.metrics) })
+	pb.state = Completed
+	return ctx.Err()
+}
+
+func (pb *PullBench) runThread(ctx context.Context, drv driver.Driver, threadNum, threads, iterations int, stats chan RunStatistics) {
+	benchName := pb.Info()
+	for i := 0; i < iterations && ctx.Err() == nil; i++ {
+		gate.wait()
+		iterStart := time.Since(pb.started)
+		errors := make(map[string]int)
+		errorClasses := make(map[string]string)
+		durations := make(map[string]int)
+		var nanos map[string]int64
+		if pb.exact {
+			nanos = make(map[string]int64)
+		}
+		for _, step := range pb.steps {
+			parts := strings.SplitN(step, " ", 2)
+			scenario, image := parts[0], parts[1]
+			if scenario == PullCold {
+				// untimed; with more than one thread another thread may
+				// re-pull the image before this thread's pull starts
+				if err := drv.RemoveImage(ctx, image); err != nil {
+					log.Warnf("Error removing image %q before cold pull: %v", image, err)
+				}
+			}
+			notifyOpStart(benchName, threads, threadNum, i, step)
+			var exact time.Duration
+			out, elapsed, err := drv.PullImage(utils.WithExact(ctx, &exact), image)
+			if nanos != nil {
+				nanos[step] = exactNanos(exact, elapsed, err)
+			}
+			if err != nil {
+				class := driver.ClassifyError(err, out)
+				errors[step]++
+				errorClasses[step] = class
+				log.Warnf("Error during %s pull of %q (%s): %v\n  Output: %s", scenario, image, class, err, out)
+			} else if u, ok := drv.(unpackReporter); ok && scenario == PullCold {
+				// warm pulls find the layers already unpacked
+				pb.addUnpack(u.LastUnpack())
+			}
+			durations[step] = elapsed
+			notify(func(o Observer) { o.OpDone(benchName, threads, step, elapsed, err != nil) })
+		}
+		notify(func(o Observer) { o.IterationDone(benchName, threads) })
+		stats <- RunStatistics{
+			Thread:       threadNum,
+			Iteration:    i,
+			Start:        utils.Ms(iterStart),
+			Durations:    durations,
+			Errors:       errors,
+			Nanos:        nanos,
+			ErrorClasses: errorClasses,
+		}
+	}
+	if err := drv.Close(cleanupContext(ctx)); err != nil {
+		log.Errorf("error on closing driver: %v", err)
+	}
+	close(stats)
+	pb.wg.Done()
+}
+
+// addUnpack adds the unpacking of a cold pull to the totals of its codec
+func (pb *PullBench) addUnpack(unpack driver.Unpack) {
+	if unpack.Bytes == 0 || unpack.Duration <= 0 {
+		return
+	}
+	pb.unpackMu.Lock()
+	defer pb.unpackMu.Unlock()
+	total := pb.unpacks[unpack.Codec]
+	total.Bytes += unpack.Bytes
+	total.Duration += unpack.Duration
+	pb.unpacks[unpack.Codec] = total
+}
+
+// Metrics returns the pull throughput of the benchmark run
+func (pb *PullBench) Metrics() map[string]float64 {
+	if pb.state == Completed {
+		return pb.metrics
+	}
+	return nil
+}
+
+// Stats returns the statistics of the benchmark run
+func (pb *PullBench) Stats() []RunStatistics {
+	if pb.state == Completed {
+		return pb.stats
+	}
+	return []RunStatistics{}
+}
+
+// State returns Created, Running, or Completed
+func (pb *PullBench) State() State {
+	return pb.state
+}
+
+// Elapsed returns the time.Duration taken to run the benchmark
+func (pb *PullBench) Elapsed() time.Duration {
+	return pb.elapsed
+}
+
+// Close closes the driver the benchmark was initialized with
+func (pb *PullBench) Close() error {
+	if pb.driver == nil {
+		return nil
+	}
+	return pb.driver.Close(context.Background())
+}
+
+// Type returns the type of benchmark
+func (pb *PullBench) Type() Type {
+	return Pull
+}
+
+// Info returns a string with the driver type and benchmark name
+func (pb *PullBench) Info() string {
+	return pb.benchName + ":" + driverName(pb.driver) + configLabel(pb.driverConfig)
+}
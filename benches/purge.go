@@ -0,0 +1,119 @@
+package benches
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// purgeBarrier removes the image between the iterations of a run with
+// purgeImageBetweenIterations. The threads of the run meet at the barrier
+// before each iteration and the last of them to arrive removes the image, so
+// it is never removed while the container of another thread's iteration uses
+// it; a thread which leaves the run no longer holds the others up.
+type purgeBarrier struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	image   string
+	threads int
+	arrived int
+	round   int
+	// opContext bounds the removal by the operation timeout of the run
+	opContext func(context.Context) (context.Context, context.CancelFunc)
+}
+
+// newPurgeBarrier creates the barrier of a run of threads threads purging
+// image, with the removal bounded by the contexts opContext returns
+func newPurgeBarrier(image string, threads int, opContext func(context.Context) (context.Context, context.CancelFunc)) *purgeBarrier {
+	p := &purgeBarrier{image: image, threads: threads, opContext: opContext}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// wait blocks until every thread still in the run has finished its previous
+// iteration and the image has been removed
+func (p *purgeBarrier) wait(ctx context.Context, drv driver.Driver) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.arrived++
+	if p.arrived == p.threads {
+		p.purge(ctx, drv)
+		return
+	}
+	for round := p.round; round == p.round; {
+		p.cond.Wait()
+	}
+}
+
+// leave removes a thread from the run; if the other threads were waiting only
+// for it, the image is removed and they are released
+func (p *purgeBarrier) leave(ctx context.Context, drv driver.Driver) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.threads--
+	if p.arrived > 0 && p.arrived == p.threads {
+		p.purge(ctx, drv)
+	}
+}
+
+// purge removes the image and releases the waiting threads; the caller holds
+// the lock. Once ctx is canceled the run is ending, and the threads are
+// released without removing the image.
+func (p *purgeBarrier) purge(ctx context.Context, drv driver.Driver) {
+	if ctx.Err() == nil {
+		opCtx, cancel := p.opContext(ctx)
+		if err := drv.RemoveImage(opCtx, p.image); err != nil {
+			log.Warnf("Error purging image %q: %v", p.image, err)
+		}
+		cancel()
+	}
+	p.arrived = 0
+	p.round++
+	p.cond.Broadcast()
+}
+
+// coldPull waits at the purge barrier and pulls the image again, timed as the
+// pull step of the iteration, so the container of a cold-start iteration is
+// not created from an image the engine pulled untimed. It returns nil unless
+// purgeImageBetweenIterations is set.
+func (cb *CustomBench) coldPull(ctx context.Context, drv driver.Driver, name, benchName string, threadNum, threads, i int) *RunStatistics {
+	if cb.purge == nil {
+		return nil
+	}
+	cb.purge.wait(ctx, drv)
+	stats := &RunStatistics{
+		Thread:       threadNum,
+		Iteration:    i,
+		Start:        utils.ElapsedMs(cb.started),
+		Durations:    make(map[string]int),
+		Errors:       make(map[string]int),
+		ErrorClasses: make(map[string]string),
+	}
+	notifyOpStart(benchName, threads, threadNum, i, phasePull)
+	spanCtx, span := startSpan(ctx, phasePull, name)
+	var exact time.Duration
+	opCtx, cancel := cb.opContext(utils.WithExact(spanCtx, &exact))
+	out, elapsed, err := drv.PullImage(opCtx, cb.imageInfo)
+	timedOut := opCtx.Err() == context.DeadlineExceeded
+	cancel()
+	endSpan(span, err)
+	stats.Durations[phasePull] = elapsed
+	if cb.exact {
+		stats.Nanos = map[string]int64{phasePull: exactNanos(exact, elapsed, err)}
+	}
+	if err != nil {
+		class := driver.ClassifyError(err, out)
+		if timedOut {
+			class = driver.ErrorTimeout
+		}
+		stats.Errors[phasePull]++
+		stats.ErrorClasses[phasePull] = class
+		log.Warnf("Error pulling image %q before iteration %d (%s): %v\n  Output: %s", cb.imageInfo, i, class, err, out)
+	}
+	notify(func(o Observer) { o.OpDone(benchName, threads, phasePull, elapsed, err != nil) })
+	return stats
+}
@@ -0,0 +1,27 @@
+package benches
+
+import (
+	"fmt"
+
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+)
+
+// pullLimiter paces the untimed pulls preparing a run; nil when unlimited
+var pullLimiter *utils.RateLimiter
+
+// ApplyRateLimits sets the rate limits of the container removals of the
+// driver cleanups and of the pulls preparing the runs of a benchmark, so
+// setting up or tearing down thousands of containers does not destabilize
+// the engine right before or after a measurement
+func ApplyRateLimits(benchmark Benchmark) error {
+	if benchmark.CleanRate < 0 {
+		return fmt.Errorf("Invalid cleanRate %v: must be a positive number of removals per second", benchmark.CleanRate)
+	}
+	if benchmark.PullRate < 0 {
+		return fmt.Errorf("Invalid pullRate %v: must be a positive number of pulls per second", benchmark.PullRate)
+	}
+	driver.SetCleanRate(benchmark.CleanRate)
+	pullLimiter = utils.NewRateLimiter(benchmark.PullRate)
+	return nil
+}
@@ -0,0 +1,286 @@
+package benches
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// digestCompression bounds the number of t-digest centroids; higher values
+// are more accurate, in particular for the middle quantiles
+const digestCompression = 100
+
+// StepSummary holds the statistics of one step over all iterations of a
+// sampled run; timings are in milliseconds, quantiles are estimates
+type StepSummary struct {
+	Count  int
+	Errors int
+	// ErrorClasses counts the errors by class, and Retries the retries
+	ErrorClasses map[string]int
+	Retries      int
+	Min          float64
+	Max          float64
+	Mean         float64
+	Stddev       float64
+	Median       float64
+	P90          float64
+	P95          float64
+	P99          float64
+	UserAvg      float64
+	SysAvg       float64
+	RunQueueAvg  float64
+}
+
+// Sampler bounds the memory used by the statistics of long, high-rate runs.
+// Every iteration is folded into streaming summaries of its steps, with
+// quantiles estimated by a t-digest, while only a uniform random sample of at
+// most size iterations (a reservoir) is kept for the raw timings. It is safe
+// for concurrent use.
+type Sampler struct {
+	mu        sync.Mutex
+	size      int
+	seen      int
+	reservoir []RunStatistics
+	steps     map[string]*stepStream
+	rand      *rand.Rand
+}
+
+// NewSampler creates a sampler keeping at most size iterations
+func NewSampler(size int) *Sampler {
+	return &Sampler{
+		size:  size,
+		steps: make(map[string]*stepStream),
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Add folds the statistics of an iteration into the summaries and the reservoir
+func (s *Sampler) Add(stat RunStatistics) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for step, ms := range stat.Durations {
+		value := float64(ms)
+		if nanos, ok := stat.Nanos[step]; ok {
+			value = float64(nanos) / 1e6
+		}
+		stream, ok := s.steps[step]
+		if !ok {
+			stream = &stepStream{digest: newTDigest(digestCompression)}
+			s.steps[step] = stream
+		}
+		stream.add(value)
+		stream.errors += stat.Errors[step]
+		stream.retries += stat.Retries[step]
+		if class, ok := stat.ErrorClasses[step]; ok {
+			if stream.classes == nil {
+				stream.classes = make(map[string]int)
+			}
+			stream.classes[class]++
+		}
+		if user, ok := stat.UserTimes[step]; ok {
+			stream.usage++
+			stream.userSum += float64(user)
+			stream.sysSum += float64(stat.SysTimes[step])
+		}
+		if micros, ok := stat.RunQueueMicros[step]; ok {
+			stream.runQueue++
+			stream.runQueueSum += float64(micros) / 1000
+		}
+	}
+	// reservoir sampling (algorithm R): the n-th iteration replaces a random
+	// kept one with probability size/n
+	s.seen++
+	if len(s.reservoir) < s.size {
+		s.reservoir = append(s.reservoir, stat)
+	} else if j := s.rand.Intn(s.seen); j < s.size {
+		s.reservoir[j] = stat
+	}
+}
+
+// Seen returns the number of iterations added
+func (s *Sampler) Seen() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen
+}
+
+// Reservoir returns the sampled iterations, in thread and iteration order
+func (s *Sampler) Reservoir() []RunStatistics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sample := append([]RunStatistics(nil), s.reservoir...)
+	sort.Slice(sample, func(i, j int) bool {
+		if sample[i].Thread != sample[j].Thread {
+			return sample[i].Thread < sample[j].Thread
+		}
+		return sample[i].Iteration < sample[j].Iteration
+	})
+	return sample
+}
+
+// Summaries returns the statistics of each step over every added iteration
+func (s *Sampler) Summaries() map[string]StepSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summaries := make(map[string]StepSummary)
+	for step, stream := range s.steps {
+		summary := StepSummary{
+			Count:        stream.count,
+			Errors:       stream.errors,
+			ErrorClasses: stream.classes,
+			Retries:      stream.retries,
+			Min:          stream.min,
+			Max:          stream.max,
+			Mean:         stream.mean,
+			Stddev:       math.Sqrt(stream.m2 / float64(stream.count)),
+			Median:       stream.digest.quantile(0.5),
+			P90:          stream.digest.quantile(0.9),
+			P95:          stream.digest.quantile(0.95),
+			P99:          stream.digest.quantile(0.99),
+		}
+		if stream.usage > 0 {
+			summary.UserAvg = stream.userSum / float64(stream.usage)
+			summary.SysAvg = stream.sysSum / float64(stream.usage)
+		}
+		if stream.runQueue > 0 {
+			summary.RunQueueAvg = stream.runQueueSum / float64(stream.runQueue)
+		}
+		summaries[step] = summary
+	}
+	return summaries
+}
+
+// stepStream accumulates the durations of a step in constant memory; the mean
+// and variance are computed exactly with Welford's algorithm
+type stepStream struct {
+	count   int
+	errors  int
+	classes map[string]int
+	retries int
+	min     float64
+	max     float64
+	mean    float64
+	m2      float64
+	usage   int
+	userSum float64
+	sysSum  float64
+	// runQueue counts the samples of the run queue delay in runQueueSum
+	runQueue    int
+	runQueueSum float64
+	digest      *tdigest
+}
+
+func (s *stepStream) add(value float64) {
+	if s.count == 0 || value < s.min {
+		s.min = value
+	}
+	if s.count == 0 || value > s.max {
+		s.max = value
+	}
+	s.count++
+	delta := value - s.mean
+	s.mean += delta / float64(s.count)
+	s.m2 += delta * (value - s.mean)
+	s.digest.add(value)
+}
+
+// tdigest is a merging t-digest (Dunning & Ertl) estimating quantiles from
+// a bounded number of centroids, which are smallest (most accurate) near the
+// tails where the interesting percentiles are
+type tdigest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []centroid
+	count       float64
+	min         float64
+	max         float64
+}
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+func newTDigest(compression float64) *tdigest {
+	return &tdigest{compression: compression}
+}
+
+func (t *tdigest) add(value float64) {
+	if t.count == 0 || value < t.min {
+		t.min = value
+	}
+	if t.count == 0 || value > t.max {
+		t.max = value
+	}
+	t.buffer = append(t.buffer, centroid{mean: value, weight: 1})
+	t.count++
+	if float64(len(t.buffer)) >= 5*t.compression {
+		t.compress()
+	}
+}
+
+// scale is the k1 scale function mapping a quantile to the centroid index
+// space; adjacent centroids are merged while they span at most one unit
+func (t *tdigest) scale(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// compress merges the buffered values into the centroids
+func (t *tdigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := make([]centroid, 0, len(t.centroids)+len(t.buffer))
+	all = append(all, t.centroids...)
+	all = append(all, t.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	current := all[0]
+	var weightSoFar float64
+	kLow := t.scale(0)
+	for _, c := range all[1:] {
+		q := (weightSoFar + current.weight + c.weight) / t.count
+		if t.scale(q)-kLow <= 1 {
+			current.weight += c.weight
+			current.mean += (c.mean - current.mean) * c.weight / current.weight
+			continue
+		}
+		weightSoFar += current.weight
+		merged = append(merged, current)
+		kLow = t.scale(weightSoFar / t.count)
+		current = c
+	}
+	t.centroids = append(merged, current)
+	t.buffer = t.buffer[:0]
+}
+
+// quantile estimates the value at quantile q (0..1), interpolating between
+// the centers of adjacent centroids
+func (t *tdigest) quantile(q float64) float64 {
+	t.compress()
+	if len(t.centroids) == 0 {
+		return 0
+	}
+	if len(t.centroids) == 1 {
+		return t.centroids[0].mean
+	}
+	target := q * t.count
+	var cumulative float64
+	for i, c := range t.centroids {
+		center := cumulative + c.weight/2
+		if target < center {
+			if i == 0 {
+				return t.min + (c.mean-t.min)*target/center
+			}
+			prev := t.centroids[i-1]
+			prevCenter := cumulative - prev.weight/2
+			return prev.mean + (c.mean-prev.mean)*(target-prevCenter)/(center-prevCenter)
+		}
+		cumulative += c.weight
+	}
+	last := t.centroids[len(t.centroids)-1]
+	lastCenter := t.count - last.weight/2
+	return last.mean + (t.max-last.mean)*(target-lastCenter)/(t.count-lastCenter)
+}
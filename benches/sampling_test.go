@@ -0,0 +1,123 @@
+package benches
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTDigestQuantiles(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name   string
+		values func(n int) []float64
+	}{
+		{"uniform", func(n int) []float64 {
+			values := make([]float64, n)
+			for i := range values {
+				values[i] = r.Float64() * 100
+			}
+			return values
+		}},
+		{"ascending", func(n int) []float64 {
+			values := make([]float64, n)
+			for i := range values {
+				values[i] = float64(i)
+			}
+			return values
+		}},
+		{"exponential", func(n int) []float64 {
+			values := make([]float64, n)
+			for i := range values {
+				values[i] = r.ExpFloat64() * 20
+			}
+			return values
+		}},
+		{"bimodal", func(n int) []float64 {
+			// fast operations with a slow tail, as with cold starts
+			values := make([]float64, n)
+			for i := range values {
+				values[i] = 10 + r.NormFloat64()
+				if r.Intn(20) == 0 {
+					values[i] = 500 + 50*r.NormFloat64()
+				}
+			}
+			return values
+		}},
+		{"constant", func(n int) []float64 {
+			values := make([]float64, n)
+			for i := range values {
+				values[i] = 42
+			}
+			return values
+		}},
+	}
+	// the estimate must fall between the exact percentiles this many ranks
+	// (as a fraction of the sample) around the quantile
+	const rankError = 0.01
+	for _, tt := range tests {
+		for _, n := range []int{1000, 100000} {
+			values := tt.values(n)
+			digest := newTDigest(digestCompression)
+			for _, v := range values {
+				digest.add(v)
+			}
+			sort.Float64s(values)
+			for _, q := range []float64{0.5, 0.9, 0.95, 0.99} {
+				got := digest.quantile(q)
+				low := values[int(math.Max(0, math.Floor((q-rankError)*float64(n))))]
+				high := values[int(math.Min(float64(n-1), math.Ceil((q+rankError)*float64(n))))]
+				if got < low || got > high {
+					t.Errorf("%s, %d values: quantile(%v) = %v, want within [%v, %v] (exact %v)", tt.name, n, q, got, low, high, values[int(q*float64(n))])
+				}
+			}
+		}
+	}
+}
+
+func TestTDigestSmallSample(t *testing.T) {
+	// with fewer values than centroids, the quantiles interpolate between
+	// the values as exact percentiles do
+	digest := newTDigest(digestCompression)
+	for v := 1; v <= 10; v++ {
+		digest.add(float64(v))
+	}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0.5, 5.5},
+		{0.25, 3},
+		{0.75, 8},
+	}
+	for _, tt := range tests {
+		if got := digest.quantile(tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestSamplerSummaries(t *testing.T) {
+	sampler := NewSampler(10)
+	for i := 1; i <= 1000; i++ {
+		sampler.Add(RunStatistics{
+			Iteration: i,
+			Durations: map[string]int{"run": i},
+			Errors:    map[string]int{},
+		})
+	}
+	if got := sampler.Seen(); got != 1000 {
+		t.Errorf("Seen() = %d, want 1000", got)
+	}
+	if got := len(sampler.Reservoir()); got != 10 {
+		t.Errorf("len(Reservoir()) = %d, want 10", got)
+	}
+	summary := sampler.Summaries()["run"]
+	if summary.Count != 1000 || summary.Min != 1 || summary.Max != 1000 || summary.Mean != 500.5 {
+		t.Errorf("Summaries() = count %d, min %v, max %v, mean %v; want 1000, 1, 1000, 500.5", summary.Count, summary.Min, summary.Max, summary.Mean)
+	}
+	if math.Abs(summary.Median-500.5) > 10 || math.Abs(summary.P99-990) > 10 {
+		t.Errorf("Summaries() = median %v, p99 %v; want about 500.5 and 990", summary.Median, summary.P99)
+	}
+}
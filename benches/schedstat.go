@@ -0,0 +1,37 @@
+package benches
+
+import (
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+)
+
+// initSchedDelay resolves the engine daemon processes whose run queue delay
+// is sampled around each operation of a run with schedDelay; the daemons may
+// have been restarted since the previous run
+func (cb *CustomBench) initSchedDelay() error {
+	cb.schedPids = nil
+	if !cb.schedDelay {
+		return nil
+	}
+	pids := daemonPids(cb.driver.Type())
+	if len(pids) == 0 {
+		return skipped(cb.strict, "schedDelay: no engine daemon of the %s driver is running; the scheduling delay is not recorded", driver.TypeToString(cb.driver.Type()))
+	}
+	if _, err := utils.RunQueueDelay(pids); err != nil {
+		return skipped(cb.strict, "schedDelay: cannot sample the scheduling delay of the engine daemons: %v", err)
+	}
+	cb.schedPids = pids
+	return nil
+}
+
+// runQueueDelay returns the run queue delay of the engine daemons so far, and
+// whether it is sampled
+func (cb *CustomBench) runQueueDelay() (time.Duration, bool) {
+	if cb.schedPids == nil {
+		return 0, false
+	}
+	delay, err := utils.RunQueueDelay(cb.schedPids)
+	return delay, err == nil
+}
@@ -0,0 +1,123 @@
+package benches
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/estesp/bucketbench/driver"
+)
+
+// canonical lifecycle operations; the YAML command list also accepts aliases
+const (
+	opRun     = "run"
+	opStop    = "stop"
+	opRemove  = "remove"
+	opPause   = "pause"
+	opUnpause = "unpause"
+	opExec    = "exec"
+	opWait    = "wait"
+	opLogs    = "logs"
+	// opCheckpoint stops the container into a CRIU checkpoint, from which
+	// opRestore runs it again
+	opCheckpoint = "checkpoint"
+	opRestore    = "restore"
+	// opVerify runs the untimed checks of the verify YAML section
+	opVerify = "verify"
+)
+
+// container states tracked while validating a command sequence
+const (
+	ctrCreated = "created"
+	ctrRunning = "running"
+	ctrPaused  = "paused"
+	// the container is stopped into a checkpoint, which only restore uses
+	ctrCheckpointed = "checkpointed"
+	ctrStopped      = "stopped"
+	ctrExited       = "exited"
+	ctrRemoved      = "removed"
+)
+
+// transitions maps each container state to the operations valid in that
+// state and the state that results. Create only records metadata in every
+// driver, so nothing exists in the runtime until the container is run.
+var transitions = map[string]map[string]string{
+	ctrCreated:      {opRun: ctrRunning},
+	ctrRunning:      {opStop: ctrStopped, opPause: ctrPaused, opExec: ctrRunning, opWait: ctrExited, opLogs: ctrRunning, opVerify: ctrRunning, opCheckpoint: ctrCheckpointed},
+	ctrPaused:       {opUnpause: ctrRunning, opStop: ctrStopped},
+	ctrCheckpointed: {opRestore: ctrRunning},
+	ctrStopped:      {opRemove: ctrRemoved, opLogs: ctrStopped, opVerify: ctrStopped},
+	ctrExited:       {opRemove: ctrRemoved, opLogs: ctrExited, opVerify: ctrExited},
+	ctrRemoved:      {},
+}
+
+// CanonicalCommand maps a YAML command (or one of its aliases) to its
+// lifecycle operation, or returns an empty string if unrecognized
+func CanonicalCommand(cmd string) string {
+	switch strings.ToLower(cmd) {
+	case "run", "start":
+		return opRun
+	case "stop", "kill":
+		return opStop
+	case "remove", "erase", "delete":
+		return opRemove
+	case "pause":
+		return opPause
+	case "unpause", "resume":
+		return opUnpause
+	case "exec":
+		return opExec
+	case "wait":
+		return opWait
+	case "logs":
+		return opLogs
+	case "verify":
+		return opVerify
+	case "checkpoint":
+		return opCheckpoint
+	case "restore":
+		return opRestore
+	default:
+		return ""
+	}
+}
+
+// ValidateCommands checks the command list of a benchmark against the container
+// lifecycle state machine for the given driver type, so that invalid sequences
+// (e.g. stop before run, unpause of a container which is not paused) are
+// reported up front rather than as runtime errors on every iteration
+func ValidateCommands(commands []string, dtype driver.Type) error {
+	if len(commands) == 0 {
+		return fmt.Errorf("no commands listed")
+	}
+	state := ctrCreated
+	for i, cmd := range commands {
+		op := CanonicalCommand(cmd)
+		if op == "" {
+			return fmt.Errorf("command %d %q is not a recognized lifecycle command", i+1, cmd)
+		}
+		if (op == opPause || op == opUnpause) && !driver.SupportsPause(dtype) ||
+			op == opExec && !driver.SupportsExec(dtype) ||
+			op == opWait && !driver.SupportsWait(dtype) ||
+			op == opLogs && !driver.SupportsLogs(dtype) ||
+			(op == opCheckpoint || op == opRestore) && !driver.SupportsCheckpoint(dtype) {
+			return fmt.Errorf("command %d %q is not supported by the %s driver", i+1, cmd, driver.TypeToString(dtype))
+		}
+		next, ok := transitions[state][op]
+		if !ok {
+			return fmt.Errorf("command %d %q is invalid when the container is %s", i+1, cmd, state)
+		}
+		state = next
+	}
+	return nil
+}
+
+// ValidateGenericCommands checks that the Generic driver has a command line
+// for every operation in the command list
+func ValidateGenericCommands(commands []string, templates driver.GenericTemplates) error {
+	for i, cmd := range commands {
+		if op := CanonicalCommand(cmd); op != opVerify && !templates.Has(op) {
+			return fmt.Errorf("command %d %q has no %s command line in the Generic driver templates", i+1, cmd, op)
+		}
+	}
+	return nil
+}
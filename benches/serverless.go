@@ -0,0 +1,189 @@
+package benches
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Phases of a serverless iteration, in order
+const (
+	phasePull   = "pull"
+	phaseStart  = "start"
+	phaseReady  = "ready"
+	phaseTask   = "task"
+	phaseRemove = "remove"
+	phaseTotal  = "total"
+)
+
+// ServerlessSteps are the steps reported by the serverless benchmark
+var ServerlessSteps = []string{phasePull, phaseStart, phaseReady, phaseTask, phaseRemove, phaseTotal}
+
+// readyPollInterval is the interval at which the ready command is retried
+const readyPollInterval = 10 * time.Millisecond
+
+// ServerlessBench emulates a FaaS cold start: every iteration pulls the image
+// if it is missing, creates and starts a container running a short task
+// (the benchmark command), waits for the container to be ready and for the
+// task to exit and removes the container. Each phase is timed, as is the whole iteration end to end.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type ServerlessBench struct {
+	CustomBench
+	readyCommand string
+}
+
+// Init initializes the benchmark and verifies the driver supports each phase
+func (sb *ServerlessBench) Init(benchmark Benchmark, driverConfig DriverConfig, imageInfo string, trace bool) error {
+	if benchmark.Overlap > 0 {
+		return fmt.Errorf("overlap is not supported by the serverless benchmark")
+	}
+	if benchmark.Retries > 0 {
+		return fmt.Errorf("retries is not supported by the serverless benchmark")
+	}
+	if err := sb.CustomBench.Init(benchmark, driverConfig, imageInfo, trace); err != nil {
+		return err
+	}
+	_, checker := sb.driver.(imageChecker)
+	if !driver.SupportsImages(sb.driver) || !checker || !driver.SupportsWait(sb.driver.Type()) {
+		return fmt.Errorf("The serverless benchmark is not supported by the %s driver", driverConfig.Type)
+	}
+	if benchmark.ReadyCommand != "" && !driver.SupportsExec(sb.driver.Type()) {
+		return fmt.Errorf("readyCommand is not supported by the %s driver", driverConfig.Type)
+	}
+	sb.readyCommand = benchmark.ReadyCommand
+	sb.iterate = sb.runServerlessIteration
+	return nil
+}
+
+// Validate runs a single serverless iteration against the initialized driver
+func (sb *ServerlessBench) Validate(ctx context.Context) error {
+	stats := sb.runServerlessIteration(ctx, sb.driver, sb.Info(), 0, 1, -1, nil)
+	for phase, errors := range stats.Errors {
+		if errors > 0 {
+			return fmt.Errorf("Driver validation: error during serverless %s phase", phase)
+		}
+	}
+	return nil
+}
+
+// Type returns the type of benchmark
+func (sb *ServerlessBench) Type() Type {
+	return Serverless
+}
+
+// runServerlessIteration runs the phases of one serverless invocation; the
+// commands list is not used
+func (sb *ServerlessBench) runServerlessIteration(ctx context.Context, drv driver.Driver, benchName string, threadNum, threads, i int, commands []string) RunStatistics {
+	stats := RunStatistics{
+		Thread:       threadNum,
+		Iteration:    i,
+		Start:        utils.ElapsedMs(sb.started),
+		Durations:    make(map[string]int),
+		Errors:       make(map[string]int),
+		ErrorClasses: make(map[string]string),
+	}
+	if sb.exact {
+		stats.Nanos = make(map[string]int64)
+	}
+	name := fmt.Sprintf("%s%d-%d", sb.namePrefix, threadNum, i)
+	if i < 0 {
+		name = sb.namePrefix + "test"
+	}
+	if sb.purge != nil && i >= 0 {
+		// untimed; waits for the other threads so the image is not removed
+		// under their containers
+		sb.purge.wait(ctx, drv)
+	} else if sb.purgeImage {
+		// the validation runs alone
+		opCtx, cancel := sb.opContext(ctx)
+		if err := drv.RemoveImage(opCtx, sb.imageInfo); err != nil {
+			log.Warnf("Error purging image %q before iteration %d: %v", sb.imageInfo, i, err)
+		}
+		cancel()
+	}
+	start := time.Now()
+	container := name
+	phase := func(name string, op func(ctx context.Context) (string, int, error)) bool {
+		notifyOpStart(benchName, threads, threadNum, i, name)
+		spanCtx, span := startSpan(ctx, name, container)
+		var exact time.Duration
+		opCtx, cancel := sb.opContext(utils.WithExact(spanCtx, &exact))
+		out, elapsed, err := op(opCtx)
+		timedOut := opCtx.Err() == context.DeadlineExceeded
+		cancel()
+		endSpan(span, err)
+		stats.Durations[name] = elapsed
+		if stats.Nanos != nil {
+			stats.Nanos[name] = exactNanos(exact, elapsed, err)
+		}
+		notify(func(o Observer) { o.OpDone(benchName, threads, name, elapsed, err != nil) })
+		if err != nil {
+			class := driver.ClassifyError(err, out)
+			if timedOut {
+				class = driver.ErrorTimeout
+			}
+			stats.Errors[name]++
+			stats.ErrorClasses[name] = class
+			log.Warnf("Error during serverless %s phase of iteration %d (%s): %v\n  Output: %s", name, i, class, err, out)
+			return false
+		}
+		return true
+	}
+	ok := phase(phasePull, func(ctx context.Context) (string, int, error) {
+		present, err := drv.(imageChecker).HasImage(ctx, sb.imageInfo)
+		if err != nil || present {
+			return "", 0, err
+		}
+		return drv.PullImage(ctx, sb.imageInfo)
+	})
+	var ctr driver.Container
+	ok = ok && phase(phaseStart, func(ctx context.Context) (string, int, error) {
+		var err error
+		if ctr, err = drv.Create(ctx, name, sb.imageInfo, sb.cmdOverride, true, sb.trace); err != nil {
+			return "", 0, err
+		}
+		return drv.Run(ctx, ctr)
+	})
+	ok = ok && phase(phaseReady, func(ctx context.Context) (string, int, error) {
+		return sb.waitReady(ctx, drv, ctr)
+	})
+	ok = ok && phase(phaseTask, func(ctx context.Context) (string, int, error) {
+		return drv.Wait(ctx, ctr)
+	})
+	ok = ok && phase(phaseRemove, func(ctx context.Context) (string, int, error) {
+		return drv.Remove(ctx, ctr)
+	})
+	if ok {
+		stats.Durations[phaseTotal] = utils.Elapsed(ctx, start)
+		if stats.Nanos != nil {
+			stats.Nanos[phaseTotal] = time.Since(start).Nanoseconds()
+		}
+	}
+	notify(func(o Observer) { o.IterationDone(benchName, threads) })
+	return stats
+}
+
+// waitReady runs the ready command in the container until it succeeds; a
+// container is ready once started if there is no ready command
+func (sb *ServerlessBench) waitReady(ctx context.Context, drv driver.Driver, ctr driver.Container) (string, int, error) {
+	if sb.readyCommand == "" {
+		return "", 0, nil
+	}
+	start := time.Now()
+	for {
+		out, _, err := drv.Exec(ctx, ctr, sb.readyCommand)
+		if err == nil {
+			return out, utils.Elapsed(ctx, start), nil
+		}
+		select {
+		case <-ctx.Done():
+			return out, 0, fmt.Errorf("Container not ready: %v", err)
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package benches
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+)
+
+// Span is the timing of an iteration, or of an operation of an iteration, as
+// reported to span observers. Every iteration is a trace: the iteration span
+// is its root and the spans of the container's operations are its children.
+type Span struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	// ParentID is the span ID of the iteration of an operation span; zero
+	// for an iteration span
+	ParentID [8]byte
+	// Name is "iteration" or the operation, e.g. "create" or "run"
+	Name      string
+	Bench     string
+	Driver    string
+	Threads   int
+	Thread    int
+	Iteration int
+	Container string
+	Start     time.Time
+	End       time.Time
+	// Error is the error of a failed operation
+	Error string
+}
+
+// SpanObserver is an Observer which also receives a span for every iteration
+// and operation, e.g. to export them as traces. The operations run with the
+// W3C trace context of their span (see driver.WithTraceParent), which the
+// drivers talking to an engine API forward, so daemon-side traces of the
+// operation join the iteration's trace.
+type SpanObserver interface {
+	Observer
+	Span(span Span)
+}
+
+const (
+	// spanIteration is the name of the root span of an iteration
+	spanIteration = "iteration"
+	// spanCreate is the name of the span of a container's creation
+	spanCreate = "create"
+)
+
+type spanKey struct{}
+
+// spansObserved returns whether any span observer is registered
+func spansObserved() bool {
+	observersMu.Lock()
+	defer observersMu.Unlock()
+	for _, o := range observers {
+		if _, ok := o.(SpanObserver); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// startIterationSpan starts the root span of an iteration, if any span
+// observer is registered, and returns the context carrying it
+func startIterationSpan(ctx context.Context, bench string, dtype driver.Type, threads, thread, iteration int) (context.Context, *Span) {
+	if !spansObserved() {
+		return ctx, nil
+	}
+	span := &Span{
+		Name:      spanIteration,
+		Bench:     bench,
+		Driver:    driver.TypeToString(dtype),
+		Threads:   threads,
+		Thread:    thread,
+		Iteration: iteration,
+		Start:     time.Now(),
+	}
+	rand.Read(span.TraceID[:])
+	rand.Read(span.SpanID[:])
+	return withSpan(ctx, span), span
+}
+
+// startSpan starts the span of an operation on a container as a child of the
+// iteration span in ctx, if any, and returns the context carrying it
+func startSpan(ctx context.Context, name, container string) (context.Context, *Span) {
+	parent, ok := ctx.Value(spanKey{}).(*Span)
+	if !ok {
+		return ctx, nil
+	}
+	span := *parent
+	span.ParentID = parent.SpanID
+	span.Name = name
+	span.Container = container
+	span.Start = time.Now()
+	rand.Read(span.SpanID[:])
+	return withSpan(ctx, &span), &span
+}
+
+// withSpan returns a context carrying the span and its W3C trace context
+func withSpan(ctx context.Context, span *Span) context.Context {
+	ctx = context.WithValue(ctx, spanKey{}, span)
+	traceParent := "00-" + hex.EncodeToString(span.TraceID[:]) + "-" + hex.EncodeToString(span.SpanID[:]) + "-01"
+	return driver.WithTraceParent(ctx, traceParent)
+}
+
+// endSpan ends a span started by startSpan or startIterationSpan, with the
+// error of its operation, and reports it to the span observers
+func endSpan(span *Span, err error) {
+	if span == nil {
+		return
+	}
+	span.End = time.Now()
+	if err != nil {
+		span.Error = err.Error()
+	}
+	notify(func(o Observer) {
+		if s, ok := o.(SpanObserver); ok {
+			s.Span(*span)
+		}
+	})
+}
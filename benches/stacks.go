@@ -0,0 +1,329 @@
+package benches
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultStackInterval is the interval between goroutine dumps of the
+	// stacks collector
+	defaultStackInterval = 5 * time.Second
+	// defaultStackTop is the number of hot blocked stacks reported
+	defaultStackTop = 10
+	// stackFrames is the number of frames identifying a blocked stack,
+	// counted from the first frame outside the runtime and sync packages
+	stackFrames = 6
+)
+
+// StackSamplingConfig holds the settings of the stacks collector, which
+// samples the goroutine stacks of the engine daemon during each run
+type StackSamplingConfig struct {
+	// Endpoint serves the daemon's Go pprof endpoints: a UNIX socket path or
+	// an http:// URL; defaults to the Docker socket for the Docker drivers and
+	// /run/containerd/debug.sock for the containerd-based drivers. The
+	// daemon must run in debug mode (e.g. dockerd --debug, or debug.address
+	// in the containerd config)
+	Endpoint string
+	// Interval is the interval between goroutine dumps (default "5s"); each
+	// dump briefly stops the daemon, so keep it well above the latencies of
+	// interest
+	Interval string
+	// Top is the number of hot blocked stacks reported (default 10)
+	Top int
+}
+
+// BlockedStack is a daemon stack found blocked on a lock in the goroutine
+// dumps of a run
+type BlockedStack struct {
+	// State is the wait reason of the goroutines, e.g. "sync.Mutex.Lock"
+	State string `json:"state"`
+	// Frames are the functions of the stack, innermost first, starting at the
+	// caller of the lock
+	Frames []string `json:"frames"`
+	// Count is the number of goroutines found on the stack over all dumps
+	Count int `json:"count"`
+	// Share is the percentage of all blocked goroutines found on the stack
+	Share float64 `json:"share"`
+}
+
+// StackSampledBench is implemented by benchmarks supporting the stacks
+// collector; BlockedStacks returns the hottest stacks the daemon's goroutines
+// were blocked on during the last run, or nil without stack sampling
+type StackSampledBench interface {
+	BlockedStacks() []BlockedStack
+}
+
+// stackCollector periodically dumps the goroutines of the engine daemon and
+// tallies the stacks blocked on locks, to point at contention in the daemon
+type stackCollector struct {
+	config   StackSamplingConfig
+	interval time.Duration
+	top      int
+	client   *http.Client
+	url      string
+
+	mu         sync.Mutex
+	samples    int
+	goroutines int
+	blocked    int
+	peak       int
+	stacks     map[string]*BlockedStack
+	hot        []BlockedStack
+	done       chan struct{}
+	stopped    sync.WaitGroup
+}
+
+func newStackCollector(benchmark Benchmark) (Collector, error) {
+	if benchmark.StackSampling == nil && !benchmark.CollectorEnabled("stacks") {
+		return nil, nil
+	}
+	s := &stackCollector{interval: defaultStackInterval, top: defaultStackTop}
+	if benchmark.StackSampling != nil {
+		s.config = *benchmark.StackSampling
+	}
+	if s.config.Interval != "" {
+		interval, err := time.ParseDuration(s.config.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("Invalid stackSampling interval %q: must be a positive duration such as 10s", s.config.Interval)
+		}
+		s.interval = interval
+	}
+	if s.config.Top < 0 {
+		return nil, fmt.Errorf("Invalid stackSampling top %d: must not be negative", s.config.Top)
+	}
+	if s.config.Top > 0 {
+		s.top = s.config.Top
+	}
+	return s, nil
+}
+
+func (s *stackCollector) Name() string {
+	return "stacks"
+}
+
+// Start resolves the daemon's debug endpoint, checks that it serves goroutine
+// dumps and begins sampling
+func (s *stackCollector) Start(run RunInfo) error {
+	s.hot = nil
+	endpoint := s.config.Endpoint
+	if endpoint == "" {
+		if endpoint = driver.DebugSocket(run.Driver); endpoint == "" {
+			return fmt.Errorf("no debug endpoint known for the %s driver; set stackSampling endpoint", driver.TypeToString(run.Driver))
+		}
+	}
+	s.client = &http.Client{Timeout: 30 * time.Second}
+	s.url = strings.TrimSuffix(endpoint, "/") + "/debug/pprof/goroutine?debug=2"
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		socket := strings.TrimPrefix(endpoint, "unix://")
+		s.client.Transport = &http.Transport{
+			Dial: func(string, string) (net.Conn, error) {
+				return net.DialTimeout("unix", socket, 30*time.Second)
+			},
+		}
+		s.url = "http://d/debug/pprof/goroutine?debug=2"
+	}
+	s.samples, s.goroutines, s.blocked, s.peak = 0, 0, 0, 0
+	s.stacks = make(map[string]*BlockedStack)
+	if err := s.sample(); err != nil {
+		return fmt.Errorf("Error dumping the daemon goroutines from %s (is the daemon in debug mode?): %v", endpoint, err)
+	}
+	s.done = make(chan struct{})
+	s.stopped.Add(1)
+	go func() {
+		defer s.stopped.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.sample(); err != nil {
+					log.Warnf("Error dumping the daemon goroutines: %v", err)
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends sampling, records the goroutine counts and ranks the blocked
+// stacks
+func (s *stackCollector) Stop(run RunInfo) (map[string]float64, error) {
+	close(s.done)
+	s.stopped.Wait()
+	// a last dump catches the end of the run
+	if err := s.sample(); err != nil {
+		log.Warnf("Error dumping the daemon goroutines: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.samples == 0 {
+		return nil, fmt.Errorf("no goroutine dumps of the daemon succeeded")
+	}
+	for _, stack := range s.stacks {
+		stack.Share = float64(stack.Count) / float64(s.blocked) * 100
+		s.hot = append(s.hot, *stack)
+	}
+	sort.Slice(s.hot, func(i, j int) bool {
+		if s.hot[i].Count != s.hot[j].Count {
+			return s.hot[i].Count > s.hot[j].Count
+		}
+		return strings.Join(s.hot[i].Frames, " ") < strings.Join(s.hot[j].Frames, " ")
+	})
+	if len(s.hot) > s.top {
+		s.hot = s.hot[:s.top]
+	}
+	return map[string]float64{
+		"daemon goroutines avg":          float64(s.goroutines) / float64(s.samples),
+		"daemon blocked goroutines avg":  float64(s.blocked) / float64(s.samples),
+		"daemon blocked goroutines peak": float64(s.peak),
+		"goroutine dumps":                float64(s.samples),
+	}, nil
+}
+
+// sample dumps the daemon's goroutines and adds their blocked stacks
+func (s *stackCollector) sample() error {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET /debug/pprof/goroutine: %s", resp.Status)
+	}
+	goroutines, err := parseGoroutines(resp.Body)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples++
+	s.goroutines += len(goroutines)
+	blocked := 0
+	for _, g := range goroutines {
+		frames, ok := lockWaiter(g)
+		if !ok {
+			continue
+		}
+		blocked++
+		key := g.state + "\n" + strings.Join(frames, "\n")
+		stack, ok := s.stacks[key]
+		if !ok {
+			stack = &BlockedStack{State: g.state, Frames: frames}
+			s.stacks[key] = stack
+		}
+		stack.Count++
+	}
+	s.blocked += blocked
+	if blocked > s.peak {
+		s.peak = blocked
+	}
+	return nil
+}
+
+// goroutine is a goroutine of a debug=2 goroutine dump
+type goroutine struct {
+	// state is the wait reason without the wait duration, e.g. "semacquire"
+	state string
+	// frames are the functions of the stack, innermost first
+	frames []string
+}
+
+// parseGoroutines parses a goroutine dump in the format of
+// /debug/pprof/goroutine?debug=2 (as of a panic):
+//
+//	goroutine 42 [sync.Mutex.Lock, 2 minutes]:
+//	sync.(*Mutex).Lock(...)
+//		/usr/local/go/src/sync/mutex.go:90
+//	main.handler(0xc000010000)
+//		/src/main.go:12 +0x2a
+//	created by main.serve in goroutine 1
+//		/src/main.go:20 +0x3c
+func parseGoroutines(r io.Reader) ([]goroutine, error) {
+	var goroutines []goroutine
+	var current *goroutine
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "goroutine "):
+			open, end := strings.Index(line, "["), strings.LastIndex(line, "]")
+			if open < 0 || end < open {
+				current = nil
+				continue
+			}
+			state := line[open+1 : end]
+			if comma := strings.Index(state, ","); comma >= 0 {
+				state = state[:comma]
+			}
+			goroutines = append(goroutines, goroutine{state: state})
+			current = &goroutines[len(goroutines)-1]
+		case current == nil, line == "", strings.HasPrefix(line, "\t"), strings.HasPrefix(line, "created by "):
+			continue
+		default:
+			// strip the arguments of the call
+			if paren := strings.LastIndex(line, "("); paren > 0 && strings.HasSuffix(line, ")") {
+				line = line[:paren]
+			}
+			current.frames = append(current.frames, line)
+		}
+	}
+	return goroutines, scanner.Err()
+}
+
+// lockWaiter returns whether a goroutine is blocked acquiring a mutex, and
+// the frames identifying its stack: the caller of the lock and its callers.
+// Goroutines waiting on channels, I/O or wait groups are idle rather than
+// contended and are not counted.
+func lockWaiter(g goroutine) ([]string, bool) {
+	locking := false
+	first := -1
+	for i, frame := range g.frames {
+		if strings.HasPrefix(frame, "sync.(*Mutex).") || strings.HasPrefix(frame, "sync.(*RWMutex).") {
+			locking = true
+			continue
+		}
+		if first < 0 && !strings.HasPrefix(frame, "runtime.") && !strings.HasPrefix(frame, "sync.") && !strings.HasPrefix(frame, "internal/sync.") {
+			first = i
+		}
+	}
+	switch {
+	case strings.HasPrefix(g.state, "sync.Mutex.Lock"), strings.HasPrefix(g.state, "sync.RWMutex."):
+	case strings.HasPrefix(g.state, "semacquire") && locking:
+		// Go before 1.20 reports every semaphore wait as semacquire
+	default:
+		return nil, false
+	}
+	if first < 0 {
+		return nil, false
+	}
+	end := first + stackFrames
+	if end > len(g.frames) {
+		end = len(g.frames)
+	}
+	return g.frames[first:end], true
+}
+
+// BlockedStacks returns the hottest stacks the daemon's goroutines were
+// blocked on during the last run, if the stacks collector is enabled
+func (cb *CustomBench) BlockedStacks() []BlockedStack {
+	for _, c := range cb.collectors {
+		if s, ok := c.(*stackCollector); ok {
+			return s.hot
+		}
+	}
+	return nil
+}
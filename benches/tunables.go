@@ -0,0 +1,76 @@
+package benches
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// TunablesConfig holds the limits and kernel tunables a benchmark requires
+type TunablesConfig struct {
+	// Require maps tunables, nofile (the open files limit of bucketbench) or
+	// a sysctl name such as net.core.somaxconn, to their minimum values
+	Require map[string]uint64
+	// Enforce fails the benchmark when a requirement is not met, rather
+	// than warning
+	Enforce bool
+}
+
+// TunableNames returns the tunables recorded in the results of the
+// benchmark: the snapshot tunables and those it requires
+func (b Benchmark) TunableNames() []string {
+	names := append([]string{}, utils.SnapshotTunables...)
+	if b.Tunables != nil {
+		var required []string
+		for name := range b.Tunables.Require {
+			required = append(required, name)
+		}
+		sort.Strings(required)
+		names = append(names, required...)
+	}
+	return names
+}
+
+// CheckTunables checks the limits and kernel tunables of the host against
+// the requirements of the benchmark. Unmet requirements are warned about, or
+// fail the benchmark when enforced; a tunable which cannot be read is
+// skipped with a warning.
+func CheckTunables(benchmark Benchmark) error {
+	config := benchmark.Tunables
+	if config == nil {
+		return nil
+	}
+	var names []string
+	for name := range config.Require {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var failures []string
+	for _, name := range names {
+		value, err := utils.ReadTunable(name)
+		if err != nil {
+			log.Warnf("Tunables: skipping the check of %s: %v", name, err)
+			continue
+		}
+		if required := config.Require[name]; value < required {
+			fix := fmt.Sprintf("sysctl -w %s=%d", name, required)
+			if name == utils.TunableNofile {
+				fix = fmt.Sprintf("ulimit -n %d", required)
+			}
+			failures = append(failures, fmt.Sprintf("%s is %d, %d required; raise it with `%s`", name, value, required, fix))
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	if config.Enforce {
+		return fmt.Errorf("Tunables check failed:\n  %s", strings.Join(failures, "\n  "))
+	}
+	for _, failure := range failures {
+		log.Warnf("Tunables: %s", failure)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package benches
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/estesp/bucketbench/driver"
+)
+
+// VerifyConfig holds the checks of the verify command, which confirm that the
+// container actually did its work, so a runtime which is fast because the
+// workload silently failed is caught
+type VerifyConfig struct {
+	// Output is a regular expression which the container's output must match
+	Output string
+	// ExitCode is the exit code the container's main process must exit with
+	ExitCode *int `yaml:"exitCode"`
+	// Files lists paths which must exist in the running container
+	Files []string
+}
+
+// verifier runs the checks of the verify command
+type verifier struct {
+	output   *regexp.Regexp
+	exitCode *int
+	files    []string
+	// states holds the container state at each verify step of the commands
+	states []string
+}
+
+// newVerifier validates the verify configuration against the commands and the
+// driver; it returns nil if the commands have no verify step
+func newVerifier(config *VerifyConfig, commands []string, drv driver.Driver) (*verifier, error) {
+	var states []string
+	state := ctrCreated
+	for _, cmd := range commands {
+		op := CanonicalCommand(cmd)
+		if op == opVerify {
+			states = append(states, state)
+		}
+		state = transitions[state][op]
+	}
+	if len(states) == 0 {
+		return nil, nil
+	}
+	if config == nil || config.Output == "" && config.ExitCode == nil && len(config.Files) == 0 {
+		return nil, fmt.Errorf("The verify command requires checks in the verify section of the benchmark YAML")
+	}
+	dtype := drv.Type()
+	v := &verifier{exitCode: config.ExitCode, files: config.Files, states: states}
+	if config.Output != "" {
+		if !driver.SupportsLogs(dtype) {
+			return nil, fmt.Errorf("verify output is not supported by the %s driver", driver.TypeToString(dtype))
+		}
+		var err error
+		if v.output, err = regexp.Compile(config.Output); err != nil {
+			return nil, fmt.Errorf("Invalid verify output regular expression: %v", err)
+		}
+	}
+	if v.exitCode != nil {
+		if _, ok := drv.(exitCoder); !ok {
+			return nil, fmt.Errorf("verify exitCode is not supported by the %s driver", driver.TypeToString(dtype))
+		}
+	}
+	if len(v.files) > 0 && !driver.SupportsExec(dtype) {
+		return nil, fmt.Errorf("verify files is not supported by the %s driver", driver.TypeToString(dtype))
+	}
+	// files can only be checked in a running container and the exit code
+	// only once it has exited; each verify step runs the checks it can
+	var running, exited bool
+	for _, state := range states {
+		running = running || state == ctrRunning
+		exited = exited || state != ctrRunning
+	}
+	if len(v.files) > 0 && !running {
+		return nil, fmt.Errorf("verify files requires a verify command while the container is running")
+	}
+	if v.exitCode != nil && !exited {
+		return nil, fmt.Errorf("verify exitCode requires a verify command after wait or stop")
+	}
+	return v, nil
+}
+
+// check runs the checks of the step-th verify step of an iteration against
+// the container and returns a description of each one which failed
+func (v *verifier) check(ctx context.Context, drv driver.Driver, ctr driver.Container, step int) []string {
+	running := v.states[step] == ctrRunning
+	var failures []string
+	if v.output != nil {
+		out, _, err := drv.Logs(ctx, ctr)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("fetching output: %v", err))
+		} else if !v.output.MatchString(out) {
+			failures = append(failures, fmt.Sprintf("output does not match %q", v.output))
+		}
+	}
+	if v.exitCode != nil && !running {
+		code, err := drv.(exitCoder).ExitCode(ctx, ctr)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("fetching exit code: %v", err))
+		} else if code != *v.exitCode {
+			failures = append(failures, fmt.Sprintf("exit code %d, expected %d", code, *v.exitCode))
+		}
+	}
+	for _, file := range v.files {
+		if !running {
+			break
+		}
+		if out, _, err := drv.Exec(ctx, ctr, "test -e "+file); err != nil {
+			failures = append(failures, fmt.Sprintf("file %s: %v %s", file, err, strings.TrimSpace(out)))
+		}
+	}
+	return failures
+}
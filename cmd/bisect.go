@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/estesp/bucketbench/benches/output"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bisectRepo      string
+	bisectGood      string
+	bisectBad       string
+	bisectBuild     string
+	bisectBenchmark string
+	bisectMetric    string
+	bisectThreshold float64
+	bisectOutputDir string
+)
+
+var bisectCmd = &cobra.Command{
+	Use:   "bisect",
+	Short: "Find the commit of a runtime which introduced a performance regression",
+	Long: `Bisects the commits of a runtime's git repository between a good and a bad
+revision. At each commit tested, the build command is run in the repository
+and the benchmark is run (as 'bucketbench run --skip-limit'), so the benchmark
+YAML should point the driver's binary at the build output and be short enough
+to run many times. The results of each commit are compared with those of the
+good revision as 'bucketbench compare' does: a commit is bad if the metric
+(e.g. "rate" or "run median"; any compared metric by default) regressed by
+more than the threshold. Commits which fail to build are skipped. The
+repository is checked out at each commit tested and returned to its original
+revision afterwards, so it must have no uncommitted changes.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if bisectGood == "" || bisectBad == "" || bisectBuild == "" || bisectBenchmark == "" {
+			return fmt.Errorf("--good, --bad, --build and --benchmark are all required")
+		}
+		benchmarkFile, err := filepath.Abs(bisectBenchmark)
+		if err != nil {
+			return err
+		}
+		if status, err := git(bisectRepo, "status", "--porcelain", "--untracked-files=no"); err != nil {
+			return err
+		} else if status != "" {
+			return fmt.Errorf("The repository %s has uncommitted changes; commit or stash them before bisecting", bisectRepo)
+		}
+		original, err := git(bisectRepo, "symbolic-ref", "--quiet", "--short", "HEAD")
+		if err != nil {
+			// a detached HEAD is returned to the same commit
+			if original, err = git(bisectRepo, "rev-parse", "HEAD"); err != nil {
+				return err
+			}
+		}
+		defer func() {
+			if _, err := git(bisectRepo, "checkout", "--quiet", original); err != nil {
+				log.Errorf("Error returning the repository to %s: %v", original, err)
+			}
+		}()
+		good, err := git(bisectRepo, "rev-parse", "--verify", bisectGood+"^{commit}")
+		if err != nil {
+			return err
+		}
+		revs, err := git(bisectRepo, "rev-list", "--reverse", "--ancestry-path", good+".."+bisectBad)
+		if err != nil {
+			return err
+		}
+		if revs == "" {
+			return fmt.Errorf("%s is not a descendant of %s; nothing to bisect", bisectBad, bisectGood)
+		}
+		commits := strings.Split(revs, "\n")
+		position := make(map[string]int)
+		for i, commit := range commits {
+			position[commit] = i
+		}
+
+		dir := bisectOutputDir
+		if dir == "" {
+			if dir, err = ioutil.TempDir("", "bucketbench-bisect"); err != nil {
+				return err
+			}
+			defer os.RemoveAll(dir)
+		}
+		b := &bisection{dir: dir, benchmarkFile: benchmarkFile}
+		baseline, err := b.run(good)
+		if err != nil {
+			return fmt.Errorf("Error benchmarking the good revision %s: %v", bisectGood, err)
+		}
+		b.baseline = baseline
+		b.record(good, "good (baseline)", nil)
+
+		// commits[lo] is the last known good commit (-1 for the good
+		// revision) and commits[hi] the first known bad one
+		lo, hi := -1, len(commits)-1
+		bad, err := b.test(commits[hi])
+		if err != nil {
+			return fmt.Errorf("Error testing the bad revision %s: %v", bisectBad, err)
+		}
+		if !bad {
+			b.write()
+			return fmt.Errorf("%s did not regress from %s by more than %.1f%%; nothing to bisect", bisectBad, bisectGood, bisectThreshold)
+		}
+		var skipped []string
+		for hi-lo > 1 {
+			mid := (lo + hi) / 2
+			bad, err := b.test(commits[mid])
+			if err == errBuildFailed {
+				// drop the commit; the range shrinks without a verdict
+				skipped = append(skipped, commits[mid])
+				commits = append(commits[:mid], commits[mid+1:]...)
+				hi--
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if bad {
+				hi = mid
+			} else {
+				lo = mid
+			}
+		}
+		b.write()
+		first := commits[hi]
+		subject, _ := git(bisectRepo, "log", "-1", "--format=%h %s", first)
+		fmt.Printf("\nFirst bad commit: %s\n  %s\n", first, subject)
+		for _, commit := range skipped {
+			// a commit skipped between the last good and the first bad
+			// commit may be the first bad one
+			if position[commit] < position[first] && (lo == -1 || position[commit] > position[commits[lo]]) {
+				log.Warnf("Commit %s failed to build; the regression may have been introduced there instead", commit)
+			}
+		}
+		return nil
+	},
+}
+
+// errBuildFailed is returned when a commit tested by bisect fails to build
+var errBuildFailed = fmt.Errorf("build failed")
+
+// bisection holds the state of a bisect run
+type bisection struct {
+	dir           string
+	benchmarkFile string
+	baseline      output.Report
+	rows          []bisectRow
+}
+
+// bisectRow is a line of the bisect log: a commit tested, its verdict and
+// the regressions found
+type bisectRow struct {
+	commit  string
+	verdict string
+	deltas  []output.Delta
+}
+
+// test builds and benchmarks a commit and returns whether it regressed
+func (b *bisection) test(commit string) (bool, error) {
+	report, err := b.run(commit)
+	if err == errBuildFailed {
+		b.record(commit, "skipped (build failed)", nil)
+		return false, err
+	}
+	if err != nil {
+		return false, fmt.Errorf("Error benchmarking commit %s: %v", commit, err)
+	}
+	var regressions []output.Delta
+	for _, d := range output.Compare(b.baseline, report, bisectThreshold) {
+		if d.Regression && (bisectMetric == "" || d.Metric == bisectMetric) {
+			regressions = append(regressions, d)
+		}
+	}
+	if len(regressions) > 0 {
+		b.record(commit, "bad", regressions)
+		return true, nil
+	}
+	b.record(commit, "good", nil)
+	return false, nil
+}
+
+// run checks out and builds a commit, then runs the benchmark against the
+// build into an output directory named after the commit
+func (b *bisection) run(commit string) (output.Report, error) {
+	if _, err := git(bisectRepo, "checkout", "--quiet", commit); err != nil {
+		return output.Report{}, err
+	}
+	log.Infof("Building %s", commit)
+	build := exec.Command("sh", "-c", bisectBuild)
+	build.Dir = bisectRepo
+	if out, err := build.CombinedOutput(); err != nil {
+		log.Warnf("Build of %s failed: %v\n  Output: %s", commit, err, out)
+		return output.Report{}, errBuildFailed
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return output.Report{}, err
+	}
+	dir := filepath.Join(b.dir, commit)
+	log.Infof("Benchmarking %s", commit)
+	run := exec.Command(self, "run", "--skip-limit", "--benchmark", b.benchmarkFile, "--output-dir", dir, "--log-level", logLevel)
+	run.Stderr = os.Stderr
+	if err := run.Run(); err != nil {
+		return output.Report{}, err
+	}
+	return readReport(filepath.Join(dir, outputResultsJSONFile))
+}
+
+// record adds a commit to the bisect log
+func (b *bisection) record(commit, verdict string, deltas []output.Delta) {
+	log.Infof("Commit %s is %s", commit, verdict)
+	b.rows = append(b.rows, bisectRow{commit: commit, verdict: verdict, deltas: deltas})
+}
+
+// write displays the bisect log
+func (b *bisection) write() {
+	fmt.Printf("\nBISECT LOG (threshold %.1f%%)\n\n", bisectThreshold)
+	w := tabwriter.NewWriter(os.Stdout, 10, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Commit\tVerdict\tRegressions\n")
+	for _, row := range b.rows {
+		var regressions []string
+		for _, d := range row.deltas {
+			regressions = append(regressions, fmt.Sprintf("%s:%d %s %+.1f%%", d.Name, d.Threads, d.Metric, d.Percent))
+		}
+		fmt.Fprintf(w, "%.12s\t%s\t%s\n", row.commit, row.verdict, strings.Join(regressions, ", "))
+	}
+	w.Flush()
+}
+
+// git runs a git command in a repository and returns its trimmed output
+func git(repo string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("Error running git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(exit.Stderr)))
+		}
+		return "", fmt.Errorf("Error running git %s: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func init() {
+	RootCmd.AddCommand(bisectCmd)
+	bisectCmd.Flags().StringVar(&bisectRepo, "repo", ".", "Git repository of the runtime")
+	bisectCmd.Flags().StringVar(&bisectGood, "good", "", "Revision without the regression")
+	bisectCmd.Flags().StringVar(&bisectBad, "bad", "", "Revision with the regression")
+	bisectCmd.Flags().StringVar(&bisectBuild, "build", "", "Shell command building the runtime, run in the repository (e.g. \"make runc\")")
+	bisectCmd.Flags().StringVarP(&bisectBenchmark, "benchmark", "b", "", "YAML file with the benchmark run at each commit")
+	bisectCmd.Flags().StringVar(&bisectMetric, "metric", "", "Metric whose regression makes a commit bad, as named by 'bucketbench compare' (e.g. \"rate\" or \"run median\"); any metric if empty")
+	bisectCmd.Flags().Float64VarP(&bisectThreshold, "threshold", "t", 10, "Percent change of the metric which counts as a regression")
+	bisectCmd.Flags().StringVar(&bisectOutputDir, "output-dir", "", "Directory to keep the output directory of the run of each commit tested in")
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/estesp/bucketbench/benches"
+	"github.com/estesp/bucketbench/benches/output"
+	"github.com/estesp/bucketbench/utils"
+	"github.com/montanaflynn/stats"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	calibrateIter int
+	calibrateFile string
+)
+
+var calibrateCmd = &cobra.Command{
+	Use:   "calibrate",
+	Short: "Measure the host noise floor for container primitives",
+	Long: `Runs a micro-suite of the primitive operations container engines rely on
+(fork/exec, cgroup creation, network namespace creation) natively on this host
+and stores the resulting profile, so results from different machines can be
+compared with the host's own floor in mind. Cgroup and network namespace
+creation require root.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if calibrateIter < 1 {
+			return fmt.Errorf("Iterations must be at least 1")
+		}
+		hostname, _ := os.Hostname()
+		profile := benches.CalibrationProfile{
+			Hostname:   hostname,
+			Kernel:     utils.KernelVersion(),
+			CPUs:       runtime.NumCPU(),
+			Clock:      utils.GetClockInfo().String(),
+			Iterations: calibrateIter,
+			Operations: make(map[string]benches.CalibrationOp),
+		}
+		ops := map[string]func(i int) (time.Duration, error){
+			"forkexec": func(i int) (time.Duration, error) {
+				return utils.TimeForkExec()
+			},
+			"cgroup": func(i int) (time.Duration, error) {
+				return utils.TimeCgroupCreate(fmt.Sprintf("bb-calibrate-%d-%d", os.Getpid(), i))
+			},
+			"netns": func(i int) (time.Duration, error) {
+				return utils.TimeNetnsCreate()
+			},
+		}
+		for name, op := range ops {
+			profile.Operations[name] = calibrateOp(name, op)
+		}
+		output.WriteCalibrationText(os.Stdout, profile)
+		if err := benches.WriteCalibration(calibrateFile, profile); err != nil {
+			return fmt.Errorf("Error writing calibration profile: %v", err)
+		}
+		log.Infof("Calibration profile written to %s", calibrateFile)
+		return nil
+	},
+}
+
+// calibrateOp runs a calibration operation for the configured iterations and
+// returns its statistics in microseconds
+func calibrateOp(name string, op func(i int) (time.Duration, error)) benches.CalibrationOp {
+	var (
+		samples []float64
+		result  benches.CalibrationOp
+	)
+	for i := 0; i < calibrateIter; i++ {
+		elapsed, err := op(i)
+		if err != nil {
+			result.Errors++
+			log.Debugf("Calibration %s: %v", name, err)
+			continue
+		}
+		samples = append(samples, float64(elapsed.Nanoseconds())/1000)
+	}
+	if len(samples) == 0 {
+		log.Warnf("Calibration operation %s failed for all iterations", name)
+		return result
+	}
+	result.Min, _ = stats.Min(samples)
+	result.Median, _ = stats.Median(samples)
+	result.P90, _ = stats.Percentile(samples, 90)
+	result.Mean, _ = stats.Mean(samples)
+	result.Stddev, _ = stats.StandardDeviation(samples)
+	return result
+}
+
+func init() {
+	RootCmd.AddCommand(calibrateCmd)
+	calibrateCmd.Flags().IntVarP(&calibrateIter, "iterations", "i", 200, "Number of iterations of each calibration operation")
+	calibrateCmd.Flags().StringVarP(&calibrateFile, "output", "o", "bucketbench-calibration.json", "File to store the calibration profile in")
+}
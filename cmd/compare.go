@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/estesp/bucketbench/benches"
+	"github.com/estesp/bucketbench/benches/output"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	compareThreshold float64
+	compareRerun     bool
+	rerunBenchmark   string
+	rerunFactor      int
+	compareNormalize bool
+	oldCalibration   string
+	newCalibration   string
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare OLD.json NEW.json",
+	Short: "Compare two JSON benchmark results and detect regressions",
+	Long: `Compares the results of two runs saved with --format json (or the
+results.json of an output directory), printing the percent change of the rate
+and of the median and p95 timing of each command, per driver and thread count.
+The command fails if any rate dropped, or any timing increased, by more than
+the threshold, so it can be used as a CI gate when upgrading a runtime.
+
+With --rerun-regressed, the driver configurations and thread counts with
+regressions are run again from the benchmark YAML the new results were
+produced with (--benchmark), with --rerun-factor times the iterations, and
+compared with the old results once more. A regression is confirmed if the
+metric regresses by more than the threshold in the rerun too, and dismissed
+otherwise; the command then fails only on confirmed regressions.
+
+With --normalize, the new results are scaled by how much faster or slower
+their host runs the calibrated primitives (fork/exec, cgroup and network
+namespace creation) than the old results' host, so differing hardware neither
+masks nor fakes a regression. The calibration profiles are those recorded in
+the results by 'bucketbench run --calibration', or the profiles given with
+--old-calibration and --new-calibration.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("Two result files are required: the old and the new results")
+		}
+		if compareRerun && rerunBenchmark == "" {
+			return fmt.Errorf("--rerun-regressed requires the benchmark YAML of the new results (--benchmark)")
+		}
+		if rerunFactor < 1 {
+			return fmt.Errorf("Invalid --rerun-factor %d: must be 1 or more", rerunFactor)
+		}
+		old, err := readReport(args[0])
+		if err != nil {
+			return err
+		}
+		current, err := readReport(args[1])
+		if err != nil {
+			return err
+		}
+		hostFactor := 1.0
+		if compareNormalize {
+			if hostFactor, err = compareHostFactor(old, current); err != nil {
+				return err
+			}
+			current = output.Normalize(current, hostFactor)
+		}
+		for _, name := range output.ImageMismatches(old, current) {
+			log.Warnf("%s ran a different image digest in the two results; the comparison includes the image change", name)
+		}
+		deltas := output.Compare(old, current, compareThreshold)
+		if len(deltas) == 0 {
+			return fmt.Errorf("No driver and thread count is present in both result files")
+		}
+		w := tabwriter.NewWriter(os.Stdout, 10, 4, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintf(w, "Driver\tThreads\tMetric\tOld\tNew\tDelta\t\t\n")
+		regressions := 0
+		for _, d := range deltas {
+			mark := ""
+			if d.Regression {
+				mark = "REGRESSION"
+				regressions++
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%7.2f\t%7.2f\t%+6.1f%%\t%s\t\n", d.Name, d.Threads, d.Metric, d.Old, d.New, d.Percent, mark)
+		}
+		w.Flush()
+		if regressions > 0 && compareRerun {
+			confirmed, err := rerunRegressed(rerunBenchmark, old, current, deltas, rerunFactor, hostFactor)
+			if err != nil {
+				return err
+			}
+			if confirmed > 0 {
+				return fmt.Errorf("%d of %d regressed metrics confirmed by the rerun", confirmed, regressions)
+			}
+			log.Infof("The rerun dismissed all %d regressed metrics", regressions)
+			return nil
+		}
+		if regressions > 0 {
+			return fmt.Errorf("%d metrics regressed by more than %.1f%%", regressions, compareThreshold)
+		}
+		return nil
+	},
+}
+
+// compareHostFactor returns the host factor of the new results relative to
+// the old ones, from the calibration profiles in the results or given with
+// --old-calibration and --new-calibration
+func compareHostFactor(old, current output.Report) (float64, error) {
+	oldProfile, err := reportCalibration(old, oldCalibration, "--old-calibration")
+	if err != nil {
+		return 0, err
+	}
+	newProfile, err := reportCalibration(current, newCalibration, "--new-calibration")
+	if err != nil {
+		return 0, err
+	}
+	factor, ops, err := output.HostFactor(oldProfile, newProfile)
+	if err != nil {
+		return 0, fmt.Errorf("Can't normalize the results: %v", err)
+	}
+	fmt.Printf("Host factor %.3f (%s vs %s, from %s): the new results are normalized to the old host\n\n",
+		factor, newProfile.Hostname, oldProfile.Hostname, strings.Join(ops, ", "))
+	return factor, nil
+}
+
+// reportCalibration returns the calibration profile in file, or else the one
+// recorded in the report
+func reportCalibration(report output.Report, file, flag string) (benches.CalibrationProfile, error) {
+	if file != "" {
+		return benches.ReadCalibration(file)
+	}
+	if report.Calibration == nil {
+		return benches.CalibrationProfile{}, fmt.Errorf("--normalize requires a calibration profile of each host: the results of %s have none (run with --calibration, or give one with %s)", report.Environment.Hostname, flag)
+	}
+	return *report.Calibration, nil
+}
+
+func readReport(filename string) (output.Report, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return output.Report{}, fmt.Errorf("Error opening %q: %v", filename, err)
+	}
+	defer f.Close()
+	report, err := output.ReadJSON(f)
+	if err != nil {
+		return report, fmt.Errorf("Error reading results from %q: %v", filename, err)
+	}
+	return report, nil
+}
+
+func init() {
+	RootCmd.AddCommand(compareCmd)
+	compareCmd.Flags().Float64VarP(&compareThreshold, "threshold", "t", 10, "Percent change of any metric which counts as a regression")
+	compareCmd.Flags().BoolVar(&compareRerun, "rerun-regressed", false, "Run the regressed driver configurations and thread counts again to confirm or dismiss each regression")
+	compareCmd.Flags().StringVarP(&rerunBenchmark, "benchmark", "b", "", "YAML file the new results were produced with, for --rerun-regressed")
+	compareCmd.Flags().BoolVar(&compareNormalize, "normalize", false, "Normalize the new results to the old results' host by the calibration profiles of the hosts")
+	compareCmd.Flags().StringVar(&oldCalibration, "old-calibration", "", "Calibration profile of the old results' host, for --normalize (default: the profile in the old results)")
+	compareCmd.Flags().StringVar(&newCalibration, "new-calibration", "", "Calibration profile of the new results' host, for --normalize (default: the profile in the new results)")
+	compareCmd.Flags().IntVar(&rerunFactor, "rerun-factor", 3, "Multiple of the configured iterations the reruns run with")
+}
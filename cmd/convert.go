@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/estesp/bucketbench/benches/output"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	convertFrom   string
+	convertTo     string
+	convertOutput string
+	convertRun    string
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert [FILE]",
+	Short: "Convert saved benchmark results to another format",
+	Long: `Converts the results of an earlier run to another format without rerunning
+the benchmark, e.g. to feed them to tools added since. The input is a JSON
+result file (--format json, or the results.json of an output directory), a
+raw timings CSV (--output-csv, or raw.csv), or with --run a run stored in the
+history database. It is written as json, csv, benchstat (the Go benchmark
+format, one sample per step of every iteration, for benchstat's statistical
+comparison), junit (JUnit XML for CI systems) or text. A CSV holds only the
+timings, so results converted from one have no rates or environment.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report, err := readConvertInput(args)
+		if err != nil {
+			return err
+		}
+		switch convertTo {
+		case output.FormatText, output.FormatJSON, output.FormatCSV, output.FormatBenchstat, output.FormatJUnit:
+		default:
+			return fmt.Errorf("Unknown output format %q; use %q, %q, %q, %q or %q", convertTo, output.FormatJSON, output.FormatCSV, output.FormatBenchstat, output.FormatJUnit, output.FormatText)
+		}
+		if convertOutput == "" {
+			return output.WriteFormat(os.Stdout, convertTo, report, precision)
+		}
+		f, err := os.Create(convertOutput)
+		if err != nil {
+			return err
+		}
+		if err := output.WriteFormat(f, convertTo, report, precision); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		log.Infof("Results written to %s as %s", convertOutput, convertTo)
+		return nil
+	},
+}
+
+// readConvertInput reads the report to convert from the result file given,
+// or from the history with --run
+func readConvertInput(args []string) (output.Report, error) {
+	if convertRun != "" {
+		if len(args) != 0 {
+			return output.Report{}, fmt.Errorf("Either a result file or --run can be converted, not both")
+		}
+		history, err := output.OpenHistory(historyDB)
+		if err != nil {
+			return output.Report{}, err
+		}
+		defer history.Close()
+		_, report, err := history.Report(convertRun)
+		return report, err
+	}
+	if len(args) != 1 {
+		return output.Report{}, fmt.Errorf("One result file (or --run) is required")
+	}
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return output.Report{}, fmt.Errorf("Error reading %q: %v", args[0], err)
+	}
+	from := convertFrom
+	if from == "" {
+		from = output.FormatCSV
+		if strings.ToLower(filepath.Ext(args[0])) == ".json" || json.Valid(data) {
+			from = output.FormatJSON
+		}
+	}
+	var report output.Report
+	switch from {
+	case output.FormatJSON:
+		report, err = output.ReadJSON(bytes.NewReader(data))
+	case output.FormatCSV:
+		report, err = output.ReadCSV(bytes.NewReader(data))
+		if report.Benchmark == "" {
+			report.Benchmark = strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+		}
+	default:
+		return report, fmt.Errorf("Unknown input format %q; use %q or %q", from, output.FormatJSON, output.FormatCSV)
+	}
+	if err != nil {
+		return report, fmt.Errorf("Error reading results from %q: %v", args[0], err)
+	}
+	return report, nil
+}
+
+func init() {
+	RootCmd.AddCommand(convertCmd)
+	convertCmd.Flags().StringVar(&convertFrom, "from", "", "Format of the input file: json or csv (default: detected from the file)")
+	convertCmd.Flags().StringVar(&convertTo, "to", output.FormatJSON, "Output format: json, csv, benchstat, junit or text")
+	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "File to write the converted results to (default: stdout)")
+	convertCmd.Flags().StringVar(&convertRun, "run", "", "Convert the run with this ID or run ID from the history instead of a file")
+	convertCmd.Flags().StringVar(&historyDB, "db", output.DefaultHistoryPath(), "History database file")
+	convertCmd.Flags().IntVar(&precision, "precision", 2, "Decimal places of the rates and millisecond statistics in text output")
+}
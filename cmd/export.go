@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportDir   string
+	exportScrub []string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export FILE...",
+	Short: "Write anonymized copies of benchmark results for sharing",
+	Long: `Strips host names, user names, image registry names and filesystem paths
+from saved benchmark output (text or JSON, e.g. calibration profiles) so the
+results can be shared with upstream runtime maintainers without leaking
+internal details. The anonymized copies are written to the output directory
+under their original file names.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("No result files provided; nothing to export")
+		}
+		if err := os.MkdirAll(exportDir, 0755); err != nil {
+			return fmt.Errorf("Error creating export directory %q: %v", exportDir, err)
+		}
+		anonymizer := utils.NewAnonymizer(exportScrub...)
+		for _, file := range args {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("Error reading %q: %v", file, err)
+			}
+			var out []byte
+			if json.Valid(data) {
+				if out, err = anonymizer.JSON(data); err != nil {
+					return fmt.Errorf("Error anonymizing %q: %v", file, err)
+				}
+			} else {
+				out = []byte(anonymizer.String(string(data)))
+			}
+			dest := filepath.Join(exportDir, filepath.Base(file))
+			if err := ioutil.WriteFile(dest, out, 0644); err != nil {
+				return fmt.Errorf("Error writing %q: %v", dest, err)
+			}
+			log.Infof("Anonymized %s written to %s", file, dest)
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&exportDir, "output-dir", "o", "bucketbench-export", "Directory to write the anonymized copies to")
+	exportCmd.Flags().StringSliceVar(&exportScrub, "scrub", nil, "Additional names (e.g. internal domains or projects) to remove")
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/estesp/bucketbench/benches"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fixturesBinary  string
+	fixturesPrefix  string
+	fixturesFile    string
+	fixturesLayers  int
+	fixturesLargeMB int
+	fixturesOwned   int
+	fixturesSweep   []int
+	fixturesSweepMB int
+	fixturesPush    bool
+	fixturesPreset  string
+)
+
+// fixtureBase is the base image for built fixtures; a statically linked
+// busybox also serves as the tiny fixture's only binary
+const fixtureBase = "busybox:1.36-musl"
+
+// fixtureDef describes how a benchmark fixture image is produced: pulled
+// as-is when dockerfile is empty, otherwise built from the dockerfile
+type fixtureDef struct {
+	name        string
+	description string
+	image       string
+	dockerfile  string
+}
+
+var fixturesCmd = &cobra.Command{
+	Use:   "fixtures",
+	Short: "Build and pull the standard benchmark images and record their digests",
+	Long: `Builds (or pulls) a standard set of benchmark images using a Docker-compatible
+client: a tiny image holding a single static binary, an image with many layers,
+a large image, an image with many files owned by a non-root user, and a
+crash-looping image. The image digests are recorded in
+a JSON file so published results can reference reproducible workloads.
+
+With --layer-sweep, it also builds one image per layer count holding the same
+total amount of data (--sweep-mb) split evenly over its layers, and writes a
+serverless benchmark running each of them as a version matrix entry, so the
+pull, start and remove phases show the overhead of each additional layer.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if fixturesLayers < 1 || fixturesLargeMB < 1 || fixturesSweepMB < 1 || fixturesOwned < 1 {
+			return fmt.Errorf("Layer count, image sizes and owned file count must be at least 1")
+		}
+		for _, layers := range fixturesSweep {
+			if layers < 1 {
+				return fmt.Errorf("Invalid --layer-sweep layer count %d: must be at least 1", layers)
+			}
+		}
+		binary, err := utils.ResolveBinary(fixturesBinary)
+		if err != nil {
+			return err
+		}
+		set := benches.FixtureSet{Engine: filepath.Base(binary)}
+		defs := fixtureDefs()
+		sweep := sweepFixtureDefs()
+		for _, def := range append(defs, sweep...) {
+			if def.dockerfile == "" {
+				err = pullFixture(binary, def.image)
+			} else {
+				err = buildFixture(binary, def)
+				if err == nil && fixturesPush {
+					err = pushFixture(binary, def.image)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("Error preparing fixture %q: %v", def.name, err)
+			}
+			digest, err := fixtureDigest(binary, def)
+			if err != nil {
+				return fmt.Errorf("Error reading digest of fixture %q: %v", def.name, err)
+			}
+			log.Infof("Fixture %s: %s (%s)", def.name, def.image, digest)
+			set.Fixtures = append(set.Fixtures, benches.Fixture{
+				Name:        def.name,
+				Image:       def.image,
+				Description: def.description,
+				Digest:      digest,
+			})
+		}
+		if err := benches.WriteFixtures(fixturesFile, set); err != nil {
+			return fmt.Errorf("Error writing fixtures file: %v", err)
+		}
+		log.Infof("Fixture digests written to %s", fixturesFile)
+		if len(sweep) > 0 {
+			if err := ioutil.WriteFile(fixturesPreset, []byte(sweepBenchmark(binary, sweep)), 0644); err != nil {
+				return fmt.Errorf("Error writing layer sweep benchmark: %v", err)
+			}
+			log.Infof("Layer sweep benchmark written to %s", fixturesPreset)
+		}
+		return nil
+	},
+}
+
+// fixtureDefs returns the standard fixture set for the configured options
+func fixtureDefs() []fixtureDef {
+	var layers []string
+	for i := 1; i <= fixturesLayers; i++ {
+		layers = append(layers, fmt.Sprintf("RUN echo %d > /layer-%d", i, i))
+	}
+	return []fixtureDef{
+		{
+			name:        "base",
+			description: "Base image of the built fixtures",
+			image:       fixtureBase,
+		},
+		{
+			name:        "tiny",
+			description: "Single static binary which exits immediately",
+			image:       fixturesPrefix + "tiny:latest",
+			dockerfile: fmt.Sprintf("FROM %s AS src\nFROM scratch\nCOPY --from=src /bin/busybox /true\nENTRYPOINT [\"/true\"]\n",
+				fixtureBase),
+		},
+		{
+			name:        "layers",
+			description: fmt.Sprintf("Image with %d small layers on the base image", fixturesLayers),
+			image:       fmt.Sprintf("%slayers-%d:latest", fixturesPrefix, fixturesLayers),
+			dockerfile:  fmt.Sprintf("FROM %s\n%s\nCMD [\"sleep\", \"30\"]\n", fixtureBase, strings.Join(layers, "\n")),
+		},
+		{
+			name:        "large",
+			description: fmt.Sprintf("Image with %dMB of incompressible data", fixturesLargeMB),
+			image:       fmt.Sprintf("%slarge-%dm:latest", fixturesPrefix, fixturesLargeMB),
+			dockerfile: fmt.Sprintf("FROM %s\nRUN dd if=/dev/urandom of=/data bs=1M count=%d\nCMD [\"sleep\", \"30\"]\n",
+				fixtureBase, fixturesLargeMB),
+		},
+		{
+			name:        "owned",
+			description: fmt.Sprintf("Image with %d small files owned by uid 1000, to run with user 1000", fixturesOwned),
+			image:       fmt.Sprintf("%sowned-%d:latest", fixturesPrefix, fixturesOwned),
+			dockerfile: fmt.Sprintf("FROM %s\nRUN mkdir /owned && cd /owned && seq %d | xargs touch && chown -R 1000:1000 /owned\nCMD [\"sleep\", \"30\"]\n",
+				fixtureBase, fixturesOwned),
+		},
+		{
+			name:        "crashloop",
+			description: "Container which exits with an error after one second",
+			image:       fixturesPrefix + "crashloop:latest",
+			dockerfile:  fmt.Sprintf("FROM %s\nCMD [\"sh\", \"-c\", \"sleep 1; exit 1\"]\n", fixtureBase),
+		},
+	}
+}
+
+// sweepFixtureDefs returns the images of the layer count sweep: each holds
+// the same amount of incompressible data on the base image, split evenly
+// over its layers, so only the number of layers differs between them
+func sweepFixtureDefs() []fixtureDef {
+	var defs []fixtureDef
+	for _, count := range fixturesSweep {
+		var layers []string
+		size := fixturesSweepMB * 1024 / count
+		for i := 1; i <= count; i++ {
+			layers = append(layers, fmt.Sprintf("RUN dd if=/dev/urandom of=/data-%d bs=1K count=%d", i, size))
+		}
+		defs = append(defs, fixtureDef{
+			name:        fmt.Sprintf("layer-sweep-%d", count),
+			description: fmt.Sprintf("Image with %dMB of incompressible data in %d layers", fixturesSweepMB, count),
+			image:       fmt.Sprintf("%slayer-sweep-%d:latest", fixturesPrefix, count),
+			dockerfile:  fmt.Sprintf("FROM %s\n%s\nCMD [\"sleep\", \"30\"]\n", fixtureBase, strings.Join(layers, "\n")),
+		})
+	}
+	return defs
+}
+
+// sweepBenchmark returns a serverless benchmark running each image of the
+// layer count sweep as a version matrix entry; pushed images are purged
+// before every iteration, so the pull phase times a cold pull from the
+// registry, while images only built locally must stay in place
+func sweepBenchmark(binary string, sweep []fixtureDef) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Layer count sweep written by 'bucketbench fixtures': every image holds\n")
+	fmt.Fprintf(&b, "# %dMB of data, so the pull, start and remove phases of the version trend\n", fixturesSweepMB)
+	fmt.Fprintf(&b, "# show the overhead of the additional layers. Copy the driver entry (e.g.\n")
+	fmt.Fprintf(&b, "# with env DOCKER_HOST set to a daemon using another storage driver, or\n")
+	fmt.Fprintf(&b, "# as a Containerd entry with another snapshotter) to compare them.\n")
+	fmt.Fprintf(&b, "name: LayerSweep\n")
+	fmt.Fprintf(&b, "type: serverless\n")
+	fmt.Fprintf(&b, "image: %s\n", sweep[0].image)
+	fmt.Fprintf(&b, "command: \"true\"\n")
+	fmt.Fprintf(&b, "purgeImageBetweenIterations: %t\n", fixturesPush)
+	fmt.Fprintf(&b, "drivers:\n")
+	fmt.Fprintf(&b, "  -\n")
+	fmt.Fprintf(&b, "   type: Docker\n")
+	fmt.Fprintf(&b, "   binary: %s\n", binary)
+	fmt.Fprintf(&b, "   threads: 1\n")
+	fmt.Fprintf(&b, "   iterations: 10\n")
+	fmt.Fprintf(&b, "   matrix:\n")
+	for _, def := range sweep {
+		fmt.Fprintf(&b, "     - version: %q\n", strings.TrimPrefix(def.name, "layer-sweep-")+" layers")
+		fmt.Fprintf(&b, "       image: %s\n", def.image)
+	}
+	return b.String()
+}
+
+func pullFixture(binary, image string) error {
+	if out, err := utils.ExecCmd(binary, "pull "+image); err != nil {
+		return fmt.Errorf("%v (output: %s)", err, out)
+	}
+	return nil
+}
+
+func pushFixture(binary, image string) error {
+	if out, err := utils.ExecCmd(binary, "push "+image); err != nil {
+		return fmt.Errorf("%v (output: %s)", err, out)
+	}
+	return nil
+}
+
+func buildFixture(binary string, def fixtureDef) error {
+	dir, err := ioutil.TempDir("", "bb-fixture-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(def.dockerfile), 0644); err != nil {
+		return err
+	}
+	if out, err := utils.ExecCmd(binary, "build -t "+def.image+" "+dir); err != nil {
+		return fmt.Errorf("%v (output: %s)", err, out)
+	}
+	return nil
+}
+
+// fixtureDigest returns the registry digest of a pulled or pushed image, or
+// the image ID of a built image (which has no registry digest until it is
+// pushed)
+func fixtureDigest(binary string, def fixtureDef) (string, error) {
+	if def.dockerfile != "" && !fixturesPush {
+		out, err := utils.ExecCmd(binary, "image inspect --format {{.Id}} "+def.image)
+		if err != nil {
+			return "", fmt.Errorf("%v (output: %s)", err, out)
+		}
+		return strings.TrimSpace(out), nil
+	}
+	// arguments are split on spaces, so the template can't use index
+	out, err := utils.ExecCmd(binary, "image inspect --format {{json .RepoDigests}} "+def.image)
+	if err != nil {
+		return "", fmt.Errorf("%v (output: %s)", err, out)
+	}
+	var digests []string
+	if err := json.Unmarshal([]byte(out), &digests); err != nil || len(digests) == 0 {
+		return "", fmt.Errorf("no repository digest found for %s", def.image)
+	}
+	return digests[0], nil
+}
+
+func init() {
+	RootCmd.AddCommand(fixturesCmd)
+	fixturesCmd.Flags().StringVar(&fixturesBinary, "binary", "docker", "Docker-compatible client binary used to build and pull images")
+	fixturesCmd.Flags().StringVar(&fixturesPrefix, "prefix", "bucketbench/", "Repository prefix for the built fixture images")
+	fixturesCmd.Flags().StringVarP(&fixturesFile, "output", "o", "bucketbench-fixtures.json", "File to record the fixture images and digests in")
+	fixturesCmd.Flags().IntVar(&fixturesLayers, "layers", 20, "Number of layers in the many-layer image")
+	fixturesCmd.Flags().IntVar(&fixturesLargeMB, "large-mb", 512, "Size in MB of the large image")
+	fixturesCmd.Flags().IntVar(&fixturesOwned, "owned-files", 10000, "Number of files owned by uid 1000 in the owned image")
+	fixturesCmd.Flags().IntSliceVar(&fixturesSweep, "layer-sweep", nil, "Layer counts of the layer sweep images to build, e.g. 1,10,50,100")
+	fixturesCmd.Flags().IntVar(&fixturesSweepMB, "sweep-mb", 64, "Total size in MB of each layer sweep image")
+	fixturesCmd.Flags().BoolVar(&fixturesPush, "push", false, "Push the built images (use a registry --prefix), so benchmarks can pull them cold")
+	fixturesCmd.Flags().StringVar(&fixturesPreset, "sweep-benchmark", "bucketbench-layer-sweep.yaml", "File to write the layer sweep benchmark to")
+}
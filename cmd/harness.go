@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/estesp/bucketbench/benches"
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	harnessImage   string
+	harnessHostPID bool
+)
+
+var harnessCmd = &cobra.Command{
+	Use:   "harness",
+	Short: "Print the docker run command line to run a benchmark with bucketbench in a container",
+	Long: `Prints a docker run command line which runs the benchmark YAML given with
+--benchmark/-b in the bucketbench container image, passing through the engine
+sockets of its drivers, its rootfs or SIF image and the current directory
+(mounted at /bench, the working directory of the container). With --host-pid (the default)
+the container shares the host's PID namespace, so the engine daemons can be
+monitored. Drivers which create containers themselves (runc, OCI runtimes,
+nspawn, podman, apptainer) need a privileged container with the runtime
+binaries in the image.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if yamlFile == "" {
+			return fmt.Errorf("No YAML file provided with --benchmark/-b; nothing to do")
+		}
+		benchmark, err := readYaml(yamlFile)
+		if err != nil {
+			return fmt.Errorf("Error reading benchmark file %q: %v", yamlFile, err)
+		}
+		args = []string{"docker", "run", "--rm", "-v", "$PWD:/bench"}
+		if harnessHostPID {
+			args = append(args, "--pid=host")
+		}
+		mounts := make(map[string]bool)
+		privileged := false
+		for _, entry := range benchmark.Drivers {
+			dtype, err := entry.DriverType()
+			if err != nil {
+				return fmt.Errorf("Invalid configuration for driver %s: %v", entry.Type, err)
+			}
+			if socket := harnessSocket(dtype, entry.Binary); socket != "" {
+				mounts[socket] = true
+			}
+			switch dtype {
+			case driver.Runc, driver.OCI, driver.Nspawn, driver.Podman, driver.Apptainer:
+				privileged = true
+			}
+			if dtype == driver.Runc || dtype == driver.Ctr || dtype == driver.OCI || dtype == driver.Nspawn {
+				if benchmark.RootFs != "" {
+					mounts[benchmark.RootFs] = true
+				}
+			}
+			if dtype == driver.Apptainer && benchmark.SIF != "" {
+				mounts[benchmark.SIF] = true
+			}
+		}
+		bench := filepath.ToSlash(yamlFile)
+		if filepath.IsAbs(yamlFile) {
+			mounts[yamlFile] = true
+		}
+		var paths []string
+		for path := range mounts {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			args = append(args, "-v", path+":"+path)
+		}
+		if privileged {
+			args = append(args, "--privileged")
+		}
+		args = append(args, harnessImage, "run", "-b", bench)
+		fmt.Println(strings.Join(args, " "))
+		return nil
+	},
+}
+
+// harnessSocket returns the engine socket a driver configuration connects to
+func harnessSocket(dtype driver.Type, path string) string {
+	switch dtype {
+	case driver.DockerAPI, driver.Containerd, driver.PodmanAPI, driver.CRI, driver.Firecracker:
+		// the path of the API drivers is the socket
+		if path != "" {
+			return strings.TrimPrefix(path, "unix://")
+		}
+	}
+	return driver.DaemonSocket(dtype)
+}
+
+// checkHarness warns about benchmark settings which cannot work when
+// bucketbench itself runs in a container without the required passthrough
+func checkHarness(benchmark benches.Benchmark) {
+	container := utils.DetectHarnessContainer()
+	if container == nil {
+		return
+	}
+	log.Infof("Running in a %s container (host PID namespace: %v)", container.Engine, container.HostPID)
+	for _, entry := range benchmark.Drivers {
+		dtype, err := entry.DriverType()
+		if err != nil {
+			continue
+		}
+		if socket := harnessSocket(dtype, entry.Binary); socket != "" && !utils.IsSocket(socket) {
+			log.Warnf("Driver %s: engine socket %s is not mounted into the bucketbench container; pass -v %s:%s", entry.Type, socket, socket, socket)
+		}
+	}
+	if !container.HostPID && (benchmark.MonitorInterval != "" || benchmark.PerfCounters ||
+		benchmark.CollectorEnabled("daemon") || benchmark.CollectorEnabled("perf")) {
+		log.Warnf("The engine daemons are not visible from the bucketbench container's PID namespace; run it with --pid=host to monitor them")
+	}
+	if benchmark.RestartDaemon {
+		log.Warnf("restartDaemonBetweenConfigs runs systemctl, which is usually not available in the bucketbench container")
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(harnessCmd)
+	harnessCmd.Flags().StringVarP(&yamlFile, "benchmark", "b", "", "YAML file with benchmark definition")
+	harnessCmd.Flags().StringVar(&harnessImage, "image", "bucketbench", "Image of the bucketbench container")
+	harnessCmd.Flags().BoolVar(&harnessHostPID, "host-pid", true, "Share the host's PID namespace so the engine daemons can be monitored")
+}
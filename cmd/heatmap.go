@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/estesp/bucketbench/benches/output"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var heatmapOutput string
+
+var heatmapCmd = &cobra.Command{
+	Use:   "heatmap RESULTS.json",
+	Short: "Draw latency-over-time heatmaps of JSON benchmark results",
+	Long: `Draws a heatmap of the latency of each command over the course of the run,
+per driver and thread count, from results saved with --format json (or the
+results.json of an output directory). Warmup effects and periodic stalls which
+the summary statistics average away stand out in the heatmaps. The output is a
+standalone SVG image or, for a .html output file, an interactive plotly page.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("One result file is required")
+		}
+		var format string
+		switch strings.ToLower(filepath.Ext(heatmapOutput)) {
+		case ".svg":
+			format = output.FormatSVG
+		case ".html", ".htm":
+			format = output.FormatHTML
+		default:
+			return fmt.Errorf("The heatmap output file %q must be a .svg or .html file", heatmapOutput)
+		}
+		report, err := readReport(args[0])
+		if err != nil {
+			return err
+		}
+		sink, err := output.NewFileSink(heatmapOutput, format, precision)
+		if err != nil {
+			return err
+		}
+		if err := sink.Write(report); err != nil {
+			return fmt.Errorf("Error writing heatmaps to %q: %v", heatmapOutput, err)
+		}
+		log.Infof("Heatmaps of %s written to %s", args[0], heatmapOutput)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(heatmapCmd)
+	heatmapCmd.Flags().StringVarP(&heatmapOutput, "output", "o", "heatmap.html", "File to write the heatmaps to (.svg or .html)")
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/estesp/bucketbench/benches/output"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyDB        string
+	historyBenchmark string
+	historyDriver    string
+	historyHost      string
+	historyTag       string
+	historyLimit     int
+	showFormat       string
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the benchmark runs stored in the history",
+	Long: `Lists the runs stored in the history database by 'bucketbench run --history'
+(or a history output), oldest first, with the rate of each driver at each
+thread count. Filtering by benchmark, host, driver name and tag (a label of
+the result names, such as version:26.0) shows how a driver's rates developed
+across runs, e.g. across engine versions labeled with a driver version. Use
+'bucketbench show' for the full results of a run, or 'bucketbench ui' to
+explore the history in a browser.
+
+The listed runs are followed by their p99 anomalies: the commands whose p99
+latency shifted from the earlier runs of the same driver, thread count and
+host by more than --anomaly-threshold robust standard deviations. A command's
+baseline is the exponentially weighted moving average of its earlier p99s,
+and the spread the scaled median absolute deviation of the latest 20 of them;
+a command is only checked once it has 5 earlier runs.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		history, err := output.OpenHistory(historyDB)
+		if err != nil {
+			return err
+		}
+		defer history.Close()
+		entries, err := history.Entries()
+		if err != nil {
+			return err
+		}
+		filter := output.HistoryFilter{
+			Benchmark: historyBenchmark,
+			Host:      historyHost,
+			Driver:    historyDriver,
+			Tag:       historyTag,
+		}
+		matched := filter.Entries(entries)
+		if historyLimit > 0 && len(matched) > historyLimit {
+			matched = matched[len(matched)-historyLimit:]
+		}
+		if len(matched) == 0 {
+			fmt.Printf("No stored runs in %s\n", historyDB)
+			return nil
+		}
+		threads := 0
+		for _, entry := range matched {
+			for _, result := range entry.Results {
+				if len(result.Rates) > threads {
+					threads = len(result.Rates)
+				}
+			}
+		}
+		w := tabwriter.NewWriter(os.Stdout, 10, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "ID\tTime\tBenchmark\tRun ID\tHost\tResult\t1 thrd")
+		for i := 2; i <= threads; i++ {
+			fmt.Fprintf(w, "\t%d thrds", i)
+		}
+		fmt.Fprintln(w, "\t")
+		for _, entry := range matched {
+			runID := entry.RunID
+			if runID == "" {
+				runID = "-"
+			}
+			for _, result := range entry.Results {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s", entry.ID, entry.Time.Format("2006-01-02 15:04"), entry.Benchmark, runID, entry.Hostname, result.Name)
+				for _, rate := range result.Rates {
+					fmt.Fprintf(w, "\t%.2f", rate)
+				}
+				fmt.Fprintln(w, "\t")
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if anomalyThreshold <= 0 {
+			return nil
+		}
+		anomalies, err := history.Anomalies(anomalyThreshold)
+		if err != nil {
+			return err
+		}
+		return writeHistoryAnomalies(matched, anomalies)
+	},
+}
+
+// writeHistoryAnomalies lists the anomalies of the listed runs and results
+func writeHistoryAnomalies(matched []output.HistoryEntry, anomalies []output.Anomaly) error {
+	listed := make(map[string]bool)
+	for _, entry := range matched {
+		for _, result := range entry.Results {
+			listed[fmt.Sprintf("%d/%s", entry.ID, result.Name)] = true
+		}
+	}
+	var shown []output.Anomaly
+	for _, a := range anomalies {
+		if listed[fmt.Sprintf("%d/%s", a.ID, a.Name)] {
+			shown = append(shown, a)
+		}
+	}
+	if len(shown) == 0 {
+		return nil
+	}
+	fmt.Printf("\nP99 ANOMALIES (shifts from the earlier runs of the host beyond %.1f robust standard deviations)\n\n", anomalyThreshold)
+	w := tabwriter.NewWriter(os.Stdout, 10, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tResult\tThreads\tCommand\tP99\tBaseline\tScore\t\n")
+	for _, a := range shown {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%.2f\t%.2f\t%+.1f\t\n", a.ID, a.Name, a.Threads, a.Command, a.P99, a.Baseline, a.Score)
+	}
+	return w.Flush()
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show ID|RUN-ID",
+	Short: "Show the results of a benchmark run stored in the history",
+	Long: `Prints the results of a run stored in the history database, by the ID
+listed by 'bucketbench history' or by the run ID it ran with (the latest run
+with that run ID).`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("One stored run ID is required; see 'bucketbench history'")
+		}
+		if showFormat != output.FormatText && showFormat != output.FormatJSON {
+			return fmt.Errorf("Unknown output format %q; use %q or %q", showFormat, output.FormatText, output.FormatJSON)
+		}
+		history, err := output.OpenHistory(historyDB)
+		if err != nil {
+			return err
+		}
+		defer history.Close()
+		entry, report, err := history.Report(args[0])
+		if err != nil {
+			return err
+		}
+		if showFormat == output.FormatJSON {
+			return output.WriteJSON(os.Stdout, report)
+		}
+		fmt.Printf("RUN %d: %s on %s at %s\n", entry.ID, entry.Benchmark, entry.Hostname, entry.Time.Format("2006-01-02 15:04:05"))
+		output.WriteText(os.Stdout, report, precision)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(historyCmd)
+	RootCmd.AddCommand(showCmd)
+	for _, c := range []*cobra.Command{historyCmd, showCmd} {
+		c.Flags().StringVar(&historyDB, "db", output.DefaultHistoryPath(), "History database file")
+	}
+	historyCmd.Flags().StringVar(&historyBenchmark, "benchmark", "", "Only list runs of the benchmark with this name")
+	historyCmd.Flags().StringVar(&historyDriver, "driver", "", "Only list the results whose name contains this driver (e.g. \"Docker[version\")")
+	historyCmd.Flags().StringVar(&historyHost, "host", "", "Only list runs on the host with this name")
+	historyCmd.Flags().StringVar(&historyTag, "tag", "", "Only list the results with this label, or a label with this key (e.g. \"version:26.0\" or \"runtime\")")
+	historyCmd.Flags().Float64Var(&anomalyThreshold, "anomaly-threshold", output.DefaultAnomalyThreshold, "Deviation of a p99 from the earlier runs of the host, in robust standard deviations, listed as an anomaly (0 disables)")
+	historyCmd.Flags().IntVarP(&historyLimit, "last", "n", 0, "Only list the last N matching runs")
+	showCmd.Flags().StringVar(&showFormat, "format", output.FormatText, "Output format of the results: text or json")
+	showCmd.Flags().IntVar(&precision, "precision", 2, "Decimal places of the rates and millisecond statistics in the results")
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/estesp/bucketbench/benches"
+	"github.com/estesp/bucketbench/benches/output"
+	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
+)
+
+// gitRevision is the git revision bucketbench was built from, set with
+//
+//	go build -ldflags "-X github.com/estesp/bucketbench/cmd.gitRevision=$(git rev-parse HEAD)"
+var gitRevision string
+
+// buildInfo identifies the bucketbench binary; without a revision set at
+// build time, the VCS revision stamped by module builds is used
+func buildInfo() output.BuildInfo {
+	info := output.BuildInfo{Revision: gitRevision, GoVersion: runtime.Version()}
+	if info.Revision == "" {
+		if build, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range build.Settings {
+				if setting.Key == "vcs.revision" {
+					info.Revision = setting.Value
+				}
+			}
+		}
+	}
+	if info.Revision == "" {
+		info.Revision = "unknown"
+	}
+	return info
+}
+
+// newManifest records the environment of a run which started at the given
+// time; the engines are queried now, while any nested engines are still up
+func newManifest(benchmark benches.Benchmark, benchmarkFile string, started time.Time) output.Manifest {
+	config, _ := ioutil.ReadFile(benchmarkFile)
+	manifest := output.Manifest{
+		ManifestVersion: output.ManifestVersion,
+		Benchmark:       benchmark.Name,
+		RunID:           benchmark.RunID,
+		Started:         started.UTC().Format(time.RFC3339),
+		Finished:        time.Now().UTC().Format(time.RFC3339),
+		Args:            os.Args,
+		Bucketbench:     buildInfo(),
+		Host:            output.NewManifestHost(),
+		Config:          string(config),
+	}
+	for _, entry := range benchmark.Drivers {
+		manifest.Engines = append(manifest.Engines, engineVersion(entry))
+	}
+	return manifest
+}
+
+// engineVersion returns the Info of a driver's engine
+func engineVersion(entry benches.DriverConfig) output.EngineVersion {
+	version := output.EngineVersion{Driver: entry.Type, Binary: entry.Binary}
+	dtype, err := entry.DriverType()
+	if err != nil {
+		version.Error = err.Error()
+		return version
+	}
+	restoreEnv, err := utils.SetEnv(entry.Env)
+	if err != nil {
+		version.Error = err.Error()
+		return version
+	}
+	defer restoreEnv()
+	drv, err := driver.New(dtype, entry.Config())
+	if err != nil {
+		version.Error = err.Error()
+		return version
+	}
+	ctx := context.Background()
+	defer drv.Close(ctx)
+	if version.Info, err = drv.Info(ctx); err != nil {
+		version.Error = err.Error()
+	}
+	return version
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/estesp/bucketbench/benches/output"
+	log "github.com/sirupsen/logrus"
+)
+
+// Layout of a run's output directory
+const (
+	outputConfigFile      = "benchmark.yaml"
+	outputResultsJSONFile = "results.json"
+	outputResultsTextFile = "results.txt"
+	outputRawCSVFile      = "raw.csv"
+	outputHeatmapFile     = "heatmap.svg"
+	outputManifestFile    = "manifest.json"
+	outputLogsDir         = "logs"
+	outputLogFile         = "bucketbench.log"
+	outputProfilesDir     = "profiles"
+)
+
+// prepareOutputDir creates the output directory layout, stores a copy of the
+// benchmark config (and calibration profile, if any) and starts copying the
+// log to logs/bucketbench.log; the returned log file is closed by the caller
+func prepareOutputDir(dir, benchmarkFile, calibrationFile string) (*os.File, error) {
+	for _, sub := range []string{outputLogsDir, outputProfilesDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := copyFile(benchmarkFile, filepath.Join(dir, outputConfigFile)); err != nil {
+		return nil, err
+	}
+	if calibrationFile != "" {
+		if err := copyFile(calibrationFile, filepath.Join(dir, outputProfilesDir, filepath.Base(calibrationFile))); err != nil {
+			return nil, err
+		}
+	}
+	logFile, err := os.Create(filepath.Join(dir, outputLogsDir, outputLogFile))
+	if err != nil {
+		return nil, err
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+	return logFile, nil
+}
+
+// writeRunArtifacts stores the results and manifest of the run in the output
+// directory
+func writeRunArtifacts(dir string, report output.Report, manifest output.Manifest) error {
+	artifacts := []struct {
+		file   string
+		format string
+	}{
+		{outputResultsJSONFile, output.FormatJSON},
+		{outputResultsTextFile, output.FormatText},
+		{outputRawCSVFile, output.FormatCSV},
+		{outputHeatmapFile, output.FormatSVG},
+	}
+	for _, artifact := range artifacts {
+		sink, err := output.NewFileSink(filepath.Join(dir, artifact.file), artifact.format, precision)
+		if err != nil {
+			return err
+		}
+		if err := sink.Write(report); err != nil {
+			return err
+		}
+	}
+	if err := output.WriteManifest(filepath.Join(dir, outputManifestFile), manifest); err != nil {
+		return err
+	}
+	log.Infof("Run results stored in %s", dir)
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, data, 0644)
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/estesp/bucketbench/benches"
+	log "github.com/sirupsen/logrus"
+)
+
+// handlePauseSignals pauses a running benchmark on SIGUSR1 and resumes
+// it on SIGUSR2
+func handlePauseSignals() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range sigs {
+			switch sig {
+			case syscall.SIGUSR1:
+				log.Warn("Pausing benchmark threads after their current iteration (SIGUSR2 to resume)")
+				benches.Pause()
+			case syscall.SIGUSR2:
+				log.Warn("Resuming benchmark threads")
+				benches.Resume()
+			}
+		}
+	}()
+}
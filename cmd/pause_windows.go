@@ -0,0 +1,5 @@
+package cmd
+
+// handlePauseSignals is a no-op on Windows which has no SIGUSR1/SIGUSR2
+func handlePauseSignals() {
+}
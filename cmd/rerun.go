@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/estesp/bucketbench/benches"
+	"github.com/estesp/bucketbench/benches/output"
+	log "github.com/sirupsen/logrus"
+)
+
+// rerunTarget is a thread count of a driver configuration with regressed
+// metrics, to be run again
+type rerunTarget struct {
+	name    string
+	threads int
+	// driver is the index of the driver configuration in the benchmark
+	driver int
+	deltas []output.Delta
+}
+
+// rerunRegressed runs the driver configurations and thread counts of the
+// benchmark with regressions in deltas again, with factor times the
+// iterations, and compares the reruns, normalized by hostFactor (see
+// output.HostFactor), with the old report. A regression is
+// confirmed if the metric regressed by more than the threshold in the rerun
+// too, and dismissed otherwise. It returns the number of confirmed
+// regressions.
+func rerunRegressed(benchmarkFile string, old, current output.Report, deltas []output.Delta, factor int, hostFactor float64) (int, error) {
+	benchmark, err := readYaml(benchmarkFile)
+	if err != nil {
+		return 0, fmt.Errorf("Error reading benchmark file %q: %v", benchmarkFile, err)
+	}
+	if benchmark.Drivers, err = benchmark.ExpandMatrix(); err != nil {
+		return 0, err
+	}
+	targets, err := rerunTargets(&benchmark, current, deltas)
+	if err != nil {
+		return 0, err
+	}
+	for i := range benchmark.Drivers {
+		benchmark.Drivers[i].Iterations *= factor
+	}
+	handlePauseSignals()
+	ctx := cancelOnInterrupt()
+	nested, err := startNestedEngines(&benchmark)
+	defer stopNestedEngines(nested)
+	if err != nil {
+		return 0, err
+	}
+
+	rerun := output.Report{Benchmark: current.Benchmark}
+	for _, target := range targets {
+		log.Infof("Rerunning %s with %d threads and %d iterations to confirm %d regressions", target.name, target.threads, benchmark.Drivers[target.driver].Iterations, len(target.deltas))
+		run, err := rerunStep(ctx, benchmark, target)
+		if err != nil {
+			return 0, err
+		}
+		if ctx.Err() != nil {
+			return 0, fmt.Errorf("Rerun of the regressed benchmarks interrupted")
+		}
+		rerun.Results = append(rerun.Results, output.Result{
+			Name:       target.name,
+			Iterations: benchmark.Drivers[target.driver].Iterations,
+			Threads:    target.threads,
+			Runs:       []output.Run{run},
+		})
+	}
+
+	rerunDeltas := make(map[string]output.Delta)
+	for _, d := range output.Compare(old, output.Normalize(rerun, hostFactor), compareThreshold) {
+		rerunDeltas[deltaKey(d)] = d
+	}
+	fmt.Printf("\nRERUN OF REGRESSED BENCHMARKS (%dx iterations, threshold %.1f%%)\n\n", factor, compareThreshold)
+	w := tabwriter.NewWriter(os.Stdout, 10, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "Driver\tThreads\tMetric\tOld\tNew\tRerun\tDelta\t\t\n")
+	confirmed := 0
+	for _, target := range targets {
+		for _, d := range target.deltas {
+			verdict := "dismissed"
+			rerunDelta, ok := rerunDeltas[deltaKey(d)]
+			if !ok {
+				// the rerun has no value to compare, e.g. every iteration
+				// of the command failed; keep the regression
+				verdict = "CONFIRMED"
+				confirmed++
+				fmt.Fprintf(w, "%s\t%d\t%s\t%7.2f\t%7.2f\t%7s\t%7s\t%s\t\n", d.Name, d.Threads, d.Metric, d.Old, d.New, "-", "-", verdict)
+				continue
+			}
+			if rerunDelta.Regression {
+				verdict = "CONFIRMED"
+				confirmed++
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%7.2f\t%7.2f\t%7.2f\t%+6.1f%%\t%s\t\n", d.Name, d.Threads, d.Metric, d.Old, d.New, rerunDelta.New, rerunDelta.Percent, verdict)
+		}
+	}
+	w.Flush()
+	return confirmed, nil
+}
+
+// rerunTargets groups the regressions by driver configuration and thread
+// count, and reduces the benchmark to the configurations with regressions.
+// The results of a report are in the order of the benchmark's driver
+// configurations, after the limit benchmark if it ran, which is how the
+// configurations are found; a rerun is checked against the result name.
+func rerunTargets(benchmark *benches.Benchmark, current output.Report, deltas []output.Delta) ([]rerunTarget, error) {
+	configs := make(map[string]int)
+	for _, result := range current.Results {
+		if result.Name == "Limit" {
+			continue
+		}
+		if len(configs) >= len(benchmark.Drivers) {
+			return nil, fmt.Errorf("The new results have more driver configurations than the benchmark YAML; rerun with the YAML the new results were produced with")
+		}
+		configs[result.Name] = len(configs)
+	}
+	var (
+		targets []rerunTarget
+		drivers []benches.DriverConfig
+		reduced = make(map[int]int)
+		byRun   = make(map[string]int)
+	)
+	for _, d := range deltas {
+		if !d.Regression {
+			continue
+		}
+		config, ok := configs[d.Name]
+		if !ok {
+			log.Warnf("%s is not a driver configuration of the benchmark; not rerunning its regressions", d.Name)
+			continue
+		}
+		if _, ok := reduced[config]; !ok {
+			reduced[config] = len(drivers)
+			drivers = append(drivers, benchmark.Drivers[config])
+		}
+		key := runKey(d.Name, d.Threads)
+		if _, ok := byRun[key]; !ok {
+			byRun[key] = len(targets)
+			targets = append(targets, rerunTarget{name: d.Name, threads: d.Threads, driver: reduced[config]})
+		}
+		targets[byRun[key]].deltas = append(targets[byRun[key]].deltas, d)
+	}
+	benchmark.Drivers = drivers
+	return targets, nil
+}
+
+// rerunStep runs a driver configuration with the thread count of a target
+// and summarizes the run as a report run
+func rerunStep(ctx context.Context, benchmark benches.Benchmark, target rerunTarget) (output.Run, error) {
+	config := benchmark.Drivers[target.driver]
+	config.Threads = target.threads
+	if benchmark.RestartDaemon {
+		if err := restartDaemon(config); err != nil {
+			return output.Run{}, err
+		}
+	}
+	restore, err := applyStreamProcessors(config)
+	if err != nil {
+		return output.Run{}, err
+	}
+	result := newBenchResult(config)
+	err = runBenchmarkStep(ctx, config, benchmark, target.threads, &result)
+	restore()
+	if err != nil {
+		return output.Run{}, err
+	}
+	if result.name != target.name {
+		return output.Run{}, fmt.Errorf("The benchmark YAML ran %s where the new results have %s; rerun with the YAML the new results were produced with", result.name, target.name)
+	}
+	run := output.Run{
+		Threads: target.threads,
+		Rate:    output.Round(result.threadRates[0], precision),
+	}
+	if sampler := result.samplers[target.threads-1]; sampler != nil {
+		run.Commands = output.RoundSummaries(output.SummarizeSampler(sampler), precision)
+	} else {
+		run.Commands = output.RoundSummaries(output.Summarize(result.statistics[target.threads-1]), precision)
+	}
+	return run, nil
+}
+
+// deltaKey identifies a metric of a driver at a thread count
+func deltaKey(d output.Delta) string {
+	return runKey(d.Name, d.Threads) + ":" + d.Metric
+}
+
+// runKey identifies a driver at a thread count
+func runKey(name string, threads int) string {
+	return fmt.Sprintf("%s:%d", name, threads)
+}
@@ -15,29 +15,55 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
-
 	"os"
-	"text/tabwriter"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/estesp/bucketbench/benches"
+	"github.com/estesp/bucketbench/benches/output"
 	"github.com/estesp/bucketbench/driver"
+	"github.com/estesp/bucketbench/utils"
 	"github.com/go-yaml/yaml"
-	"github.com/montanaflynn/stats"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 const (
 	defaultLimitThreads = 10
 	defaultLimitIter    = 1000
+	daemonReadyTimeout  = 60 * time.Second
+
+	// scheduleSerial runs each driver's full benchmark one after another
+	scheduleSerial = "serial"
+	// scheduleInterleaved alternates between drivers for each thread count
+	scheduleInterleaved = "interleaved"
 )
 
 var (
-	yamlFile  string
-	trace     bool
-	skipLimit bool
+	yamlFile        string
+	trace           bool
+	traceDir        string
+	skipLimit       bool
+	calibrationFile string
+	outputFormat    string
+	csvFile         string
+	outputDir       string
+	precision       int
+	exact           bool
+	strict          bool
+	forceClean      bool
+	runID           string
+	manifestFile    string
+	progress        time.Duration
+	saveHistory     bool
+	// anomalyThreshold is shared by run and history
+	anomalyThreshold float64
 )
 
 // simple structure to handle collecting output data which will be displayed
@@ -47,7 +73,13 @@ type benchResult struct {
 	threads     int
 	iterations  int
 	threadRates []float64
+	imageDigest string
 	statistics  [][]benches.RunStatistics
+	samplers    []*benches.Sampler
+	metrics     []map[string]float64
+	stacks      [][]benches.BlockedStack
+	health      []map[string]string
+	started     []time.Time
 }
 
 var runCmd = &cobra.Command{
@@ -61,24 +93,152 @@ iterations and number of concurrent threads. Results will be displayed afterward
 		if yamlFile == "" {
 			return fmt.Errorf("No YAML file provided with --benchmark/-b; nothing to do")
 		}
+		if outputFormat != output.FormatText && outputFormat != output.FormatJSON {
+			return fmt.Errorf("Unknown output format %q; use %q or %q", outputFormat, output.FormatText, output.FormatJSON)
+		}
 		benchmark, err := readYaml(yamlFile)
 		if err != nil {
 			return fmt.Errorf("Error reading benchmark file %q: %v", yamlFile, err)
 		}
+		benchType, err := benchmark.BenchType()
+		if err != nil {
+			return err
+		}
+		if benchmark.Drivers, err = benchmark.ExpandMatrix(); err != nil {
+			return err
+		}
+		if precision < 0 {
+			return fmt.Errorf("Invalid --precision %d: must be zero or more decimal places", precision)
+		}
+		if exact {
+			benchmark.Exact = true
+		}
+		if strict {
+			benchmark.Strict = true
+		}
+		if forceClean {
+			benchmark.ForceClean = true
+		}
+		if runID != "" {
+			benchmark.RunID = runID
+		}
+		if traceDir != "" {
+			benchmark.TraceDir = traceDir
+		} else if benchmark.TraceDir == "" && outputDir != "" {
+			benchmark.TraceDir = filepath.Join(outputDir, "traces")
+		}
+		if _, err := benchmark.NamePrefix(); err != nil {
+			return err
+		}
 		// verify that an image name exists in the benchmark as
 		// we'll end up erroring out further down if no image is
 		// specified
-		if benchmark.Image == "" {
-			return fmt.Errorf("Please provide an 'image:' entry in your benchmark YAML")
+		if benchType == benches.Pull {
+			if len(benchmark.PullImages()) == 0 {
+				return fmt.Errorf("Please provide an 'images:' list in your pull benchmark YAML")
+			}
+			if _, err := benchmark.PullSteps(); err != nil {
+				return err
+			}
+			for _, driverEntry := range benchmark.Drivers {
+				if driverEntry.Image != "" {
+					return fmt.Errorf("Driver image %q is not supported by the pull benchmark; list the images in 'images:'", driverEntry.Image)
+				}
+			}
+		} else if benchmark.Image == "" {
+			for _, driverEntry := range benchmark.Drivers {
+				if driverEntry.Image == "" {
+					return fmt.Errorf("Please provide an 'image:' entry in your benchmark YAML")
+				}
+			}
+		}
+		for _, driverEntry := range benchmark.Drivers {
+			driverType, err := driverEntry.DriverType()
+			if err != nil {
+				return fmt.Errorf("Invalid configuration for driver %s: %v", driverEntry.Type, err)
+			}
+			if benchType == benches.Pull || benchType == benches.Serverless {
+				// these benchmark types do not use the commands list
+				continue
+			}
+			if benchType == benches.Mix {
+				if err := benches.ValidateMix(benchmark.Mix, driverType); err != nil {
+					return fmt.Errorf("Invalid mix for driver %s: %v", driverEntry.Type, err)
+				}
+				continue
+			}
+			if err := benches.ValidateCommands(benchmark.Commands, driverType); err != nil {
+				return fmt.Errorf("Invalid commands list for driver %s: %v", driverEntry.Type, err)
+			}
+			if driverType == driver.Generic {
+				if err := benches.ValidateGenericCommands(benchmark.Commands, *driverEntry.Templates); err != nil {
+					return fmt.Errorf("Invalid commands list for driver %s: %v", driverEntry.Type, err)
+				}
+			}
+		}
+
+		started := time.Now()
+		checkHarness(benchmark)
+		if err := benches.Preflight(benchmark); err != nil {
+			return err
+		}
+		if err := benches.CheckTunables(benchmark); err != nil {
+			return err
+		}
+		if err := benches.ApplyHarnessPriority(benchmark); err != nil {
+			return err
+		}
+		defer benches.RestorePriorities()
+		if err := benches.ApplyHarnessAffinity(benchmark); err != nil {
+			return err
+		}
+		defer benches.RestoreAffinities()
+		if err := benches.ApplyHarnessGC(benchmark); err != nil {
+			return err
+		}
+		if err := benches.ApplyRateLimits(benchmark); err != nil {
+			return err
 		}
 
-		var (
-			maxThreads = defaultLimitThreads
-			results    []benchResult
-		)
+		if outputDir != "" {
+			logFile, err := prepareOutputDir(outputDir, yamlFile, calibrationFile)
+			if err != nil {
+				return fmt.Errorf("Error preparing output directory %q: %v", outputDir, err)
+			}
+			defer logFile.Close()
+		}
+
+		var calibration *benches.CalibrationProfile
+		if calibrationFile != "" {
+			profile, err := benches.ReadCalibration(calibrationFile)
+			if err != nil {
+				return err
+			}
+			calibration = &profile
+		}
+		handlePauseSignals()
+		ctx := cancelOnInterrupt()
+		sinks, err := newSinks(benchmark)
+		if err != nil {
+			return err
+		}
+		if progress > 0 {
+			p := output.NewProgress(os.Stderr, progress)
+			benches.AddObserver(p)
+			p.Start()
+			defer p.Stop()
+		}
+
+		nested, err := startNestedEngines(&benchmark)
+		defer stopNestedEngines(nested)
+		if err != nil {
+			return err
+		}
+
+		var results []benchResult
 		if !skipLimit {
 			// get thread limit stats
-			limitRates := runLimitTest()
+			limitRates := runLimitTest(ctx)
 			limitResult := benchResult{
 				name:        "Limit",
 				threads:     defaultLimitThreads,
@@ -86,33 +246,167 @@ iterations and number of concurrent threads. Results will be displayed afterward
 				threadRates: limitRates,
 			}
 			results = append(results, limitResult)
-		} else {
-			maxThreads = 0 // no limit results in output
 		}
 
-		for _, driverEntry := range benchmark.Drivers {
-			result, err := runBenchmark(driverEntry, benchmark)
+		switch benchmark.Schedule {
+		case "", scheduleSerial:
+			for _, driverEntry := range benchmark.Drivers {
+				if benchmark.RestartDaemon {
+					if err := restartDaemon(driverEntry); err != nil {
+						return err
+					}
+				}
+				restore, err := applyStreamProcessors(driverEntry)
+				if err != nil {
+					return err
+				}
+				result, err := runBenchmark(ctx, driverEntry, benchmark)
+				restore()
+				if err != nil {
+					return err
+				}
+				results = append(results, result)
+				if ctx.Err() != nil {
+					break
+				}
+			}
+		case scheduleInterleaved:
+			driverResults, err := runInterleaved(ctx, benchmark)
 			if err != nil {
 				return err
 			}
-			results = append(results, result)
-			maxThreads = intMax(maxThreads, driverEntry.Threads)
+			results = append(results, driverResults...)
+		default:
+			return fmt.Errorf("Unknown schedule %q in benchmark YAML; use %q or %q", benchmark.Schedule, scheduleSerial, scheduleInterleaved)
 		}
 		// output benchmark results
-		outputRunDetails(maxThreads, results)
+		report := newReport(benchmark, calibration, results)
+		detectAnomalies(benchmark, &report)
+		manifest := newManifest(benchmark, yamlFile, started)
+		if outputDir != "" {
+			if err := writeRunArtifacts(outputDir, report, manifest); err != nil {
+				return fmt.Errorf("Error writing results to output directory %q: %v", outputDir, err)
+			}
+		}
+		if manifestFile != "" {
+			if err := output.WriteManifest(manifestFile, manifest); err != nil {
+				return fmt.Errorf("Error writing run manifest %q: %v", manifestFile, err)
+			}
+		}
+		if err := sinks.Write(report); err != nil {
+			return err
+		}
 
+		if ctx.Err() != nil {
+			return fmt.Errorf("Benchmark run interrupted; the results cover only the runs completed before the interrupt")
+		}
 		log.Info("Benchmark runs complete")
 		return nil
 	},
 }
 
-func runLimitTest() []float64 {
+// cancelOnInterrupt returns a context which is canceled on the first SIGINT or
+// SIGTERM, interrupting in-flight operations so the run stops cleanly
+func cancelOnInterrupt() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Warnf("Received %v; canceling benchmark run", sig)
+		signal.Stop(sigs)
+		cancel()
+		// release any paused threads so they can observe the cancellation
+		benches.Resume()
+	}()
+	return ctx
+}
+
+// detectAnomalies records the p99 shifts of the results from the earlier runs
+// of the host in the history database they are stored in (--history, or else
+// the first history output) in the report, so every output, including a
+// webhook, carries them. A history which can't be read only warns.
+func detectAnomalies(benchmark benches.Benchmark, report *output.Report) {
+	if anomalyThreshold <= 0 {
+		return
+	}
+	path := ""
+	if saveHistory {
+		path = historyDB
+	}
+	for _, config := range benchmark.Outputs {
+		if path == "" && strings.ToLower(config.Type) == "history" {
+			path = config.Path
+			if path == "" {
+				path = output.DefaultHistoryPath()
+			}
+		}
+	}
+	if path == "" {
+		return
+	}
+	history, err := output.OpenHistory(path)
+	if err != nil {
+		log.Warnf("Can't check the results for anomalies: %v", err)
+		return
+	}
+	defer history.Close()
+	anomalies, err := history.AnomaliesOf(*report, anomalyThreshold)
+	if err != nil {
+		log.Warnf("Can't check the results for anomalies: %v", err)
+		return
+	}
+	for _, a := range anomalies {
+		log.Warnf("The p99 of %s of %s with %d threads shifted to %.2f ms from a baseline of %.2f ms (score %+.1f)", a.Command, a.Name, a.Threads, a.P99, a.Baseline, a.Score)
+	}
+	report.Anomalies = anomalies
+}
+
+// newSinks creates the sinks the results are written to: the console in the
+// --format format (unless the YAML lists a console output), the --output-csv
+// file, the --history database, the prometheus shorthand and the outputs
+// listed in the YAML. Sinks which observe the run are registered as observers.
+func newSinks(benchmark benches.Benchmark) (output.MultiSink, error) {
+	configs := benchmark.Outputs
+	hasConsole := false
+	for _, config := range configs {
+		if strings.ToLower(config.Type) == "console" {
+			hasConsole = true
+		}
+	}
+	if !hasConsole {
+		configs = append([]benches.OutputConfig{{Type: "console", Format: outputFormat}}, configs...)
+	}
+	if csvFile != "" {
+		configs = append(configs, benches.OutputConfig{Type: "file", Path: csvFile, Format: output.FormatCSV})
+	}
+	if saveHistory {
+		configs = append(configs, benches.OutputConfig{Type: "history", Path: historyDB})
+	}
+	if benchmark.Prometheus != nil {
+		configs = append(configs, benches.OutputConfig{Type: "prometheus", PrometheusConfig: *benchmark.Prometheus})
+	}
+	var sinks output.MultiSink
+	for _, config := range configs {
+		sink, err := output.NewSink(config, precision)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s output: %v", config.Type, err)
+		}
+		if observer, ok := sink.(benches.Observer); ok {
+			benches.AddObserver(observer)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func runLimitTest(ctx context.Context) []float64 {
 	var rates []float64
 	// get thread limit stats
 	for i := 1; i <= defaultLimitThreads; i++ {
 		limit, _ := benches.New(benches.Limit)
-		limit.Init("", driver.Null, "", "", "", trace)
-		limit.Run(i, defaultLimitIter, nil)
+		limit.Init(benches.Benchmark{}, benches.DriverConfig{}, "", trace)
+		limit.Run(ctx, i, defaultLimitIter, nil)
 		duration := limit.Elapsed()
 		rate := float64(i*defaultLimitIter) / duration.Seconds()
 		rates = append(rates, rate)
@@ -121,164 +415,344 @@ func runLimitTest() []float64 {
 	return rates
 }
 
-func runBenchmark(driverConfig benches.DriverConfig, benchmark benches.Benchmark) (benchResult, error) {
-	var (
-		rates     []float64
-		stats     [][]benches.RunStatistics
-		benchInfo string
-	)
-	driverType := driver.StringToType(driverConfig.Type)
-	stats = make([][]benches.RunStatistics, driverConfig.Threads)
-
-	for i := 1; i <= driverConfig.Threads; i++ {
-		bench, _ := benches.New(benches.Custom)
-		imageInfo := benchmark.Image
-		if driverType == driver.Runc || driverType == driver.Ctr {
-			// legacy ctr mode and runc drivers need an exploded rootfs
-			// first, verify thta a rootfs was provided in the benchmark YAML
-			if benchmark.RootFs == "" {
-				return benchResult{}, fmt.Errorf("No rootfs defined in the benchmark YAML; driver %s requires a root FS path", driverConfig.Type)
-			}
-			imageInfo = benchmark.RootFs
+// startNestedEngines starts a nested engine for each driver configuration
+// which asks for one, pointing the configuration at the nested engine's socket
+func startNestedEngines(benchmark *benches.Benchmark) ([]*driver.NestedEngine, error) {
+	var engines []*driver.NestedEngine
+	for i, driverEntry := range benchmark.Drivers {
+		if driverEntry.Nested == "" {
+			continue
 		}
-		err := bench.Init(benchmark.Name, driverType, driverConfig.Binary, imageInfo, benchmark.Command, trace)
+		engine, err := driver.StartNestedEngine(driverEntry.Nested, driverEntry.NestedImage)
 		if err != nil {
-			return benchResult{}, err
+			return engines, fmt.Errorf("Error starting nested engine for driver %s: %v", driverEntry.Type, err)
 		}
-		benchInfo = bench.Info()
-		if err = bench.Validate(); err != nil {
-			return benchResult{}, fmt.Errorf("Error during bench validate: %v", err)
+		engines = append(engines, engine)
+		benchmark.Drivers[i].Binary = engine.Socket()
+	}
+	return engines, nil
+}
+
+func stopNestedEngines(engines []*driver.NestedEngine) {
+	for _, engine := range engines {
+		if err := engine.Stop(); err != nil {
+			log.Errorf("Error stopping %s nested engine: %v", engine.Kind(), err)
 		}
-		err = bench.Run(i, driverConfig.Iterations, benchmark.Commands)
-		if err != nil {
-			return benchResult{}, fmt.Errorf("Error during bench run: %v", err)
+	}
+}
+
+// restartDaemon restarts the engine daemon used by a driver configuration and
+// waits until the driver can successfully query it again
+func restartDaemon(driverConfig benches.DriverConfig) error {
+	driverType, err := driverConfig.DriverType()
+	if err != nil {
+		return err
+	}
+	restoreEnv, err := utils.SetEnv(driverConfig.Env)
+	if err != nil {
+		return err
+	}
+	defer restoreEnv()
+	if driverConfig.Nested != "" {
+		// restarting the host daemon would take the nested engine down with it
+		log.Infof("Driver %s runs a nested engine; skipping daemon restart", driverConfig.Type)
+		return nil
+	}
+	service := driverConfig.DaemonService
+	if service == "" {
+		service = driver.DaemonService(driverType)
+	}
+	if service == "" {
+		log.Infof("Driver %s has no daemon; skipping daemon restart", driverConfig.Type)
+		return nil
+	}
+	log.Infof("Restarting daemon service %q before %s benchmark", service, driverConfig.Type)
+	if out, err := utils.ExecCmd("systemctl", "restart "+service); err != nil {
+		return fmt.Errorf("Error restarting daemon service %q: %v (output: %s)", service, err, out)
+	}
+	deadline := time.Now().Add(daemonReadyTimeout)
+	for {
+		drv, err := driver.New(driverType, driverConfig.Config())
+		if err == nil {
+			_, err = drv.Info(context.Background())
+			drv.Close(context.Background())
 		}
-		duration := bench.Elapsed()
-		rate := float64(i*driverConfig.Iterations) / duration.Seconds()
-		rates = append(rates, rate)
-		stats[i-1] = bench.Stats()
-		log.Infof("%s: threads %d, iterations %d, rate: %6.2f", benchInfo, i, driverConfig.Iterations, rate)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Daemon service %q not ready %v after restart: %v", service, daemonReadyTimeout, err)
+		}
+		time.Sleep(500 * time.Millisecond)
 	}
-	result := benchResult{
-		name:        benchInfo,
-		threads:     driverConfig.Threads,
-		iterations:  driverConfig.Iterations,
-		threadRates: rates,
-		statistics:  stats,
+}
+
+func runBenchmark(ctx context.Context, driverConfig benches.DriverConfig, benchmark benches.Benchmark) (benchResult, error) {
+	result := newBenchResult(driverConfig)
+	for i := 1; i <= driverConfig.Threads && ctx.Err() == nil; i++ {
+		if err := runBenchmarkStep(ctx, driverConfig, benchmark, i, &result); err != nil {
+			return benchResult{}, err
+		}
 	}
 	return result, nil
 }
 
-func outputRunDetails(maxThreads int, results []benchResult) {
-	w := tabwriter.NewWriter(os.Stdout, 10, 4, 2, ' ', tabwriter.AlignRight)
-
-	fmt.Printf("\nSUMMARY TIMINGS/THREAD RATES\n\n")
-	fmt.Fprintf(w, " \tIter/Thd\t1 thrd")
-	for i := 2; i <= maxThreads; i++ {
-		fmt.Fprintf(w, "\t%d thrds", i)
+// runInterleaved runs the benchmark from a work queue holding one slice per
+// (thread count, driver) pair, ordered so that every driver runs its slice for
+// a thread count before any driver moves to the next one. Over a long suite
+// this spreads any drift in host behavior evenly across the drivers.
+func runInterleaved(ctx context.Context, benchmark benches.Benchmark) ([]benchResult, error) {
+	type slice struct {
+		driver  int
+		threads int
 	}
-	fmt.Fprintln(w, "\t ")
-
-	for _, result := range results {
-		fmt.Fprintf(w, "%s\t%d\t%7.2f", result.name, result.iterations, result.threadRates[0])
-		for i := 1; i < result.threads; i++ {
-			fmt.Fprintf(w, "\t%7.2f", result.threadRates[i])
+	var (
+		queue      []slice
+		maxThreads int
+		results    = make([]benchResult, len(benchmark.Drivers))
+	)
+	for i, driverConfig := range benchmark.Drivers {
+		results[i] = newBenchResult(driverConfig)
+		maxThreads = intMax(maxThreads, driverConfig.Threads)
+	}
+	for threads := 1; threads <= maxThreads; threads++ {
+		for i, driverConfig := range benchmark.Drivers {
+			if threads <= driverConfig.Threads {
+				queue = append(queue, slice{driver: i, threads: threads})
+			}
 		}
-		fmt.Fprintln(w, "\t ")
 	}
-	w.Flush()
-	fmt.Println("")
-
-	fmt.Printf("DETAILED COMMAND TIMINGS/STATISTICS\n")
-	// output per-command timings across the runs as well
-	for _, result := range results {
-		for i := 0; i < result.threads; i++ {
-			fmt.Fprintf(w, "%s:%d\tMin\tMax\tAvg\tMedian\tStddev\tErrors\t\n", result.name, i+1)
-			cmdTimings := parseStats(result.statistics[i])
-			for cmd, stats := range cmdTimings {
-				fmt.Fprintf(w, "%s\t%6.2f\t%6.2f\t%6.2f\t%6.2f\t%6.2f\t%d\t\n", cmd, stats.min, stats.max, stats.avg, stats.median, stats.stddev, stats.errors)
+	for _, s := range queue {
+		if ctx.Err() != nil {
+			break
+		}
+		driverConfig := benchmark.Drivers[s.driver]
+		if benchmark.RestartDaemon {
+			if err := restartDaemon(driverConfig); err != nil {
+				return nil, err
 			}
 		}
-		fmt.Println("")
+		restore, err := applyStreamProcessors(driverConfig)
+		if err != nil {
+			return nil, err
+		}
+		err = runBenchmarkStep(ctx, driverConfig, benchmark, s.threads, &results[s.driver])
+		restore()
+		if err != nil {
+			return nil, err
+		}
 	}
-	w.Flush()
+	return ranResults(results), nil
 }
 
-type statResults struct {
-	min    float64
-	max    float64
-	avg    float64
-	median float64
-	stddev float64
-	errors int
+// ranResults drops the results of the drivers an interrupted run never got to
+func ranResults(results []benchResult) []benchResult {
+	var ran []benchResult
+	for _, result := range results {
+		if len(result.threadRates) > 0 {
+			ran = append(ran, result)
+		}
+	}
+	return ran
 }
 
-func parseStats(statistics []benches.RunStatistics) map[string]statResults {
-	result := make(map[string]statResults)
-	durationSeq := make(map[string][]float64)
-	errorSeq := make(map[string][]int)
-	iterations := len(statistics)
+func newBenchResult(driverConfig benches.DriverConfig) benchResult {
+	return benchResult{
+		threads:    driverConfig.Threads,
+		iterations: driverConfig.Iterations,
+		statistics: make([][]benches.RunStatistics, driverConfig.Threads),
+		samplers:   make([]*benches.Sampler, driverConfig.Threads),
+		metrics:    make([]map[string]float64, driverConfig.Threads),
+		stacks:     make([][]benches.BlockedStack, driverConfig.Threads),
+		health:     make([]map[string]string, driverConfig.Threads),
+		started:    make([]time.Time, driverConfig.Threads),
+	}
+}
 
-	durationKeys := make([]string, len(statistics[0].Durations))
-	i := 0
-	for k := range statistics[0].Durations {
-		durationKeys[i] = k
-		i++
+// runBenchmarkStep runs the benchmark for a driver with a single thread count
+// and records the rate and statistics into the driver's result
+func runBenchmarkStep(ctx context.Context, driverConfig benches.DriverConfig, benchmark benches.Benchmark, threads int, result *benchResult) error {
+	driverType, err := driverConfig.DriverType()
+	if err != nil {
+		return err
 	}
-	for i := 0; i < iterations; i++ {
-		for key, duration := range statistics[i].Durations {
-			durationSeq[key] = append(durationSeq[key], float64(duration))
-		}
-		for key, errors := range statistics[i].Errors {
-			errorSeq[key] = append(errorSeq[key], errors)
-		}
+	benchType, err := benchmark.BenchType()
+	if err != nil {
+		return err
 	}
-	for _, key := range durationKeys {
-		// take the durations for this key and perform
-		// several math/statistical functions:
-		min, err := stats.Min(durationSeq[key])
-		if err != nil {
-			log.Errorf("Error finding stats.Min(): %v", err)
-		}
-		max, err := stats.Max(durationSeq[key])
-		if err != nil {
-			log.Errorf("Error finding stats.Max(): %v", err)
-		}
-		average, err := stats.Mean(durationSeq[key])
-		if err != nil {
-			log.Errorf("Error finding stats.Average(): %v", err)
+	bench, err := benches.New(benchType)
+	if err != nil {
+		return err
+	}
+	// driver configurations never run concurrently, so their environment
+	// is set on the process for the duration of the run
+	restoreEnv, err := utils.SetEnv(driverConfig.Env)
+	if err != nil {
+		return err
+	}
+	defer restoreEnv()
+	image := benchmark.Image
+	if driverConfig.Image != "" {
+		image = driverConfig.Image
+	}
+	imageInfo := image
+	if benchType != benches.Pull && (driverType == driver.Runc || driverType == driver.Ctr || driverType == driver.OCI || driverType == driver.Nspawn) {
+		// legacy ctr mode, runc, OCI runtime and nspawn drivers need an exploded rootfs
+		// first, verify thta a rootfs was provided in the benchmark YAML
+		if benchmark.RootFs == "" {
+			return fmt.Errorf("No rootfs defined in the benchmark YAML; driver %s requires a root FS path", driverConfig.Type)
 		}
-		median, err := stats.Median(durationSeq[key])
-		if err != nil {
-			log.Errorf("Error finding stats.Median(): %v", err)
+		imageInfo = benchmark.RootFs
+	}
+	if driverType == driver.Apptainer && benchType != benches.Pull {
+		// apptainer runs a SIF image, or converts the OCI image on every run
+		imageInfo = "docker://" + image
+		if benchmark.SIF != "" {
+			imageInfo = benchmark.SIF
 		}
-		stddev, err := stats.StandardDeviation(durationSeq[key])
-		if err != nil {
-			log.Errorf("Error finding stats.StdDev(): %v", err)
+	}
+	if result.imageDigest != "" {
+		// later thread counts run the image pinned by the first one
+		imageInfo = benches.PinnedReference(imageInfo, result.imageDigest)
+	}
+	if err := benches.ApplyDaemonPriority(benchmark, driverType); err != nil {
+		return err
+	}
+	if err := benches.ApplyDaemonAffinity(benchmark, driverType); err != nil {
+		return err
+	}
+	if closable, ok := bench.(benches.ClosableBench); ok {
+		defer func() {
+			if err := closable.Close(); err != nil {
+				log.Errorf("error on closing driver: %v", err)
+			}
+		}()
+	}
+	err = bench.Init(benchmark, driverConfig, imageInfo, trace)
+	if err != nil {
+		return err
+	}
+	benchInfo := bench.Info()
+	if err = bench.Validate(ctx); err != nil {
+		return fmt.Errorf("Error during bench validate: %v", err)
+	}
+	result.started[threads-1] = time.Now()
+	err = bench.Run(ctx, threads, driverConfig.Iterations, benchmark.Commands)
+	if ctx.Err() != nil {
+		// an interrupted run still reports the iterations it completed
+		log.Warnf("%s: run with %d threads interrupted; recording its partial results", benchInfo, threads)
+	} else if err != nil {
+		return fmt.Errorf("Error during bench run: %v", err)
+	}
+	duration := bench.Elapsed()
+	iterations := threads * driverConfig.Iterations
+	if ctx.Err() != nil {
+		iterations = completedIterations(bench)
+	}
+	rate := float64(iterations) / duration.Seconds()
+	result.name = benchInfo
+	result.threadRates = append(result.threadRates, rate)
+	result.statistics[threads-1] = bench.Stats()
+	if pinned, ok := bench.(benches.PinnedBench); ok && pinned.ImageDigest() != "" {
+		if result.imageDigest != "" && result.imageDigest != pinned.ImageDigest() {
+			return fmt.Errorf("Image %s changed from %s to %s between runs of %s", image, result.imageDigest, pinned.ImageDigest(), benchInfo)
 		}
-		var errors int
-		if errorSlice, ok := errorSeq[key]; ok {
-			errors = intSum(errorSlice)
+		result.imageDigest = pinned.ImageDigest()
+	}
+	if sampled, ok := bench.(benches.SampledBench); ok {
+		result.samplers[threads-1] = sampled.Sampler()
+	}
+	if sampled, ok := bench.(benches.StackSampledBench); ok {
+		result.stacks[threads-1] = sampled.BlockedStacks()
+	}
+	if collecting, ok := bench.(benches.CollectorHealthBench); ok {
+		result.health[threads-1] = collecting.CollectorHealth()
+	}
+	result.metrics[threads-1] = bench.Metrics()
+	log.Infof("%s: threads %d, iterations %d, rate: %6.2f", benchInfo, threads, driverConfig.Iterations, rate)
+	return nil
+}
+
+// completedIterations returns the number of iterations a run completed, for
+// the rate of an interrupted run
+func completedIterations(bench benches.Bench) int {
+	if sampled, ok := bench.(benches.SampledBench); ok && sampled.Sampler() != nil {
+		return sampled.Sampler().Seen()
+	}
+	return len(bench.Stats())
+}
+
+// newReport converts the collected results into the report schema shared by
+// the JSON and CSV outputs
+func newReport(benchmark benches.Benchmark, calibration *benches.CalibrationProfile, results []benchResult) output.Report {
+	report := output.Report{
+		Benchmark:   benchmark.Name,
+		RunID:       benchmark.RunID,
+		Commands:    benchmark.Steps(),
+		Environment: output.NewEnvironment(),
+		Calibration: calibration,
+		Priority:    benchmark.Priority,
+		CPUAffinity: benchmark.CPUAffinity,
+	}
+	if benchmark.Tunables != nil {
+		// record the required tunables along with the snapshot
+		report.Environment.Tunables = utils.ReadTunables(benchmark.TunableNames())
+	}
+	for _, result := range results {
+		jsonResult := output.Result{
+			Name:        result.name,
+			Iterations:  result.iterations,
+			Threads:     result.threads,
+			ImageDigest: result.imageDigest,
 		}
-		result[key] = statResults{
-			min:    min,
-			max:    max,
-			avg:    average,
-			median: median,
-			stddev: stddev,
-			errors: errors,
+		for i, rate := range result.threadRates {
+			run := output.Run{
+				Threads: i + 1,
+				Rate:    output.Round(rate, precision),
+			}
+			// the limit benchmark only records rates
+			if i < len(result.statistics) {
+				if sampler := result.samplers[i]; sampler != nil {
+					// the statistics are a sample; summarize every iteration
+					run.Commands = output.RoundSummaries(output.SummarizeSampler(sampler), precision)
+					run.SampledFrom = sampler.Seen()
+				} else {
+					run.Commands = output.RoundSummaries(output.Summarize(result.statistics[i]), precision)
+				}
+				run.Started = result.started[i].UnixNano() / int64(time.Millisecond)
+				run.Statistics = result.statistics[i]
+				run.Metrics = result.metrics[i]
+				run.BlockedStacks = result.stacks[i]
+				run.Collectors = result.health[i]
+				if trace && report.TraceDir == "" && traced(result.statistics[i]) {
+					report.TraceDir = benchmark.TraceDir
+					if report.TraceDir == "" {
+						report.TraceDir = benches.DefaultTraceDir
+					}
+				}
+				if buckets := output.ConcurrencyBuckets(result.statistics[i]); len(buckets) > 0 {
+					run.Concurrency = output.RoundBuckets(buckets, precision)
+				}
+			}
+			jsonResult.Runs = append(jsonResult.Runs, run)
 		}
+		report.Results = append(report.Results, jsonResult)
 	}
-	return result
+	report.Scorecard = output.Scorecards(report)
+	report.Trends = output.VersionTrends(report)
+	return report
 }
 
-func intSum(slice []int) int {
-	var total int
-	for _, val := range slice {
-		total += val
+// traced returns whether any iteration of a run wrote a container trace
+func traced(stats []benches.RunStatistics) bool {
+	for _, stat := range stats {
+		if len(stat.Traces) > 0 {
+			return true
+		}
 	}
-	return total
+	return false
 }
+
 func intMax(x, y int) int {
 	if x > y {
 		return x
@@ -302,6 +776,21 @@ func readYaml(filename string) (benches.Benchmark, error) {
 func init() {
 	RootCmd.AddCommand(runCmd)
 	runCmd.PersistentFlags().StringVarP(&yamlFile, "benchmark", "b", "", "YAML file with benchmark definition")
-	runCmd.PersistentFlags().BoolVarP(&trace, "trace", "t", false, "Enable per-container tracing during benchmark runs")
+	runCmd.PersistentFlags().BoolVarP(&trace, "trace", "t", false, "Trace every container (engine events, or strace of the OCI runtime) and write the traces to the trace directory")
+	runCmd.PersistentFlags().StringVar(&traceDir, "trace-dir", "", "Directory the traces are written to with --trace (default: traces in the output directory, or ./traces; overrides traceDir in the YAML)")
 	runCmd.PersistentFlags().BoolVarP(&skipLimit, "skip-limit", "s", false, "Skip 'limit' benchmark run")
+	runCmd.PersistentFlags().StringVar(&outputFormat, "format", output.FormatText, "Output format of the results: text or json")
+	runCmd.PersistentFlags().StringVar(&outputDir, "output-dir", "", "Directory to store the benchmark config, results, raw timings and logs of this run")
+	runCmd.PersistentFlags().StringVar(&csvFile, "output-csv", "", "Also write the raw per-iteration step timings to this CSV file")
+	runCmd.PersistentFlags().IntVar(&precision, "precision", 2, "Decimal places of the rates and millisecond statistics in the results")
+	runCmd.PersistentFlags().BoolVar(&exact, "exact", false, "Time each operation in nanoseconds and compute statistics on the exact samples")
+	runCmd.PersistentFlags().BoolVar(&strict, "strict", false, "Fail instead of warning when a driver would skip a setting or stub an operation the benchmark requests")
+	runCmd.PersistentFlags().BoolVar(&forceClean, "force-clean", false, "Kill the containers and pods of earlier runs without waiting for their graceful termination in the driver cleanup")
+	runCmd.PersistentFlags().StringVar(&runID, "run-id", "", "Run ID isolating this run's containers from other bucketbench runs on the host (overrides runID in the YAML)")
+	runCmd.PersistentFlags().StringVar(&calibrationFile, "calibration", "", "Host calibration profile (from 'bucketbench calibrate') to report with the results")
+	runCmd.PersistentFlags().DurationVar(&progress, "progress", 0, "Write a progress line per running benchmark to stderr at this interval (e.g. 10s)")
+	runCmd.PersistentFlags().BoolVar(&saveHistory, "history", false, "Also store the results in the history database (see 'bucketbench history')")
+	runCmd.PersistentFlags().Float64Var(&anomalyThreshold, "anomaly-threshold", output.DefaultAnomalyThreshold, "Deviation of a p99 from its history, in robust standard deviations, reported as an anomaly when the results are stored in the history (0 disables)")
+	runCmd.PersistentFlags().StringVar(&historyDB, "history-db", output.DefaultHistoryPath(), "History database file the results are stored in with --history")
+	runCmd.PersistentFlags().StringVar(&manifestFile, "manifest", "", "Also write the run manifest (host, engine versions, config and bucketbench revision) to this file, as YAML if it ends in .yaml")
 }
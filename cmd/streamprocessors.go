@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/estesp/bucketbench/benches"
+	"github.com/estesp/bucketbench/driver"
+	log "github.com/sirupsen/logrus"
+)
+
+// applyStreamProcessors adds the stream processors of a driver configuration
+// to containerd's config and restarts containerd to load them; the returned
+// function restores the original config and restarts containerd again
+func applyStreamProcessors(driverConfig benches.DriverConfig) (func(), error) {
+	if len(driverConfig.StreamProcessors) == 0 {
+		return func() {}, nil
+	}
+	path := driverConfig.ContainerdConfig
+	if path == "" {
+		path = driver.DefaultContainerdConfig
+	}
+	restoreConfig, err := driver.WriteStreamProcessors(path, driverConfig.StreamProcessors)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Stream processors %s added to %s for %s", strings.Join(driver.StreamProcessorNames(driverConfig.StreamProcessors), ", "), path, driverConfig.Type)
+	restore := func() {
+		if err := restoreConfig(); err != nil {
+			log.Errorf("Error restoring containerd config %s: %v", path, err)
+			return
+		}
+		if err := restartDaemon(driverConfig); err != nil {
+			log.Errorf("Error restarting containerd with its original config: %v", err)
+		}
+	}
+	if err := restartDaemon(driverConfig); err != nil {
+		restore()
+		return nil, err
+	}
+	return restore, nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/estesp/bucketbench/benches/output"
+	"github.com/spf13/cobra"
+)
+
+var (
+	summaryRuns   []string
+	summaryFormat string
+)
+
+var summaryCmd = &cobra.Command{
+	Use:   "summary [FILE...]",
+	Short: "Rank the drivers across the benchmarks of a suite",
+	Long: `Summarizes a suite of benchmarks, each run separately, from their JSON
+results (--format json, or the results.json of an output directory) and/or
+the runs given with --run from the history database. For every benchmark it
+lists the drivers with the best startup, throughput, memory, teardown and
+overall score of its scorecard, then ranks the drivers in each category
+across the suite by the number of benchmarks they won and lost. Drivers are
+matched across benchmarks by their result name without the benchmark name,
+e.g. "Docker[version:26.0]".`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args)+len(summaryRuns) == 0 {
+			return fmt.Errorf("No result files or --run provided; nothing to summarize")
+		}
+		if summaryFormat != output.FormatText && summaryFormat != output.FormatJSON {
+			return fmt.Errorf("Unknown output format %q; use %q or %q", summaryFormat, output.FormatText, output.FormatJSON)
+		}
+		var reports []output.Report
+		for _, file := range args {
+			report, err := readReport(file)
+			if err != nil {
+				return err
+			}
+			reports = append(reports, report)
+		}
+		if len(summaryRuns) > 0 {
+			history, err := output.OpenHistory(historyDB)
+			if err != nil {
+				return err
+			}
+			defer history.Close()
+			for _, ref := range summaryRuns {
+				_, report, err := history.Report(ref)
+				if err != nil {
+					return err
+				}
+				reports = append(reports, report)
+			}
+		}
+		summary := output.Suite(reports)
+		if summaryFormat == output.FormatJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(summary)
+		}
+		output.WriteSuiteSummary(os.Stdout, summary)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(summaryCmd)
+	summaryCmd.Flags().StringSliceVar(&summaryRuns, "run", nil, "Also summarize the runs with these IDs or run IDs from the history")
+	summaryCmd.Flags().StringVar(&historyDB, "db", output.DefaultHistoryPath(), "History database file")
+	summaryCmd.Flags().StringVar(&summaryFormat, "format", output.FormatText, "Output format of the summary: text or json")
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/estesp/bucketbench/benches/output"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	uiListen    string
+	uiThreshold float64
+)
+
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Explore the benchmark runs stored in the history in a browser",
+	Long: `Serves a small local web app over the history database, for teams which don't
+want to stand up Grafana: the stored runs filtered by benchmark, host, driver
+and tag (a label of the result names, such as version:26.0) with the trend of
+their rates, the latency percentile charts of the commands of a run, and the
+diff of two runs, marking the changes worse than --threshold percent as
+regressions as 'bucketbench compare' does. The charts load plotly.js from its
+CDN. The database is only opened while a page is served, so benchmarks can
+store results in it meanwhile.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listener, err := net.Listen("tcp", uiListen)
+		if err != nil {
+			return err
+		}
+		server := &http.Server{Handler: output.NewExplorer(historyDB, uiThreshold)}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+		log.Infof("Exploring the history %s on http://%s", historyDB, listener.Addr())
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(uiCmd)
+	uiCmd.Flags().StringVar(&historyDB, "db", output.DefaultHistoryPath(), "History database file")
+	uiCmd.Flags().StringVarP(&uiListen, "listen", "l", "127.0.0.1:8080", "Address the web UI listens on")
+	uiCmd.Flags().Float64VarP(&uiThreshold, "threshold", "t", 10, "Percent change of any metric which counts as a regression in the diff of two runs")
+}
@@ -0,0 +1,271 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultApptainerBinary = "apptainer"
+
+// ApptainerDriver is an implementation of the driver interface for Apptainer
+// (formerly Singularity) instances, the container model of HPC sites. A
+// container is an instance started from a SIF image (or any image URI
+// Apptainer accepts, e.g. docker://alpine); the Singularity CLI is driven the
+// same way when given as the binary.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type ApptainerDriver struct {
+	cmdUsage
+	apptainerBinary string
+	namePrefix      string
+}
+
+// ApptainerContainer is an implementation of the container metadata needed
+// for an Apptainer instance
+type ApptainerContainer struct {
+	name        string
+	imageName   string
+	cmdOverride string
+	trace       bool
+}
+
+// apptainerInstances is the output of `apptainer instance list --json`
+type apptainerInstances struct {
+	Instances []struct {
+		Instance string `json:"instance"`
+	} `json:"instances"`
+}
+
+// NewApptainerDriver creates an instance of the Apptainer driver, providing a path
+// to the apptainer (or singularity) binary and the name prefix of the instances it
+// cleans up
+func NewApptainerDriver(binaryPath, namePrefix string) (Driver, error) {
+	if binaryPath == "" {
+		binaryPath = defaultApptainerBinary
+	}
+	resolvedBinPath, err := utils.ResolveBinary(binaryPath)
+	if err != nil {
+		return &ApptainerDriver{}, err
+	}
+	driver := &ApptainerDriver{
+		apptainerBinary: resolvedBinPath,
+		namePrefix:      namePrefix,
+	}
+	return driver, nil
+}
+
+// Name returns the name of the instance
+func (c *ApptainerContainer) Name() string {
+	return c.name
+}
+
+// Detached always returns true as instances run in the background
+func (c *ApptainerContainer) Detached() bool {
+	return true
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *ApptainerContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the SIF path or image URI the instance is started from
+func (c *ApptainerContainer) Image() string {
+	return c.imageName
+}
+
+// Command returns the arguments passed to the image's startscript
+func (c *ApptainerContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources is not implemented for the Apptainer driver type, which does not
+// apply resource limits
+func (c *ApptainerContainer) Resources() Resources {
+	return Resources{}
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (a *ApptainerDriver) Type() Type {
+	return Apptainer
+}
+
+// Path returns the binary path of the apptainer binary in use
+func (a *ApptainerDriver) Path() string {
+	return a.apptainerBinary
+}
+
+// Close allows the driver to handle any resource free/connection closing
+// as necessary. Apptainer has no need to perform any actions on close.
+func (a *ApptainerDriver) Close(ctx context.Context) error {
+	return nil
+}
+
+// Info returns the apptainer binary and version
+func (a *ApptainerDriver) Info(ctx context.Context) (string, error) {
+	version, err := utils.ExecCmdContext(ctx, a.apptainerBinary, "--version")
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve apptainer version info: %v (output: %s)", err, version)
+	}
+	return fmt.Sprintf("apptainer driver (binary: %s)\n[VERSION:%s]", a.apptainerBinary, strings.TrimSpace(version)), nil
+}
+
+// Create only records the instance metadata; the instance is started by Run
+func (a *ApptainerDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	return &ApptainerContainer{
+		name:        name,
+		imageName:   image,
+		cmdOverride: cmdOverride,
+		trace:       trace,
+	}, nil
+}
+
+// instances returns the names of the running instances
+func (a *ApptainerDriver) instances(ctx context.Context) ([]string, error) {
+	out, err := utils.ExecCmdContext(ctx, a.apptainerBinary, "instance list --json")
+	if err != nil {
+		return nil, fmt.Errorf("Error getting apptainer instance list: %v (output: %s)", err, out)
+	}
+	var list apptainerInstances
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return nil, fmt.Errorf("Error parsing apptainer instance list: %v (output: %s)", err, out)
+	}
+	var names []string
+	for _, instance := range list.Instances {
+		names = append(names, instance.Instance)
+	}
+	return names, nil
+}
+
+// running returns whether the instance is still listed
+func (a *ApptainerDriver) running(ctx context.Context, name string) (bool, error) {
+	names, err := a.instances(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, instance := range names {
+		if instance == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Clean will clean the environment; stopping any instances from bucketbench runs
+func (a *ApptainerDriver) Clean(ctx context.Context) error {
+	names, err := a.instances(ctx)
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for _, name := range names {
+		if strings.HasPrefix(name, a.namePrefix) {
+			stale = append(stale, name)
+		}
+	}
+	log.Infof("Apptainer: stopping %d instances from bucketbench runs", len(stale))
+	for _, name := range stale {
+		if err := paceClean(ctx); err != nil {
+			return err
+		}
+		if out, err := utils.ExecCmdContext(ctx, a.apptainerBinary, "instance stop --force "+name); err != nil {
+			log.Warnf("Apptainer: failed to stop instance %q: %v (output: %s)", name, err, out)
+		}
+	}
+	return nil
+}
+
+// Run starts an instance of the image, running its startscript with the
+// command as its arguments
+func (a *ApptainerDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	args := fmt.Sprintf("instance start %s %s", ctr.Image(), ctr.Name())
+	if ctr.Command() != "" {
+		args = args + " " + ctr.Command()
+	}
+	return a.execTimed(ctx, a.apptainerBinary, args)
+}
+
+// Stop will stop the instance, killing its processes
+func (a *ApptainerDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return a.execTimed(ctx, a.apptainerBinary, "instance stop --force "+ctr.Name())
+}
+
+// Remove stops the instance if it is still running; a stopped instance
+// leaves nothing else behind
+func (a *ApptainerDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	start := time.Now()
+	running, err := a.running(ctx, ctr.Name())
+	if err != nil {
+		return "", 0, err
+	}
+	if !running {
+		return "", utils.Elapsed(ctx, start), nil
+	}
+	return a.execTimed(ctx, a.apptainerBinary, "instance stop --force "+ctr.Name())
+}
+
+// Pause is not supported by Apptainer instances
+func (a *ApptainerDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("pause is not supported by the Apptainer driver")
+}
+
+// Unpause is not supported by Apptainer instances
+func (a *ApptainerDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("unpause is not supported by the Apptainer driver")
+}
+
+// Exec will run a command in the running instance and wait for it to exit
+func (a *ApptainerDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	return a.execTimed(ctx, a.apptainerBinary, "exec instance://"+ctr.Name()+" "+command)
+}
+
+// Wait polls the instance list until the instance has exited
+func (a *ApptainerDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	a.last = utils.Usage{}
+	start := time.Now()
+	for {
+		running, err := a.running(ctx, ctr.Name())
+		if err != nil {
+			return "", 0, err
+		}
+		if !running {
+			return "", utils.Elapsed(ctx, start), nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+// Logs is not supported by the Apptainer driver
+func (a *ApptainerDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("logs are not supported by the Apptainer driver")
+}
+
+// Checkpoint is not supported by the Apptainer driver
+func (a *ApptainerDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the Apptainer driver")
+}
+
+// Restore is not supported by the Apptainer driver
+func (a *ApptainerDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the Apptainer driver")
+}
+
+// PullImage is not supported by the Apptainer driver
+func (a *ApptainerDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return "", 0, unsupported("image pull", "Apptainer")
+}
+
+// RemoveImage is not supported by the Apptainer driver
+func (a *ApptainerDriver) RemoveImage(ctx context.Context, image string) error {
+	return unsupported("image removal", "Apptainer")
+}
@@ -1,20 +1,37 @@
+//go:build !windows
+// +build !windows
+
 package driver
 
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/containerd/containerd"
+	eventsapi "github.com/containerd/containerd/api/services/events/v1"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/typeurl"
+	"github.com/estesp/bucketbench/utils"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	log "github.com/sirupsen/logrus"
 )
 
-const defaultContainerdPath = "/run/containerd/containerd.sock"
+const defaultContainerdNamespace = "bb"
 
 // ContainerdDriver is an implementation of the driver interface for using Containerd.
 // This uses the provided client library which abstracts using the gRPC APIs directly.
@@ -24,6 +41,22 @@ type ContainerdDriver struct {
 	ctrdAddress string
 	client      *containerd.Client
 	context     context.Context
+	namespace   string
+	runtime     string
+	// snapshotter is empty for containerd's default; drivers for stacks
+	// which need a block device snapshotter (Firecracker) set it
+	snapshotter string
+	labels      map[string]string
+	resources   Resources
+	network     string
+	mounts      []Mount
+	user        string
+	namePrefix  string
+	lastUnpack  Unpack
+	// traces records the events of the traced containers until their
+	// traces are written
+	traces   map[string]*eventRecorder
+	tracesMu sync.Mutex
 }
 
 // ContainerdContainer is an implementation of the container metadata needed for containerd
@@ -34,34 +67,73 @@ type ContainerdContainer struct {
 	state       string
 	process     string
 	trace       bool
+	resources   Resources
 }
 
-// NewContainerdDriver creates an instance of the containerd driver, providing a path to the ctr client
-func NewContainerdDriver(path string) (Driver, error) {
+// NewContainerdDriver creates an instance of the containerd driver, providing the containerd socket path
+// (defaulting to CONTAINERD_ADDRESS; containers are created in the CONTAINERD_NAMESPACE namespace, or "bb")
+// and optionally a runtime name (e.g. io.containerd.runsc.v1) to create container tasks with,
+// the options of the containers it creates and the name prefix of the containers it cleans up
+func NewContainerdDriver(path, runtime string, opts ContainerOptions, namePrefix string) (Driver, error) {
+	driver, err := newContainerdDriver(path, runtime, opts, namePrefix)
+	if err != nil {
+		return &ContainerdDriver{}, err
+	}
+	return driver, nil
+}
+
+// newContainerdDriver creates the containerd driver instance which drivers
+// for containerd-based stacks build on
+func newContainerdDriver(path, runtime string, opts ContainerOptions, namePrefix string) (*ContainerdDriver, error) {
+	if path == "" {
+		path = os.Getenv("CONTAINERD_ADDRESS")
+	}
 	if path == "" {
 		path = defaultContainerdPath
 	}
+	namespace := os.Getenv("CONTAINERD_NAMESPACE")
+	if namespace == "" {
+		namespace = defaultContainerdNamespace
+	}
 	client, err := containerd.New(path)
 	if err != nil {
-		return &ContainerdDriver{}, err
+		return nil, err
 	}
-	bbCtx := namespaces.WithNamespace(context.Background(), "bb")
+	bbCtx := namespaces.WithNamespace(context.Background(), namespace)
 	driver := &ContainerdDriver{
 		ctrdAddress: path,
 		client:      client,
 		context:     bbCtx,
+		namespace:   namespace,
+		runtime:     runtime,
+		labels:      opts.Labels,
+		resources:   opts.Resources,
+		network:     opts.Network,
+		mounts:      opts.Mounts,
+		user:        opts.User,
+		namePrefix:  namePrefix,
 	}
 	return driver, nil
 }
 
+// pullOpts returns the options images are pulled and unpacked with
+func (r *ContainerdDriver) pullOpts() []containerd.RemoteOpts {
+	opts := []containerd.RemoteOpts{containerd.WithPullUnpack}
+	if r.snapshotter != "" {
+		opts = append(opts, containerd.WithPullSnapshotter(r.snapshotter))
+	}
+	return opts
+}
+
 // newContainerdContainer creates the metadata object of a containerd-specific container with
 // bundle, name, and any required additional information
-func newContainerdContainer(name, image, cmd string, trace bool) Container {
+func newContainerdContainer(name, image, cmd string, trace bool, resources Resources) Container {
 	return &ContainerdContainer{
 		name:        name,
 		imageName:   image,
 		cmdOverride: cmd,
 		trace:       trace,
+		resources:   resources,
 	}
 }
 
@@ -86,6 +158,11 @@ func (c *ContainerdContainer) Command() string {
 	return c.cmdOverride
 }
 
+// Resources returns the resource limits the container is created with
+func (c *ContainerdContainer) Resources() Resources {
+	return c.resources
+}
+
 // Process returns the process name in cases where this container instance is
 // wrapping a potentially running container
 func (c *ContainerdContainer) Process() string {
@@ -112,9 +189,16 @@ func (r *ContainerdDriver) Path() string {
 	return r.ctrdAddress
 }
 
+// Runtime returns the runtime name container tasks are created with, or an
+// empty string for containerd's default runtime
+func (r *ContainerdDriver) Runtime() string {
+	return r.runtime
+}
+
 // Close allows the driver to handle any resource free/connection closing
 // as necessary.
-func (r *ContainerdDriver) Close() error {
+func (r *ContainerdDriver) Close(ctx context.Context) error {
+	r.stopTraces()
 	if err := r.client.Close(); err != nil {
 		return err
 	}
@@ -122,8 +206,8 @@ func (r *ContainerdDriver) Close() error {
 }
 
 // Info returns
-func (r *ContainerdDriver) Info() (string, error) {
-	version, err := r.client.Version(r.context)
+func (r *ContainerdDriver) Info(ctx context.Context) (string, error) {
+	version, err := r.client.Version(namespaces.WithNamespace(ctx, r.namespace))
 	if err != nil {
 		return "", err
 	}
@@ -133,26 +217,33 @@ func (r *ContainerdDriver) Info() (string, error) {
 
 // Create will create a container instance matching the specific needs
 // of a driver
-func (r *ContainerdDriver) Create(name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+func (r *ContainerdDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
 	// we need to convert the bare Docker image name to a fully resolved
 	// reference (since the Docker driver and containerd driver share image
 	// name references)
 	fullImageName := resolveDockerImageName(image)
-	if _, err := r.client.GetImage(r.context, fullImageName); err != nil {
+	if _, err := r.client.GetImage(ctx, fullImageName); err != nil {
 		// if the image isn't already in our namespaced context, then pull it
 		// using the reference and default resolver (most likely DockerHub)
-		if _, err := r.client.Pull(r.context, fullImageName, containerd.WithPullUnpack); err != nil {
+		if _, err := r.client.Pull(ctx, fullImageName, r.pullOpts()...); err != nil {
 			// error pulling the image
 			return nil, err
 		}
 	}
-	return newContainerdContainer(name, fullImageName, cmdOverride, trace), nil
+	if trace {
+		if err := r.startTrace(name); err != nil {
+			return nil, fmt.Errorf("Error subscribing to containerd events to trace container %s: %v", name, err)
+		}
+	}
+	return newContainerdContainer(name, fullImageName, cmdOverride, trace, r.resources), nil
 }
 
 // Clean will clean the environment; removing any remaining containers in the runc metadata
-func (r *ContainerdDriver) Clean() error {
+func (r *ContainerdDriver) Clean(ctx context.Context) error {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
 	var tries int
-	list, err := r.client.Containers(r.context)
+	list, err := r.containers(ctx)
 	if err != nil {
 		return fmt.Errorf("Error getting containerd list output: %v", err)
 	}
@@ -162,15 +253,18 @@ func (r *ContainerdDriver) Clean() error {
 		log.Infof("containerd cleanup: Pass #%d", tries+1)
 		// kill/stop and remove containers
 		for _, ctr := range list {
-			if err := stopTask(r.context, ctr); err != nil {
+			if err := paceClean(ctx); err != nil {
+				return err
+			}
+			if err := stopTask(ctx, ctr); err != nil {
 				log.Errorf("Error stopping container: %v", err)
 			}
-			if err := ctr.Delete(r.context, containerd.WithRootFSDeletion); err != nil {
+			if err := ctr.Delete(ctx, containerd.WithRootFSDeletion); err != nil {
 				log.Errorf("Error deleting container %v", err)
 			}
 		}
 		tries++
-		list, err = r.client.Containers(r.context)
+		list, err = r.containers(ctx)
 		if err != nil {
 			return fmt.Errorf("Error getting containerd list output: %v", err)
 		}
@@ -179,117 +273,413 @@ func (r *ContainerdDriver) Clean() error {
 	return nil
 }
 
+// containers lists the containers of the bb namespace named with the driver's prefix
+func (r *ContainerdDriver) containers(ctx context.Context) ([]containerd.Container, error) {
+	all, err := r.client.Containers(namespaces.WithNamespace(ctx, r.namespace))
+	if err != nil {
+		return nil, err
+	}
+	var list []containerd.Container
+	for _, ctr := range all {
+		if strings.HasPrefix(ctr.ID(), r.namePrefix) {
+			list = append(list, ctr)
+		}
+	}
+	return list, nil
+}
+
+// applyResources sets the resource limits of a container in its generated
+// spec
+func applyResources(spec *specs.Spec, ctr Container) {
+	resources := ctr.Resources()
+	if !resources.IsSet() {
+		return
+	}
+	if spec.Linux == nil {
+		spec.Linux = &specs.Linux{}
+	}
+	if spec.Linux.Resources == nil {
+		spec.Linux.Resources = &specs.LinuxResources{}
+	}
+	if resources.CPUs > 0 {
+		period, quota := uint64(cpuPeriod), resources.cpuQuota()
+		spec.Linux.Resources.CPU = &specs.LinuxCPU{Period: &period, Quota: &quota}
+	}
+	if resources.Memory > 0 {
+		limit := resources.Memory
+		spec.Linux.Resources.Memory = &specs.LinuxMemory{Limit: &limit}
+	}
+	if resources.CgroupParent != "" {
+		spec.Linux.CgroupsPath = cgroupsPath(resources.CgroupParent, ctr.Name())
+	}
+}
+
+// cgroupsPath returns the cgroups path of a container under a cgroup parent.
+// A systemd slice parent (e.g. "bucketbench.slice") is taken to mean the
+// runtime uses the systemd cgroup driver, which expects a "slice:prefix:name"
+// path and creates the container's scope in the slice; any other parent is a
+// cgroupfs path the container's cgroup is created under.
+func cgroupsPath(parent, name string) string {
+	if strings.HasSuffix(parent, ".slice") {
+		return parent + ":bucketbench:" + name
+	}
+	return filepath.Join(parent, name)
+}
+
 // Run will execute a container using the containerd driver.
-func (r *ContainerdDriver) Run(ctr Container) (string, int, error) {
+func (r *ContainerdDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
 	start := time.Now()
-	image, err := r.client.GetImage(r.context, ctr.Image())
+	image, err := r.client.GetImage(ctx, ctr.Image())
 	if err != nil {
 		return "", 0, err
 	}
-	var spec *specs.Spec
+	specOpts := []containerd.SpecOpts{containerd.WithImageConfig(ctx, image)}
 	if ctr.Command() != "" {
 		// the command needs to be overridden in the generated spec
-		spec, err = containerd.GenerateSpec(containerd.WithImageConfig(r.context, image),
-			containerd.WithProcessArgs(strings.Split(ctr.Command(), " ")...))
-	} else {
-		spec, err = containerd.GenerateSpec(containerd.WithImageConfig(r.context, image))
+		specOpts = append(specOpts, containerd.WithProcessArgs(strings.Split(ctr.Command(), " ")...))
 	}
+	if r.network == NetworkHost {
+		specOpts = append(specOpts, containerd.WithHostNamespace(specs.NetworkNamespace))
+	}
+	spec, err := containerd.GenerateSpec(specOpts...)
 	if err != nil {
 		return "", 0, err
 	}
-	container, err := r.client.NewContainer(r.context, ctr.Name(),
+	applyResources(spec, ctr)
+	if uid, gid, hasGID, ok := numericUser(r.user); ok {
+		spec.Process.User.UID = uid
+		if hasGID {
+			spec.Process.User.GID = gid
+		}
+	}
+	for _, m := range r.mounts {
+		if m.Type != MountVolume {
+			spec.Mounts = append(spec.Mounts, specMount(m))
+		}
+	}
+	opts := []containerd.NewContainerOpts{
 		containerd.WithSpec(spec),
 		containerd.WithImage(image),
-		containerd.WithNewRootFS(ctr.Name(), image))
+	}
+	if r.snapshotter != "" {
+		// the root filesystem snapshot is prepared with the container's snapshotter
+		opts = append(opts, containerd.WithSnapshotter(r.snapshotter))
+	}
+	opts = append(opts, containerd.WithNewRootFS(ctr.Name(), image))
+	if r.runtime != "" {
+		opts = append(opts, containerd.WithRuntime(r.runtime))
+	}
+	if len(r.labels) > 0 {
+		opts = append(opts, containerd.WithContainerLabels(r.labels))
+	}
+	container, err := r.client.NewContainer(ctx, ctr.Name(), opts...)
 	if err != nil {
 		return "", 0, err
 	}
 
 	stdouterr := bytes.NewBuffer(nil)
-	task, err := container.NewTask(r.context, containerd.NewIO(bytes.NewBuffer(nil), stdouterr, stdouterr))
+	task, err := container.NewTask(ctx, containerd.NewIO(bytes.NewBuffer(nil), stdouterr, stdouterr))
 	if err != nil {
 		return "", 0, err
 	}
-	if err := task.Start(r.context); err != nil {
-		task.Delete(r.context)
+	if err := task.Start(ctx); err != nil {
+		task.Delete(ctx)
 		return "", 0, err
 	}
-	elapsed := time.Since(start)
-	msElapsed := int(elapsed.Nanoseconds() / 1000000)
-	return stdouterr.String(), msElapsed, nil
+	return stdouterr.String(), utils.Elapsed(ctx, start), nil
 }
 
 // Stop will stop/kill a container (specifically, the tasks [processes]
 // running in the container)
-func (r *ContainerdDriver) Stop(ctr Container) (string, int, error) {
+func (r *ContainerdDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
 	start := time.Now()
-	container, err := r.client.LoadContainer(r.context, ctr.Name())
+	container, err := r.client.LoadContainer(ctx, ctr.Name())
 	if err != nil {
 		return "", 0, err
 	}
-	if err = stopTask(r.context, container); err != nil {
+	if err = stopTask(ctx, container); err != nil {
 		return "", 0, err
 	}
-	elapsed := time.Since(start)
-	msElapsed := int(elapsed.Nanoseconds() / 1000000)
-	return "", msElapsed, nil
+	return "", utils.Elapsed(ctx, start), nil
 }
 
 // Remove will remove a container; in the containerd case we simply call kill
 // which will remove any container metadata if it was running
-func (r *ContainerdDriver) Remove(ctr Container) (string, int, error) {
+func (r *ContainerdDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
 	start := time.Now()
-	container, err := r.client.LoadContainer(r.context, ctr.Name())
+	container, err := r.client.LoadContainer(ctx, ctr.Name())
 	if err != nil {
 		return "", 0, err
 	}
-	err = container.Delete(r.context, containerd.WithRootFSDeletion)
+	err = container.Delete(ctx, containerd.WithRootFSDeletion)
 	if err != nil {
 		return "", 0, err
 	}
-	elapsed := time.Since(start)
-	msElapsed := int(elapsed.Nanoseconds() / 1000000)
-	return "", msElapsed, nil
+	return "", utils.Elapsed(ctx, start), nil
 }
 
 // Pause will pause a container
-func (r *ContainerdDriver) Pause(ctr Container) (string, int, error) {
+func (r *ContainerdDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
 	start := time.Now()
-	container, err := r.client.LoadContainer(r.context, ctr.Name())
+	container, err := r.client.LoadContainer(ctx, ctr.Name())
 	if err != nil {
 		return "", 0, err
 	}
-	task, err := container.Task(r.context, nil)
+	task, err := container.Task(ctx, nil)
 	if err != nil {
 		return "", 0, err
 	}
-	err = task.Pause(r.context)
+	err = task.Pause(ctx)
 	if err != nil {
 		return "", 0, err
 	}
-	elapsed := time.Since(start)
-	msElapsed := int(elapsed.Nanoseconds() / 1000000)
-	return "", msElapsed, nil
+	return "", utils.Elapsed(ctx, start), nil
 }
 
 // Unpause will unpause/resume a container
-func (r *ContainerdDriver) Unpause(ctr Container) (string, int, error) {
+func (r *ContainerdDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
+	start := time.Now()
+	container, err := r.client.LoadContainer(ctx, ctr.Name())
+	if err != nil {
+		return "", 0, err
+	}
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	err = task.Resume(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// Exec will run a command in the container's task and wait for it to exit
+func (r *ContainerdDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	ctx, cancel := context.WithCancel(namespaces.WithNamespace(ctx, r.namespace))
+	defer cancel()
+	start := time.Now()
+	container, err := r.client.LoadContainer(ctx, ctr.Name())
+	if err != nil {
+		return "", 0, err
+	}
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	spec, err := container.Spec()
+	if err != nil {
+		return "", 0, err
+	}
+	process := *spec.Process
+	process.Args = strings.Split(command, " ")
+	process.Terminal = false
+	// subscribe to exit events before the process starts, as the vendored
+	// client's Process.Wait misses an exit which happens before it subscribes
+	events, err := r.client.EventService().Stream(ctx, &eventsapi.StreamEventsRequest{})
+	if err != nil {
+		return "", 0, err
+	}
+	execID := fmt.Sprintf("bb-exec-%d", time.Now().UnixNano())
+	stdouterr := bytes.NewBuffer(nil)
+	proc, err := task.Exec(ctx, execID, &process, containerd.NewIO(bytes.NewBuffer(nil), stdouterr, stdouterr))
+	if err != nil {
+		return "", 0, err
+	}
+	defer proc.Delete(ctx)
+	if err := proc.Start(ctx); err != nil {
+		return "", 0, err
+	}
+	for {
+		evt, err := events.Recv()
+		if err != nil {
+			return "", 0, err
+		}
+		if !typeurl.Is(evt.Event, &eventsapi.TaskExit{}) {
+			continue
+		}
+		v, err := typeurl.UnmarshalAny(evt.Event)
+		if err != nil {
+			return "", 0, err
+		}
+		if e := v.(*eventsapi.TaskExit); e.ID == execID && e.ContainerID == ctr.Name() {
+			if e.ExitStatus != 0 {
+				return stdouterr.String(), 0, fmt.Errorf("exec of %q exited with status %d", command, e.ExitStatus)
+			}
+			return stdouterr.String(), utils.Elapsed(ctx, start), nil
+		}
+	}
+}
+
+// Wait polls the task status until the task has exited; the vendored client's
+// Task.Wait misses an exit which happens before it subscribes to events
+func (r *ContainerdDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
 	start := time.Now()
-	container, err := r.client.LoadContainer(r.context, ctr.Name())
+	container, err := r.client.LoadContainer(ctx, ctr.Name())
 	if err != nil {
 		return "", 0, err
 	}
-	task, err := container.Task(r.context, nil)
+	task, err := container.Task(ctx, nil)
 	if err != nil {
 		return "", 0, err
 	}
-	err = task.Resume(r.context)
+	for {
+		status, err := task.Status(ctx)
+		if err != nil {
+			return "", 0, err
+		}
+		if status == containerd.Stopped {
+			elapsed := utils.Elapsed(ctx, start)
+			// the exited task is deleted untimed, as Stop deletes a killed
+			// one, so Remove still times the container removal alone
+			if _, err := task.Delete(ctx); err != nil {
+				return "", 0, err
+			}
+			return "", elapsed, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+// Logs is not supported as containerd does not keep container output
+func (r *ContainerdDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("logs are not supported by the Containerd driver")
+}
+
+// Checkpoint is not supported by the Containerd driver
+func (r *ContainerdDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the Containerd driver")
+}
+
+// Restore is not supported by the Containerd driver
+func (r *ContainerdDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the Containerd driver")
+}
+
+// HasImage returns whether the image is present in the namespace
+func (r *ContainerdDriver) HasImage(ctx context.Context, image string) (bool, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
+	if _, err := r.client.GetImage(ctx, resolveDockerImageName(image)); err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// PullImage pulls and unpacks the image from its registry; the unpacking is
+// timed separately, see LastUnpack
+func (r *ContainerdDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
+	start := time.Now()
+	img, err := r.client.Pull(ctx, resolveDockerImageName(image))
 	if err != nil {
 		return "", 0, err
 	}
-	elapsed := time.Since(start)
-	msElapsed := int(elapsed.Nanoseconds() / 1000000)
-	return "", msElapsed, nil
+	unpackStart := time.Now()
+	if err := img.Unpack(ctx, r.snapshotter); err != nil {
+		return "", 0, err
+	}
+	r.lastUnpack = r.layerUnpack(ctx, img.Target())
+	r.lastUnpack.Duration = time.Since(unpackStart)
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// layerUnpack returns the codec and size of the layers of an image manifest
+func (r *ContainerdDriver) layerUnpack(ctx context.Context, target ocispec.Descriptor) Unpack {
+	unpack := Unpack{Codec: "unknown"}
+	p, err := content.ReadBlob(ctx, r.client.ContentStore(), target.Digest)
+	if err != nil {
+		return unpack
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(p, &manifest); err != nil || len(manifest.Layers) == 0 {
+		return unpack
+	}
+	codecs := make(map[string]bool)
+	for _, layer := range manifest.Layers {
+		codecs[layerCodec(layer.MediaType)] = true
+		unpack.Bytes += layer.Size
+	}
+	var names []string
+	for codec := range codecs {
+		names = append(names, codec)
+	}
+	sort.Strings(names)
+	unpack.Codec = strings.Join(names, "+")
+	return unpack
+}
+
+// LastUnpack returns the codec, size and unpack time of the layers of the
+// last image pulled
+func (r *ContainerdDriver) LastUnpack() Unpack {
+	return r.lastUnpack
+}
+
+// ImageDigest returns the digest of the manifest (or index) the image was
+// pulled as
+func (r *ContainerdDriver) ImageDigest(ctx context.Context, image string) (string, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
+	img, err := r.client.GetImage(ctx, resolveDockerImageName(image))
+	if err != nil {
+		return "", err
+	}
+	return img.Target().Digest.String(), nil
+}
+
+// RemoveImage removes the image record, the snapshots its layers were
+// unpacked to and the content blobs referenced by it, so the next use of the
+// image pulls and unpacks it from scratch
+func (r *ContainerdDriver) RemoveImage(ctx context.Context, image string) error {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
+	fullImageName := resolveDockerImageName(image)
+	img, err := r.client.ImageService().Get(ctx, fullImageName)
+	if err != nil {
+		// nothing to purge
+		return nil
+	}
+	var blobs []digest.Digest
+	cs := r.client.ContentStore()
+	collect := images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		blobs = append(blobs, desc.Digest)
+		return nil, nil
+	})
+	if err := images.Walk(ctx, images.Handlers(collect, images.ChildrenHandler(cs)), img.Target); err != nil {
+		return err
+	}
+	diffIDs, err := img.RootFS(ctx, cs)
+	if err != nil {
+		return err
+	}
+	if err := r.client.ImageService().Delete(ctx, fullImageName); err != nil {
+		return err
+	}
+	// the snapshots are committed under the chain IDs of the layers; each
+	// is the parent of the next, so they are removed from the top down
+	sn := r.client.SnapshotService(r.snapshotter)
+	chainIDs := identity.ChainIDs(diffIDs)
+	for i := len(chainIDs) - 1; i >= 0; i-- {
+		if err := sn.Remove(ctx, chainIDs[i].String()); err != nil {
+			log.Debugf("containerd: error removing snapshot %s: %v", chainIDs[i], err)
+		}
+	}
+	for _, dgst := range blobs {
+		if err := cs.Delete(ctx, dgst); err != nil {
+			log.Debugf("containerd: error deleting content %s: %v", dgst, err)
+		}
+	}
+	return nil
 }
 
 // much of this code is copied from docker/docker/reference.go
@@ -2,11 +2,13 @@ package driver
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
 )
 
 const defaultCtrBinary = "ctr"
@@ -16,7 +18,9 @@ const defaultCtrBinary = "ctr"
 // IMPORTANT: This implementation does not protect instance metadata for thread safely.
 // At this time there is no understood use case for multi-threaded use of this implementation.
 type CtrDriver struct {
-	ctrBinary string
+	cmdUsage
+	ctrBinary  string
+	namePrefix string
 }
 
 // CtrContainer is an implementation of the container metadata needed for containerd
@@ -29,7 +33,8 @@ type CtrContainer struct {
 }
 
 // NewCtrDriver creates an instance of the containerd driver, providing a path to the ctr client
-func NewCtrDriver(binaryPath string) (Driver, error) {
+// and the name prefix of the containers it cleans up
+func NewCtrDriver(binaryPath, namePrefix string) (Driver, error) {
 	if binaryPath == "" {
 		binaryPath = defaultCtrBinary
 	}
@@ -38,7 +43,8 @@ func NewCtrDriver(binaryPath string) (Driver, error) {
 		return &CtrDriver{}, err
 	}
 	driver := &CtrDriver{
-		ctrBinary: resolvedBinPath,
+		ctrBinary:  resolvedBinPath,
+		namePrefix: namePrefix,
 	}
 	return driver, nil
 }
@@ -74,6 +80,12 @@ func (c *CtrContainer) Command() string {
 	return ""
 }
 
+// Resources is not implemented for the legacy `ctr` driver type, which does not
+// apply resource limits
+func (c *CtrContainer) Resources() Resources {
+	return Resources{}
+}
+
 // Process returns the process name in cases where this container instance is
 // wrapping a potentially running container
 func (c *CtrContainer) Process() string {
@@ -102,18 +114,18 @@ func (r *CtrDriver) Path() string {
 
 // Close allows the driver to handle any resource free/connection closing
 // as necessary. Ctr has no need to perform any actions on close.
-func (r *CtrDriver) Close() error {
+func (r *CtrDriver) Close(ctx context.Context) error {
 	return nil
 }
 
 // Info returns
-func (r *CtrDriver) Info() (string, error) {
+func (r *CtrDriver) Info(ctx context.Context) (string, error) {
 	info := "containerd legacy driver (ctr client binary: " + r.ctrBinary + ")"
-	clientVersionInfo, err := utils.ExecCmd(r.ctrBinary, "--v")
+	clientVersionInfo, err := utils.ExecCmdContext(ctx, r.ctrBinary, "--v")
 	if err != nil {
 		return "", fmt.Errorf("Error trying to retrieve containerd client version info: %v", err)
 	}
-	daemonVersionInfo, err := utils.ExecCmd(r.ctrBinary, "version")
+	daemonVersionInfo, err := utils.ExecCmdContext(ctx, r.ctrBinary, "version")
 	if err != nil {
 		return "", fmt.Errorf("Error trying to retrieve containerd daemon version info: %v", err)
 	}
@@ -124,80 +136,119 @@ func (r *CtrDriver) Info() (string, error) {
 
 // Create will create a container instance matching the specific needs
 // of a driver
-func (r *CtrDriver) Create(name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+func (r *CtrDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
 	return newCtrContainer(name, image, trace), nil
 }
 
 // Clean will clean the environment; removing any remaining containers in the runc metadata
-func (r *CtrDriver) Clean() error {
+func (r *CtrDriver) Clean(ctx context.Context) error {
 	var tries int
-	out, err := utils.ExecCmd(r.ctrBinary, "containers")
+	out, err := utils.ExecCmdContext(ctx, r.ctrBinary, "containers")
 	if err != nil {
 		return fmt.Errorf("Error getting containerd list output: (err: %v) output: %s", err, out)
 	}
 	// try up to 3 times to handle any remaining containers in the runc list
-	containers := parseContainerdList(out)
+	containers := parseContainerdList(out, r.namePrefix)
 	log.Infof("Attempting to cleanup containerd containers/metadata; %d listed", len(containers))
 	for len(containers) > 0 && tries < 3 {
 		log.Infof("containerd cleanup: Pass #%d", tries+1)
 		for _, ctr := range containers {
+			if err := paceClean(ctx); err != nil {
+				return err
+			}
 			switch ctr.State() {
 			case "running":
 				log.Infof("Attempting stop and remove on container %q", ctr.Name())
-				r.Stop(ctr)
-				r.Remove(ctr)
+				r.Stop(ctx, ctr)
+				r.Remove(ctx, ctr)
 			case "paused":
 				log.Infof("Attempting unpause and removal of container %q", ctr.Name())
-				r.Unpause(ctr)
-				r.Remove(ctr)
+				r.Unpause(ctx, ctr)
+				r.Remove(ctx, ctr)
 			case "stopped":
 				log.Infof("Attempting remove of container %q", ctr.Name())
-				r.Remove(ctr)
+				r.Remove(ctx, ctr)
 			default:
 				log.Warnf("Unknown state %q for ctr %q", ctr.State(), ctr.Name())
 			}
 		}
 		tries++
-		out, err := utils.ExecCmd(r.ctrBinary, "containers")
+		out, err := utils.ExecCmdContext(ctx, r.ctrBinary, "containers")
 		if err != nil {
 			return fmt.Errorf("Error getting containerd list output: %v", err)
 		}
-		containers = parseContainerdList(out)
+		containers = parseContainerdList(out, r.namePrefix)
 	}
 	log.Infof("containerd cleanup complete.")
 	return nil
 }
 
 // Run will execute a container using the containerd driver.
-func (r *CtrDriver) Run(ctr Container) (string, int, error) {
+func (r *CtrDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
 	args := fmt.Sprintf("containers start %s %s", ctr.Name(), ctr.Image())
 	// the "NoOut" variant of ExecTimedCmd ignores stdin/out/err (sets them to /dev/null)
-	return utils.ExecTimedCmdNoOut(r.ctrBinary, args)
+	return r.execTimedNoOut(ctx, r.ctrBinary, args)
 }
 
 // Stop will stop/kill a container
-func (r *CtrDriver) Stop(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(r.ctrBinary, "containers kill "+ctr.Name())
+func (r *CtrDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.ctrBinary, "containers kill "+ctr.Name())
 }
 
 // Remove will remove a container; in the containerd case we simply call kill
 // which will remove any container metadata if it was running
-func (r *CtrDriver) Remove(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(r.ctrBinary, "containers kill "+ctr.Name())
+func (r *CtrDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.ctrBinary, "containers kill "+ctr.Name())
 }
 
 // Pause will pause a container
-func (r *CtrDriver) Pause(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(r.ctrBinary, "containers pause "+ctr.Name())
+func (r *CtrDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.ctrBinary, "containers pause "+ctr.Name())
 }
 
 // Unpause will unpause/resume a container
-func (r *CtrDriver) Unpause(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(r.ctrBinary, "containers resume "+ctr.Name())
+func (r *CtrDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.ctrBinary, "containers resume "+ctr.Name())
+}
+
+// Exec will run a command in a running container and wait for it to exit
+func (r *CtrDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	args := fmt.Sprintf("containers exec --id %s --pid bb-exec-%d --cwd / %s", ctr.Name(), time.Now().UnixNano(), command)
+	return r.execTimed(ctx, r.ctrBinary, args)
+}
+
+// Wait is not supported by the legacy ctr client
+func (r *CtrDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("wait is not supported by the Ctr driver")
+}
+
+// Logs is not supported as containerd does not keep container output
+func (r *CtrDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("logs are not supported by the Ctr driver")
+}
+
+// Checkpoint is not supported by the Ctr driver
+func (r *CtrDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the Ctr driver")
+}
+
+// Restore is not supported by the Ctr driver
+func (r *CtrDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the Ctr driver")
+}
+
+// PullImage is not supported by the Ctr driver
+func (r *CtrDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return "", 0, unsupported("image pull", "Ctr")
+}
+
+// RemoveImage is not supported by the Ctr driver
+func (r *CtrDriver) RemoveImage(ctx context.Context, image string) error {
+	return unsupported("image removal", "Ctr")
 }
 
 // take the output of "runc list" and parse into container instances
-func parseContainerdList(listOutput string) []*CtrContainer {
+func parseContainerdList(listOutput, prefix string) []*CtrContainer {
 	var results []*CtrContainer
 	reader := strings.NewReader(listOutput)
 	scan := bufio.NewScanner(reader)
@@ -214,6 +265,10 @@ func parseContainerdList(listOutput string) []*CtrContainer {
 			log.Warnf("containerd list parsing found invalid line: %q", line)
 			continue
 		}
+		// don't delete containers that aren't part of our benchmark run!
+		if !strings.HasPrefix(parts[0], prefix) {
+			continue
+		}
 		ctr := &CtrContainer{
 			name:       parts[0],
 			bundlePath: parts[1],
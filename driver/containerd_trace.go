@@ -0,0 +1,124 @@
+//go:build !windows
+// +build !windows
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	eventsapi "github.com/containerd/containerd/api/services/events/v1"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/typeurl"
+	log "github.com/sirupsen/logrus"
+)
+
+// eventRecorder records the events of one container from containerd's event
+// stream while the container is traced; containerd keeps no event history,
+// so the stream is subscribed to when the container is created
+type eventRecorder struct {
+	sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	lines  []byte
+}
+
+// traceEvent is a line of a containerd event trace
+type traceEvent struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Topic     string          `json:"topic"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// startTrace subscribes to containerd's events and records those of the
+// named container: its container and task events, and the snapshot events of
+// its root filesystem, which is keyed by the container's name
+func (r *ContainerdDriver) startTrace(name string) error {
+	ctx, cancel := context.WithCancel(namespaces.WithNamespace(context.Background(), r.namespace))
+	events, err := r.client.EventService().Stream(ctx, &eventsapi.StreamEventsRequest{})
+	if err != nil {
+		cancel()
+		return err
+	}
+	rec := &eventRecorder{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(rec.done)
+		for {
+			evt, err := events.Recv()
+			if err != nil {
+				return
+			}
+			v, err := typeurl.UnmarshalAny(evt.Event)
+			if err != nil {
+				continue
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				continue
+			}
+			var ids struct {
+				ID          string `json:"id"`
+				ContainerID string `json:"container_id"`
+				Key         string `json:"key"`
+			}
+			json.Unmarshal(data, &ids)
+			if ids.ID != name && ids.ContainerID != name && ids.Key != name {
+				continue
+			}
+			line, err := json.Marshal(traceEvent{Timestamp: evt.Timestamp, Topic: evt.Topic, Event: data})
+			if err != nil {
+				continue
+			}
+			rec.Lock()
+			rec.lines = append(append(rec.lines, line...), '\n')
+			rec.Unlock()
+		}
+	}()
+	r.tracesMu.Lock()
+	if r.traces == nil {
+		r.traces = make(map[string]*eventRecorder)
+	}
+	if old, ok := r.traces[name]; ok {
+		old.cancel()
+	}
+	r.traces[name] = rec
+	r.tracesMu.Unlock()
+	return nil
+}
+
+// WriteTrace stops recording the events of the container and writes them,
+// one JSON object per line with its timestamp, topic and event
+func (r *ContainerdDriver) WriteTrace(ctx context.Context, name string, start, end time.Time, dir string) ([]string, error) {
+	r.tracesMu.Lock()
+	rec, ok := r.traces[name]
+	delete(r.traces, name)
+	r.tracesMu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	// events are delivered asynchronously; give the last ones a moment
+	time.Sleep(100 * time.Millisecond)
+	rec.cancel()
+	<-rec.done
+	rec.Lock()
+	defer rec.Unlock()
+	path, err := writeTraceFile(dir, name, ".events.json", rec.lines)
+	if err != nil {
+		return nil, err
+	}
+	return []string{path}, nil
+}
+
+// stopTraces stops recording the events of containers whose traces were
+// never written
+func (r *ContainerdDriver) stopTraces() {
+	r.tracesMu.Lock()
+	defer r.tracesMu.Unlock()
+	for name, rec := range r.traces {
+		log.Debugf("containerd: discarding the trace of container %s", name)
+		rec.cancel()
+	}
+	r.traces = nil
+}
@@ -0,0 +1,9 @@
+package driver
+
+import "fmt"
+
+// NewContainerdDriver is not available on Windows, as the vendored containerd
+// client only supports UNIX socket connections
+func NewContainerdDriver(path, runtime string, opts ContainerOptions, namePrefix string) (Driver, error) {
+	return nil, fmt.Errorf("The Containerd driver is not supported on Windows")
+}
@@ -0,0 +1,547 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/driver/cri"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCRISocket    = "/run/containerd/containerd.sock"
+	criDialTimeout      = 10 * time.Second
+	criSandboxNamespace = "bucketbench"
+	criLabel            = "io.bucketbench"
+)
+
+// CRIDriver is an implementation of the driver interface for any runtime implementing
+// the Kubernetes Container Runtime Interface (CRI-O, containerd CRI, cri-dockerd). All
+// runtimes are driven through the identical CRI gRPC call path; each benchmark container
+// runs in its own pod sandbox created from an optional sandbox config template, or
+// optionally all containers of a driver instance share one persistent pod sandbox.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type CRIDriver struct {
+	criSettings
+	socketPath   string
+	client       *cri.Client
+	context      context.Context
+	shared       bool
+	sharedID     string
+	sharedConfig *cri.PodSandboxConfig
+	namePrefix   string
+}
+
+// criSettings holds the pod sandbox template and container settings of the
+// drivers for CRI runtimes, which build the same sandbox and container
+// configs whether they are sent over gRPC or passed to crictl
+type criSettings struct {
+	sandboxTemplate []byte
+	labels          map[string]string
+	resources       Resources
+	network         string
+	mounts          []Mount
+	user            string
+}
+
+// newCRISettings reads and validates the optional pod sandbox config template
+// (as used by crictl) and holds the container options
+func newCRISettings(sandboxConfigPath string, opts ContainerOptions) (criSettings, error) {
+	template := []byte("{}")
+	if sandboxConfigPath != "" {
+		data, err := ioutil.ReadFile(sandboxConfigPath)
+		if err != nil {
+			return criSettings{}, fmt.Errorf("Error reading CRI sandbox config template: %v", err)
+		}
+		// validate the template once up front
+		if err := json.Unmarshal(data, &cri.PodSandboxConfig{}); err != nil {
+			return criSettings{}, fmt.Errorf("Error parsing CRI sandbox config template %q: %v", sandboxConfigPath, err)
+		}
+		template = data
+	}
+	return criSettings{
+		sandboxTemplate: template,
+		labels:          opts.Labels,
+		resources:       opts.Resources,
+		network:         opts.Network,
+		mounts:          opts.Mounts,
+		user:            opts.User,
+	}, nil
+}
+
+// CRIContainer is an implementation of the container metadata needed for CRI runtimes
+type CRIContainer struct {
+	name        string
+	imageName   string
+	cmdOverride string
+	trace       bool
+	sandboxID   string
+	containerID string
+	resources   Resources
+}
+
+// NewCRIDriver creates an instance of the CRI driver, providing the CRI socket path,
+// an optional path to a JSON pod sandbox config template (as used by crictl),
+// whether containers share a persistent pod sandbox, and the name prefix of the
+// pod sandboxes it cleans up
+func NewCRIDriver(socketPath, sandboxConfigPath string, shared bool, opts ContainerOptions, namePrefix string) (Driver, error) {
+	if socketPath == "" {
+		socketPath = defaultCRISocket
+	}
+	settings, err := newCRISettings(sandboxConfigPath, opts)
+	if err != nil {
+		return &CRIDriver{}, err
+	}
+	ctx := context.Background()
+	client, err := cri.Dial(ctx, socketPath, criDialTimeout)
+	if err != nil {
+		return &CRIDriver{}, fmt.Errorf("Error connecting to CRI endpoint %s: %v", socketPath, err)
+	}
+	driver := &CRIDriver{
+		criSettings: settings,
+		socketPath:  socketPath,
+		client:      client,
+		context:     ctx,
+		shared:      shared,
+		namePrefix:  namePrefix,
+	}
+	return driver, nil
+}
+
+// newCRIContainer creates the metadata object of a CRI container with
+// image name, container name, and any required additional information
+func newCRIContainer(name, image, cmd string, trace bool, resources Resources) Container {
+	return &CRIContainer{
+		name:        name,
+		imageName:   image,
+		cmdOverride: cmd,
+		trace:       trace,
+		resources:   resources,
+	}
+}
+
+// Name returns the name of the container
+func (c *CRIContainer) Name() string {
+	return c.name
+}
+
+// Detached always returns true for CRI as containers are never attached
+func (c *CRIContainer) Detached() bool {
+	return true
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *CRIContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the image name that the CRI runtime will use
+func (c *CRIContainer) Image() string {
+	return c.imageName
+}
+
+// Command returns the override command that will be executed instead of
+// the default image-specified command
+func (c *CRIContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources returns the resource limits the container is created with
+func (c *CRIContainer) Resources() Resources {
+	return c.resources
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (r *CRIDriver) Type() Type {
+	return CRI
+}
+
+// Path returns the socket path of the CRI endpoint
+func (r *CRIDriver) Path() string {
+	return r.socketPath
+}
+
+// Close allows the driver to handle any resource free/connection closing
+// as necessary; a shared pod sandbox is removed.
+func (r *CRIDriver) Close(ctx context.Context) error {
+	if r.sharedID != "" {
+		if err := r.client.StopPodSandbox(ctx, r.sharedID); err != nil {
+			log.Warnf("CRI: error stopping shared pod sandbox %s: %v", r.sharedID, err)
+		}
+		if err := r.client.RemovePodSandbox(ctx, r.sharedID); err != nil {
+			log.Warnf("CRI: error removing shared pod sandbox %s: %v", r.sharedID, err)
+		}
+	}
+	return r.client.Close()
+}
+
+// SandboxMode returns "shared" when containers share a persistent pod sandbox
+func (r *CRIDriver) SandboxMode() string {
+	if r.shared {
+		return "shared"
+	}
+	return ""
+}
+
+// Info returns the runtime name and version reported over CRI
+func (r *CRIDriver) Info(ctx context.Context) (string, error) {
+	version, err := r.client.Version(ctx)
+	if err != nil {
+		return "", err
+	}
+	info := fmt.Sprintf("CRI gRPC driver (socket: %s)[RUNTIME:%s %s|CRI:%s %s]", r.socketPath,
+		version.RuntimeName, version.RuntimeVersion, r.client.APIVersion(), version.RuntimeAPIVersion)
+	return info, nil
+}
+
+// sandboxConfig returns a new pod sandbox config for a container from the
+// template, with the cgroup parent of resources
+func (r criSettings) sandboxConfig(name string, resources Resources) (*cri.PodSandboxConfig, error) {
+	config := &cri.PodSandboxConfig{}
+	if err := json.Unmarshal(r.sandboxTemplate, config); err != nil {
+		return nil, err
+	}
+	if config.Metadata == nil {
+		config.Metadata = &cri.PodSandboxMetadata{}
+	}
+	config.Metadata.Name = name
+	config.Metadata.UID = name
+	if config.Metadata.Namespace == "" {
+		config.Metadata.Namespace = criSandboxNamespace
+	}
+	if config.Labels == nil {
+		config.Labels = make(map[string]string)
+	}
+	for k, v := range r.labels {
+		config.Labels[k] = v
+	}
+	config.Labels[criLabel] = "true"
+	if resources.CgroupParent != "" || r.network == NetworkHost {
+		if config.Linux == nil {
+			config.Linux = &cri.LinuxPodSandboxConfig{}
+		}
+	}
+	if resources.CgroupParent != "" {
+		config.Linux.CgroupParent = resources.CgroupParent
+	}
+	if r.network == NetworkHost {
+		if config.Linux.SecurityContext == nil {
+			config.Linux.SecurityContext = &cri.LinuxSandboxSecurityContext{}
+		}
+		if config.Linux.SecurityContext.NamespaceOptions == nil {
+			config.Linux.SecurityContext.NamespaceOptions = &cri.NamespaceOption{}
+		}
+		config.Linux.SecurityContext.NamespaceOptions.Network = cri.NamespaceModeNode
+	}
+	return config, nil
+}
+
+// containerConfig returns the config of a container in a pod sandbox created
+// from sandbox; its log file is only written when the sandbox config sets a
+// log_directory
+func (r criSettings) containerConfig(ctr Container, sandbox *cri.PodSandboxConfig) *cri.ContainerConfig {
+	name, image, cmd := ctr.Name(), ctr.Image(), ctr.Command()
+	config := &cri.ContainerConfig{
+		Metadata: &cri.ContainerMetadata{Name: name},
+		Image:    &cri.ImageSpec{Image: image},
+		Labels:   map[string]string{criLabel: "true"},
+	}
+	for k, v := range r.labels {
+		config.Labels[k] = v
+	}
+	if cmd != "" {
+		config.Command = strings.Split(cmd, " ")
+	}
+	for _, m := range r.mounts {
+		if m.Type != MountBind {
+			continue
+		}
+		mount := &cri.Mount{ContainerPath: m.Target, HostPath: m.Source, Readonly: m.ReadOnly}
+		switch propagationMode(m.Propagation) {
+		case "HostToContainer":
+			mount.Propagation = cri.MountPropagationHostToContainer
+		case "Bidirectional":
+			mount.Propagation = cri.MountPropagationBidirectional
+		}
+		config.Mounts = append(config.Mounts, mount)
+	}
+	if limits := ctr.Resources(); limits.CPUs > 0 || limits.Memory > 0 {
+		resources := &cri.LinuxContainerResources{MemoryLimitInBytes: limits.Memory}
+		if limits.CPUs > 0 {
+			resources.CpuPeriod = cpuPeriod
+			resources.CpuQuota = limits.cpuQuota()
+		}
+		config.Linux = &cri.LinuxContainerConfig{Resources: resources}
+	}
+	if uid, gid, hasGID, ok := numericUser(r.user); ok {
+		security := &cri.LinuxContainerSecurityContext{RunAsUser: &cri.Int64Value{Value: int64(uid)}}
+		if hasGID {
+			security.RunAsGroup = &cri.Int64Value{Value: int64(gid)}
+		}
+		if config.Linux == nil {
+			config.Linux = &cri.LinuxContainerConfig{}
+		}
+		config.Linux.SecurityContext = security
+	}
+	if sandbox.LogDirectory != "" {
+		config.LogPath = name + ".log"
+	}
+	return config
+}
+
+// Create will create a container instance matching the specific needs
+// of a driver; the image is pulled if not already present on the node, and
+// the shared pod sandbox is created on first use
+func (r *CRIDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	img, err := r.client.ImageStatus(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if img == nil {
+		if _, err := r.client.PullImage(ctx, image, nil); err != nil {
+			return nil, err
+		}
+	}
+	if r.shared && r.sharedID == "" {
+		if r.sharedConfig, err = r.sandboxConfig(fmt.Sprintf("%sshared-%d", r.namePrefix, time.Now().UnixNano()), r.resources); err != nil {
+			return nil, err
+		}
+		if r.sharedID, err = r.client.RunPodSandbox(ctx, r.sharedConfig, ""); err != nil {
+			return nil, fmt.Errorf("Error creating shared pod sandbox: %v", err)
+		}
+	}
+	return newCRIContainer(name, image, cmdOverride, trace, r.resources), nil
+}
+
+// Clean will clean the environment; removing all pod sandboxes (and their
+// containers) created by bucketbench
+func (r *CRIDriver) Clean(ctx context.Context) error {
+	sandboxes, err := r.client.ListPodSandbox(ctx, map[string]string{criLabel: "true"})
+	if err != nil {
+		return fmt.Errorf("Error listing CRI pod sandboxes: %v", err)
+	}
+	var own []*cri.PodSandbox
+	for _, sandbox := range sandboxes {
+		if sandbox.Metadata != nil && strings.HasPrefix(sandbox.Metadata.Name, r.namePrefix) {
+			own = append(own, sandbox)
+		}
+	}
+	log.Infof("CRI: removing %d pod sandboxes from bucketbench runs", len(own))
+	for _, sandbox := range own {
+		if err := paceClean(ctx); err != nil {
+			return err
+		}
+		if err := r.client.StopPodSandbox(ctx, sandbox.ID); err != nil {
+			log.Warnf("CRI: error stopping pod sandbox %s: %v", sandbox.ID, err)
+		}
+		if err := r.client.RemovePodSandbox(ctx, sandbox.ID); err != nil {
+			log.Warnf("CRI: error removing pod sandbox %s: %v", sandbox.ID, err)
+		}
+	}
+	return nil
+}
+
+// Run will create a pod sandbox (unless a shared sandbox is used), and create
+// and start the container within it
+func (r *CRIDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	criCtr, ok := ctr.(*CRIContainer)
+	if !ok {
+		return "", 0, fmt.Errorf("CRI driver cannot run container of type %T", ctr)
+	}
+	sandboxConfig := r.sharedConfig
+	if !r.shared {
+		var err error
+		if sandboxConfig, err = r.sandboxConfig(ctr.Name(), ctr.Resources()); err != nil {
+			return "", 0, err
+		}
+	}
+	config := r.containerConfig(ctr, sandboxConfig)
+	start := time.Now()
+	var err error
+	if r.shared {
+		criCtr.sandboxID = r.sharedID
+	} else if criCtr.sandboxID, err = r.client.RunPodSandbox(ctx, sandboxConfig, ""); err != nil {
+		return "", 0, err
+	}
+	criCtr.containerID, err = r.client.CreateContainer(ctx, criCtr.sandboxID, config, sandboxConfig)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := r.client.StartContainer(ctx, criCtr.containerID); err != nil {
+		return "", 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// Stop will stop the container without any grace period
+func (r *CRIDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	criCtr, err := r.runningContainer(ctr)
+	if err != nil {
+		return "", 0, err
+	}
+	start := time.Now()
+	if err := r.client.StopContainer(ctx, criCtr.containerID, 0); err != nil {
+		return "", 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// Remove will remove the container and its pod sandbox; a shared pod
+// sandbox is kept for the following containers
+func (r *CRIDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	criCtr, err := r.runningContainer(ctr)
+	if err != nil {
+		return "", 0, err
+	}
+	start := time.Now()
+	if err := r.client.RemoveContainer(ctx, criCtr.containerID); err != nil {
+		return "", 0, err
+	}
+	if r.shared {
+		return "", utils.Elapsed(ctx, start), nil
+	}
+	if err := r.client.StopPodSandbox(ctx, criCtr.sandboxID); err != nil {
+		return "", 0, err
+	}
+	if err := r.client.RemovePodSandbox(ctx, criCtr.sandboxID); err != nil {
+		return "", 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// Pause is not part of the CRI API
+func (r *CRIDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("pause is not supported by the CRI API")
+}
+
+// Unpause is not part of the CRI API
+func (r *CRIDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("unpause is not supported by the CRI API")
+}
+
+// Exec will run a command in a running container and wait for it to exit
+func (r *CRIDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	criCtr, err := r.runningContainer(ctr)
+	if err != nil {
+		return "", 0, err
+	}
+	start := time.Now()
+	resp, err := r.client.ExecSync(ctx, criCtr.containerID, strings.Split(command, " "))
+	if err != nil {
+		return "", 0, err
+	}
+	elapsed := utils.Elapsed(ctx, start)
+	out := string(resp.Stdout) + string(resp.Stderr)
+	if resp.ExitCode != 0 {
+		return out, 0, fmt.Errorf("exec of %q exited with status %d", command, resp.ExitCode)
+	}
+	return out, elapsed, nil
+}
+
+// Wait polls the container status until the container has exited
+func (r *CRIDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	criCtr, err := r.runningContainer(ctr)
+	if err != nil {
+		return "", 0, err
+	}
+	start := time.Now()
+	for {
+		status, err := r.client.ContainerStatus(ctx, criCtr.containerID)
+		if err != nil {
+			return "", 0, err
+		}
+		if status != nil && status.State == cri.ContainerExited {
+			return "", utils.Elapsed(ctx, start), nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+// Logs reads the container's log file, which the runtime only writes when the
+// sandbox config template sets a log_directory
+func (r *CRIDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	criCtr, err := r.runningContainer(ctr)
+	if err != nil {
+		return "", 0, err
+	}
+	start := time.Now()
+	status, err := r.client.ContainerStatus(ctx, criCtr.containerID)
+	if err != nil {
+		return "", 0, err
+	}
+	if status == nil || status.LogPath == "" {
+		return "", 0, fmt.Errorf("container has no log file; set log_directory in the sandbox config template")
+	}
+	out, err := ioutil.ReadFile(status.LogPath)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(out), utils.Elapsed(ctx, start), nil
+}
+
+// Checkpoint is not supported by the CRI driver
+func (r *CRIDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the CRI driver")
+}
+
+// Restore is not supported by the CRI driver
+func (r *CRIDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the CRI driver")
+}
+
+// HasImage returns whether the image is present on the node
+func (r *CRIDriver) HasImage(ctx context.Context, image string) (bool, error) {
+	img, err := r.client.ImageStatus(ctx, image)
+	if err != nil {
+		return false, err
+	}
+	return img != nil, nil
+}
+
+// PullImage pulls the image onto the node
+func (r *CRIDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	start := time.Now()
+	if _, err := r.client.PullImage(ctx, image, nil); err != nil {
+		return "", 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// ImageDigest returns the registry digest of the image on the node
+func (r *CRIDriver) ImageDigest(ctx context.Context, image string) (string, error) {
+	img, err := r.client.ImageStatus(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	if img == nil {
+		return "", fmt.Errorf("Image %q is not present on the node", image)
+	}
+	return repoDigest(image, img.RepoDigests)
+}
+
+// RemoveImage removes the image from the node
+func (r *CRIDriver) RemoveImage(ctx context.Context, image string) error {
+	return r.client.RemoveImage(ctx, image)
+}
+
+// runningContainer returns the CRI container once it has been run and has IDs assigned
+func (r *CRIDriver) runningContainer(ctr Container) (*CRIContainer, error) {
+	criCtr, ok := ctr.(*CRIContainer)
+	if !ok {
+		return nil, fmt.Errorf("CRI driver cannot manage container of type %T", ctr)
+	}
+	if criCtr.containerID == "" {
+		return nil, fmt.Errorf("container %q has not been run", ctr.Name())
+	}
+	return criCtr, nil
+}
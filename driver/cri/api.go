@@ -0,0 +1,719 @@
+// Package cri contains a hand-maintained subset of the Kubernetes Container
+// Runtime Interface (CRI) protobuf messages, sufficient for driving the pod
+// sandbox and container lifecycle over gRPC. Field numbers match the upstream
+// runtime.v1 (and wire-compatible runtime.v1alpha2) api.proto definitions.
+package cri
+
+import "github.com/golang/protobuf/proto"
+
+// VersionRequest is the request for the RuntimeService Version RPC
+type VersionRequest struct {
+	Version string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+}
+
+// Reset clears the message
+func (m *VersionRequest) Reset() { *m = VersionRequest{} }
+
+// String returns the compact text form of the message
+func (m *VersionRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks VersionRequest as a protobuf message
+func (*VersionRequest) ProtoMessage() {}
+
+// VersionResponse carries the runtime name and versions
+type VersionResponse struct {
+	Version           string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	RuntimeName       string `protobuf:"bytes,2,opt,name=runtime_name,proto3" json:"runtime_name,omitempty"`
+	RuntimeVersion    string `protobuf:"bytes,3,opt,name=runtime_version,proto3" json:"runtime_version,omitempty"`
+	RuntimeAPIVersion string `protobuf:"bytes,4,opt,name=runtime_api_version,proto3" json:"runtime_api_version,omitempty"`
+}
+
+// Reset clears the message
+func (m *VersionResponse) Reset() { *m = VersionResponse{} }
+
+// String returns the compact text form of the message
+func (m *VersionResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks VersionResponse as a protobuf message
+func (*VersionResponse) ProtoMessage() {}
+
+// PodSandboxMetadata holds the attributes identifying a pod sandbox
+type PodSandboxMetadata struct {
+	Name      string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	UID       string `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	Namespace string `protobuf:"bytes,3,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Attempt   uint32 `protobuf:"varint,4,opt,name=attempt,proto3" json:"attempt,omitempty"`
+}
+
+// Reset clears the message
+func (m *PodSandboxMetadata) Reset() { *m = PodSandboxMetadata{} }
+
+// String returns the compact text form of the message
+func (m *PodSandboxMetadata) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks PodSandboxMetadata as a protobuf message
+func (*PodSandboxMetadata) ProtoMessage() {}
+
+// NamespaceModeNode shares a namespace of the node with the pod; the other
+// NamespaceMode values are POD (0) and CONTAINER (1)
+const NamespaceModeNode int32 = 2
+
+// NamespaceOption holds the namespace modes of a pod sandbox
+type NamespaceOption struct {
+	Network int32 `protobuf:"varint,1,opt,name=network,proto3" json:"network,omitempty"`
+}
+
+// Reset clears the message
+func (m *NamespaceOption) Reset() { *m = NamespaceOption{} }
+
+// String returns the compact text form of the message
+func (m *NamespaceOption) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks NamespaceOption as a protobuf message
+func (*NamespaceOption) ProtoMessage() {}
+
+// LinuxSandboxSecurityContext holds the Linux security settings of a pod sandbox
+type LinuxSandboxSecurityContext struct {
+	NamespaceOptions *NamespaceOption `protobuf:"bytes,1,opt,name=namespace_options" json:"namespace_options,omitempty"`
+}
+
+// Reset clears the message
+func (m *LinuxSandboxSecurityContext) Reset() { *m = LinuxSandboxSecurityContext{} }
+
+// String returns the compact text form of the message
+func (m *LinuxSandboxSecurityContext) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks LinuxSandboxSecurityContext as a protobuf message
+func (*LinuxSandboxSecurityContext) ProtoMessage() {}
+
+// LinuxPodSandboxConfig holds Linux-specific pod sandbox settings
+type LinuxPodSandboxConfig struct {
+	CgroupParent    string                       `protobuf:"bytes,1,opt,name=cgroup_parent,proto3" json:"cgroup_parent,omitempty"`
+	SecurityContext *LinuxSandboxSecurityContext `protobuf:"bytes,2,opt,name=security_context" json:"security_context,omitempty"`
+	Sysctls         map[string]string            `protobuf:"bytes,3,rep,name=sysctls" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3" json:"sysctls,omitempty"`
+}
+
+// Reset clears the message
+func (m *LinuxPodSandboxConfig) Reset() { *m = LinuxPodSandboxConfig{} }
+
+// String returns the compact text form of the message
+func (m *LinuxPodSandboxConfig) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks LinuxPodSandboxConfig as a protobuf message
+func (*LinuxPodSandboxConfig) ProtoMessage() {}
+
+// PodSandboxConfig holds the settings for creating a pod sandbox
+type PodSandboxConfig struct {
+	Metadata     *PodSandboxMetadata    `protobuf:"bytes,1,opt,name=metadata" json:"metadata,omitempty"`
+	Hostname     string                 `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	LogDirectory string                 `protobuf:"bytes,3,opt,name=log_directory,proto3" json:"log_directory,omitempty"`
+	Labels       map[string]string      `protobuf:"bytes,6,rep,name=labels" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3" json:"labels,omitempty"`
+	Annotations  map[string]string      `protobuf:"bytes,7,rep,name=annotations" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3" json:"annotations,omitempty"`
+	Linux        *LinuxPodSandboxConfig `protobuf:"bytes,8,opt,name=linux" json:"linux,omitempty"`
+}
+
+// Reset clears the message
+func (m *PodSandboxConfig) Reset() { *m = PodSandboxConfig{} }
+
+// String returns the compact text form of the message
+func (m *PodSandboxConfig) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks PodSandboxConfig as a protobuf message
+func (*PodSandboxConfig) ProtoMessage() {}
+
+// RunPodSandboxRequest is the request for RunPodSandbox
+type RunPodSandboxRequest struct {
+	Config         *PodSandboxConfig `protobuf:"bytes,1,opt,name=config" json:"config,omitempty"`
+	RuntimeHandler string            `protobuf:"bytes,2,opt,name=runtime_handler,proto3" json:"runtime_handler,omitempty"`
+}
+
+// Reset clears the message
+func (m *RunPodSandboxRequest) Reset() { *m = RunPodSandboxRequest{} }
+
+// String returns the compact text form of the message
+func (m *RunPodSandboxRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks RunPodSandboxRequest as a protobuf message
+func (*RunPodSandboxRequest) ProtoMessage() {}
+
+// RunPodSandboxResponse returns the ID of the created sandbox
+type RunPodSandboxResponse struct {
+	PodSandboxID string `protobuf:"bytes,1,opt,name=pod_sandbox_id,proto3" json:"pod_sandbox_id,omitempty"`
+}
+
+// Reset clears the message
+func (m *RunPodSandboxResponse) Reset() { *m = RunPodSandboxResponse{} }
+
+// String returns the compact text form of the message
+func (m *RunPodSandboxResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks RunPodSandboxResponse as a protobuf message
+func (*RunPodSandboxResponse) ProtoMessage() {}
+
+// StopPodSandboxRequest is the request for StopPodSandbox
+type StopPodSandboxRequest struct {
+	PodSandboxID string `protobuf:"bytes,1,opt,name=pod_sandbox_id,proto3" json:"pod_sandbox_id,omitempty"`
+}
+
+// Reset clears the message
+func (m *StopPodSandboxRequest) Reset() { *m = StopPodSandboxRequest{} }
+
+// String returns the compact text form of the message
+func (m *StopPodSandboxRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks StopPodSandboxRequest as a protobuf message
+func (*StopPodSandboxRequest) ProtoMessage() {}
+
+// StopPodSandboxResponse is the empty response of StopPodSandbox
+type StopPodSandboxResponse struct {
+}
+
+// Reset clears the message
+func (m *StopPodSandboxResponse) Reset() { *m = StopPodSandboxResponse{} }
+
+// String returns the compact text form of the message
+func (m *StopPodSandboxResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks StopPodSandboxResponse as a protobuf message
+func (*StopPodSandboxResponse) ProtoMessage() {}
+
+// RemovePodSandboxRequest is the request for RemovePodSandbox
+type RemovePodSandboxRequest struct {
+	PodSandboxID string `protobuf:"bytes,1,opt,name=pod_sandbox_id,proto3" json:"pod_sandbox_id,omitempty"`
+}
+
+// Reset clears the message
+func (m *RemovePodSandboxRequest) Reset() { *m = RemovePodSandboxRequest{} }
+
+// String returns the compact text form of the message
+func (m *RemovePodSandboxRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks RemovePodSandboxRequest as a protobuf message
+func (*RemovePodSandboxRequest) ProtoMessage() {}
+
+// RemovePodSandboxResponse is the empty response of RemovePodSandbox
+type RemovePodSandboxResponse struct {
+}
+
+// Reset clears the message
+func (m *RemovePodSandboxResponse) Reset() { *m = RemovePodSandboxResponse{} }
+
+// String returns the compact text form of the message
+func (m *RemovePodSandboxResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks RemovePodSandboxResponse as a protobuf message
+func (*RemovePodSandboxResponse) ProtoMessage() {}
+
+// PodSandboxFilter selects pod sandboxes to list
+type PodSandboxFilter struct {
+	ID            string            `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	LabelSelector map[string]string `protobuf:"bytes,3,rep,name=label_selector" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3" json:"label_selector,omitempty"`
+}
+
+// Reset clears the message
+func (m *PodSandboxFilter) Reset() { *m = PodSandboxFilter{} }
+
+// String returns the compact text form of the message
+func (m *PodSandboxFilter) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks PodSandboxFilter as a protobuf message
+func (*PodSandboxFilter) ProtoMessage() {}
+
+// ListPodSandboxRequest is the request for ListPodSandbox
+type ListPodSandboxRequest struct {
+	Filter *PodSandboxFilter `protobuf:"bytes,1,opt,name=filter" json:"filter,omitempty"`
+}
+
+// Reset clears the message
+func (m *ListPodSandboxRequest) Reset() { *m = ListPodSandboxRequest{} }
+
+// String returns the compact text form of the message
+func (m *ListPodSandboxRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ListPodSandboxRequest as a protobuf message
+func (*ListPodSandboxRequest) ProtoMessage() {}
+
+// PodSandbox is a pod sandbox as returned by ListPodSandbox
+type PodSandbox struct {
+	ID        string              `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Metadata  *PodSandboxMetadata `protobuf:"bytes,2,opt,name=metadata" json:"metadata,omitempty"`
+	State     int32               `protobuf:"varint,3,opt,name=state,proto3" json:"state,omitempty"`
+	CreatedAt int64               `protobuf:"varint,4,opt,name=created_at,proto3" json:"created_at,omitempty"`
+	Labels    map[string]string   `protobuf:"bytes,5,rep,name=labels" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3" json:"labels,omitempty"`
+}
+
+// Reset clears the message
+func (m *PodSandbox) Reset() { *m = PodSandbox{} }
+
+// String returns the compact text form of the message
+func (m *PodSandbox) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks PodSandbox as a protobuf message
+func (*PodSandbox) ProtoMessage() {}
+
+// ListPodSandboxResponse lists the selected pod sandboxes
+type ListPodSandboxResponse struct {
+	Items []*PodSandbox `protobuf:"bytes,1,rep,name=items" json:"items,omitempty"`
+}
+
+// Reset clears the message
+func (m *ListPodSandboxResponse) Reset() { *m = ListPodSandboxResponse{} }
+
+// String returns the compact text form of the message
+func (m *ListPodSandboxResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ListPodSandboxResponse as a protobuf message
+func (*ListPodSandboxResponse) ProtoMessage() {}
+
+// ContainerMetadata holds the attributes identifying a container
+type ContainerMetadata struct {
+	Name    string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Attempt uint32 `protobuf:"varint,2,opt,name=attempt,proto3" json:"attempt,omitempty"`
+}
+
+// Reset clears the message
+func (m *ContainerMetadata) Reset() { *m = ContainerMetadata{} }
+
+// String returns the compact text form of the message
+func (m *ContainerMetadata) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ContainerMetadata as a protobuf message
+func (*ContainerMetadata) ProtoMessage() {}
+
+// ImageSpec references an image
+type ImageSpec struct {
+	Image       string            `protobuf:"bytes,1,opt,name=image,proto3" json:"image,omitempty"`
+	Annotations map[string]string `protobuf:"bytes,2,rep,name=annotations" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3" json:"annotations,omitempty"`
+}
+
+// Reset clears the message
+func (m *ImageSpec) Reset() { *m = ImageSpec{} }
+
+// String returns the compact text form of the message
+func (m *ImageSpec) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ImageSpec as a protobuf message
+func (*ImageSpec) ProtoMessage() {}
+
+// KeyValue is an environment variable of a container
+type KeyValue struct {
+	Key   string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+// Reset clears the message
+func (m *KeyValue) Reset() { *m = KeyValue{} }
+
+// String returns the compact text form of the message
+func (m *KeyValue) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks KeyValue as a protobuf message
+func (*KeyValue) ProtoMessage() {}
+
+// Mount propagation modes of a container mount
+const (
+	MountPropagationPrivate         int32 = 0
+	MountPropagationHostToContainer int32 = 1
+	MountPropagationBidirectional   int32 = 2
+)
+
+// Mount is a host path mounted into a container
+type Mount struct {
+	ContainerPath string `protobuf:"bytes,1,opt,name=container_path,proto3" json:"container_path,omitempty"`
+	HostPath      string `protobuf:"bytes,2,opt,name=host_path,proto3" json:"host_path,omitempty"`
+	Readonly      bool   `protobuf:"varint,3,opt,name=readonly,proto3" json:"readonly,omitempty"`
+	Propagation   int32  `protobuf:"varint,5,opt,name=propagation,proto3" json:"propagation,omitempty"`
+}
+
+// Reset clears the message
+func (m *Mount) Reset() { *m = Mount{} }
+
+// String returns the compact text form of the message
+func (m *Mount) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks Mount as a protobuf message
+func (*Mount) ProtoMessage() {}
+
+// LinuxContainerResources holds the Linux resource limits of a container
+type LinuxContainerResources struct {
+	CpuPeriod          int64 `protobuf:"varint,1,opt,name=cpu_period,proto3" json:"cpu_period,omitempty"`
+	CpuQuota           int64 `protobuf:"varint,2,opt,name=cpu_quota,proto3" json:"cpu_quota,omitempty"`
+	MemoryLimitInBytes int64 `protobuf:"varint,4,opt,name=memory_limit_in_bytes,proto3" json:"memory_limit_in_bytes,omitempty"`
+}
+
+// Reset clears the message
+func (m *LinuxContainerResources) Reset() { *m = LinuxContainerResources{} }
+
+// String returns the compact text form of the message
+func (m *LinuxContainerResources) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks LinuxContainerResources as a protobuf message
+func (*LinuxContainerResources) ProtoMessage() {}
+
+// Int64Value wraps an optional int64
+type Int64Value struct {
+	Value int64 `protobuf:"varint,1,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+// Reset clears the message
+func (m *Int64Value) Reset() { *m = Int64Value{} }
+
+// String returns the compact text form of the message
+func (m *Int64Value) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks Int64Value as a protobuf message
+func (*Int64Value) ProtoMessage() {}
+
+// LinuxContainerSecurityContext holds the user a container's process runs as
+type LinuxContainerSecurityContext struct {
+	RunAsUser  *Int64Value `protobuf:"bytes,5,opt,name=run_as_user" json:"run_as_user,omitempty"`
+	RunAsGroup *Int64Value `protobuf:"bytes,12,opt,name=run_as_group" json:"run_as_group,omitempty"`
+}
+
+// Reset clears the message
+func (m *LinuxContainerSecurityContext) Reset() { *m = LinuxContainerSecurityContext{} }
+
+// String returns the compact text form of the message
+func (m *LinuxContainerSecurityContext) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks LinuxContainerSecurityContext as a protobuf message
+func (*LinuxContainerSecurityContext) ProtoMessage() {}
+
+// LinuxContainerConfig holds Linux-specific container settings
+type LinuxContainerConfig struct {
+	Resources       *LinuxContainerResources       `protobuf:"bytes,1,opt,name=resources" json:"resources,omitempty"`
+	SecurityContext *LinuxContainerSecurityContext `protobuf:"bytes,2,opt,name=security_context" json:"security_context,omitempty"`
+}
+
+// Reset clears the message
+func (m *LinuxContainerConfig) Reset() { *m = LinuxContainerConfig{} }
+
+// String returns the compact text form of the message
+func (m *LinuxContainerConfig) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks LinuxContainerConfig as a protobuf message
+func (*LinuxContainerConfig) ProtoMessage() {}
+
+// ContainerConfig holds the settings for creating a container
+type ContainerConfig struct {
+	Metadata    *ContainerMetadata    `protobuf:"bytes,1,opt,name=metadata" json:"metadata,omitempty"`
+	Image       *ImageSpec            `protobuf:"bytes,2,opt,name=image" json:"image,omitempty"`
+	Command     []string              `protobuf:"bytes,3,rep,name=command" json:"command,omitempty"`
+	Args        []string              `protobuf:"bytes,4,rep,name=args" json:"args,omitempty"`
+	WorkingDir  string                `protobuf:"bytes,5,opt,name=working_dir,proto3" json:"working_dir,omitempty"`
+	Envs        []*KeyValue           `protobuf:"bytes,6,rep,name=envs" json:"envs,omitempty"`
+	Mounts      []*Mount              `protobuf:"bytes,7,rep,name=mounts" json:"mounts,omitempty"`
+	Labels      map[string]string     `protobuf:"bytes,9,rep,name=labels" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3" json:"labels,omitempty"`
+	Annotations map[string]string     `protobuf:"bytes,10,rep,name=annotations" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3" json:"annotations,omitempty"`
+	LogPath     string                `protobuf:"bytes,11,opt,name=log_path,proto3" json:"log_path,omitempty"`
+	Linux       *LinuxContainerConfig `protobuf:"bytes,15,opt,name=linux" json:"linux,omitempty"`
+}
+
+// Reset clears the message
+func (m *ContainerConfig) Reset() { *m = ContainerConfig{} }
+
+// String returns the compact text form of the message
+func (m *ContainerConfig) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ContainerConfig as a protobuf message
+func (*ContainerConfig) ProtoMessage() {}
+
+// CreateContainerRequest is the request for CreateContainer
+type CreateContainerRequest struct {
+	PodSandboxID  string            `protobuf:"bytes,1,opt,name=pod_sandbox_id,proto3" json:"pod_sandbox_id,omitempty"`
+	Config        *ContainerConfig  `protobuf:"bytes,2,opt,name=config" json:"config,omitempty"`
+	SandboxConfig *PodSandboxConfig `protobuf:"bytes,3,opt,name=sandbox_config" json:"sandbox_config,omitempty"`
+}
+
+// Reset clears the message
+func (m *CreateContainerRequest) Reset() { *m = CreateContainerRequest{} }
+
+// String returns the compact text form of the message
+func (m *CreateContainerRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks CreateContainerRequest as a protobuf message
+func (*CreateContainerRequest) ProtoMessage() {}
+
+// CreateContainerResponse returns the ID of the created container
+type CreateContainerResponse struct {
+	ContainerID string `protobuf:"bytes,1,opt,name=container_id,proto3" json:"container_id,omitempty"`
+}
+
+// Reset clears the message
+func (m *CreateContainerResponse) Reset() { *m = CreateContainerResponse{} }
+
+// String returns the compact text form of the message
+func (m *CreateContainerResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks CreateContainerResponse as a protobuf message
+func (*CreateContainerResponse) ProtoMessage() {}
+
+// StartContainerRequest is the request for StartContainer
+type StartContainerRequest struct {
+	ContainerID string `protobuf:"bytes,1,opt,name=container_id,proto3" json:"container_id,omitempty"`
+}
+
+// Reset clears the message
+func (m *StartContainerRequest) Reset() { *m = StartContainerRequest{} }
+
+// String returns the compact text form of the message
+func (m *StartContainerRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks StartContainerRequest as a protobuf message
+func (*StartContainerRequest) ProtoMessage() {}
+
+// StartContainerResponse is the empty response of StartContainer
+type StartContainerResponse struct {
+}
+
+// Reset clears the message
+func (m *StartContainerResponse) Reset() { *m = StartContainerResponse{} }
+
+// String returns the compact text form of the message
+func (m *StartContainerResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks StartContainerResponse as a protobuf message
+func (*StartContainerResponse) ProtoMessage() {}
+
+// StopContainerRequest is the request for StopContainer
+type StopContainerRequest struct {
+	ContainerID string `protobuf:"bytes,1,opt,name=container_id,proto3" json:"container_id,omitempty"`
+	Timeout     int64  `protobuf:"varint,2,opt,name=timeout,proto3" json:"timeout,omitempty"`
+}
+
+// Reset clears the message
+func (m *StopContainerRequest) Reset() { *m = StopContainerRequest{} }
+
+// String returns the compact text form of the message
+func (m *StopContainerRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks StopContainerRequest as a protobuf message
+func (*StopContainerRequest) ProtoMessage() {}
+
+// StopContainerResponse is the empty response of StopContainer
+type StopContainerResponse struct {
+}
+
+// Reset clears the message
+func (m *StopContainerResponse) Reset() { *m = StopContainerResponse{} }
+
+// String returns the compact text form of the message
+func (m *StopContainerResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks StopContainerResponse as a protobuf message
+func (*StopContainerResponse) ProtoMessage() {}
+
+// RemoveContainerRequest is the request for RemoveContainer
+type RemoveContainerRequest struct {
+	ContainerID string `protobuf:"bytes,1,opt,name=container_id,proto3" json:"container_id,omitempty"`
+}
+
+// Reset clears the message
+func (m *RemoveContainerRequest) Reset() { *m = RemoveContainerRequest{} }
+
+// String returns the compact text form of the message
+func (m *RemoveContainerRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks RemoveContainerRequest as a protobuf message
+func (*RemoveContainerRequest) ProtoMessage() {}
+
+// RemoveContainerResponse is the empty response of RemoveContainer
+type RemoveContainerResponse struct {
+}
+
+// Reset clears the message
+func (m *RemoveContainerResponse) Reset() { *m = RemoveContainerResponse{} }
+
+// String returns the compact text form of the message
+func (m *RemoveContainerResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks RemoveContainerResponse as a protobuf message
+func (*RemoveContainerResponse) ProtoMessage() {}
+
+// ExecSyncRequest is the request for ExecSync
+type ExecSyncRequest struct {
+	ContainerID string   `protobuf:"bytes,1,opt,name=container_id,proto3" json:"container_id,omitempty"`
+	Cmd         []string `protobuf:"bytes,2,rep,name=cmd" json:"cmd,omitempty"`
+	Timeout     int64    `protobuf:"varint,3,opt,name=timeout,proto3" json:"timeout,omitempty"`
+}
+
+// Reset clears the message
+func (m *ExecSyncRequest) Reset() { *m = ExecSyncRequest{} }
+
+// String returns the compact text form of the message
+func (m *ExecSyncRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ExecSyncRequest as a protobuf message
+func (*ExecSyncRequest) ProtoMessage() {}
+
+// ExecSyncResponse returns the output and exit code of a command
+type ExecSyncResponse struct {
+	Stdout   []byte `protobuf:"bytes,1,opt,name=stdout,proto3" json:"stdout,omitempty"`
+	Stderr   []byte `protobuf:"bytes,2,opt,name=stderr,proto3" json:"stderr,omitempty"`
+	ExitCode int32  `protobuf:"varint,3,opt,name=exit_code,proto3" json:"exit_code,omitempty"`
+}
+
+// Reset clears the message
+func (m *ExecSyncResponse) Reset() { *m = ExecSyncResponse{} }
+
+// String returns the compact text form of the message
+func (m *ExecSyncResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ExecSyncResponse as a protobuf message
+func (*ExecSyncResponse) ProtoMessage() {}
+
+// ContainerState is the state of a container
+type ContainerState int32
+
+// Container states
+const (
+	ContainerCreated ContainerState = 0
+	ContainerRunning ContainerState = 1
+	ContainerExited  ContainerState = 2
+	ContainerUnknown ContainerState = 3
+)
+
+// ContainerStatusRequest is the request for ContainerStatus
+type ContainerStatusRequest struct {
+	ContainerID string `protobuf:"bytes,1,opt,name=container_id,proto3" json:"container_id,omitempty"`
+}
+
+// Reset clears the message
+func (m *ContainerStatusRequest) Reset() { *m = ContainerStatusRequest{} }
+
+// String returns the compact text form of the message
+func (m *ContainerStatusRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ContainerStatusRequest as a protobuf message
+func (*ContainerStatusRequest) ProtoMessage() {}
+
+// ContainerStatus is the subset of container status details used by bucketbench
+type ContainerStatus struct {
+	ID       string         `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	State    ContainerState `protobuf:"varint,3,opt,name=state,proto3" json:"state,omitempty"`
+	ExitCode int32          `protobuf:"varint,7,opt,name=exit_code,proto3" json:"exit_code,omitempty"`
+	LogPath  string         `protobuf:"bytes,15,opt,name=log_path,proto3" json:"log_path,omitempty"`
+}
+
+// Reset clears the message
+func (m *ContainerStatus) Reset() { *m = ContainerStatus{} }
+
+// String returns the compact text form of the message
+func (m *ContainerStatus) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ContainerStatus as a protobuf message
+func (*ContainerStatus) ProtoMessage() {}
+
+// ContainerStatusResponse returns the status of a container
+type ContainerStatusResponse struct {
+	Status *ContainerStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+}
+
+// Reset clears the message
+func (m *ContainerStatusResponse) Reset() { *m = ContainerStatusResponse{} }
+
+// String returns the compact text form of the message
+func (m *ContainerStatusResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ContainerStatusResponse as a protobuf message
+func (*ContainerStatusResponse) ProtoMessage() {}
+
+// Image is the subset of image details returned by ImageStatus
+type Image struct {
+	ID          string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	RepoTags    []string `protobuf:"bytes,2,rep,name=repo_tags" json:"repo_tags,omitempty"`
+	RepoDigests []string `protobuf:"bytes,3,rep,name=repo_digests" json:"repo_digests,omitempty"`
+}
+
+// Reset clears the message
+func (m *Image) Reset() { *m = Image{} }
+
+// String returns the compact text form of the message
+func (m *Image) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks Image as a protobuf message
+func (*Image) ProtoMessage() {}
+
+// ImageStatusRequest is the request for ImageStatus
+type ImageStatusRequest struct {
+	Image *ImageSpec `protobuf:"bytes,1,opt,name=image" json:"image,omitempty"`
+}
+
+// Reset clears the message
+func (m *ImageStatusRequest) Reset() { *m = ImageStatusRequest{} }
+
+// String returns the compact text form of the message
+func (m *ImageStatusRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ImageStatusRequest as a protobuf message
+func (*ImageStatusRequest) ProtoMessage() {}
+
+// ImageStatusResponse returns the image, or nil if not present
+type ImageStatusResponse struct {
+	Image *Image `protobuf:"bytes,1,opt,name=image" json:"image,omitempty"`
+}
+
+// Reset clears the message
+func (m *ImageStatusResponse) Reset() { *m = ImageStatusResponse{} }
+
+// String returns the compact text form of the message
+func (m *ImageStatusResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks ImageStatusResponse as a protobuf message
+func (*ImageStatusResponse) ProtoMessage() {}
+
+// PullImageRequest is the request for PullImage
+type PullImageRequest struct {
+	Image         *ImageSpec        `protobuf:"bytes,1,opt,name=image" json:"image,omitempty"`
+	SandboxConfig *PodSandboxConfig `protobuf:"bytes,3,opt,name=sandbox_config" json:"sandbox_config,omitempty"`
+}
+
+// Reset clears the message
+func (m *PullImageRequest) Reset() { *m = PullImageRequest{} }
+
+// String returns the compact text form of the message
+func (m *PullImageRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks PullImageRequest as a protobuf message
+func (*PullImageRequest) ProtoMessage() {}
+
+// PullImageResponse returns the reference of the pulled image
+type PullImageResponse struct {
+	ImageRef string `protobuf:"bytes,1,opt,name=image_ref,proto3" json:"image_ref,omitempty"`
+}
+
+// Reset clears the message
+func (m *PullImageResponse) Reset() { *m = PullImageResponse{} }
+
+// String returns the compact text form of the message
+func (m *PullImageResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks PullImageResponse as a protobuf message
+func (*PullImageResponse) ProtoMessage() {}
+
+// RemoveImageRequest is the request for RemoveImage
+type RemoveImageRequest struct {
+	Image *ImageSpec `protobuf:"bytes,1,opt,name=image" json:"image,omitempty"`
+}
+
+// Reset clears the message
+func (m *RemoveImageRequest) Reset() { *m = RemoveImageRequest{} }
+
+// String returns the compact text form of the message
+func (m *RemoveImageRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks RemoveImageRequest as a protobuf message
+func (*RemoveImageRequest) ProtoMessage() {}
+
+// RemoveImageResponse is the empty response of RemoveImage
+type RemoveImageResponse struct {
+}
+
+// Reset clears the message
+func (m *RemoveImageResponse) Reset() { *m = RemoveImageResponse{} }
+
+// String returns the compact text form of the message
+func (m *RemoveImageResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage marks RemoveImageResponse as a protobuf message
+func (*RemoveImageResponse) ProtoMessage() {}
@@ -0,0 +1,154 @@
+package cri
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// apiVersions are the CRI API versions tried, in order, when connecting
+var apiVersions = []string{"v1", "v1alpha2"}
+
+// Client invokes CRI RuntimeService and ImageService RPCs over a UNIX socket
+type Client struct {
+	conn       *grpc.ClientConn
+	apiVersion string
+}
+
+// Dial connects to the CRI endpoint at the socket path and negotiates the
+// CRI API version served by the runtime
+func Dial(ctx context.Context, socket string, timeout time.Duration) (*Client, error) {
+	conn, err := grpc.Dial(socket,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithTimeout(timeout),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}))
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn}
+	for _, version := range apiVersions {
+		c.apiVersion = version
+		if _, err = c.Version(ctx); grpc.Code(err) != codes.Unimplemented {
+			break
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// APIVersion returns the negotiated CRI API version (e.g. "v1")
+func (c *Client) APIVersion() string {
+	return c.apiVersion
+}
+
+// Close closes the gRPC connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) runtime(ctx context.Context, method string, req, resp proto.Message) error {
+	return grpc.Invoke(ctx, "/runtime."+c.apiVersion+".RuntimeService/"+method, req, resp, c.conn)
+}
+
+func (c *Client) image(ctx context.Context, method string, req, resp proto.Message) error {
+	return grpc.Invoke(ctx, "/runtime."+c.apiVersion+".ImageService/"+method, req, resp, c.conn)
+}
+
+// Version returns the runtime name and version information
+func (c *Client) Version(ctx context.Context) (*VersionResponse, error) {
+	resp := &VersionResponse{}
+	return resp, c.runtime(ctx, "Version", &VersionRequest{Version: c.apiVersion}, resp)
+}
+
+// RunPodSandbox creates and starts a pod sandbox, returning its ID
+func (c *Client) RunPodSandbox(ctx context.Context, config *PodSandboxConfig, runtimeHandler string) (string, error) {
+	resp := &RunPodSandboxResponse{}
+	err := c.runtime(ctx, "RunPodSandbox", &RunPodSandboxRequest{Config: config, RuntimeHandler: runtimeHandler}, resp)
+	return resp.PodSandboxID, err
+}
+
+// StopPodSandbox stops all processes of a pod sandbox
+func (c *Client) StopPodSandbox(ctx context.Context, id string) error {
+	return c.runtime(ctx, "StopPodSandbox", &StopPodSandboxRequest{PodSandboxID: id}, &StopPodSandboxResponse{})
+}
+
+// RemovePodSandbox removes a pod sandbox and any containers in it
+func (c *Client) RemovePodSandbox(ctx context.Context, id string) error {
+	return c.runtime(ctx, "RemovePodSandbox", &RemovePodSandboxRequest{PodSandboxID: id}, &RemovePodSandboxResponse{})
+}
+
+// ListPodSandbox lists the pod sandboxes matching the label selector
+func (c *Client) ListPodSandbox(ctx context.Context, labels map[string]string) ([]*PodSandbox, error) {
+	resp := &ListPodSandboxResponse{}
+	err := c.runtime(ctx, "ListPodSandbox", &ListPodSandboxRequest{Filter: &PodSandboxFilter{LabelSelector: labels}}, resp)
+	return resp.Items, err
+}
+
+// CreateContainer creates a container in a pod sandbox, returning its ID
+func (c *Client) CreateContainer(ctx context.Context, sandboxID string, config *ContainerConfig, sandboxConfig *PodSandboxConfig) (string, error) {
+	resp := &CreateContainerResponse{}
+	err := c.runtime(ctx, "CreateContainer", &CreateContainerRequest{
+		PodSandboxID:  sandboxID,
+		Config:        config,
+		SandboxConfig: sandboxConfig,
+	}, resp)
+	return resp.ContainerID, err
+}
+
+// StartContainer starts a created container
+func (c *Client) StartContainer(ctx context.Context, id string) error {
+	return c.runtime(ctx, "StartContainer", &StartContainerRequest{ContainerID: id}, &StartContainerResponse{})
+}
+
+// StopContainer stops a container, killing it after the timeout in seconds
+func (c *Client) StopContainer(ctx context.Context, id string, timeout int64) error {
+	return c.runtime(ctx, "StopContainer", &StopContainerRequest{ContainerID: id, Timeout: timeout}, &StopContainerResponse{})
+}
+
+// RemoveContainer removes a container
+func (c *Client) RemoveContainer(ctx context.Context, id string) error {
+	return c.runtime(ctx, "RemoveContainer", &RemoveContainerRequest{ContainerID: id}, &RemoveContainerResponse{})
+}
+
+// ExecSync runs a command in a running container and returns once it exits
+func (c *Client) ExecSync(ctx context.Context, id string, cmd []string) (*ExecSyncResponse, error) {
+	resp := &ExecSyncResponse{}
+	err := c.runtime(ctx, "ExecSync", &ExecSyncRequest{ContainerID: id, Cmd: cmd}, resp)
+	return resp, err
+}
+
+// ContainerStatus returns the status of a container
+func (c *Client) ContainerStatus(ctx context.Context, id string) (*ContainerStatus, error) {
+	resp := &ContainerStatusResponse{}
+	err := c.runtime(ctx, "ContainerStatus", &ContainerStatusRequest{ContainerID: id}, resp)
+	return resp.Status, err
+}
+
+// ImageStatus returns the image if it is present on the node, or nil
+func (c *Client) ImageStatus(ctx context.Context, image string) (*Image, error) {
+	resp := &ImageStatusResponse{}
+	err := c.image(ctx, "ImageStatus", &ImageStatusRequest{Image: &ImageSpec{Image: image}}, resp)
+	return resp.Image, err
+}
+
+// PullImage pulls an image, returning the image reference
+func (c *Client) PullImage(ctx context.Context, image string, sandboxConfig *PodSandboxConfig) (string, error) {
+	resp := &PullImageResponse{}
+	err := c.image(ctx, "PullImage", &PullImageRequest{Image: &ImageSpec{Image: image}, SandboxConfig: sandboxConfig}, resp)
+	return resp.ImageRef, err
+}
+
+// RemoveImage removes an image from the node
+func (c *Client) RemoveImage(ctx context.Context, image string) error {
+	return c.image(ctx, "RemoveImage", &RemoveImageRequest{Image: &ImageSpec{Image: image}}, &RemoveImageResponse{})
+}
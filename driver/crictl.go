@@ -0,0 +1,438 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCrictlBinary = "crictl"
+	defaultCRIOSocket   = "/var/run/crio/crio.sock"
+)
+
+// CrictlDriver is an implementation of the driver interface for CRI runtimes
+// using the crictl CLI, by default against CRI-O, so the CLI path can be
+// compared with the docker, ctr and nerdctl drivers, and with the CRI driver
+// on the same runtime. Every container runs in its own pod sandbox, created
+// from the same sandbox config template as the CRI driver's. The endpoint is
+// CRI-O's socket unless CONTAINER_RUNTIME_ENDPOINT is set.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type CrictlDriver struct {
+	cmdUsage
+	criSettings
+	crictlBinary string
+	// endpoint holds the global arguments selecting the runtime and image
+	// endpoints, prefixed to every command
+	endpoint   string
+	crictlInfo string
+	namePrefix string
+}
+
+// CrictlContainer is an implementation of the container metadata needed for crictl
+type CrictlContainer struct {
+	name        string
+	imageName   string
+	cmdOverride string
+	trace       bool
+	// podConfig and ctrConfig are the config files passed to crictl
+	podConfig   string
+	ctrConfig   string
+	podID       string
+	containerID string
+	resources   Resources
+}
+
+// NewCrictlDriver creates an instance of the crictl driver, providing a path to the
+// crictl binary, an optional path to a JSON pod sandbox config template, and
+// the name prefix of the pod sandboxes it cleans up
+func NewCrictlDriver(binaryPath, sandboxConfigPath string, opts ContainerOptions, namePrefix string) (Driver, error) {
+	if binaryPath == "" {
+		binaryPath = defaultCrictlBinary
+	}
+	resolvedBinPath, err := utils.ResolveBinary(binaryPath)
+	if err != nil {
+		return &CrictlDriver{}, err
+	}
+	settings, err := newCRISettings(sandboxConfigPath, opts)
+	if err != nil {
+		return &CrictlDriver{}, err
+	}
+	endpoint := os.Getenv("CONTAINER_RUNTIME_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "unix://" + defaultCRIOSocket
+	}
+	driver := &CrictlDriver{
+		criSettings:  settings,
+		crictlBinary: resolvedBinPath,
+		endpoint:     fmt.Sprintf("--runtime-endpoint %s --image-endpoint %s ", endpoint, endpoint),
+		namePrefix:   namePrefix,
+	}
+	return driver, nil
+}
+
+// Name returns the name of the container
+func (c *CrictlContainer) Name() string {
+	return c.name
+}
+
+// Detached always returns true for crictl as containers are never attached
+func (c *CrictlContainer) Detached() bool {
+	return true
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *CrictlContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the image name that the CRI runtime will use
+func (c *CrictlContainer) Image() string {
+	return c.imageName
+}
+
+// Command returns the override command that will be executed instead of
+// the default image-specified command
+func (c *CrictlContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources returns the resource limits the container is created with
+func (c *CrictlContainer) Resources() Resources {
+	return c.resources
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (c *CrictlDriver) Type() Type {
+	return Crictl
+}
+
+// Path returns the binary path of the crictl binary in use
+func (c *CrictlDriver) Path() string {
+	return c.crictlBinary
+}
+
+// Close is a no-op; the config files of a container are removed with it
+func (c *CrictlDriver) Close(ctx context.Context) error {
+	return nil
+}
+
+// crictl runs a crictl command against the driver's endpoint
+func (c *CrictlDriver) crictl(ctx context.Context, args string) (string, error) {
+	return utils.ExecCmdContext(ctx, c.crictlBinary, c.endpoint+args)
+}
+
+// Info returns the crictl client version and the runtime version reported
+// over CRI
+func (c *CrictlDriver) Info(ctx context.Context) (string, error) {
+	if c.crictlInfo != "" {
+		return c.crictlInfo, nil
+	}
+	out, err := c.crictl(ctx, "version")
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve crictl version info: %v (output: %s)", err, out)
+	}
+	// "Version:  0.1.0\nRuntimeName:  cri-o\nRuntimeVersion:  1.29.1\n..."
+	var fields []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if parts := strings.SplitN(line, ":", 2); len(parts) == 2 {
+			fields = append(fields, strings.TrimSpace(parts[0])+":"+strings.TrimSpace(parts[1]))
+		}
+	}
+	client, err := utils.ExecCmdContext(ctx, c.crictlBinary, "--version")
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve crictl version info: %v (output: %s)", err, client)
+	}
+	c.crictlInfo = fmt.Sprintf("crictl driver (binary: %s)\n[CLIENT:%s][RUNTIME:%s]", c.crictlBinary,
+		strings.TrimSpace(strings.TrimPrefix(client, "crictl version")), strings.Join(fields, "|"))
+	return c.crictlInfo, nil
+}
+
+// Create will create a container instance matching the specific needs of a
+// driver and write its pod sandbox and container configs; the image is
+// pulled if not already present on the node
+func (c *CrictlDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	present, err := c.HasImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if !present {
+		if out, err := c.crictl(ctx, "pull "+image); err != nil {
+			return nil, fmt.Errorf("Error pulling image %q: %v (output: %s)", image, err, out)
+		}
+	}
+	ctr := &CrictlContainer{
+		name:        name,
+		imageName:   image,
+		cmdOverride: cmdOverride,
+		trace:       trace,
+		resources:   c.resources,
+	}
+	sandbox, err := c.sandboxConfig(name, ctr.Resources())
+	if err != nil {
+		return nil, err
+	}
+	if ctr.podConfig, err = writeJSON("bb-crictl-"+name+"-pod-*.json", sandbox); err != nil {
+		return nil, err
+	}
+	if ctr.ctrConfig, err = writeJSON("bb-crictl-"+name+"-container-*.json", c.containerConfig(ctr, sandbox)); err != nil {
+		os.Remove(ctr.podConfig)
+		return nil, err
+	}
+	return ctr, nil
+}
+
+// writeJSON writes a config file passed to crictl to a new temporary file
+// matching pattern and returns its path
+func writeJSON(pattern string, v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Clean will clean the environment; removing all pod sandboxes (and their
+// containers) created by bucketbench
+func (c *CrictlDriver) Clean(ctx context.Context) error {
+	out, err := c.crictl(ctx, "pods --label "+criLabel+"=true -o json")
+	if err != nil {
+		return fmt.Errorf("Error listing crictl pod sandboxes: %v (output: %s)", err, out)
+	}
+	var pods struct {
+		Items []struct {
+			ID       string `json:"id"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(out), &pods); err != nil {
+		return fmt.Errorf("Error parsing crictl pod sandbox list: %v (output: %s)", err, out)
+	}
+	var own []string
+	for _, pod := range pods.Items {
+		if strings.HasPrefix(pod.Metadata.Name, c.namePrefix) {
+			own = append(own, pod.ID)
+		}
+	}
+	if len(own) == 0 {
+		return nil
+	}
+	log.Infof("Crictl: removing %d pod sandboxes from bucketbench runs", len(own))
+	if cleanLimited() {
+		for _, id := range own {
+			if err := paceClean(ctx); err != nil {
+				return err
+			}
+			if out, err := c.crictl(ctx, "stopp "+id); err != nil {
+				log.Warnf("Crictl: failed to stop pod sandbox %s: %v (output: %s)", id, err, out)
+			}
+			if out, err := c.crictl(ctx, "rmp -f "+id); err != nil {
+				log.Warnf("Crictl: failed to remove pod sandbox %s: %v (output: %s)", id, err, out)
+			}
+		}
+		return nil
+	}
+	if out, err := c.crictl(ctx, "stopp "+strings.Join(own, " ")); err != nil {
+		log.Warnf("Crictl: failed to stop pod sandboxes: %v (output: %s)", err, out)
+	}
+	if out, err := c.crictl(ctx, "rmp -f "+strings.Join(own, " ")); err != nil {
+		log.Warnf("Crictl: failed to remove pod sandboxes: %v (output: %s)", err, out)
+	}
+	return nil
+}
+
+// Run will create the pod sandbox, and create and start the container within
+// it; the elapsed time and client usage cover all three crictl invocations
+func (c *CrictlDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	crictlCtr, ok := ctr.(*CrictlContainer)
+	if !ok {
+		return "", 0, fmt.Errorf("Crictl driver cannot run container of type %T", ctr)
+	}
+	var usage utils.Usage
+	step := func(args string) (string, error) {
+		out, _, err := c.execTimed(ctx, c.crictlBinary, c.endpoint+args)
+		usage.User += c.last.User
+		usage.System += c.last.System
+		return strings.TrimSpace(out), err
+	}
+	start := time.Now()
+	out, err := step("runp " + crictlCtr.podConfig)
+	if err == nil {
+		crictlCtr.podID = out
+		out, err = step("create " + crictlCtr.podID + " " + crictlCtr.ctrConfig + " " + crictlCtr.podConfig)
+	}
+	if err == nil {
+		crictlCtr.containerID = out
+		out, err = step("start " + crictlCtr.containerID)
+	}
+	c.last = usage
+	if err != nil {
+		return out, 0, err
+	}
+	return out, utils.Elapsed(ctx, start), nil
+}
+
+// Stop will stop the container without any grace period
+func (c *CrictlDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	crictlCtr, err := c.runningContainer(ctr)
+	if err != nil {
+		return "", 0, err
+	}
+	return c.execTimed(ctx, c.crictlBinary, c.endpoint+"stop --timeout 0 "+crictlCtr.containerID)
+}
+
+// Remove will remove the container and stop and remove its pod sandbox
+func (c *CrictlDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	crictlCtr, err := c.runningContainer(ctr)
+	if err != nil {
+		return "", 0, err
+	}
+	var usage utils.Usage
+	start := time.Now()
+	for _, args := range []string{"rm " + crictlCtr.containerID, "stopp " + crictlCtr.podID, "rmp " + crictlCtr.podID} {
+		out, _, err := c.execTimed(ctx, c.crictlBinary, c.endpoint+args)
+		usage.User += c.last.User
+		usage.System += c.last.System
+		if err != nil {
+			c.last = usage
+			return out, 0, err
+		}
+	}
+	c.last = usage
+	os.Remove(crictlCtr.podConfig)
+	os.Remove(crictlCtr.ctrConfig)
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// Pause is not supported by crictl
+func (c *CrictlDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("pause is not supported by crictl")
+}
+
+// Unpause is not supported by crictl
+func (c *CrictlDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("unpause is not supported by crictl")
+}
+
+// Exec will run a command in a running container and wait for it to exit
+func (c *CrictlDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	crictlCtr, err := c.runningContainer(ctr)
+	if err != nil {
+		return "", 0, err
+	}
+	return c.execTimed(ctx, c.crictlBinary, c.endpoint+"exec "+crictlCtr.containerID+" "+command)
+}
+
+// Wait polls the container state until the container has exited
+func (c *CrictlDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	crictlCtr, err := c.runningContainer(ctr)
+	if err != nil {
+		return "", 0, err
+	}
+	c.last = utils.Usage{}
+	start := time.Now()
+	for {
+		out, err := c.crictl(ctx, "inspect -o go-template --template {{.status.state}} "+crictlCtr.containerID)
+		if err != nil {
+			return out, 0, fmt.Errorf("Error inspecting container %q: %v (output: %s)", ctr.Name(), err, out)
+		}
+		if strings.TrimSpace(out) == "CONTAINER_EXITED" {
+			return "", utils.Elapsed(ctx, start), nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+// Logs fetches the output of the container, which the runtime only keeps
+// when the sandbox config template sets a log_directory
+func (c *CrictlDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	crictlCtr, err := c.runningContainer(ctr)
+	if err != nil {
+		return "", 0, err
+	}
+	return c.execTimed(ctx, c.crictlBinary, c.endpoint+"logs "+crictlCtr.containerID)
+}
+
+// Checkpoint is not supported by the Crictl driver
+func (c *CrictlDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the Crictl driver")
+}
+
+// Restore is not supported by the Crictl driver
+func (c *CrictlDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the Crictl driver")
+}
+
+// HasImage returns whether the image is present on the node
+func (c *CrictlDriver) HasImage(ctx context.Context, image string) (bool, error) {
+	out, err := c.crictl(ctx, "images -q "+image)
+	if err != nil {
+		return false, fmt.Errorf("Error listing images: %v (output: %s)", err, out)
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+// PullImage pulls the image onto the node
+func (c *CrictlDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return c.execTimed(ctx, c.crictlBinary, c.endpoint+"pull "+image)
+}
+
+// ImageDigest returns the registry digest of the image on the node
+func (c *CrictlDriver) ImageDigest(ctx context.Context, image string) (string, error) {
+	out, err := c.crictl(ctx, "inspecti -o json "+image)
+	if err != nil {
+		return "", fmt.Errorf("Error inspecting image %q: %v (output: %s)", image, err, out)
+	}
+	var status struct {
+		Status struct {
+			RepoDigests []string `json:"repoDigests"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		return "", fmt.Errorf("Error parsing digests of image %q: %v (output: %s)", image, err, out)
+	}
+	return repoDigest(image, status.Status.RepoDigests)
+}
+
+// RemoveImage removes the image from the node
+func (c *CrictlDriver) RemoveImage(ctx context.Context, image string) error {
+	if out, err := c.crictl(ctx, "rmi "+image); err != nil {
+		return fmt.Errorf("Error removing image %q: %v (output: %s)", image, err, out)
+	}
+	return nil
+}
+
+// runningContainer returns the crictl container once it has been run and has IDs assigned
+func (c *CrictlDriver) runningContainer(ctr Container) (*CrictlContainer, error) {
+	crictlCtr, ok := ctr.(*CrictlContainer)
+	if !ok {
+		return nil, fmt.Errorf("Crictl driver cannot manage container of type %T", ctr)
+	}
+	if crictlCtr.containerID == "" {
+		return nil, fmt.Errorf("container %q has not been run", ctr.Name())
+	}
+	return crictlCtr, nil
+}
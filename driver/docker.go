@@ -2,21 +2,41 @@ package driver
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
 )
 
 const defaultDockerBinary = "docker"
 
+// dockerCheckpoint is the name of the checkpoints of the Docker driver
+const dockerCheckpoint = "bb-checkpoint"
+
 // DockerDriver is an implementation of the driver interface for the Docker engine.
+// Any engine with a Docker-compatible client binary (balena-engine, moby forks) can
+// be driven by providing its client binary; the detected engine is reported by Info.
 // IMPORTANT: This implementation does not protect instance metadata for thread safely.
 // At this time there is no understood use case for multi-threaded use of this implementation.
 type DockerDriver struct {
+	cmdUsage
 	dockerBinary string
 	dockerInfo   string
+	engine       string
+	vm           string
+	runtime      string
+	labels       map[string]string
+	runArgs      string
+	resources    Resources
+	runCommand   bool
+	namePrefix   string
 }
 
 // DockerContainer is an implementation of the container metadata needed for docker
@@ -26,10 +46,13 @@ type DockerContainer struct {
 	cmdOverride string
 	detached    bool
 	trace       bool
+	resources   Resources
 }
 
 // NewDockerDriver creates an instance of the docker driver, providing a path to the docker client binary
-func NewDockerDriver(binaryPath string) (Driver, error) {
+// and optionally the name of a runtime registered with the daemon (e.g. runsc) to run containers with,
+// and the name prefix of the containers it cleans up
+func NewDockerDriver(binaryPath, runtime string, opts ContainerOptions, namePrefix string) (Driver, error) {
 	if binaryPath == "" {
 		binaryPath = defaultDockerBinary
 	}
@@ -39,20 +62,27 @@ func NewDockerDriver(binaryPath string) (Driver, error) {
 	}
 	driver := &DockerDriver{
 		dockerBinary: resolvedBinPath,
+		runtime:      runtime,
+		labels:       opts.Labels,
+		runArgs:      runArgs(opts),
+		resources:    opts.Resources,
+		runCommand:   opts.RunCommand,
+		namePrefix:   namePrefix,
 	}
-	driver.Info()
+	driver.Info(context.Background())
 	return driver, nil
 }
 
 // newDockerContainer creates the metadata object of a docker-specific container with
 // image name, container runtime name, and any required additional information
-func newDockerContainer(name, image, cmd string, detached bool, trace bool) Container {
+func newDockerContainer(name, image, cmd string, detached bool, trace bool, resources Resources) Container {
 	return &DockerContainer{
 		name:        name,
 		imageName:   image,
 		cmdOverride: cmd,
 		detached:    detached,
 		trace:       trace,
+		resources:   resources,
 	}
 }
 
@@ -82,6 +112,11 @@ func (c *DockerContainer) Command() string {
 	return c.cmdOverride
 }
 
+// Resources returns the resource limits the container is created with
+func (c *DockerContainer) Resources() Resources {
+	return c.resources
+}
+
 // Type returns a driver.Type to indentify the driver implementation
 func (d *DockerDriver) Type() Type {
 	return Docker
@@ -92,88 +127,246 @@ func (d *DockerDriver) Path() string {
 	return d.dockerBinary
 }
 
+// Runtime returns the runtime containers are run with, or an empty string
+// for the daemon's default runtime
+func (d *DockerDriver) Runtime() string {
+	return d.runtime
+}
+
 // Close allows the driver to handle any resource free/connection closing
 // as necessary. Docker has no need to perform any actions on close.
-func (d *DockerDriver) Close() error {
+func (d *DockerDriver) Close(ctx context.Context) error {
 	return nil
 }
 
 // Info returns
-func (d *DockerDriver) Info() (string, error) {
+func (d *DockerDriver) Info(ctx context.Context) (string, error) {
 	if d.dockerInfo != "" {
 		return d.dockerInfo, nil
 	}
 
-	infoStart := "docker driver (binary: " + d.dockerBinary + ")\n"
-	version, err := utils.ExecCmd(d.dockerBinary, "version")
-	info, err := utils.ExecCmd(d.dockerBinary, "info")
+	version, err := utils.ExecCmdContext(ctx, d.dockerBinary, "version")
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve docker version info: %v", err)
+	}
+	info, err := utils.ExecCmdContext(ctx, d.dockerBinary, "info")
 	if err != nil {
 		return "", fmt.Errorf("Error trying to retrieve docker daemon info: %v", err)
 	}
-	d.dockerInfo = infoStart + parseDaemonInfo(version, info)
+	d.engine = detectEngine(d.dockerBinary, version)
+	d.vm = detectVMFromInfo(info, os.Getenv("DOCKER_HOST"))
+	infoStart := "docker driver (binary: " + d.dockerBinary + ")\n"
+	d.dockerInfo = infoStart + parseDaemonInfo(version, info) + "[ENGINE:" + d.engine + "]"
+	if d.vm != "" {
+		d.dockerInfo += "[VM:" + d.vm + "]"
+	}
 	return d.dockerInfo, nil
 }
 
+// Engine returns the name of the Docker-API-compatible engine detected
+// behind the client binary (e.g. "docker", "balena-engine")
+func (d *DockerDriver) Engine() string {
+	if d.engine == "" {
+		d.Info(context.Background())
+	}
+	return d.engine
+}
+
+// VM returns the local VM product (e.g. "colima") the engine runs in,
+// or an empty string if the engine runs on this host
+func (d *DockerDriver) VM() string {
+	if d.dockerInfo == "" {
+		d.Info(context.Background())
+	}
+	return d.vm
+}
+
 // Create will create a container instance matching the specific needs
 // of a driver
-func (d *DockerDriver) Create(name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
-	return newDockerContainer(name, image, cmdOverride, detached, trace), nil
+func (d *DockerDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	return newDockerContainer(name, image, cmdOverride, detached, trace, d.resources), nil
 }
 
 // Clean will clean the environment; removing any exited containers
-func (d *DockerDriver) Clean() error {
+func (d *DockerDriver) Clean(ctx context.Context) error {
+	if cleanLimited() {
+		return d.cleanPaced(ctx)
+	}
 	// clean up any containers from a prior run
 	log.Info("Docker: Stopping any running containers created during bucketbench runs")
-	cmd := "docker stop `docker ps -qf name=bb-ctr-`"
-	out, err := utils.ExecShellCmd(cmd)
+	// older engines match the name filter against the name with a leading slash
+	cmd := fmt.Sprintf("%[1]s stop `%[1]s ps -qf 'name=^/?%[2]s'`", d.dockerBinary, d.namePrefix)
+	out, err := utils.ExecShellCmdContext(ctx, cmd)
 	if err != nil {
 		// first make sure the error isn't simply that there were no
 		// containers to stop:
 		if !strings.Contains(out, "requires at least 1 argument") {
-			log.Warnf("Docker: Failed to stop running bb-ctr-* containers: %v (output: %s)", err, out)
+			log.Warnf("Docker: Failed to stop running %s* containers: %v (output: %s)", d.namePrefix, err, out)
 		}
 	}
 	log.Info("Docker: Removing exited containers from bucketbench runs")
-	cmd = "docker rm -f `docker ps -aqf name=bb-ctr-`"
-	out, err = utils.ExecShellCmd(cmd)
+	cmd = fmt.Sprintf("%[1]s rm -f `%[1]s ps -aqf 'name=^/?%[2]s'`", d.dockerBinary, d.namePrefix)
+	out, err = utils.ExecShellCmdContext(ctx, cmd)
 	if err != nil {
 		// first make sure the error isn't simply that there were no
 		// exited containers to remove:
 		if !strings.Contains(out, "requires at least 1 argument") {
-			log.Warnf("Docker: Failed to remove exited bb-ctr-* containers: %v (output: %s)", err, out)
+			log.Warnf("Docker: Failed to remove exited %s* containers: %v (output: %s)", d.namePrefix, err, out)
+		}
+	}
+	return nil
+}
+
+// cleanPaced removes the containers from prior runs one at a time at the
+// clean rate limit
+func (d *DockerDriver) cleanPaced(ctx context.Context) error {
+	out, err := utils.ExecShellCmdContext(ctx, fmt.Sprintf("%s ps -aqf 'name=^/?%s'", d.dockerBinary, d.namePrefix))
+	if err != nil {
+		return fmt.Errorf("Error getting docker container list: %v (output: %s)", err, out)
+	}
+	ids := strings.Fields(out)
+	log.Infof("Docker: Removing %d containers from bucketbench runs", len(ids))
+	for _, id := range ids {
+		if err := paceClean(ctx); err != nil {
+			return err
+		}
+		if out, err := utils.ExecCmdContext(ctx, d.dockerBinary, "rm -f "+id); err != nil {
+			log.Warnf("Docker: Failed to remove container %s: %v (output: %s)", id, err, out)
 		}
 	}
 	return nil
 }
 
 // Run will execute a container using the driver
-func (d *DockerDriver) Run(ctr Container) (string, int, error) {
+func (d *DockerDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
 	var detached string
 	if ctr.Detached() {
 		detached = "-d"
 	}
-	args := fmt.Sprintf("run %s --name %s %s", detached, ctr.Name(), ctr.Image())
-	return utils.ExecTimedCmd(d.dockerBinary, args)
+	var runtime string
+	if d.runtime != "" {
+		runtime = "--runtime=" + d.runtime + " "
+	}
+	args := fmt.Sprintf("run %s%s%s%s%s --name %s %s", runtime, labelArgs(d.labels), resourceArgs(ctr), d.runArgs, detached, ctr.Name(), ctr.Image())
+	if d.runCommand && ctr.Command() != "" {
+		args = args + " " + ctr.Command()
+	}
+	return d.execTimed(ctx, d.dockerBinary, args)
 }
 
 // Stop will stop/kill a container
-func (d *DockerDriver) Stop(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(d.dockerBinary, "kill "+ctr.Name())
+func (d *DockerDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return d.execTimed(ctx, d.dockerBinary, "kill "+ctr.Name())
 }
 
 // Remove will remove a container
-func (d *DockerDriver) Remove(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(d.dockerBinary, "rm "+ctr.Name())
+func (d *DockerDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	return d.execTimed(ctx, d.dockerBinary, "rm "+ctr.Name())
 }
 
 // Pause will pause a container
-func (d *DockerDriver) Pause(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(d.dockerBinary, "pause "+ctr.Name())
+func (d *DockerDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return d.execTimed(ctx, d.dockerBinary, "pause "+ctr.Name())
 }
 
 // Unpause will unpause/resume a container
-func (d *DockerDriver) Unpause(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(d.dockerBinary, "unpause "+ctr.Name())
+func (d *DockerDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return d.execTimed(ctx, d.dockerBinary, "unpause "+ctr.Name())
+}
+
+// Exec will run a command in a running container and wait for it to exit
+func (d *DockerDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	return d.execTimed(ctx, d.dockerBinary, "exec "+ctr.Name()+" "+command)
+}
+
+// Wait waits for the container to exit
+func (d *DockerDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	return d.execTimed(ctx, d.dockerBinary, "wait "+ctr.Name())
+}
+
+// Logs fetches the output of the container
+func (d *DockerDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return d.execTimed(ctx, d.dockerBinary, "logs "+ctr.Name())
+}
+
+// Checkpoint checkpoints the container, which requires the experimental
+// features of the daemon and CRIU; the container is stopped
+func (d *DockerDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return d.execTimed(ctx, d.dockerBinary, "checkpoint create "+ctr.Name()+" "+dockerCheckpoint)
+}
+
+// Restore starts the container from its checkpoint, which is then removed
+// (untimed) so the container can be checkpointed again
+func (d *DockerDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	out, elapsed, err := d.execTimed(ctx, d.dockerBinary, "start --checkpoint "+dockerCheckpoint+" "+ctr.Name())
+	if err == nil {
+		if rmOut, rmErr := utils.ExecCmd(d.dockerBinary, "checkpoint rm "+ctr.Name()+" "+dockerCheckpoint); rmErr != nil {
+			log.Warnf("Error removing the checkpoint of container %q: %v (output: %s)", ctr.Name(), rmErr, rmOut)
+		}
+	}
+	return out, elapsed, err
+}
+
+// ExitCode returns the exit code of the container's main process
+func (d *DockerDriver) ExitCode(ctx context.Context, ctr Container) (int, error) {
+	out, err := utils.ExecCmd(d.dockerBinary, "inspect --format {{.State.ExitCode}} "+ctr.Name())
+	if err != nil {
+		return 0, fmt.Errorf("Error inspecting container %q: %v (output: %s)", ctr.Name(), err, out)
+	}
+	return strconv.Atoi(strings.TrimSpace(out))
+}
+
+// HasImage returns whether the image is present on the engine
+func (d *DockerDriver) HasImage(ctx context.Context, image string) (bool, error) {
+	out, err := utils.ExecCmd(d.dockerBinary, "images -q "+image)
+	if err != nil {
+		return false, fmt.Errorf("Error listing images: %v (output: %s)", err, out)
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+// PullImage pulls the image from its registry
+func (d *DockerDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return d.execTimed(ctx, d.dockerBinary, "pull "+image)
+}
+
+// ImageDigest returns the registry digest of the local image
+func (d *DockerDriver) ImageDigest(ctx context.Context, image string) (string, error) {
+	out, err := utils.ExecCmd(d.dockerBinary, "image inspect --format {{json .RepoDigests}} "+image)
+	if err != nil {
+		return "", fmt.Errorf("Error inspecting image %q: %v (output: %s)", image, err, out)
+	}
+	var repoDigests []string
+	if err := json.Unmarshal([]byte(out), &repoDigests); err != nil {
+		return "", fmt.Errorf("Error parsing digests of image %q: %v (output: %s)", image, err, out)
+	}
+	return repoDigest(image, repoDigests)
+}
+
+// RemoveImage removes the image and prunes any dangling image content
+func (d *DockerDriver) RemoveImage(ctx context.Context, image string) error {
+	if out, err := utils.ExecCmdContext(ctx, d.dockerBinary, "rmi -f "+image); err != nil {
+		return fmt.Errorf("Error removing image %q: %v (output: %s)", image, err, out)
+	}
+	if out, err := utils.ExecCmdContext(ctx, d.dockerBinary, "image prune -f"); err != nil {
+		return fmt.Errorf("Error pruning images: %v (output: %s)", err, out)
+	}
+	return nil
+}
+
+// WriteTrace writes the daemon events of the container between start and
+// end, one JSON object per line with its nanosecond timestamp (timeNano)
+func (d *DockerDriver) WriteTrace(ctx context.Context, name string, start, end time.Time, dir string) ([]string, error) {
+	cmd := fmt.Sprintf("%s events --since %s --until %s --filter container=%s --format '{{json .}}'", d.dockerBinary, unixTimestamp(start), unixTimestamp(end), name)
+	out, err := utils.ExecShellCmd(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the events of container %s: %v (output: %s)", name, err, out)
+	}
+	path, err := writeTraceFile(dir, name, ".events.json", []byte(out))
+	if err != nil {
+		return nil, err
+	}
+	return []string{path}, nil
 }
 
 // return a condensed string of version and daemon information
@@ -228,3 +421,30 @@ func parseDaemonInfo(version, info string) string {
 	}
 	return fmt.Sprintf("[CLIENT:%s][SERVER:%s]", clientVer, serverVer)
 }
+
+// detectEngine determines which Docker-API-compatible engine is in use from the
+// "Server:" banner of the version output, falling back to the client binary name
+// for older engines which do not report a platform name
+func detectEngine(binary, version string) string {
+	scan := bufio.NewScanner(strings.NewReader(version))
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if !strings.HasPrefix(line, "Server:") {
+			continue
+		}
+		platform := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(line, "Server:")))
+		switch {
+		case platform == "":
+		case strings.Contains(platform, "balena"):
+			return "balena-engine"
+		case strings.Contains(platform, "docker"):
+			return "docker"
+		default:
+			return platform
+		}
+	}
+	if strings.Contains(filepath.Base(binary), "balena") {
+		return "balena-engine"
+	}
+	return "docker"
+}
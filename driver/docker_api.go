@@ -0,0 +1,599 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-connections/sockets"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// DockerAPIDriver is an implementation of the driver interface for the Docker engine
+// using the Docker client SDK against the Engine API on the daemon socket. Comparing
+// it with the Docker CLI driver separates the daemon latency from `docker` client
+// process overhead.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type DockerAPIDriver struct {
+	socketPath string
+	client     *client.Client
+	dockerInfo string
+	vm         string
+	runtime    string
+	nested     string
+	labels     map[string]string
+	resources  Resources
+	network    string
+	ports      []string
+	mounts     []Mount
+	user       string
+	namePrefix string
+}
+
+// DockerAPIContainer is an implementation of the container metadata needed for the Docker API
+type DockerAPIContainer struct {
+	name        string
+	imageName   string
+	cmdOverride string
+	detached    bool
+	trace       bool
+	resources   Resources
+}
+
+// NewDockerAPIDriver creates an instance of the Docker API driver, providing a path
+// to the Docker daemon socket, or a tcp:// or ssh:// address (defaulting to DOCKER_HOST), optionally the name of a runtime registered with
+// the daemon (e.g. runsc) to run containers with, and the kind of nested engine
+// (e.g. dind) if the daemon runs inside a container, and the name prefix of the
+// containers it cleans up
+func NewDockerAPIDriver(socketPath, runtime, nested string, opts ContainerOptions, namePrefix string) (Driver, error) {
+	if socketPath == "" {
+		switch host := os.Getenv("DOCKER_HOST"); {
+		case strings.HasPrefix(host, "unix://"):
+			socketPath = strings.TrimPrefix(host, "unix://")
+		case strings.HasPrefix(host, "tcp://"), strings.HasPrefix(host, "ssh://"):
+			socketPath = host
+		default:
+			socketPath = defaultDockerSocket
+		}
+	}
+	cli, err := newDockerClient(socketPath)
+	if err != nil {
+		return nil, err
+	}
+	driver := &DockerAPIDriver{
+		socketPath: socketPath,
+		client:     cli,
+		runtime:    runtime,
+		nested:     nested,
+		labels:     opts.Labels,
+		resources:  opts.Resources,
+		network:    opts.Network,
+		ports:      opts.Ports,
+		mounts:     opts.Mounts,
+		user:       opts.User,
+		namePrefix: namePrefix,
+	}
+	return driver, nil
+}
+
+// newDockerClient creates a Docker client SDK client of the daemon at a UNIX
+// socket path, or a tcp:// or ssh:// address; the client negotiates the API
+// version with the daemon on its first request. Requests over a socket or TCP
+// carry the trace context of their operation (see WithTraceParent); over ssh
+// the SDK needs its own transport to dial the hijacked connections of exec,
+// so they are sent without it.
+func newDockerClient(host string) (*client.Client, error) {
+	if strings.HasPrefix(host, "ssh://") {
+		if _, err := sshArgs(host, "docker"); err != nil {
+			return nil, err
+		}
+		// the host of the URL is only a placeholder, as every connection is
+		// an ssh session running the remote docker CLI's dial-stdio
+		return client.NewClientWithOpts(
+			client.WithHost("http://docker.example.com"),
+			client.WithDialContext(func(context.Context, string, string) (net.Conn, error) {
+				return sshDial(host, "docker")
+			}),
+			client.WithAPIVersionNegotiation(),
+		)
+	}
+	if !strings.HasPrefix(host, "tcp://") {
+		host = "unix://" + strings.TrimPrefix(host, "unix://")
+	}
+	hostURL, err := client.ParseHostURL(host)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{DisableCompression: true}
+	if err := sockets.ConfigureTransport(transport, hostURL.Scheme, hostURL.Host); err != nil {
+		return nil, err
+	}
+	return client.NewClientWithOpts(
+		client.WithHost(host),
+		client.WithHTTPClient(&http.Client{Transport: &traceTransport{transport}, CheckRedirect: client.CheckRedirect}),
+		client.WithAPIVersionNegotiation(),
+	)
+}
+
+// traceTransport sends the W3C trace context of each request's context as
+// its traceparent header
+type traceTransport struct {
+	base *http.Transport
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if tp := traceParent(req.Context()); tp != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(traceParentHeader, tp)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the base transport
+func (t *traceTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
+
+// newDockerAPIContainer creates the metadata object of a Docker API container with
+// image name, container runtime name, and any required additional information
+func newDockerAPIContainer(name, image, cmd string, detached bool, trace bool, resources Resources) Container {
+	return &DockerAPIContainer{
+		name:        name,
+		imageName:   image,
+		cmdOverride: cmd,
+		detached:    detached,
+		trace:       trace,
+		resources:   resources,
+	}
+}
+
+// Name returns the name of the container
+func (c *DockerAPIContainer) Name() string {
+	return c.name
+}
+
+// Detached returns whether the container should be started in detached mode
+func (c *DockerAPIContainer) Detached() bool {
+	return c.detached
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *DockerAPIContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the image name that Docker will use
+func (c *DockerAPIContainer) Image() string {
+	return c.imageName
+}
+
+// Command returns the optional overriding command that Docker will use
+// when executing a container based on this container's image
+func (c *DockerAPIContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources returns the resource limits the container is created with
+func (c *DockerAPIContainer) Resources() Resources {
+	return c.resources
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (d *DockerAPIDriver) Type() Type {
+	return DockerAPI
+}
+
+// Path returns the socket path of the Docker daemon
+func (d *DockerAPIDriver) Path() string {
+	return d.socketPath
+}
+
+// Runtime returns the runtime containers are run with, or an empty string
+// for the daemon's default runtime
+func (d *DockerAPIDriver) Runtime() string {
+	return d.runtime
+}
+
+// Nested returns the kind of nested engine the daemon runs in, or an empty
+// string for a daemon running on the host
+func (d *DockerAPIDriver) Nested() string {
+	return d.nested
+}
+
+// Close allows the driver to handle any resource free/connection closing
+// as necessary.
+func (d *DockerAPIDriver) Close(ctx context.Context) error {
+	d.client.HTTPClient().CloseIdleConnections()
+	return d.client.Close()
+}
+
+// Info returns the Docker daemon version details; this also verifies
+// the daemon is up and reachable, and negotiates the API version before any
+// timed operation
+func (d *DockerAPIDriver) Info(ctx context.Context) (string, error) {
+	if d.dockerInfo != "" {
+		return d.dockerInfo, nil
+	}
+	d.client.NegotiateAPIVersion(ctx)
+	version, err := d.client.ServerVersion(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve docker daemon version: %v", err)
+	}
+	info, err := d.client.Info(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve docker daemon info: %v", err)
+	}
+	d.vm = detectVM(info.Name, info.OperatingSystem, version.KernelVersion, d.socketPath)
+	d.dockerInfo = fmt.Sprintf("docker API driver (socket: %s)[SERVER:%s|API:%s|%s/%s|Kernel:%s]",
+		d.socketPath, version.Version, version.APIVersion, version.Os, version.Arch, version.KernelVersion)
+	if d.vm != "" {
+		d.dockerInfo += "[VM:" + d.vm + "]"
+	}
+	return d.dockerInfo, nil
+}
+
+// VM returns the local VM product (e.g. "colima") the engine runs in,
+// or an empty string if the engine runs on this host
+func (d *DockerAPIDriver) VM() string {
+	if d.dockerInfo == "" {
+		d.Info(context.Background())
+	}
+	return d.vm
+}
+
+// Create will create a container instance matching the specific needs
+// of a driver; the image is pulled through the API if not already present
+func (d *DockerAPIDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	if _, _, err := d.client.ImageInspectWithRaw(ctx, image); err != nil {
+		log.Debugf("docker API: image %q not found locally (%v); pulling", image, err)
+		if out, err := d.pull(ctx, image); err != nil {
+			log.Debugf("docker API: pull output: %s", out)
+			return nil, err
+		}
+	}
+	return newDockerAPIContainer(name, image, cmdOverride, detached, trace, d.resources), nil
+}
+
+// Clean will clean the environment; removing any containers created by bucketbench
+func (d *DockerAPIDriver) Clean(ctx context.Context) error {
+	list, err := d.client.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("name", "^/?"+d.namePrefix)),
+	})
+	if err != nil {
+		return fmt.Errorf("Error getting docker container list: %v", err)
+	}
+	log.Infof("docker API: removing %d containers from bucketbench runs", len(list))
+	for _, ctr := range list {
+		if err := paceClean(ctx); err != nil {
+			return err
+		}
+		if err := d.client.ContainerRemove(ctx, ctr.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			log.Warnf("docker API: failed to remove container %s (%v): %v", ctr.ID, ctr.Names, err)
+		}
+	}
+	return nil
+}
+
+// Run will create and start a container using the Docker API
+func (d *DockerAPIDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	config := &container.Config{
+		Image:  ctr.Image(),
+		User:   d.user,
+		Labels: d.labels,
+	}
+	if ctr.Command() != "" {
+		config.Cmd = strslice.StrSlice(strings.Split(ctr.Command(), " "))
+	}
+	resources := ctr.Resources()
+	hostConfig := &container.HostConfig{
+		Runtime:     d.runtime,
+		NetworkMode: container.NetworkMode(d.network),
+		Resources: container.Resources{
+			NanoCPUs:     int64(resources.CPUs * 1e9),
+			Memory:       resources.Memory,
+			CgroupParent: resources.CgroupParent,
+		},
+	}
+	if len(d.ports) > 0 {
+		config.ExposedPorts = nat.PortSet{}
+		hostConfig.PortBindings = nat.PortMap{}
+		for _, port := range d.ports {
+			n, proto := splitPort(port)
+			key := nat.Port(fmt.Sprintf("%d/%s", n, proto))
+			config.ExposedPorts[key] = struct{}{}
+			// an empty host port publishes on a random host port
+			hostConfig.PortBindings[key] = []nat.PortBinding{{HostPort: ""}}
+		}
+	}
+	for _, m := range d.mounts {
+		mnt := mount.Mount{Type: mount.Type(m.Type), Target: m.Target, ReadOnly: m.ReadOnly}
+		if m.Type != MountTmpfs {
+			mnt.Source = m.Source
+		}
+		if m.Type == MountBind && m.Propagation != "" {
+			mnt.BindOptions = &mount.BindOptions{Propagation: mount.Propagation(m.Propagation)}
+		}
+		hostConfig.Mounts = append(hostConfig.Mounts, mnt)
+	}
+	start := time.Now()
+	if _, err := d.client.ContainerCreate(ctx, config, hostConfig, nil, nil, ctr.Name()); err != nil {
+		return "", 0, err
+	}
+	if err := d.client.ContainerStart(ctx, ctr.Name(), types.ContainerStartOptions{}); err != nil {
+		return "", 0, err
+	}
+	if !ctr.Detached() {
+		if err := d.wait(ctx, ctr.Name()); err != nil {
+			return "", 0, err
+		}
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// Stop will stop/kill a container
+func (d *DockerAPIDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return d.timed(ctx, func() error {
+		return d.client.ContainerKill(ctx, ctr.Name(), "KILL")
+	})
+}
+
+// Remove will remove a container
+func (d *DockerAPIDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	return d.timed(ctx, func() error {
+		return d.client.ContainerRemove(ctx, ctr.Name(), types.ContainerRemoveOptions{})
+	})
+}
+
+// Pause will pause a container
+func (d *DockerAPIDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return d.timed(ctx, func() error {
+		return d.client.ContainerPause(ctx, ctr.Name())
+	})
+}
+
+// Unpause will unpause/resume a container
+func (d *DockerAPIDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return d.timed(ctx, func() error {
+		return d.client.ContainerUnpause(ctx, ctr.Name())
+	})
+}
+
+// Exec will run a command in a running container and wait for it to exit;
+// the exec is attached to, as the command has only exited once its output
+// stream is closed
+func (d *DockerAPIDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	args := strings.Split(command, " ")
+	start := time.Now()
+	created, err := d.client.ContainerExecCreate(ctx, ctr.Name(), types.ExecConfig{
+		Cmd:          args,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	attached, err := d.client.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", 0, err
+	}
+	_, err = io.Copy(ioutil.Discard, attached.Reader)
+	attached.Close()
+	if err != nil {
+		return "", 0, err
+	}
+	elapsed := utils.Elapsed(ctx, start)
+	inspect, err := d.client.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return "", 0, err
+	}
+	if inspect.ExitCode != 0 {
+		return "", 0, fmt.Errorf("exec of %q exited with status %d", command, inspect.ExitCode)
+	}
+	return "", elapsed, nil
+}
+
+// Wait waits for the container to exit
+func (d *DockerAPIDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	return d.timed(ctx, func() error {
+		return d.wait(ctx, ctr.Name())
+	})
+}
+
+// Logs fetches the output of the container, with the stdout and stderr
+// streams the engine multiplexes demultiplexed
+func (d *DockerAPIDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	start := time.Now()
+	logs, err := d.client.ContainerLogs(ctx, ctr.Name(), types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return "", 0, err
+	}
+	defer logs.Close()
+	raw, err := ioutil.ReadAll(logs)
+	if err != nil {
+		return "", 0, err
+	}
+	elapsed := utils.Elapsed(ctx, start)
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, bytes.NewReader(raw)); err != nil {
+		return "", 0, err
+	}
+	return out.String(), elapsed, nil
+}
+
+// Checkpoint is not supported by the DockerAPI driver
+func (d *DockerAPIDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the DockerAPI driver")
+}
+
+// Restore is not supported by the DockerAPI driver
+func (d *DockerAPIDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the DockerAPI driver")
+}
+
+// ExitCode returns the exit code of the container's main process
+func (d *DockerAPIDriver) ExitCode(ctx context.Context, ctr Container) (int, error) {
+	inspect, err := d.client.ContainerInspect(ctx, ctr.Name())
+	if err != nil {
+		return 0, err
+	}
+	return inspect.State.ExitCode, nil
+}
+
+// HasImage returns whether the image is present on the engine
+func (d *DockerAPIDriver) HasImage(ctx context.Context, image string) (bool, error) {
+	images, err := d.client.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", image)),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(images) > 0, nil
+}
+
+// PullImage pulls the image from its registry; the progress stream is read
+// to its end so the elapsed time covers the complete pull
+func (d *DockerAPIDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	start := time.Now()
+	out, err := d.pull(ctx, image)
+	if err != nil {
+		return out, 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// pull pulls the image, the "latest" tag of a reference without a tag or
+// digest, and returns the progress stream; the stream is decoded as the engine
+// reports a pull which fails once the response has started in the stream
+// rather than in the response status
+func (d *DockerAPIDriver) pull(ctx context.Context, image string) (string, error) {
+	progress, err := d.client.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer progress.Close()
+	stream, err := ioutil.ReadAll(progress)
+	if err != nil {
+		return string(stream), err
+	}
+	return string(stream), pullStreamError(stream)
+}
+
+// pullMessage is a message of the JSON progress stream of an image pull
+type pullMessage struct {
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+// pullStreamError returns the error reported in the progress stream of an
+// image pull, if any
+func pullStreamError(stream []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(stream))
+	for {
+		var msg pullMessage
+		err := dec.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error decoding the pull progress stream: %v", err)
+		}
+		if msg.ErrorDetail != nil {
+			return fmt.Errorf("Error pulling image: %s", msg.ErrorDetail.Message)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("Error pulling image: %s", msg.Error)
+		}
+	}
+}
+
+// ImageDigest returns the registry digest of the local image
+func (d *DockerAPIDriver) ImageDigest(ctx context.Context, image string) (string, error) {
+	inspect, _, err := d.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	return repoDigest(image, inspect.RepoDigests)
+}
+
+// WriteTrace writes the engine events of the container between start and
+// end, one JSON object per line with its nanosecond timestamp (timeNano)
+func (d *DockerAPIDriver) WriteTrace(ctx context.Context, name string, start, end time.Time, dir string) ([]string, error) {
+	messages, errs := d.client.Events(ctx, types.EventsOptions{
+		Since:   unixTimestamp(start),
+		Until:   unixTimestamp(end),
+		Filters: filters.NewArgs(filters.Arg("container", name)),
+	})
+	var raw bytes.Buffer
+	enc := json.NewEncoder(&raw)
+	for done := false; !done; {
+		select {
+		case msg := <-messages:
+			if err := enc.Encode(msg); err != nil {
+				return nil, err
+			}
+		case err := <-errs:
+			if err != io.EOF {
+				return nil, fmt.Errorf("Error getting the events of container %s: %v", name, err)
+			}
+			done = true
+		}
+	}
+	path, err := writeTraceFile(dir, name, ".events.json", raw.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return []string{path}, nil
+}
+
+// RemoveImage removes the image and prunes any dangling image content
+func (d *DockerAPIDriver) RemoveImage(ctx context.Context, image string) error {
+	if _, err := d.client.ImageRemove(ctx, image, types.ImageRemoveOptions{Force: true}); err != nil {
+		return err
+	}
+	_, err := d.client.ImagesPrune(ctx, filters.NewArgs())
+	return err
+}
+
+// wait waits for the container to exit
+func (d *DockerAPIDriver) wait(ctx context.Context, name string) error {
+	waited, errs := d.client.ContainerWait(ctx, name, container.WaitConditionNotRunning)
+	select {
+	case <-waited:
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+// timed calls an API operation and returns the elapsed milliseconds
+func (d *DockerAPIDriver) timed(ctx context.Context, call func() error) (string, int, error) {
+	start := time.Now()
+	if err := call(); err != nil {
+		return "", 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
@@ -0,0 +1,59 @@
+package driver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDockerAPITraceParent(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers = make(map[string]string)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers[r.Method+" "+r.URL.Path] = r.Header.Get(traceParentHeader)
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/_ping":
+			w.Header().Set("API-Version", "1.41")
+			w.Write([]byte("OK"))
+		case strings.HasSuffix(r.URL.Path, "/version"), strings.HasSuffix(r.URL.Path, "/info"):
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{}"))
+		case strings.HasSuffix(r.URL.Path, "/kill"):
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	drv, err := NewDockerAPIDriver("tcp://"+strings.TrimPrefix(srv.URL, "http://"), "", "", ContainerOptions{}, "bb-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer drv.Close(context.Background())
+	// Info negotiates the API version, so operations don't
+	if _, err := drv.Info(context.Background()); err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	ctr := newDockerAPIContainer("bb-ctr-1", "busybox", "", true, false, Resources{})
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if _, _, err := drv.Stop(WithTraceParent(context.Background(), tp), ctr); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := headers["POST /v1.41/containers/bb-ctr-1/kill"]; got != tp {
+		t.Errorf("traceparent of the kill request = %q, want %q (requests: %v)", got, tp, headers)
+	}
+	if _, ok := headers["HEAD /_ping"]; !ok {
+		t.Errorf("the API version was not negotiated (requests: %v)", headers)
+	}
+}
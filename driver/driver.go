@@ -1,6 +1,28 @@
 package driver
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultNamePrefix is the prefix of the names of the containers created by
+// benchmarks without a run ID
+const DefaultNamePrefix = "bb-ctr-"
+
+// Default sockets of the containerd-based drivers, which are not built on
+// Windows; shared with DaemonSocket
+const (
+	defaultContainerdPath  = "/run/containerd/containerd.sock"
+	defaultFirecrackerPath = "/run/firecracker-containerd/containerd.sock"
+)
+
+// waitPollInterval is the status polling interval of drivers whose engine
+// API has no blocking wait for a container exit
+const waitPollInterval = 10 * time.Millisecond
 
 // Type represents the know implementations of the driver interface
 type Type int
@@ -20,8 +42,57 @@ const (
 	// Null driver represents an empty driver for use by benchmarks that
 	// require no driver
 	Null
+	// PodmanAPI represents the Podman driver implementation using the
+	// libpod REST API of the Podman API service
+	PodmanAPI
+	// Podman represents the daemonless Podman driver implementation
+	// using the `podman` CLI
+	Podman
+	// CRI represents a driver for any CRI-conformant runtime (CRI-O,
+	// containerd CRI, cri-dockerd) using the CRI gRPC API
+	CRI
+	// DockerAPI represents the Docker driver implementation using the
+	// Engine REST API on the daemon socket
+	DockerAPI
+	// OCI represents a driver for any OCI runtime CLI (runc, crun, youki,
+	// kata-runtime) using bundles generated from a rootfs
+	OCI
+	// Kubelet represents a driver running static pods on a standalone
+	// kubelet via its manifest directory and read-only API
+	Kubelet
+	// Nspawn represents a driver for the systemd container stack, running
+	// systemd-nspawn machines from a rootfs controlled with machinectl
+	Nspawn
+	// Nerdctl represents the containerd driver implementation using the
+	// Docker-compatible `nerdctl` CLI
+	Nerdctl
+	// Apptainer represents a driver for Apptainer (Singularity) instances
+	// started from SIF images with the `apptainer` CLI
+	Apptainer
+	// Firecracker represents a driver for firecracker-containerd, running
+	// every container in its own Firecracker microVM
+	Firecracker
+	// Generic represents a driver for any engine, running command lines
+	// templated in the benchmark YAML with a shell
+	Generic
+	// Crictl represents a driver for CRI runtimes (by default CRI-O) using
+	// the `crictl` CLI
+	Crictl
+
+	// numBuiltinTypes is the number of built-in driver types; new built-in
+	// types go above it, and registered types are numbered from it
+	numBuiltinTypes
 )
 
+// BuiltinTypes returns the built-in driver types
+func BuiltinTypes() []Type {
+	types := make([]Type, 0, numBuiltinTypes)
+	for dtype := Docker; dtype < numBuiltinTypes; dtype++ {
+		types = append(types, dtype)
+	}
+	return types
+}
+
 // Container represents a generic container instance on any container engine
 type Container interface {
 	// Name returns the name of the container
@@ -41,66 +112,302 @@ type Container interface {
 	// Command returns an optional command that overrides the default image
 	// "CMD" or "ENTRYPOINT" for the Docker and Containerd (gRPC) drivers
 	Command() string
+
+	// Resources returns the resource limits the container is created with,
+	// for drivers for which SupportsResources is true
+	Resources() Resources
 }
 
 // Driver is an interface for various container engines. The integer returned from
-// container operations is the milliseconds elapsed for any command
+// container operations is the milliseconds elapsed for any command. Container
+// operations are abandoned with an error once their context is done.
 type Driver interface {
 
 	// Type returns a driver type to identify the driver
 	Type() Type
 
 	// Info returns a string with information about the container engine/runtime details
-	Info() (string, error)
+	Info(ctx context.Context) (string, error)
 
 	// Path returns the binary (or socket) path related to the runtime in use
 	Path() string
 
 	// Create will create a container instance matching the specific needs
 	// of a driver
-	Create(name, image, cmdOverride string, detached bool, trace bool) (Container, error)
+	Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error)
 
 	// Clean will clean the operating environment of a specific driver
-	Clean() error
+	Clean(ctx context.Context) error
 
 	// Run will execute a container using the driver
-	Run(ctr Container) (string, int, error)
+	Run(ctx context.Context, ctr Container) (string, int, error)
 
 	// Stop will stop/kill a container
-	Stop(ctr Container) (string, int, error)
+	Stop(ctx context.Context, ctr Container) (string, int, error)
 
 	// Remove will remove a container
-	Remove(ctr Container) (string, int, error)
+	Remove(ctx context.Context, ctr Container) (string, int, error)
 
 	// Pause will pause a container
-	Pause(ctr Container) (string, int, error)
+	Pause(ctx context.Context, ctr Container) (string, int, error)
 
 	// Unpause will unpause/resume a container
-	Unpause(ctr Container) (string, int, error)
+	Unpause(ctx context.Context, ctr Container) (string, int, error)
+
+	// Exec will run a command in a running container and wait for it to exit
+	Exec(ctx context.Context, ctr Container, command string) (string, int, error)
+
+	// Wait will block until the container has exited
+	Wait(ctx context.Context, ctr Container) (string, int, error)
+
+	// Logs will fetch the output of a container
+	Logs(ctx context.Context, ctr Container) (string, int, error)
+
+	// Checkpoint will checkpoint a running container with CRIU, which
+	// stops it
+	Checkpoint(ctx context.Context, ctr Container) (string, int, error)
+
+	// Restore will restore a checkpointed container, running it again
+	Restore(ctx context.Context, ctr Container) (string, int, error)
+
+	// PullImage will pull an image from its registry onto the engine
+	PullImage(ctx context.Context, image string) (string, int, error)
+
+	// RemoveImage will remove an image (and its content) from the engine
+	RemoveImage(ctx context.Context, image string) error
 
 	// Close allows the driver to free any resources/close any
 	// connections
-	Close() error
+	Close(ctx context.Context) error
 }
 
-// New creates a driver instance of a specific type
-func New(dtype Type, path string) (Driver, error) {
-	switch dtype {
-	case Runc:
-		return NewRuncDriver(path)
-	case Garden:
-		return NewGardenDriver(path)
-	case Docker:
-		return NewDockerDriver(path)
-	case Containerd:
-		return NewContainerdDriver(path)
-	case Ctr:
-		return NewCtrDriver(path)
-	case Null:
+// Config holds the settings used to create a driver instance
+type Config struct {
+	// Path is the client binary or API socket path; the driver's
+	// default is used when empty
+	Path string
+	// SandboxConfig is the path to a JSON pod sandbox config template
+	// used by the CRI driver
+	SandboxConfig string
+	// SharedSandbox runs all containers of a CRI driver instance in one
+	// persistent pod sandbox instead of a sandbox per container
+	SharedSandbox bool
+	// Nested is the kind of nested engine (dind, sysbox) the DockerAPI
+	// driver's daemon runs in
+	Nested string
+	// ManifestDir is the static pod manifest directory of the kubelet
+	// used by the Kubelet driver
+	ManifestDir string
+	// CRISocket is the socket of the CRI runtime beneath the kubelet used
+	// by the Kubelet driver
+	CRISocket string
+	// ForceClean makes Clean kill containers without a grace period where
+	// the driver otherwise waits for a graceful termination (Kubelet)
+	ForceClean bool
+	// Runtime is the OCI runtime (Docker) or runtime name (containerd) used
+	// for containers instead of the engine's default, e.g. runsc
+	Runtime string
+	// KernelImage and RootDrive are the kernel image and root drive of the
+	// microVMs booted by the Firecracker driver
+	KernelImage string
+	RootDrive   string
+	// Generic holds the command line templates of the Generic driver
+	Generic GenericTemplates
+	// StreamProcessors are the stream processors containerd runs with for
+	// this configuration; they are written to containerd's config by the
+	// run command, not by the drivers, and label the results
+	StreamProcessors []StreamProcessor
+	// Version labels the results with the version of the engine the
+	// configuration runs, for comparing builds of the same engine
+	Version string
+	// Container holds the settings applied to every container created
+	Container ContainerOptions
+	// NamePrefix is the prefix of the names of the benchmark's containers;
+	// Clean only removes containers with this prefix. Defaults to
+	// DefaultNamePrefix.
+	NamePrefix string
+}
+
+// ContainerOptions holds settings applied to every container a driver
+// creates; drivers ignore the settings they cannot apply
+type ContainerOptions struct {
+	// Labels are set on the containers (and pods) of drivers for which
+	// SupportsLabels is true
+	Labels map[string]string
+	// Resources are the limits of the containers of drivers for which
+	// SupportsResources is true
+	Resources Resources
+	// EngineFlags are extra arguments passed to the run command of the CLI
+	// drivers (docker, podman, nerdctl), e.g. "--pids-limit 100"
+	EngineFlags string
+	// Network is the network mode of the containers (NetworkBridge,
+	// NetworkHost or NetworkNone); empty for the engine's default
+	Network string
+	// Ports are the container ports published on random host ports, e.g.
+	// "80" or "53/udp", for drivers for which SupportsPorts is true
+	Ports []string
+	// Mounts are the volume, bind and tmpfs mounts of the containers, for
+	// drivers for which SupportsMount is true
+	Mounts []Mount
+	// User is the user the container's process runs as (a name or uid,
+	// optionally with ":group" or ":gid"), for drivers for which SupportsUser
+	// is true
+	User string
+	// RunCommand runs the Docker driver's containers with the command
+	// passed to Create; otherwise they run the image's default command
+	RunCommand bool
+}
+
+// Mount types
+const (
+	MountBind   = "bind"
+	MountVolume = "volume"
+	MountTmpfs  = "tmpfs"
+)
+
+// Mount is a mount of a container
+type Mount struct {
+	// Type is MountBind, MountVolume or MountTmpfs
+	Type string
+	// Source is the host path of a bind mount or the name of a volume
+	Source string
+	// Target is the path of the mount in the container
+	Target   string
+	ReadOnly bool
+	// Propagation is the propagation of a bind mount (private, rprivate,
+	// shared, rshared, slave or rslave); empty for the engine's default
+	Propagation string
+}
+
+// Network modes of containers
+const (
+	NetworkBridge = "bridge"
+	NetworkHost   = "host"
+	NetworkNone   = "none"
+)
+
+// Resources holds the resource limits of a container; zero values are not set
+type Resources struct {
+	// CPUs is the number of CPUs a container may use, e.g. 0.5
+	CPUs float64
+	// Memory is the memory limit in bytes
+	Memory int64
+	// CgroupParent is the cgroup under which the container's cgroup is created
+	CgroupParent string
+}
+
+// IsSet returns whether any limit is set
+func (r Resources) IsSet() bool {
+	return r.CPUs > 0 || r.Memory > 0 || r.CgroupParent != ""
+}
+
+// cpuPeriod is the CFS period, in microseconds, used to express a CPU limit
+// as a quota
+const cpuPeriod = 100000
+
+// cpuQuota returns the CFS quota of a CPU limit for cpuPeriod
+func (r Resources) cpuQuota() int64 {
+	return int64(r.CPUs * cpuPeriod)
+}
+
+// Factory creates a driver instance from its settings; the NamePrefix of the
+// config is always set
+type Factory func(config Config) (Driver, error)
+
+// factories holds the factory of every driver type, including the types
+// added with Register
+var factories = map[Type]Factory{
+	Runc: func(c Config) (Driver, error) {
+		return NewRuncDriver(c.Path, c.NamePrefix)
+	},
+	Garden: func(c Config) (Driver, error) {
+		return NewGardenDriver(c.Path, c.NamePrefix)
+	},
+	Docker: func(c Config) (Driver, error) {
+		return NewDockerDriver(c.Path, c.Runtime, c.Container, c.NamePrefix)
+	},
+	Containerd: func(c Config) (Driver, error) {
+		return NewContainerdDriver(c.Path, c.Runtime, c.Container, c.NamePrefix)
+	},
+	Ctr: func(c Config) (Driver, error) {
+		return NewCtrDriver(c.Path, c.NamePrefix)
+	},
+	PodmanAPI: func(c Config) (Driver, error) {
+		return NewPodmanAPIDriver(c.Path, c.Container, c.NamePrefix)
+	},
+	Podman: func(c Config) (Driver, error) {
+		return NewPodmanDriver(c.Path, c.Container, c.NamePrefix)
+	},
+	CRI: func(c Config) (Driver, error) {
+		return NewCRIDriver(c.Path, c.SandboxConfig, c.SharedSandbox, c.Container, c.NamePrefix)
+	},
+	DockerAPI: func(c Config) (Driver, error) {
+		return NewDockerAPIDriver(c.Path, c.Runtime, c.Nested, c.Container, c.NamePrefix)
+	},
+	OCI: func(c Config) (Driver, error) {
+		return NewOCIDriver(c.Path, c.Container, c.NamePrefix)
+	},
+	Kubelet: func(c Config) (Driver, error) {
+		return NewKubeletDriver(c.Path, c.ManifestDir, c.CRISocket, c.ForceClean, c.Container, c.NamePrefix)
+	},
+	Nspawn: func(c Config) (Driver, error) {
+		return NewNspawnDriver(c.Path, c.NamePrefix)
+	},
+	Nerdctl: func(c Config) (Driver, error) {
+		return NewNerdctlDriver(c.Path, c.Runtime, c.Container, c.NamePrefix)
+	},
+	Apptainer: func(c Config) (Driver, error) {
+		return NewApptainerDriver(c.Path, c.NamePrefix)
+	},
+	Firecracker: func(c Config) (Driver, error) {
+		return NewFirecrackerDriver(c.Path, c.KernelImage, c.RootDrive, c.Container, c.NamePrefix)
+	},
+	Generic: func(c Config) (Driver, error) {
+		return NewGenericDriver(c.Path, c.Generic, c.NamePrefix)
+	},
+	Crictl: func(c Config) (Driver, error) {
+		return NewCrictlDriver(c.Path, c.SandboxConfig, c.Container, c.NamePrefix)
+	},
+	Null: func(c Config) (Driver, error) {
 		return nil, nil
-	default:
+	},
+}
+
+// registered maps the names of the driver types added with Register to
+// their types; nextType is the type the next one is assigned
+var (
+	registered = make(map[string]Type)
+	nextType   = numBuiltinTypes
+)
+
+// Register adds a driver type which can then be used as the type of a driver
+// in a benchmark YAML, so programs embedding bucketbench can benchmark their
+// own engines, and returns the type, which the driver's Type method returns.
+// Registering the name of an existing type replaces its factory. Registered
+// types support the operations which every driver supports by default; an
+// unsupported operation returns an error when run. Register is not safe for
+// concurrent use and is meant to be called from init functions.
+func Register(name string, factory Factory) Type {
+	dtype := StringToType(name)
+	if dtype == Null && name != "Null" {
+		dtype = nextType
+		nextType++
+		registered[name] = dtype
+	}
+	factories[dtype] = factory
+	return dtype
+}
+
+// New creates a driver instance of a specific type
+func New(dtype Type, config Config) (Driver, error) {
+	if config.NamePrefix == "" {
+		config.NamePrefix = DefaultNamePrefix
+	}
+	factory, ok := factories[dtype]
+	if !ok {
 		return nil, fmt.Errorf("No such driver type: %v", dtype)
 	}
+	return factory(config)
 }
 
 // TypeToString converts a driver Type into its string representation
@@ -117,8 +424,37 @@ func TypeToString(dtype Type) string {
 		driverType = "Runc"
 	case Garden:
 		driverType = "Garden"
+	case PodmanAPI:
+		driverType = "PodmanAPI"
+	case Podman:
+		driverType = "Podman"
+	case CRI:
+		driverType = "CRI"
+	case DockerAPI:
+		driverType = "DockerAPI"
+	case OCI:
+		driverType = "OCI"
+	case Kubelet:
+		driverType = "Kubelet"
+	case Nspawn:
+		driverType = "Nspawn"
+	case Nerdctl:
+		driverType = "Nerdctl"
+	case Apptainer:
+		driverType = "Apptainer"
+	case Firecracker:
+		driverType = "Firecracker"
+	case Generic:
+		driverType = "Generic"
+	case Crictl:
+		driverType = "Crictl"
 	default:
 		driverType = "(unknown)"
+		for name, t := range registered {
+			if t == dtype {
+				driverType = name
+			}
+		}
 	}
 	return driverType
 }
@@ -137,8 +473,418 @@ func StringToType(dtype string) Type {
 		driverType = Runc
 	case "Garden":
 		driverType = Garden
+	case "PodmanAPI":
+		driverType = PodmanAPI
+	case "Podman":
+		driverType = Podman
+	case "CRI":
+		driverType = CRI
+	case "DockerAPI":
+		driverType = DockerAPI
+	case "OCI":
+		driverType = OCI
+	case "Kubelet":
+		driverType = Kubelet
+	case "Nspawn":
+		driverType = Nspawn
+	case "Nerdctl":
+		driverType = Nerdctl
+	case "Apptainer":
+		driverType = Apptainer
+	case "Firecracker":
+		driverType = Firecracker
+	case "Generic":
+		driverType = Generic
+	case "Crictl":
+		driverType = Crictl
 	default:
 		driverType = Null
+		if t, ok := registered[dtype]; ok {
+			driverType = t
+		}
 	}
 	return driverType
 }
+
+// DaemonService returns the name of the systemd unit which manages the daemon
+// behind a driver type, or an empty string for daemonless drivers
+func DaemonService(dtype Type) string {
+	switch dtype {
+	case Docker, DockerAPI:
+		return "docker"
+	case Containerd, Ctr, Nerdctl:
+		return "containerd"
+	case PodmanAPI:
+		return "podman"
+	case Garden:
+		return "garden"
+	case Kubelet:
+		return "kubelet"
+	case Nspawn:
+		return "systemd-machined"
+	case Firecracker:
+		return "firecracker-containerd"
+	case Crictl:
+		return "crio"
+	default:
+		return ""
+	}
+}
+
+// DaemonSocket returns the default path of the socket of the daemon behind a
+// driver type, which both the API drivers and the CLIs of the exec-based
+// drivers connect to; empty for drivers without a daemon socket
+func DaemonSocket(dtype Type) string {
+	switch dtype {
+	case Docker, DockerAPI:
+		return defaultDockerSocket
+	case Containerd, Ctr, Nerdctl:
+		return defaultContainerdPath
+	case PodmanAPI:
+		return defaultPodmanSocket
+	case CRI:
+		return defaultCRISocket
+	case Firecracker:
+		return defaultFirecrackerPath
+	case Crictl:
+		return defaultCRIOSocket
+	default:
+		return ""
+	}
+}
+
+// defaultContainerdDebugPath is the socket of containerd's debug endpoints
+// when debug.address is set to it in the containerd config
+const defaultContainerdDebugPath = "/run/containerd/debug.sock"
+
+// DebugSocket returns the default path of the socket serving the Go pprof
+// endpoints (/debug/pprof) of the daemon behind a driver type, available once
+// the daemon's debug mode is enabled; empty for drivers without one
+func DebugSocket(dtype Type) string {
+	switch dtype {
+	case Docker, DockerAPI:
+		return defaultDockerSocket
+	case Containerd, Ctr, Nerdctl, CRI:
+		return defaultContainerdDebugPath
+	default:
+		return ""
+	}
+}
+
+// DataRoot returns the default directory in which the engine behind a driver
+// type stores images and container filesystems, or an empty string if it
+// has none
+func DataRoot(dtype Type) string {
+	switch dtype {
+	case Docker, DockerAPI:
+		return "/var/lib/docker"
+	case Containerd, Ctr, Nerdctl, CRI:
+		return "/var/lib/containerd"
+	case Podman, PodmanAPI, Crictl:
+		return "/var/lib/containers"
+	case Kubelet:
+		return "/var/lib/kubelet"
+	case Garden:
+		return "/var/lib/gdn"
+	case Nspawn:
+		return "/var/lib/machines"
+	case Firecracker:
+		return "/var/lib/firecracker-containerd"
+	default:
+		return ""
+	}
+}
+
+// DaemonProcesses returns the process names of the daemons which perform
+// work on behalf of a driver type; empty for daemonless drivers
+func DaemonProcesses(dtype Type) []string {
+	switch dtype {
+	case Docker, DockerAPI:
+		return []string{"dockerd", "containerd"}
+	case Containerd, Ctr, Nerdctl:
+		return []string{"containerd"}
+	case PodmanAPI:
+		return []string{"podman"}
+	case CRI:
+		return []string{"containerd", "crio", "cri-dockerd"}
+	case Crictl:
+		return []string{"crio", "containerd"}
+	case Kubelet:
+		return []string{"kubelet", "containerd", "crio", "cri-dockerd"}
+	case Garden:
+		return []string{"gdn"}
+	case Nspawn:
+		return []string{"systemd-machined"}
+	case Firecracker:
+		return []string{"firecracker-containerd", "firecracker"}
+	default:
+		return nil
+	}
+}
+
+// SupportsPause returns whether a driver type can pause and unpause containers
+func SupportsPause(dtype Type) bool {
+	return dtype != CRI && dtype != Crictl && dtype != Kubelet && dtype != Apptainer
+}
+
+// SupportsExec returns whether a driver type can run a command in a container
+func SupportsExec(dtype Type) bool {
+	return dtype != Kubelet
+}
+
+// SupportsWait returns whether a driver type can wait for a container to exit
+func SupportsWait(dtype Type) bool {
+	return dtype != Ctr && dtype != Garden
+}
+
+// SupportsLogs returns whether a driver type can fetch the output of a container
+func SupportsLogs(dtype Type) bool {
+	switch dtype {
+	case Docker, DockerAPI, Podman, PodmanAPI, CRI, Crictl, Nspawn, Nerdctl, Generic:
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportsCheckpoint returns whether a driver type can checkpoint and restore
+// a container
+func SupportsCheckpoint(dtype Type) bool {
+	switch dtype {
+	case Docker, Runc, Generic:
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportsLabels returns whether a driver type can label the containers it creates
+func SupportsLabels(dtype Type) bool {
+	switch dtype {
+	case Docker, DockerAPI, Podman, PodmanAPI, Containerd, CRI, Crictl, Kubelet, Nerdctl, Firecracker:
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportsResources returns whether a driver type can apply resource limits
+// to the containers it creates
+func SupportsResources(dtype Type) bool {
+	switch dtype {
+	case Docker, DockerAPI, Podman, PodmanAPI, Containerd, CRI, Crictl, Kubelet, Nerdctl:
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportsEngineFlags returns whether a driver type passes extra engine flags
+// to its run command
+func SupportsEngineFlags(dtype Type) bool {
+	switch dtype {
+	case Docker, Podman, Nerdctl:
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportsNetwork returns whether a driver type can run containers in a
+// network mode
+func SupportsNetwork(dtype Type, network string) bool {
+	switch dtype {
+	case Docker, DockerAPI, Podman, PodmanAPI, Nerdctl:
+		return true
+	case Containerd:
+		// without CNI, containers get an unconnected network namespace
+		return network == NetworkHost || network == NetworkNone
+	case CRI, Crictl, Kubelet:
+		// pods are always connected to the pod network
+		return network == NetworkBridge || network == NetworkHost
+	default:
+		return false
+	}
+}
+
+// SupportsUser returns whether a driver type can run the container's process
+// as a user
+func SupportsUser(dtype Type, user string) bool {
+	switch dtype {
+	case Docker, DockerAPI, Podman, PodmanAPI, Nerdctl:
+		return true
+	case Containerd, CRI, Crictl:
+		// names would have to be looked up in the image's /etc/passwd
+		_, _, _, ok := numericUser(user)
+		return ok
+	default:
+		return false
+	}
+}
+
+// numericUser parses a user of the form uid or uid:gid
+func numericUser(user string) (uid, gid uint32, hasGID bool, ok bool) {
+	parts := strings.SplitN(user, ":", 2)
+	u, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, false, false
+	}
+	if len(parts) == 1 {
+		return uint32(u), 0, false, true
+	}
+	g, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, 0, false, false
+	}
+	return uint32(u), uint32(g), true, true
+}
+
+// SupportsPorts returns whether a driver type can publish container ports
+func SupportsPorts(dtype Type) bool {
+	switch dtype {
+	case Docker, DockerAPI, Podman, PodmanAPI, Nerdctl:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsStubbed returns whether a lifecycle operation (e.g. "stop") is accepted
+// by a driver type without being performed, so its timing is recorded as zero;
+// previous are the operations run on the container before it
+func IsStubbed(dtype Type, op string, previous []string) bool {
+	switch dtype {
+	case Garden:
+		return op == "stop" || op == "pause" || op == "unpause"
+	case Kubelet:
+		// stopping a static pod removes it along with its containers
+		if op == "remove" {
+			for _, prev := range previous {
+				if prev == "stop" {
+					return true
+				}
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// SupportsMount returns whether a driver type can mount a type of mount
+// into its containers
+func SupportsMount(dtype Type, mountType string) bool {
+	switch dtype {
+	case Docker, DockerAPI, Podman, PodmanAPI, Nerdctl:
+		return true
+	case Containerd, OCI, Kubelet:
+		return mountType == MountBind || mountType == MountTmpfs
+	case CRI, Crictl:
+		return mountType == MountBind
+	default:
+		return false
+	}
+}
+
+// propagationMode returns the Kubernetes mount propagation mode of a bind
+// mount propagation: HostToContainer for (r)slave, Bidirectional for
+// (r)shared, or empty for private
+func propagationMode(propagation string) string {
+	switch strings.TrimPrefix(propagation, "r") {
+	case "slave":
+		return "HostToContainer"
+	case "shared":
+		return "Bidirectional"
+	default:
+		return ""
+	}
+}
+
+// mountArg returns the --mount argument of a CLI driver's run command
+func mountArg(m Mount) string {
+	arg := "--mount type=" + m.Type
+	if m.Type != MountTmpfs {
+		arg += ",source=" + m.Source
+	}
+	arg += ",target=" + m.Target
+	if m.ReadOnly {
+		arg += ",readonly"
+	}
+	if m.Type == MountBind && m.Propagation != "" {
+		arg += ",bind-propagation=" + m.Propagation
+	}
+	return arg + " "
+}
+
+// splitPort returns the number and protocol of a published port, e.g.
+// "53/udp"; the protocol defaults to tcp
+func splitPort(port string) (int, string) {
+	proto := "tcp"
+	if i := strings.Index(port, "/"); i != -1 {
+		port, proto = port[:i], port[i+1:]
+	}
+	n, _ := strconv.Atoi(port)
+	return n, proto
+}
+
+// resourceArgs returns the resource limit arguments of a CLI driver's run
+// command for a container
+func resourceArgs(ctr Container) string {
+	var args []string
+	r := ctr.Resources()
+	if r.CPUs > 0 {
+		args = append(args, "--cpus "+strconv.FormatFloat(r.CPUs, 'f', -1, 64)+" ")
+	}
+	if r.Memory > 0 {
+		args = append(args, "--memory "+strconv.FormatInt(r.Memory, 10)+" ")
+	}
+	if r.CgroupParent != "" {
+		args = append(args, "--cgroup-parent "+r.CgroupParent+" ")
+	}
+	return strings.Join(args, "")
+}
+
+// runArgs returns the network, mount and extra engine arguments of a CLI
+// driver's run command
+func runArgs(opts ContainerOptions) string {
+	var args []string
+	if opts.Network != "" {
+		args = append(args, "--network "+opts.Network+" ")
+	}
+	if opts.User != "" {
+		args = append(args, "--user "+opts.User+" ")
+	}
+	for _, port := range opts.Ports {
+		args = append(args, "-p "+port+" ")
+	}
+	for _, m := range opts.Mounts {
+		args = append(args, mountArg(m))
+	}
+	// the arguments are split on single spaces when executed
+	if flags := strings.Fields(opts.EngineFlags); len(flags) > 0 {
+		args = append(args, strings.Join(flags, " ")+" ")
+	}
+	return strings.Join(args, "")
+}
+
+// labelArgs returns the --label arguments of a CLI driver's run command, in
+// a stable order
+func labelArgs(labels map[string]string) string {
+	var args []string
+	for k, v := range labels {
+		args = append(args, "--label "+k+"="+v+" ")
+	}
+	sort.Strings(args)
+	return strings.Join(args, "")
+}
+
+// repoDigest returns the digest of the first of an image's repository digests
+// (name@sha256:...), which identifies the registry manifest it was pulled from
+func repoDigest(image string, repoDigests []string) (string, error) {
+	for _, ref := range repoDigests {
+		if i := strings.LastIndex(ref, "@"); i != -1 {
+			return ref[i+1:], nil
+		}
+	}
+	return "", fmt.Errorf("Image %q has no registry digest; only images pulled from a registry can be pinned", image)
+}
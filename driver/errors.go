@@ -0,0 +1,71 @@
+package driver
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// The classes of operation errors returned by ClassifyError
+const (
+	// ErrorTimeout is an operation which exceeded its deadline
+	ErrorTimeout = "timeout"
+	// ErrorDaemonUnavailable is an operation which could not reach the
+	// engine daemon, see IsDaemonUnavailable
+	ErrorDaemonUnavailable = "daemon unavailable"
+	// ErrorNameConflict is an operation which found a container of the same
+	// name, e.g. one left behind by an earlier run
+	ErrorNameConflict = "name conflict"
+	// ErrorNonzeroExit is a client command which exited with a nonzero status
+	ErrorNonzeroExit = "nonzero exit"
+	// ErrorOther is any other error
+	ErrorOther = "other"
+)
+
+// nameConflictMessages are fragments of client errors and CLI output which
+// indicate the container name is already taken
+var nameConflictMessages = []string{
+	"is already in use",
+	"already exists",
+	"name conflict",
+}
+
+// IsNameConflict returns whether an operation error (and its output, for CLI
+// drivers) shows a container of the same name already exists
+func IsNameConflict(err error, output string) bool {
+	if err == nil {
+		return false
+	}
+	if grpc.Code(err) == codes.AlreadyExists {
+		return true
+	}
+	msg := strings.ToLower(err.Error() + " " + output)
+	for _, fragment := range nameConflictMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifyError returns the class of an operation error (and its output, for
+// CLI drivers), so the results show why operations failed; a daemon which is
+// unreachable or a name conflict is recognized before the nonzero exit of the
+// client reporting it
+func ClassifyError(err error, output string) string {
+	switch {
+	case err == context.DeadlineExceeded, grpc.Code(err) == codes.DeadlineExceeded:
+		return ErrorTimeout
+	case IsDaemonUnavailable(err, output):
+		return ErrorDaemonUnavailable
+	case IsNameConflict(err, output):
+		return ErrorNameConflict
+	}
+	if _, ok := err.(*exec.ExitError); ok || strings.Contains(err.Error(), "exit status") {
+		return ErrorNonzeroExit
+	}
+	return ErrorOther
+}
@@ -0,0 +1,223 @@
+//go:build !windows
+// +build !windows
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containerd/containerd/namespaces"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFirecrackerSnapshotter   = "devmapper"
+	defaultFirecrackerRuntimeConfig = "/etc/containerd/firecracker-runtime.json"
+	firecrackerRuntime              = "aws.firecracker"
+)
+
+// FirecrackerDriver is an implementation of the driver interface for
+// firecracker-containerd, which runs every container in its own Firecracker
+// microVM. It drives the firecracker-containerd daemon like the Containerd
+// driver drives containerd, with the aws.firecracker runtime and a block
+// device snapshotter, so microVM boot latency can be compared with runc
+// containers on the same operations.
+type FirecrackerDriver struct {
+	*ContainerdDriver
+	kernelImage string
+	rootDrive   string
+	// vmConfig is set while the driver holds the microVM config
+	vmConfig bool
+}
+
+// NewFirecrackerDriver creates an instance of the firecracker-containerd driver, providing
+// the daemon's socket path, optionally the paths of the microVM kernel image and root drive
+// to set in the runtime config, the options of the containers it creates and the name prefix
+// of the containers it cleans up
+func NewFirecrackerDriver(path, kernelImage, rootDrive string, opts ContainerOptions, namePrefix string) (Driver, error) {
+	if path == "" {
+		path = defaultFirecrackerPath
+	}
+	ctrd, err := newContainerdDriver(path, firecrackerRuntime, opts, namePrefix)
+	if err != nil {
+		return &FirecrackerDriver{}, err
+	}
+	ctrd.snapshotter = os.Getenv("CONTAINERD_SNAPSHOTTER")
+	if ctrd.snapshotter == "" {
+		ctrd.snapshotter = defaultFirecrackerSnapshotter
+	}
+	driver := &FirecrackerDriver{
+		ContainerdDriver: ctrd,
+		kernelImage:      kernelImage,
+		rootDrive:        rootDrive,
+	}
+	if kernelImage != "" || rootDrive != "" {
+		if err := firecrackerVM.acquire(kernelImage, rootDrive); err != nil {
+			ctrd.Close(context.Background())
+			return &FirecrackerDriver{}, err
+		}
+		driver.vmConfig = true
+	}
+	return driver, nil
+}
+
+// Close releases the microVM config, restoring the original runtime config
+// once the last driver setting it is closed, and closes the client connection
+func (f *FirecrackerDriver) Close(ctx context.Context) error {
+	if f.vmConfig {
+		f.vmConfig = false
+		if err := firecrackerVM.release(); err != nil {
+			log.Errorf("Firecracker: %v", err)
+		}
+	}
+	return f.ContainerdDriver.Close(ctx)
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (f *FirecrackerDriver) Type() Type {
+	return Firecracker
+}
+
+// Runtime returns an empty string, as the aws.firecracker runtime is implied
+// by the driver
+func (f *FirecrackerDriver) Runtime() string {
+	return ""
+}
+
+// Info returns the firecracker-containerd daemon version and the microVM
+// configuration
+func (f *FirecrackerDriver) Info(ctx context.Context) (string, error) {
+	version, err := f.client.Version(namespaces.WithNamespace(ctx, f.namespace))
+	if err != nil {
+		return "", err
+	}
+	info := "firecracker-containerd driver (daemon: " + version.Version + "[Revision: " + version.Revision + "] snapshotter: " + f.snapshotter + ")"
+	if f.kernelImage != "" {
+		info += "\n[KERNEL:" + f.kernelImage + "]"
+	}
+	if f.rootDrive != "" {
+		info += "[ROOTDRIVE:" + f.rootDrive + "]"
+	}
+	return info, nil
+}
+
+// firecrackerRuntimeConfig returns the path of the aws.firecracker runtime
+// config, which the runtime reads for every microVM it boots
+func firecrackerRuntimeConfig() string {
+	if path := os.Getenv("FIRECRACKER_CONTAINERD_RUNTIME_CONFIG_PATH"); path != "" {
+		return path
+	}
+	return defaultFirecrackerRuntimeConfig
+}
+
+// firecrackerVM is the microVM config of the runtime config, shared by the
+// Firecracker drivers of the process: the first driver setting the kernel
+// image and root drive saves the original config and the last one closed
+// restores it, so the host's config is left as it was found
+var firecrackerVM = &vmConfig{}
+
+// vmConfig tracks the drivers holding a microVM config in the runtime config
+type vmConfig struct {
+	mu       sync.Mutex
+	drivers  int
+	path     string
+	original []byte
+	existed  bool
+	changed  bool
+}
+
+// acquire sets the kernel image and root drive of the microVMs in the runtime
+// config, keeping its other settings; drivers of the process must all set
+// the same ones
+func (v *vmConfig) acquire(kernelImage, rootDrive string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	path := firecrackerRuntimeConfig()
+	if v.drivers > 0 && path != v.path {
+		return fmt.Errorf("Firecracker runtime config %q is in use by another driver, not %q", v.path, path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error reading firecracker runtime config %q: %v", path, err)
+	}
+	existed := err == nil
+	config := make(map[string]interface{})
+	if existed {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("Error parsing firecracker runtime config %q: %v", path, err)
+		}
+	}
+	changed := false
+	for key, value := range map[string]string{"kernel_image_path": kernelImage, "root_drive": rootDrive} {
+		if value == "" || config[key] == value {
+			continue
+		}
+		if v.drivers > 0 {
+			return fmt.Errorf("Firecracker %s %q differs from the %v set by another driver", key, value, config[key])
+		}
+		if _, err := os.Stat(value); err != nil {
+			return fmt.Errorf("Invalid firecracker %s: %v", key, err)
+		}
+		config[key] = value
+		changed = true
+	}
+	if changed {
+		updated, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFirecrackerConfig(path, updated); err != nil {
+			return err
+		}
+		v.path, v.original, v.existed, v.changed = path, data, existed, true
+	} else if v.drivers == 0 {
+		v.path, v.changed = path, false
+	}
+	v.drivers++
+	return nil
+}
+
+// release restores the original runtime config once no driver holds the
+// microVM config
+func (v *vmConfig) release() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.drivers--; v.drivers > 0 || !v.changed {
+		return nil
+	}
+	v.changed = false
+	if !v.existed {
+		if err := os.Remove(v.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Error removing firecracker runtime config %q: %v", v.path, err)
+		}
+		return nil
+	}
+	return writeFirecrackerConfig(v.path, v.original)
+}
+
+// writeFirecrackerConfig replaces the runtime config atomically, as the
+// runtime may be booting microVMs from it
+func writeFirecrackerConfig(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".firecracker-runtime")
+	if err != nil {
+		return fmt.Errorf("Error writing firecracker runtime config %q: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Error writing firecracker runtime config %q: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Error writing firecracker runtime config %q: %v", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,9 @@
+package driver
+
+import "fmt"
+
+// NewFirecrackerDriver is not available on Windows, as firecracker-containerd
+// only runs on Linux
+func NewFirecrackerDriver(path, kernelImage, rootDrive string, opts ContainerOptions, namePrefix string) (Driver, error) {
+	return nil, fmt.Errorf("The Firecracker driver is not supported on Windows")
+}
@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -9,47 +10,52 @@ import (
 )
 
 type GardenDriver struct {
-	gaolPath string
+	cmdUsage
+	gaolPath   string
+	namePrefix string
 }
 
-func NewGardenDriver(gaolPath string) (Driver, error) {
-	return &GardenDriver{gaolPath: gaolPath}, nil
+func NewGardenDriver(gaolPath, namePrefix string) (Driver, error) {
+	return &GardenDriver{gaolPath: gaolPath, namePrefix: namePrefix}, nil
 }
 
 func (g *GardenDriver) Type() Type {
 	return Garden
 }
 
-func (g *GardenDriver) Info() (string, error) {
+func (g *GardenDriver) Info(ctx context.Context) (string, error) {
 	return "Info for Garden isn't implemented yet", nil
 }
 
-func (g *GardenDriver) runGaol(gaolArgs ...string) (string, error) {
-	out, err := exec.Command(g.gaolPath, gaolArgs...).CombinedOutput()
+func (g *GardenDriver) runGaol(ctx context.Context, gaolArgs ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, g.gaolPath, gaolArgs...).CombinedOutput()
 	if err != nil {
 		return "", fmt.Errorf("error running %s '%s': %s\ngaol CLI output: %s", g.gaolPath, strings.Join(gaolArgs, " "), err, string(out))
 	}
 	return string(out), nil
 }
 
-func (g *GardenDriver) Create(name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
-	if _, err := g.runGaol("create", "-n", name); err != nil {
+func (g *GardenDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	if _, err := g.runGaol(ctx, "create", "-n", name); err != nil {
 		return nil, err
 	}
 	return &gardenContainer{name: name, detached: detached}, nil
 }
 
-func (g *GardenDriver) Clean() error {
+func (g *GardenDriver) Clean(ctx context.Context) error {
 	// gaol list | xargs
-	containers, err := g.runGaol("list")
+	containers, err := g.runGaol(ctx, "list")
 	if err != nil {
 		return err
 	}
 	for _, container := range strings.Split(containers, "\n") {
-		if container == "" {
+		if !strings.HasPrefix(container, g.namePrefix) {
 			continue
 		}
-		if _, err := g.runGaol("destroy", container); err != nil {
+		if err := paceClean(ctx); err != nil {
+			return err
+		}
+		if _, err := g.runGaol(ctx, "destroy", container); err != nil {
 			return err
 		}
 	}
@@ -57,32 +63,67 @@ func (g *GardenDriver) Clean() error {
 	return nil
 }
 
-func (g *GardenDriver) Run(ctr Container) (string, int, error) {
+func (g *GardenDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
 	gaolArgs := "run " + ctr.Name()
 	if !ctr.Detached() {
 		gaolArgs = gaolArgs + " -a"
 	}
 	gaolArgs = gaolArgs + " -c whoami"
-	return utils.ExecTimedCmd(g.gaolPath, gaolArgs)
+	return g.execTimed(ctx, g.gaolPath, gaolArgs)
 }
 
-func (g *GardenDriver) Stop(ctr Container) (string, int, error) {
+func (g *GardenDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	g.last = utils.Usage{}
 	return "", 0, nil
 }
 
-func (g *GardenDriver) Remove(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(g.gaolPath, "destroy "+ctr.Name())
+func (g *GardenDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	return g.execTimed(ctx, g.gaolPath, "destroy "+ctr.Name())
 }
 
-func (g *GardenDriver) Pause(ctr Container) (string, int, error) {
+func (g *GardenDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	g.last = utils.Usage{}
 	return "", 0, nil
 }
 
-func (g *GardenDriver) Unpause(ctr Container) (string, int, error) {
+func (g *GardenDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	g.last = utils.Usage{}
 	return "", 0, nil
 }
 
-func (g *GardenDriver) Close() error {
+func (g *GardenDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	// gaol runs the command with sh -c in the container, so the command line
+	// is passed whole rather than split into gaol arguments
+	return g.execTimedArgs(ctx, g.gaolPath, "run", ctr.Name(), "-a", "-c", command)
+}
+
+func (g *GardenDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("wait is not supported by the Garden driver")
+}
+
+func (g *GardenDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("logs are not supported by the Garden driver")
+}
+
+func (g *GardenDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the Garden driver")
+}
+
+func (g *GardenDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the Garden driver")
+}
+
+// PullImage is not supported by the Garden driver
+func (g *GardenDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return "", 0, unsupported("image pull", "Garden")
+}
+
+// RemoveImage is not supported by the Garden driver
+func (g *GardenDriver) RemoveImage(ctx context.Context, image string) error {
+	return unsupported("image removal", "Garden")
+}
+
+func (g *GardenDriver) Close(ctx context.Context) error {
 	return nil
 }
 
@@ -114,3 +155,7 @@ func (c *gardenContainer) Image() string {
 func (c *gardenContainer) Command() string {
 	return ""
 }
+
+func (c *gardenContainer) Resources() Resources {
+	return Resources{}
+}
@@ -0,0 +1,329 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/estesp/bucketbench/utils"
+)
+
+const defaultGenericShell = "sh"
+
+// GenericTemplates holds the command lines the Generic driver runs for each
+// operation, as text/template strings executed with GenericData; operations
+// without a command line are not supported
+type GenericTemplates struct {
+	// Info prints the version of the engine, shown as the driver info
+	Info string
+	// Clean removes the containers whose names start with {{.NamePrefix}}
+	Clean string
+	// Create prepares a container before it is run; it is not timed
+	Create  string
+	Run     string
+	Stop    string
+	Remove  string
+	Pause   string
+	Unpause string
+	// Exec runs {{.ExecCommand}} in the container
+	Exec string
+	Wait string
+	Logs string
+	// Checkpoint and Restore checkpoint the running container and run it
+	// again from its checkpoint
+	Checkpoint string
+	Restore    string
+}
+
+// GenericData is the data the command line templates are executed with
+type GenericData struct {
+	// Name is the name of the container
+	Name string
+	// Image is the image of the benchmark
+	Image string
+	// Command is the command of the benchmark, or empty for the image's
+	Command string
+	// Detached is whether the container is to be run in the background
+	Detached bool
+	// ExecCommand is the command run by the exec operation
+	ExecCommand string
+	// NamePrefix is the prefix of the names of the benchmark's containers
+	NamePrefix string
+}
+
+// GenericDriver is an implementation of the driver interface for engines
+// bucketbench has no driver for, running the command lines templated in the
+// benchmark YAML with a shell. Every operation is timed as a whole, including
+// the shell, so results are comparable between Generic configurations but
+// include a fork and exec more than those of the CLI drivers.
+type GenericDriver struct {
+	cmdUsage
+	shell       string
+	templates   map[string]*template.Template
+	namePrefix  string
+	genericInfo string
+}
+
+// GenericContainer is an implementation of the container metadata needed for
+// the Generic driver
+type GenericContainer struct {
+	name        string
+	imageName   string
+	cmdOverride string
+	detached    bool
+	trace       bool
+}
+
+// NewGenericDriver creates an instance of the Generic driver, providing the
+// shell the command lines are run with, the command line templates and the
+// name prefix of the containers it cleans up
+func NewGenericDriver(shell string, templates GenericTemplates, namePrefix string) (Driver, error) {
+	if shell == "" {
+		shell = defaultGenericShell
+	}
+	resolvedShell, err := utils.ResolveBinary(shell)
+	if err != nil {
+		return &GenericDriver{}, err
+	}
+	driver := &GenericDriver{
+		shell:      resolvedShell,
+		templates:  make(map[string]*template.Template),
+		namePrefix: namePrefix,
+	}
+	for op, text := range templates.byOperation() {
+		if text == "" {
+			continue
+		}
+		tmpl, err := template.New(op).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return &GenericDriver{}, fmt.Errorf("Invalid %s command line: %v", op, err)
+		}
+		// catch references to unknown fields before the benchmark runs
+		if err := tmpl.Execute(&bytes.Buffer{}, GenericData{}); err != nil {
+			return &GenericDriver{}, fmt.Errorf("Invalid %s command line: %v", op, err)
+		}
+		driver.templates[op] = tmpl
+	}
+	if driver.templates["run"] == nil {
+		return &GenericDriver{}, fmt.Errorf("The Generic driver requires a run command line")
+	}
+	return driver, nil
+}
+
+// byOperation returns the command line templates by operation name
+func (t GenericTemplates) byOperation() map[string]string {
+	return map[string]string{
+		"info":       t.Info,
+		"clean":      t.Clean,
+		"create":     t.Create,
+		"run":        t.Run,
+		"stop":       t.Stop,
+		"remove":     t.Remove,
+		"pause":      t.Pause,
+		"unpause":    t.Unpause,
+		"exec":       t.Exec,
+		"wait":       t.Wait,
+		"logs":       t.Logs,
+		"checkpoint": t.Checkpoint,
+		"restore":    t.Restore,
+	}
+}
+
+// Has returns whether a command line is set for an operation, e.g. "pause"
+func (t GenericTemplates) Has(op string) bool {
+	return t.byOperation()[op] != ""
+}
+
+// Name returns the name of the container
+func (c *GenericContainer) Name() string {
+	return c.name
+}
+
+// Detached returns whether the container should be started in detached mode
+func (c *GenericContainer) Detached() bool {
+	return c.detached
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *GenericContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the image the command lines are run with
+func (c *GenericContainer) Image() string {
+	return c.imageName
+}
+
+// Command returns the optional overriding command the command lines are run
+// with
+func (c *GenericContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources is not implemented for the generic driver type, which does not
+// apply resource limits
+func (c *GenericContainer) Resources() Resources {
+	return Resources{}
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (g *GenericDriver) Type() Type {
+	return Generic
+}
+
+// Path returns the shell the command lines are run with
+func (g *GenericDriver) Path() string {
+	return g.shell
+}
+
+// Close allows the driver to handle any resource free/connection closing
+// as necessary. The Generic driver has no need to perform any actions on close.
+func (g *GenericDriver) Close(ctx context.Context) error {
+	return nil
+}
+
+// command returns the command line of an operation on a container
+func (g *GenericDriver) command(op string, data GenericData) (string, error) {
+	tmpl, ok := g.templates[op]
+	if !ok {
+		return "", fmt.Errorf("The Generic driver has no %s command line", op)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("Error executing the %s command line: %v", op, err)
+	}
+	return buf.String(), nil
+}
+
+// containerData returns the template data of a container
+func (g *GenericDriver) containerData(ctr Container) GenericData {
+	return GenericData{
+		Name:       ctr.Name(),
+		Image:      ctr.Image(),
+		Command:    ctr.Command(),
+		Detached:   ctr.Detached(),
+		NamePrefix: g.namePrefix,
+	}
+}
+
+// execTimedOp runs the command line of an operation on a container
+func (g *GenericDriver) execTimedOp(ctx context.Context, op string, data GenericData) (string, int, error) {
+	cmd, err := g.command(op, data)
+	if err != nil {
+		return "", 0, err
+	}
+	out, elapsed, usage, err := utils.ExecTimedShellCmdUsage(ctx, g.shell, cmd)
+	g.last = usage
+	return out, elapsed, err
+}
+
+// Info returns the output of the info command line
+func (g *GenericDriver) Info(ctx context.Context) (string, error) {
+	if g.genericInfo != "" {
+		return g.genericInfo, nil
+	}
+	info := "(no info command line)"
+	if _, ok := g.templates["info"]; ok {
+		out, _, err := g.execTimedOp(ctx, "info", GenericData{NamePrefix: g.namePrefix})
+		if err != nil {
+			return "", fmt.Errorf("Error running the info command line: %v (output: %s)", err, out)
+		}
+		info = strings.TrimSpace(out)
+	}
+	g.genericInfo = fmt.Sprintf("Generic driver (shell: %s)\n[INFO:%s]", g.shell, info)
+	return g.genericInfo, nil
+}
+
+// Create runs the create command line, if any, and returns the container
+func (g *GenericDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	ctr := &GenericContainer{
+		name:        name,
+		imageName:   image,
+		cmdOverride: cmdOverride,
+		detached:    detached,
+		trace:       trace,
+	}
+	if _, ok := g.templates["create"]; ok {
+		if out, _, err := g.execTimedOp(ctx, "create", g.containerData(ctr)); err != nil {
+			return nil, fmt.Errorf("Error creating container %q: %v (output: %s)", name, err, out)
+		}
+	}
+	return ctr, nil
+}
+
+// Clean runs the clean command line, if any, to remove the containers from
+// bucketbench runs
+func (g *GenericDriver) Clean(ctx context.Context) error {
+	if _, ok := g.templates["clean"]; !ok {
+		return nil
+	}
+	out, _, err := g.execTimedOp(ctx, "clean", GenericData{NamePrefix: g.namePrefix})
+	if err != nil {
+		return fmt.Errorf("Error running the clean command line: %v (output: %s)", err, out)
+	}
+	return nil
+}
+
+// Run will execute a container using the driver
+func (g *GenericDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	return g.execTimedOp(ctx, "run", g.containerData(ctr))
+}
+
+// Stop will stop/kill a container
+func (g *GenericDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return g.execTimedOp(ctx, "stop", g.containerData(ctr))
+}
+
+// Remove will remove a container
+func (g *GenericDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	return g.execTimedOp(ctx, "remove", g.containerData(ctr))
+}
+
+// Pause will pause a container
+func (g *GenericDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return g.execTimedOp(ctx, "pause", g.containerData(ctr))
+}
+
+// Unpause will unpause/resume a container
+func (g *GenericDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return g.execTimedOp(ctx, "unpause", g.containerData(ctr))
+}
+
+// Exec will run a command in a running container and wait for it to exit
+func (g *GenericDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	data := g.containerData(ctr)
+	data.ExecCommand = command
+	return g.execTimedOp(ctx, "exec", data)
+}
+
+// Wait waits for the container to exit
+func (g *GenericDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	return g.execTimedOp(ctx, "wait", g.containerData(ctr))
+}
+
+// Logs fetches the output of the container
+func (g *GenericDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return g.execTimedOp(ctx, "logs", g.containerData(ctr))
+}
+
+// Checkpoint will checkpoint a running container
+func (g *GenericDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return g.execTimedOp(ctx, "checkpoint", g.containerData(ctr))
+}
+
+// Restore will run a container again from its checkpoint
+func (g *GenericDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return g.execTimedOp(ctx, "restore", g.containerData(ctr))
+}
+
+// PullImage is not supported by the Generic driver
+func (g *GenericDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return "", 0, unsupported("image pull", "Generic")
+}
+
+// RemoveImage is not supported by the Generic driver
+func (g *GenericDriver) RemoveImage(ctx context.Context, image string) error {
+	return unsupported("image removal", "Generic")
+}
@@ -0,0 +1,196 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/utils"
+)
+
+// apiClient is a minimal JSON-over-HTTP client for engines which expose a
+// REST API on a UNIX socket without a Go client SDK of their own (Podman's
+// libpod API, the kubelet). The host portion of any URL is
+// ignored as all requests are dialed to the socket path. A "tcp://host:port"
+// address dials a TCP endpoint instead, e.g. a remote engine's socket which
+// has been forwarded with `ssh -L`, and an "ssh://[user@]host" address
+// connects through ssh with the engine CLI cli (see sshDial).
+type apiClient struct {
+	socket string
+	prefix string
+	client *http.Client
+}
+
+func newAPIClient(socket, prefix, cli string) *apiClient {
+	network, addr := "unix", strings.TrimPrefix(socket, "unix://")
+	if strings.HasPrefix(socket, "tcp://") {
+		network, addr = "tcp", strings.TrimPrefix(socket, "tcp://")
+	}
+	transport := &http.Transport{
+		Dial: func(string, string) (net.Conn, error) {
+			if strings.HasPrefix(socket, "ssh://") {
+				return sshDial(socket, cli)
+			}
+			return net.DialTimeout(network, addr, 30*time.Second)
+		},
+		DisableCompression: true,
+	}
+	return &apiClient{
+		socket: socket,
+		prefix: prefix,
+		client: &http.Client{Transport: transport},
+	}
+}
+
+// do performs the request and decodes a JSON response into out (if non-nil),
+// or reads the raw response into out if it is a *[]byte. Any non-2xx response
+// is converted into an error containing the response body.
+func (c *apiClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, "http://d"+c.prefix+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if tp := traceParent(ctx); tp != "" {
+		req.Header.Set(traceParentHeader, tp)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		// drain the body so the connection can be reused
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw, err = ioutil.ReadAll(resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// logs fetches the stdout and stderr of a container; the logs endpoint of a
+// container without a TTY multiplexes both streams into frames with an 8-byte
+// header (stream, 3 zero bytes, big-endian length), which are stripped
+func (c *apiClient) logs(ctx context.Context, name string) (string, int, error) {
+	start := time.Now()
+	var raw []byte
+	if err := c.do(ctx, "GET", "/containers/"+name+"/logs?stdout=1&stderr=1", nil, &raw); err != nil {
+		return "", 0, err
+	}
+	elapsed := utils.Elapsed(ctx, start)
+	var out bytes.Buffer
+	for len(raw) >= 8 && raw[0] <= 2 && raw[1] == 0 && raw[2] == 0 && raw[3] == 0 {
+		size := int(binary.BigEndian.Uint32(raw[4:8]))
+		if 8+size > len(raw) {
+			break
+		}
+		out.Write(raw[8 : 8+size])
+		raw = raw[8+size:]
+	}
+	// a TTY container's output is not multiplexed
+	out.Write(raw)
+	return out.String(), elapsed, nil
+}
+
+// events fetches the events of a container between start and end as a
+// stream of JSON objects, with their nanosecond timestamps (timeNano)
+func (c *apiClient) events(ctx context.Context, name string, start, end time.Time) ([]byte, error) {
+	filter := url.QueryEscape(`{"container":["` + name + `"]}`)
+	var raw []byte
+	err := c.do(ctx, "GET", "/events?since="+unixTimestamp(start)+"&until="+unixTimestamp(end)+"&filters="+filter, nil, &raw)
+	return raw, err
+}
+
+// writeTrace writes the events of a container between start and end to dir
+func (c *apiClient) writeTrace(ctx context.Context, name string, start, end time.Time, dir string) ([]string, error) {
+	raw, err := c.events(ctx, name, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the events of container %s: %v", name, err)
+	}
+	path, err := writeTraceFile(dir, name, ".events.json", raw)
+	if err != nil {
+		return nil, err
+	}
+	return []string{path}, nil
+}
+
+// exitCode returns the exit code of the container's main process
+func (c *apiClient) exitCode(ctx context.Context, name string) (int, error) {
+	var inspect struct {
+		State struct {
+			ExitCode int
+		}
+	}
+	if err := c.do(ctx, "GET", "/containers/"+name+"/json", nil, &inspect); err != nil {
+		return 0, err
+	}
+	return inspect.State.ExitCode, nil
+}
+
+// exec runs args in a running container through the libpod exec endpoints,
+// returning an error if the command exits non-zero
+func (c *apiClient) exec(ctx context.Context, name string, args []string) (string, int, error) {
+	config := map[string]interface{}{
+		"Cmd":          args,
+		"AttachStdout": true,
+		"AttachStderr": true,
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	start := time.Now()
+	if err := c.do(ctx, "POST", "/containers/"+name+"/exec", config, &created); err != nil {
+		return "", 0, err
+	}
+	// the start request returns once the command has exited and its output
+	// stream is closed
+	if err := c.do(ctx, "POST", "/exec/"+created.ID+"/start", map[string]interface{}{"Detach": false}, nil); err != nil {
+		return "", 0, err
+	}
+	elapsed := utils.Elapsed(ctx, start)
+	var inspect struct {
+		ExitCode int
+	}
+	if err := c.do(ctx, "GET", "/exec/"+created.ID+"/json", nil, &inspect); err != nil {
+		return "", 0, err
+	}
+	if inspect.ExitCode != 0 {
+		return "", 0, fmt.Errorf("exec of %q exited with status %d", strings.Join(args, " "), inspect.ExitCode)
+	}
+	return "", elapsed, nil
+}
+
+// close releases any idle connections held by the client
+func (c *apiClient) close() {
+	if t, ok := c.client.Transport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,457 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/driver/cri"
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultKubeletAddress     = "tcp://127.0.0.1:10255"
+	defaultKubeletManifestDir = "/etc/kubernetes/manifests"
+	kubeletLabel              = "bucketbench.name"
+	// kubeletCleanTimeout bounds the wait for the kubelet to terminate the
+	// pods of removed manifests, which get their termination grace period
+	kubeletCleanTimeout = 2 * time.Minute
+	kubeletCleanPoll    = 500 * time.Millisecond
+)
+
+// KubeletDriver is an implementation of the driver interface for a standalone
+// kubelet (one running without an API server). Containers are run as static
+// pods: a pod manifest is written to the kubelet's manifest directory and the
+// kubelet's read-only API is polled until the pod is running, so the timed
+// operations cover the kubelet's pod workers and the CRI runtime beneath them.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type KubeletDriver struct {
+	address     string
+	manifestDir string
+	criSocket   string
+	forceClean  bool
+	api         *apiClient
+	labels      map[string]string
+	resources   Resources
+	network     string
+	mounts      []Mount
+	namePrefix  string
+}
+
+// KubeletContainer is an implementation of the container metadata needed for a static pod
+type KubeletContainer struct {
+	name        string
+	imageName   string
+	cmdOverride string
+	trace       bool
+	resources   Resources
+}
+
+// kubeletPod is the subset of the pod details returned by the kubelet /pods endpoint
+type kubeletPod struct {
+	Metadata struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// NewKubeletDriver creates an instance of the kubelet static pod driver, providing
+// the address of the kubelet read-only API, the static pod manifest directory,
+// the socket of the kubelet's CRI runtime, whether its cleanup kills the pods
+// without a grace period through that runtime, and the name prefix of the
+// pods it cleans up
+func NewKubeletDriver(address, manifestDir, criSocket string, forceClean bool, opts ContainerOptions, namePrefix string) (Driver, error) {
+	if address == "" {
+		address = defaultKubeletAddress
+	}
+	if manifestDir == "" {
+		manifestDir = defaultKubeletManifestDir
+	}
+	if criSocket == "" {
+		criSocket = defaultCRISocket
+	}
+	if info, err := os.Stat(manifestDir); err != nil || !info.IsDir() {
+		return &KubeletDriver{}, fmt.Errorf("Static pod manifest directory %q not found", manifestDir)
+	}
+	driver := &KubeletDriver{
+		address:     address,
+		manifestDir: manifestDir,
+		criSocket:   criSocket,
+		forceClean:  forceClean,
+		api:         newAPIClient(address, "", ""),
+		labels:      opts.Labels,
+		resources:   opts.Resources,
+		network:     opts.Network,
+		mounts:      opts.Mounts,
+		namePrefix:  namePrefix,
+	}
+	return driver, nil
+}
+
+// Name returns the name of the container
+func (c *KubeletContainer) Name() string {
+	return c.name
+}
+
+// Detached always returns true as static pods run in the background
+func (c *KubeletContainer) Detached() bool {
+	return true
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *KubeletContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the image name of the pod's container
+func (c *KubeletContainer) Image() string {
+	return c.imageName
+}
+
+// Command returns the override command that will be executed instead of
+// the default image-specified command
+func (c *KubeletContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources returns the resource limits the container is created with
+func (c *KubeletContainer) Resources() Resources {
+	return c.resources
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (k *KubeletDriver) Type() Type {
+	return Kubelet
+}
+
+// Path returns the address of the kubelet read-only API
+func (k *KubeletDriver) Path() string {
+	return k.address
+}
+
+// Close allows the driver to handle any resource free/connection closing
+// as necessary.
+func (k *KubeletDriver) Close(ctx context.Context) error {
+	k.api.close()
+	return nil
+}
+
+// Info returns the kubelet address and manifest directory, verifying the
+// kubelet API answers
+func (k *KubeletDriver) Info(ctx context.Context) (string, error) {
+	if _, err := k.pods(ctx); err != nil {
+		return "", fmt.Errorf("Error querying the kubelet API at %s: %v", k.address, err)
+	}
+	return fmt.Sprintf("Kubelet static pod driver (API: %s, manifests: %s)", k.address, k.manifestDir), nil
+}
+
+// Create will create a container instance matching the specific needs
+// of a driver; the manifest is only written when the pod is run
+func (k *KubeletDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	return &KubeletContainer{
+		name:        name,
+		imageName:   image,
+		cmdOverride: cmdOverride,
+		trace:       trace,
+		resources:   k.resources,
+	}, nil
+}
+
+// Clean will clean the environment; removing the manifests of any static
+// pods from bucketbench runs and waiting for the kubelet to terminate the
+// pods. With forceClean the pods are killed without their termination grace
+// period by stopping their sandboxes through the CRI runtime, as deleting a
+// pod with a grace period of zero would.
+func (k *KubeletDriver) Clean(ctx context.Context) error {
+	manifests, err := filepath.Glob(filepath.Join(k.manifestDir, k.namePrefix+"*.json"))
+	if err != nil {
+		return err
+	}
+	log.Infof("Kubelet: removing %d static pod manifests from bucketbench runs", len(manifests))
+	for _, manifest := range manifests {
+		if err := paceClean(ctx); err != nil {
+			return err
+		}
+		if err := os.Remove(manifest); err != nil {
+			log.Warnf("Kubelet: error removing manifest %s: %v", manifest, err)
+		}
+	}
+	if k.forceClean {
+		if err := k.killSandboxes(ctx); err != nil {
+			return err
+		}
+	}
+	return k.waitTerminated(ctx)
+}
+
+// killSandboxes stops the pod sandboxes of the bucketbench pods on the
+// kubelet's CRI runtime, which kills their containers at once; the kubelet
+// carries the pod labels over to the sandboxes, and removes the stopped
+// sandboxes itself
+func (k *KubeletDriver) killSandboxes(ctx context.Context) error {
+	client, err := cri.Dial(ctx, k.criSocket, criDialTimeout)
+	if err != nil {
+		return fmt.Errorf("Error connecting to the kubelet's CRI runtime at %s: %v", k.criSocket, err)
+	}
+	defer client.Close()
+	sandboxes, err := client.ListPodSandbox(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Error listing CRI pod sandboxes: %v", err)
+	}
+	killed := 0
+	for _, sandbox := range sandboxes {
+		if !strings.HasPrefix(sandbox.Labels[kubeletLabel], k.namePrefix) {
+			continue
+		}
+		if err := client.StopPodSandbox(ctx, sandbox.ID); err != nil {
+			log.Warnf("Kubelet: error stopping pod sandbox %s: %v", sandbox.ID, err)
+			continue
+		}
+		killed++
+	}
+	log.Infof("Kubelet: killed %d bucketbench pod sandboxes", killed)
+	return nil
+}
+
+// waitTerminated waits for the kubelet to terminate the pods of the removed
+// manifests, so an aborted run's pods do not overlap the next run
+func (k *KubeletDriver) waitTerminated(ctx context.Context) error {
+	waitCtx, cancel := context.WithTimeout(ctx, kubeletCleanTimeout)
+	defer cancel()
+	for {
+		pods, err := k.pods(waitCtx)
+		if err != nil {
+			return fmt.Errorf("Error listing the kubelet's pods: %v", err)
+		}
+		var remaining []string
+		for _, pod := range pods {
+			if name := pod.Metadata.Labels[kubeletLabel]; strings.HasPrefix(name, k.namePrefix) {
+				remaining = append(remaining, name)
+			}
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("The kubelet did not terminate the pods %s within %v; run with forceClean to kill them", strings.Join(remaining, ", "), kubeletCleanTimeout)
+		case <-time.After(kubeletCleanPoll):
+		}
+	}
+}
+
+// Run will write the static pod manifest and wait for the kubelet to report
+// the pod as running (or as already exited, for a short-lived container)
+func (k *KubeletDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	container := map[string]interface{}{
+		"name":            "bb",
+		"image":           ctr.Image(),
+		"imagePullPolicy": "IfNotPresent",
+	}
+	if ctr.Command() != "" {
+		container["command"] = strings.Split(ctr.Command(), " ")
+	}
+	limits := map[string]string{}
+	resources := ctr.Resources()
+	if resources.CPUs > 0 {
+		limits["cpu"] = fmt.Sprintf("%dm", int64(resources.CPUs*1000))
+	}
+	if resources.Memory > 0 {
+		limits["memory"] = strconv.FormatInt(resources.Memory, 10)
+	}
+	if len(limits) > 0 {
+		container["resources"] = map[string]interface{}{"limits": limits}
+	}
+	labels := map[string]string{kubeletLabel: ctr.Name()}
+	for k, v := range k.labels {
+		labels[k] = v
+	}
+	var volumes, volumeMounts []map[string]interface{}
+	for i, m := range k.mounts {
+		name := fmt.Sprintf("bb-%d", i)
+		switch m.Type {
+		case MountBind:
+			volumes = append(volumes, map[string]interface{}{"name": name, "hostPath": map[string]string{"path": m.Source}})
+		case MountTmpfs:
+			volumes = append(volumes, map[string]interface{}{"name": name, "emptyDir": map[string]string{"medium": "Memory"}})
+		default:
+			continue
+		}
+		mount := map[string]interface{}{"name": name, "mountPath": m.Target, "readOnly": m.ReadOnly}
+		if m.Type == MountBind && propagationMode(m.Propagation) != "" {
+			mount["mountPropagation"] = propagationMode(m.Propagation)
+		}
+		volumeMounts = append(volumeMounts, mount)
+	}
+	if len(volumeMounts) > 0 {
+		container["volumeMounts"] = volumeMounts
+	}
+	spec := map[string]interface{}{
+		"containers":    []interface{}{container},
+		"restartPolicy": "Never",
+	}
+	if len(volumes) > 0 {
+		spec["volumes"] = volumes
+	}
+	if k.network == NetworkHost {
+		spec["hostNetwork"] = true
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":   ctr.Name(),
+			"labels": labels,
+		},
+		"spec": spec,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	// the kubelet ignores dot files, so the manifest is written under a
+	// hidden name and renamed into place to be picked up complete
+	tmp := filepath.Join(k.manifestDir, "."+ctr.Name()+".json")
+	if err := ioutil.WriteFile(tmp, manifest, 0644); err != nil {
+		return "", 0, fmt.Errorf("Error writing static pod manifest: %v", err)
+	}
+	start := time.Now()
+	if err := os.Rename(tmp, k.manifestPath(ctr)); err != nil {
+		return "", 0, fmt.Errorf("Error writing static pod manifest: %v", err)
+	}
+	if err := k.waitFor(ctx, ctr, func(pod *kubeletPod) bool {
+		return pod != nil && pod.Status.Phase != "" && pod.Status.Phase != "Pending"
+	}); err != nil {
+		return "", 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// Stop will remove the static pod manifest and wait for the kubelet to
+// terminate the pod
+func (k *KubeletDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	start := time.Now()
+	if err := os.Remove(k.manifestPath(ctr)); err != nil {
+		return "", 0, err
+	}
+	if err := k.waitFor(ctx, ctr, func(pod *kubeletPod) bool {
+		return pod == nil
+	}); err != nil {
+		return "", 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// Remove will remove the static pod if it has not been stopped already; the
+// kubelet removes a static pod's containers along with the pod
+func (k *KubeletDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	if _, err := os.Stat(k.manifestPath(ctr)); os.IsNotExist(err) {
+		return "", 0, nil
+	}
+	return k.Stop(ctx, ctr)
+}
+
+// Pause is not supported for static pods
+func (k *KubeletDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("pause is not supported by the Kubelet driver")
+}
+
+// Unpause is not supported for static pods
+func (k *KubeletDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("unpause is not supported by the Kubelet driver")
+}
+
+// Exec is not supported by the kubelet read-only API
+func (k *KubeletDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	return "", 0, fmt.Errorf("exec is not supported by the Kubelet driver")
+}
+
+// Wait waits for the kubelet to report the pod's container as exited
+func (k *KubeletDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	start := time.Now()
+	if err := k.waitFor(ctx, ctr, func(pod *kubeletPod) bool {
+		return pod != nil && (pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed")
+	}); err != nil {
+		return "", 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// Logs is not supported by the kubelet read-only API
+func (k *KubeletDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("logs are not supported by the Kubelet driver")
+}
+
+// Checkpoint is not supported by the Kubelet driver
+func (k *KubeletDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the Kubelet driver")
+}
+
+// Restore is not supported by the Kubelet driver
+func (k *KubeletDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the Kubelet driver")
+}
+
+// PullImage is not supported by the Kubelet driver
+func (k *KubeletDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return "", 0, unsupported("image pull", "Kubelet")
+}
+
+// RemoveImage is not supported by the Kubelet driver
+func (k *KubeletDriver) RemoveImage(ctx context.Context, image string) error {
+	return unsupported("image removal", "Kubelet")
+}
+
+func (k *KubeletDriver) manifestPath(ctr Container) string {
+	return filepath.Join(k.manifestDir, ctr.Name()+".json")
+}
+
+// waitFor polls the kubelet's pods until the pod of the container (or nil if
+// the kubelet no longer lists it) satisfies done
+func (k *KubeletDriver) waitFor(ctx context.Context, ctr Container, done func(pod *kubeletPod) bool) error {
+	for {
+		pods, err := k.pods(ctx)
+		if err != nil {
+			return err
+		}
+		var found *kubeletPod
+		for i := range pods {
+			if pods[i].Metadata.Labels[kubeletLabel] == ctr.Name() {
+				found = &pods[i]
+				break
+			}
+		}
+		if done(found) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+// pods returns the pods known to the kubelet
+func (k *KubeletDriver) pods(ctx context.Context) ([]kubeletPod, error) {
+	var list struct {
+		Items []kubeletPod `json:"items"`
+	}
+	if err := k.api.do(ctx, "GET", "/pods", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
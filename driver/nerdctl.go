@@ -0,0 +1,293 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultNerdctlBinary = "nerdctl"
+
+// NerdctlDriver is an implementation of the driver interface for containerd
+// using the Docker-compatible nerdctl CLI, so its overhead can be compared
+// with the ctr and containerd gRPC API drivers on the same containerd. The
+// containerd namespace is nerdctl's default unless CONTAINERD_NAMESPACE is set.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type NerdctlDriver struct {
+	cmdUsage
+	nerdctlBinary string
+	nerdctlInfo   string
+	runtime       string
+	labels        map[string]string
+	runArgs       string
+	resources     Resources
+	namePrefix    string
+}
+
+// NerdctlContainer is an implementation of the container metadata needed for nerdctl
+type NerdctlContainer struct {
+	name        string
+	imageName   string
+	cmdOverride string
+	detached    bool
+	trace       bool
+	resources   Resources
+}
+
+// NewNerdctlDriver creates an instance of the nerdctl driver, providing a path to the
+// nerdctl binary, optionally the containerd runtime name (e.g. io.containerd.runsc.v1)
+// to run containers with, and the name prefix of the containers it cleans up
+func NewNerdctlDriver(binaryPath, runtime string, opts ContainerOptions, namePrefix string) (Driver, error) {
+	if binaryPath == "" {
+		binaryPath = defaultNerdctlBinary
+	}
+	resolvedBinPath, err := utils.ResolveBinary(binaryPath)
+	if err != nil {
+		return &NerdctlDriver{}, err
+	}
+	driver := &NerdctlDriver{
+		nerdctlBinary: resolvedBinPath,
+		runtime:       runtime,
+		labels:        opts.Labels,
+		runArgs:       runArgs(opts),
+		resources:     opts.Resources,
+		namePrefix:    namePrefix,
+	}
+	return driver, nil
+}
+
+// Name returns the name of the container
+func (c *NerdctlContainer) Name() string {
+	return c.name
+}
+
+// Detached returns whether the container should be started in detached mode
+func (c *NerdctlContainer) Detached() bool {
+	return c.detached
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *NerdctlContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the image name that nerdctl will use
+func (c *NerdctlContainer) Image() string {
+	return c.imageName
+}
+
+// Command returns the optional overriding command that nerdctl will use
+// when executing a container based on this container's image
+func (c *NerdctlContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources returns the resource limits the container is created with
+func (c *NerdctlContainer) Resources() Resources {
+	return c.resources
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (n *NerdctlDriver) Type() Type {
+	return Nerdctl
+}
+
+// Path returns the binary path of the nerdctl binary in use
+func (n *NerdctlDriver) Path() string {
+	return n.nerdctlBinary
+}
+
+// Runtime returns the runtime containers are run with, or an empty string
+// for containerd's default runtime
+func (n *NerdctlDriver) Runtime() string {
+	return n.runtime
+}
+
+// Close allows the driver to handle any resource free/connection closing
+// as necessary. nerdctl has no need to perform any actions on close.
+func (n *NerdctlDriver) Close(ctx context.Context) error {
+	return nil
+}
+
+// Info returns the nerdctl client version and the containerd, kernel and
+// snapshotter details reported by nerdctl
+func (n *NerdctlDriver) Info(ctx context.Context) (string, error) {
+	if n.nerdctlInfo != "" {
+		return n.nerdctlInfo, nil
+	}
+	version, err := utils.ExecCmdContext(ctx, n.nerdctlBinary, "version --format {{.Client.Version}}")
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve nerdctl version info: %v (output: %s)", err, version)
+	}
+	info, err := utils.ExecCmdContext(ctx, n.nerdctlBinary, "info --format Containerd:{{.ServerVersion}}|Kernel:{{.KernelVersion}}|Snapshotter:{{.Driver}}|Cgroups:{{.CgroupVersion}}")
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve containerd info from nerdctl: %v (output: %s)", err, info)
+	}
+	n.nerdctlInfo = fmt.Sprintf("nerdctl driver (binary: %s)\n[CLIENT:%s][SERVER:%s]", n.nerdctlBinary,
+		strings.TrimSpace(version), strings.TrimSpace(info))
+	return n.nerdctlInfo, nil
+}
+
+// Create will create a container instance matching the specific needs
+// of a driver
+func (n *NerdctlDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	return &NerdctlContainer{
+		name:        name,
+		imageName:   image,
+		cmdOverride: cmdOverride,
+		detached:    detached,
+		trace:       trace,
+		resources:   n.resources,
+	}, nil
+}
+
+// Clean will clean the environment; removing any containers from bucketbench runs.
+// Container names are matched against the prefix here rather than with a ps
+// filter, whose name matching differs between nerdctl releases.
+func (n *NerdctlDriver) Clean(ctx context.Context) error {
+	out, err := utils.ExecCmdContext(ctx, n.nerdctlBinary, "ps -a --format {{.Names}}")
+	if err != nil {
+		return fmt.Errorf("Error getting nerdctl container list: %v (output: %s)", err, out)
+	}
+	var names []string
+	for _, name := range strings.Fields(out) {
+		if strings.HasPrefix(name, n.namePrefix) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	log.Infof("Nerdctl: Removing %d containers from bucketbench runs", len(names))
+	if cleanLimited() {
+		for _, name := range names {
+			if err := paceClean(ctx); err != nil {
+				return err
+			}
+			if out, err := utils.ExecCmdContext(ctx, n.nerdctlBinary, "rm -f "+name); err != nil {
+				log.Warnf("Nerdctl: Failed to remove container %s: %v (output: %s)", name, err, out)
+			}
+		}
+		return nil
+	}
+	out, err = utils.ExecCmdContext(ctx, n.nerdctlBinary, "rm -f "+strings.Join(names, " "))
+	if err != nil {
+		log.Warnf("Nerdctl: Failed to remove %s* containers: %v (output: %s)", n.namePrefix, err, out)
+	}
+	return nil
+}
+
+// Run will execute a container using the driver
+func (n *NerdctlDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	var detached string
+	if ctr.Detached() {
+		detached = "-d "
+	}
+	var runtime string
+	if n.runtime != "" {
+		runtime = "--runtime=" + n.runtime + " "
+	}
+	args := fmt.Sprintf("run %s%s%s%s%s--name %s %s", runtime, labelArgs(n.labels), resourceArgs(ctr), n.runArgs, detached, ctr.Name(), ctr.Image())
+	if ctr.Command() != "" {
+		args = args + " " + ctr.Command()
+	}
+	return n.execTimed(ctx, n.nerdctlBinary, args)
+}
+
+// Stop will stop/kill a container
+func (n *NerdctlDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return n.execTimed(ctx, n.nerdctlBinary, "kill "+ctr.Name())
+}
+
+// Remove will remove a container
+func (n *NerdctlDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	return n.execTimed(ctx, n.nerdctlBinary, "rm "+ctr.Name())
+}
+
+// Pause will pause a container
+func (n *NerdctlDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return n.execTimed(ctx, n.nerdctlBinary, "pause "+ctr.Name())
+}
+
+// Unpause will unpause/resume a container
+func (n *NerdctlDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return n.execTimed(ctx, n.nerdctlBinary, "unpause "+ctr.Name())
+}
+
+// Exec will run a command in a running container and wait for it to exit
+func (n *NerdctlDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	return n.execTimed(ctx, n.nerdctlBinary, "exec "+ctr.Name()+" "+command)
+}
+
+// Wait waits for the container to exit
+func (n *NerdctlDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	return n.execTimed(ctx, n.nerdctlBinary, "wait "+ctr.Name())
+}
+
+// Logs fetches the output of the container
+func (n *NerdctlDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return n.execTimed(ctx, n.nerdctlBinary, "logs "+ctr.Name())
+}
+
+// Checkpoint is not supported by the Nerdctl driver
+func (n *NerdctlDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the Nerdctl driver")
+}
+
+// Restore is not supported by the Nerdctl driver
+func (n *NerdctlDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the Nerdctl driver")
+}
+
+// ExitCode returns the exit code of the container's main process
+func (n *NerdctlDriver) ExitCode(ctx context.Context, ctr Container) (int, error) {
+	out, err := utils.ExecCmd(n.nerdctlBinary, "inspect --format {{.State.ExitCode}} "+ctr.Name())
+	if err != nil {
+		return 0, fmt.Errorf("Error inspecting container %q: %v (output: %s)", ctr.Name(), err, out)
+	}
+	return strconv.Atoi(strings.TrimSpace(out))
+}
+
+// HasImage returns whether the image is present in the containerd namespace
+func (n *NerdctlDriver) HasImage(ctx context.Context, image string) (bool, error) {
+	out, err := utils.ExecCmd(n.nerdctlBinary, "images -q "+image)
+	if err != nil {
+		return false, fmt.Errorf("Error listing images: %v (output: %s)", err, out)
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+// PullImage pulls the image from its registry and unpacks it
+func (n *NerdctlDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return n.execTimed(ctx, n.nerdctlBinary, "pull -q "+image)
+}
+
+// ImageDigest returns the registry digest of the local image
+func (n *NerdctlDriver) ImageDigest(ctx context.Context, image string) (string, error) {
+	out, err := utils.ExecCmd(n.nerdctlBinary, "image inspect --format {{json .RepoDigests}} "+image)
+	if err != nil {
+		return "", fmt.Errorf("Error inspecting image %q: %v (output: %s)", image, err, out)
+	}
+	var repoDigests []string
+	if err := json.Unmarshal([]byte(out), &repoDigests); err != nil {
+		return "", fmt.Errorf("Error parsing digests of image %q: %v (output: %s)", image, err, out)
+	}
+	return repoDigest(image, repoDigests)
+}
+
+// RemoveImage removes the image and prunes any dangling image content
+func (n *NerdctlDriver) RemoveImage(ctx context.Context, image string) error {
+	if out, err := utils.ExecCmdContext(ctx, n.nerdctlBinary, "rmi -f "+image); err != nil {
+		return fmt.Errorf("Error removing image %q: %v (output: %s)", image, err, out)
+	}
+	if out, err := utils.ExecCmdContext(ctx, n.nerdctlBinary, "image prune -f"); err != nil {
+		return fmt.Errorf("Error pruning images: %v (output: %s)", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Nested engine kinds
+const (
+	NestedDinD   = "dind"
+	NestedSysbox = "sysbox"
+)
+
+const (
+	defaultNestedImage = "docker:dind"
+	nestedReadyTimeout = 60 * time.Second
+)
+
+// NestedEngine is a Docker engine running inside a container on the host's
+// Docker engine, as on CI platforms which run jobs with Docker-in-Docker or
+// under the sysbox runtime. The nested daemon's socket is exposed to the host
+// through a bind-mounted directory.
+type NestedEngine struct {
+	kind      string
+	container string
+	socketDir string
+}
+
+// StartNestedEngine starts a nested Docker engine of the given kind ("dind"
+// runs a privileged container, "sysbox" an unprivileged one under the
+// sysbox-runc runtime) from image (docker:dind by default), and waits until
+// its API answers
+func StartNestedEngine(kind, image string) (*NestedEngine, error) {
+	var isolation string
+	switch kind {
+	case NestedDinD:
+		isolation = "--privileged"
+	case NestedSysbox:
+		isolation = "--runtime=sysbox-runc"
+	default:
+		return nil, fmt.Errorf("Unknown nested engine %q; use %q or %q", kind, NestedDinD, NestedSysbox)
+	}
+	if image == "" {
+		image = defaultNestedImage
+	}
+	socketDir, err := ioutil.TempDir("", "bucketbench-nested-")
+	if err != nil {
+		return nil, fmt.Errorf("Error creating nested engine socket directory: %v", err)
+	}
+	e := &NestedEngine{
+		kind:      kind,
+		container: fmt.Sprintf("bb-nested-%d", time.Now().UnixNano()),
+		socketDir: socketDir,
+	}
+	// an empty DOCKER_TLS_CERTDIR makes the dind entrypoint serve the API
+	// without TLS
+	args := fmt.Sprintf("run -d --name %s %s -e DOCKER_TLS_CERTDIR= -v %s:/var/run %s", e.container, isolation, socketDir, image)
+	if out, err := utils.ExecCmd(defaultDockerBinary, args); err != nil {
+		os.RemoveAll(socketDir)
+		return nil, fmt.Errorf("Error starting nested engine: %v (output: %s)", err, strings.TrimSpace(out))
+	}
+	log.Infof("Started %s nested engine in container %s", kind, e.container)
+	cli, err := newDockerClient(e.Socket())
+	if err != nil {
+		e.Stop()
+		return nil, err
+	}
+	defer cli.Close()
+	deadline := time.Now().Add(nestedReadyTimeout)
+	for {
+		_, err := cli.Ping(context.Background())
+		if err == nil {
+			return e, nil
+		}
+		if time.Now().After(deadline) {
+			e.Stop()
+			return nil, fmt.Errorf("Nested engine not ready %v after start: %v", nestedReadyTimeout, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// Kind returns the kind of nested engine
+func (e *NestedEngine) Kind() string {
+	return e.kind
+}
+
+// Socket returns the host path of the nested engine's API socket
+func (e *NestedEngine) Socket() string {
+	return filepath.Join(e.socketDir, "docker.sock")
+}
+
+// Stop removes the nested engine container along with everything run in it
+func (e *NestedEngine) Stop() error {
+	defer os.RemoveAll(e.socketDir)
+	if out, err := utils.ExecCmd(defaultDockerBinary, "rm -f -v "+e.container); err != nil {
+		return fmt.Errorf("Error removing nested engine container %s: %v (output: %s)", e.container, err, strings.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultNspawnBinary = "systemd-nspawn"
+	machinectlBinary    = "machinectl"
+	systemdRunBinary    = "systemd-run"
+	systemctlBinary     = "systemctl"
+	journalctlBinary    = "journalctl"
+	nsenterBinary       = "nsenter"
+)
+
+// NspawnDriver is an implementation of the driver interface for the systemd
+// container stack. Every container is a systemd-nspawn machine booted from the
+// benchmark rootfs as a transient systemd service, registered with
+// systemd-machined and controlled with machinectl.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type NspawnDriver struct {
+	cmdUsage
+	nspawnBinary string
+	namePrefix   string
+}
+
+// NspawnContainer is an implementation of the container metadata needed for
+// a systemd-nspawn machine
+type NspawnContainer struct {
+	name        string
+	rootfs      string
+	cmdOverride string
+	trace       bool
+}
+
+// NewNspawnDriver creates an instance of the systemd-nspawn driver, providing
+// a path to the systemd-nspawn binary and the name prefix of the machines it
+// cleans up
+func NewNspawnDriver(binaryPath, namePrefix string) (Driver, error) {
+	if binaryPath == "" {
+		binaryPath = defaultNspawnBinary
+	}
+	resolvedBinPath, err := utils.ResolveBinary(binaryPath)
+	if err != nil {
+		return &NspawnDriver{}, err
+	}
+	for _, binary := range []string{machinectlBinary, systemdRunBinary} {
+		if _, err := utils.ResolveBinary(binary); err != nil {
+			return &NspawnDriver{}, fmt.Errorf("The Nspawn driver requires %s: %v", binary, err)
+		}
+	}
+	driver := &NspawnDriver{
+		nspawnBinary: resolvedBinPath,
+		namePrefix:   namePrefix,
+	}
+	return driver, nil
+}
+
+// Name returns the name of the container
+func (c *NspawnContainer) Name() string {
+	return c.name
+}
+
+// Detached always returns true as machines run as systemd services
+func (c *NspawnContainer) Detached() bool {
+	return true
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *NspawnContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the rootfs path of the machine
+func (c *NspawnContainer) Image() string {
+	return c.rootfs
+}
+
+// Command returns the override command that will be executed instead of
+// the default command
+func (c *NspawnContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources is not implemented for the systemd-nspawn driver type, which does not
+// apply resource limits
+func (c *NspawnContainer) Resources() Resources {
+	return Resources{}
+}
+
+// unit returns the name of the transient service running the machine
+func (c *NspawnContainer) unit() string {
+	return c.name + ".service"
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (n *NspawnDriver) Type() Type {
+	return Nspawn
+}
+
+// Path returns the binary path of systemd-nspawn
+func (n *NspawnDriver) Path() string {
+	return n.nspawnBinary
+}
+
+// Close allows the driver to handle any resource free/connection closing
+// as necessary. systemd-nspawn has no need to perform any actions on close.
+func (n *NspawnDriver) Close(ctx context.Context) error {
+	return nil
+}
+
+// Info returns the systemd-nspawn binary and the systemd version
+func (n *NspawnDriver) Info(ctx context.Context) (string, error) {
+	versionInfo, err := utils.ExecCmdContext(ctx, n.nspawnBinary, "--version")
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve systemd-nspawn version info: %v (output: %s)", err, versionInfo)
+	}
+	version := strings.SplitN(strings.TrimSpace(versionInfo), "\n", 2)[0]
+	return fmt.Sprintf("systemd-nspawn driver (binary: %s)\n%s", n.nspawnBinary, version), nil
+}
+
+// Create only records the container metadata; the machine is started by Run
+func (n *NspawnDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	rootfs, err := filepath.Abs(image)
+	if err != nil {
+		return nil, err
+	}
+	return &NspawnContainer{
+		name:        name,
+		rootfs:      rootfs,
+		cmdOverride: cmdOverride,
+		trace:       trace,
+	}, nil
+}
+
+// Clean will clean the environment; terminating any machines from
+// bucketbench runs
+func (n *NspawnDriver) Clean(ctx context.Context) error {
+	out, err := utils.ExecCmdContext(ctx, machinectlBinary, "list --no-legend --no-pager")
+	if err != nil {
+		return fmt.Errorf("Error getting machinectl list output: (err: %v) output: %s", err, out)
+	}
+	var machines []string
+	scan := bufio.NewScanner(strings.NewReader(out))
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		if len(fields) > 0 && strings.HasPrefix(fields[0], n.namePrefix) {
+			machines = append(machines, fields[0])
+		}
+	}
+	log.Infof("Nspawn: terminating %d machines from bucketbench runs", len(machines))
+	for _, machine := range machines {
+		if err := paceClean(ctx); err != nil {
+			return err
+		}
+		if out, err := utils.ExecCmdContext(ctx, machinectlBinary, "terminate "+machine); err != nil {
+			log.Warnf("Nspawn: failed to terminate machine %q: %v (output: %s)", machine, err, out)
+		}
+	}
+	return nil
+}
+
+// Run starts the machine as a transient service; the elapsed time lasts
+// until the machine is registered as running with systemd-machined (or its
+// command has already exited)
+func (n *NspawnDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	nsCtr, ok := ctr.(*NspawnContainer)
+	if !ok {
+		return "", 0, fmt.Errorf("Nspawn driver cannot run container of type %T", ctr)
+	}
+	command := strings.Join(ociDefaultArgs, " ")
+	if nsCtr.cmdOverride != "" {
+		command = nsCtr.cmdOverride
+	}
+	// --read-only lets the machines of all threads share the rootfs
+	args := fmt.Sprintf("--unit=%s --collect --quiet %s --quiet --keep-unit --register=yes --read-only --machine=%s --directory=%s %s",
+		nsCtr.unit(), n.nspawnBinary, ctr.Name(), nsCtr.rootfs, command)
+	start := time.Now()
+	out, _, err := n.execTimed(ctx, systemdRunBinary, args)
+	if err != nil {
+		return out, 0, err
+	}
+	for {
+		state, err := utils.ExecCmd(machinectlBinary, "show --property=State --value "+ctr.Name())
+		if err == nil && strings.TrimSpace(state) == "running" {
+			break
+		}
+		if active, _ := utils.ExecCmd(systemctlBinary, "is-active "+nsCtr.unit()); !unitActive(active) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+	return out, utils.Elapsed(ctx, start), nil
+}
+
+// Stop will terminate the machine
+func (n *NspawnDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return n.execTimed(ctx, machinectlBinary, "terminate "+ctr.Name())
+}
+
+// Remove stops the machine's service if it is still loaded; the collected
+// transient service leaves nothing else behind
+func (n *NspawnDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	nsCtr, ok := ctr.(*NspawnContainer)
+	if !ok {
+		return "", 0, fmt.Errorf("Nspawn driver cannot remove container of type %T", ctr)
+	}
+	out, elapsed, err := n.execTimed(ctx, systemctlBinary, "stop "+nsCtr.unit())
+	if err != nil && strings.Contains(out, "not loaded") {
+		return "", elapsed, nil
+	}
+	return out, elapsed, err
+}
+
+// Pause will stop all processes of the machine with SIGSTOP
+func (n *NspawnDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return n.execTimed(ctx, machinectlBinary, "kill --kill-whom=all --signal=SIGSTOP "+ctr.Name())
+}
+
+// Unpause will resume all processes of the machine with SIGCONT
+func (n *NspawnDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return n.execTimed(ctx, machinectlBinary, "kill --kill-whom=all --signal=SIGCONT "+ctr.Name())
+}
+
+// Exec will run a command in the namespaces of the machine's leader process
+// and wait for it to exit
+func (n *NspawnDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	leader, err := utils.ExecCmd(machinectlBinary, "show --property=Leader --value "+ctr.Name())
+	if err != nil {
+		return leader, 0, fmt.Errorf("Error finding the leader of machine %q: %v", ctr.Name(), err)
+	}
+	return n.execTimed(ctx, nsenterBinary, "--target "+strings.TrimSpace(leader)+" --all "+command)
+}
+
+// Wait polls the machine's service until it is no longer active
+func (n *NspawnDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	nsCtr, ok := ctr.(*NspawnContainer)
+	if !ok {
+		return "", 0, fmt.Errorf("Nspawn driver cannot wait for container of type %T", ctr)
+	}
+	n.last = utils.Usage{}
+	start := time.Now()
+	for {
+		active, _ := utils.ExecCmd(systemctlBinary, "is-active "+nsCtr.unit())
+		if !unitActive(active) {
+			return "", utils.Elapsed(ctx, start), nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+// Logs fetches the output of the machine from the journal of its service
+func (n *NspawnDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	nsCtr, ok := ctr.(*NspawnContainer)
+	if !ok {
+		return "", 0, fmt.Errorf("Nspawn driver cannot fetch logs of container of type %T", ctr)
+	}
+	return n.execTimed(ctx, journalctlBinary, "--unit="+nsCtr.unit()+" --output=cat --no-pager")
+}
+
+// Checkpoint is not supported by the Nspawn driver
+func (n *NspawnDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the Nspawn driver")
+}
+
+// Restore is not supported by the Nspawn driver
+func (n *NspawnDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the Nspawn driver")
+}
+
+// PullImage is not supported by the Nspawn driver
+func (n *NspawnDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return "", 0, unsupported("image pull", "Nspawn")
+}
+
+// RemoveImage is not supported by the Nspawn driver
+func (n *NspawnDriver) RemoveImage(ctx context.Context, image string) error {
+	return unsupported("image removal", "Nspawn")
+}
+
+// unitActive returns whether `systemctl is-active` output reports a unit
+// which is (still) running
+func unitActive(state string) bool {
+	switch strings.TrimSpace(state) {
+	case "active", "activating", "deactivating", "reloading":
+		return true
+	default:
+		return false
+	}
+}
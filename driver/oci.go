@@ -0,0 +1,345 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/utils"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// ociSpecVersion is the OCI runtime spec version of the generated bundles
+const ociSpecVersion = "1.0.0"
+
+// ociDefaultArgs keeps a detached container running until it is killed when
+// the benchmark YAML does not override the command
+var ociDefaultArgs = []string{"sleep", "3600"}
+
+// OCIDriver is an implementation of the driver interface for any OCI runtime
+// CLI (runc, crun, youki, kata-runtime), using the create/start/kill/delete
+// operations of the OCI runtime command line interface. Unlike the Runc driver,
+// which needs a prepared bundle, an OCI bundle is generated for every container
+// from the benchmark rootfs, so only the runtime itself is in the timed path.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type OCIDriver struct {
+	cmdUsage
+	runtimeBinary string
+	bundleRoot    string
+	mounts        []Mount
+	namePrefix    string
+}
+
+// OCIContainer is an implementation of the container metadata needed for an OCI runtime
+type OCIContainer struct {
+	name        string
+	rootfs      string
+	cmdOverride string
+	bundlePath  string
+	trace       bool
+}
+
+// NewOCIDriver creates an instance of the OCI runtime driver, providing a path
+// to the runtime binary (runc by default), the options of its containers and
+// the name prefix of the containers it cleans up
+func NewOCIDriver(binaryPath string, opts ContainerOptions, namePrefix string) (Driver, error) {
+	if binaryPath == "" {
+		binaryPath = defaultRuncBinary
+	}
+	resolvedBinPath, err := utils.ResolveBinary(binaryPath)
+	if err != nil {
+		return &OCIDriver{}, err
+	}
+	driver := &OCIDriver{
+		runtimeBinary: resolvedBinPath,
+		bundleRoot:    filepath.Join(os.TempDir(), "bucketbench-oci", namePrefix),
+		mounts:        opts.Mounts,
+		namePrefix:    namePrefix,
+	}
+	return driver, nil
+}
+
+// Name returns the name of the container
+func (c *OCIContainer) Name() string {
+	return c.name
+}
+
+// Detached always returns true as the OCI create/start operations detach
+func (c *OCIContainer) Detached() bool {
+	return true
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *OCIContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the rootfs path the bundle is generated from
+func (c *OCIContainer) Image() string {
+	return c.rootfs
+}
+
+// Command returns the override command that will be executed instead of
+// the default command of the generated bundle
+func (c *OCIContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources is not implemented for the OCI runtime driver type, which does not
+// apply resource limits
+func (c *OCIContainer) Resources() Resources {
+	return Resources{}
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (r *OCIDriver) Type() Type {
+	return OCI
+}
+
+// Path returns the binary path of the OCI runtime in use
+func (r *OCIDriver) Path() string {
+	return r.runtimeBinary
+}
+
+// Engine returns the name of the OCI runtime binary, so results of different
+// runtimes are distinguished
+func (r *OCIDriver) Engine() string {
+	return filepath.Base(r.runtimeBinary)
+}
+
+// Close allows the driver to handle any resource free/connection closing
+// as necessary. OCI runtimes have no need to perform any actions on close.
+func (r *OCIDriver) Close(ctx context.Context) error {
+	return nil
+}
+
+// Info returns the runtime binary and its version
+func (r *OCIDriver) Info(ctx context.Context) (string, error) {
+	versionInfo, err := utils.ExecCmdContext(ctx, r.runtimeBinary, "--version")
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve OCI runtime version info: %v (output: %s)", err, versionInfo)
+	}
+	return fmt.Sprintf("OCI runtime driver (binary: %s)\n%s", r.runtimeBinary, strings.TrimSpace(versionInfo)), nil
+}
+
+// Create generates the OCI bundle of the container from the rootfs; this is
+// not part of any timed operation
+func (r *OCIDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	rootfs, err := filepath.Abs(image)
+	if err != nil {
+		return nil, err
+	}
+	args := ociDefaultArgs
+	if cmdOverride != "" {
+		args = strings.Split(cmdOverride, " ")
+	}
+	bundlePath := filepath.Join(r.bundleRoot, name)
+	if err := os.MkdirAll(bundlePath, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating OCI bundle directory: %v", err)
+	}
+	config, err := json.MarshalIndent(ociSpec(name, rootfs, args, r.mounts), "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundlePath, "config.json"), config, 0644); err != nil {
+		return nil, fmt.Errorf("Error writing OCI bundle config: %v", err)
+	}
+	return &OCIContainer{
+		name:        name,
+		rootfs:      rootfs,
+		cmdOverride: cmdOverride,
+		bundlePath:  bundlePath,
+		trace:       trace,
+	}, nil
+}
+
+// Clean will clean the environment; force deleting any containers from
+// bucketbench runs and removing the generated bundles
+func (r *OCIDriver) Clean(ctx context.Context) error {
+	out, err := utils.ExecCmdContext(ctx, r.runtimeBinary, "list")
+	if err != nil {
+		return fmt.Errorf("Error getting OCI runtime list output: (err: %v) output: %s", err, out)
+	}
+	containers := parseRuncList(out, r.namePrefix)
+	log.Infof("OCI runtime: removing %d containers from bucketbench runs", len(containers))
+	for _, ctr := range containers {
+		if err := paceClean(ctx); err != nil {
+			return err
+		}
+		if out, err := utils.ExecCmdContext(ctx, r.runtimeBinary, "delete --force "+ctr.Name()); err != nil {
+			log.Warnf("OCI runtime: failed to delete container %q: %v (output: %s)", ctr.Name(), err, out)
+		}
+	}
+	return os.RemoveAll(r.bundleRoot)
+}
+
+// Run will create and start the container; the elapsed time covers both
+// runtime invocations
+func (r *OCIDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	ociCtr, ok := ctr.(*OCIContainer)
+	if !ok {
+		return "", 0, fmt.Errorf("OCI driver cannot run container of type %T", ctr)
+	}
+	create := fmt.Sprintf("create --bundle %s %s", ociCtr.bundlePath, ctr.Name())
+	runtimeStart := "start " + ctr.Name()
+	start := time.Now()
+	var (
+		out string
+		err error
+	)
+	if ctr.Trace() {
+		// both runtime invocations are traced into one file
+		out, _, err = r.execTimedNoOut(ctx, straceBinary, straceArgs(ctr.Name(), false, r.runtimeBinary+" "+create))
+	} else {
+		out, _, err = r.execTimedNoOut(ctx, r.runtimeBinary, create)
+	}
+	if err != nil {
+		return out, 0, err
+	}
+	createUsage := r.last
+	if ctr.Trace() {
+		out, _, err = r.execTimed(ctx, straceBinary, straceArgs(ctr.Name(), true, r.runtimeBinary+" "+runtimeStart))
+	} else {
+		out, _, err = r.execTimed(ctx, r.runtimeBinary, runtimeStart)
+	}
+	r.last.User += createUsage.User
+	r.last.System += createUsage.System
+	if err != nil {
+		return out, 0, err
+	}
+	return out, utils.Elapsed(ctx, start), nil
+}
+
+// WriteTrace moves the strace output of the container's run into dir
+func (r *OCIDriver) WriteTrace(ctx context.Context, name string, start, end time.Time, dir string) ([]string, error) {
+	return moveStrace(name, dir)
+}
+
+// Stop will stop/kill a container
+func (r *OCIDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.runtimeBinary, "kill "+ctr.Name()+" KILL")
+}
+
+// Remove will delete a container and its generated bundle
+func (r *OCIDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	out, elapsed, err := r.execTimed(ctx, r.runtimeBinary, "delete "+ctr.Name())
+	if ociCtr, ok := ctr.(*OCIContainer); ok && err == nil {
+		os.RemoveAll(ociCtr.bundlePath)
+	}
+	return out, elapsed, err
+}
+
+// Pause will pause a container
+func (r *OCIDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.runtimeBinary, "pause "+ctr.Name())
+}
+
+// Unpause will unpause/resume a container
+func (r *OCIDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.runtimeBinary, "resume "+ctr.Name())
+}
+
+// Exec will run a command in a running container and wait for it to exit
+func (r *OCIDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	return r.execTimed(ctx, r.runtimeBinary, "exec "+ctr.Name()+" "+command)
+}
+
+// Wait polls the container state until the container has exited
+func (r *OCIDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	r.last = utils.Usage{}
+	return waitRuncStopped(ctx, r.runtimeBinary, ctr.Name())
+}
+
+// Logs is not supported as OCI runtimes do not keep container output
+func (r *OCIDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("logs are not supported by the OCI driver")
+}
+
+// Checkpoint is not supported by the OCI driver
+func (r *OCIDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the OCI driver")
+}
+
+// Restore is not supported by the OCI driver
+func (r *OCIDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the OCI driver")
+}
+
+// PullImage is not supported by the OCI driver
+func (r *OCIDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return "", 0, unsupported("image pull", "OCI")
+}
+
+// RemoveImage is not supported by the OCI driver
+func (r *OCIDriver) RemoveImage(ctx context.Context, image string) error {
+	return unsupported("image removal", "OCI")
+}
+
+// ociSpec returns a minimal runtime spec for a container running args in
+// rootfs, matching the defaults of `runc spec` without a terminal, with the
+// bind and tmpfs mounts added
+func ociSpec(name, rootfs string, args []string, mounts []Mount) *specs.Spec {
+	caps := []string{"CAP_AUDIT_WRITE", "CAP_KILL", "CAP_NET_BIND_SERVICE"}
+	spec := &specs.Spec{
+		Version: ociSpecVersion,
+		Process: &specs.Process{
+			Args: args,
+			Env:  []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+			Cwd:  "/",
+			Capabilities: &specs.LinuxCapabilities{
+				Bounding:  caps,
+				Effective: caps,
+				Permitted: caps,
+				Ambient:   caps,
+			},
+			NoNewPrivileges: true,
+		},
+		Root:     &specs.Root{Path: rootfs, Readonly: true},
+		Hostname: name,
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+			{Destination: "/dev/pts", Type: "devpts", Source: "devpts", Options: []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620"}},
+			{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+			{Destination: "/dev/mqueue", Type: "mqueue", Source: "mqueue", Options: []string{"nosuid", "noexec", "nodev"}},
+			{Destination: "/sys", Type: "sysfs", Source: "sysfs", Options: []string{"nosuid", "noexec", "nodev", "ro"}},
+		},
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.PIDNamespace},
+				{Type: specs.NetworkNamespace},
+				{Type: specs.IPCNamespace},
+				{Type: specs.UTSNamespace},
+				{Type: specs.MountNamespace},
+			},
+			MaskedPaths:   []string{"/proc/kcore", "/proc/latency_stats", "/proc/timer_list", "/proc/timer_stats", "/proc/sched_debug", "/sys/firmware"},
+			ReadonlyPaths: []string{"/proc/asound", "/proc/bus", "/proc/fs", "/proc/irq", "/proc/sys", "/proc/sysrq-trigger"},
+		},
+	}
+	for _, m := range mounts {
+		spec.Mounts = append(spec.Mounts, specMount(m))
+	}
+	return spec
+}
+
+// specMount returns the runtime spec mount of a bind or tmpfs mount
+func specMount(m Mount) specs.Mount {
+	mount := specs.Mount{Destination: m.Target, Type: "bind", Source: m.Source, Options: []string{"rbind"}}
+	if m.Type == MountTmpfs {
+		mount = specs.Mount{Destination: m.Target, Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "nodev"}}
+	}
+	if m.ReadOnly {
+		mount.Options = append(mount.Options, "ro")
+	}
+	if m.Type == MountBind && m.Propagation != "" {
+		mount.Options = append(mount.Options, m.Propagation)
+	}
+	return mount
+}
@@ -0,0 +1,280 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultPodmanBinary = "podman"
+
+// PodmanDriver is an implementation of the driver interface for the daemonless
+// Podman CLI. The CLI is mostly Docker-compatible, so operations mirror the
+// Docker driver; info and cleanup are Podman-specific.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type PodmanDriver struct {
+	cmdUsage
+	podmanBinary string
+	podmanInfo   string
+	labels       map[string]string
+	runArgs      string
+	resources    Resources
+	namePrefix   string
+}
+
+// PodmanContainer is an implementation of the container metadata needed for podman
+type PodmanContainer struct {
+	name        string
+	imageName   string
+	cmdOverride string
+	detached    bool
+	trace       bool
+	resources   Resources
+}
+
+// NewPodmanDriver creates an instance of the podman driver, providing a path to the podman binary
+// and the name prefix of the containers it cleans up
+func NewPodmanDriver(binaryPath string, opts ContainerOptions, namePrefix string) (Driver, error) {
+	if binaryPath == "" {
+		binaryPath = defaultPodmanBinary
+	}
+	resolvedBinPath, err := utils.ResolveBinary(binaryPath)
+	if err != nil {
+		return &PodmanDriver{}, err
+	}
+	driver := &PodmanDriver{
+		podmanBinary: resolvedBinPath,
+		labels:       opts.Labels,
+		runArgs:      runArgs(opts),
+		resources:    opts.Resources,
+		namePrefix:   namePrefix,
+	}
+	return driver, nil
+}
+
+// newPodmanContainer creates the metadata object of a podman-specific container with
+// image name, container runtime name, and any required additional information
+func newPodmanContainer(name, image, cmd string, detached bool, trace bool, resources Resources) Container {
+	return &PodmanContainer{
+		name:        name,
+		imageName:   image,
+		cmdOverride: cmd,
+		detached:    detached,
+		trace:       trace,
+		resources:   resources,
+	}
+}
+
+// Name returns the name of the container
+func (c *PodmanContainer) Name() string {
+	return c.name
+}
+
+// Detached returns whether the container should be started in detached mode
+func (c *PodmanContainer) Detached() bool {
+	return c.detached
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *PodmanContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the image name that Podman will use
+func (c *PodmanContainer) Image() string {
+	return c.imageName
+}
+
+// Command returns the optional overriding command that Podman will use
+// when executing a container based on this container's image
+func (c *PodmanContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources returns the resource limits the container is created with
+func (c *PodmanContainer) Resources() Resources {
+	return c.resources
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (p *PodmanDriver) Type() Type {
+	return Podman
+}
+
+// Path returns the binary path of the podman binary in use
+func (p *PodmanDriver) Path() string {
+	return p.podmanBinary
+}
+
+// Close allows the driver to handle any resource free/connection closing
+// as necessary. Podman has no need to perform any actions on close.
+func (p *PodmanDriver) Close(ctx context.Context) error {
+	return nil
+}
+
+// Info returns the podman client version and host/storage details. Podman has
+// no daemon, so unlike Docker the "server" details come from the local host.
+func (p *PodmanDriver) Info(ctx context.Context) (string, error) {
+	if p.podmanInfo != "" {
+		return p.podmanInfo, nil
+	}
+	version, err := utils.ExecCmdContext(ctx, p.podmanBinary, "version --format {{.Client.Version}}|API:{{.Client.APIVersion}}")
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve podman version info: %v (output: %s)", err, version)
+	}
+	info, err := utils.ExecCmdContext(ctx, p.podmanBinary, "info --format Kernel:{{.Host.Kernel}}|Runtime:{{.Host.OCIRuntime.Name}}|Cgroups:{{.Host.CgroupsVersion}}|Storage:{{.Store.GraphDriverName}}")
+	if err != nil {
+		return "", fmt.Errorf("Error trying to retrieve podman host info: %v (output: %s)", err, info)
+	}
+	p.podmanInfo = fmt.Sprintf("podman driver (binary: %s)\n[CLIENT:%s][HOST:%s]", p.podmanBinary,
+		strings.TrimSpace(version), strings.TrimSpace(info))
+	return p.podmanInfo, nil
+}
+
+// Create will create a container instance matching the specific needs
+// of a driver
+func (p *PodmanDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	return newPodmanContainer(name, image, cmdOverride, detached, trace, p.resources), nil
+}
+
+// Clean will clean the environment; removing any containers from bucketbench runs.
+// Unlike the Docker CLI, podman errors differ when given an empty list of containers,
+// so the list is queried first and removal skipped when empty.
+func (p *PodmanDriver) Clean(ctx context.Context) error {
+	out, err := utils.ExecCmdContext(ctx, p.podmanBinary, "ps -aq --filter name=^"+p.namePrefix)
+	if err != nil {
+		return fmt.Errorf("Error getting podman container list: %v (output: %s)", err, out)
+	}
+	ids := strings.Fields(out)
+	if len(ids) == 0 {
+		return nil
+	}
+	log.Infof("Podman: Removing %d containers from bucketbench runs", len(ids))
+	if cleanLimited() {
+		for _, id := range ids {
+			if err := paceClean(ctx); err != nil {
+				return err
+			}
+			if out, err := utils.ExecCmdContext(ctx, p.podmanBinary, "rm -f "+id); err != nil {
+				log.Warnf("Podman: Failed to remove container %s: %v (output: %s)", id, err, out)
+			}
+		}
+		return nil
+	}
+	out, err = utils.ExecCmdContext(ctx, p.podmanBinary, "rm -f "+strings.Join(ids, " "))
+	if err != nil {
+		log.Warnf("Podman: Failed to remove %s* containers: %v (output: %s)", p.namePrefix, err, out)
+	}
+	return nil
+}
+
+// Run will execute a container using the driver
+func (p *PodmanDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	var detached string
+	if ctr.Detached() {
+		detached = "-d "
+	}
+	args := fmt.Sprintf("run %s%s%s%s--name %s %s", labelArgs(p.labels), resourceArgs(ctr), p.runArgs, detached, ctr.Name(), ctr.Image())
+	if ctr.Command() != "" {
+		args = args + " " + ctr.Command()
+	}
+	return p.execTimed(ctx, p.podmanBinary, args)
+}
+
+// Stop will stop/kill a container
+func (p *PodmanDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return p.execTimed(ctx, p.podmanBinary, "kill "+ctr.Name())
+}
+
+// Remove will remove a container
+func (p *PodmanDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	return p.execTimed(ctx, p.podmanBinary, "rm "+ctr.Name())
+}
+
+// Pause will pause a container
+func (p *PodmanDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return p.execTimed(ctx, p.podmanBinary, "pause "+ctr.Name())
+}
+
+// Unpause will unpause/resume a container
+func (p *PodmanDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return p.execTimed(ctx, p.podmanBinary, "unpause "+ctr.Name())
+}
+
+// Exec will run a command in a running container and wait for it to exit
+func (p *PodmanDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	return p.execTimed(ctx, p.podmanBinary, "exec "+ctr.Name()+" "+command)
+}
+
+// Wait waits for the container to exit
+func (p *PodmanDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	return p.execTimed(ctx, p.podmanBinary, "wait "+ctr.Name())
+}
+
+// Logs fetches the output of the container
+func (p *PodmanDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return p.execTimed(ctx, p.podmanBinary, "logs "+ctr.Name())
+}
+
+// Checkpoint is not supported by the Podman driver
+func (p *PodmanDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the Podman driver")
+}
+
+// Restore is not supported by the Podman driver
+func (p *PodmanDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the Podman driver")
+}
+
+// ExitCode returns the exit code of the container's main process
+func (p *PodmanDriver) ExitCode(ctx context.Context, ctr Container) (int, error) {
+	out, err := utils.ExecCmd(p.podmanBinary, "inspect --format {{.State.ExitCode}} "+ctr.Name())
+	if err != nil {
+		return 0, fmt.Errorf("Error inspecting container %q: %v (output: %s)", ctr.Name(), err, out)
+	}
+	return strconv.Atoi(strings.TrimSpace(out))
+}
+
+// HasImage returns whether the image is present in local storage
+func (p *PodmanDriver) HasImage(ctx context.Context, image string) (bool, error) {
+	out, err := utils.ExecCmd(p.podmanBinary, "images -q "+image)
+	if err != nil {
+		return false, fmt.Errorf("Error listing images: %v (output: %s)", err, out)
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+// PullImage pulls the image from its registry
+func (p *PodmanDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return p.execTimed(ctx, p.podmanBinary, "pull -q "+image)
+}
+
+// ImageDigest returns the registry digest of the local image
+func (p *PodmanDriver) ImageDigest(ctx context.Context, image string) (string, error) {
+	out, err := utils.ExecCmd(p.podmanBinary, "image inspect --format {{json .RepoDigests}} "+image)
+	if err != nil {
+		return "", fmt.Errorf("Error inspecting image %q: %v (output: %s)", image, err, out)
+	}
+	var repoDigests []string
+	if err := json.Unmarshal([]byte(out), &repoDigests); err != nil {
+		return "", fmt.Errorf("Error parsing digests of image %q: %v (output: %s)", image, err, out)
+	}
+	return repoDigest(image, repoDigests)
+}
+
+// RemoveImage removes the image and prunes any dangling image content
+func (p *PodmanDriver) RemoveImage(ctx context.Context, image string) error {
+	if out, err := utils.ExecCmdContext(ctx, p.podmanBinary, "rmi -f "+image); err != nil {
+		return fmt.Errorf("Error removing image %q: %v (output: %s)", image, err, out)
+	}
+	if out, err := utils.ExecCmdContext(ctx, p.podmanBinary, "image prune -f"); err != nil {
+		return fmt.Errorf("Error pruning images: %v (output: %s)", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPodmanSocket = "/run/podman/podman.sock"
+	podmanAPIPrefix     = "/v4.0.0/libpod"
+)
+
+// PodmanAPIDriver is an implementation of the driver interface for Podman using
+// the libpod REST API served by `podman system service`. Comparing it with the
+// Podman CLI driver separates the API service latency from CLI process overhead.
+// IMPORTANT: This implementation does not protect instance metadata for thread safely.
+// At this time there is no understood use case for multi-threaded use of this implementation.
+type PodmanAPIDriver struct {
+	socketPath string
+	api        *apiClient
+	podmanInfo string
+	labels     map[string]string
+	resources  Resources
+	network    string
+	ports      []string
+	mounts     []Mount
+	user       string
+	namePrefix string
+}
+
+// PodmanAPIContainer is an implementation of the container metadata needed for the libpod API
+type PodmanAPIContainer struct {
+	name        string
+	imageName   string
+	cmdOverride string
+	detached    bool
+	trace       bool
+	resources   Resources
+}
+
+// NewPodmanAPIDriver creates an instance of the libpod API driver, providing a path
+// to the Podman API service socket, or a tcp:// or ssh:// address, and the name prefix of the containers it cleans up
+func NewPodmanAPIDriver(socketPath string, opts ContainerOptions, namePrefix string) (Driver, error) {
+	if socketPath == "" {
+		socketPath = defaultPodmanSocket
+	}
+	if strings.HasPrefix(socketPath, "ssh://") {
+		if _, err := sshArgs(socketPath, "podman"); err != nil {
+			return nil, err
+		}
+	}
+	driver := &PodmanAPIDriver{
+		socketPath: socketPath,
+		api:        newAPIClient(socketPath, podmanAPIPrefix, "podman"),
+		labels:     opts.Labels,
+		resources:  opts.Resources,
+		network:    opts.Network,
+		ports:      opts.Ports,
+		mounts:     opts.Mounts,
+		user:       opts.User,
+		namePrefix: namePrefix,
+	}
+	return driver, nil
+}
+
+// newPodmanAPIContainer creates the metadata object of a libpod-specific container with
+// image name, container runtime name, and any required additional information
+func newPodmanAPIContainer(name, image, cmd string, detached bool, trace bool, resources Resources) Container {
+	return &PodmanAPIContainer{
+		name:        name,
+		imageName:   image,
+		cmdOverride: cmd,
+		detached:    detached,
+		trace:       trace,
+		resources:   resources,
+	}
+}
+
+// Name returns the name of the container
+func (c *PodmanAPIContainer) Name() string {
+	return c.name
+}
+
+// Detached returns whether the container should be started in detached mode
+func (c *PodmanAPIContainer) Detached() bool {
+	return c.detached
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *PodmanAPIContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the image name that Podman will use
+func (c *PodmanAPIContainer) Image() string {
+	return c.imageName
+}
+
+// Command returns the optional overriding command that Podman will use
+// when executing a container based on this container's image
+func (c *PodmanAPIContainer) Command() string {
+	return c.cmdOverride
+}
+
+// Resources returns the resource limits the container is created with
+func (c *PodmanAPIContainer) Resources() Resources {
+	return c.resources
+}
+
+// Type returns a driver.Type to indentify the driver implementation
+func (p *PodmanAPIDriver) Type() Type {
+	return PodmanAPI
+}
+
+// Path returns the socket path of the libpod API service
+func (p *PodmanAPIDriver) Path() string {
+	return p.socketPath
+}
+
+// Close allows the driver to handle any resource free/connection closing
+// as necessary.
+func (p *PodmanAPIDriver) Close(ctx context.Context) error {
+	p.api.close()
+	return nil
+}
+
+// Info returns the libpod API service version details; this also verifies
+// the API service is up and reachable
+func (p *PodmanAPIDriver) Info(ctx context.Context) (string, error) {
+	if p.podmanInfo != "" {
+		return p.podmanInfo, nil
+	}
+	var version struct {
+		Version    string
+		APIVersion string `json:"ApiVersion"`
+		GoVersion  string
+		OsArch     string
+	}
+	if err := p.api.do(ctx, "GET", "/version", nil, &version); err != nil {
+		return "", fmt.Errorf("Error trying to retrieve podman API service version: %v", err)
+	}
+	p.podmanInfo = fmt.Sprintf("podman libpod API driver (socket: %s)[SERVER:%s|API:%s|%s|%s]",
+		p.socketPath, version.Version, version.APIVersion, version.GoVersion, version.OsArch)
+	return p.podmanInfo, nil
+}
+
+// Create will create a container instance matching the specific needs
+// of a driver; the image is pulled through the API if not already present
+func (p *PodmanAPIDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	if err := p.api.do(ctx, "GET", "/images/"+url.PathEscape(image)+"/exists", nil, nil); err != nil {
+		log.Debugf("podman API: image %q not found locally (%v); pulling", image, err)
+		if err := p.api.do(ctx, "POST", "/images/pull?quiet=true&reference="+url.QueryEscape(image), nil, nil); err != nil {
+			return nil, err
+		}
+	}
+	return newPodmanAPIContainer(name, image, cmdOverride, detached, trace, p.resources), nil
+}
+
+// Clean will clean the environment; removing any containers created by bucketbench
+func (p *PodmanAPIDriver) Clean(ctx context.Context) error {
+	var list []struct {
+		ID    string `json:"Id"`
+		Names []string
+	}
+	filter := url.QueryEscape(`{"name":["^/?` + p.namePrefix + `"]}`)
+	if err := p.api.do(ctx, "GET", "/containers/json?all=true&filters="+filter, nil, &list); err != nil {
+		return fmt.Errorf("Error getting podman container list: %v", err)
+	}
+	log.Infof("podman API: removing %d containers from bucketbench runs", len(list))
+	for _, ctr := range list {
+		if err := paceClean(ctx); err != nil {
+			return err
+		}
+		if err := p.api.do(ctx, "DELETE", "/containers/"+ctr.ID+"?force=true", nil, nil); err != nil {
+			log.Warnf("podman API: failed to remove container %s (%v): %v", ctr.ID, ctr.Names, err)
+		}
+	}
+	return nil
+}
+
+// Run will create and start a container using the libpod API
+func (p *PodmanAPIDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	spec := map[string]interface{}{
+		"name":  ctr.Name(),
+		"image": ctr.Image(),
+	}
+	if ctr.Command() != "" {
+		spec["command"] = strings.Split(ctr.Command(), " ")
+	}
+	if len(p.labels) > 0 {
+		spec["labels"] = p.labels
+	}
+	if p.user != "" {
+		spec["user"] = p.user
+	}
+	limits := map[string]interface{}{}
+	resources := ctr.Resources()
+	if resources.CPUs > 0 {
+		limits["cpu"] = map[string]interface{}{"period": cpuPeriod, "quota": resources.cpuQuota()}
+	}
+	if resources.Memory > 0 {
+		limits["memory"] = map[string]interface{}{"limit": resources.Memory}
+	}
+	if len(limits) > 0 {
+		spec["resource_limits"] = limits
+	}
+	if resources.CgroupParent != "" {
+		spec["cgroup_parent"] = resources.CgroupParent
+	}
+	if p.network != "" {
+		spec["netns"] = map[string]string{"nsmode": p.network}
+	}
+	var mounts, volumes []map[string]interface{}
+	for _, m := range p.mounts {
+		options := []string{}
+		if m.ReadOnly {
+			options = append(options, "ro")
+		}
+		if m.Type == MountBind && m.Propagation != "" {
+			options = append(options, m.Propagation)
+		}
+		switch m.Type {
+		case MountVolume:
+			volumes = append(volumes, map[string]interface{}{"Name": m.Source, "Dest": m.Target, "Options": options})
+		case MountTmpfs:
+			mounts = append(mounts, map[string]interface{}{"destination": m.Target, "type": "tmpfs", "source": "tmpfs", "options": options})
+		default:
+			mounts = append(mounts, map[string]interface{}{"destination": m.Target, "type": "bind", "source": m.Source, "options": append(options, "rbind")})
+		}
+	}
+	if len(mounts) > 0 {
+		spec["mounts"] = mounts
+	}
+	if len(volumes) > 0 {
+		spec["volumes"] = volumes
+	}
+	if len(p.ports) > 0 {
+		var mappings []map[string]interface{}
+		for _, port := range p.ports {
+			// without a host port, a random host port is assigned
+			n, proto := splitPort(port)
+			mappings = append(mappings, map[string]interface{}{"container_port": n, "protocol": proto})
+		}
+		spec["portmappings"] = mappings
+	}
+	start := time.Now()
+	if err := p.api.do(ctx, "POST", "/containers/create", spec, nil); err != nil {
+		return "", 0, err
+	}
+	if err := p.api.do(ctx, "POST", "/containers/"+ctr.Name()+"/start", nil, nil); err != nil {
+		return "", 0, err
+	}
+	if !ctr.Detached() {
+		if err := p.api.do(ctx, "POST", "/containers/"+ctr.Name()+"/wait", nil, nil); err != nil {
+			return "", 0, err
+		}
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
+
+// Stop will stop/kill a container
+func (p *PodmanAPIDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return p.timedCall(ctx, "POST", "/containers/"+ctr.Name()+"/kill?signal=KILL")
+}
+
+// Remove will remove a container
+func (p *PodmanAPIDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	return p.timedCall(ctx, "DELETE", "/containers/"+ctr.Name())
+}
+
+// Pause will pause a container
+func (p *PodmanAPIDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return p.timedCall(ctx, "POST", "/containers/"+ctr.Name()+"/pause")
+}
+
+// Unpause will unpause/resume a container
+func (p *PodmanAPIDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return p.timedCall(ctx, "POST", "/containers/"+ctr.Name()+"/unpause")
+}
+
+// Exec will run a command in a running container and wait for it to exit
+func (p *PodmanAPIDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	return p.api.exec(ctx, ctr.Name(), strings.Split(command, " "))
+}
+
+// Wait waits for the container to exit
+func (p *PodmanAPIDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	return p.timedCall(ctx, "POST", "/containers/"+ctr.Name()+"/wait")
+}
+
+// Logs fetches the output of the container
+func (p *PodmanAPIDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return p.api.logs(ctx, ctr.Name())
+}
+
+// Checkpoint is not supported by the PodmanAPI driver
+func (p *PodmanAPIDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("checkpoint is not supported by the PodmanAPI driver")
+}
+
+// Restore is not supported by the PodmanAPI driver
+func (p *PodmanAPIDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("restore is not supported by the PodmanAPI driver")
+}
+
+// ExitCode returns the exit code of the container's main process
+func (p *PodmanAPIDriver) ExitCode(ctx context.Context, ctr Container) (int, error) {
+	return p.api.exitCode(ctx, ctr.Name())
+}
+
+// HasImage returns whether the image is present in local storage
+func (p *PodmanAPIDriver) HasImage(ctx context.Context, image string) (bool, error) {
+	var images []struct {
+		ID string `json:"Id"`
+	}
+	filter := url.QueryEscape(fmt.Sprintf(`{"reference":[%q]}`, image))
+	if err := p.api.do(ctx, "GET", "/images/json?filters="+filter, nil, &images); err != nil {
+		return false, err
+	}
+	return len(images) > 0, nil
+}
+
+// PullImage pulls the image from its registry
+func (p *PodmanAPIDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return p.timedCall(ctx, "POST", "/images/pull?quiet=true&reference="+url.QueryEscape(image))
+}
+
+// ImageDigest returns the registry digest of the local image
+func (p *PodmanAPIDriver) ImageDigest(ctx context.Context, image string) (string, error) {
+	var inspect struct {
+		RepoDigests []string
+	}
+	if err := p.api.do(ctx, "GET", "/images/"+url.PathEscape(image)+"/json", nil, &inspect); err != nil {
+		return "", err
+	}
+	return repoDigest(image, inspect.RepoDigests)
+}
+
+// WriteTrace writes the engine events of the container between start and
+// end, one JSON object per line with its nanosecond timestamp (timeNano)
+func (p *PodmanAPIDriver) WriteTrace(ctx context.Context, name string, start, end time.Time, dir string) ([]string, error) {
+	return p.api.writeTrace(ctx, name, start, end, dir)
+}
+
+// RemoveImage removes the image and prunes any dangling image content
+func (p *PodmanAPIDriver) RemoveImage(ctx context.Context, image string) error {
+	if err := p.api.do(ctx, "DELETE", "/images/"+url.PathEscape(image)+"?force=true", nil, nil); err != nil {
+		return err
+	}
+	return p.api.do(ctx, "POST", "/images/prune", nil, nil)
+}
+
+// timedCall performs a single body-less API request and returns the elapsed milliseconds
+func (p *PodmanAPIDriver) timedCall(ctx context.Context, method, path string) (string, int, error) {
+	start := time.Now()
+	if err := p.api.do(ctx, method, path, nil, nil); err != nil {
+		return "", 0, err
+	}
+	return "", utils.Elapsed(ctx, start), nil
+}
@@ -0,0 +1,31 @@
+package driver
+
+import (
+	"context"
+
+	"github.com/estesp/bucketbench/utils"
+)
+
+// cleanLimiter paces the removals of every driver's Clean; nil when unlimited
+var cleanLimiter *utils.RateLimiter
+
+// SetCleanRate limits the containers (or pods, machines, instances) the Clean
+// of every driver removes to perSecond per second, so tearing down thousands
+// of containers right before or after a run does not itself destabilize the
+// engine; zero removes the limit. Drivers which remove their containers with
+// one bulk command remove them one at a time while a limit is set, and the
+// Generic driver's clean command line is run as is.
+func SetCleanRate(perSecond float64) {
+	cleanLimiter = utils.NewRateLimiter(perSecond)
+}
+
+// paceClean blocks until Clean may remove its next container; it returns
+// the error of ctx if ctx is done first
+func paceClean(ctx context.Context) error {
+	return cleanLimiter.Wait(ctx)
+}
+
+// cleanLimited returns whether Clean removals are rate limited
+func cleanLimited() bool {
+	return cleanLimiter != nil
+}
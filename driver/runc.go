@@ -2,11 +2,16 @@ package driver
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/estesp/bucketbench/utils"
+	log "github.com/sirupsen/logrus"
 )
 
 const defaultRuncBinary = "runc"
@@ -15,7 +20,9 @@ const defaultRuncBinary = "runc"
 // IMPORTANT: This implementation does not protect instance metadata for thread safely.
 // At this time there is no understood use case for multi-threaded use of this implementation.
 type RuncDriver struct {
+	cmdUsage
 	runcBinary string
+	namePrefix string
 }
 
 // RuncContainer is an implementation of the container metadata needed for runc
@@ -29,7 +36,8 @@ type RuncContainer struct {
 }
 
 // NewRuncDriver creates an instance of the runc driver, providing a path to runc
-func NewRuncDriver(binaryPath string) (Driver, error) {
+// and the name prefix of the containers it cleans up
+func NewRuncDriver(binaryPath, namePrefix string) (Driver, error) {
 	if binaryPath == "" {
 		binaryPath = defaultRuncBinary
 	}
@@ -39,6 +47,7 @@ func NewRuncDriver(binaryPath string) (Driver, error) {
 	}
 	driver := &RuncDriver{
 		runcBinary: resolvedBinPath,
+		namePrefix: namePrefix,
 	}
 	return driver, nil
 }
@@ -80,6 +89,12 @@ func (c *RuncContainer) Command() string {
 	return ""
 }
 
+// Resources is not implemented for the runc driver type, which does not
+// apply resource limits
+func (c *RuncContainer) Resources() Resources {
+	return Resources{}
+}
+
 // Pid returns the process ID in cases where this container instance is
 // wrapping a potentially running container
 func (c *RuncContainer) Pid() string {
@@ -103,14 +118,14 @@ func (r *RuncDriver) Path() string {
 
 // Close allows the driver to handle any resource free/connection closing
 // as necessary. Runc has no need to perform any actions on close.
-func (r *RuncDriver) Close() error {
+func (r *RuncDriver) Close(ctx context.Context) error {
 	return nil
 }
 
 // Info returns
-func (r *RuncDriver) Info() (string, error) {
+func (r *RuncDriver) Info(ctx context.Context) (string, error) {
 	info := "runc driver (binary: " + r.runcBinary + ")\n"
-	versionInfo, err := utils.ExecCmd(r.runcBinary, "--v")
+	versionInfo, err := utils.ExecCmdContext(ctx, r.runcBinary, "--v")
 	if err != nil {
 		return "", fmt.Errorf("Error trying to retrieve runc version info: %v", err)
 	}
@@ -119,45 +134,48 @@ func (r *RuncDriver) Info() (string, error) {
 
 // Create will create a container instance matching the specific needs
 // of a driver
-func (r *RuncDriver) Create(name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+func (r *RuncDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
 	return newRuncContainer(name, image, detached, trace), nil
 }
 
 // Clean will clean the environment; removing any remaining containers in the runc metadata
-func (r *RuncDriver) Clean() error {
+func (r *RuncDriver) Clean(ctx context.Context) error {
 	var tries int
-	out, err := utils.ExecCmd(r.runcBinary, "list")
+	out, err := utils.ExecCmdContext(ctx, r.runcBinary, "list")
 	if err != nil {
 		return fmt.Errorf("Error getting runc list output: (err: %v) output: %s", err, out)
 	}
 	// try up to 3 times to handle any remaining containers in the runc list
-	containers := parseRuncList(out)
+	containers := parseRuncList(out, r.namePrefix)
 	log.Infof("Attempting to cleanup runc containers/metadata; %d listed", len(containers))
 	for len(containers) > 0 && tries < 3 {
 		log.Infof("runc cleanup: Pass #%d", tries+1)
 		for _, ctr := range containers {
+			if err := paceClean(ctx); err != nil {
+				return err
+			}
 			switch ctr.State() {
 			case "running":
 				log.Infof("Attempting stop and remove on container %q", ctr.Name())
-				r.Stop(ctr)
-				r.Remove(ctr)
+				r.Stop(ctx, ctr)
+				r.Remove(ctx, ctr)
 			case "paused":
 				log.Infof("Attempting unpause and removal of container %q", ctr.Name())
-				r.Unpause(ctr)
-				r.Remove(ctr)
+				r.Unpause(ctx, ctr)
+				r.Remove(ctx, ctr)
 			case "stopped":
 				log.Infof("Attempting remove of container %q", ctr.Name())
-				r.Remove(ctr)
+				r.Remove(ctx, ctr)
 			default:
 				log.Warnf("Unknown state %q for ctr %q", ctr.State(), ctr.Name())
 			}
 		}
 		tries++
-		out, err := utils.ExecCmd(r.runcBinary, "list")
+		out, err := utils.ExecCmdContext(ctx, r.runcBinary, "list")
 		if err != nil {
 			return fmt.Errorf("Error getting runc list output: %v", err)
 		}
-		containers = parseRuncList(out)
+		containers = parseRuncList(out, r.namePrefix)
 	}
 	log.Infof("runc cleanup complete.")
 	return nil
@@ -169,45 +187,132 @@ func (r *RuncDriver) Clean() error {
 // device to runc. Detached daemon/server bundles should not need a tty; stdin/out/err of
 // the container will be ignored given this is for benchmarking not validating container
 // operation.
-func (r *RuncDriver) Run(ctr Container) (string, int, error) {
-	var (
-		detached string
-		trace    string
-	)
+func (r *RuncDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	var detached string
 	if ctr.Detached() {
 		detached = "--detach"
 	}
+
+	args := fmt.Sprintf("run %s --bundle %s %s", detached, ctr.Image(), ctr.Name())
 	if ctr.Trace() {
-		trace = fmt.Sprintf("--trace /tmp/%s.trace ", ctr.Name())
+		// runc's system calls, and those of the container's init until
+		// it execs the container's process, are traced with timestamps
+		return r.execTimedNoOut(ctx, straceBinary, straceArgs(ctr.Name(), false, r.runcBinary+" "+args))
 	}
-
-	args := fmt.Sprintf("%srun %s --bundle %s %s", trace, detached, ctr.Image(), ctr.Name())
 	// the "NoOut" variant of ExecTimedCmd ignores stdin/out/err (sets them to /dev/null)
-	return utils.ExecTimedCmdNoOut(r.runcBinary, args)
+	return r.execTimedNoOut(ctx, r.runcBinary, args)
+}
+
+// WriteTrace moves the strace output of the container's run into dir
+func (r *RuncDriver) WriteTrace(ctx context.Context, name string, start, end time.Time, dir string) ([]string, error) {
+	return moveStrace(name, dir)
 }
 
 // Stop will stop/kill a container
-func (r *RuncDriver) Stop(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(r.runcBinary, "kill "+ctr.Name()+" KILL")
+func (r *RuncDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.runcBinary, "kill "+ctr.Name()+" KILL")
 }
 
 // Remove will remove a container
-func (r *RuncDriver) Remove(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(r.runcBinary, "delete "+ctr.Name())
+func (r *RuncDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.runcBinary, "delete "+ctr.Name())
 }
 
 // Pause will pause a container
-func (r *RuncDriver) Pause(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(r.runcBinary, "pause "+ctr.Name())
+func (r *RuncDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.runcBinary, "pause "+ctr.Name())
 }
 
 // Unpause will unpause/resume a container
-func (r *RuncDriver) Unpause(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(r.runcBinary, "resume "+ctr.Name())
+func (r *RuncDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	return r.execTimed(ctx, r.runcBinary, "resume "+ctr.Name())
+}
+
+// Exec will run a command in a running container and wait for it to exit
+func (r *RuncDriver) Exec(ctx context.Context, ctr Container, command string) (string, int, error) {
+	return r.execTimed(ctx, r.runcBinary, "exec "+ctr.Name()+" "+command)
+}
+
+// Wait polls the container state until the container has exited
+func (r *RuncDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	r.last = utils.Usage{}
+	return waitRuncStopped(ctx, r.runcBinary, ctr.Name())
+}
+
+// Logs is not supported as runc does not keep container output
+func (r *RuncDriver) Logs(ctx context.Context, ctr Container) (string, int, error) {
+	return "", 0, fmt.Errorf("logs are not supported by the Runc driver")
+}
+
+// checkpointPath returns the directory of the CRIU image of a container's
+// checkpoint
+func (r *RuncDriver) checkpointPath(ctr Container) string {
+	return filepath.Join(os.TempDir(), "bucketbench-checkpoints", ctr.Name())
+}
+
+// Checkpoint checkpoints the container with CRIU into a temporary directory;
+// runc stops the container
+func (r *RuncDriver) Checkpoint(ctx context.Context, ctr Container) (string, int, error) {
+	// a checkpoint left by an earlier iteration or run is replaced, untimed
+	path := r.checkpointPath(ctr)
+	if err := os.RemoveAll(path); err != nil {
+		return "", 0, err
+	}
+	return r.execTimed(ctx, r.runcBinary, fmt.Sprintf("checkpoint --image-path %s %s", path, ctr.Name()))
+}
+
+// Restore restores the container from its checkpoint, detached, and removes
+// the checkpoint (untimed)
+func (r *RuncDriver) Restore(ctx context.Context, ctr Container) (string, int, error) {
+	path := r.checkpointPath(ctr)
+	args := fmt.Sprintf("restore --detach --bundle %s --image-path %s %s", ctr.Image(), path, ctr.Name())
+	// like run, restore ignores the output of the container
+	out, elapsed, err := r.execTimedNoOut(ctx, r.runcBinary, args)
+	if err == nil {
+		os.RemoveAll(path)
+	}
+	return out, elapsed, err
+}
+
+// PullImage is not supported by the Runc driver
+func (r *RuncDriver) PullImage(ctx context.Context, image string) (string, int, error) {
+	return "", 0, unsupported("image pull", "Runc")
+}
+
+// RemoveImage is not supported by the Runc driver
+func (r *RuncDriver) RemoveImage(ctx context.Context, image string) error {
+	return unsupported("image removal", "Runc")
+}
+
+// waitRuncStopped polls `state` of a runc-compatible runtime until the
+// container status is stopped
+func waitRuncStopped(ctx context.Context, binary, name string) (string, int, error) {
+	start := time.Now()
+	for {
+		out, err := utils.ExecCmd(binary, "state "+name)
+		if err != nil {
+			return out, 0, err
+		}
+		var state struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal([]byte(out), &state); err != nil {
+			return out, 0, fmt.Errorf("Error parsing container state: %v", err)
+		}
+		if state.Status == "stopped" {
+			return "", utils.Elapsed(ctx, start), nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
 }
 
-// take the output of "runc list" and parse into container instances
-func parseRuncList(listOutput string) []*RuncContainer {
+// take the output of "runc list" and parse into container instances, keeping
+// the containers whose names start with prefix
+func parseRuncList(listOutput, prefix string) []*RuncContainer {
 	var results []*RuncContainer
 	reader := strings.NewReader(listOutput)
 	scan := bufio.NewScanner(reader)
@@ -225,7 +330,7 @@ func parseRuncList(listOutput string) []*RuncContainer {
 			continue
 		}
 		// don't delete containers that aren't part of our benchmark run!
-		if !strings.Contains(parts[0], "bb-") {
+		if !strings.HasPrefix(parts[0], prefix) {
 			continue
 		}
 		ctr := &RuncContainer{
@@ -0,0 +1,140 @@
+package driver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sshDial starts an ssh session to the host of an ssh://[user@]host[:port][/path]
+// address running the engine CLI's "system dial-stdio" command, which relays
+// its stdin and stdout to the engine's API socket on the remote host (the
+// socket at path, if given, otherwise the CLI's default), and returns the
+// session as a connection. This is how the Docker and Podman CLIs connect to
+// ssh:// hosts, so the remote host needs the engine CLI but no open API port.
+func sshDial(address, cli string) (net.Conn, error) {
+	args, err := sshArgs(address, cli)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("ssh", args...)
+	conn := &sshConn{cmd: cmd, host: address}
+	cmd.Stderr = &conn.stderr
+	if conn.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if conn.stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Error starting ssh to %s: %v", address, err)
+	}
+	return conn, nil
+}
+
+// sshArgs returns the ssh arguments running the engine CLI's dial-stdio
+// command on the host of an ssh:// address
+func sshArgs(address, cli string) ([]string, error) {
+	if cli == "" {
+		return nil, fmt.Errorf("ssh:// addresses are not supported for this API")
+	}
+	u, err := url.Parse(address)
+	if err != nil || u.Scheme != "ssh" || u.Hostname() == "" {
+		return nil, fmt.Errorf("Invalid ssh address %q; use ssh://[user@]host[:port][/socket/path]", address)
+	}
+	// never prompt for a password: the session runs without a terminal
+	args := []string{"-o", "BatchMode=yes"}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	args = append(args, "--", u.Hostname(), cli)
+	if u.Path != "" && u.Path != "/" {
+		flag := "--host"
+		if cli == "podman" {
+			flag = "--url"
+		}
+		args = append(args, flag, "unix://"+u.Path)
+	}
+	return append(args, "system", "dial-stdio"), nil
+}
+
+// sshConn is a connection over the stdin and stdout of an ssh session
+type sshConn struct {
+	cmd    *exec.Cmd
+	host   string
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr lockedBuffer
+	once   sync.Once
+}
+
+func (c *sshConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err == io.EOF && n == 0 {
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			return 0, fmt.Errorf("ssh to %s: %s", c.host, msg)
+		}
+	}
+	return n, err
+}
+
+func (c *sshConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// Close ends the ssh session
+func (c *sshConn) Close() error {
+	c.once.Do(func() {
+		c.stdin.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *sshConn) LocalAddr() net.Addr {
+	return sshAddr("local")
+}
+
+func (c *sshConn) RemoteAddr() net.Addr {
+	return sshAddr(c.host)
+}
+
+// the deadlines of the requests are enforced by their contexts instead
+func (c *sshConn) SetDeadline(t time.Time) error      { return nil }
+func (c *sshConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *sshConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// sshAddr is the address of either end of an ssh session
+type sshAddr string
+
+func (a sshAddr) Network() string { return "ssh" }
+func (a sshAddr) String() string  { return string(a) }
+
+// lockedBuffer is a buffer written by the ssh process's stderr copier and
+// read by the connection
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
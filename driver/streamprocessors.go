@@ -0,0 +1,152 @@
+package driver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultContainerdConfig is the path of containerd's configuration file
+const DefaultContainerdConfig = "/etc/containerd/config.toml"
+
+// markers of the stream processors block written to the containerd config
+const (
+	streamProcessorsBegin = "# bucketbench stream processors begin\n"
+	streamProcessorsEnd   = "# bucketbench stream processors end\n"
+)
+
+// StreamProcessor is a containerd stream processor: a binary which converts
+// layers of the accepted media types (e.g. decompressing them with unpigz or
+// zstd) before containerd applies them
+type StreamProcessor struct {
+	// Name is the name of the processor in the containerd config
+	Name string
+	// Accepts are the layer media types the processor handles
+	Accepts []string
+	// Returns is the media type of the processor's output
+	Returns string
+	// Path and Args are the binary and its arguments; it reads the layer
+	// on stdin and writes the result to stdout
+	Path string
+	Args []string
+}
+
+// Validate checks the settings of a stream processor
+func (p StreamProcessor) Validate() error {
+	if p.Name == "" || strings.ContainsAny(p.Name, "\"\\\n") {
+		return fmt.Errorf("Invalid stream processor name %q", p.Name)
+	}
+	if len(p.Accepts) == 0 || p.Returns == "" || p.Path == "" {
+		return fmt.Errorf("Stream processor %q requires accepts, returns and path", p.Name)
+	}
+	return nil
+}
+
+// streamProcessorsTOML returns the stream_processors tables of the containerd
+// config for the processors
+func streamProcessorsTOML(processors []StreamProcessor) string {
+	quoteAll := func(values []string) string {
+		var quoted []string
+		for _, v := range values {
+			quoted = append(quoted, strconv.Quote(v))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	var b strings.Builder
+	b.WriteString(streamProcessorsBegin)
+	for _, p := range processors {
+		fmt.Fprintf(&b, "[stream_processors.%s]\n", strconv.Quote(p.Name))
+		fmt.Fprintf(&b, "  accepts = %s\n", quoteAll(p.Accepts))
+		fmt.Fprintf(&b, "  returns = %s\n", strconv.Quote(p.Returns))
+		fmt.Fprintf(&b, "  path = %s\n", strconv.Quote(p.Path))
+		fmt.Fprintf(&b, "  args = %s\n", quoteAll(p.Args))
+	}
+	b.WriteString(streamProcessorsEnd)
+	return b.String()
+}
+
+// stripStreamProcessors removes a stream processors block left in a
+// containerd config by an interrupted run
+func stripStreamProcessors(config []byte) []byte {
+	begin := bytes.Index(config, []byte(streamProcessorsBegin))
+	if begin == -1 {
+		return config
+	}
+	end := bytes.Index(config[begin:], []byte(streamProcessorsEnd))
+	if end == -1 {
+		return config[:begin]
+	}
+	return append(config[:begin:begin], config[begin+end+len(streamProcessorsEnd):]...)
+}
+
+// WriteStreamProcessors adds the stream processors to the containerd config
+// file, which takes effect when containerd is restarted, and returns a
+// function restoring the original file
+func WriteStreamProcessors(path string, processors []StreamProcessor) (func() error, error) {
+	if path == "" {
+		path = DefaultContainerdConfig
+	}
+	original, err := ioutil.ReadFile(path)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	original = stripStreamProcessors(original)
+	for _, p := range processors {
+		if bytes.Contains(original, []byte("[stream_processors."+strconv.Quote(p.Name)+"]")) {
+			return nil, fmt.Errorf("Stream processor %q is already configured in %s", p.Name, path)
+		}
+	}
+	config := append([]byte{}, original...)
+	if len(config) > 0 && config[len(config)-1] != '\n' {
+		config = append(config, '\n')
+	}
+	config = append(config, streamProcessorsTOML(processors)...)
+	if err := ioutil.WriteFile(path, config, 0644); err != nil {
+		return nil, err
+	}
+	restore := func() error {
+		if !existed {
+			return os.Remove(path)
+		}
+		return ioutil.WriteFile(path, original, 0644)
+	}
+	return restore, nil
+}
+
+// StreamProcessorNames returns the names of the stream processors, sorted
+func StreamProcessorNames(processors []StreamProcessor) []string {
+	var names []string
+	for _, p := range processors {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Unpack describes the unpacking of the layers of the last image pulled
+type Unpack struct {
+	// Codec is the compression of the layers: gzip, zstd or uncompressed,
+	// or several joined with "+" for images mixing them
+	Codec string
+	// Bytes is the size of the layers as fetched
+	Bytes    int64
+	Duration time.Duration
+}
+
+// layerCodec returns the compression of a layer media type
+func layerCodec(mediaType string) string {
+	switch {
+	case strings.HasSuffix(mediaType, "gzip"):
+		return "gzip"
+	case strings.HasSuffix(mediaType, "zstd"):
+		return "zstd"
+	default:
+		return "uncompressed"
+	}
+}
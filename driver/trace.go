@@ -0,0 +1,86 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Tracer is implemented by drivers which can trace the containers created
+// with tracing enabled. WriteTrace writes the trace of the named container,
+// covering at least the window from start to end, to files in dir and returns
+// their paths; it is called once the container's iteration is done.
+type Tracer interface {
+	WriteTrace(ctx context.Context, name string, start, end time.Time, dir string) ([]string, error)
+}
+
+// writeTraceFile writes a trace artifact of a container to dir, named after
+// the container with the suffix (e.g. ".events.json"), and returns its path
+func writeTraceFile(dir, name, suffix string, data []byte) (string, error) {
+	path := filepath.Join(dir, name+suffix)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// moveTraceFile moves a trace artifact written by a traced process (e.g. an
+// strace output file) into dir, named after the container with the suffix
+func moveTraceFile(src, dir, name, suffix string) (string, error) {
+	path := filepath.Join(dir, name+suffix)
+	if err := os.Rename(src, path); err != nil {
+		// the temporary directory may be on another filesystem
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return "", err
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return "", err
+		}
+		os.Remove(src)
+	}
+	return path, nil
+}
+
+// straceBinary traces the runtime invocations of traced containers of the
+// OCI runtime CLI drivers
+const straceBinary = "strace"
+
+// stracePath is the path strace writes the trace of a container's run to
+func stracePath(name string) string {
+	return filepath.Join(os.TempDir(), name+".strace")
+}
+
+// straceArgs returns the strace arguments tracing a runtime command line of a
+// container: the runtime's system calls, and those of the container's init
+// until it execs the container's process, with timestamps; with appendTrace
+// the trace is added to that of an earlier command of the container
+func straceArgs(name string, appendTrace bool, cmdline string) string {
+	opts := "-f -tt"
+	if appendTrace {
+		opts += " -A"
+	}
+	return fmt.Sprintf("%s -o %s %s", opts, stracePath(name), cmdline)
+}
+
+// moveStrace moves the strace output of a container's run into dir
+func moveStrace(name, dir string) ([]string, error) {
+	src := stracePath(name)
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil, nil
+	}
+	path, err := moveTraceFile(src, dir, name, ".strace")
+	if err != nil {
+		return nil, err
+	}
+	return []string{path}, nil
+}
+
+// unixTimestamp formats a time as the fractional Unix timestamp accepted by
+// the since and until options of the engines' event streams
+func unixTimestamp(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
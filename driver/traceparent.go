@@ -0,0 +1,36 @@
+package driver
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// traceParentHeader is the W3C trace context header
+const traceParentHeader = "traceparent"
+
+type traceParentKey struct{}
+
+// WithTraceParent returns a context carrying a W3C trace context (e.g.
+// "00-<trace id>-<span id>-01") for the operations run with it. The drivers
+// using an engine's HTTP API send it as the traceparent header, and the
+// gRPC-based drivers (containerd, CRI) as traceparent metadata, so an engine
+// tracing its API requests records the operation in the caller's trace.
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	ctx = context.WithValue(ctx, traceParentKey{}, traceParent)
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		// the trace context of a child span replaces its parent's
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	md[traceParentHeader] = []string{traceParent}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// traceParent returns the W3C trace context of an operation's context, if any
+func traceParent(ctx context.Context) string {
+	traceParent, _ := ctx.Value(traceParentKey{}).(string)
+	return traceParent
+}
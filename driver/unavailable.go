@@ -0,0 +1,41 @@
+package driver
+
+import (
+	"strings"
+
+	"github.com/docker/docker/errdefs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// unavailableMessages are fragments of client errors and CLI output which
+// indicate the daemon (or its API endpoint) is down rather than that the
+// operation itself failed; a 500 status is left out, as engines return it for
+// failed operations (e.g. a container which cannot start) too
+var unavailableMessages = []string{
+	"connection refused",
+	"connect: no such file or directory",
+	"cannot connect to the docker daemon",
+	"is the docker daemon running",
+	"transport is closing",
+	"502 bad gateway",
+	"503 service unavailable",
+}
+
+// IsDaemonUnavailable returns whether an operation error (and its output, for
+// CLI drivers) shows the engine daemon was unreachable or failing every request
+func IsDaemonUnavailable(err error, output string) bool {
+	if err == nil {
+		return false
+	}
+	if grpc.Code(err) == codes.Unavailable || errdefs.IsUnavailable(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error() + " " + output)
+	for _, fragment := range unavailableMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package driver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/errdefs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestIsDaemonUnavailable(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		output string
+		want   bool
+	}{
+		{"no error", nil, "", false},
+		{"no error with output", nil, "Cannot connect to the Docker daemon", false},
+		{"grpc unavailable", grpc.Errorf(codes.Unavailable, "all SubConns are in TransientFailure"), "", true},
+		{"grpc not found", grpc.Errorf(codes.NotFound, "container not found"), "", false},
+		{"socket refused", errors.New("dial unix /var/run/docker.sock: connect: connection refused"), "", true},
+		{"socket missing", errors.New("dial unix /run/containerd/containerd.sock: connect: no such file or directory"), "", true},
+		{"cli output", errors.New("exit status 1"), "Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?", true},
+		{"bad gateway", errors.New("502 Bad Gateway"), "", true},
+		{"service unavailable", errors.New("503 Service Unavailable"), "", true},
+		{"sdk unavailable", errdefs.Unavailable(errors.New("Error response from daemon: shutting down")), "", true},
+		{"internal server error", errors.New("500 Internal Server Error"), "", false},
+		{"failed operation", errors.New("exit status 1"), "Error: No such container: bb-ctr-1", false},
+	}
+	for _, tt := range tests {
+		if got := IsDaemonUnavailable(tt.err, tt.output); got != tt.want {
+			t.Errorf("%s: IsDaemonUnavailable(%v, %q) = %v, want %v", tt.name, tt.err, tt.output, got, tt.want)
+		}
+	}
+}
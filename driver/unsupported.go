@@ -0,0 +1,44 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+)
+
+// unsupportedError is returned by a driver for an operation its engine or
+// runtime does not support
+type unsupportedError struct {
+	op     string
+	driver string
+}
+
+func (e unsupportedError) Error() string {
+	return fmt.Sprintf("%s is not supported by the %s driver", e.op, e.driver)
+}
+
+// unsupported returns the error of an operation a driver does not support
+func unsupported(op, driver string) error {
+	return unsupportedError{op: op, driver: driver}
+}
+
+// IsUnsupported returns whether an operation error reports that the driver
+// does not support the operation at all
+func IsUnsupported(err error) bool {
+	_, ok := err.(unsupportedError)
+	return ok
+}
+
+// SupportsImages returns whether a driver manages the images of its engine,
+// so it can pull and remove them. The driver is asked to pull with a context
+// which is already canceled: a driver managing images fails the pull before
+// contacting its engine, while any other driver reports it unsupported.
+func SupportsImages(drv Driver) bool {
+	if drv == nil {
+		// the Null driver
+		return false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := drv.PullImage(ctx, "")
+	return !IsUnsupported(err)
+}
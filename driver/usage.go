@@ -0,0 +1,37 @@
+package driver
+
+import (
+	"context"
+
+	"github.com/estesp/bucketbench/utils"
+)
+
+// cmdUsage is embedded by exec-based drivers to record the CPU time used by
+// the client process of the last timed command, so client CPU cost can be
+// separated from time spent waiting on a daemon
+type cmdUsage struct {
+	last utils.Usage
+}
+
+// LastUsage returns the user/system CPU time of the last timed command
+func (u *cmdUsage) LastUsage() utils.Usage {
+	return u.last
+}
+
+func (u *cmdUsage) execTimed(ctx context.Context, cmd, args string) (string, int, error) {
+	out, elapsed, usage, err := utils.ExecTimedCmdUsage(ctx, cmd, args)
+	u.last = usage
+	return out, elapsed, err
+}
+
+func (u *cmdUsage) execTimedArgs(ctx context.Context, cmd string, args ...string) (string, int, error) {
+	out, elapsed, usage, err := utils.ExecTimedArgsUsage(ctx, cmd, args...)
+	u.last = usage
+	return out, elapsed, err
+}
+
+func (u *cmdUsage) execTimedNoOut(ctx context.Context, cmd, args string) (string, int, error) {
+	out, elapsed, usage, err := utils.ExecTimedCmdNoOutUsage(ctx, cmd, args)
+	u.last = usage
+	return out, elapsed, err
+}
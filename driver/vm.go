@@ -0,0 +1,57 @@
+package driver
+
+import (
+	"bufio"
+	"strings"
+)
+
+// Local VM products which run a Linux engine for a macOS or Windows host
+const (
+	VMDockerDesktop  = "docker-desktop"
+	VMColima         = "colima"
+	VMLima           = "lima"
+	VMRancherDesktop = "rancher-desktop"
+)
+
+// detectVM determines whether an engine runs inside a local VM from the
+// daemon's name, operating system and kernel and the endpoint used to reach
+// it; an empty string means no VM was detected
+func detectVM(name, operatingSystem, kernel, endpoint string) string {
+	name = strings.ToLower(name)
+	endpoint = strings.ToLower(endpoint)
+	switch {
+	case strings.Contains(operatingSystem, "Docker Desktop"), strings.Contains(kernel, "linuxkit"),
+		strings.Contains(endpoint, "/.docker/run/"):
+		return VMDockerDesktop
+	case name == "colima" || strings.HasPrefix(name, "colima-"), strings.Contains(endpoint, "/.colima/"):
+		return VMColima
+	case strings.Contains(operatingSystem, "Rancher Desktop"), strings.Contains(endpoint, "/.rd/"):
+		return VMRancherDesktop
+	case strings.HasPrefix(name, "lima-"), strings.Contains(endpoint, "/.lima/"):
+		return VMLima
+	default:
+		return ""
+	}
+}
+
+// detectVMFromInfo runs detectVM on the output of `docker info`
+func detectVMFromInfo(info, endpoint string) string {
+	var name, operatingSystem, kernel string
+	scan := bufio.NewScanner(strings.NewReader(info))
+	for scan.Scan() {
+		parts := strings.SplitN(scan.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "Name":
+			name = value
+		case "Operating System":
+			operatingSystem = value
+		case "Kernel Version":
+			kernel = value
+		}
+	}
+	return detectVM(name, operatingSystem, kernel, endpoint)
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseCPUList parses a CPU list in the format of the kernel and taskset -c,
+// e.g. "0-3,8,10-11", into sorted CPU numbers
+func ParseCPUList(list string) ([]int, error) {
+	seen := make(map[int]bool)
+	var cpus []int
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			first, last = part[:i], part[i+1:]
+		}
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("Invalid CPU list %q: %q is not a CPU number or range", list, part)
+		}
+		to, err := strconv.Atoi(last)
+		if err != nil || to < from {
+			return nil, fmt.Errorf("Invalid CPU list %q: %q is not a CPU number or range", list, part)
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("Invalid CPU list %q: no CPUs listed", list)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// FormatCPUList renders sorted CPU numbers as a CPU list, e.g. "0-3,8"
+func FormatCPUList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
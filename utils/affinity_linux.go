@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// cpuMaskWords sizes the CPU masks of sched_setaffinity(2) for up to 1024
+// CPUs, as glibc's cpu_set_t
+const cpuMaskWords = 16
+
+// clientCPUs holds the CPUs the engine client processes are pinned to; it is
+// set before the benchmark threads start
+var clientCPUs []int
+
+// GetTaskAffinity returns the CPUs a task (thread) may run on
+func GetTaskAffinity(tid int) ([]int, error) {
+	var mask [cpuMaskWords]uint64
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, uintptr(tid), unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask))); errno != 0 {
+		return nil, errno
+	}
+	var cpus []int
+	for cpu := 0; cpu < cpuMaskWords*64; cpu++ {
+		if mask[cpu/64]&(1<<uint(cpu%64)) != 0 {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// SetTaskAffinity pins a task (thread) to a set of CPUs, as taskset -p does;
+// the threads and processes it starts afterwards inherit the affinity
+func SetTaskAffinity(tid int, cpus []int) error {
+	var mask [cpuMaskWords]uint64
+	for _, cpu := range cpus {
+		if cpu < 0 || cpu >= cpuMaskWords*64 {
+			return fmt.Errorf("CPU %d is out of range", cpu)
+		}
+		mask[cpu/64] |= 1 << uint(cpu%64)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid), unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// NodeCPUs returns the CPUs of a NUMA node
+func NodeCPUs(node int) ([]int, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/sys/devices/system/node/node%d/cpulist", node))
+	if err != nil {
+		return nil, fmt.Errorf("NUMA node %d not found: %v", node, err)
+	}
+	return ParseCPUList(string(data))
+}
+
+// SetClientAffinity pins the engine client processes started by the
+// ExecTimed functions to a set of CPUs; nil leaves them on the CPUs of the
+// harness. The CPUs are checked by pinning the calling thread to them.
+func SetClientAffinity(cpus []int) error {
+	if len(cpus) > 0 {
+		err := withAffinity(cpus, func() error { return nil })
+		if err != nil {
+			return err
+		}
+	}
+	clientCPUs = cpus
+	return nil
+}
+
+// withClientAffinity runs a function starting a client process with the
+// client CPU affinity
+func withClientAffinity(run func() error) error {
+	if len(clientCPUs) == 0 {
+		return run()
+	}
+	return withAffinity(clientCPUs, run)
+}
+
+// withAffinity runs a function on a thread pinned to a set of CPUs for its
+// duration, so a process it starts is pinned from its first instruction
+func withAffinity(cpus []int, run func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	tid := syscall.Gettid()
+	previous, err := GetTaskAffinity(tid)
+	if err != nil {
+		return err
+	}
+	if err := SetTaskAffinity(tid, cpus); err != nil {
+		return fmt.Errorf("Error pinning to CPUs %s: %v", FormatCPUList(cpus), err)
+	}
+	defer SetTaskAffinity(tid, previous)
+	return run()
+}
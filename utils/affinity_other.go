@@ -0,0 +1,38 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// GetTaskAffinity is only supported on Linux
+func GetTaskAffinity(tid int) ([]int, error) {
+	return nil, fmt.Errorf("CPU affinities are not read on %s", runtime.GOOS)
+}
+
+// SetTaskAffinity is only supported on Linux
+func SetTaskAffinity(tid int, cpus []int) error {
+	return fmt.Errorf("CPU affinities are not set on %s", runtime.GOOS)
+}
+
+// NodeCPUs is only supported on Linux
+func NodeCPUs(node int) ([]int, error) {
+	return nil, fmt.Errorf("NUMA nodes are not read on %s", runtime.GOOS)
+}
+
+// SetClientAffinity is only supported on Linux
+func SetClientAffinity(cpus []int) error {
+	if len(cpus) > 0 {
+		return fmt.Errorf("CPU affinities are not set on %s", runtime.GOOS)
+	}
+	return nil
+}
+
+// withClientAffinity runs the function; client affinity is only supported on
+// Linux
+func withClientAffinity(run func() error) error {
+	return run()
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/user"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// registryRef matches the registry host of an image reference such as
+	// registry.example.com:5000/team/image:tag (a registry host contains a
+	// '.' or a port, or is localhost)
+	registryRef = regexp.MustCompile(`\b((?:[a-zA-Z0-9-]+\.)+[a-zA-Z0-9-]+(?::[0-9]+)?|localhost(?::[0-9]+)?|[a-zA-Z0-9-]+:[0-9]+)/([a-z0-9._-]+)`)
+	// absPath matches an absolute filesystem path, keeping what precedes it
+	absPath = regexp.MustCompile(`(^|[\s=:,(\["'])((?:/+[^\s/"',)\]]+)+)/?`)
+)
+
+// redactKeys are JSON object keys whose values are replaced outright
+var redactKeys = map[string]string{
+	"hostname": "<host>",
+	"host":     "<host>",
+	"user":     "<user>",
+	"username": "<user>",
+}
+
+// Anonymizer strips host names, user names, registry names and filesystem
+// paths from benchmark results so they can be shared outside the organization
+type Anonymizer struct {
+	names map[string]string
+}
+
+// NewAnonymizer creates an anonymizer for the local host and user; any extra
+// names (e.g. internal domains or project names) are also scrubbed
+func NewAnonymizer(extra ...string) *Anonymizer {
+	a := &Anonymizer{names: make(map[string]string)}
+	if hostname, err := os.Hostname(); err == nil {
+		a.add(hostname, "<host>")
+		a.add(strings.SplitN(hostname, ".", 2)[0], "<host>")
+	}
+	if u, err := user.Current(); err == nil {
+		a.add(u.Username, "<user>")
+		a.add(u.Name, "<user>")
+	}
+	for _, name := range extra {
+		a.add(name, "<redacted>")
+	}
+	return a
+}
+
+// add registers a name to scrub; single characters would mangle unrelated text
+func (a *Anonymizer) add(name, replacement string) {
+	if len(name) >= 2 {
+		a.names[name] = replacement
+	}
+}
+
+// String returns s with all identifying details replaced by placeholders.
+// Paths are reduced to their final element, e.g. /usr/local/bin/dockerd
+// becomes <path>/dockerd, so binary and socket names remain recognizable.
+func (a *Anonymizer) String(s string) string {
+	s = registryRef.ReplaceAllString(s, "<registry>/$2")
+	s = absPath.ReplaceAllStringFunc(s, func(match string) string {
+		parts := absPath.FindStringSubmatch(match)
+		base := parts[2][strings.LastIndex(parts[2], "/")+1:]
+		return parts[1] + "<path>/" + base
+	})
+	// replace longer names first so a short host name doesn't split an FQDN
+	var names []string
+	for name := range a.names {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for _, name := range names {
+		re := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+		s = re.ReplaceAllLiteralString(s, a.names[name])
+	}
+	return s
+}
+
+// JSON anonymizes every string value of a JSON document, replacing the values
+// of host and user keys outright since they may not be known to this host
+func (a *Anonymizer) JSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(a.value("", doc)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (a *Anonymizer) value(key string, v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		if replacement, ok := redactKeys[strings.ToLower(key)]; ok {
+			return replacement
+		}
+		return a.String(val)
+	case map[string]interface{}:
+		for k, child := range val {
+			val[k] = a.value(k, child)
+		}
+		return val
+	case []interface{}:
+		for i, child := range val {
+			val[i] = a.value(key, child)
+		}
+		return val
+	default:
+		return v
+	}
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TimeForkExec times a fork/exec/wait of a trivial binary
+func TimeForkExec() (time.Duration, error) {
+	start := time.Now()
+	err := exec.Command("true").Run()
+	return time.Since(start), err
+}
+
+// TimeCgroupCreate times the creation of a cgroup directory; the cgroup is
+// removed again (untimed) before returning
+func TimeCgroupCreate(name string) (time.Duration, error) {
+	root := "/sys/fs/cgroup"
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		// cgroup v1; use the cpu controller hierarchy
+		root = filepath.Join(root, "cpu")
+	}
+	path := filepath.Join(root, name)
+	start := time.Now()
+	if err := os.Mkdir(path, 0755); err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	return elapsed, os.Remove(path)
+}
+
+// TimeNetnsCreate times the creation of a new network namespace. The
+// unshare is performed on a locked OS thread which is discarded afterwards
+// so the namespace is released with it.
+func TimeNetnsCreate() (time.Duration, error) {
+	type result struct {
+		elapsed time.Duration
+		err     error
+	}
+	resultC := make(chan result, 1)
+	go func() {
+		// never unlocked; the runtime terminates the thread when this goroutine exits
+		runtime.LockOSThread()
+		start := time.Now()
+		err := syscall.Unshare(syscall.CLONE_NEWNET)
+		resultC <- result{time.Since(start), err}
+	}()
+	r := <-resultC
+	return r.elapsed, r.err
+}
+
+// KernelVersion returns the running kernel release
+func KernelVersion() string {
+	data, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// CPUModel returns the model name of the host's CPUs
+func CPUModel() string {
+	data, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// "model name" on x86, "Model" or "Hardware" on some ARM kernels
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "model name", "Model", "Hardware":
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	return "unknown"
+}
+
+// cgroup2SuperMagic is the filesystem type of the cgroup v2 hierarchy
+const cgroup2SuperMagic = 0x63677270
+
+// CgroupVersion returns the cgroup hierarchy mounted on the host: "v2"
+// (unified), "hybrid" (v1 with a v2 mount for systemd) or "v1"
+func CgroupVersion() string {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs("/sys/fs/cgroup", &fs); err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	if fs.Type == cgroup2SuperMagic {
+		return "v2"
+	}
+	if err := syscall.Statfs("/sys/fs/cgroup/unified", &fs); err == nil && fs.Type == cgroup2SuperMagic {
+		return "hybrid"
+	}
+	return "v1"
+}
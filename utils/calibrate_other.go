@@ -0,0 +1,43 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// TimeForkExec times a fork/exec/wait of a trivial binary
+func TimeForkExec() (time.Duration, error) {
+	start := time.Now()
+	err := exec.Command("true").Run()
+	return time.Since(start), err
+}
+
+// TimeCgroupCreate is only supported on Linux
+func TimeCgroupCreate(name string) (time.Duration, error) {
+	return 0, fmt.Errorf("cgroups are not supported on %s", runtime.GOOS)
+}
+
+// TimeNetnsCreate is only supported on Linux
+func TimeNetnsCreate() (time.Duration, error) {
+	return 0, fmt.Errorf("network namespaces are not supported on %s", runtime.GOOS)
+}
+
+// KernelVersion returns the running kernel release
+func KernelVersion() string {
+	return runtime.GOOS
+}
+
+// CPUModel is only read on Linux
+func CPUModel() string {
+	return "unknown"
+}
+
+// CgroupVersion returns "none" as cgroups only exist on Linux
+func CgroupVersion() string {
+	return "none"
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// ClockInfo describes the clock used to time benchmark operations
+type ClockInfo struct {
+	// Source is the kernel clocksource backing the monotonic clock (e.g. "tsc")
+	Source string
+	// Resolution is the resolution the kernel reports for the monotonic clock
+	Resolution time.Duration
+}
+
+// String returns a condensed description of the clock for output headers
+func (c ClockInfo) String() string {
+	return "monotonic (source: " + c.Source + ", resolution: " + c.Resolution.String() + ")"
+}
+
+// ElapsedMs returns the milliseconds elapsed since start. All operation timings
+// are taken through time.Since, which uses the monotonic clock reading of start
+// and is therefore unaffected by NTP steps or other wall clock changes.
+func ElapsedMs(start time.Time) int {
+	return Ms(time.Since(start))
+}
+
+// Ms returns a duration in whole milliseconds, the unit timings are reported in
+func Ms(d time.Duration) int {
+	return int(d.Nanoseconds() / 1000000)
+}
+
+// exactKey is the context key of the duration recorder set by WithExact
+type exactKey struct{}
+
+// WithExact returns a context under which Elapsed records the exact duration it
+// times in *d, so exact mode reports the nanoseconds between the same start
+// and stop points as the milliseconds an operation returns
+func WithExact(ctx context.Context, d *time.Duration) context.Context {
+	return context.WithValue(ctx, exactKey{}, d)
+}
+
+// Elapsed is ElapsedMs which also records the exact duration elapsed since
+// start in the recorder of ctx, if it has one (see WithExact)
+func Elapsed(ctx context.Context, start time.Time) int {
+	d := time.Since(start)
+	if exact, ok := ctx.Value(exactKey{}).(*time.Duration); ok {
+		*exact = d
+	}
+	return Ms(d)
+}
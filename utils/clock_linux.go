@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	clockMonotonic  = 1
+	clocksourcePath = "/sys/devices/system/clocksource/clocksource0/current_clocksource"
+)
+
+// GetClockInfo returns the clocksource and resolution of CLOCK_MONOTONIC
+func GetClockInfo() ClockInfo {
+	info := ClockInfo{Source: "unknown"}
+	if src, err := ioutil.ReadFile(clocksourcePath); err == nil {
+		info.Source = strings.TrimSpace(string(src))
+	}
+	var ts syscall.Timespec
+	if _, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETRES, clockMonotonic, uintptr(unsafe.Pointer(&ts)), 0); errno == 0 {
+		info.Resolution = time.Duration(ts.Nano())
+	}
+	return info
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+// GetClockInfo returns the clock details; the clocksource and resolution
+// are only queried on Linux
+func GetClockInfo() ClockInfo {
+	return ClockInfo{Source: "unknown"}
+}
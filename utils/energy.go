@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const raplPath = "/sys/class/powercap"
+
+// EnergyMeter reads a cumulative energy counter in joules
+type EnergyMeter interface {
+	// Joules returns the current counter value
+	Joules() (float64, error)
+	// Delta returns the joules consumed between two counter readings,
+	// handling counter wraparound where the meter has one
+	Delta(before, after float64) float64
+}
+
+// NewEnergyMeter returns an energy meter for a meter spec: "rapl" sums the
+// package-level Intel RAPL domains; any other value is a shell command which
+// prints a cumulative joules counter on stdout
+func NewEnergyMeter(spec string) (EnergyMeter, error) {
+	if spec == "rapl" {
+		return newRaplMeter()
+	}
+	return &commandMeter{cmd: spec}, nil
+}
+
+type raplMeter struct {
+	domains []string
+	// sum of the counter ranges of all domains, in joules
+	maxRange float64
+}
+
+func newRaplMeter() (*raplMeter, error) {
+	// package domains are intel-rapl:N; subdomains (core, dram) are
+	// intel-rapl:N:M and already included in their package
+	domains, _ := filepath.Glob(filepath.Join(raplPath, "intel-rapl:[0-9]"))
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("No RAPL package domains found in %s", raplPath)
+	}
+	m := &raplMeter{domains: domains}
+	for _, domain := range domains {
+		max, err := readMicroJoules(filepath.Join(domain, "max_energy_range_uj"))
+		if err != nil {
+			return nil, err
+		}
+		m.maxRange += max
+	}
+	return m, nil
+}
+
+func (m *raplMeter) Joules() (float64, error) {
+	var total float64
+	for _, domain := range m.domains {
+		energy, err := readMicroJoules(filepath.Join(domain, "energy_uj"))
+		if err != nil {
+			return 0, err
+		}
+		total += energy
+	}
+	return total, nil
+}
+
+func (m *raplMeter) Delta(before, after float64) float64 {
+	if after < before {
+		return after + m.maxRange - before
+	}
+	return after - before
+}
+
+func readMicroJoules(path string) (float64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("Error reading RAPL counter: %v", err)
+	}
+	uj, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Error parsing RAPL counter %s: %v", path, err)
+	}
+	return uj / 1e6, nil
+}
+
+type commandMeter struct {
+	cmd string
+}
+
+func (m *commandMeter) Joules() (float64, error) {
+	out, err := ExecShellCmd(m.cmd)
+	if err != nil {
+		return 0, fmt.Errorf("Error running energy meter command %q: %v (output: %s)", m.cmd, err, out)
+	}
+	joules, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Energy meter command %q did not print a number: %q", m.cmd, out)
+	}
+	return joules, nil
+}
+
+func (m *commandMeter) Delta(before, after float64) float64 {
+	return after - before
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SetEnv sets environment variables of the bucketbench process, and so of
+// every command it executes, returning a function which restores their
+// previous values (unsetting the ones which were not set)
+func SetEnv(env map[string]string) (func(), error) {
+	var names []string
+	for name := range env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return nil, fmt.Errorf("Invalid environment variable name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	type previous struct {
+		value string
+		set   bool
+	}
+	saved := make(map[string]previous)
+	restore := func() {
+		for name, prev := range saved {
+			if prev.set {
+				os.Setenv(name, prev.value)
+			} else {
+				os.Unsetenv(name)
+			}
+		}
+	}
+	for _, name := range names {
+		value, set := os.LookupEnv(name)
+		saved[name] = previous{value: value, set: set}
+		if err := os.Setenv(name, env[name]); err != nil {
+			restore()
+			return nil, fmt.Errorf("Error setting environment variable %s: %v", name, err)
+		}
+	}
+	return restore, nil
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// HarnessContainerEnv is set by the bucketbench container image, so a
+// containerized harness is detected even where no engine leaves a marker
+const HarnessContainerEnv = "BUCKETBENCH_CONTAINER"
+
+// HarnessContainer describes the container bucketbench itself runs in
+type HarnessContainer struct {
+	// Engine is the engine running the container ("docker", "podman",
+	// "kubernetes", "containerd", "systemd-nspawn"), or "unknown"
+	Engine string
+	// HostPID is whether the container shares the host's PID namespace, so
+	// the engine daemons can be monitored
+	HostPID bool
+}
+
+// cgroupEngines maps markers in the cgroup path of a process to the engine
+// which created its container
+var cgroupEngines = []struct{ marker, engine string }{
+	{"kubepods", "kubernetes"},
+	{"libpod", "podman"},
+	{"docker", "docker"},
+	{"containerd", "containerd"},
+	{"machine.slice/systemd-nspawn", "systemd-nspawn"},
+}
+
+// DetectHarnessContainer returns a description of the container bucketbench
+// runs in, or nil if it runs directly on the host
+func DetectHarnessContainer() *HarnessContainer {
+	engine := ""
+	switch {
+	case os.Getenv("KUBERNETES_SERVICE_HOST") != "":
+		engine = "kubernetes"
+	case exists("/.dockerenv"):
+		engine = "docker"
+	case exists("/run/.containerenv"):
+		engine = "podman"
+	case os.Getenv("container") != "":
+		engine = os.Getenv("container")
+	}
+	if engine == "" {
+		if cgroup, err := ioutil.ReadFile("/proc/self/cgroup"); err == nil {
+			for _, e := range cgroupEngines {
+				if strings.Contains(string(cgroup), e.marker) {
+					engine = e.engine
+					break
+				}
+			}
+		}
+	}
+	if engine == "" && os.Getenv(HarnessContainerEnv) != "" {
+		engine = "unknown"
+	}
+	if engine == "" {
+		return nil
+	}
+	// with its own PID namespace, the container's PID 1 is its entrypoint
+	// (or an init shim) rather than the host's init
+	comm, _ := ioutil.ReadFile("/proc/1/comm")
+	pid1 := strings.TrimSpace(string(comm))
+	return &HarnessContainer{
+		Engine:  engine,
+		HostPID: pid1 == "systemd" || pid1 == "init",
+	}
+}
+
+// IsSocket returns whether a path is a UNIX socket, e.g. an engine socket
+// mounted into the harness container
+func IsSocket(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
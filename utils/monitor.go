@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+var pageSize = uint64(os.Getpagesize())
+
+// ProcSample is the resource usage of a process (or the sum over several
+// processes) at a point in time
+type ProcSample struct {
+	// CPU is the cumulative user and system CPU time
+	CPU     time.Duration
+	RSS     uint64
+	FDs     int
+	Threads int
+}
+
+// MonitorStats holds the average and peak resource usage seen by a Monitor
+type MonitorStats struct {
+	Samples int
+	// CPU usage in percent of one CPU
+	CPUPercentAvg  float64
+	CPUPercentPeak float64
+	RSSAvg         uint64
+	RSSPeak        uint64
+	FDsAvg         float64
+	FDsPeak        int
+	ThreadsAvg     float64
+	ThreadsPeak    int
+}
+
+// Monitor periodically samples the resource usage of a set of processes,
+// e.g. the engine daemons behind a driver, summing over the processes
+type Monitor struct {
+	pids     []int
+	interval time.Duration
+	stop     chan struct{}
+	done     sync.WaitGroup
+	stats    MonitorStats
+	cpuSum   float64
+	rssSum   uint64
+	fdsSum   int
+	thrSum   int
+}
+
+// StartMonitor starts sampling the processes every interval until Stop
+func StartMonitor(pids []int, interval time.Duration) *Monitor {
+	m := &Monitor{
+		pids:     pids,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	m.done.Add(1)
+	go m.run()
+	return m
+}
+
+// Stop ends sampling and returns the statistics of the samples taken
+func (m *Monitor) Stop() MonitorStats {
+	close(m.stop)
+	m.done.Wait()
+	if n := m.stats.Samples; n > 0 {
+		m.stats.CPUPercentAvg = m.cpuSum / float64(n)
+		m.stats.RSSAvg = m.rssSum / uint64(n)
+		m.stats.FDsAvg = float64(m.fdsSum) / float64(n)
+		m.stats.ThreadsAvg = float64(m.thrSum) / float64(n)
+	}
+	return m.stats
+}
+
+func (m *Monitor) run() {
+	defer m.done.Done()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	last, lastTime := m.sample(), time.Now()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+		current, now := m.sample(), time.Now()
+		cpu := float64(current.CPU-last.CPU) / float64(now.Sub(lastTime)) * 100
+		last, lastTime = current, now
+
+		m.stats.Samples++
+		m.cpuSum += cpu
+		m.rssSum += current.RSS
+		m.fdsSum += current.FDs
+		m.thrSum += current.Threads
+		if cpu > m.stats.CPUPercentPeak {
+			m.stats.CPUPercentPeak = cpu
+		}
+		if current.RSS > m.stats.RSSPeak {
+			m.stats.RSSPeak = current.RSS
+		}
+		if current.FDs > m.stats.FDsPeak {
+			m.stats.FDsPeak = current.FDs
+		}
+		if current.Threads > m.stats.ThreadsPeak {
+			m.stats.ThreadsPeak = current.Threads
+		}
+	}
+}
+
+// sample sums the usage of all monitored processes; processes which have
+// exited are skipped
+func (m *Monitor) sample() ProcSample {
+	var total ProcSample
+	for _, pid := range m.pids {
+		s, err := SampleProcess(pid)
+		if err != nil {
+			continue
+		}
+		total.CPU += s.CPU
+		total.RSS += s.RSS
+		total.FDs += s.FDs
+		total.Threads += s.Threads
+	}
+	return total
+}
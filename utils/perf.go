@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// PerfEvents are the hardware/software events counted by PerfStat
+var PerfEvents = []string{"cycles", "instructions", "context-switches"}
+
+// PerfStat wraps a `perf stat` process counting PerfEvents for a set of
+// processes (and any children they spawn) until stopped
+type PerfStat struct {
+	cmd    *exec.Cmd
+	output bytes.Buffer
+}
+
+// StartPerfStat starts counting events for the given process IDs
+func StartPerfStat(pids []int) (*PerfStat, error) {
+	var pidList []string
+	for _, pid := range pids {
+		pidList = append(pidList, strconv.Itoa(pid))
+	}
+	p := &PerfStat{}
+	p.cmd = exec.Command("perf", "stat", "-x", ",", "-e", strings.Join(PerfEvents, ","), "-p", strings.Join(pidList, ","))
+	p.cmd.Stderr = &p.output
+	if err := p.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Error starting perf stat: %v", err)
+	}
+	return p, nil
+}
+
+// Stop ends counting and returns the total count for each event
+func (p *PerfStat) Stop() (map[string]float64, error) {
+	if err := p.cmd.Process.Signal(os.Interrupt); err != nil {
+		return nil, err
+	}
+	// perf exits non-zero when interrupted; the counts are still written
+	p.cmd.Wait()
+	return parsePerfOutput(p.output.String())
+}
+
+// parse the CSV output of `perf stat -x,` into a map of event to count
+func parsePerfOutput(out string) (map[string]float64, error) {
+	counts := make(map[string]float64)
+	scan := bufio.NewScanner(strings.NewReader(out))
+	for scan.Scan() {
+		fields := strings.Split(scan.Text(), ",")
+		if len(fields) < 3 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			// "<not counted>" or "<not supported>"
+			continue
+		}
+		event := strings.SplitN(fields[2], ":", 2)[0]
+		counts[event] = value
+	}
+	if len(counts) == 0 {
+		return nil, fmt.Errorf("No counters found in perf output: %s", strings.TrimSpace(out))
+	}
+	return counts, nil
+}
+
+// PidsOf returns the process IDs of all processes with exactly the given name
+func PidsOf(name string) []int {
+	var pids []int
+	out, err := ExecCmd("pgrep", "-x "+name)
+	if err != nil {
+		return nil
+	}
+	for _, field := range strings.Fields(out) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
@@ -0,0 +1,24 @@
+package utils
+
+// IO scheduling classes of ioprio_set(2)
+const (
+	IOClassNone       = 0
+	IOClassRealtime   = 1
+	IOClassBestEffort = 2
+	IOClassIdle       = 3
+)
+
+// CPU scheduling policies of sched_setscheduler(2)
+const (
+	SchedOther = 0
+	SchedBatch = 3
+	SchedIdle  = 5
+)
+
+// TaskPriority is the CPU and IO priority of a task (a thread of a process)
+type TaskPriority struct {
+	Nice    int
+	IOClass int
+	IOLevel int
+	Policy  int
+}
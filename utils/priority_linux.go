@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"io/ioutil"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// ioprioWhoProcess selects a single task in ioprio_get(2) and ioprio_set(2)
+const ioprioWhoProcess = 1
+
+// ioprioClassShift is the position of the class in an IO priority value
+const ioprioClassShift = 13
+
+// TasksOf returns the task (thread) IDs of a process; priorities are per task
+func TasksOf(pid int) []int {
+	entries, err := ioutil.ReadDir("/proc/" + strconv.Itoa(pid) + "/task")
+	if err != nil {
+		return nil
+	}
+	var tids []int
+	for _, entry := range entries {
+		if tid, err := strconv.Atoi(entry.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids
+}
+
+// GetTaskPriority returns the CPU and IO priority of a task
+func GetTaskPriority(tid int) (TaskPriority, error) {
+	// the raw getpriority syscall returns 20 - nice
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, tid)
+	if err != nil {
+		return TaskPriority{}, err
+	}
+	ioprio, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(tid), 0)
+	if errno != 0 {
+		return TaskPriority{}, errno
+	}
+	policy, _, errno := syscall.Syscall(syscall.SYS_SCHED_GETSCHEDULER, uintptr(tid), 0, 0)
+	if errno != 0 {
+		return TaskPriority{}, errno
+	}
+	return TaskPriority{
+		Nice:    20 - prio,
+		IOClass: int(ioprio >> ioprioClassShift),
+		IOLevel: int(ioprio & (1<<ioprioClassShift - 1)),
+		Policy:  int(policy),
+	}, nil
+}
+
+// SetTaskPriority sets the CPU and IO priority of a task; only the
+// non-realtime scheduling policies are supported
+func SetTaskPriority(tid int, p TaskPriority) error {
+	// the static priority of the non-realtime policies is always 0
+	var param struct{ priority int32 }
+	if _, _, errno := syscall.Syscall(syscall.SYS_SCHED_SETSCHEDULER, uintptr(tid), uintptr(p.Policy), uintptr(unsafe.Pointer(&param))); errno != 0 {
+		return errno
+	}
+	ioprio := p.IOClass<<ioprioClassShift | p.IOLevel
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioprio)); errno != 0 {
+		return errno
+	}
+	return syscall.Setpriority(syscall.PRIO_PROCESS, tid, p.Nice)
+}
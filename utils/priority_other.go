@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// TasksOf is only supported on Linux
+func TasksOf(pid int) []int {
+	return nil
+}
+
+// GetTaskPriority is only supported on Linux
+func GetTaskPriority(tid int) (TaskPriority, error) {
+	return TaskPriority{}, fmt.Errorf("task priorities are not read on %s", runtime.GOOS)
+}
+
+// SetTaskPriority is only supported on Linux
+func SetTaskPriority(tid int, p TaskPriority) error {
+	return fmt.Errorf("task priorities are not set on %s", runtime.GOOS)
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the kernel USER_HZ used by the CPU times of /proc/<pid>/stat;
+// it is 100 on all mainstream architectures
+const clockTicks = 100
+
+// SampleProcess reads the current resource usage of a process from /proc
+func SampleProcess(pid int) (ProcSample, error) {
+	var sample ProcSample
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return sample, err
+	}
+	// the command name may contain spaces; fields are counted after its closing paren
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	if len(fields) < 22 {
+		return sample, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	threads, _ := strconv.Atoi(fields[17])
+	rssPages, _ := strconv.ParseUint(fields[21], 10, 64)
+	sample.CPU = time.Duration(utime+stime) * time.Second / clockTicks
+	sample.Threads = threads
+	sample.RSS = rssPages * pageSize
+	fds, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+	if err == nil {
+		sample.FDs = len(fds)
+	}
+	return sample, nil
+}
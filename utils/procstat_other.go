@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+import "fmt"
+
+// SampleProcess is only supported on Linux
+func SampleProcess(pid int) (ProcSample, error) {
+	return ProcSample{}, fmt.Errorf("process sampling is only supported on Linux")
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const pressurePath = "/proc/pressure"
+
+// ReadPressure reads the cumulative stall times of the kernel's pressure stall
+// information (PSI) for CPU, memory and IO, keyed by resource and kind, e.g.
+// "memory some" (time at least one task stalled) or "io full" (time all
+// non-idle tasks stalled). Requires a Linux 4.20+ kernel with PSI enabled.
+func ReadPressure() (map[string]time.Duration, error) {
+	totals := make(map[string]time.Duration)
+	for _, resource := range []string{"cpu", "memory", "io"} {
+		f, err := os.Open(filepath.Join(pressurePath, resource))
+		if err != nil {
+			return nil, fmt.Errorf("PSI unavailable: %v", err)
+		}
+		scan := bufio.NewScanner(f)
+		for scan.Scan() {
+			// some avg10=0.00 avg60=0.00 avg300=0.00 total=12345
+			fields := strings.Fields(scan.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			for _, field := range fields[1:] {
+				if !strings.HasPrefix(field, "total=") {
+					continue
+				}
+				usecs, err := strconv.ParseInt(strings.TrimPrefix(field, "total="), 10, 64)
+				if err != nil {
+					f.Close()
+					return nil, fmt.Errorf("Error parsing %s pressure: %v", resource, err)
+				}
+				totals[resource+" "+fields[0]] = time.Duration(usecs) * time.Microsecond
+			}
+		}
+		f.Close()
+	}
+	return totals, nil
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting operations to a rate per second,
+// with bursts of up to one second's worth of operations (at least one). A nil
+// RateLimiter does not limit anything.
+type RateLimiter struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a token bucket for perSecond operations per second,
+// or nil (unlimited) if perSecond is not positive
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	burst := math.Max(1, math.Floor(perSecond))
+	return &RateLimiter{rate: perSecond, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait blocks until the bucket holds a token for one operation and takes it,
+// or returns the context's error if it is done first
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// the token is taken now, leaving the bucket in debt until it refills,
+	// so concurrent waiters queue up behind each other
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// FreeDisk returns the bytes available to unprivileged users on the
+// filesystem of a path; a path which does not exist yet is measured on the
+// filesystem of its nearest existing parent, where it would be created
+func FreeDisk(path string) (uint64, error) {
+	for {
+		if _, err := os.Stat(path); err == nil || filepath.Dir(path) == path {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, err
+	}
+	return fs.Bavail * uint64(fs.Bsize), nil
+}
+
+// FreeMemory returns the memory available for new workloads without
+// swapping (MemAvailable) in bytes
+func FreeMemory() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		// MemAvailable:    1234567 kB
+		fields := strings.Fields(scan.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			return kb << 10, err
+		}
+	}
+	return 0, fmt.Errorf("MemAvailable not found in /proc/meminfo")
+}
+
+// OpenFilesLimit returns the soft limit of open files of a process, or of
+// bucketbench itself for pid 0
+func OpenFilesLimit(pid int) (uint64, error) {
+	if pid == 0 {
+		var rlim syscall.Rlimit
+		if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+			return 0, err
+		}
+		return rlim.Cur, nil
+	}
+	limits, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(limits), "\n") {
+		// Max open files            1048576              1048576              files
+		if strings.HasPrefix(line, "Max open files") {
+			fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+			if len(fields) > 0 && fields[0] == "unlimited" {
+				return ^uint64(0), nil
+			}
+			if len(fields) > 0 {
+				return strconv.ParseUint(fields[0], 10, 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("Max open files not found in /proc/%d/limits", pid)
+}
+
+// PidsLimit returns the number of processes (and threads) which can exist,
+// the lowest of the kernel's pid_max and threads-max and the pids.max of
+// bucketbench's cgroup, along with the setting it comes from
+func PidsLimit() (uint64, string, error) {
+	var (
+		limit  = ^uint64(0)
+		source string
+	)
+	for _, setting := range []string{"/proc/sys/kernel/pid_max", "/proc/sys/kernel/threads-max", cgroupPidsMax()} {
+		data, err := ioutil.ReadFile(setting)
+		if err != nil {
+			continue
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			// "max" in a cgroup is unlimited
+			continue
+		}
+		if value < limit {
+			limit, source = value, setting
+		}
+	}
+	if source == "" {
+		return 0, "", fmt.Errorf("no pids limit found under /proc/sys/kernel")
+	}
+	return limit, source, nil
+}
+
+// cgroupPidsMax returns the pids.max file of the cgroup (v2) of bucketbench
+func cgroupPidsMax() string {
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return filepath.Join("/sys/fs/cgroup", strings.TrimPrefix(line, "0::"), "pids.max")
+		}
+	}
+	return ""
+}
+
+// Sysctl returns the value of a numeric kernel tunable such as
+// net.core.somaxconn; of a tunable with several values, the first is returned
+func Sysctl(name string) (uint64, error) {
+	data, err := ioutil.ReadFile(filepath.Join("/proc/sys", strings.Replace(name, ".", "/", -1)))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("sysctl %s is empty", name)
+	}
+	return strconv.ParseUint(fields[0], 10, 64)
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// FreeDisk is only supported on Linux
+func FreeDisk(path string) (uint64, error) {
+	return 0, fmt.Errorf("free disk space is not measured on %s", runtime.GOOS)
+}
+
+// FreeMemory is only supported on Linux
+func FreeMemory() (uint64, error) {
+	return 0, fmt.Errorf("free memory is not measured on %s", runtime.GOOS)
+}
+
+// OpenFilesLimit is only supported on Linux
+func OpenFilesLimit(pid int) (uint64, error) {
+	return 0, fmt.Errorf("open files limits are not read on %s", runtime.GOOS)
+}
+
+// PidsLimit is only supported on Linux
+func PidsLimit() (uint64, string, error) {
+	return 0, "", fmt.Errorf("pids limits are not read on %s", runtime.GOOS)
+}
+
+// Sysctl is only supported on Linux
+func Sysctl(name string) (uint64, error) {
+	return 0, fmt.Errorf("sysctls are not read on %s", runtime.GOOS)
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunQueueDelay returns the total time every thread of the processes has
+// spent runnable but waiting for a CPU, from the run queue wait time of
+// /proc/<pid>/task/<tid>/schedstat (requires schedstats, enabled on all
+// mainstream kernels). Threads which exited are not counted, so the deltas of
+// a process creating and ending threads may be slightly low.
+func RunQueueDelay(pids []int) (time.Duration, error) {
+	var total time.Duration
+	for _, pid := range pids {
+		tasks, err := filepath.Glob(fmt.Sprintf("/proc/%d/task/*/schedstat", pid))
+		if err != nil {
+			return 0, err
+		}
+		if len(tasks) == 0 {
+			return 0, fmt.Errorf("no schedstat for process %d", pid)
+		}
+		for _, task := range tasks {
+			data, err := ioutil.ReadFile(task)
+			if err != nil {
+				// the thread exited
+				continue
+			}
+			// cpu time, run queue wait time and timeslices, in nanoseconds
+			fields := strings.Fields(string(data))
+			if len(fields) < 2 {
+				return 0, fmt.Errorf("unexpected format of %s", task)
+			}
+			wait, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("unexpected format of %s: %v", task, err)
+			}
+			total += time.Duration(wait)
+		}
+	}
+	return total, nil
+}
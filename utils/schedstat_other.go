@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// RunQueueDelay is only supported on Linux
+func RunQueueDelay(pids []int) (time.Duration, error) {
+	return 0, fmt.Errorf("scheduling delay sampling is only supported on Linux")
+}
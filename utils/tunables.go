@@ -0,0 +1,28 @@
+package utils
+
+// TunableNofile names the open files limit of bucketbench among the
+// tunables; the other tunables are sysctls
+const TunableNofile = "nofile"
+
+// SnapshotTunables are the limits and kernel tunables recorded with every
+// result, as they silently cap the container density and rates reached
+var SnapshotTunables = []string{TunableNofile, "kernel.pid_max", "kernel.threads-max", "net.core.somaxconn"}
+
+// ReadTunable returns the value of a tunable: nofile or a sysctl name
+func ReadTunable(name string) (uint64, error) {
+	if name == TunableNofile {
+		return OpenFilesLimit(0)
+	}
+	return Sysctl(name)
+}
+
+// ReadTunables returns the values of the tunables which can be read on the host
+func ReadTunables(names []string) map[string]uint64 {
+	values := make(map[string]uint64)
+	for _, name := range names {
+		if value, err := ReadTunable(name); err == nil {
+			values[name] = value
+		}
+	}
+	return values
+}
@@ -1,8 +1,7 @@
-// +build !windows
-
 package utils
 
 import (
+	"context"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -25,31 +24,103 @@ func ResolveBinary(binname string) (string, error) {
 // ExecTimedCmdNoOut executes a command and returns any errors, but ignores output
 // This function also times the command and returns the elapsed milliseconds
 func ExecTimedCmdNoOut(cmd, args string) (string, int, error) {
-	start := time.Now()
 	execCmd := exec.Command(cmd, strings.Split(args, " ")...)
 	execCmd.Stdin = nil
 	execCmd.Stdout = nil
 	execCmd.Stderr = nil
-	err := execCmd.Run()
-	elapsed := time.Since(start)
-	msElapsed := int(elapsed.Nanoseconds() / 1000000)
-	return "", msElapsed, err
+	_, elapsed, err := timedClient(context.Background(), execCmd, false)
+	return "", elapsed, err
 }
 
 // ExecTimedCmd executes a command and returns the combined err/out output and any errors
 // This function also times the command and returns the elapsed milliseconds
 func ExecTimedCmd(cmd, args string) (string, int, error) {
-	start := time.Now()
-	execCmd := exec.Command(cmd, strings.Split(args, " ")...)
-	out, err := execCmd.CombinedOutput()
-	elapsed := time.Since(start)
-	msElapsed := int(elapsed.Nanoseconds() / 1000000)
-	return string(out), msElapsed, err
+	out, elapsed, _, err := ExecTimedCmdUsage(context.Background(), cmd, args)
+	return out, elapsed, err
+}
+
+// Usage is the CPU time consumed by an executed command
+type Usage struct {
+	User   time.Duration
+	System time.Duration
+}
+
+// ExecTimedCmdUsage is ExecTimedCmd which also returns the user and system CPU
+// time used by the command process; the process is killed if ctx is done first
+func ExecTimedCmdUsage(ctx context.Context, cmd, args string) (string, int, Usage, error) {
+	execCmd := exec.CommandContext(ctx, cmd, strings.Split(args, " ")...)
+	out, elapsed, err := timedClient(ctx, execCmd, true)
+	return out, elapsed, processUsage(execCmd), err
+}
+
+// ExecTimedCmdNoOutUsage is ExecTimedCmdNoOut which also returns the user and
+// system CPU time used by the command process; the process is killed if ctx is
+// done first
+func ExecTimedCmdNoOutUsage(ctx context.Context, cmd, args string) (string, int, Usage, error) {
+	execCmd := exec.CommandContext(ctx, cmd, strings.Split(args, " ")...)
+	_, elapsed, err := timedClient(ctx, execCmd, false)
+	return "", elapsed, processUsage(execCmd), err
+}
+
+// ExecTimedArgsUsage is ExecTimedCmdUsage for a command whose arguments are
+// passed as they are, so an argument may contain spaces
+func ExecTimedArgsUsage(ctx context.Context, cmd string, args ...string) (string, int, Usage, error) {
+	execCmd := exec.CommandContext(ctx, cmd, args...)
+	out, elapsed, err := timedClient(ctx, execCmd, true)
+	return out, elapsed, processUsage(execCmd), err
+}
+
+// ExecTimedShellCmdUsage is ExecTimedCmdUsage for a command line run by a
+// shell (e.g. "sh"), so its arguments may be quoted and contain spaces
+func ExecTimedShellCmdUsage(ctx context.Context, shell, cmd string) (string, int, Usage, error) {
+	execCmd := exec.CommandContext(ctx, shell, "-c", cmd)
+	out, elapsed, err := timedClient(ctx, execCmd, true)
+	return out, elapsed, processUsage(execCmd), err
+}
+
+// timedClient runs an engine client command with the client CPU affinity (see
+// SetClientAffinity) and returns its combined output, if requested, and the
+// elapsed milliseconds
+func timedClient(ctx context.Context, execCmd *exec.Cmd, output bool) (string, int, error) {
+	var (
+		start time.Time
+		out   []byte
+	)
+	err := withClientAffinity(func() error {
+		var err error
+		start = time.Now()
+		if output {
+			out, err = execCmd.CombinedOutput()
+		} else {
+			err = execCmd.Run()
+		}
+		return err
+	})
+	if start.IsZero() {
+		// the client could not be pinned and did not run
+		return "", 0, err
+	}
+	return string(out), Elapsed(ctx, start), err
+}
+
+func processUsage(cmd *exec.Cmd) Usage {
+	if cmd.ProcessState == nil {
+		return Usage{}
+	}
+	return Usage{
+		User:   cmd.ProcessState.UserTime(),
+		System: cmd.ProcessState.SystemTime(),
+	}
 }
 
 // ExecCmd executes a command and returns the combined err/out output and any errors
 func ExecCmd(cmd, args string) (string, error) {
-	execCmd := exec.Command(cmd, strings.Split(args, " ")...)
+	return ExecCmdContext(context.Background(), cmd, args)
+}
+
+// ExecCmdContext is ExecCmd which kills the command if ctx is done first
+func ExecCmdContext(ctx context.Context, cmd, args string) (string, error) {
+	execCmd := exec.CommandContext(ctx, cmd, strings.Split(args, " ")...)
 	out, err := execCmd.CombinedOutput()
 	return string(out), err
 }
@@ -57,7 +128,13 @@ func ExecCmd(cmd, args string) (string, error) {
 // ExecShellCmd executes a 'bash -c' process, with the passed-in command
 // handed to the -c flag of bash
 func ExecShellCmd(cmd string) (string, error) {
-	execCmd := exec.Command("bash", "-c", cmd)
+	return ExecShellCmdContext(context.Background(), cmd)
+}
+
+// ExecShellCmdContext is ExecShellCmd which kills the shell if ctx is done
+// first
+func ExecShellCmdContext(ctx context.Context, cmd string) (string, error) {
+	execCmd := exec.CommandContext(ctx, "bash", "-c", cmd)
 	out, err := execCmd.CombinedOutput()
 	return string(out), err
 }